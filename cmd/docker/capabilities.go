@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dockforward "dockforward/pkg"
+)
+
+// capabilitiesMaxAge is how long a server's probed capabilities are trusted before they're
+// probed again, in case docker was upgraded there
+const capabilitiesMaxAge = 24 * time.Hour
+
+// Ways the server runs Compose
+const (
+	composeV2 = "plugin"     // docker compose, Compose v2
+	composeV1 = "standalone" // docker-compose, Compose v1
+)
+
+// remoteCapabilities is what the server's docker can do
+type remoteCapabilities struct {
+	DockerVersion  string    `json:"docker_version"`  // The docker CLI's version, "" if it isn't installed
+	Compose        string    `json:"compose"`         // composeV2, composeV1 or "" for neither
+	ComposeVersion string    `json:"compose_version"` // Version of whichever Compose is used
+	Buildx         bool      `json:"buildx"`
+	ProbedAt       time.Time `json:"probed_at"`
+}
+
+// capabilitiesProbe asks the server for each capability on a line of its own, ignoring
+// what fails since a missing command is an answer too. A docker too old for --format is
+// still reported, as unknown.
+const capabilitiesProbe = `v=$(docker version --format '{{.Client.Version}}' 2>/dev/null); ` +
+	`[ -z "$v" ] && command -v docker >/dev/null && v=unknown; echo "docker=$v"; ` +
+	`echo "compose=$(docker compose version --short 2>/dev/null)"; ` +
+	`echo "docker-compose=$(docker-compose version --short 2>/dev/null)"; ` +
+	`echo "buildx=$(docker buildx version 2>/dev/null)"`
+
+// probeCapabilities asks the server at target what its docker can do
+func probeCapabilities(ctx context.Context, target string) (remoteCapabilities, error) {
+	// Only stdout, so ssh's own messages on stderr aren't taken for answers
+	output, err := sshCommandContext(ctx, target, capabilitiesProbe).Output()
+	if err != nil {
+		return remoteCapabilities{}, fmt.Errorf("failed to probe the server's docker: %w", dockforward.ClassifySSHError(err, ""))
+	}
+	return parseCapabilities(string(output)), nil
+}
+
+// parseCapabilities reads what capabilitiesProbe printed
+func parseCapabilities(output string) remoteCapabilities {
+	caps := remoteCapabilities{ProbedAt: time.Now()}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "docker":
+			caps.DockerVersion = value
+		case "compose":
+			if value != "" {
+				caps.Compose, caps.ComposeVersion = composeV2, value
+			}
+		case "docker-compose":
+			if value != "" && caps.Compose == "" {
+				caps.Compose, caps.ComposeVersion = composeV1, value
+			}
+		case "buildx":
+			caps.Buildx = value != ""
+		}
+	}
+	return caps
+}
+
+// serverCapabilities returns what the docker on server, reached at target, can do, from
+// the state file if it was probed within capabilitiesMaxAge and probing it otherwise
+func serverCapabilities(ctx context.Context, server *dockforward.ServerConfig, target string) (remoteCapabilities, error) {
+	path, err := serverStatePath(server, "capabilities.json")
+	if err != nil {
+		return remoteCapabilities{}, err
+	}
+	var caps remoteCapabilities
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &caps) == nil && time.Since(caps.ProbedAt) < capabilitiesMaxAge {
+		return caps, nil
+	}
+
+	if caps, err = probeCapabilities(ctx, target); err != nil {
+		return caps, err
+	}
+	slog.Debug("Probed the server's docker", "server", server.Name, "docker", caps.DockerVersion, "compose", caps.Compose, "compose_version", caps.ComposeVersion, "buildx", caps.Buildx)
+	// The cache only saves a round trip, so failing to write it isn't an error
+	data, _ := json.MarshalIndent(caps, "", "  ")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			slog.Debug("Failed to cache the server's capabilities", "err", err)
+		}
+	}
+	return caps, nil
+}
+
+// adapt returns args rewritten for what the server's docker can do, running compose with
+// docker-compose where the plugin is missing, or explains what's missing
+func (c remoteCapabilities) adapt(args []string) ([]string, error) {
+	if c.DockerVersion == "" {
+		return nil, fmt.Errorf("%w: docker isn't installed on the server, or isn't on the remote user's PATH", dockforward.ErrRemoteUnsupported)
+	}
+	if len(args) == 0 {
+		return args, nil
+	}
+	switch args[0] {
+	case "compose":
+		switch c.Compose {
+		case composeV2:
+			return args, nil
+		case composeV1:
+			slog.Debug("Running docker-compose, the server has no compose plugin", "version", c.ComposeVersion)
+			return append([]string{composeStandalone}, args[1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: remote docker %s lacks compose v2, and docker-compose isn't installed either; install the compose plugin or upgrade", dockforward.ErrRemoteUnsupported, c.DockerVersion)
+	case "buildx":
+		if !c.Buildx {
+			return nil, fmt.Errorf("%w: remote docker %s lacks buildx; install the buildx plugin or upgrade", dockforward.ErrRemoteUnsupported, c.DockerVersion)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	dockforward "dockforward/pkg"
+)
+
+func TestServerCapabilities(t *testing.T) {
+	// A stand-in ssh running the remote command locally, on a server with docker 19.03 and
+	// Compose v1 but neither plugin
+	bin := t.TempDir()
+	scripts := map[string]string{
+		"ssh":            "#!/bin/sh\nfor last; do :; done\necho probed >> " + filepath.Join(bin, "probes") + "\nexec sh -c \"$last\"\n",
+		"docker":         "#!/bin/sh\ncase \"$1\" in version) echo 19.03.8 ;; *) echo \"docker: '$1' is not a docker command.\" >&2; exit 1 ;; esac\n",
+		"docker-compose": "#!/bin/sh\necho 1.29.2\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+"/usr/bin:/bin")
+	t.Setenv("DOCKFORWARD_CONFIG_DIR", t.TempDir())
+
+	server := &dockforward.ServerConfig{Name: "old", Host: "old.example.invalid:22", User: "deploy"}
+	for range 2 {
+		caps, err := serverCapabilities(context.Background(), server, "deploy@old.example.invalid")
+		if err != nil {
+			t.Fatalf("serverCapabilities failed: %v", err)
+		}
+		if caps.DockerVersion != "19.03.8" || caps.Compose != composeV1 || caps.ComposeVersion != "1.29.2" || caps.Buildx {
+			t.Errorf("capabilities = %+v, want docker 19.03.8 with docker-compose 1.29.2", caps)
+		}
+	}
+	if probes, _ := os.ReadFile(filepath.Join(bin, "probes")); strings.Count(string(probes), "probed") != 1 {
+		t.Errorf("probed %d times, want once and then the cached answer", strings.Count(string(probes), "probed"))
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	caps := parseCapabilities("docker=27.3.1\ncompose=2.29.7\ndocker-compose=1.29.2\nbuildx=github.com/docker/buildx v0.17.1 257815a\n")
+	if caps.DockerVersion != "27.3.1" || caps.Compose != composeV2 || caps.ComposeVersion != "2.29.7" || !caps.Buildx {
+		t.Errorf("capabilities = %+v, want docker 27.3.1 with the compose and buildx plugins", caps)
+	}
+	if caps := parseCapabilities("docker=\ncompose=\ndocker-compose=\nbuildx=\n"); caps.DockerVersion != "" || caps.Compose != "" {
+		t.Errorf("capabilities = %+v, want nothing", caps)
+	}
+}
+
+func TestAdaptToCapabilities(t *testing.T) {
+	modern := remoteCapabilities{DockerVersion: "27.3.1", Compose: composeV2, Buildx: true}
+	old := remoteCapabilities{DockerVersion: "19.03.8", Compose: composeV1}
+	bare := remoteCapabilities{DockerVersion: "19.03.8"}
+
+	up := []string{"compose", "-p", "shop", "up", "-d"}
+	if got, err := modern.adapt(up); err != nil || !reflect.DeepEqual(got, up) {
+		t.Errorf("with the plugin, adapt = %q, %v", got, err)
+	}
+	want := []string{"docker-compose", "-p", "shop", "up", "-d"}
+	if got, err := old.adapt(up); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("with docker-compose, adapt = %q, %v, want %q", got, err, want)
+	}
+	if compose, ok := parseComposeCommand(want); !ok || compose.subcommand != "up" || compose.program() != "docker-compose" {
+		t.Errorf("docker-compose args parsed as %+v", compose)
+	}
+
+	_, err := bare.adapt(up)
+	if !errors.Is(err, dockforward.ErrRemoteUnsupported) || !strings.Contains(err.Error(), "remote docker 19.03.8 lacks compose v2") {
+		t.Errorf("without compose, adapt = %v", err)
+	}
+	if _, err := old.adapt([]string{"buildx", "build", "."}); !errors.Is(err, dockforward.ErrRemoteUnsupported) {
+		t.Errorf("without buildx, adapt = %v", err)
+	}
+	if got, err := bare.adapt([]string{"ps"}); err != nil || len(got) != 1 {
+		t.Errorf("adapt(ps) = %q, %v", got, err)
+	}
+	if _, err := (remoteCapabilities{}).adapt([]string{"ps"}); !errors.Is(err, dockforward.ErrRemoteUnsupported) || exitCode(err) != daemonUnavailableExitCode {
+		t.Errorf("without docker, adapt = %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	dockforward "dockforward/pkg"
+)
+
+// composeValueFlags are docker compose's global flags that take a value
+var composeValueFlags = map[string]bool{
+	"-f": true, "--file": true,
+	"-p": true, "--project-name": true,
+	"--profile": true, "--env-file": true, "--project-directory": true,
+	"--parallel": true, "--ansi": true, "--progress": true,
+}
+
+// composeStandalone is Compose v1's own binary, which args starting with it run instead of
+// the docker compose plugin, on servers that only have that
+const composeStandalone = "docker-compose"
+
+// composeCommand is a parsed docker compose invocation
+type composeCommand struct {
+	globals    []string // Flags before the subcommand, which pick the files, project and profiles
+	subcommand string
+	args       []string // What follows the subcommand
+	standalone bool     // Run with docker-compose rather than docker compose
+}
+
+// program returns the remote command that runs compose
+func (c composeCommand) program() string {
+	if c.standalone {
+		return composeStandalone
+	}
+	return "docker compose"
+}
+
+// parseComposeCommand splits a docker compose invocation, and reports whether args is one
+func parseComposeCommand(args []string) (composeCommand, bool) {
+	if len(args) == 0 || (args[0] != "compose" && args[0] != composeStandalone) {
+		return composeCommand{}, false
+	}
+	compose := composeCommand{standalone: args[0] == composeStandalone}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			compose.subcommand, compose.args = arg, args[i+1:]
+			return compose, true
+		}
+		compose.globals = append(compose.globals, arg)
+		if composeValueFlags[arg] && i+1 < len(args) {
+			i++
+			compose.globals = append(compose.globals, args[i])
+		}
+	}
+	return compose, true
+}
+
+// detached reports whether an up returns once the project is running, with -d, --detach or
+// --wait, rather than staying attached until it's stopped
+func (c composeCommand) detached() bool {
+	for _, arg := range c.args {
+		switch arg {
+		case "-d", "--detach", "--detach=true", "--wait", "--wait=true":
+			return true
+		}
+		// Short flags given together, such as -dV, unless one before d takes a value
+		if short, ok := strings.CutPrefix(arg, "-"); ok && !strings.HasPrefix(short, "-") {
+			if i := strings.IndexByte(short, 'd'); i >= 0 && !strings.ContainsRune(short[:i], 't') {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// composeRunValueFlags are the flags of compose exec and run that take a value, so it isn't
+// taken for the service
+var composeRunValueFlags = map[string]bool{
+	"-e": true, "--env": true, "-u": true, "--user": true, "-w": true, "--workdir": true,
+	"--index": true, "--name": true, "--entrypoint": true, "-v": true, "--volume": true,
+	"-p": true, "--publish": true, "-l": true, "--label": true, "--cap-add": true, "--cap-drop": true,
+}
+
+// interactive reports whether the command attaches a terminal to a container: attach, and
+// exec or run unless -T or -d is given before the service
+func (c composeCommand) interactive() bool {
+	switch c.subcommand {
+	case "attach":
+		return true
+	case "exec", "run":
+	default:
+		return false
+	}
+	for i := 0; i < len(c.args); i++ {
+		arg := c.args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return true // The service; what follows is the container's command
+		}
+		switch arg {
+		case "-T", "--no-TTY", "--no-tty", "--tty=false", "-d", "--detach", "--detach=true":
+			return false
+		}
+		if composeRunValueFlags[arg] {
+			i++
+		}
+	}
+	return true
+}
+
+// changesForwards reports whether the command brings a project up for good or takes it
+// down, so the monitor's forwards should follow
+func (c composeCommand) changesForwards() bool {
+	return c.subcommand == "up" && c.detached() || c.subcommand == "down"
+}
+
+// composePortNumber is a port in compose config's JSON, a string in newer releases and a
+// number in older ones
+type composePortNumber string
+
+func (n *composePortNumber) UnmarshalJSON(data []byte) error {
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		*n = composePortNumber(strconv.Itoa(number))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("invalid port %s", data)
+	}
+	*n = composePortNumber(text)
+	return nil
+}
+
+// composeConfig is the part of `docker compose config --format json` forwarding reads. It
+// only lists the services of the profiles enabled.
+type composeConfig struct {
+	Name     string `json:"name"`
+	Services map[string]struct {
+		Ports []struct {
+			Target    composePortNumber `json:"target"`
+			Published composePortNumber `json:"published"`
+			Protocol  string            `json:"protocol"`
+		} `json:"ports"`
+		Scale  int `json:"scale"`
+		Deploy *struct {
+			Replicas *int `json:"replicas"`
+		} `json:"deploy"`
+	} `json:"services"`
+}
+
+// replicas returns how many containers a service runs
+func (c composeConfig) replicas(service string) int {
+	config := c.Services[service]
+	switch {
+	case config.Deploy != nil && config.Deploy.Replicas != nil:
+		return *config.Deploy.Replicas
+	case config.Scale > 0:
+		return config.Scale
+	}
+	return 1
+}
+
+// ports lists the ports the project publishes, by service in name order, with warnings
+// about ports that can only be forwarded once: a fixed port a scaled service publishes,
+// which only one of its containers can bind, and a port two services publish
+func (c composeConfig) ports() ([]dockforward.ComposePort, []string) {
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ports []dockforward.ComposePort
+	var warnings []string
+	owners := make(map[string]string) // Service publishing each port, with its protocol
+	for _, name := range names {
+		for _, port := range c.Services[name].Ports {
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			for _, published := range expandPortRange(string(port.Published)) {
+				key := published + "/" + protocol
+				if owner, ok := owners[key]; ok && published != "" {
+					if owner != name {
+						warnings = append(warnings, fmt.Sprintf("%s and %s both publish port %s, forwarding it for %s", owner, name, published, owner))
+					}
+					continue
+				}
+				owners[key] = name
+				if replicas := c.replicas(name); replicas > 1 && published != "" {
+					warnings = append(warnings, fmt.Sprintf("%s runs %d replicas publishing port %s, which only one can bind; forwarding it once", name, replicas, published))
+				}
+				ports = append(ports, dockforward.ComposePort{Service: name, Published: published, Target: string(port.Target), Protocol: protocol})
+			}
+		}
+	}
+	return ports, warnings
+}
+
+// expandPortRange lists the ports of a published range such as 8000-8002, or the port
+// itself otherwise
+func expandPortRange(published string) []string {
+	first, last, ok := strings.Cut(published, "-")
+	if !ok {
+		return []string{published}
+	}
+	start, err1 := strconv.Atoi(first)
+	end, err2 := strconv.Atoi(last)
+	if err1 != nil || err2 != nil || end < start {
+		return []string{published}
+	}
+	ports := make([]string, 0, end-start+1)
+	for port := start; port <= end; port++ {
+		ports = append(ports, strconv.Itoa(port))
+	}
+	return ports
+}
+
+// loadComposeConfig reads the effective config of the project compose's global flags pick
+// in remoteDir on the remote host
+func loadComposeConfig(ctx context.Context, user, host, remoteDir string, forwardEnv []string, compose composeCommand) (composeConfig, error) {
+	if remoteDir == "" {
+		remoteDir = "."
+	}
+	remote := fmt.Sprintf("cd %s && %s%s %s config --format json",
+		dockforward.ShellQuote(remoteDir), envAssignments(forwardEnv), compose.program(), quoteAll(compose.globals))
+	// Only stdout, so warnings compose prints on stderr don't spoil the JSON
+	output, err := sshCommandContext(ctx, fmt.Sprintf("%s@%s", user, host), remote).Output()
+	if err != nil {
+		return composeConfig{}, fmt.Errorf("failed to read the compose config: %w", dockforward.ClassifySSHError(err, ""))
+	}
+	var config composeConfig
+	if err := json.Unmarshal(output, &config); err != nil {
+		return composeConfig{}, fmt.Errorf("failed to parse the compose config: %v", err)
+	}
+	if config.Name == "" {
+		return composeConfig{}, fmt.Errorf("compose config names no project")
+	}
+	return config, nil
+}
+
+// composeMonitor is the monitor Compose forwards are registered with, as *ipc.Client does
+type composeMonitor interface {
+	ForwardCompose(project string, ports []dockforward.ComposePort) (*dockforward.ComposeForwards, error)
+	StopCompose(project string, ports []dockforward.ComposePort) ([]string, error)
+}
+
+// updateComposeForwards has the monitor forward the ports of a project compose just
+// brought up, or stop forwarding those of one it took down. The command already succeeded,
+// so failures are only logged.
+func updateComposeForwards(monitor composeMonitor, config composeConfig, compose composeCommand) {
+	ports, warnings := config.ports()
+	for _, warning := range warnings {
+		slog.Warn(warning, "project", config.Name)
+	}
+
+	if compose.subcommand == "down" {
+		stopped, err := monitor.StopCompose(config.Name, ports)
+		if err != nil {
+			slog.Warn("Failed to stop forwarding the project's ports", "project", config.Name, "err", err)
+			return
+		}
+		if len(stopped) > 0 {
+			slog.Info("Stopped forwarding", "project", config.Name, "ports", strings.Join(stopped, ","))
+		}
+		return
+	}
+
+	if len(ports) == 0 {
+		return
+	}
+	forwards, err := monitor.ForwardCompose(config.Name, ports)
+	if err != nil {
+		slog.Warn("Failed to forward the project's ports", "project", config.Name, "err", err)
+		return
+	}
+	for _, warning := range forwards.Warnings {
+		slog.Warn(warning, "project", config.Name)
+	}
+	for _, forward := range forwards.Forwards {
+		slog.Info("Forwarded", "service", forward.Service, "port", forward.Remote, "address", forward.Address)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	dockforward "dockforward/pkg"
+)
+
+func TestParseComposeCommand(t *testing.T) {
+	compose, ok := parseComposeCommand([]string{"compose", "-f", "compose.yaml", "--profile", "debug", "--dry-run", "up", "-d", "web"})
+	if !ok {
+		t.Fatal("compose command not recognised")
+	}
+	want := composeCommand{
+		globals:    []string{"-f", "compose.yaml", "--profile", "debug", "--dry-run"},
+		subcommand: "up",
+		args:       []string{"-d", "web"},
+	}
+	if !reflect.DeepEqual(compose, want) {
+		t.Errorf("parseComposeCommand = %+v, want %+v", compose, want)
+	}
+	if _, ok := parseComposeCommand([]string{"ps"}); ok {
+		t.Error("docker ps taken for a compose command")
+	}
+
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"compose", "up", "-d"}, true},
+		{[]string{"compose", "up", "--wait"}, true},
+		{[]string{"compose", "up", "-dV"}, true},
+		{[]string{"compose", "up", "--detach=false"}, false},
+		{[]string{"compose", "up"}, false},
+		{[]string{"compose", "-p", "demo", "down", "-v"}, true},
+		{[]string{"compose", "ps"}, false},
+	}
+	for _, tt := range tests {
+		compose, _ := parseComposeCommand(tt.args)
+		if got := compose.changesForwards(); got != tt.want {
+			t.Errorf("%q changes forwards = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+// parseConfig decodes compose config JSON
+func parseConfig(t *testing.T, data string) composeConfig {
+	t.Helper()
+	var config composeConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	return config
+}
+
+func TestComposeConfigPorts(t *testing.T) {
+	config := parseConfig(t, `{"name": "shop", "services": {
+		"web": {"ports": [{"target": 80, "published": "8080", "protocol": "tcp"}], "deploy": {"replicas": 3}},
+		"api": {"ports": [{"target": 3000, "published": 8080}, {"target": 9000}]},
+		"db": {"ports": [{"target": 5432, "published": "5432"}]},
+		"metrics": {"ports": [{"target": 9100, "published": "9100-9101", "protocol": "udp"}]}
+	}}`)
+	ports, warnings := config.ports()
+	want := []dockforward.ComposePort{
+		{Service: "api", Published: "8080", Target: "3000", Protocol: "tcp"},
+		{Service: "api", Target: "9000", Protocol: "tcp"},
+		{Service: "db", Published: "5432", Target: "5432", Protocol: "tcp"},
+		{Service: "metrics", Published: "9100", Target: "9100", Protocol: "udp"},
+		{Service: "metrics", Published: "9101", Target: "9100", Protocol: "udp"},
+	}
+	if !reflect.DeepEqual(ports, want) {
+		t.Errorf("ports = %+v, want %+v", ports, want)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "api and web both publish port 8080") {
+		t.Errorf("warnings = %q, want one about the conflict on 8080", warnings)
+	}
+
+	scaled := parseConfig(t, `{"name": "shop", "services": {"web": {"ports": [{"target": 80, "published": "8080"}, {"target": 443}], "scale": 2}}}`)
+	if _, warnings := scaled.ports(); len(warnings) != 1 || !strings.Contains(warnings[0], "2 replicas publishing port 8080") {
+		t.Errorf("warnings = %q, want one about the scaled fixed port only", warnings)
+	}
+}
+
+// composeRecorder records what the wrapper asks the monitor for
+type composeRecorder struct {
+	project string
+	ports   []dockforward.ComposePort
+	stopped bool
+}
+
+func (r *composeRecorder) ForwardCompose(project string, ports []dockforward.ComposePort) (*dockforward.ComposeForwards, error) {
+	r.project, r.ports = project, ports
+	return &dockforward.ComposeForwards{}, nil
+}
+
+func (r *composeRecorder) StopCompose(project string, ports []dockforward.ComposePort) ([]string, error) {
+	r.project, r.ports, r.stopped = project, ports, true
+	return []string{"8080"}, nil
+}
+
+func TestUpdateComposeForwards(t *testing.T) {
+	config := parseConfig(t, `{"name": "shop", "services": {"web": {"ports": [{"target": 80, "published": "8080"}]}, "worker": {}}}`)
+	want := []dockforward.ComposePort{{Service: "web", Published: "8080", Target: "80", Protocol: "tcp"}}
+
+	up := &composeRecorder{}
+	compose, _ := parseComposeCommand([]string{"compose", "up", "-d"})
+	updateComposeForwards(up, config, compose)
+	if up.project != "shop" || up.stopped || !reflect.DeepEqual(up.ports, want) {
+		t.Errorf("up asked the monitor for %+v", up)
+	}
+
+	down := &composeRecorder{}
+	compose, _ = parseComposeCommand([]string{"compose", "down"})
+	updateComposeForwards(down, config, compose)
+	if down.project != "shop" || !down.stopped || !reflect.DeepEqual(down.ports, want) {
+		t.Errorf("down asked the monitor for %+v", down)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	dockforward "dockforward/pkg"
+	dfsync "dockforward/pkg/sync"
+)
+
+// contextsSuffix names the sibling of the remote project directory that build contexts
+// outside the project are synced into, which cleanup removes along with the project's
+const contextsSuffix = "-contexts"
+
+// overrideFileName is the compose file, in the staging directory, pointing services that
+// build outside the project at their synced contexts
+const overrideFileName = "dockforward.override.yaml"
+
+// composeBuildFile is the part of a compose file build contexts are read from
+type composeBuildFile struct {
+	Services map[string]struct {
+		Build any `yaml:"build"` // The context, or a mapping with context and dockerfile
+	} `yaml:"services"`
+}
+
+// buildContexts returns each service's build context in the compose file at path, as
+// written, skipping services that use an image
+func buildContexts(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file composeBuildFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	contexts := make(map[string]string)
+	for name, service := range file.Services {
+		switch build := service.Build.(type) {
+		case string:
+			contexts[name] = build
+		case map[string]any:
+			dir, _ := build["context"].(string)
+			if dir == "" {
+				dir = "."
+			}
+			contexts[name] = dir
+		}
+	}
+	return contexts, nil
+}
+
+// interpolate replaces the $VAR, ${VAR}, ${VAR:-default} and ${VAR-default} compose allows
+// in a value with the local environment
+func interpolate(value string) string {
+	return os.Expand(value, func(name string) string {
+		if name, fallback, ok := strings.Cut(name, ":-"); ok {
+			if value := os.Getenv(name); value != "" {
+				return value
+			}
+			return fallback
+		}
+		if name, fallback, ok := strings.Cut(name, "-"); ok {
+			if value, set := os.LookupEnv(name); set {
+				return value
+			}
+			return fallback
+		}
+		return os.Getenv(name)
+	})
+}
+
+// remoteContext reports whether compose fetches a build context itself, from a git
+// repository or URL, rather than reading a directory
+func remoteContext(dir string) bool {
+	return strings.Contains(dir, "://") || strings.HasPrefix(dir, "git@") || strings.HasSuffix(dir, ".git")
+}
+
+// localComposeFiles returns the compose files compose's global flags pick in dir, or the
+// one it would find there itself, skipping those that don't exist locally
+func localComposeFiles(dir string, compose composeCommand) []string {
+	var files []string
+	for i := 0; i+1 < len(compose.globals); i++ {
+		if flag := compose.globals[i]; flag == "-f" || flag == "--file" {
+			i++
+			file := compose.globals[i]
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			if _, err := os.Stat(file); err == nil {
+				files = append(files, file)
+			}
+		}
+	}
+	if len(files) > 0 {
+		return files
+	}
+	for _, name := range composeFileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return []string{filepath.Join(dir, name)}
+		}
+	}
+	return nil
+}
+
+// stagedDir is a directory outside the project a build context needs, synced into the
+// staging directory
+type stagedDir struct {
+	local  string // Absolute local directory
+	staged string // Where it goes under the staging directory, slash-separated
+}
+
+// contextPlan says which build contexts outside the project are synced where
+type contextPlan struct {
+	projectDir string            // Directory compose resolves contexts against, under the synced one
+	dirs       []stagedDir       // Directories to sync, none inside another
+	contexts   map[string]string // Local directory of each service building outside the project
+	root       string            // Common ancestor of the project and the staged directories
+	warnings   []string
+}
+
+// planBuildContexts finds the build contexts of the compose project dir holds that fall
+// outside dir, and plans where they're synced so their layout relative to each other is
+// kept. Git URLs and absolute paths are left for compose, with a warning.
+func planBuildContexts(dir string, compose composeCommand) (contextPlan, error) {
+	plan := contextPlan{contexts: make(map[string]string)}
+	files := localComposeFiles(dir, compose)
+	if len(files) == 0 {
+		return plan, nil
+	}
+	plan.projectDir = filepath.Dir(files[0])
+	for i := 0; i+1 < len(compose.globals); i++ {
+		if compose.globals[i] == "--project-directory" {
+			plan.projectDir = filepath.Join(dir, compose.globals[i+1])
+		}
+	}
+
+	// Later files override the contexts of earlier ones, as compose merges them
+	contexts := make(map[string]string)
+	for _, file := range files {
+		found, err := buildContexts(file)
+		if err != nil {
+			return plan, err
+		}
+		for service, dir := range found {
+			contexts[service] = dir
+		}
+	}
+	services := make([]string, 0, len(contexts))
+	for service := range contexts {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var outside []string
+	for _, service := range services {
+		build := interpolate(contexts[service])
+		switch {
+		case remoteContext(build):
+			plan.warnings = append(plan.warnings, fmt.Sprintf("%s builds from %s, which the server fetches itself", service, build))
+			continue
+		case filepath.IsAbs(build) || strings.HasPrefix(build, "~"):
+			plan.warnings = append(plan.warnings, fmt.Sprintf("%s builds in %s, an absolute path that must exist on the server", service, build))
+			continue
+		}
+		local := filepath.Join(plan.projectDir, build)
+		if within(dir, local) {
+			continue
+		}
+		plan.contexts[service] = local
+		outside = append(outside, local)
+	}
+	if len(outside) == 0 {
+		return plan, nil
+	}
+
+	// Only the outermost directories are synced, the others come along inside them
+	sort.Strings(outside)
+	plan.root = dir
+	for _, local := range outside {
+		for !within(plan.root, local) && filepath.Dir(plan.root) != plan.root {
+			plan.root = filepath.Dir(plan.root)
+		}
+		if !slices.ContainsFunc(plan.dirs, func(staged stagedDir) bool { return within(staged.local, local) }) {
+			plan.dirs = append(plan.dirs, stagedDir{local: local})
+		}
+	}
+	for i := range plan.dirs {
+		rel, _ := filepath.Rel(plan.root, plan.dirs[i].local)
+		plan.dirs[i].staged = filepath.ToSlash(rel)
+	}
+	return plan, nil
+}
+
+// within reports whether target is dir or inside it
+func within(dir, target string) bool {
+	rel, err := filepath.Rel(dir, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// stagingDir returns the remote directory build contexts outside the project synced to
+// remoteDir go to
+func stagingDir(remoteDir string) string {
+	return path.Clean(remoteDir) + contextsSuffix
+}
+
+// syncOptions returns how each staged directory is synced for the project synced with opts
+func (p contextPlan) syncOptions(opts dfsync.SyncOptions) []dfsync.SyncOptions {
+	var all []dfsync.SyncOptions
+	for _, dir := range p.dirs {
+		staged := opts
+		staged.LocalDir = dir.local
+		staged.RemoteDir = path.Join(stagingDir(opts.RemoteDir), dir.staged)
+		all = append(all, staged)
+	}
+	return all
+}
+
+// stagedPath returns where local, outside the project, is on the server, relative to the
+// parent of remoteDir, which the project is synced to
+func (p contextPlan) stagedPath(remoteDir, local string) string {
+	rel, _ := filepath.Rel(p.root, local)
+	return path.Join(path.Base(stagingDir(remoteDir)), filepath.ToSlash(rel))
+}
+
+// override returns the compose file pointing each service building outside the project at
+// its staged context, relative to the project directory as compose resolves it
+func (p contextPlan) override(dir, remoteDir string) ([]byte, error) {
+	rel, err := filepath.Rel(dir, p.projectDir)
+	if err != nil {
+		return nil, err
+	}
+	project := path.Join(path.Base(path.Clean(remoteDir)), filepath.ToSlash(rel))
+	services := make(map[string]any, len(p.contexts))
+	for service, local := range p.contexts {
+		staged, err := filepath.Rel(filepath.FromSlash(project), filepath.FromSlash(p.stagedPath(remoteDir, local)))
+		if err != nil {
+			return nil, err
+		}
+		services[service] = map[string]any{"build": map[string]any{"context": filepath.ToSlash(staged)}}
+	}
+	return yaml.Marshal(map[string]any{"services": services})
+}
+
+// overrideFile returns the override's path relative to remoteDir, where compose runs
+func overrideFile(remoteDir string) string {
+	return path.Join("..", path.Base(stagingDir(remoteDir)), overrideFileName)
+}
+
+// writeOverride writes the plan's override file into the staging directory of remoteDir
+// on the server at target, after the staged directories are synced
+func (p contextPlan) writeOverride(ctx context.Context, target, dir, remoteDir string) error {
+	data, err := p.override(dir, remoteDir)
+	if err != nil {
+		return fmt.Errorf("failed to write the compose override: %v", err)
+	}
+	staging := stagingDir(remoteDir)
+	cmd := sshCommandContext(ctx, target, fmt.Sprintf("mkdir -p %s && cat > %s",
+		dockforward.ShellQuote(staging), dockforward.ShellQuote(path.Join(staging, overrideFileName))))
+	cmd.Stdin = strings.NewReader(string(data))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write the compose override: %w", dockforward.ClassifySSHError(err, string(output)))
+	}
+	return nil
+}
+
+// withComposeFile returns compose args with file added after the files they already name,
+// so it overrides them
+func withComposeFile(args []string, file string) []string {
+	compose, ok := parseComposeCommand(args)
+	if !ok || compose.subcommand == "" {
+		return args
+	}
+	updated := append([]string{args[0]}, compose.globals...)
+	updated = append(updated, "-f", file, compose.subcommand)
+	return append(updated, compose.args...)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	dockforward "dockforward/pkg"
+	dfsync "dockforward/pkg/sync"
+)
+
+const contextsCompose = `services:
+  api:
+    build: ./api
+  worker:
+    build:
+      context: ../shared-lib
+      dockerfile: worker.Dockerfile
+  tools:
+    build: ../shared-lib/tools
+  proto:
+    build: ${PROTO_DIR:-../proto}
+  remote:
+    build: https://github.com/example/remote.git#main
+  system:
+    build: /opt/images/system
+  db:
+    image: postgres:16
+`
+
+func TestPlanBuildContexts(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	for _, dir := range []string{"app/api", "shared-lib/tools", "proto"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(app, "compose.yaml"), []byte(contextsCompose), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	compose, _ := parseComposeCommand([]string{"compose", "build"})
+	plan, err := planBuildContexts(app, compose)
+	if err != nil {
+		t.Fatalf("planBuildContexts failed: %v", err)
+	}
+	// The tools context comes along inside shared-lib, and api is in the project already
+	want := []stagedDir{{local: filepath.Join(root, "proto"), staged: "proto"}, {local: filepath.Join(root, "shared-lib"), staged: "shared-lib"}}
+	if !reflect.DeepEqual(plan.dirs, want) {
+		t.Errorf("staged %+v, want %+v", plan.dirs, want)
+	}
+	if len(plan.warnings) != 2 || !strings.Contains(plan.warnings[0], "https://github.com/example/remote.git#main") || !strings.Contains(plan.warnings[1], "/opt/images/system") {
+		t.Errorf("warnings = %q, want the git URL and the absolute path", plan.warnings)
+	}
+
+	opts := plan.syncOptions(dfsync.SyncOptions{LocalDir: app, RemoteDir: "/tmp/docker-context-abc", BwLimit: "500K"})
+	if len(opts) != 2 || opts[1].LocalDir != filepath.Join(root, "shared-lib") || opts[1].RemoteDir != "/tmp/docker-context-abc-contexts/shared-lib" || opts[1].BwLimit != "500K" {
+		t.Errorf("sync options = %+v", opts)
+	}
+
+	data, err := plan.override(app, "/tmp/docker-context-abc")
+	if err != nil {
+		t.Fatalf("override failed: %v", err)
+	}
+	var override struct {
+		Services map[string]struct {
+			Build struct {
+				Context string `yaml:"context"`
+			} `yaml:"build"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &override); err != nil {
+		t.Fatalf("override isn't YAML: %v\n%s", err, data)
+	}
+	contexts := map[string]string{}
+	for service, config := range override.Services {
+		contexts[service] = config.Build.Context
+	}
+	wantContexts := map[string]string{
+		"worker": "../docker-context-abc-contexts/shared-lib",
+		"tools":  "../docker-context-abc-contexts/shared-lib/tools",
+		"proto":  "../docker-context-abc-contexts/proto",
+	}
+	if !reflect.DeepEqual(contexts, wantContexts) {
+		t.Errorf("override contexts = %v, want %v", contexts, wantContexts)
+	}
+
+	// The variable picks another directory, and a compose file in a subdirectory moves the
+	// project directory with it
+	t.Setenv("PROTO_DIR", "./api")
+	if err := os.MkdirAll(filepath.Join(app, "deploy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(app, "deploy", "compose.yaml"), []byte("services:\n  web:\n    build: ../../shared-lib\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	compose, _ = parseComposeCommand([]string{"compose", "-f", "deploy/compose.yaml", "up", "-d"})
+	if plan, err = planBuildContexts(app, compose); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = plan.override(app, "/tmp/docker-context-abc"); err != nil || !strings.Contains(string(data), "context: ../../docker-context-abc-contexts/shared-lib") {
+		t.Errorf("override from a subdirectory = %s, %v", data, err)
+	}
+}
+
+func TestPlanBuildContextsInside(t *testing.T) {
+	app := t.TempDir()
+	if err := os.WriteFile(filepath.Join(app, "docker-compose.yml"), []byte("services:\n  api:\n    build:\n      dockerfile: Dockerfile\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	compose, _ := parseComposeCommand([]string{"compose", "build"})
+	plan, err := planBuildContexts(app, compose)
+	if err != nil || len(plan.dirs) != 0 || len(plan.warnings) != 0 {
+		t.Errorf("plan = %+v, %v, want nothing to stage", plan, err)
+	}
+}
+
+func TestWithComposeFile(t *testing.T) {
+	got := withComposeFile([]string{"compose", "-f", "compose.yaml", "-p", "shop", "build", "api"}, "../x-contexts/dockforward.override.yaml")
+	want := []string{"compose", "-f", "compose.yaml", "-p", "shop", "-f", "../x-contexts/dockforward.override.yaml", "build", "api"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withComposeFile = %q, want %q", got, want)
+	}
+	if got := overrideFile("/tmp/docker-context-abc"); got != "../docker-context-abc-contexts/dockforward.override.yaml" {
+		t.Errorf("overrideFile = %q", got)
+	}
+}
+
+func TestSyncContextStaged(t *testing.T) {
+	t.Setenv("DOCKFORWARD_CONFIG_DIR", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	server := &dockforward.ServerConfig{Name: "staging", Host: "staging.example.com:22", User: "deploy"}
+	syncer := &dfsync.MockSyncer{}
+	opts := dfsync.SyncOptions{LocalDir: "/src/app", RemoteDir: "/tmp/docker-context-abc"}
+	staged := []dfsync.SyncOptions{
+		{LocalDir: "/src/proto", RemoteDir: "/tmp/docker-context-abc-contexts/proto"},
+		{LocalDir: "/src/shared-lib", RemoteDir: "/tmp/docker-context-abc-contexts/shared-lib"},
+	}
+	if err := syncContext(context.Background(), syncer, server, nil, opts, staged...); err != nil {
+		t.Fatalf("syncContext failed: %v", err)
+	}
+	var synced []string
+	for _, opts := range syncer.Syncs {
+		synced = append(synced, opts.LocalDir)
+	}
+	sort.Strings(synced)
+	if want := []string{"/src/app", "/src/proto", "/src/shared-lib"}; !reflect.DeepEqual(synced, want) {
+		t.Errorf("synced %q, want %q", synced, want)
+	}
+	if dir, _ := readLastRemoteDir(server); dir != "/tmp/docker-context-abc" {
+		t.Errorf("last context = %q, want the project's", dir)
+	}
+
+	syncer.Err = dockforward.ErrRemoteDiskFull
+	err := syncContext(context.Background(), syncer, server, nil, opts, staged...)
+	if !errors.Is(err, dockforward.ErrRemoteDiskFull) || !strings.Contains(err.Error(), "failed to sync build context /src/shared-lib") {
+		t.Errorf("syncContext = %v, want each failure", err)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dockforward "dockforward/pkg"
+	dfsync "dockforward/pkg/sync"
+)
+
+// copyStagePrefix names the remote directories copies are staged in, which are removed
+// after each copy
+const copyStagePrefix = "/tmp/dockforward-cp-"
+
+// copyCleanupTimeout limits removing the staging directory, which runs even after the copy
+// was interrupted
+const copyCleanupTimeout = 30 * time.Second
+
+// copyArg is one side of a docker cp: a path in container, or on this machine if container
+// is empty
+type copyArg struct {
+	container string
+	path      string
+}
+
+// copyCommand is a parsed docker cp
+type copyCommand struct {
+	options []string // docker cp's own options, such as -a or -L, passed on to it
+	quiet   bool
+	src     copyArg
+	dest    copyArg
+}
+
+// copyArguments returns the arguments of a docker cp or docker container cp, and whether
+// args is one
+func copyArguments(args []string) ([]string, bool) {
+	switch {
+	case len(args) > 0 && args[0] == "cp":
+		return args[1:], true
+	case len(args) > 1 && args[0] == "container" && args[1] == "cp":
+		return args[2:], true
+	}
+	return nil, false
+}
+
+// splitCopyArg splits a docker cp argument the way docker does: CONTAINER:PATH, unless it's
+// an absolute path or what comes before the colon starts with ".", which are local paths
+func splitCopyArg(arg string) copyArg {
+	if filepath.IsAbs(arg) {
+		return copyArg{path: arg}
+	}
+	container, path, found := strings.Cut(arg, ":")
+	if !found || strings.HasPrefix(container, ".") {
+		return copyArg{path: arg}
+	}
+	return copyArg{container: container, path: path}
+}
+
+// parseCopyArgs parses the arguments after cp, which copy between one container and this
+// machine
+func parseCopyArgs(args []string) (copyCommand, error) {
+	var cp copyCommand
+	var paths []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			cp.options = append(cp.options, arg)
+			if arg == "--quiet" || !strings.HasPrefix(arg, "--") && strings.Contains(arg, "q") {
+				cp.quiet = true
+			}
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	if len(paths) != 2 {
+		return cp, fmt.Errorf("cp takes a source and a destination, got %d paths", len(paths))
+	}
+	if paths[0] == "-" || paths[1] == "-" {
+		return cp, fmt.Errorf("cp can't stream a tar archive with - through dockforward")
+	}
+	cp.src, cp.dest = splitCopyArg(paths[0]), splitCopyArg(paths[1])
+	switch {
+	case cp.src.container != "" && cp.dest.container != "":
+		return cp, fmt.Errorf("copying between containers is not supported")
+	case cp.src.container == "" && cp.dest.container == "":
+		return cp, fmt.Errorf("must specify at least one container source")
+	}
+	return cp, nil
+}
+
+// copiesContents reports whether a source path ends in "/." or is ".", which docker cp
+// reads as copying the directory's contents rather than the directory itself
+func copiesContents(path string) bool {
+	return filepath.Base(path) == "."
+}
+
+// localCopyTarget returns where a copy of a source named base lands for dest on this
+// machine, following docker cp: into an existing directory under the source's name, or as
+// dest itself. A directory source with contents set always fills dest.
+func localCopyTarget(dest, base string, isDir, contents bool) (string, error) {
+	info, err := os.Stat(dest)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("invalid destination %s: %v", dest, err)
+	}
+	trailingSlash := strings.HasSuffix(dest, string(os.PathSeparator))
+
+	if !isDir {
+		switch {
+		case exists && info.IsDir():
+			return filepath.Join(dest, base), nil
+		case !exists && trailingSlash:
+			return "", fmt.Errorf("destination directory %s does not exist", dest)
+		}
+		return dest, nil
+	}
+	switch {
+	case exists && !info.IsDir():
+		return "", fmt.Errorf("cannot copy a directory to a file: %s", dest)
+	case exists && !contents:
+		return filepath.Join(dest, base), nil
+	}
+	return dest, nil
+}
+
+// runCopy runs docker cp between a container on target, user@host, and this machine. The
+// copy is staged in a temporary directory on the server, which rsync transfers from or to,
+// and which is removed afterwards even if the copy fails or is interrupted.
+func runCopy(ctx context.Context, target string, args []string) error {
+	cp, err := parseCopyArgs(args)
+	if err != nil {
+		return err
+	}
+	stage, err := makeCopyStage(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer removeCopyStage(target, stage)
+
+	if cp.src.container != "" {
+		err = copyFromContainer(ctx, target, stage, cp)
+	} else {
+		err = copyToContainer(ctx, target, stage, cp)
+	}
+	if err == nil && !cp.quiet {
+		fmt.Fprintf(os.Stderr, "Successfully copied to %s\n", formatCopyArg(cp.dest))
+	}
+	return err
+}
+
+// copyFromContainer copies out of the container into the stage, then down to this machine
+func copyFromContainer(ctx context.Context, target, stage string, cp copyCommand) error {
+	staged := stage + "/item"
+	remote := fmt.Sprintf("docker cp %s %s %s && if [ -d %s ]; then echo dir; else echo file; fi",
+		quoteAll(cp.options), dockforward.ShellQuote(cp.src.container+":"+cp.src.path), dockforward.ShellQuote(staged), dockforward.ShellQuote(staged))
+	output, err := runRemote(ctx, target, remote)
+	if err != nil {
+		return err
+	}
+	isDir := strings.TrimSpace(output) == "dir"
+
+	base := filepath.Base(filepath.Clean(cp.src.path))
+	dest, err := localCopyTarget(cp.dest.path, base, isDir, copiesContents(cp.src.path))
+	if err != nil {
+		return err
+	}
+	// Absolute, so rsync doesn't take a colon in the path for a host
+	if dest, err = filepath.Abs(dest); err != nil {
+		return err
+	}
+	source := target + ":" + staged
+	if isDir {
+		source, dest = source+"/", dest+"/"
+	}
+	return transfer(ctx, source, dest, cp.quiet)
+}
+
+// copyToContainer copies this machine's source up into the stage under its own name, so
+// docker cp names it the same in the container, then into the container
+func copyToContainer(ctx context.Context, target, stage string, cp copyCommand) error {
+	src, err := filepath.Abs(cp.src.path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("invalid source %s: %v", cp.src.path, err)
+	}
+	if err := transfer(ctx, src, target+":"+stage+"/", cp.quiet); err != nil {
+		return err
+	}
+
+	staged := stage + "/" + filepath.Base(src)
+	if copiesContents(cp.src.path) {
+		staged += "/."
+	}
+	remote := fmt.Sprintf("docker cp %s %s %s", quoteAll(cp.options), dockforward.ShellQuote(staged), dockforward.ShellQuote(cp.dest.container+":"+cp.dest.path))
+	_, err = runRemote(ctx, target, remote)
+	return err
+}
+
+// transfer copies source to dest with rsync, either of which may be on the server,
+// preserving permissions and showing progress unless quiet
+func transfer(ctx context.Context, source, dest string, quiet bool) error {
+	args := []string{"-rlptDz", "-e", dfsync.RemoteShell(sshOptions)}
+	if !quiet {
+		args = append(args, "--progress")
+	}
+	cmd := exec.CommandContext(ctx, "rsync", append(args, source, dest)...)
+	slog.Debug("Running rsync", "args", strings.Join(cmd.Args[1:], " "))
+	tail := &tailBuffer{max: 4096}
+	if !quiet {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = tail
+	if err := cmd.Run(); err != nil {
+		// rsync passes on ssh's exit status when its remote shell fails
+		return fmt.Errorf("rsync failed: %w\nOutput: %s", dockforward.ClassifySSHError(err, tail.String()), tail.String())
+	}
+	return nil
+}
+
+// makeCopyStage creates a temporary directory on the server to stage a copy in
+func makeCopyStage(ctx context.Context, target string) (string, error) {
+	output, err := runRemote(ctx, target, "mktemp -d "+copyStagePrefix+"XXXXXX")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	stage := strings.TrimSpace(output)
+	if !strings.HasPrefix(stage, copyStagePrefix) {
+		return "", fmt.Errorf("failed to create staging directory: mktemp printed %q", stage)
+	}
+	return stage, nil
+}
+
+// removeCopyStage deletes a staging directory, with its own deadline since the copy's
+// context may already be done
+func removeCopyStage(target, stage string) {
+	ctx, cancel := context.WithTimeout(context.Background(), copyCleanupTimeout)
+	defer cancel()
+	if _, err := runRemote(ctx, target, "rm -rf "+dockforward.ShellQuote(stage)); err != nil {
+		slog.Warn("Failed to remove the copy's staging directory", "dir", stage, "err", err)
+	}
+}
+
+// runRemote runs command on target over ssh and returns what it printed on stdout. A
+// failure carries what it printed on stderr.
+func runRemote(ctx context.Context, target, command string) (string, error) {
+	output, err := sshCommandContext(ctx, target, command).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			stderr := strings.TrimSpace(string(exitErr.Stderr))
+			return string(output), fmt.Errorf("%w: %s", dockforward.ClassifySSHError(err, stderr), stderr)
+		}
+		return string(output), err
+	}
+	return string(output), nil
+}
+
+// quoteAll shell quotes each of args, joined with spaces
+func quoteAll(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = dockforward.ShellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// formatCopyArg formats a copy argument as it was given
+func formatCopyArg(arg copyArg) string {
+	if arg.container == "" {
+		return arg.path
+	}
+	return arg.container + ":" + arg.path
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCopyArgs(t *testing.T) {
+	cp, err := parseCopyArgs([]string{"-a", "web:/srv/my file.txt", "./out dir/"})
+	if err != nil {
+		t.Fatalf("parseCopyArgs failed: %v", err)
+	}
+	want := copyCommand{
+		options: []string{"-a"},
+		src:     copyArg{container: "web", path: "/srv/my file.txt"},
+		dest:    copyArg{path: "./out dir/"},
+	}
+	if !reflect.DeepEqual(cp, want) {
+		t.Errorf("parseCopyArgs = %+v, want %+v", cp, want)
+	}
+
+	// Absolute paths and ones starting with . are local even with a colon in them
+	for _, arg := range []string{"/tmp/a:b", "./a:b", "plain"} {
+		if got := splitCopyArg(arg); got.container != "" {
+			t.Errorf("splitCopyArg(%q) = %+v, want a local path", arg, got)
+		}
+	}
+	if cp, _ := parseCopyArgs([]string{"-qL", "a", "web:/b"}); !cp.quiet {
+		t.Error("-qL not taken as quiet")
+	}
+
+	for _, args := range [][]string{{"a", "b"}, {"web:/a", "db:/b"}, {"web:/a"}, {"web:/a", "-"}} {
+		if _, err := parseCopyArgs(args); err == nil {
+			t.Errorf("parseCopyArgs(%q) accepted an unsupported copy", args)
+		}
+	}
+}
+
+func TestLocalCopyTarget(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing dir")
+	file := filepath.Join(dir, "file.txt")
+	if err := os.Mkdir(existing, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name           string
+		dest           string
+		isDir, content bool
+		want           string // Empty for an error
+	}{
+		{"file into a directory", existing, false, false, filepath.Join(existing, "app")},
+		{"file over a file", file, false, false, file},
+		{"file to a new name", missing, false, false, missing},
+		{"file to a missing directory", missing + "/", false, false, ""},
+		{"directory into a directory", existing, true, false, filepath.Join(existing, "app")},
+		{"directory's contents into a directory", existing + "/", true, true, existing + "/"},
+		{"directory to a new name", missing, true, false, missing},
+		{"directory over a file", file, true, false, ""},
+	}
+	for _, tt := range tests {
+		got, err := localCopyTarget(tt.dest, "app", tt.isDir, tt.content)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: got %q, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// stubCopyTools puts stand-ins for ssh, rsync and docker on PATH, which run everything on
+// this machine. The container's filesystem is the directory returned.
+func stubCopyTools(t *testing.T) string {
+	t.Helper()
+	bin, root := t.TempDir(), t.TempDir()
+	scripts := map[string]string{
+		// Runs the remote command locally
+		"ssh": "#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n",
+		// Copies locally, dropping the host from remote paths
+		"rsync": `#!/bin/sh
+n=0; for arg; do n=$((n+1)); eval "a$n=\$arg"; done
+eval "src=\$a$((n-1))"; eval "dest=\$a$n"
+src=${src#*@*:}; dest=${dest#*@*:}
+case "$src" in */) mkdir -p "$dest" && exec cp -Rp "$src." "$dest" ;; esac
+exec cp -Rp "$src" "$dest"
+`,
+		// docker cp with web:PATH mapped into the container's directory
+		"docker": `#!/bin/sh
+shift
+while [ $# -gt 2 ]; do shift; done
+map() { case "$1" in web:*) echo "` + root + `${1#web:}" ;; *) echo "$1" ;; esac; }
+src=$(map "$1"); dest=$(map "$2")
+[ -e "$src" ] || { echo "Error: No such container:path: $1" >&2; exit 1; }
+exec cp -Rp "$src" "$dest"
+`,
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return root
+}
+
+// stages returns the copy staging directories left in /tmp
+func stages(t *testing.T) []string {
+	t.Helper()
+	matches, err := filepath.Glob(copyStagePrefix + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestRunCopy(t *testing.T) {
+	root := stubCopyTools(t)
+	if err := os.MkdirAll(filepath.Join(root, "app", "sub dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "app", "sub dir", "my file.txt"), []byte("hello"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	before := len(stages(t))
+	local := t.TempDir()
+	copyTo := func(args ...string) error {
+		t.Helper()
+		return runCopy(context.Background(), "deploy@example.invalid", append([]string{"-q"}, args...))
+	}
+	read := func(path string) string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("copy missing: %v", err)
+		}
+		return string(data)
+	}
+
+	// A file with a space in its name into an existing local directory
+	if err := copyTo("web:/app/sub dir/my file.txt", local+"/"); err != nil {
+		t.Fatalf("copying a file out failed: %v", err)
+	}
+	if got := read(filepath.Join(local, "my file.txt")); got != "hello" {
+		t.Errorf("copied file holds %q", got)
+	}
+
+	// A directory to a new name, then into the now existing directory, then only its contents
+	fresh := filepath.Join(local, "fresh copy")
+	if err := copyTo("web:/app", fresh); err != nil {
+		t.Fatalf("copying a directory out failed: %v", err)
+	}
+	read(filepath.Join(fresh, "sub dir", "my file.txt"))
+	if err := copyTo("web:/app", fresh); err != nil {
+		t.Fatalf("copying into an existing directory failed: %v", err)
+	}
+	read(filepath.Join(fresh, "app", "sub dir", "my file.txt"))
+	if err := copyTo("web:/app/.", local); err != nil {
+		t.Fatalf("copying a directory's contents failed: %v", err)
+	}
+	read(filepath.Join(local, "sub dir", "my file.txt"))
+
+	// Up into the container, named after the local directory
+	if err := os.MkdirAll(filepath.Join(root, "srv"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTo(fresh, "web:/srv"); err != nil {
+		t.Fatalf("copying into the container failed: %v", err)
+	}
+	read(filepath.Join(root, "srv", "fresh copy", "sub dir", "my file.txt"))
+
+	// Failures still clean up the staging directory
+	if err := copyTo("web:/missing", local); err == nil || !strings.Contains(err.Error(), "No such container:path") {
+		t.Errorf("copying a missing path failed with %v, want docker's error", err)
+	}
+	if err := copyTo("web:/app/sub dir/my file.txt", filepath.Join(local, "nowhere")+"/"); err == nil {
+		t.Error("copying a file to a missing directory succeeded")
+	}
+	if after := len(stages(t)); after != before {
+		t.Errorf("%d staging directories left behind", after-before)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	dockforward "dockforward/pkg"
+	dfsync "dockforward/pkg/sync"
+)
+
+// largestListed is how many of the biggest files and directories a large sync lists
+const largestListed = 10
+
+// confirmLargeSync estimates what syncing each of all sends, the project first, and when
+// it's over settings.WarnSize lists the largest paths on out and asks on in whether to go
+// ahead. With yes it goes ahead, and without a terminal to ask on, as settings say.
+func confirmLargeSync(in io.Reader, out io.Writer, interactive, yes bool, settings dockforward.SyncSettings, all []dfsync.SyncOptions) error {
+	if settings.WarnSize <= 0 || len(all) == 0 {
+		return nil
+	}
+	var total int64
+	var largest []dfsync.SizeEntry
+	for _, opts := range all {
+		estimate, err := dfsync.EstimateSize(opts.LocalDir, opts.ExtraExcludes, largestListed)
+		if err != nil {
+			slog.Debug("Failed to estimate the sync's size", "dir", opts.LocalDir, "err", err)
+			continue
+		}
+		total += estimate.Total
+		// Build contexts outside the project are listed by their path from it
+		prefix := ""
+		if rel, err := filepath.Rel(all[0].LocalDir, opts.LocalDir); err == nil && rel != "." {
+			prefix = filepath.ToSlash(rel) + "/"
+		}
+		for _, entry := range estimate.Largest {
+			entry.Path = prefix + entry.Path
+			largest = append(largest, entry)
+		}
+	}
+	if total <= settings.WarnSize {
+		return nil
+	}
+	sort.SliceStable(largest, func(i, j int) bool { return largest[i].Size > largest[j].Size })
+	largest = largest[:min(len(largest), largestListed)]
+
+	summary := fmt.Sprintf("The context to sync is %s, over the %s sync_warn_size_mb", dockforward.FormatBytes(total), dockforward.FormatBytes(settings.WarnSize))
+	switch {
+	case yes:
+		slog.Info(summary + ", syncing it as " + yesFlag + " says")
+		return nil
+	case !interactive && settings.AbortLarge:
+		return fmt.Errorf("%s; exclude what the build doesn't need in %s, or pass %s", summary, dfsync.IgnoreFileName, yesFlag)
+	case !interactive:
+		slog.Warn(summary+"; syncing it since there's no terminal to ask on", "largest", largestPaths(largest))
+		return nil
+	}
+
+	fmt.Fprintf(out, "%s. The largest paths are:\n", summary)
+	for _, entry := range largest {
+		fmt.Fprintf(out, "  %10s  %s\n", dockforward.FormatBytes(entry.Size), entry.Path)
+	}
+	fmt.Fprintf(out, "Add what the build doesn't need to %s to leave it out. Sync anyway? [y/N] ", dfsync.IgnoreFileName)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return fmt.Errorf("sync cancelled")
+	}
+	return nil
+}
+
+// largestPaths joins the paths of entries for a log line
+func largestPaths(entries []dfsync.SizeEntry) string {
+	paths := make([]string, len(entries))
+	for i, entry := range entries {
+		paths[i] = fmt.Sprintf("%s (%s)", entry.Path, dockforward.FormatBytes(entry.Size))
+	}
+	return strings.Join(paths, ", ")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dockforward "dockforward/pkg"
+	dfsync "dockforward/pkg/sync"
+)
+
+func TestConfirmLargeSync(t *testing.T) {
+	root := t.TempDir()
+	app, shared := filepath.Join(root, "app"), filepath.Join(root, "shared")
+	for path, size := range map[string]int{
+		filepath.Join(app, "main.go"):         100,
+		filepath.Join(app, "data", "big.bin"): 3000,
+		filepath.Join(shared, "model.bin"):    2000,
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all := []dfsync.SyncOptions{{LocalDir: app}, {LocalDir: shared}}
+	settings := dockforward.SyncSettings{WarnSize: 4000}
+
+	// Asked on a terminal, listing the project's and the build context's largest paths
+	var out bytes.Buffer
+	if err := confirmLargeSync(strings.NewReader("y\n"), &out, true, false, settings, all); err != nil {
+		t.Errorf("confirmed sync = %v", err)
+	}
+	for _, want := range []string{"5.1kB, over the 4.0kB", "data/", "../shared/model.bin", "[y/N]"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("prompt %q lacks %q", out.String(), want)
+		}
+	}
+	if err := confirmLargeSync(strings.NewReader("\n"), &out, true, false, settings, all); err == nil {
+		t.Error("sync went ahead without a yes")
+	}
+
+	// --dfw-yes, and without a terminal whatever the config chose
+	out.Reset()
+	if err := confirmLargeSync(strings.NewReader(""), &out, true, true, settings, all); err != nil || out.Len() != 0 {
+		t.Errorf("with --dfw-yes = %v, asking %q", err, out.String())
+	}
+	if err := confirmLargeSync(strings.NewReader(""), &out, false, false, settings, all); err != nil || out.Len() != 0 {
+		t.Errorf("without a terminal = %v, asking %q", err, out.String())
+	}
+	settings.AbortLarge = true
+	if err := confirmLargeSync(strings.NewReader(""), &out, false, false, settings, all); err == nil || !strings.Contains(err.Error(), yesFlag) {
+		t.Errorf("without a terminal set to abort = %v", err)
+	}
+
+	// Under the threshold, or with it off, nothing is asked
+	for _, warnSize := range []int64{10000, 0} {
+		if err := confirmLargeSync(strings.NewReader(""), &out, true, false, dockforward.SyncSettings{WarnSize: warnSize}, all); err != nil || out.Len() != 0 {
+			t.Errorf("with threshold %d = %v, asking %q", warnSize, err, out.String())
+		}
+	}
+}
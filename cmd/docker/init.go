@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	dockforward "dockforward/pkg"
+)
+
+// initCommand scaffolds the project's committed settings instead of running docker init on
+// the server, where the files it writes would be out of reach
+const initCommand = "init"
+
+// runInit writes .dockforward/config.json in dir from the flags in args, naming the compose
+// file found there, and says where it went on w
+func runInit(w io.Writer, config *dockforward.Config, dir string, args []string) error {
+	flags := flag.NewFlagSet(initCommand, flag.ContinueOnError)
+	flags.SetOutput(w)
+	server := flags.String("server", "", "server the project's commands run on, instead of the one the monitor forwards")
+	composeFile := flags.String("compose-file", "", "compose file for compose commands without -f")
+	noSync := flags.Bool("no-sync", false, "run commands in the last synced context")
+	force := flags.Bool("force", false, "replace existing settings")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%s takes no arguments, got %q", initCommand, flags.Args())
+	}
+	if *server != "" && config.Server(*server) == nil {
+		return fmt.Errorf("server %q isn't configured. Use '%s' to add it", *server, getMonitorName())
+	}
+	if *composeFile == "" {
+		for _, name := range composeFileNames {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				*composeFile = name
+				break
+			}
+		}
+	}
+
+	file := dockforward.ProjectFile{Server: *server, ComposeFile: *composeFile}
+	// Left out, no_sync keeps whatever the global config says
+	if *noSync {
+		file.NoSync = noSync
+	}
+	path, err := dockforward.InitProjectFile(dir, file, *force)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+	fmt.Fprintf(w, "Created %s; commit it to share these settings with everyone working on the project\n", rel)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dockforward "dockforward/pkg"
+)
+
+func TestRunInit(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &dockforward.Config{Servers: []dockforward.ServerConfig{{Name: "build", Host: "build.example.invalid:22", User: "deploy"}}}
+
+	var out bytes.Buffer
+	if err := runInit(&out, config, dir, []string{"--server", "build"}); err != nil {
+		t.Fatalf("runInit failed: %v", err)
+	}
+	if !strings.Contains(out.String(), filepath.Join(".dockforward", "config.json")) {
+		t.Errorf("runInit printed %q", out.String())
+	}
+	file, err := dockforward.LoadProjectFile(dir)
+	if err != nil || file == nil || file.Server != "build" || file.ComposeFile != "docker-compose.yml" {
+		t.Errorf("project file = %+v, %v, want the server and the compose file found", file, err)
+	}
+
+	if err := runInit(&out, config, dir, nil); err == nil {
+		t.Error("runInit replaced the settings without --force")
+	}
+	if err := runInit(&out, config, dir, []string{"--force", "--server", "prod"}); err == nil || !strings.Contains(err.Error(), `"prod" isn't configured`) {
+		t.Errorf("runInit with an unknown server = %v", err)
+	}
+	if err := runInit(&out, config, dir, []string{"--force", "--no-sync", "--compose-file", "deploy/compose.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := dockforward.LoadProjectFile(dir); file.Server != "" || file.ComposeFile != "deploy/compose.yaml" || file.NoSync == nil || !*file.NoSync {
+		t.Errorf("project file = %+v after --force", file)
+	}
+}
@@ -1,17 +1,30 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 	"crypto/sha256"
 	"io"
-	"io/ioutil"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	dockforward "dockforward/pkg"
+	dfgrpc "dockforward/pkg/grpc"
+	"dockforward/pkg/grpc/pb"
+	"dockforward/pkg/ipc"
+	"dockforward/pkg/version"
+	dfsync "dockforward/pkg/sync"
 )
 
 // getBinaryName returns the current binary name (docker or dockforward)
@@ -27,6 +40,84 @@ func getMonitorName() string {
 	return "docker-monitor"
 }
 
+// sshKeyFlag overrides the configured SSH key for one invocation. Like remoteDirFlag it's
+// read from os.Args before cobra runs, since all other flags are passed through to docker.
+const sshKeyFlag = "--ssh-key"
+
+// sshKeyAgent is the --ssh-key value meaning "use the keys loaded in ssh-agent"
+const sshKeyAgent = "agent"
+
+// remoteDirFlag pins the remote build context directory instead of the per-project /tmp one
+const remoteDirFlag = "--remote-dir"
+
+// noSyncFlag skips rsync and reuses the context left by the last sync to the server
+const noSyncFlag = "--no-sync"
+
+// verifyFlag compares the server's copy of the context by checksum after syncing it
+const verifyFlag = "--dfw-verify"
+
+// yesFlag syncs a context over sync_warn_size_mb without asking
+const yesFlag = "--dfw-yes"
+
+// bwLimitFlag caps the context sync's bandwidth for one invocation, over sync_bwlimit
+const bwLimitFlag = "--dfw-bwlimit"
+
+// symlinksFlag picks how the context sync treats symlinks for one invocation, over sync_symlinks
+const symlinksFlag = "--dfw-symlinks"
+
+// timeoutFlag caps how long the remote docker command may run
+const timeoutFlag = "--timeout"
+
+// verboseFlag and quietFlag log debug details, such as each ssh invocation, or only
+// warnings and errors. There's no -v, which docker reads as --version.
+const (
+	verboseFlag = "--verbose"
+	quietFlag   = "--quiet"
+)
+
+// timeoutExitCode is the exit status after --timeout expires, as used by coreutils timeout
+const timeoutExitCode = 124
+
+// Exit statuses for failures before docker could run, from sysexits.h, so scripts can tell
+// them from docker's own
+const (
+	hostUnreachableExitCode   = 68 // EX_NOHOST
+	daemonUnavailableExitCode = 69 // EX_UNAVAILABLE
+	remoteFullExitCode        = 74 // EX_IOERR
+	authFailedExitCode        = 77 // EX_NOPERM
+)
+
+// keyOverride is the --ssh-key value, replacing the configured key for this invocation
+var keyOverride string
+
+// remoteDirOverride is the --remote-dir value, replacing the computed context directory
+var remoteDirOverride string
+
+// skipSync is set by --no-sync
+var skipSync bool
+
+// verifySync is set by --dfw-verify
+var verifySync bool
+
+// assumeYes is set by --dfw-yes
+var assumeYes bool
+
+// bwLimitOverride is the --dfw-bwlimit value, replacing the configured sync bandwidth limit
+var bwLimitOverride string
+
+// symlinksOverride is the --dfw-symlinks value, replacing the configured symlink policy
+var symlinksOverride dockforward.SymlinkPolicy
+
+// commandTimeout is the --timeout value, or 0 for no limit
+var commandTimeout time.Duration
+
+// logLevel is the level --verbose or --quiet asks for
+var logLevel = dockforward.LevelInfo
+
+// sshOptions are extra options for every ssh invocation, set from --ssh-key, --verbose and
+// the connect timeout
+var sshOptions []string
+
 var rootCmd = &cobra.Command{
 	Use:                getBinaryName(), // Use executable name (docker or dockforward)
 	Short:              "Execute Docker commands on a remote host",
@@ -34,136 +125,527 @@ var rootCmd = &cobra.Command{
 	DisableFlagParsing: true, // Pass all flags through to docker
 }
 
-// calculateProjectHash generates a stable hash based on the absolute path
-func calculateProjectHash(dir string) (string, error) {
-	absPath, err := filepath.Abs(dir)
-	if err != nil {
-		return "", fmt.Errorf("failed to get absolute path: %v", err)
+// wrapperFlags are the flags dockforward reads itself rather than passing to docker
+type wrapperFlags struct {
+	sshKey    string
+	remoteDir string
+	timeout   string
+	bwLimit   string
+	symlinks  string
+	noSync    bool
+	verify    bool
+	yes       bool
+	verbose   bool
+	quiet     bool
+}
+
+// extractWrapperFlags removes leading --ssh-key, --remote-dir, --timeout, --dfw-bwlimit,
+// --dfw-symlinks, --no-sync, --dfw-verify, --dfw-yes, --verbose and --quiet flags from args.
+// Flags with values take either the "--flag value" or "--flag=value" form, keeping the last
+// value of each. Flags after the docker command belong to docker.
+func extractWrapperFlags(args []string) (flags wrapperFlags, rest []string, err error) {
+	values := map[string]*string{
+		sshKeyFlag:    &flags.sshKey,
+		remoteDirFlag: &flags.remoteDir,
+		timeoutFlag:   &flags.timeout,
+		bwLimitFlag:   &flags.bwLimit,
+		symlinksFlag:  &flags.symlinks,
+	}
+	usage := map[string]string{
+		sshKeyFlag:    fmt.Sprintf("a key path or %q", sshKeyAgent),
+		remoteDirFlag: "a directory",
+		timeoutFlag:   "a duration such as 10m",
+		bwLimitFlag:   "a rate such as 500K",
+		symlinksFlag:  "preserve, follow or skip",
 	}
 
-	// Create a stable hash of the absolute path
-	hash := sha256.New()
-	io.WriteString(hash, absPath)
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	for len(args) > 0 {
+		switch args[0] {
+		case noSyncFlag:
+			flags.noSync, args = true, args[1:]
+			continue
+		case verifyFlag:
+			flags.verify, args = true, args[1:]
+			continue
+		case yesFlag:
+			flags.yes, args = true, args[1:]
+			continue
+		case verboseFlag:
+			flags.verbose, args = true, args[1:]
+			continue
+		case quietFlag:
+			flags.quiet, args = true, args[1:]
+			continue
+		}
+		name, value, inline := strings.Cut(args[0], "=")
+		target, ok := values[name]
+		if !ok {
+			break
+		}
+		if inline {
+			args = args[1:]
+		} else if len(args) > 1 {
+			value, args = args[1], args[2:]
+		}
+		if value == "" {
+			return wrapperFlags{}, nil, fmt.Errorf("%s needs %s", name, usage[name])
+		}
+		*target = value
+	}
+	return flags, args, nil
 }
 
-// createExcludeFile creates a temporary file containing exclusion patterns from .gitignore and .dockerignore
-func createExcludeFile(dir string) (string, error) {
-	tmpfile, err := ioutil.TempFile("", "exclude")
-	if err != nil {
-		return "", err
+// sshKeyOptions returns the ssh options that authenticate with key, either a private key
+// file or "agent" for the keys in ssh-agent
+func sshKeyOptions(key string) ([]string, error) {
+	if key == sshKeyAgent {
+		if os.Getenv("SSH_AUTH_SOCK") == "" {
+			return nil, fmt.Errorf("%s %s: SSH_AUTH_SOCK is not set, is ssh-agent running?", sshKeyFlag, sshKeyAgent)
+		}
+		// ssh offers the agent's keys without any options
+		return nil, nil
 	}
 
-	// Common patterns to always exclude
-	commonPatterns := []string{
-		".git/",
-		".env",
-		"node_modules/",
+	if strings.HasPrefix(key, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get home directory: %v", err)
+		}
+		key = filepath.Join(homeDir, key[2:])
 	}
+	if _, err := os.Stat(key); err != nil {
+		return nil, fmt.Errorf("unable to read SSH key: %v", err)
+	}
+	// Offer only this key, not the agent's or ssh_config's
+	return []string{"-i", key, "-o", "IdentitiesOnly=yes"}, nil
+}
 
-	// Write common patterns
-	for _, pattern := range commonPatterns {
-		fmt.Fprintln(tmpfile, pattern)
+// sshCommandContext builds an ssh invocation with any --ssh-key options, sending ssh
+// SIGTERM once ctx is done so it can close the session and let the remote command hang up
+func sshCommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "ssh", append(append([]string{}, sshOptions...), args...)...)
+	slog.Debug("Running ssh", "args", strings.Join(cmd.Args[1:], " "))
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
 	}
+	// Kill ssh if it doesn't exit after SIGTERM
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
 
-	// Read and append .gitignore if it exists
-	if gitignore, err := ioutil.ReadFile(filepath.Join(dir, ".gitignore")); err == nil {
-		tmpfile.Write(gitignore)
-		fmt.Fprintln(tmpfile) // Add newline
+// exitCode returns the status to exit with after err, a sysexits one for the failures
+// dockforward.ClassifySSHError recognises and 1 for anything else
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, dockforward.ErrAuthFailed):
+		return authFailedExitCode
+	case errors.Is(err, dockforward.ErrHostUnreachable):
+		return hostUnreachableExitCode
+	case errors.Is(err, dockforward.ErrDaemonUnavailable), errors.Is(err, dockforward.ErrRemoteUnsupported):
+		return daemonUnavailableExitCode
+	case errors.Is(err, dockforward.ErrRemoteDiskFull):
+		return remoteFullExitCode
 	}
+	return 1
+}
 
-	// Read and append .dockerignore if it exists
-	if dockerignore, err := ioutil.ReadFile(filepath.Join(dir, ".dockerignore")); err == nil {
-		tmpfile.Write(dockerignore)
+// commandExitCode returns the status to exit with after the remote docker command failed
+// with err: exitCode's for the failures to reach docker, and otherwise the command's own,
+// which ssh passes on
+func commandExitCode(err error) int {
+	if code := exitCode(err); code != 1 {
+		return code
 	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
 
-	if err := tmpfile.Close(); err != nil {
-		return "", err
+// exitWithHint prints what to try for err, if dockforward knows, and exits with its status
+func exitWithHint(err error) {
+	if hint := dockforward.ErrorHint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
 	}
+	os.Exit(exitCode(err))
+}
+
+// tailBuffer keeps the last bytes written to it, enough to classify a failure by the last
+// messages ssh or docker printed. It's safe for stdout and stderr to write concurrently.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
 
-	return tmpfile.Name(), nil
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
 }
 
-// syncDirectory synchronizes the local directory with remote
-func syncDirectory(user, host, localDir, remoteDir string) error {
-	// Create remote directory
-	mkdirCmd := exec.Command("ssh", fmt.Sprintf("%s@%s", user, host), "mkdir", "-p", remoteDir)
-	if err := mkdirCmd.Run(); err != nil {
-		return fmt.Errorf("failed to create remote directory: %v", err)
+// syncContext syncs the context as opts says with a spinner showing, along with the build
+// contexts outside it staged says to sync, all at once. Then it remembers the remote
+// directory as the server's last context, for --no-sync, and tells the monitor about it.
+func syncContext(ctx context.Context, syncer dfsync.Syncer, server *dockforward.ServerConfig, monitor *ipc.Client, opts dfsync.SyncOptions, staged ...dfsync.SyncOptions) error {
+	remoteDir := opts.RemoteDir
+	spinner := dockforward.NewSpinner()
+	if len(staged) > 0 {
+		spinner.Start(fmt.Sprintf("Syncing context and the build contexts outside it to %s...", remoteDir))
+	} else {
+		spinner.Start(fmt.Sprintf("Syncing context to %s...", remoteDir))
+	}
+	all := append([]dfsync.SyncOptions{opts}, staged...)
+	results := make([]dfsync.SyncResult, len(all))
+	errs := make([]error, len(all))
+	var wg sync.WaitGroup
+	for i, opts := range all {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = syncer.Sync(ctx, opts)
+			if errs[i] != nil && i > 0 {
+				errs[i] = fmt.Errorf("failed to sync build context %s: %w", opts.LocalDir, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	spinner.Stop()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	for i, result := range results {
+		if i == 0 {
+			slog.Info("Synced context", "dir", remoteDir, "duration", result.Duration.Round(time.Millisecond))
+		} else {
+			slog.Info("Synced build context", "local", all[i].LocalDir, "dir", result.RemoteDir, "duration", result.Duration.Round(time.Millisecond))
+		}
+		slog.Debug("rsync output", "output", result.Output)
+		if len(result.DanglingLinks) > 0 {
+			slog.Warn(fmt.Sprintf("Symlinks that don't resolve on the server were synced; use %s follow to copy their targets", symlinksFlag),
+				"links", strings.Join(result.DanglingLinks, ", "))
+		}
+		if throughput := result.Throughput(); throughput > 0 {
+			slog.Debug("Sync throughput", "dir", result.RemoteDir, "sent_bytes", result.BytesSent, "rate", fmt.Sprintf("%.1f KiB/s", throughput/1024),
+				"bwlimit", opts.BwLimit)
+		}
 	}
+	if err := writeLastRemoteDir(server, remoteDir); err != nil {
+		slog.Warn("Failed to remember the synced context", "server", server.Name, "err", err)
+	}
+	if monitor != nil {
+		if err := monitor.SetSyncedDir(server.Name, remoteDir); err != nil {
+			slog.Debug("Failed to tell the monitor about the synced context", "err", err)
+		}
+	}
+	return nil
+}
 
-	// Create exclude file from .gitignore and .dockerignore
-	excludeFile, err := createExcludeFile(localDir)
+// parseTimeout parses a --timeout value such as "10m" or "90s"
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
 	if err != nil {
-		return fmt.Errorf("failed to create exclude file: %v", err)
+		return 0, fmt.Errorf("invalid %s %q: %v", timeoutFlag, value, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", timeoutFlag, value)
 	}
-	defer os.Remove(excludeFile)
+	return timeout, nil
+}
 
-	// Sync files using rsync
-	rsyncArgs := []string{
-		"-rlptDz",  // no -a, explicit flags instead
-		"--chmod=Du=rwx,Dg=rx,Do=rx,Fu=rw,Fg=r,Fo=r", // explicit permissions
-		"--delete", // delete extraneous files
-		"--exclude-from", excludeFile, // use patterns from exclude file
-		"-v",      // verbose output for debugging
-		"-e", "ssh",
-		fmt.Sprintf("%s/", localDir), // source with trailing slash
-		fmt.Sprintf("%s@%s:%s/", user, host, remoteDir), // destination
+// serverStatePath returns the path of the state file name kept for server, in a directory
+// of the config directory named after its user and host
+func serverStatePath(server *dockforward.ServerConfig, name string) (string, error) {
+	configDir, err := dockforward.GetConfigDir()
+	if err != nil {
+		return "", err
 	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s@%s", server.User, server.Host)))
+	return filepath.Join(configDir, fmt.Sprintf("%x", hash[:6]), name), nil
+}
 
-	fmt.Fprintf(os.Stderr, "Running rsync with args: %v\n", rsyncArgs)
+// lastRemoteDirPath returns the state file recording the last context directory synced to server
+func lastRemoteDirPath(server *dockforward.ServerConfig) (string, error) {
+	return serverStatePath(server, "last-remote-dir")
+}
 
-	rsyncCmd := exec.Command("rsync", rsyncArgs...)
-	output, err := rsyncCmd.CombinedOutput()
+// readLastRemoteDir returns the context directory last synced to server
+func readLastRemoteDir(server *dockforward.ServerConfig) (string, error) {
+	path, err := lastRemoteDirPath(server)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("nothing has been synced to %s yet, run once without %s", server.Name, noSyncFlag)
+	}
 	if err != nil {
-		return fmt.Errorf("rsync failed: %v\nOutput: %s", err, string(output))
+		return "", fmt.Errorf("failed to read last remote directory: %v", err)
 	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// monitorServer returns the configured server the running monitor forwards, or the config's
+// current server if no monitor answers on the control socket
+func monitorServer(config *dockforward.Config, monitor *ipc.Client) *dockforward.ServerConfig {
+	if monitor != nil {
+		if current, err := monitor.CurrentServer(); err == nil {
+			for i := range config.Servers {
+				if config.Servers[i].Name == current.Name {
+					return &config.Servers[i]
+				}
+			}
+		}
+	}
+	return config.GetCurrentServer()
+}
 
+// lastSyncedDir returns the context directory last synced to server, as the running monitor
+// remembers it, or else from the state file
+func lastSyncedDir(server *dockforward.ServerConfig, monitor *ipc.Client) (string, error) {
+	if monitor != nil {
+		if dir, err := monitor.SyncedDir(server.Name); err == nil && dir != "" {
+			return dir, nil
+		}
+	}
+	return readLastRemoteDir(server)
+}
+
+// writeLastRemoteDir records remoteDir as the context directory last synced to server
+func writeLastRemoteDir(server *dockforward.ServerConfig, remoteDir string) error {
+	path, err := lastRemoteDirPath(server)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(remoteDir+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write last remote directory: %v", err)
+	}
 	return nil
 }
 
-// executeRemoteDocker executes a docker command on the remote host
-func executeRemoteDocker(user, host string, args []string, remoteDir string, needsContext bool) error {
+// envAssignments returns "NAME=value " shell assignments for each of names set locally.
+// They're prepended to the remote command, since SendEnv only works if the remote sshd
+// accepts the variable.
+func envAssignments(names []string) string {
+	var b strings.Builder
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			fmt.Fprintf(&b, "%s=%s ", name, dockforward.ShellQuote(value))
+		}
+	}
+	return b.String()
+}
+
+// printVersion adds dockforward's own version to what docker version printed, and the
+// monitor's if it's running another. --format output is left alone, since it's parsed.
+func printVersion(w io.Writer, args []string, monitor *ipc.Client) {
+	for _, arg := range args[1:] {
+		if arg == "-f" || strings.HasPrefix(arg, "--format") {
+			return
+		}
+	}
+	info := version.Get()
+	fmt.Fprintf(w, "\nDockforward: %s\n", info)
+	if monitor == nil {
+		return
+	}
+	if v, err := monitor.MonitorVersion(); err == nil && v != info.Version {
+		fmt.Fprintf(w, "Dockforward monitor: %s, which differs; install both from the same build\n", v)
+	}
+}
+
+// dockerValueFlags are the flags of docker exec and run that take a value, so it isn't taken
+// for the container or image
+var dockerValueFlags = map[string]bool{
+	"-e": true, "--env": true, "-u": true, "--user": true, "-w": true, "--workdir": true,
+	"--name": true, "--entrypoint": true, "-v": true, "--volume": true, "-p": true,
+	"--publish": true, "-l": true, "--label": true, "--network": true, "--env-file": true,
+	"--detach-keys": true, "-h": true, "--hostname": true, "--platform": true,
+}
+
+// interactiveSession reports whether args attach the terminal to a container, as docker
+// attach, docker exec -t, docker run -t and compose exec, run and attach do
+func interactiveSession(args []string) bool {
+	if compose, ok := parseComposeCommand(args); ok {
+		return compose.interactive()
+	}
+	if len(args) > 1 && args[0] == "container" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "attach":
+		return true
+	case "exec", "run":
+	default:
+		return false
+	}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return false // The container or image, without -t before it
+		}
+		if arg == "--tty" || arg == "--tty=true" {
+			return true
+		}
+		// Short flags given together, such as -it
+		if short, ok := strings.CutPrefix(arg, "-"); ok && !strings.HasPrefix(short, "-") && strings.ContainsRune(short, 't') {
+			return true
+		}
+		if dockerValueFlags[arg] {
+			i++
+		}
+	}
+	return false
+}
+
+// executeRemoteDocker executes a docker command on the remote host, stopping it when ctx is done.
+// Variables in forwardEnv that are set locally are set for the remote docker too.
+func executeRemoteDocker(ctx context.Context, user, host string, args []string, remoteDir string, needsContext bool, forwardEnv []string) error {
+	interactive := interactiveSession(args)
+
 	// Build the remote command
 	var remoteCmd string
+	docker := envAssignments(forwardEnv) + "docker"
+	if len(args) > 0 && args[0] == composeStandalone {
+		docker, args = envAssignments(forwardEnv)+composeStandalone, args[1:]
+	}
 	if needsContext {
-		remoteCmd = fmt.Sprintf("cd %s && docker %s", remoteDir, strings.Join(args, " "))
+		remoteCmd = fmt.Sprintf("cd %s && %s %s", dockforward.ShellQuote(remoteDir), docker, strings.Join(args, " "))
 	} else {
-		remoteCmd = fmt.Sprintf("docker %s", strings.Join(args, " "))
+		remoteCmd = fmt.Sprintf("%s %s", docker, strings.Join(args, " "))
 	}
 	
-	// Execute the command over SSH with pseudo-terminal allocation
-	cmd := exec.Command("ssh", "-t", fmt.Sprintf("%s@%s", user, host), remoteCmd)
-	
-	// Connect command's standard streams to our own
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// Execute the command over SSH with pseudo-terminal allocation. A shell in a container
+	// gets one even when ssh doubts the local terminal, with -tt.
+	tty := "-t"
+	if interactive {
+		tty = "-tt"
+	}
+	cmd := sshCommandContext(ctx, tty, fmt.Sprintf("%s@%s", user, host), remoteCmd)
+
+	// Connect command's standard streams to our own, keeping the tail of what's printed to
+	// classify a failure by. With -t the remote docker's errors arrive on stdout too.
+	tail := &tailBuffer{max: 4096}
+	cmd.Stdout = io.MultiWriter(os.Stdout, tail)
+	cmd.Stderr = io.MultiWriter(os.Stderr, tail)
 	cmd.Stdin = os.Stdin
+	// An interactive session writes straight to the terminal rather than through a pipe.
+	// ssh puts the terminal in raw mode itself and, getting SIGWINCH along with the rest of
+	// the foreground process group, sends the remote side every change of its size; the
+	// wrapper doesn't catch SIGWINCH or start ssh in a process group of its own.
+	if interactive && term.IsTerminal(int(os.Stdout.Fd())) {
+		cmd.Stdout = os.Stdout
+	}
 
 	// Run the command
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return dockforward.ClassifySSHError(err, tail.String())
+	}
+	return nil
 }
 
-// cleanupOldContexts removes docker context directories older than 24 hours
-func cleanupOldContexts(user, host string) error {
-	// Find and remove old context directories (older than 24h)
-	// Only look in our specific context directory path
-	cleanupCmd := fmt.Sprintf(
-		"cd /tmp && find . -maxdepth 1 -type d -name 'docker-context-*' -mtime +1 -exec rm -rf {} \\;",
-	)
-	
-	cmd := exec.Command("ssh", fmt.Sprintf("%s@%s", user, host), cleanupCmd)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("cleanup failed: %v\nOutput: %s", err, string(output))
+// composeFileNames are the files docker compose looks for, in its own order of preference
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// findRemoteComposeFile returns the first of composeFileNames in remoteDir on the remote host,
+// or "" if there's none
+func findRemoteComposeFile(ctx context.Context, user, host, remoteDir string) (string, error) {
+	if remoteDir == "" {
+		remoteDir = "."
 	}
-	
-	return nil
+	probe := fmt.Sprintf("cd %s && for f in %s; do if [ -f \"$f\" ]; then echo \"$f\"; break; fi; done",
+		dockforward.ShellQuote(remoteDir), strings.Join(composeFileNames, " "))
+	// Only stdout, so ssh's own messages on stderr aren't taken for a file name
+	output, err := sshCommandContext(ctx, fmt.Sprintf("%s@%s", user, host), probe).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to look for a compose file: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
 }
 
-// checkRemoteDocker verifies that the monitor is running
-func checkRemoteDocker() error {
-	// Check if monitor is in the process list
+// grpcServerConnected asks the monitor's gRPC API at addr whether it's connected to its server
+func grpcServerConnected(addr string) (bool, error) {
+	token, err := dockforward.LoadAPIToken()
+	if err != nil {
+		return false, err
+	}
+	client, err := dfgrpc.Dial(addr, token)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := client.GetServices(ctx, &pb.GetServicesRequest{})
+	if err != nil {
+		return false, err
+	}
+	for _, server := range resp.Servers {
+		if !server.Connected {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkRemoteDocker verifies that the monitor is running, asking its gRPC or control API if
+// either is configured, then its control socket, then checking for the current server's lock
+// and falling back to the process list
+func checkRemoteDocker(config *dockforward.Config, monitor *ipc.Client) error {
 	monitorName := getMonitorName()
+	if config.API.GRPCAddr != "" {
+		if connected, err := grpcServerConnected(config.API.GRPCAddr); err == nil {
+			if !connected {
+				return fmt.Errorf("%s isn't connected to %s", monitorName, config.CurrentServer)
+			}
+			return nil
+		}
+	}
+	if client, err := dockforward.NewAPIClient(config.API); err == nil {
+		servers, err := client.Servers()
+		if err == nil {
+			for _, server := range servers {
+				if server.Current && !server.Connected {
+					return fmt.Errorf("%s isn't connected to %s", monitorName, server.Name)
+				}
+			}
+			return nil
+		}
+	}
+
+	if monitor != nil {
+		if current, err := monitor.CurrentServer(); err == nil {
+			if !current.Connected {
+				return fmt.Errorf("%s isn't connected to %s", monitorName, current.Name)
+			}
+			return nil
+		}
+	}
+
+	// A monitor forwarding the current server holds its lock
+	if holder, err := dockforward.ServerLockHolder(config.CurrentServer); err == nil && holder != nil {
+		return nil
+	}
+
+	// Check if monitor is in the process list
 	cmd := exec.Command("pgrep", "-f", fmt.Sprintf("^%s$", monitorName))
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("%s is not running. Please start it first with: %s", monitorName, monitorName)
@@ -173,43 +655,176 @@ func checkRemoteDocker() error {
 
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	// Consume our own flags so they aren't passed on to the remote docker
+	flags, args, err := extractWrapperFlags(os.Args[1:])
+	if err != nil {
 		log.Fatal(err)
 	}
-}
+	os.Args = append(os.Args[:1], args...)
+	keyOverride = flags.sshKey
+	remoteDirOverride = flags.remoteDir
+	skipSync = flags.noSync
+	verifySync = flags.verify
+	assumeYes = flags.yes
+	if flags.bwLimit != "" {
+		if err := dockforward.ValidateBwLimit(flags.bwLimit); err != nil {
+			log.Fatalf("%s: %v", bwLimitFlag, err)
+		}
+		bwLimitOverride = flags.bwLimit
+	}
+	if flags.symlinks != "" {
+		if symlinksOverride, err = dockforward.ParseSymlinkPolicy(flags.symlinks); err != nil {
+			log.Fatalf("%s: %v", symlinksFlag, err)
+		}
+	}
+	logLevel = dockforward.LogLevelFor(flags.verbose, flags.quiet)
+	dockforward.SetLogLevel(logLevel)
+	if flags.timeout != "" {
+		if commandTimeout, err = parseTimeout(flags.timeout); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-func executeCommand(cmd *cobra.Command, args []string) {
-	// Check if monitor is running
-	if err := checkRemoteDocker(); err != nil {
+	// Cancelled on the first SIGINT or SIGTERM so ssh and rsync are stopped cleanly; the
+	// default handling comes back then, so a second signal exits at once
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		log.Fatal(err)
 	}
+}
 
+func executeCommand(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
 	// Load configuration
 	config, err := dockforward.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if config.Logging.File != "" {
+		logFile, err := config.Logging.OpenFile("")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer logFile.Close()
+		slog.SetDefault(slog.New(slog.NewTextHandler(logFile, &slog.HandlerOptions{Level: logLevel.SlogLevel()})))
+	}
 
-	// Get current server config
-	server := config.GetCurrentServer()
+	// Get current working directory
+	pwd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Failed to get working directory: %v", err)
+	}
+	// The project's committed settings take precedence over the global config's. A broken
+	// file shouldn't stop docker commands, so it's only warned about.
+	project := config.Project(pwd)
+	if file, err := dockforward.LoadProjectFile(pwd); err != nil {
+		slog.Warn("Ignoring the project's settings", "err", err)
+	} else {
+		project = project.Merge(file)
+	}
+
+	// init only writes the project's settings, so the server isn't needed
+	if len(args) > 0 && args[0] == initCommand {
+		if err := runInit(os.Stdout, config, pwd, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Check if monitor is running. Without a config directory there's no control socket,
+	// so a nil client just skips asking it.
+	monitor, _ := ipc.DefaultClient()
+	if err := checkRemoteDocker(config, monitor); err != nil {
+		log.Fatal(err)
+	}
+
+	// Get the server the monitor forwards, unless the project names its own
+	server := monitorServer(config, monitor)
+	if project.Server != "" {
+		if server == nil || server.Name != project.Server {
+			slog.Debug("Using the project's server", "server", project.Server)
+		}
+		if server = config.Server(project.Server); server == nil {
+			log.Fatalf("The project's %s names server %q, which isn't configured. Use '%s' to add it",
+				dockforward.ProjectFilePath("."), project.Server, getMonitorName())
+		}
+	}
 	if server == nil {
 		log.Fatalf("No server configured. Use '%s' to configure servers", getMonitorName())
 	}
+	if project.NoSync {
+		skipSync = true
+	}
+
+	// Use the --ssh-key key instead of the configured one for this invocation only
+	if keyOverride != "" {
+		server.KeyPath = keyOverride
+		if sshOptions, err = sshKeyOptions(server.KeyPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// ssh's own debugging goes to stderr, alongside ours
+	if logLevel <= dockforward.LevelDebug {
+		sshOptions = append(sshOptions, "-v")
+	}
+	// Give up on a server that doesn't answer instead of hanging, bounding only the
+	// connection so a long build or docker logs -f keeps running
+	sshOptions = append(sshOptions,
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(config.SSHConnectTimeout().Seconds())),
+		"-o", "ServerAliveInterval=15",
+		"-o", "ServerAliveCountMax=3",
+	)
 
 	// Extract host without port
 	hostParts := strings.Split(server.Host, ":")
 	host := hostParts[0]
 
 	// Cleanup old context directories
-	if err := cleanupOldContexts(server.User, host); err != nil {
-		// Just log the error but continue
-		log.Printf("Warning: Failed to cleanup old contexts: %v", err)
+	syncer := dfsync.NewRsyncSyncer(server.User, host, sshOptions)
+	settings := config.SyncSettings(*server)
+	cleanupCtx, cancel := context.WithTimeout(ctx, settings.Timeout)
+	err = syncer.Cleanup(cleanupCtx)
+	cancel()
+	if errors.Is(cleanupCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("cleanup timed out after %s: %w", settings.Timeout, context.DeadlineExceeded)
 	}
-
-	// Get current working directory
-	pwd, err := os.Getwd()
 	if err != nil {
-		log.Fatalf("Failed to get working directory: %v", err)
+		// It's the first ssh run, so a server that can't be reached or refuses the key
+		// stops here. Anything else is just logged.
+		if errors.Is(err, dockforward.ErrAuthFailed) || errors.Is(err, dockforward.ErrHostUnreachable) {
+			log.Printf("Failed to connect to %s: %v", server.Name, err)
+			exitWithHint(err)
+		}
+		slog.Warn("Failed to clean up old contexts", "server", server.Name, "err", err)
+	}
+
+	// docker cp copies between a container and this machine rather than the remote host
+	if cpArgs, ok := copyArguments(os.Args[1:]); ok {
+		if commandTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+			defer cancel()
+		}
+		if err := runCopy(ctx, fmt.Sprintf("%s@%s", server.User, host), cpArgs); err != nil {
+			log.Printf("Failed to copy: %v", err)
+			exitWithHint(err)
+		}
+		return
+	}
+
+	// Run compose the way the server can, or say what it lacks before syncing for nothing
+	remoteArgs := os.Args[1:]
+	if caps, err := serverCapabilities(ctx, server, fmt.Sprintf("%s@%s", server.User, host)); err != nil {
+		slog.Debug("Failed to probe the server's docker, running the command as it is", "server", server.Name, "err", err)
+	} else if remoteArgs, err = caps.adapt(remoteArgs); err != nil {
+		log.Print(err)
+		exitWithHint(err)
+	}
+	// The project's compose file stands in for compose's own search, as -f would
+	if compose, ok := parseComposeCommand(remoteArgs); ok && project.ComposeFile != "" && !slices.Contains(compose.globals, "-f") && !slices.Contains(compose.globals, "--file") {
+		remoteArgs = withComposeFile(remoteArgs, project.ComposeFile)
 	}
 
 	// Check if we need to sync the directory
@@ -238,34 +853,95 @@ func executeCommand(cmd *cobra.Command, args []string) {
 	}
 
 	// Only create and sync directory if needed
-	if needsSync {
-		// Calculate project hash for context directory name
-		projectHash, err := calculateProjectHash(pwd)
-		if err != nil {
-			log.Fatalf("Failed to calculate project hash: %v", err)
+	if needsSync && skipSync && remoteDirOverride == "" {
+		// Build in whatever the last sync left behind, as is
+		if remoteDir, err = lastSyncedDir(server, monitor); err != nil {
+			log.Fatal(err)
 		}
-
+		slog.Info("Skipping sync, using the last context", "dir", remoteDir)
+	} else if needsSync && remoteDirOverride != "" {
+		// A pinned directory is kept between builds; cleanup only removes the /tmp ones
+		remoteDir = remoteDirOverride
+		if !strings.HasPrefix(remoteDir, "/") {
+			slog.Warn(fmt.Sprintf("%s is relative, so it's resolved against the remote user's home directory", remoteDirFlag), "dir", remoteDir, "server", server.Name)
+		}
+	} else if needsSync {
 		// Create remote directory path using stable project hash
-		remoteDir = fmt.Sprintf("/tmp/docker-context-%s", projectHash[:12])
+		if remoteDir, err = dfsync.ContextDir(pwd); err != nil {
+			log.Fatalf("Failed to calculate project hash: %v", err)
+		}
+	}
 
-		fmt.Fprintf(os.Stderr, "Syncing context to %s...\n", remoteDir)
-		if err := syncDirectory(server.User, host, pwd, remoteDir); err != nil {
-			log.Fatalf("Failed to sync directory: %v", err)
+	var contexts *contextPlan // Build contexts outside the project synced with it, nil for none
+	if needsSync && !skipSync {
+		if bwLimitOverride != "" {
+			settings.BwLimit = bwLimitOverride
+		}
+		if symlinksOverride != "" {
+			settings.Symlinks = symlinksOverride
+		}
+		opts := dfsync.SyncOptions{
+			LocalDir:      pwd,
+			RemoteDir:     remoteDir,
+			ExtraExcludes: project.ExtraExcludes,
+			BwLimit:       settings.BwLimit,
+			CompressLevel: settings.CompressLevel,
+			Symlinks:      settings.Symlinks,
+			Verify:        settings.Verify || verifySync,
+			Verbose:       logLevel <= dockforward.LevelDebug,
+			Timeout:       settings.Timeout,
+			Retries:       settings.Retries,
+		}
+		// Build contexts outside the project are synced alongside it, and compose pointed at them
+		var staged []dfsync.SyncOptions
+		if compose, ok := parseComposeCommand(remoteArgs); ok {
+			plan, err := planBuildContexts(pwd, compose)
+			if err != nil {
+				slog.Warn("Failed to read the compose file's build contexts, syncing only the project", "err", err)
+			}
+			for _, warning := range plan.warnings {
+				slog.Warn("Build context isn't synced: " + warning)
+			}
+			if len(plan.dirs) > 0 {
+				contexts = &plan
+				staged = plan.syncOptions(opts)
+			}
+		}
+		// Ask before sending a context big enough to be a mistake, such as a dataset
+		interactive := term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+		if err := confirmLargeSync(os.Stdin, os.Stderr, interactive, assumeYes, settings, append([]dfsync.SyncOptions{opts}, staged...)); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+		if err := syncContext(ctx, syncer, server, monitor, opts, staged...); err != nil {
+			log.Printf("Failed to sync directory: %v", err)
+			exitWithHint(err)
+		}
+		if contexts != nil {
+			if err := contexts.writeOverride(ctx, fmt.Sprintf("%s@%s", server.User, host), pwd, remoteDir); err != nil {
+				log.Print(err)
+				exitWithHint(err)
+			}
 		}
 
-		// Debug: List contents of remote directory after sync
-		listCmd := exec.Command("ssh", fmt.Sprintf("%s@%s", server.User, host), 
-			fmt.Sprintf("cd %s && ls -la", remoteDir))
-		if output, err := listCmd.CombinedOutput(); err != nil {
-			log.Printf("Warning: Failed to list remote directory: %v", err)
-		} else {
-			fmt.Fprintf(os.Stderr, "Remote directory contents:\n%s\n", output)
+		// List what was synced, which only --verbose asks for since it takes another ssh round trip
+		if logLevel <= dockforward.LevelDebug {
+			listCtx, cancel := context.WithTimeout(ctx, settings.Timeout)
+			listCmd := sshCommandContext(listCtx, fmt.Sprintf("%s@%s", server.User, host),
+				fmt.Sprintf("cd %s && ls -la", dockforward.ShellQuote(remoteDir)))
+			output, err := listCmd.CombinedOutput()
+			cancel()
+			if err != nil {
+				slog.Debug("Failed to list remote directory", "dir", remoteDir, "err", err)
+			} else {
+				slog.Debug("Remote directory contents", "dir", remoteDir, "listing", string(output))
+			}
 		}
 	}
 
 	// Execute docker command remotely
-	args = os.Args[1:]
-	if len(args) > 0 && args[0] == "compose" {
+	args = remoteArgs
+	if len(args) > 0 && (args[0] == "compose" || args[0] == composeStandalone) {
 		// For docker compose commands, ensure we're using -f to specify the config file
 		hasConfigFlag := false
 		for i := 1; i < len(args); i++ {
@@ -275,15 +951,61 @@ func executeCommand(cmd *cobra.Command, args []string) {
 			}
 		}
 		if !hasConfigFlag {
-			// Insert -f flag with docker-compose.yml right after "compose" command
-			newArgs := make([]string, 0, len(args)+2)
-			newArgs = append(newArgs, args[0], "-f", "docker-compose.yml")
-			newArgs = append(newArgs, args[1:]...)
-			args = newArgs
+			// Name the compose file compose itself would pick, if the context has one
+			composeFile, err := findRemoteComposeFile(ctx, server.User, host, remoteDir)
+			if err != nil {
+				slog.Warn("Failed to find the compose file", "dir", remoteDir, "err", err)
+			}
+			if composeFile != "" {
+				newArgs := make([]string, 0, len(args)+2)
+				newArgs = append(newArgs, args[0], "-f", composeFile)
+				newArgs = append(newArgs, args[1:]...)
+				args = newArgs
+				hasConfigFlag = true
+			}
+		}
+		// The override only adds to the files named, so there must be some
+		if contexts != nil && hasConfigFlag {
+			args = withComposeFile(args, overrideFile(remoteDir))
+		}
+	}
+
+	// Log where the monitor forwards the server's ports, for debugging
+	if monitor != nil && logLevel <= dockforward.LevelDebug {
+		if mappings, err := monitor.PortMappings(); err == nil {
+			slog.Debug("Monitor forwards", "ports", mappings)
+		}
+	}
+
+	if commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+	}
+	if err := executeRemoteDocker(ctx, server.User, host, args, remoteDir, needsSync, server.ForwardEnvVars); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			fmt.Fprintf(os.Stderr, "Command timed out after %s\n", commandTimeout)
+			os.Exit(timeoutExitCode)
 		}
+		// ssh or docker already printed why, so only the hint is added, and the command's
+		// own exit status is passed on
+		if hint := dockforward.ErrorHint(err); hint != "" {
+			fmt.Fprintln(os.Stderr, hint)
+		}
+		os.Exit(commandExitCode(err))
 	}
 
-	if err := executeRemoteDocker(server.User, host, args, remoteDir, needsSync); err != nil {
-		os.Exit(1)
+	if len(args) > 0 && args[0] == "version" {
+		printVersion(os.Stdout, args, monitor)
+	}
+
+	// Have the monitor forward what compose up -d brought up, and stop what down took down
+	if compose, ok := parseComposeCommand(args); ok && compose.changesForwards() && monitor != nil {
+		config, err := loadComposeConfig(ctx, server.User, host, remoteDir, server.ForwardEnvVars, compose)
+		if err != nil {
+			slog.Warn("Failed to update the monitor's forwards", "err", err)
+			return
+		}
+		updateComposeForwards(monitor, config, compose)
 	}
 }
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dockforward "dockforward/pkg"
+	"dockforward/pkg/ipc"
+	dfsync "dockforward/pkg/sync"
+	"dockforward/pkg/version"
+)
+
+func TestExtractWrapperFlags(t *testing.T) {
+	tests := []struct {
+		args  []string
+		flags wrapperFlags
+		rest  []string
+	}{
+		{[]string{"ps", "-a"}, wrapperFlags{}, []string{"ps", "-a"}},
+		{[]string{"--ssh-key", "~/.ssh/deploy", "build", "."}, wrapperFlags{sshKey: "~/.ssh/deploy"}, []string{"build", "."}},
+		{[]string{"--ssh-key=agent", "compose", "up"}, wrapperFlags{sshKey: "agent"}, []string{"compose", "up"}},
+		{[]string{"--ssh-key", "a", "--ssh-key=b", "ps"}, wrapperFlags{sshKey: "b"}, []string{"ps"}},
+		{[]string{"--remote-dir", "/home/deploy/myapp", "build", "."}, wrapperFlags{remoteDir: "/home/deploy/myapp"}, []string{"build", "."}},
+		{[]string{"--remote-dir=/srv/app", "--ssh-key", "k", "build"}, wrapperFlags{sshKey: "k", remoteDir: "/srv/app"}, []string{"build"}},
+		{[]string{"--no-sync", "--ssh-key=k", "build", "."}, wrapperFlags{sshKey: "k", noSync: true}, []string{"build", "."}},
+		{[]string{"--verbose", "--quiet", "build", "--quiet", "."}, wrapperFlags{verbose: true, quiet: true}, []string{"build", "--quiet", "."}},
+		{[]string{"--timeout", "10m", "build", "."}, wrapperFlags{timeout: "10m"}, []string{"build", "."}},
+		{[]string{"--dfw-bwlimit=500K", "compose", "up"}, wrapperFlags{bwLimit: "500K"}, []string{"compose", "up"}},
+		{[]string{"--dfw-symlinks", "follow", "build", "."}, wrapperFlags{symlinks: "follow"}, []string{"build", "."}},
+		{[]string{"--dfw-verify", "build", "--verify"}, wrapperFlags{verify: true}, []string{"build", "--verify"}},
+		{[]string{"--dfw-yes", "compose", "up", "--build"}, wrapperFlags{yes: true}, []string{"compose", "up", "--build"}},
+		// After the docker command the flags belong to docker or the container
+		{[]string{"run", "alpine", "--ssh-key", "x"}, wrapperFlags{}, []string{"run", "alpine", "--ssh-key", "x"}},
+		{[]string{"build", "--remote-dir", "/srv"}, wrapperFlags{}, []string{"build", "--remote-dir", "/srv"}},
+		{[]string{"build", "--no-sync", "."}, wrapperFlags{}, []string{"build", "--no-sync", "."}},
+	}
+	for _, tt := range tests {
+		flags, rest, err := extractWrapperFlags(tt.args)
+		if err != nil {
+			t.Errorf("extractWrapperFlags(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if flags != tt.flags || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("extractWrapperFlags(%q) = %+v, %q; want %+v, %q", tt.args, flags, rest, tt.flags, tt.rest)
+		}
+	}
+
+	for _, args := range [][]string{{"--ssh-key"}, {"--ssh-key="}, {"--ssh-key", ""}, {"--remote-dir"}, {"--remote-dir=", "build"}, {"--timeout"}, {"--dfw-bwlimit"}} {
+		if _, _, err := extractWrapperFlags(args); err == nil {
+			t.Errorf("extractWrapperFlags(%q) accepted a missing value", args)
+		}
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	if timeout, err := parseTimeout("1m30s"); err != nil || timeout != 90*time.Second {
+		t.Errorf("parseTimeout(1m30s) = %v, %v; want 1m30s", timeout, err)
+	}
+	for _, value := range []string{"10", "soon", "0s", "-5m"} {
+		if _, err := parseTimeout(value); err == nil {
+			t.Errorf("parseTimeout(%q) accepted an invalid timeout", value)
+		}
+	}
+}
+
+func TestExecuteRemoteDockerTimeout(t *testing.T) {
+	// A stand-in ssh that hangs until it's sent SIGTERM, recording that it was
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "terminated")
+	script := "#!/bin/sh\ntrap 'touch " + marker + "; exit 143' TERM\nwhile :; do sleep 0.1; done\n"
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := executeRemoteDocker(ctx, "deploy", "example.invalid", []string{"build", "."}, "", false, nil); err == nil {
+		t.Fatal("executeRemoteDocker succeeded after the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("executeRemoteDocker returned after %v, want soon after the 200ms timeout", elapsed)
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("ctx.Err() = %v, want DeadlineExceeded", ctx.Err())
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("ssh was not sent SIGTERM")
+	}
+}
+
+func TestEnvAssignments(t *testing.T) {
+	t.Setenv("DOCKER_BUILDKIT", "1")
+	t.Setenv("COMPOSE_PROJECT_NAME", "it's mine")
+	t.Setenv("COMPOSE_FILE", "")
+	os.Unsetenv("COMPOSE_FILE") // Restored by t.Setenv
+
+	got := envAssignments([]string{"DOCKER_BUILDKIT", "COMPOSE_FILE", "COMPOSE_PROJECT_NAME"})
+	want := `DOCKER_BUILDKIT='1' COMPOSE_PROJECT_NAME='it'\''s mine' `
+	if got != want {
+		t.Errorf("envAssignments = %q, want %q", got, want)
+	}
+	if got := envAssignments(nil); got != "" {
+		t.Errorf("envAssignments(nil) = %q, want nothing", got)
+	}
+}
+
+func TestExecuteRemoteDockerQuotesRemoteDir(t *testing.T) {
+	// Stand-ins for ssh, running the remote command locally, and docker, noting where it ran
+	bin, out := t.TempDir(), filepath.Join(t.TempDir(), "pwd")
+	scripts := map[string]string{
+		"ssh":    "#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n",
+		"docker": "#!/bin/sh\npwd > " + dockforward.ShellQuote(out) + "\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// A --remote-dir with a space and a command substitution that mustn't run
+	remoteDir := filepath.Join(t.TempDir(), "my app $(touch pwned)")
+	if err := os.Mkdir(remoteDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := executeRemoteDocker(context.Background(), "deploy", "example.invalid", []string{"ps"}, remoteDir, true, nil); err != nil {
+		t.Fatalf("executeRemoteDocker failed: %v", err)
+	}
+	if got, _ := os.ReadFile(out); strings.TrimSpace(string(got)) != remoteDir {
+		t.Errorf("docker ran in %q, want %q", strings.TrimSpace(string(got)), remoteDir)
+	}
+}
+
+func TestFindRemoteComposeFile(t *testing.T) {
+	// A stand-in ssh that runs the remote command locally
+	bin := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The remote directory may be a --remote-dir with a space in it
+	dir := filepath.Join(t.TempDir(), "my app")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	find := func() string {
+		t.Helper()
+		file, err := findRemoteComposeFile(context.Background(), "deploy", "example.invalid", dir)
+		if err != nil {
+			t.Fatalf("findRemoteComposeFile failed: %v", err)
+		}
+		return file
+	}
+	if got := find(); got != "" {
+		t.Errorf("found %q in an empty directory", got)
+	}
+	// Later names only win when the earlier ones are missing
+	for _, name := range []string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := find(); got != name {
+			t.Errorf("with %s added, found %q", name, got)
+		}
+	}
+}
+
+func TestLastRemoteDir(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	staging := &dockforward.ServerConfig{Name: "staging", Host: "staging.example.com:22", User: "deploy"}
+	prod := &dockforward.ServerConfig{Name: "prod", Host: "prod.example.com:22", User: "deploy"}
+
+	if _, err := readLastRemoteDir(staging); err == nil {
+		t.Fatal("readLastRemoteDir succeeded before any sync")
+	}
+	if err := writeLastRemoteDir(staging, "/tmp/docker-context-abc"); err != nil {
+		t.Fatalf("writeLastRemoteDir failed: %v", err)
+	}
+	if err := writeLastRemoteDir(prod, "/srv/app"); err != nil {
+		t.Fatalf("writeLastRemoteDir failed: %v", err)
+	}
+	if dir, err := readLastRemoteDir(staging); err != nil || dir != "/tmp/docker-context-abc" {
+		t.Errorf("readLastRemoteDir(staging) = %q, %v; want /tmp/docker-context-abc", dir, err)
+	}
+	if dir, err := readLastRemoteDir(prod); err != nil || dir != "/srv/app" {
+		t.Errorf("readLastRemoteDir(prod) = %q, %v; want /srv/app", dir, err)
+	}
+}
+
+func TestSyncContext(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := &dockforward.ServerConfig{Name: "staging", Host: "staging.example.com:22", User: "deploy"}
+	syncer := &dfsync.MockSyncer{}
+	opts := dfsync.SyncOptions{LocalDir: "/src/app", RemoteDir: "/tmp/docker-context-abc", ExtraExcludes: []string{"fixtures/"}}
+	if err := syncContext(context.Background(), syncer, server, nil, opts); err != nil {
+		t.Fatalf("syncContext failed: %v", err)
+	}
+	want := []dfsync.SyncOptions{opts}
+	if !reflect.DeepEqual(syncer.Syncs, want) {
+		t.Errorf("synced %+v, want %+v", syncer.Syncs, want)
+	}
+	if dir, err := readLastRemoteDir(server); err != nil || dir != "/tmp/docker-context-abc" {
+		t.Errorf("last context = %q, %v; want /tmp/docker-context-abc", dir, err)
+	}
+
+	// A failed sync isn't remembered
+	syncer.Err = dockforward.ErrHostUnreachable
+	if err := syncContext(context.Background(), syncer, server, nil, dfsync.SyncOptions{LocalDir: "/src/app", RemoteDir: "/srv/app"}); !errors.Is(err, dockforward.ErrHostUnreachable) {
+		t.Errorf("syncContext = %v, want ErrHostUnreachable", err)
+	}
+	if dir, _ := readLastRemoteDir(server); dir != "/tmp/docker-context-abc" {
+		t.Errorf("last context = %q after a failed sync", dir)
+	}
+}
+
+// reportingMonitor is a monitor forwarding one server
+type reportingMonitor struct {
+	server string
+}
+
+func (m reportingMonitor) StatusReport() dockforward.StatusReport {
+	return dockforward.StatusReport{Source: "monitor", Servers: []dockforward.ServerReport{{Name: m.server, Connected: true}}}
+}
+
+func TestMonitorState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	config := &dockforward.Config{
+		Servers: []dockforward.ServerConfig{
+			{Name: "staging", Host: "staging.example.com:22", User: "deploy"},
+			{Name: "prod", Host: "prod.example.com:22", User: "deploy"},
+		},
+		CurrentServer: "staging",
+	}
+
+	// Unix socket paths are limited to about 100 bytes, which t.TempDir can exceed
+	dir, err := os.MkdirTemp("", "dockforward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	monitor := ipc.NewClient(filepath.Join(dir, "monitor.sock"))
+
+	// With no monitor running, the config and state file are used
+	if server := monitorServer(config, monitor); server.Name != "staging" {
+		t.Errorf("server with no monitor = %s, want the config's staging", server.Name)
+	}
+	if err := writeLastRemoteDir(&config.Servers[0], "/tmp/docker-context-abc"); err != nil {
+		t.Fatal(err)
+	}
+	if dir, err := lastSyncedDir(&config.Servers[0], monitor); err != nil || dir != "/tmp/docker-context-abc" {
+		t.Errorf("lastSyncedDir with no monitor = %q, %v, want the state file's", dir, err)
+	}
+
+	listener, err := ipc.Serve(filepath.Join(dir, "monitor.sock"), reportingMonitor{server: "prod"})
+	if err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	defer listener.Close()
+	if server := monitorServer(config, monitor); server.Name != "prod" {
+		t.Errorf("server = %s, want prod, which the monitor forwards", server.Name)
+	}
+	if err := checkRemoteDocker(config, monitor); err != nil {
+		t.Errorf("checkRemoteDocker with a connected monitor = %v", err)
+	}
+	if err := monitor.SetSyncedDir("staging", "/srv/app"); err != nil {
+		t.Fatal(err)
+	}
+	if dir, err := lastSyncedDir(&config.Servers[0], monitor); err != nil || dir != "/srv/app" {
+		t.Errorf("lastSyncedDir = %q, %v, want the monitor's /srv/app", dir, err)
+	}
+}
+
+func TestSSHKeyOptions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	key := filepath.Join(home, ".ssh", "deploy")
+	if err := os.MkdirAll(filepath.Dir(key), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(key, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := sshKeyOptions("~/.ssh/deploy")
+	if err != nil {
+		t.Fatalf("sshKeyOptions failed: %v", err)
+	}
+	if want := []string{"-i", key, "-o", "IdentitiesOnly=yes"}; !reflect.DeepEqual(options, want) {
+		t.Errorf("options = %q, want %q", options, want)
+	}
+	if _, err := sshKeyOptions("~/.ssh/missing"); err == nil {
+		t.Error("sshKeyOptions accepted a missing key file")
+	}
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	if _, err := sshKeyOptions("agent"); err == nil {
+		t.Error("sshKeyOptions accepted agent without SSH_AUTH_SOCK")
+	}
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	if options, err := sshKeyOptions("agent"); err != nil || len(options) != 0 {
+		t.Errorf("sshKeyOptions(agent) = %q, %v", options, err)
+	}
+}
+
+func TestSSHFailuresClassified(t *testing.T) {
+	bin := t.TempDir()
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	// standIn replaces ssh with a script printing message to stderr and exiting with status
+	standIn := func(message string, status int) {
+		t.Helper()
+		script := fmt.Sprintf("#!/bin/sh\necho '%s' >&2\nexit %d\n", message, status)
+		if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		message string
+		status  int
+		want    error
+		code    int
+	}{
+		{"deploy@example.invalid: Permission denied (publickey).", 255, dockforward.ErrAuthFailed, authFailedExitCode},
+		{"ssh: Could not resolve hostname example.invalid: Name or service not known", 255, dockforward.ErrHostUnreachable, hostUnreachableExitCode},
+		{"ssh: connect to host example.invalid port 22: Connection refused", 255, dockforward.ErrHostUnreachable, hostUnreachableExitCode},
+		{"Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?", 1, dockforward.ErrDaemonUnavailable, daemonUnavailableExitCode},
+		// A remote command that happens to print ssh's wording is left alone
+		{"Permission denied (publickey).", 1, nil, 1},
+	}
+	for _, tt := range tests {
+		standIn(tt.message, tt.status)
+		err := executeRemoteDocker(context.Background(), "deploy", "example.invalid", []string{"ps"}, "", false, nil)
+		if err == nil {
+			t.Errorf("%q: executeRemoteDocker succeeded", tt.message)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%q: err = %v, want %v", tt.message, err, tt.want)
+		}
+		if got := exitCode(err); got != tt.code {
+			t.Errorf("%q: exit code %d, want %d", tt.message, got, tt.code)
+		}
+	}
+
+	full := fmt.Errorf("failed to sync: %w", fmt.Errorf("rsync failed: %w: /dev/sda1 on /tmp has 0 KiB free (100%% used)", dockforward.ErrRemoteDiskFull))
+	if got := exitCode(full); got != remoteFullExitCode {
+		t.Errorf("full disk: exit code %d, want %d", got, remoteFullExitCode)
+	}
+
+	// The classification survives the wrapping on the way up
+	standIn("deploy@example.invalid: Permission denied (publickey).", 255)
+	syncer := dfsync.NewRsyncSyncer("deploy", "example.invalid", nil)
+	if err := syncer.Cleanup(context.Background()); !errors.Is(err, dockforward.ErrAuthFailed) {
+		t.Errorf("Cleanup = %v, want ErrAuthFailed", err)
+	}
+	if _, err := syncer.Sync(context.Background(), dfsync.SyncOptions{LocalDir: t.TempDir(), RemoteDir: "/tmp/docker-context-test"}); !errors.Is(err, dockforward.ErrAuthFailed) {
+		t.Errorf("Sync = %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestInteractiveSession(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"compose", "exec", "app", "bash"}, true},
+		{[]string{"compose", "-f", "dev.yml", "run", "--rm", "-e", "DEBUG=1", "app", "sh"}, true},
+		{[]string{"compose", "exec", "-T", "db", "pg_dump"}, false},
+		{[]string{"compose", "run", "-d", "worker"}, false},
+		{[]string{"compose", "exec", "app", "ls", "-d"}, true},
+		{[]string{"compose", "up"}, false},
+		{[]string{"exec", "-it", "web", "sh"}, true},
+		{[]string{"container", "exec", "--tty", "-i", "web", "sh"}, true},
+		{[]string{"run", "--rm", "-e", "A=1", "-t", "alpine"}, true},
+		{[]string{"exec", "web", "top", "-t"}, false},
+		{[]string{"exec", "-i", "web", "cat"}, false},
+		{[]string{"attach", "web"}, true},
+		{[]string{"build", "-t", "myapp", "."}, false},
+	}
+	for _, tt := range tests {
+		if got := interactiveSession(tt.args); got != tt.want {
+			t.Errorf("interactiveSession(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCommandExitCode(t *testing.T) {
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	if got := commandExitCode(err); got != 3 {
+		t.Errorf("exit code %d, want the command's 3", got)
+	}
+	if got := commandExitCode(fmt.Errorf("%w: exit status 255", dockforward.ErrAuthFailed)); got != authFailedExitCode {
+		t.Errorf("exit code %d after an auth failure, want %d", got, authFailedExitCode)
+	}
+	if got := commandExitCode(errors.New("no ssh")); got != 1 {
+		t.Errorf("exit code %d, want 1", got)
+	}
+}
+
+func TestPrintVersion(t *testing.T) {
+	var out strings.Builder
+	printVersion(&out, []string{"version"}, nil)
+	if !strings.HasPrefix(out.String(), "\nDockforward: "+version.Version) {
+		t.Errorf("printed %q, want the Dockforward version", out.String())
+	}
+	out.Reset()
+	printVersion(&out, []string{"version", "--format", "{{json .}}"}, nil)
+	if out.Len() != 0 {
+		t.Errorf("printed %q after --format output", out.String())
+	}
+}
@@ -0,0 +1,94 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+func TestInteractiveSessionTerminal(t *testing.T) {
+	// A stand-in ssh recording its arguments and running the remote command locally, and a
+	// docker that reports the terminal's size before and after a line is typed
+	bin := t.TempDir()
+	argsFile := filepath.Join(bin, "ssh-args")
+	scripts := map[string]string{
+		"ssh":    "#!/bin/sh\necho \"$@\" > " + argsFile + "\nfor last; do :; done\nexec sh -c \"$last\"\n",
+		"docker": "#!/bin/sh\necho \"size $(stty size)\"\nread line\necho \"size $(stty size)\"\nexit 3\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	terminal, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	defer terminal.Close()
+	if err := pty.Setsize(tty, &pty.Winsize{Rows: 40, Cols: 120}); err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = tty, tty
+	defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+
+	// Collect what the session prints to the terminal
+	var mu sync.Mutex
+	var printed strings.Builder
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := terminal.Read(buf)
+			mu.Lock()
+			printed.Write(buf[:n])
+			mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	waitFor := func(want string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			mu.Lock()
+			done := strings.Contains(printed.String(), want)
+			mu.Unlock()
+			if done {
+				return
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		t.Fatalf("terminal shows %q, want %q", printed.String(), want)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- executeRemoteDocker(context.Background(), "deploy", "example.invalid", []string{"compose", "exec", "app", "bash"}, "", false, nil)
+	}()
+	waitFor("size 40 120")
+	if err := pty.Setsize(tty, &pty.Winsize{Rows: 50, Cols: 132}); err != nil {
+		t.Fatal(err)
+	}
+	terminal.Write([]byte("\n"))
+	waitFor("size 50 132")
+
+	err = <-done
+	tty.Close()
+	if got := commandExitCode(err); got != 3 {
+		t.Errorf("exit code %d after %v, want the command's 3", got, err)
+	}
+	if args, _ := os.ReadFile(argsFile); !strings.HasPrefix(string(args), "-tt ") {
+		t.Errorf("ssh was run with %q, want -tt", args)
+	}
+}
@@ -3,14 +3,23 @@ module dockforward
 go 1.23.5
 
 require (
+	github.com/atotto/clipboard v0.1.4
+	github.com/creack/pty v1.1.24
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/spf13/cobra v1.8.1
 	golang.org/x/crypto v0.32.0
+	golang.org/x/net v0.32.0
+	golang.org/x/sys v0.29.0
+	golang.org/x/term v0.28.0
+	google.golang.org/grpc v1.70.0
+	google.golang.org/protobuf v1.36.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241202173237-19429a94021a // indirect
 )
@@ -2,18 +2,33 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"log/slog"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strings"
-	"strconv"
+	"sync/atomic"
 	"syscall"
-	"time"
+	"text/template"
 	"io/ioutil"
+	"net/http"
+	"time"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 	dockforward "dockforward/pkg"
+	"dockforward/pkg/api"
+	dfgrpc "dockforward/pkg/grpc"
+	"dockforward/pkg/ipc"
+	"dockforward/pkg/version"
+	"dockforward/pkg/web"
 )
 
 // getSSHConfig loads SSH configuration from config file with fallback defaults
@@ -24,12 +39,12 @@ func getSSHConfig() (user, host, keyPath string) {
 	keyPath = "~/.ssh/id_rsa"
 
 	// Get config directory
-	homeDir, err := os.UserHomeDir()
+	configDir, err := dockforward.GetConfigDir()
 	if err != nil {
 		return
 	}
 
-	configPath := filepath.Join(homeDir, ".config", "dockforward", "config")
+	configPath := filepath.Join(configDir, "config")
 	configData, err := ioutil.ReadFile(configPath)
 	if err != nil {
 		return
@@ -70,12 +85,12 @@ func getConfigCommand() *cobra.Command {
 		Use:   "config",
 		Short: "Configure connection settings",
 		Run: func(cmd *cobra.Command, args []string) {
-			homeDir, err := os.UserHomeDir()
+			// The prompts wait on stdin, not the root context, so Ctrl+C should just exit
+			signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+			configDir, err := dockforward.GetConfigDir()
 			if err != nil {
-				log.Fatalf("Failed to get home directory: %v", err)
+				log.Fatal(err)
 			}
-
-			configDir := filepath.Join(homeDir, ".config", "dockforward")
 			if err := os.MkdirAll(configDir, 0755); err != nil {
 				log.Fatalf("Failed to create config directory: %v", err)
 			}
@@ -113,9 +128,74 @@ func getConfigCommand() *cobra.Command {
 			fmt.Println("Configuration updated successfully")
 		},
 	}
+	cmd.AddCommand(getConfigShowCommand())
 	return cmd
 }
 
+// getConfigShowCommand returns a command that prints the config as dockforward loads it
+func getConfigShowCommand() *cobra.Command {
+	var showSecrets, expandEnv bool
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the resolved config.json as formatted JSON",
+		Long: `Print config.json as dockforward loads it, after dropping invalid servers, with the
+API token and webhook secrets masked as ***.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			config, err := dockforward.LoadConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+				os.Exit(1)
+			}
+			data, err := config.Show(showSecrets, expandEnv)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+		},
+	}
+	cmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print the API token and webhook secrets instead of ***")
+	cmd.Flags().BoolVar(&expandEnv, "expand-env", false, "Replace $VAR and ${VAR} in values with the environment variables")
+	return cmd
+}
+
+// simpleInput disables raw keyboard mode in favor of line-based input
+var simpleInput bool
+
+// noColor disables ANSI colors in all output
+var noColor bool
+
+// mouse enables clicking table rows in terminals that report mouse events
+var mouse bool
+
+// headless forwards ports without the TUI, for running under a service manager
+var headless bool
+
+// logFile and logFormat set where and how headless mode writes its logs
+var logFile, logFormat string
+
+// filterExprs restrict the containers monitored, as key=value Docker filters
+var filterExprs []string
+
+// connectRetries is how many more times headless mode tries the initial connection
+var connectRetries int
+
+// verbose and quiet log debug details, or only warnings and errors
+var verbose, quiet bool
+
+// serverName picks the server to connect to instead of the config's current server
+var serverName string
+
+// grpcAddr is where the gRPC API listens, overriding the config's api.grpc_addr
+var grpcAddr string
+
+// apiAddr is where the REST API listens; empty doesn't serve it
+var apiAddr string
+
+// webAddr is where the browser terminal is served; empty doesn't serve it
+var webAddr string
+
 // getMonitorName returns the monitor binary name based on current binary name
 func getMonitorName() string {
 	if filepath.Base(os.Args[0]) == "docker" {
@@ -129,11 +209,38 @@ func main() {
 		Use:   getMonitorName(),
 		Short: "Monitor and forward Docker ports from a remote host",
 		Run: monitorCommand,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			dockforward.SetLogLevel(dockforward.LogLevelFor(verbose, quiet))
+		},
 	}
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log debug details, such as each port forward and Docker API request")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "Only log warnings and errors")
 
+	rootCmd.Flags().BoolVar(&simpleInput, "simple-input", false, "Read line-based commands instead of single keypresses (for dumb terminals)")
+	rootCmd.Flags().BoolVar(&mouse, "mouse", false, "Enable mouse support to select table rows by clicking them")
+	rootCmd.Flags().BoolVar(&noColor, "no-color", false, "Disable colored output (also honors the NO_COLOR environment variable)")
+	rootCmd.Flags().BoolVar(&headless, "headless", false, "Forward ports and log state changes without the interactive screens")
+	rootCmd.Flags().StringVar(&logFile, "log-file", "", "Write headless logs to this file instead of stdout (default: logging.file in the config)")
+	rootCmd.Flags().StringVar(&logFormat, "log-format", "text", "Headless log format: text or json")
+	rootCmd.Flags().StringArrayVar(&filterExprs, "filter", nil, "Only monitor containers matching a Docker filter, e.g. label=com.docker.compose.project=myapp (repeatable)")
+	rootCmd.Flags().IntVar(&connectRetries, "retries", 3, "Times to retry the initial connection in headless mode before exiting")
+	rootCmd.Flags().StringVar(&serverName, "server", "", "Connect to this configured server instead of the current one")
+	rootCmd.Flags().StringVar(&grpcAddr, "grpc-addr", "", "Serve the gRPC API on this address, e.g. 127.0.0.1:50051 (default: api.grpc_addr in the config)")
+	rootCmd.Flags().StringVar(&apiAddr, "api-addr", "", "Serve the REST API on this address, e.g. 127.0.0.1:8765, checking api_token from the config, which other addresses need")
+	rootCmd.Flags().StringVar(&webAddr, "web-addr", "", "Serve the screens to browsers on this address, e.g. 127.0.0.1:8766, checking api_token from the config, which other addresses need")
 	rootCmd.AddCommand(getConfigCommand())
+	rootCmd.AddCommand(getStatusCommand())
+	rootCmd.AddCommand(getPullCommand())
+	rootCmd.AddCommand(getSSHCommand())
+	rootCmd.AddCommand(getEventsCommand())
+	rootCmd.AddCommand(getServiceCommand())
+	rootCmd.AddCommand(getVersionCommand())
 
-	if err := rootCmd.Execute(); err != nil {
+	// Cancelled on the first SIGINT or SIGTERM so connections and remote commands unwind; the
+	// default handling comes back then, so a second signal exits at once
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -144,108 +251,767 @@ func monitorCommand(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	filters, err := dockforward.ParseFilters(filterExprs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if serverName != "" {
+		if config.Server(serverName) == nil {
+			log.Fatalf("No server named %q is configured", serverName)
+		}
+		config.CurrentServer = serverName
+	}
+
+	if headless {
+		os.Exit(runHeadless(cmd.Context(), config, filters))
+	}
 
 	// Create display manager
 	display, err := dockforward.NewDisplayManager(config, nil)
 	if err != nil {
 		log.Fatalf("Error creating display manager: %v", err)
 	}
+	if noColor {
+		display.SetColorizer(dockforward.NewColorizer(false))
+	}
+	display.SetFilters(filters)
+	display.SetEventLogger(openEventLog())
+	pluginErr := loadPlugins(display)
+
+	// Connect to the default server before the TUI takes over the screen, so the spinner
+	// is visible; any error is logged once the message area is set up
+	var connectErr error
+	if server := config.GetCurrentServer(); server != nil {
+		connectErr = connect(cmd.Context(), display, server)
+		if cmd.Context().Err() != nil {
+			os.Exit(1) // Interrupted while connecting
+		}
+	}
+
+	// Use single-keypress input unless asked not to or stdin isn't a terminal
+	input := dockforward.NewInputHandler()
+	if !simpleInput {
+		if rawInput, err := dockforward.NewRawInputHandler(); err == nil {
+			input = rawInput
+		}
+	}
+	display.SetInputHandler(input)
+	if mouse && input.Raw() {
+		display.EnableMouse()
+	}
+
+	// Route log output into the display's message area while the TUI owns the screen
+	display.Start()
+	log.SetOutput(display.MessageWriter())
+	dockforward.SetLogHook(display.Log)
+	display.Log(dockforward.LevelDebug, fmt.Sprintf("%s %s", getMonitorName(), version.Get()))
+	if connectErr != nil {
+		display.Log(dockforward.LevelError, connectErr.Error())
+		if hint := dockforward.ErrorHint(connectErr); hint != "" {
+			display.Log(dockforward.LevelInfo, hint)
+		}
+	}
+	if pluginErr != nil {
+		display.Log(dockforward.LevelWarn, pluginErr.Error())
+		if hint := dockforward.ErrorHint(pluginErr); hint != "" {
+			display.Log(dockforward.LevelInfo, hint)
+		}
+	}
+
+	// quit restores the terminal before tearing down, so a second Ctrl+C arrives as a
+	// signal and can force the exit if teardown hangs
+	var quitting atomic.Bool
+	stopStatus := serveIPC(display)
+	stopAPI := serveAPI(config.API, display)
+	stopGRPC := serveGRPC(config.API, display)
+	stopREST := serveREST(config.APIToken, display)
+	stopWeb := serveWeb(config.APIToken, display)
+	quit := func() {
+		quitting.Store(true)
+		stopStatus()
+		stopAPI()
+		stopGRPC()
+		stopREST()
+		stopWeb()
+		input.Restore()
+		display.Stop()
+		dockforward.SetLogHook(nil)
+		log.SetOutput(os.Stderr)
+		fmt.Println("Shutting down... (press Ctrl+C again to force)")
+		display.Shutdown()
+		os.Exit(0)
+	}
+	display.SetQuitHandler(quit)
+
+	// Leave the terminal usable if the main loop panics
+	defer func() {
+		if r := recover(); r != nil {
+			dockforward.SetLogHook(nil)
+			log.SetOutput(os.Stderr)
+			input.Restore()
+			display.Stop()
+			panic(r)
+		}
+	}()
+
+	// Another monitor taking over this server asks for its lock
+	release := make(chan os.Signal, 1)
+	dockforward.NotifyRelease(release)
+	go func() {
+		for range release {
+			display.ReleaseServer()
+		}
+	}()
 
 	// Setup signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		<-sigChan
-		fmt.Println("\nShutting down...")
-		os.Exit(0)
+		for range sigChan {
+			if quitting.Load() {
+				fmt.Fprintln(os.Stderr, "Forced exit")
+				os.Exit(1)
+			}
+			go quit()
+		}
 	}()
 
-	var dockerClient *dockforward.DockerClient
-	var sshClient *dockforward.SSHClient
+	// Display initial screen
+	display.Display()
 
-	// Attempt to connect to the default server
-	if server := config.GetCurrentServer(); server != nil {
-		sshClient, err = dockforward.NewSSHClient(server.User, server.Host, server.KeyPath)
-		if err != nil {
-			log.Printf("Error creating SSH client for default server: %v", err)
-		} else {
-			dockerClient, err = dockforward.NewDockerClient(sshClient)
+	// Main loop, reading input on this goroutine so screen prompts don't compete for stdin
+	for {
+		if input.Raw() {
+			key, err := input.ReadKey()
 			if err != nil {
-				log.Printf("Error creating Docker client for default server: %v", err)
-				sshClient.Close()
-			} else {
-				dockerClient.Start()
-				display.SetDockerClient(dockerClient)
-				display.SetMode(dockforward.ModeOverview)
-				fmt.Println("Connected to default server. Starting service monitor...")
+				log.Printf("Error reading input: %v", err)
+				quit()
 			}
+			if key.Type == dockforward.KeyCtrlC {
+				quit()
+			}
+			display.HandleKeys(key)
+			continue
+		}
+
+		line, err := input.ReadInput()
+		if err != nil {
+			log.Printf("Error reading input: %v", err)
+			quit()
+		}
+		display.HandleLine(line)
+	}
+}
+
+// connect opens SSH and Docker API connections to server and shows its services, giving up
+// once ctx is done
+func connect(ctx context.Context, display *dockforward.DisplayManager, server *dockforward.ServerConfig) error {
+	spinner := dockforward.NewSpinner()
+	defer spinner.Stop()
+
+	spinner.Start(fmt.Sprintf("Connecting to %s (%s)...", server.Name, server.Host))
+	sshClient, err := dockforward.NewSSHClientContext(ctx, server.User, server.Host, server.KeyPath)
+	if err != nil {
+		return fmt.Errorf("Error creating SSH client for default server: %w", err)
+	}
+	dockerClient, err := dockforward.NewDockerClient(sshClient, server.DialTimeout())
+	if err != nil {
+		sshClient.Close()
+		return fmt.Errorf("Error creating Docker client for default server: %v", err)
+	}
+
+	if server.UseWSL2 {
+		if err := dockerClient.UseWSL2(server.WSL2Distro); err != nil {
+			dockerClient.Close()
+			sshClient.Close()
+			return err
 		}
 	}
+	spinner.Start("Starting Docker API connection...")
+	dockerClient.StartContext(ctx)
+	dockerClient.DetectSwarmContext(ctx)
+	spinner.Stop()
+	if err := ctx.Err(); err != nil {
+		dockerClient.Close()
+		sshClient.Close()
+		return fmt.Errorf("Error connecting to default server: %v", err)
+	}
+
+	display.SetDockerClient(dockerClient)
+	display.SetMode(dockforward.ModeOverview)
+	fmt.Println("Connected to default server. Starting service monitor...")
+	return nil
+}
 
-	// Create channel for input
-	inputChan := make(chan string)
+// runHeadless forwards the current server's ports, or --server's, until SIGINT or SIGTERM, reloading the
+// config on SIGHUP, and returns the exit code. Only containers matching filters are forwarded.
+func runHeadless(ctx context.Context, config *dockforward.Config, filters map[string][]string) int {
+	var out io.Writer = os.Stdout
+	if logFile != "" || config.Logging.File != "" {
+		file, err := config.Logging.OpenFile(logFile)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+	options := &slog.HandlerOptions{Level: dockforward.LogLevelFor(verbose, quiet).SlogLevel()}
+	var handler slog.Handler
+	switch logFormat {
+	case "text":
+		handler = slog.NewTextHandler(out, options)
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		log.Printf("Unknown log format %q, expected text or json", logFormat)
+		return 1
+	}
+	logger := slog.New(handler)
+	// Route the package's own log output through the same handler
+	slog.SetDefault(logger)
+	info := version.Get()
+	logger.Info("starting", "version", info.Version, "commit", info.GitCommit, "built", info.BuildDate, "go", info.GoVersion)
 
-	// Start input handling goroutine
+	// Another monitor taking over this server stops this one, releasing the lock as it does
+	ctx, takenOver := context.WithCancel(ctx)
+	defer takenOver()
+	release := make(chan os.Signal, 1)
+	dockforward.NotifyRelease(release)
 	go func() {
-		reader := bufio.NewReader(os.Stdin)
-		for {
-			input, err := reader.ReadString('\n')
-			if err != nil {
-				log.Printf("Error reading input: %v", err)
-				continue
+		<-release
+		logger.Warn("another monitor is taking over, stopping")
+		takenOver()
+	}()
+	reload := make(chan struct{}, 1)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			select {
+			case reload <- struct{}{}:
+			default: // A reload is already pending
 			}
-			inputChan <- strings.TrimSpace(input)
 		}
 	}()
 
-	// Display initial screen
-	display.Display()
+	forwarder := dockforward.NewHeadless(config, logger)
+	forwarder.SetFilters(filters)
+	forwarder.SetServer(serverName)
+	events := openEventLog()
+	defer events.Close()
+	forwarder.SetEventLogger(events)
+	if err := forwarder.Connect(ctx, connectRetries); err != nil {
+		logger.Error("initial connection failed", "err", err)
+		return 1
+	}
+	defer serveIPC(forwarder)()
+	defer serveAPI(config.API, forwarder)()
+	defer serveGRPC(config.API, forwarder)()
+	defer serveREST(config.APIToken, forwarder)()
+	forwarder.Run(ctx, reload)
+	logger.Info("stopped")
+	return 0
+}
 
-	// Main loop
-	for {
-		select {
-		case input := <-inputChan:
-			handled := display.HandleInput(input)
-			if !handled {
-				switch input {
-				case "b", "back":
-					if sshClient != nil {
-						sshClient.Close()
-						sshClient = nil
-					}
-					if dockerClient != nil {
-						dockerClient = nil
-					}
-					display.SetDockerClient(nil)
-					display.SetMode(dockforward.ModeServerList)
-				default:
-					if idx, err := strconv.Atoi(input); err == nil && idx >= 0 && idx < len(config.Servers) {
-						server := &config.Servers[idx]
-						if sshClient != nil {
-							sshClient.Close()
-						}
-						sshClient, err = dockforward.NewSSHClient(server.User, server.Host, server.KeyPath)
-						if err != nil {
-							log.Printf("Error creating SSH client: %v", err)
-							continue
-						}
-						dockerClient, err = dockforward.NewDockerClient(sshClient)
-						if err != nil {
-							log.Printf("Error creating Docker client: %v", err)
-							sshClient.Close()
-							continue
-						}
-						dockerClient.Start()
-						display.SetDockerClient(dockerClient)
-						display.SetMode(dockforward.ModeOverview)
-						fmt.Printf("Connected to %s. Starting service monitor...\n", server.Name)
+// serveIPC answers `status` and the docker wrapper on the control socket, returning a func
+// that stops. The monitor works without it, so failures are only logged.
+func serveIPC(target dockforward.ControlTarget) func() {
+	path, err := dockforward.ControlSocketPath()
+	if err != nil {
+		log.Printf("Status queries unavailable: %v", err)
+		return func() {}
+	}
+	listener, err := ipc.Serve(path, dockforward.NewControl(target))
+	if err != nil {
+		log.Printf("Status queries unavailable: %v", err)
+		return func() {}
+	}
+	return func() { listener.Close() }
+}
+
+// getStatusCommand returns a command that prints what's forwarded for scripts
+func getStatusCommand() *cobra.Command {
+	var asJSON, asCSV bool
+	var format string
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print services and forwarded ports; exits 1 on conflicts and 2 on errors",
+		Long: `Print services and forwarded ports, read from the running monitor or, if none is
+running, queried once from the current server without forwarding anything.
+
+Exits 0 when everything is fine, 1 if any local port is in conflict and 2 if a server
+is unreachable or a port failed to forward.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(printStatus(cmd.Context(), os.Stdout, asJSON, asCSV, format))
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the status as JSON")
+	cmd.Flags().BoolVar(&asCSV, "csv", false, "Print the services as CSV, one row per service")
+	cmd.Flags().StringVar(&format, "format", "", "Format the status with a Go template, e.g. '{{range .Servers}}{{.Name}}{{end}}'")
+	return cmd
+}
+
+// getPullCommand returns a command that pulls an image on the current server
+func getPullCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pull IMAGE",
+		Short: "Pull an image on the current server, showing each layer's progress",
+		Long: `Pull an image on the current server through its Docker API, for example to have it
+ready before a build. Exits 1 if the pull fails.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(pullImage(cmd.Context(), args[0]))
+		},
+	}
+}
+
+// getSSHCommand returns a command that opens a shell on a configured server
+func getSSHCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ssh [SERVER]",
+		Short: "Open a shell on a configured server, the current one by default",
+		Long: `Replace this process with ssh -t to the named server, or the current one, using its
+configured user, port and key. Anything else, such as a ProxyJump, comes from ~/.ssh/config.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			config, err := dockforward.LoadConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+				os.Exit(1)
+			}
+			server := config.GetCurrentServer()
+			if len(args) == 1 {
+				server = config.Server(args[0])
+			}
+			if server == nil {
+				if len(args) == 1 {
+					fmt.Fprintf(os.Stderr, "Server %q isn't configured\n", args[0])
+				} else {
+					fmt.Fprintln(os.Stderr, "No server configured")
+				}
+				os.Exit(1)
+			}
+
+			sshArgs := server.ShellArgs()
+			path, err := exec.LookPath(sshArgs[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to find ssh: %v\n", err)
+				os.Exit(1)
+			}
+			slog.Debug("Running ssh", "args", strings.Join(sshArgs[1:], " "))
+			// exec keeps the terminal and signals ssh's alone, as if it had been run directly
+			err = syscall.Exec(path, sshArgs, os.Environ())
+			fmt.Fprintf(os.Stderr, "Failed to run ssh: %v\n", err)
+			os.Exit(1)
+		},
+	}
+}
+
+// pullImage pulls image on the current server until it's done or ctx is cancelled, and returns the exit code
+func pullImage(ctx context.Context, image string) int {
+	config, err := dockforward.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	server := config.GetCurrentServer()
+	if server == nil {
+		fmt.Fprintln(os.Stderr, "No server configured")
+		return 1
+	}
+
+	// Connection progress would otherwise be logged around the progress bars
+	log.SetOutput(io.Discard)
+	docker, err := dockforward.ConnectContext(ctx, server)
+	if err != nil {
+		log.SetOutput(os.Stderr)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer func() {
+		docker.Close()
+		docker.GetClient().Close()
+	}()
+
+	progress, err := docker.PullImage(ctx, image)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	display := dockforward.NewPullDisplay(os.Stdout, term.IsTerminal(int(os.Stdout.Fd())))
+	for update := range progress {
+		display.Update(update)
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "Pull interrupted")
+		return 1
+	}
+	if err := display.Err(); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// serveAPI serves the control API if the config enables it, returning a func that stops it.
+// Like status queries, the monitor works without it, so failures are only logged.
+func serveAPI(prefs dockforward.APIPreferences, target dockforward.ControlTarget) func() {
+	if !prefs.Enabled {
+		return func() {}
+	}
+	listener, err := dockforward.ServeAPI(prefs, target)
+	if err != nil {
+		log.Printf("Control API unavailable: %v", err)
+		return func() {}
+	}
+	return func() { listener.Close() }
+}
+
+// serveGRPC serves the gRPC API on --grpc-addr, or the config's address, if either is set,
+// returning a func that stops it. Like the control API, failures are only logged.
+func serveGRPC(prefs dockforward.APIPreferences, target dockforward.ControlTarget) func() {
+	addr := grpcAddr
+	if addr == "" {
+		addr = prefs.GRPCAddr
+	}
+	if addr == "" {
+		return func() {}
+	}
+	server, err := dfgrpc.Serve(addr, dockforward.NewControl(target))
+	if err != nil {
+		log.Printf("gRPC API unavailable: %v", err)
+		return func() {}
+	}
+	return server.Stop
+}
+
+// serveREST serves the REST API on --api-addr if it's set, returning a func that stops it.
+// Like the control API, failures are only logged.
+func serveREST(token string, target dockforward.ControlTarget) func() {
+	if apiAddr == "" {
+		return func() {}
+	}
+	server, err := api.Serve(apiAddr, token, dockforward.NewControl(target))
+	if err != nil {
+		log.Printf("REST API unavailable: %v", err)
+		return func() {}
+	}
+	return func() { server.Close() }
+}
+
+// serveWeb serves the screens to browsers on --web-addr if it's set, returning a func that
+// stops it. Like the control API, failures are only logged.
+func serveWeb(token string, display *dockforward.DisplayManager) func() {
+	if webAddr == "" {
+		return func() {}
+	}
+	server, err := web.Serve(webAddr, token, display)
+	if err != nil {
+		log.Printf("Web terminal unavailable: %v", err)
+		return func() {}
+	}
+	return func() { server.Close() }
+}
+
+// openEventLog opens the event log that state changes are recorded in, or returns nil if it
+// can't be opened; like the control API, the failure is only logged
+func openEventLog() *dockforward.EventLogger {
+	path, err := dockforward.GetEventLogPath()
+	if err == nil {
+		var events *dockforward.EventLogger
+		if events, err = dockforward.OpenEventLogger(path); err == nil {
+			return events
+		}
+	}
+	log.Printf("Event log unavailable: %v", err)
+	return nil
+}
+
+// getEventsCommand returns a command that prints the event log
+func getEventsCommand() *cobra.Command {
+	var tail int
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Print the log of service health, forward status, conflict and reconnection changes",
+		Long: `Print the state changes monitors have recorded in ~/.config/dockforward/events.jsonl,
+oldest first: services' health and forward status changing, local processes taking
+their ports, and reconnections to a server.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := dockforward.GetEventLogPath()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to find the event log: %v\n", err)
+				os.Exit(1)
+			}
+			events, err := dockforward.ReadEvents(path, tail)
+			if errors.Is(err, fs.ErrNotExist) {
+				fmt.Println("No events recorded yet")
+				return
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			dockforward.WriteEvents(os.Stdout, events)
+		},
+	}
+	cmd.Flags().IntVar(&tail, "tail", 0, "Only print the last N events")
+	return cmd
+}
+
+// loadPlugins registers the screens of the plugins in the plugin directory, returning why
+// any failed to load once the message area can show it
+func loadPlugins(display *dockforward.DisplayManager) error {
+	dir, err := dockforward.GetPluginDir()
+	if err != nil {
+		return fmt.Errorf("failed to find the plugin directory: %v", err)
+	}
+	plugins, err := dockforward.NewPluginLoader(dir).Load()
+	for _, plugin := range plugins {
+		display.RegisterPlugin(plugin)
+	}
+	return err
+}
+
+// printStatus writes the status in the requested format and returns the exit code
+func printStatus(ctx context.Context, w io.Writer, asJSON, asCSV bool, format string) int {
+	config, err := dockforward.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 2
+	}
+
+	// Ask the running monitor, over the control API if it's enabled
+	var report *dockforward.StatusReport
+	if client, err := dockforward.NewAPIClient(config.API); err == nil {
+		report, _ = client.StatusReport()
+	}
+	if report == nil {
+		if client, err := ipc.DefaultClient(); err == nil {
+			report, _ = client.Status()
+		}
+	}
+	if report == nil {
+		server := config.GetCurrentServer()
+		if server == nil {
+			fmt.Fprintln(os.Stderr, "No server configured")
+			return 2
+		}
+		// Connection progress would otherwise be logged around the output
+		log.SetOutput(io.Discard)
+		query := dockforward.QueryStatusContext(ctx, server)
+		log.SetOutput(os.Stderr)
+		report = &query
+	}
+
+	switch {
+	case format != "":
+		tmpl, err := template.New("status").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				data, err := json.Marshal(v)
+				return string(data), err
+			},
+		}).Parse(format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid format: %v\n", err)
+			return 2
+		}
+		if err := tmpl.Execute(w, report); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to format status: %v\n", err)
+			return 2
+		}
+		fmt.Fprintln(w)
+	case asCSV:
+		if err := dockforward.WriteStatusCSV(w, report.Servers); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write status: %v\n", err)
+			return 2
+		}
+	case asJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	default:
+		for _, server := range report.Servers {
+			state := "connected"
+			if server.Error != "" {
+				state = "error: " + server.Error
+			} else if !server.Connected {
+				state = "disconnected"
+			}
+			fmt.Fprintf(w, "%s (%s@%s) %s\n", server.Name, server.User, server.Host, state)
+			for _, service := range server.Services {
+				fmt.Fprintf(w, "  %s %s\n", service.Name, service.Health)
+				for _, port := range service.Ports {
+					if port.Error != "" {
+						fmt.Fprintf(w, "    %s/%s -> %s %s: %s\n", port.Remote, port.Protocol, port.Address, port.Status, port.Error)
+						continue
 					}
+					fmt.Fprintf(w, "    %s/%s -> %s %s\n", port.Remote, port.Protocol, port.Address, port.Status)
+				}
+			}
+		}
+	}
+
+	switch {
+	case report.Errors() > 0:
+		return 2
+	case report.Conflicts() > 0:
+		return 1
+	}
+	return 0
+}
+
+// getServiceCommand returns a command that installs the headless monitor as a user
+// service started at login
+func getServiceCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Run the headless monitor at login with systemd or launchd",
+		Long: `Install the headless monitor as a systemd user unit on Linux, or a LaunchAgent on macOS,
+so ports are forwarded from login onwards and the monitor restarts if it fails.`,
+	}
+
+	var server string
+	install := &cobra.Command{
+		Use:   "install",
+		Short: "Install and start the service",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(installService(server))
+		},
+	}
+	install.Flags().StringVar(&server, "server", "", "Server to forward (default: the current server)")
+
+	cmd.AddCommand(install, &cobra.Command{
+		Use:   "uninstall",
+		Short: "Stop the service and remove what install created",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(runServiceManager(func(m *dockforward.ServiceManager) error {
+				path, err := m.Uninstall()
+				if err == nil {
+					fmt.Printf("Removed %s\n", path)
+				}
+				return err
+			}))
+		},
+	}, &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the service is installed and running",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Exit(runServiceManager(func(m *dockforward.ServiceManager) error {
+				status, err := m.Status()
+				if err == nil {
+					fmt.Println(strings.TrimRight(status, "\n"))
 				}
+				return err
+			}))
+		},
+	})
+	return cmd
+}
+
+// getVersionCommand returns a command that prints the build information, and optionally
+// whether a newer release is out
+func getVersionCommand() *cobra.Command {
+	var checkUpdate bool
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version and build information",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			info := version.Get()
+			fmt.Printf("%s %s\n", getMonitorName(), info.Version)
+			if info.GitCommit != "" {
+				fmt.Printf("  Commit:     %s\n", info.GitCommit)
+			}
+			if info.BuildDate != "" {
+				fmt.Printf("  Built:      %s\n", info.BuildDate)
+			}
+			fmt.Printf("  Go version: %s\n", info.GoVersion)
+			if !checkUpdate {
+				return
 			}
-			display.Display()
 
-		case <-time.After(50 * time.Millisecond):
-			// No input, continue to next iteration
+			ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Second)
+			defer cancel()
+			latest, err := version.LatestRelease(ctx, http.DefaultClient)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			switch {
+			case version.Newer(info.Version, latest):
+				fmt.Printf("%s is available, see https://github.com/thebadking/dockforward/releases/tag/%s to upgrade\n", latest, latest)
+			case info.Version == "dev":
+				fmt.Printf("This is a development build; the latest release is %s\n", latest)
+			default:
+				fmt.Printf("Up to date, %s is the latest release\n", latest)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&checkUpdate, "check", false, "Check GitHub for a newer release")
+	cmd.Flags().BoolVar(&checkUpdate, "check-update", false, "Check GitHub for a newer release")
+	cmd.Flags().MarkHidden("check-update")
+	return cmd
+}
+
+// installService installs a service forwarding server, or the current server if it's
+// empty, and returns the exit code
+func installService(server string) int {
+	config, err := dockforward.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	if server == "" {
+		server = config.CurrentServer
+	}
+	if config.Server(server) == nil {
+		fmt.Fprintf(os.Stderr, "No server named %q is configured\n", server)
+		return 1
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find the monitor binary: %v\n", err)
+		return 1
+	}
+	if resolved, err := filepath.EvalSymlinks(binary); err == nil {
+		binary = resolved
+	}
+
+	spec := dockforward.ServiceSpec{Binary: binary, Server: server}
+	// The service doesn't start in this directory, so a relative override is made absolute
+	if dir := os.Getenv("DOCKFORWARD_CONFIG_DIR"); dir != "" {
+		if spec.ConfigDir, err = filepath.Abs(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to resolve DOCKFORWARD_CONFIG_DIR: %v\n", err)
+			return 1
+		}
+	}
+	return runServiceManager(func(m *dockforward.ServiceManager) error {
+		path, err := m.Install(spec)
+		if path != "" {
+			fmt.Printf("Wrote %s\n", path)
+		}
+		if err == nil {
+			fmt.Printf("Forwarding %s from now on and at every login\n", server)
 		}
+		return err
+	})
+}
+
+// runServiceManager runs action with this machine's service manager and returns the exit code
+func runServiceManager(action func(*dockforward.ServiceManager) error) int {
+	manager, err := dockforward.NewServiceManager()
+	if err == nil {
+		err = action(manager)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
+	return 0
 }
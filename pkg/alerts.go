@@ -0,0 +1,197 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertRule runs a command when a matching service enters a condition, such as a webhook
+// call when a production service goes unhealthy
+type AlertRule struct {
+	ServerPattern   string `json:"server_pattern,omitempty"`   // Glob matched against the server's name, empty for every server
+	ServicePattern  string `json:"service_pattern,omitempty"`  // Glob matched against the service's name, empty for every service
+	Condition       string `json:"condition"`                  // e.g. "health != Healthy" or "forward_status == Conflict"
+	CooldownSeconds int    `json:"cooldown_seconds,omitempty"` // Minimum gap between runs for one service, default 300
+	Command         string `json:"command"`                    // Shell command to run
+}
+
+// defaultAlertCooldown is the gap between runs of a rule for one service when none is set
+const defaultAlertCooldown = 5 * time.Minute
+
+// alertTimeout is how long an alert command may run before it's killed
+const alertTimeout = time.Minute
+
+// alertCommand builds the process that runs an alert's shell command, replaced in tests.
+// It returns nil on platforms without a shell.
+var alertCommand = defaultAlertCommand
+
+func defaultAlertCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// Cooldown returns the minimum gap between runs of the rule for one service
+func (r AlertRule) Cooldown() time.Duration {
+	if r.CooldownSeconds <= 0 {
+		return defaultAlertCooldown
+	}
+	return time.Duration(r.CooldownSeconds) * time.Second
+}
+
+// alertCondition compares one field of a service's state with a value
+type alertCondition struct {
+	field string // "health" or "forward_status"
+	equal bool   // Whether the condition is == rather than !=
+	value string
+}
+
+// parseCondition parses a condition such as "health != Healthy"
+func parseCondition(condition string) (alertCondition, error) {
+	fields := strings.Fields(condition)
+	if len(fields) != 3 {
+		return alertCondition{}, fmt.Errorf("invalid condition %q, expected FIELD == VALUE or FIELD != VALUE", condition)
+	}
+	parsed := alertCondition{field: strings.ToLower(fields[0]), value: fields[2]}
+	switch parsed.field {
+	case "health", "forward_status":
+	default:
+		return alertCondition{}, fmt.Errorf("invalid condition %q, the field must be health or forward_status", condition)
+	}
+	switch fields[1] {
+	case "==":
+		parsed.equal = true
+	case "!=":
+	default:
+		return alertCondition{}, fmt.Errorf("invalid condition %q, the operator must be == or !=", condition)
+	}
+	return parsed, nil
+}
+
+// holds reports whether a service's state meets the condition
+func (c alertCondition) holds(state serviceSnapshot) bool {
+	value := state.health
+	if c.field == "forward_status" {
+		value = state.forward
+	}
+	return strings.EqualFold(value, c.value) == c.equal
+}
+
+// AlertHistory is when each rule last ran for each service, keyed by rule, server and service
+type AlertHistory map[string]time.Time
+
+// Alerter runs the commands of alert rules as services enter their conditions. Its methods
+// do nothing on a nil alerter, so callers don't have to check.
+type Alerter struct {
+	rules      []AlertRule
+	conditions []alertCondition // Parsed condition of each rule
+	history    AlertHistory
+	now        func() time.Time
+	mu         sync.Mutex
+}
+
+// NewAlerter creates an alerter for rules, leaving out any with an invalid pattern or
+// condition or no command and returning why along with the alerter for the rest
+func NewAlerter(rules []AlertRule) (*Alerter, error) {
+	a := &Alerter{history: make(AlertHistory), now: time.Now}
+	var errs []error
+	for i, rule := range rules {
+		condition, err := parseCondition(rule.Condition)
+		if err == nil && rule.Command == "" {
+			err = fmt.Errorf("no command")
+		}
+		for _, pattern := range []string{rule.ServerPattern, rule.ServicePattern} {
+			if _, patternErr := path.Match(pattern, ""); err == nil && patternErr != nil {
+				err = fmt.Errorf("invalid pattern %q", pattern)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("alert rule %d: %v", i+1, err))
+			continue
+		}
+		a.rules = append(a.rules, rule)
+		a.conditions = append(a.conditions, condition)
+	}
+	return a, errors.Join(errs...)
+}
+
+// Check runs the command of each rule matching a service on server that has entered its
+// condition since the previous snapshot, unless the rule ran for it within its cooldown.
+// Services that only just appeared have nothing to compare against and are skipped.
+func (a *Alerter) Check(server string, previous, current map[string]serviceSnapshot) {
+	if a == nil {
+		return
+	}
+	for name, now := range current {
+		before, ok := previous[name]
+		if !ok {
+			continue
+		}
+		for i, rule := range a.rules {
+			condition := a.conditions[i]
+			if !matchPattern(rule.ServerPattern, server) || !matchPattern(rule.ServicePattern, name) {
+				continue
+			}
+			if condition.holds(before) || !condition.holds(now) || !a.due(i, server, name) {
+				continue
+			}
+			a.run(rule, server, name, now)
+		}
+	}
+}
+
+// due records a run of rule i for a service, reporting whether its cooldown since the last
+// one has passed
+func (a *Alerter) due(i int, server, service string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := fmt.Sprintf("%d/%s/%s", i, server, service)
+	now := a.now()
+	if last, ok := a.history[key]; ok && now.Sub(last) < a.rules[i].Cooldown() {
+		return false
+	}
+	a.history[key] = now
+	return true
+}
+
+// run starts rule's command in the background, describing the service in its environment
+func (a *Alerter) run(rule AlertRule, server, service string, state serviceSnapshot) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	cmd := alertCommand(ctx, rule.Command)
+	if cmd == nil {
+		cancel()
+		return
+	}
+	cmd.Env = append(os.Environ(),
+		"DOCKFORWARD_SERVER="+server,
+		"DOCKFORWARD_SERVICE="+service,
+		"DOCKFORWARD_HEALTH="+state.health,
+		"DOCKFORWARD_FORWARD_STATUS="+state.forward,
+		"DOCKFORWARD_CONDITION="+rule.Condition,
+	)
+	logInfo("Running alert for %s on %s: %s", service, server, rule.Condition)
+	go func() {
+		defer cancel()
+		if output, err := cmd.CombinedOutput(); err != nil {
+			logWarn("Alert command for %s failed: %v: %s", service, err, strings.TrimSpace(string(output)))
+		}
+	}()
+}
+
+// matchPattern reports whether name matches a glob, where an empty pattern matches anything
+func matchPattern(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"context"
+	"os/exec"
+	"slices"
+	"testing"
+	"time"
+)
+
+// stubAlertCommand records the alert commands started until the test ends
+func stubAlertCommand(t *testing.T) *[]*exec.Cmd {
+	var started []*exec.Cmd
+	alertCommand = func(ctx context.Context, command string) *exec.Cmd {
+		cmd := exec.Command("true")
+		cmd.Args = append(cmd.Args, command)
+		started = append(started, cmd)
+		return cmd
+	}
+	t.Cleanup(func() { alertCommand = defaultAlertCommand })
+	return &started
+}
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      alertCondition
+		wantErr   bool
+	}{
+		{condition: "health != Healthy", want: alertCondition{field: "health", value: "Healthy"}},
+		{condition: "Forward_Status == Conflict", want: alertCondition{field: "forward_status", equal: true, value: "Conflict"}},
+		{condition: "health = Healthy", wantErr: true},
+		{condition: "uptime != 0", wantErr: true},
+		{condition: "health !=", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCondition(tt.condition)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCondition(%q) = %+v, %v; want %+v, error %v", tt.condition, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	unhealthy := alertCondition{field: "health", value: "Healthy"}
+	if !unhealthy.holds(serviceSnapshot{health: HealthUnhealthy}) || unhealthy.holds(serviceSnapshot{health: "healthy"}) {
+		t.Error("health != Healthy doesn't compare case-insensitively")
+	}
+}
+
+func TestNewAlerterSkipsInvalidRules(t *testing.T) {
+	alerter, err := NewAlerter([]AlertRule{
+		{Condition: "health != Healthy", Command: "true"},
+		{Condition: "health", Command: "true"},
+		{Condition: "health != Healthy"},
+		{ServicePattern: "[", Condition: "health != Healthy", Command: "true"},
+	})
+	if err == nil {
+		t.Error("NewAlerter accepted invalid rules")
+	}
+	if len(alerter.rules) != 1 {
+		t.Errorf("%d rules kept, want the valid one", len(alerter.rules))
+	}
+}
+
+func TestAlerterCheck(t *testing.T) {
+	started := stubAlertCommand(t)
+	alerter, err := NewAlerter([]AlertRule{{
+		ServerPattern:   "prod*",
+		ServicePattern:  "web",
+		Condition:       "health != Healthy",
+		CooldownSeconds: 60,
+		Command:         "curl hook",
+	}})
+	if err != nil {
+		t.Fatalf("NewAlerter failed: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	alerter.now = func() time.Time { return now }
+
+	healthy := map[string]serviceSnapshot{"web": {health: HealthHealthy}, "db": {health: HealthHealthy}}
+	unhealthy := map[string]serviceSnapshot{"web": {health: HealthUnhealthy}, "db": {health: HealthUnhealthy}}
+
+	alerter.Check("prod-eu", healthy, unhealthy)
+	if len(*started) != 1 {
+		t.Fatalf("%d commands run, want one for web", len(*started))
+	}
+	env := (*started)[0].Env
+	for _, want := range []string{"DOCKFORWARD_SERVER=prod-eu", "DOCKFORWARD_SERVICE=web", "DOCKFORWARD_HEALTH=Unhealthy"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("alert environment lacks %s", want)
+		}
+	}
+
+	// Staying unhealthy isn't a transition, and other servers don't match
+	alerter.Check("prod-eu", unhealthy, unhealthy)
+	alerter.Check("staging", healthy, unhealthy)
+	if len(*started) != 1 {
+		t.Errorf("%d commands run, want still one", len(*started))
+	}
+
+	// Flapping within the cooldown doesn't fire again, after it does
+	now = now.Add(30 * time.Second)
+	alerter.Check("prod-eu", healthy, unhealthy)
+	if len(*started) != 1 {
+		t.Errorf("%d commands run within the cooldown, want one", len(*started))
+	}
+	now = now.Add(time.Minute)
+	alerter.Check("prod-eu", healthy, unhealthy)
+	if len(*started) != 2 {
+		t.Errorf("%d commands run after the cooldown, want two", len(*started))
+	}
+
+	var none *Alerter
+	none.Check("prod-eu", healthy, unhealthy)
+}
+
+func TestUpdateServicesRunsAlerts(t *testing.T) {
+	started := stubAlertCommand(t)
+	alerter, err := NewAlerter([]AlertRule{{Condition: "forward_status == Conflict", Command: "notify-team"}})
+	if err != nil {
+		t.Fatalf("NewAlerter failed: %v", err)
+	}
+	docker := fixtureDockerClient()
+	docker.name = "prod"
+	docker.SetAlerter(alerter)
+
+	// The first update has nothing to compare against, so db's conflict doesn't fire
+	docker.UpdateServices(fixtureDockerClient().services)
+	services := fixtureDockerClient().services
+	services["web"].ForwardStatus = StatusConflict
+	docker.UpdateServices(services)
+
+	if len(*started) != 1 {
+		t.Fatalf("%d commands run, want one for web", len(*started))
+	}
+	if cmd := (*started)[0]; !slices.Contains(cmd.Args, "notify-team") || !slices.Contains(cmd.Env, "DOCKFORWARD_SERVICE=web") {
+		t.Errorf("ran %v with %v, want notify-team for web", cmd.Args, cmd.Env)
+	}
+}
@@ -0,0 +1,451 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// apiTokenFile is the file in the config directory holding the control API's bearer token
+const apiTokenFile = "api-token"
+
+// ControlTarget is a running monitor the control API reports on and acts through, either
+// the interactive DisplayManager or a Headless forwarder
+type ControlTarget interface {
+	StatusReport() StatusReport
+	configuredServers() []ServerConfig
+	dockerClient() ContainerAPI
+	reconnect() error
+}
+
+// ServerInfo is a configured server as listed by GET /servers
+type ServerInfo struct {
+	Name      string `json:"name"`
+	Host      string `json:"host"`
+	User      string `json:"user"`
+	Current   bool   `json:"current"`
+	Connected bool   `json:"connected"`
+}
+
+// ForwardReport is a service's port as listed by GET /forwards, with the id DELETE takes
+type ForwardReport struct {
+	ID      string `json:"id"`
+	Service string `json:"service"`
+	PortReport
+}
+
+// ForwardRequest is the body of POST /forwards; an empty localPort forwards to the same port
+type ForwardRequest struct {
+	Service    string `json:"service"`
+	RemotePort string `json:"remotePort"`
+	LocalPort  string `json:"localPort"`
+}
+
+// apiError is the body of every failed control API request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// APISocketPath returns where the control API listens when no port is configured
+func APISocketPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "api.sock"), nil
+}
+
+// APIToken returns the control API's token, creating it readable only by the user if
+// there isn't one yet
+func APIToken() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(configDir, apiTokenFile)
+	if token, err := readAPIToken(path); err == nil {
+		return token, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate API token: %v", err)
+	}
+	token := hex.EncodeToString(secret)
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write API token: %v", err)
+	}
+	return token, nil
+}
+
+// LoadAPIToken returns the control API's token, failing if there isn't one yet, which means
+// no monitor has served the API
+func LoadAPIToken() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	token, err := readAPIToken(filepath.Join(configDir, apiTokenFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read API token: %v", err)
+	}
+	return token, nil
+}
+
+// readAPIToken reads a token file, failing if it's empty
+func readAPIToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("API token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// ServeAPI serves the control API for target on 127.0.0.1 at the configured port, or on a
+// unix socket in the config directory, until the returned listener is closed
+func ServeAPI(prefs APIPreferences, target ControlTarget) (net.Listener, error) {
+	token, err := APIToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var listener net.Listener
+	if prefs.Port > 0 {
+		listener, err = net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", prefs.Port))
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on port %d: %v", prefs.Port, err)
+		}
+	} else {
+		path, err := APISocketPath()
+		if err != nil {
+			return nil, err
+		}
+		if listener, err = ListenUnix(path); err != nil {
+			return nil, err
+		}
+	}
+
+	server := &http.Server{Handler: newAPIHandler(target, token), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, net.ErrClosed) {
+			logError("Control API stopped: %v", err)
+		}
+	}()
+	return listener, nil
+}
+
+// newAPIHandler routes the control API's endpoints, each requiring token
+func newAPIHandler(target ControlTarget, token string) http.Handler {
+	control := NewControl(target)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /servers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, control.Servers())
+	})
+	mux.HandleFunc("GET /services", func(w http.ResponseWriter, r *http.Request) {
+		services := []ServiceReport{}
+		for _, server := range target.StatusReport().Servers {
+			services = append(services, server.Services...)
+		}
+		writeJSON(w, http.StatusOK, services)
+	})
+	mux.HandleFunc("GET /forwards", func(w http.ResponseWriter, r *http.Request) {
+		forwards := []ForwardReport{}
+		for _, server := range target.StatusReport().Servers {
+			for _, service := range server.Services {
+				for _, port := range service.Ports {
+					forwards = append(forwards, forwardReport(service.Name, port))
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, forwards)
+	})
+	mux.HandleFunc("POST /forwards", func(w http.ResponseWriter, r *http.Request) {
+		var req ForwardRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+			return
+		}
+		if req.Service == "" || req.RemotePort == "" {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("service and remotePort are required"))
+			return
+		}
+		forward, err := control.StartForward(req)
+		if errors.Is(err, ErrNotConnected) {
+			writeAPIError(w, http.StatusServiceUnavailable, err)
+			return
+		} else if err != nil {
+			writeAPIError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, forward)
+	})
+	mux.HandleFunc("DELETE /forwards/{id...}", func(w http.ResponseWriter, r *http.Request) {
+		service, label, ok := strings.Cut(r.PathValue("id"), ":")
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid forward id %q, expected service:port", r.PathValue("id")))
+			return
+		}
+		remote, _, _ := strings.Cut(label, "/")
+		err := control.StopForward(service, remote)
+		if errors.Is(err, ErrNotConnected) {
+			writeAPIError(w, http.StatusServiceUnavailable, err)
+			return
+		} else if err != nil {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /reconnect", func(w http.ResponseWriter, r *http.Request) {
+		if err := target.reconnect(); err != nil {
+			writeAPIError(w, http.StatusBadGateway, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong API token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Control starts and stops forwards on a ControlTarget for API clients, the HTTP control API
+// and the gRPC server alike
+type Control struct {
+	target ControlTarget
+}
+
+// NewControl returns a Control acting through target
+func NewControl(target ControlTarget) *Control {
+	return &Control{target: target}
+}
+
+// StatusReport reports on the target's server and its services
+func (c *Control) StatusReport() StatusReport {
+	return c.target.StatusReport()
+}
+
+// Servers lists the configured servers, marking the one the target is connected to
+func (c *Control) Servers() []ServerInfo {
+	report := c.target.StatusReport()
+	servers := []ServerInfo{}
+	for _, server := range c.target.configuredServers() {
+		info := ServerInfo{Name: server.Name, Host: server.Host, User: server.User}
+		for _, connected := range report.Servers {
+			if connected.Name == server.Name {
+				info.Current, info.Connected = true, connected.Connected
+			}
+		}
+		servers = append(servers, info)
+	}
+	return servers
+}
+
+// StartForward forwards a service's remote port, failing with ErrNotConnected while the
+// target has no server connection
+func (c *Control) StartForward(req ForwardRequest) (ForwardReport, error) {
+	docker := c.target.dockerClient()
+	if docker == nil {
+		return ForwardReport{}, ErrNotConnected
+	}
+	port, err := docker.StartForward(req.Service, req.RemotePort, req.LocalPort)
+	if err != nil {
+		return ForwardReport{}, err
+	}
+	logInfo("Forwarded %s port %s to local port %s for an API client", req.Service, req.RemotePort, port.Local)
+	return forwardReport(req.Service, portReport(port)), nil
+}
+
+// StopForward stops forwarding a service's remote port, failing with ErrNotConnected while
+// the target has no server connection
+func (c *Control) StopForward(service, remotePort string) error {
+	docker := c.target.dockerClient()
+	if docker == nil {
+		return ErrNotConnected
+	}
+	if err := docker.StopForward(service, remotePort); err != nil {
+		return err
+	}
+	logInfo("Stopped forwarding %s port %s for an API client", service, remotePort)
+	return nil
+}
+
+// forwardReport identifies a service's port as service:port, with /udp for UDP ports
+func forwardReport(service string, port PortReport) ForwardReport {
+	label := ForwardedPort{Remote: port.Remote, Protocol: port.Protocol}.Label()
+	return ForwardReport{ID: service + ":" + label, Service: service, PortReport: port}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+// APIClient talks to a running monitor's control API
+type APIClient struct {
+	http  *http.Client
+	base  string
+	token string
+}
+
+// NewAPIClient returns a client for the control API prefs configures, failing if it isn't
+// enabled or there's no token yet, which means no monitor has served it
+func NewAPIClient(prefs APIPreferences) (*APIClient, error) {
+	if !prefs.Enabled {
+		return nil, fmt.Errorf("control API is not enabled")
+	}
+	token, err := LoadAPIToken()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &APIClient{http: &http.Client{Timeout: 5 * time.Second}, token: token}
+	if prefs.Port > 0 {
+		client.base = fmt.Sprintf("http://127.0.0.1:%d", prefs.Port)
+		return client, nil
+	}
+	path, err := APISocketPath()
+	if err != nil {
+		return nil, err
+	}
+	client.base = "http://dockforward"
+	client.http.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}
+	return client, nil
+}
+
+// do sends a request with body encoded as JSON, if it isn't nil, and decodes the response into out
+func (c *APIClient) do(method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		reqBody = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, c.base+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("control API unavailable: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var failure apiError
+		if json.NewDecoder(resp.Body).Decode(&failure) == nil && failure.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, path, failure.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %v", path, err)
+	}
+	return nil
+}
+
+// Servers lists the configured servers and which one the monitor is connected to
+func (c *APIClient) Servers() ([]ServerInfo, error) {
+	var servers []ServerInfo
+	return servers, c.do(http.MethodGet, "/servers", nil, &servers)
+}
+
+// Services lists the connected server's services
+func (c *APIClient) Services() ([]ServiceReport, error) {
+	var services []ServiceReport
+	return services, c.do(http.MethodGet, "/services", nil, &services)
+}
+
+// Forwards lists every exposed port and its forward
+func (c *APIClient) Forwards() ([]ForwardReport, error) {
+	var forwards []ForwardReport
+	return forwards, c.do(http.MethodGet, "/forwards", nil, &forwards)
+}
+
+// Forward asks the monitor to forward a service's remote port
+func (c *APIClient) Forward(req ForwardRequest) (*ForwardReport, error) {
+	var forward ForwardReport
+	if err := c.do(http.MethodPost, "/forwards", req, &forward); err != nil {
+		return nil, err
+	}
+	return &forward, nil
+}
+
+// StopForward asks the monitor to stop the forward with the given id
+func (c *APIClient) StopForward(id string) error {
+	return c.do(http.MethodDelete, "/forwards/"+id, nil, nil)
+}
+
+// Reconnect asks the monitor to reconnect to the current server
+func (c *APIClient) Reconnect() error {
+	return c.do(http.MethodPost, "/reconnect", nil, nil)
+}
+
+// StatusReport builds the status `dockforward-monitor status` prints from the API
+func (c *APIClient) StatusReport() (*StatusReport, error) {
+	servers, err := c.Servers()
+	if err != nil {
+		return nil, err
+	}
+	services, err := c.Services()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &StatusReport{Source: "monitor", Time: time.Now()}
+	for _, server := range servers {
+		if server.Current {
+			report.Servers = append(report.Servers, ServerReport{
+				Name:      server.Name,
+				Host:      server.Host,
+				User:      server.User,
+				Connected: server.Connected,
+				Services:  services,
+			})
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,159 @@
+// Package api serves a running monitor's REST API on an address of the user's choosing, for
+// dashboards, browser extensions and scripts that want services and forwards as JSON without
+// reading the control API's token file. Requests need the config's api_token as
+// "Authorization: Bearer TOKEN" when it's set.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	dockforward "dockforward/pkg"
+)
+
+// Monitor is what the server reports on and acts through, satisfied by *dockforward.Control
+type Monitor interface {
+	StatusReport() dockforward.StatusReport
+	Servers() []dockforward.ServerInfo
+	StartForward(req dockforward.ForwardRequest) (dockforward.ForwardReport, error)
+	StopForward(service, remotePort string) error
+}
+
+// Error is the body of every failed request
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Serve serves monitor's REST API on addr until the returned server is closed, requiring
+// token on every request unless it's empty. Without one it only listens on loopback.
+func Serve(addr, token string, monitor Monitor) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	if token == "" && !dockforward.LoopbackAddr(listener.Addr()) {
+		listener.Close()
+		return nil, fmt.Errorf("%s is reachable beyond this machine, set api_token in the config to serve on it", addr)
+	}
+	server := &http.Server{Handler: NewHandler(monitor, token, addr), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("REST API stopped", "err", err)
+		}
+	}()
+	return server, nil
+}
+
+// NewHandler routes the REST API's endpoints, each requiring token unless it's empty.
+// Requests must name the machine as served on listenAddr, see dockforward.AllowedHost, and
+// those changing forwards must be sent as JSON, which pages on other sites can't send
+// without asking first.
+func NewHandler(monitor Monitor, token, listenAddr string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/services", func(w http.ResponseWriter, r *http.Request) {
+		services := []dockforward.ServiceReport{}
+		for _, server := range monitor.StatusReport().Servers {
+			services = append(services, server.Services...)
+		}
+		writeJSON(w, http.StatusOK, services)
+	})
+	mux.HandleFunc("GET /api/servers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, monitor.Servers())
+	})
+	mux.HandleFunc("POST /api/forward", func(w http.ResponseWriter, r *http.Request) {
+		var req dockforward.ForwardRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+			return
+		}
+		if req.Service == "" || req.RemotePort == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("service and remotePort are required"))
+			return
+		}
+		forward, err := monitor.StartForward(req)
+		switch {
+		case errors.Is(err, dockforward.ErrNotConnected):
+			writeError(w, http.StatusServiceUnavailable, err)
+		case err != nil:
+			writeError(w, http.StatusConflict, err)
+		default:
+			writeJSON(w, http.StatusCreated, forward)
+		}
+	})
+	mux.HandleFunc("DELETE /api/forward/{port}", func(w http.ResponseWriter, r *http.Request) {
+		port := r.PathValue("port")
+		service, ok := exposing(monitor.StatusReport(), port)
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no service exposes port %s", port))
+			return
+		}
+		err := monitor.StopForward(service, port)
+		switch {
+		case errors.Is(err, dockforward.ErrNotConnected):
+			writeError(w, http.StatusServiceUnavailable, err)
+		case err != nil:
+			writeError(w, http.StatusNotFound, err)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !dockforward.AllowedHost(r.Host, listenAddr) {
+			writeError(w, http.StatusMisdirectedRequest, fmt.Errorf("host %q isn't served here", r.Host))
+			return
+		}
+		if token != "" {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong API token"))
+				return
+			}
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !jsonContent(r) {
+			writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("requests changing forwards must be sent as application/json"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// jsonContent reports whether r's Content-Type is JSON
+func jsonContent(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// exposing returns the service exposing remote port on the connected server, since the
+// host's published ports are unique to one container
+func exposing(report dockforward.StatusReport, port string) (string, bool) {
+	for _, server := range report.Servers {
+		for _, service := range server.Services {
+			for _, exposed := range service.Ports {
+				if exposed.Remote == port {
+					return service.Name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, Error{Error: err.Error()})
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	dockforward "dockforward/pkg"
+)
+
+// fakeMonitor is a Monitor recording the forwards it's asked to stop
+type fakeMonitor struct {
+	mu      sync.Mutex
+	report  dockforward.StatusReport
+	stopped []string // service:port of each stopped forward
+	err     error    // Returned by StartForward and StopForward when set
+}
+
+func (m *fakeMonitor) StatusReport() dockforward.StatusReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.report
+}
+
+func (m *fakeMonitor) Servers() []dockforward.ServerInfo {
+	return []dockforward.ServerInfo{
+		{Name: "prod", Host: "prod.example.com:22", User: "deploy"},
+		{Name: "staging", Host: "staging.example.com:22", User: "deploy", Current: true, Connected: true},
+	}
+}
+
+func (m *fakeMonitor) StartForward(req dockforward.ForwardRequest) (dockforward.ForwardReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return dockforward.ForwardReport{}, m.err
+	}
+	port := dockforward.PortReport{Remote: req.RemotePort, Local: req.LocalPort, Protocol: "tcp", Status: dockforward.StatusForwarded}
+	return dockforward.ForwardReport{ID: req.Service + ":" + req.RemotePort, Service: req.Service, PortReport: port}, nil
+}
+
+func (m *fakeMonitor) StopForward(service, remotePort string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.stopped = append(m.stopped, service+":"+remotePort)
+	return nil
+}
+
+func newFakeMonitor() *fakeMonitor {
+	return &fakeMonitor{report: dockforward.StatusReport{Source: "monitor", Servers: []dockforward.ServerReport{{
+		Name: "staging", Connected: true,
+		Services: []dockforward.ServiceReport{
+			{Name: "db", Ports: []dockforward.PortReport{{Remote: "5432", Local: "5432", Status: dockforward.StatusConflict}}},
+			{Name: "web", Ports: []dockforward.PortReport{{Remote: "3000", Local: "3000", Status: dockforward.StatusReady}}},
+		},
+	}}}}
+}
+
+// request sends a JSON request to the API at url with token, if it isn't empty, decoding
+// the response into out
+func request(t *testing.T, method, url, token, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestToken(t *testing.T) {
+	server := httptest.NewServer(NewHandler(newFakeMonitor(), "secret", ""))
+	t.Cleanup(server.Close)
+
+	for _, path := range []string{"/api/services", "/api/servers"} {
+		for _, token := range []string{"", "wrong"} {
+			if status := request(t, http.MethodGet, server.URL+path, token, "", nil); status != http.StatusUnauthorized {
+				t.Errorf("GET %s with token %q = %d, want %d", path, token, status, http.StatusUnauthorized)
+			}
+		}
+		if status := request(t, http.MethodGet, server.URL+path, "secret", "", nil); status != http.StatusOK {
+			t.Errorf("GET %s with the right token = %d, want %d", path, status, http.StatusOK)
+		}
+	}
+	if status := request(t, http.MethodDelete, server.URL+"/api/forward/3000", "", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("DELETE without a token = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// Without a configured token nothing is checked
+	open := httptest.NewServer(NewHandler(newFakeMonitor(), "", ""))
+	t.Cleanup(open.Close)
+	if status := request(t, http.MethodGet, open.URL+"/api/services", "", "", nil); status != http.StatusOK {
+		t.Errorf("GET without a configured token = %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	monitor := newFakeMonitor()
+	server := httptest.NewServer(NewHandler(monitor, "secret", ""))
+	t.Cleanup(server.Close)
+
+	var services []dockforward.ServiceReport
+	request(t, http.MethodGet, server.URL+"/api/services", "secret", "", &services)
+	if len(services) != 2 || services[0].Name != "db" || services[1].Name != "web" {
+		t.Errorf("services = %+v, want db and web", services)
+	}
+	var servers []dockforward.ServerInfo
+	request(t, http.MethodGet, server.URL+"/api/servers", "secret", "", &servers)
+	if len(servers) != 2 || !servers[1].Current {
+		t.Errorf("servers = %+v, want staging current", servers)
+	}
+
+	var created dockforward.ForwardReport
+	status := request(t, http.MethodPost, server.URL+"/api/forward", "secret", `{"service":"web","remotePort":"3000","localPort":"38125"}`, &created)
+	if status != http.StatusCreated || created.ID != "web:3000" || created.Local != "38125" {
+		t.Errorf("POST /api/forward = %d %+v, want web:3000 on 38125", status, created)
+	}
+	if status := request(t, http.MethodPost, server.URL+"/api/forward", "secret", `{"service":"web"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("POST /api/forward without a port = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if status := request(t, http.MethodDelete, server.URL+"/api/forward/5432", "secret", "", nil); status != http.StatusNoContent {
+		t.Errorf("DELETE /api/forward/5432 = %d, want %d", status, http.StatusNoContent)
+	}
+	if len(monitor.stopped) != 1 || monitor.stopped[0] != "db:5432" {
+		t.Errorf("stopped forwards = %v, want db:5432", monitor.stopped)
+	}
+	var failure Error
+	if status := request(t, http.MethodDelete, server.URL+"/api/forward/9999", "secret", "", &failure); status != http.StatusNotFound || failure.Error == "" {
+		t.Errorf("DELETE of an unexposed port = %d %+v, want not found", status, failure)
+	}
+
+	monitor.err = dockforward.ErrNotConnected
+	if status := request(t, http.MethodPost, server.URL+"/api/forward", "secret", `{"service":"web","remotePort":"3000"}`, nil); status != http.StatusServiceUnavailable {
+		t.Errorf("POST /api/forward while disconnected = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+}
+
+func TestServe(t *testing.T) {
+	server, err := Serve("127.0.0.1:0", "", newFakeMonitor())
+	if err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	server.Close()
+
+	if _, err := Serve("256.0.0.1:1", "", newFakeMonitor()); err == nil {
+		t.Error("Serve succeeded on an invalid address")
+	}
+	if _, err := Serve("0.0.0.0:0", "", newFakeMonitor()); err == nil {
+		t.Error("Serve succeeded on every address without a token")
+	}
+}
+
+func TestBrowserRequestsRefused(t *testing.T) {
+	monitor := newFakeMonitor()
+	server := httptest.NewServer(NewHandler(monitor, "", ""))
+	t.Cleanup(server.Close)
+
+	// A form or a plain fetch from another site's page can't send JSON without asking first
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		for _, req := range []struct{ method, path, body string }{
+			{http.MethodPost, "/api/forward", `{"service":"web","remotePort":"3000"}`},
+			{http.MethodDelete, "/api/forward/5432", ""},
+		} {
+			r, err := http.NewRequest(req.method, server.URL+req.path, strings.NewReader(req.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != "" {
+				r.Header.Set("Content-Type", contentType)
+			}
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnsupportedMediaType {
+				t.Errorf("%s %s as %q = %d, want %d", req.method, req.path, contentType, resp.StatusCode, http.StatusUnsupportedMediaType)
+			}
+		}
+	}
+	if len(monitor.stopped) != 0 {
+		t.Errorf("stopped forwards = %v, want none", monitor.stopped)
+	}
+
+	// A rebound name reaches the server's address, but says which name it used
+	r, err := http.NewRequest(http.MethodGet, server.URL+"/api/services", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Host = "evil.example.com"
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMisdirectedRequest {
+		t.Errorf("GET for another host = %d, want %d", resp.StatusCode, http.StatusMisdirectedRequest)
+	}
+}
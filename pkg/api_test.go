@@ -0,0 +1,140 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// apiRequest sends a request to the control API at url with token, decoding the response into out
+func apiRequest(t *testing.T, method, url, token, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPIRequiresToken(t *testing.T) {
+	dm, _ := newRemapFixture(t)
+	server := httptest.NewServer(newAPIHandler(dm, "secret"))
+	t.Cleanup(server.Close)
+
+	for _, token := range []string{"", "wrong"} {
+		if status := apiRequest(t, http.MethodGet, server.URL+"/services", token, "", nil); status != http.StatusUnauthorized {
+			t.Errorf("token %q got status %d, want %d", token, status, http.StatusUnauthorized)
+		}
+	}
+	if status := apiRequest(t, http.MethodGet, server.URL+"/services", "secret", "", nil); status != http.StatusOK {
+		t.Errorf("right token got status %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestAPIForwards(t *testing.T) {
+	dm, client := newRemapFixture(t)
+	server := httptest.NewServer(newAPIHandler(dm, "secret"))
+	t.Cleanup(server.Close)
+
+	var servers []ServerInfo
+	apiRequest(t, http.MethodGet, server.URL+"/servers", "secret", "", &servers)
+	if len(servers) != 2 || servers[0].Current || !servers[1].Current || !servers[1].Connected {
+		t.Errorf("servers = %+v, want staging current and connected", servers)
+	}
+
+	var forwards []ForwardReport
+	apiRequest(t, http.MethodGet, server.URL+"/forwards", "secret", "", &forwards)
+	var ids []string
+	for _, forward := range forwards {
+		ids = append(ids, forward.ID)
+	}
+	if want := []string{"db:5432", "web:3000", "web:8080"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("forward ids = %q, want %q", ids, want)
+	}
+
+	var created ForwardReport
+	status := apiRequest(t, http.MethodPost, server.URL+"/forwards", "secret", `{"service":"web","remotePort":"3000","localPort":"38125"}`, &created)
+	if status != http.StatusCreated || created.ID != "web:3000" || created.Local != "38125" {
+		t.Fatalf("POST /forwards = %d %+v, want web:3000 on 38125", status, created)
+	}
+	if got := client.ports["3000"]; got != "38125" {
+		t.Errorf("port 3000 is forwarded to %q, want 38125", got)
+	}
+
+	if status := apiRequest(t, http.MethodDelete, server.URL+"/forwards/web:3000", "secret", "", nil); status != http.StatusNoContent {
+		t.Fatalf("DELETE /forwards/web:3000 = %d, want %d", status, http.StatusNoContent)
+	}
+	if _, ok := client.ports["3000"]; ok {
+		t.Error("port 3000 is still forwarded after DELETE")
+	}
+	// Refreshes leave a stopped forward alone
+	if err := dm.docker.UpdateForwardingStatus(); err != nil {
+		t.Fatalf("UpdateForwardingStatus failed: %v", err)
+	}
+	if got := dm.docker.GetService("web").Port("3000").Status; got != StatusNotForwarded {
+		t.Errorf("stopped port status = %q, want %q", got, StatusNotForwarded)
+	}
+
+	var failure apiError
+	status = apiRequest(t, http.MethodPost, server.URL+"/forwards", "secret", `{"service":"web","remotePort":"9999"}`, &failure)
+	if status != http.StatusConflict || failure.Error == "" {
+		t.Errorf("forwarding an unexposed port = %d %+v, want an error", status, failure)
+	}
+	if status := apiRequest(t, http.MethodDelete, server.URL+"/forwards/nope:1", "secret", "", nil); status != http.StatusNotFound {
+		t.Errorf("DELETE of an unknown forward = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestAPIClientOverSocket(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dm, _ := newRemapFixture(t)
+	prefs := APIPreferences{Enabled: true}
+
+	if _, err := NewAPIClient(prefs); err == nil {
+		t.Fatal("NewAPIClient succeeded before any monitor created a token")
+	}
+	listener, err := ServeAPI(prefs, dm)
+	if err != nil {
+		t.Fatalf("ServeAPI failed: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	configDir, _ := GetConfigDir()
+	info, err := os.Stat(filepath.Join(configDir, apiTokenFile))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("token file = %v, %v, want it readable only by the user", info, err)
+	}
+
+	client, err := NewAPIClient(prefs)
+	if err != nil {
+		t.Fatalf("NewAPIClient failed: %v", err)
+	}
+	report, err := client.StatusReport()
+	if err != nil {
+		t.Fatalf("StatusReport failed: %v", err)
+	}
+	want := dm.StatusReport()
+	if !reflect.DeepEqual(report.Servers, want.Servers) {
+		t.Errorf("StatusReport servers = %+v, want %+v", report.Servers, want.Servers)
+	}
+
+	if _, err := NewAPIClient(APIPreferences{}); err == nil {
+		t.Error("NewAPIClient succeeded with the API disabled")
+	}
+}
@@ -1,9 +1,204 @@
 package pkg
 
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
 // Color constants for terminal output
 const (
-	ColorGreen  = "\033[0;32m"
-	ColorYellow = "\033[0;33m"
-	ColorRed    = "\033[0;31m"
-	ColorReset  = "\033[0m"
+	ColorGreen   = "\033[0;32m"
+	ColorYellow  = "\033[0;33m"
+	ColorRed     = "\033[0;31m"
+	ColorReverse = "\033[7m"
+	ColorReset   = "\033[0m"
+	ColorBold    = "\033[1m"
+	ColorDim     = "\033[2m"
 )
+
+// ColorTheme holds the escape sequence used for each kind of text
+type ColorTheme struct {
+	Healthy   string
+	Unhealthy string
+	Warning   string
+	Reset     string
+	Header    string
+	Selected  string
+	Muted     string
+}
+
+// DefaultThemeName is the theme used when the config doesn't name one
+const DefaultThemeName = "default"
+
+// themes are the built-in palettes selectable with theme_name
+var themes = map[string]ColorTheme{
+	DefaultThemeName: {
+		Healthy:   ColorGreen,
+		Unhealthy: ColorRed,
+		Warning:   ColorYellow,
+		Reset:     ColorReset,
+		Header:    ColorBold,
+		Selected:  ColorReverse,
+		Muted:     ColorDim,
+	},
+	"solarized-dark": {
+		Healthy:   sgr("38;5;64"),
+		Unhealthy: sgr("38;5;160"),
+		Warning:   sgr("38;5;136"),
+		Reset:     ColorReset,
+		Header:    sgr("1;38;5;33"),
+		Selected:  sgr("38;5;230;48;5;24"),
+		Muted:     sgr("38;5;240"),
+	},
+	"high-contrast": {
+		Healthy:   sgr("1;92"),
+		Unhealthy: sgr("1;91"),
+		Warning:   sgr("1;93"),
+		Reset:     ColorReset,
+		Header:    sgr("1;4;97"),
+		Selected:  sgr("1;30;107"),
+		Muted:     sgr("37"),
+	},
+}
+
+// sgrParams matches the parameters of an SGR escape, such as "1;32" or "38;5;64"
+var sgrParams = regexp.MustCompile(`^[0-9]+(;[0-9]+)*$`)
+
+// sgr builds the escape sequence for SGR parameters
+func sgr(params string) string {
+	return "\033[" + params + "m"
+}
+
+// ThemeNames returns the names of the built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTheme returns the named built-in theme with overrides applied. Overrides are keyed
+// by lowercase field name and given as SGR parameters, e.g. {"healthy": "1;32"}.
+func LoadTheme(name string, overrides map[string]string) (ColorTheme, error) {
+	if name == "" {
+		name = DefaultThemeName
+	}
+	theme, ok := themes[name]
+	if !ok {
+		return themes[DefaultThemeName], fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(ThemeNames(), ", "))
+	}
+
+	fields := map[string]*string{
+		"healthy":   &theme.Healthy,
+		"unhealthy": &theme.Unhealthy,
+		"warning":   &theme.Warning,
+		"reset":     &theme.Reset,
+		"header":    &theme.Header,
+		"selected":  &theme.Selected,
+		"muted":     &theme.Muted,
+	}
+	for key, params := range overrides {
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			return themes[DefaultThemeName], fmt.Errorf("unknown theme color %q", key)
+		}
+		if !sgrParams.MatchString(params) {
+			return themes[DefaultThemeName], fmt.Errorf("invalid value %q for theme color %q: expected SGR parameters such as \"1;32\"", params, key)
+		}
+		*field = sgr(params)
+	}
+	return theme, nil
+}
+
+// Colorizer applies ANSI colors to text, or leaves it plain when color is disabled
+type Colorizer struct {
+	enabled bool
+	theme   ColorTheme
+}
+
+// NewColorizer creates a colorizer with the default theme that emits escape codes only when enabled
+func NewColorizer(enabled bool) *Colorizer {
+	return NewThemeColorizer(enabled, themes[DefaultThemeName])
+}
+
+// NewThemeColorizer creates a colorizer using theme that emits escape codes only when enabled
+func NewThemeColorizer(enabled bool, theme ColorTheme) *Colorizer {
+	return &Colorizer{enabled: enabled, theme: theme}
+}
+
+// ColorSupported reports whether stdout is a terminal and NO_COLOR is unset
+func ColorSupported() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Enabled reports whether the colorizer emits escape codes
+func (c *Colorizer) Enabled() bool {
+	return c != nil && c.enabled
+}
+
+func (c *Colorizer) wrap(color, s string) string {
+	if !c.Enabled() {
+		return s
+	}
+	return color + s + c.theme.Reset
+}
+
+// palette returns the active theme, which is empty for a nil colorizer
+func (c *Colorizer) palette() ColorTheme {
+	if c == nil {
+		return ColorTheme{}
+	}
+	return c.theme
+}
+
+// Healthy colors text describing something working
+func (c *Colorizer) Healthy(s string) string {
+	return c.wrap(c.palette().Healthy, s)
+}
+
+// Warning colors text that needs attention but isn't broken
+func (c *Colorizer) Warning(s string) string {
+	return c.wrap(c.palette().Warning, s)
+}
+
+// Unhealthy colors errors and failures
+func (c *Colorizer) Unhealthy(s string) string {
+	return c.wrap(c.palette().Unhealthy, s)
+}
+
+// Header colors screen titles
+func (c *Colorizer) Header(s string) string {
+	return c.wrap(c.palette().Header, s)
+}
+
+// Muted greys out text about something that's gone or inactive
+func (c *Colorizer) Muted(s string) string {
+	return c.wrap(c.palette().Muted, s)
+}
+
+// Highlight marks the selected row, falling back to a text marker without color
+func (c *Colorizer) Highlight(s string) string {
+	if !c.Enabled() {
+		return "> " + s
+	}
+	return c.wrap(c.palette().Selected, s)
+}
+
+// Hyperlink makes text a clickable link to url using the OSC 8 escape, which terminals
+// without support ignore. Plain text is returned when color is disabled.
+func (c *Colorizer) Hyperlink(url, text string) string {
+	if !c.Enabled() {
+		return text
+	}
+	return "\033]8;;" + url + "\033\\" + text + "\033]8;;\033\\"
+}
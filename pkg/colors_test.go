@@ -0,0 +1,57 @@
+package pkg
+
+import "testing"
+
+func TestLoadTheme(t *testing.T) {
+	for _, name := range []string{"", "default", "solarized-dark", "high-contrast"} {
+		theme, err := LoadTheme(name, nil)
+		if err != nil {
+			t.Errorf("LoadTheme(%q) failed: %v", name, err)
+		}
+		if theme.Healthy == "" || theme.Reset == "" || theme.Selected == "" {
+			t.Errorf("LoadTheme(%q) left colors empty: %+v", name, theme)
+		}
+	}
+
+	theme, err := LoadTheme("high-contrast", map[string]string{"Healthy": "38;5;46", "reset": "0"})
+	if err != nil {
+		t.Fatalf("LoadTheme with overrides failed: %v", err)
+	}
+	if theme.Healthy != "\033[38;5;46m" || theme.Unhealthy != themes["high-contrast"].Unhealthy {
+		t.Errorf("overrides not applied on top of the preset: %+v", theme)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		overrides map[string]string
+	}{
+		{"neon", nil},
+		{"default", map[string]string{"border": "1"}},
+		{"default", map[string]string{"healthy": "\033[32m"}},
+	} {
+		theme, err := LoadTheme(tt.name, tt.overrides)
+		if err == nil {
+			t.Errorf("LoadTheme(%q, %q) succeeded", tt.name, tt.overrides)
+		}
+		if theme != themes[DefaultThemeName] {
+			t.Errorf("LoadTheme(%q, %q) didn't fall back to the default theme", tt.name, tt.overrides)
+		}
+	}
+}
+
+func TestColorizeUsesTheme(t *testing.T) {
+	theme, _ := LoadTheme("solarized-dark", nil)
+	dm := &DisplayManager{colors: NewThemeColorizer(true, theme)}
+
+	if got, want := dm.colorizeHealth(HealthHealthy), theme.Healthy+HealthHealthy+ColorReset; got != want {
+		t.Errorf("colorizeHealth = %q, want %q", got, want)
+	}
+	if got, want := dm.colorizeStatus(StatusConflict), theme.Unhealthy+StatusConflict+ColorReset; got != want {
+		t.Errorf("colorizeStatus = %q, want %q", got, want)
+	}
+
+	dm.colors = NewThemeColorizer(false, theme)
+	if got := dm.colorizeHealth(HealthHealthy); got != HealthHealthy {
+		t.Errorf("colorizeHealth with color disabled = %q", got)
+	}
+}
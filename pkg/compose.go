@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Labels Docker Compose puts on the containers it creates
+const (
+	ComposeProjectLabel = "com.docker.compose.project"
+	ComposeServiceLabel = "com.docker.compose.service"
+)
+
+// ComposePort is a port a Compose service publishes, as its effective config lists it
+type ComposePort struct {
+	Service   string `json:"service"`
+	Published string `json:"published,omitempty"` // Host port, empty when Docker picks one
+	Target    string `json:"target"`
+	Protocol  string `json:"protocol,omitempty"`
+}
+
+// ComposeForwards is what registering a Compose project's ports did
+type ComposeForwards struct {
+	Forwards []ForwardReport `json:"forwards"`
+	Warnings []string        `json:"warnings,omitempty"` // Ports that couldn't be forwarded, and why
+}
+
+// ForwardCompose refreshes the services so a project just brought up is listed, then makes
+// sure each of ports is forwarded from the project's containers. A port published by
+// several containers, such as a scaled service's, is forwarded once. Ports Docker picked
+// the host port for, with no Published, are forwarded for every container of their service.
+func (c *Control) ForwardCompose(project string, ports []ComposePort) (ComposeForwards, error) {
+	docker := c.target.dockerClient()
+	if docker == nil {
+		return ComposeForwards{}, ErrNotConnected
+	}
+	if docker.ReadOnly() {
+		return ComposeForwards{}, fmt.Errorf("read-only, another monitor forwards this server")
+	}
+	if _, err := docker.GetServices(); err != nil {
+		return ComposeForwards{}, fmt.Errorf("failed to refresh services: %v", err)
+	}
+	replicas := composeReplicas(docker, project)
+
+	var result ComposeForwards
+	warn := func(format string, args ...any) {
+		warning := fmt.Sprintf(format, args...)
+		logWarn("Compose project %s: %s", project, warning)
+		result.Warnings = append(result.Warnings, warning)
+	}
+	claimed := make(map[string]string) // Compose service forwarding each remote port
+	forward := func(composeService string, service *ServiceStatus, port ForwardedPort) {
+		if owner, ok := claimed[port.Label()]; ok {
+			if owner != composeService {
+				warn("%s and %s both publish port %s, forwarding it for %s", owner, composeService, port.Label(), owner)
+			}
+			return
+		}
+		claimed[port.Label()] = composeService
+		switch port.Status {
+		case StatusForwarded, StatusReady:
+		case StatusUnsupported:
+			warn("%s publishes UDP port %s, which can't be forwarded over SSH", composeService, port.Remote)
+			return
+		default:
+			// Keeps a remapped local port, since StartForward only defaults to the same port
+			started, err := docker.StartForward(service.Name, port.Remote, port.Local)
+			if err != nil {
+				warn("failed to forward %s port %s: %v", composeService, port.Remote, err)
+				return
+			}
+			port = started
+		}
+		result.Forwards = append(result.Forwards, forwardReport(service.Name, portReport(port)))
+	}
+
+	// Fixed ports first, so one a scaled service publishes is claimed before the picked ones
+	published := make(map[string]bool)
+	for _, want := range ports {
+		if want.Published == "" {
+			continue
+		}
+		label := ForwardedPort{Remote: want.Published, Protocol: want.Protocol}.Label()
+		published[label] = true
+		found := false
+		for _, service := range replicas[want.Service] {
+			if port := service.Port(want.Published); port != nil && port.Label() == label {
+				forward(want.Service, service, *port)
+				found = true
+			}
+		}
+		if !found {
+			warn("%s publishes port %s, but none of its running containers do", want.Service, label)
+		}
+	}
+	for _, want := range ports {
+		if want.Published != "" {
+			continue
+		}
+		for _, service := range replicas[want.Service] {
+			for _, port := range service.ForwardedPorts {
+				if !published[port.Label()] {
+					forward(want.Service, service, port)
+				}
+			}
+		}
+	}
+	logInfo("Forwarded %d ports of Compose project %s for the docker wrapper", len(result.Forwards), project)
+	return result, nil
+}
+
+// StopCompose stops the forwards of a project taken down: each of ports' published port,
+// and any port its containers still listed publish. Forwards are stopped on the tunnel
+// only, so bringing the project up again forwards them again. A port another running
+// container publishes is left alone. It returns the remote ports stopped.
+func (c *Control) StopCompose(project string, ports []ComposePort) ([]string, error) {
+	docker := c.target.dockerClient()
+	if docker == nil {
+		return nil, ErrNotConnected
+	}
+	client := docker.GetClient()
+	if client == nil {
+		return nil, ErrNotConnected
+	}
+
+	// The project's containers may still be listed from before it was taken down
+	remotes := make(map[string]bool)
+	for _, port := range ports {
+		if port.Published != "" {
+			remotes[port.Published] = true
+		}
+	}
+	for _, services := range composeReplicas(docker, project) {
+		for _, service := range services {
+			for _, port := range service.ForwardedPorts {
+				remotes[port.Remote] = true
+			}
+		}
+	}
+
+	services, err := docker.GetServices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh services: %v", err)
+	}
+	for _, service := range services {
+		for _, port := range service.ForwardedPorts {
+			delete(remotes, port.Remote)
+		}
+	}
+
+	var stopped []string
+	for remote := range remotes {
+		if client.ForwardedTo(remote) == "" && client.ForwardFailure(remote) == nil {
+			continue
+		}
+		client.StopForward(remote)
+		stopped = append(stopped, remote)
+	}
+	sort.Strings(stopped)
+	logInfo("Stopped %d forwards of Compose project %s for the docker wrapper", len(stopped), project)
+	return stopped, nil
+}
+
+// composeReplicas returns copies of a Compose project's listed containers by Compose
+// service, sorted by name
+func composeReplicas(docker ContainerAPI, project string) map[string][]*ServiceStatus {
+	replicas := make(map[string][]*ServiceStatus)
+	docker.ViewServices(func(services map[string]*ServiceStatus) {
+		for _, service := range services {
+			if service.Project == project && service.ComposeService != "" {
+				replicas[service.ComposeService] = append(replicas[service.ComposeService], service.Clone())
+			}
+		}
+	})
+	for _, services := range replicas {
+		sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	}
+	return replicas
+}
@@ -6,22 +6,391 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
 )
 
 type ServerConfig struct {
-	Name    string `json:"name"`
-	Host    string `json:"host"`
-	User    string `json:"user"`
-	KeyPath string `json:"key_path"`
+	Name           string   `json:"name"`
+	Host           string   `json:"host"`
+	User           string   `json:"user"`
+	KeyPath        string   `json:"key_path"`
+	ForwardEnvVars []string `json:"forward_env_vars,omitempty"` // Local environment variables set on remote docker commands
+	// DialTimeoutSeconds limits each Docker API request, 0 for defaultDialTimeout
+	DialTimeoutSeconds int `json:"dial_timeout_seconds,omitempty"`
+	// UseWSL2 reaches Docker inside a WSL2 distro on a Windows host, WSL2Distro or the default one
+	UseWSL2    bool   `json:"use_wsl2,omitempty"`
+	WSL2Distro string `json:"wsl2_distro,omitempty"`
+	// WebhookURL receives a POST whenever a service turns unhealthy or recovers, signed with WebhookSecret
+	WebhookURL    string `json:"webhook_url,omitempty"`
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+	// SyncBwLimit, SyncCompressLevel and SyncSymlinks override the global sync settings for this server
+	SyncBwLimit       string        `json:"sync_bwlimit,omitempty"`
+	SyncCompressLevel *int          `json:"sync_compress_level,omitempty"`
+	SyncSymlinks      SymlinkPolicy `json:"sync_symlinks,omitempty"`
+	// TLSCertPath, TLSKeyPath and TLSCACertPath authenticate to a Docker daemon run with
+	// --tlsverify, over the SSH forward
+	TLSCertPath   string `json:"tls_cert_path,omitempty"`
+	TLSKeyPath    string `json:"tls_key_path,omitempty"`
+	TLSCACertPath string `json:"tls_ca_cert_path,omitempty"`
+}
+
+// defaultDialTimeout limits Docker API requests when the server doesn't set its own limit
+const defaultDialTimeout = 10 * time.Second
+
+// DialTimeout returns how long a Docker API request to the server may take
+func (s ServerConfig) DialTimeout() time.Duration {
+	if s.DialTimeoutSeconds <= 0 {
+		return defaultDialTimeout
+	}
+	return time.Duration(s.DialTimeoutSeconds) * time.Second
+}
+
+// SameConnection reports whether s and other connect to the same server the same way,
+// with the same certificates, posting to the same webhook
+func (s ServerConfig) SameConnection(other ServerConfig) bool {
+	return s.Name == other.Name && s.Host == other.Host && s.User == other.User && s.KeyPath == other.KeyPath &&
+		s.DialTimeoutSeconds == other.DialTimeoutSeconds && s.UseWSL2 == other.UseWSL2 && s.WSL2Distro == other.WSL2Distro &&
+		s.WebhookURL == other.WebhookURL && s.WebhookSecret == other.WebhookSecret &&
+		s.TLSCertPath == other.TLSCertPath && s.TLSKeyPath == other.TLSKeyPath && s.TLSCACertPath == other.TLSCACertPath
 }
 
 type Config struct {
-	Servers        []ServerConfig `json:"servers"`
-	CurrentServer  string         `json:"current_server"`
-	DefaultServer  string         `json:"default_server"`
+	Servers        []ServerConfig     `json:"servers"`
+	CurrentServer  string             `json:"current_server"`
+	DefaultServer  string             `json:"default_server"`
+	Display        DisplayPreferences `json:"display"`
+	Notifications  NotificationPreferences `json:"notifications"`
+	Alerts         []AlertRule        `json:"alerts,omitempty"` // Commands run when services enter a condition
+	API            APIPreferences     `json:"api"`
+	APIToken       string             `json:"api_token,omitempty"` // Bearer token the REST API on --api-addr requires; empty requires none
+	Logging        LoggingPreferences `json:"logging"`
+	ThemeName      string             `json:"theme_name,omitempty"` // Built-in color theme, see ThemeNames
+	Theme          map[string]string  `json:"theme,omitempty"`      // Per color overrides as SGR parameters, e.g. {"healthy": "1;32"}
+	// DockerAPIRetryAttempts is how many times a failing Docker API request is tried, 0 for
+	// defaultRetryAttempts; DockerAPIRetryDelayMs is the wait before the first retry
+	DockerAPIRetryAttempts int `json:"docker_api_retry_attempts,omitempty"`
+	DockerAPIRetryDelayMs  int `json:"docker_api_retry_delay_ms,omitempty"`
+	// Projects holds the docker wrapper's settings for each project, by its absolute path
+	Projects map[string]ProjectConfig `json:"projects,omitempty"`
+	// SyncBwLimit caps the docker wrapper's context syncs, e.g. "500K" or "2M" per second;
+	// SyncCompressLevel is rsync's compression level, 0 to turn compression off
+	SyncBwLimit       string `json:"sync_bwlimit,omitempty"`
+	SyncCompressLevel *int   `json:"sync_compress_level,omitempty"`
+	// SyncSymlinks is how the sync treats symlinks, SymlinkPreserve if empty
+	SyncSymlinks SymlinkPolicy `json:"sync_symlinks,omitempty"`
+	// SyncVerify compares the server's copy of each context by checksum after syncing it
+	SyncVerify bool `json:"sync_verify,omitempty"`
+	// SyncTimeoutSeconds limits each step of a sync, such as one rsync run, 0 for
+	// defaultSyncTimeout; SyncRetries is how often a failed step is retried, nil for
+	// defaultSyncRetries
+	SyncTimeoutSeconds int  `json:"sync_timeout_seconds,omitempty"`
+	SyncRetries        *int `json:"sync_retries,omitempty"`
+	// SSHConnectTimeoutSeconds limits how long the wrapper's ssh waits to connect, 0 for
+	// defaultConnectTimeout
+	SSHConnectTimeoutSeconds int `json:"ssh_connect_timeout_seconds,omitempty"`
+	// SyncWarnSizeMB is the context size in MB over which the wrapper asks before syncing, 0
+	// for defaultSyncWarnSize and negative to never ask; SyncLargeNonInteractive is what it
+	// does without a terminal to ask on, LargeSyncProceed if empty
+	SyncWarnSizeMB          int    `json:"sync_warn_size_mb,omitempty"`
+	SyncLargeNonInteractive string `json:"sync_large_noninteractive,omitempty"`
+
+}
+
+// Defaults for bounding the docker wrapper's ssh and rsync runs
+const (
+	defaultSyncTimeout    = 10 * time.Minute
+	defaultSyncRetries    = 2
+	defaultConnectTimeout = 15 * time.Second
+)
+
+// defaultSyncWarnSize is the context size the docker wrapper asks about before syncing
+const defaultSyncWarnSize = 200 * 1000 * 1000
+
+// What the docker wrapper does with a large context when there's no terminal to ask on
+const (
+	LargeSyncProceed = "proceed"
+	LargeSyncAbort   = "abort"
+)
+
+// SSHConnectTimeout returns how long the docker wrapper's ssh waits to connect
+func (c *Config) SSHConnectTimeout() time.Duration {
+	if c.SSHConnectTimeoutSeconds <= 0 {
+		return defaultConnectTimeout
+	}
+	return time.Duration(c.SSHConnectTimeoutSeconds) * time.Second
+}
+
+// SymlinkPolicy is how the docker wrapper's sync treats symlinks in the build context
+type SymlinkPolicy string
+
+const (
+	SymlinkPreserve SymlinkPolicy = "preserve" // Copy them as symlinks
+	SymlinkFollow   SymlinkPolicy = "follow"   // Copy what they point to
+	SymlinkSkip     SymlinkPolicy = "skip"     // Leave them out
+)
+
+// ParseSymlinkPolicy reads a symlink policy, SymlinkPreserve if it's empty
+func ParseSymlinkPolicy(policy string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(policy); p {
+	case "":
+		return SymlinkPreserve, nil
+	case SymlinkPreserve, SymlinkFollow, SymlinkSkip:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid symlink policy %q, want %s, %s or %s", policy, SymlinkPreserve, SymlinkFollow, SymlinkSkip)
+}
+
+// SyncSettings throttle and tune the docker wrapper's context syncs
+type SyncSettings struct {
+	BwLimit       string        // Bandwidth cap in rsync's units, empty for none
+	CompressLevel *int          // nil for rsync's default
+	Symlinks      SymlinkPolicy // Empty for SymlinkPreserve
+	Verify        bool          // Compare the server's copy by checksum after syncing
+	Timeout       time.Duration // Limit on each step of the sync
+	Retries       int           // How often a failed step is retried
+	WarnSize      int64         // Bytes over which syncing asks first, 0 for never
+	AbortLarge    bool          // Refuse a large sync when there's no terminal to ask on
+}
+
+// SyncSettings returns the sync settings for server, its own taking precedence over the
+// global ones
+func (c *Config) SyncSettings(server ServerConfig) SyncSettings {
+	settings := SyncSettings{
+		BwLimit:       c.SyncBwLimit,
+		CompressLevel: c.SyncCompressLevel,
+		Symlinks:      c.SyncSymlinks,
+		Verify:        c.SyncVerify,
+		Timeout:       defaultSyncTimeout,
+		Retries:       defaultSyncRetries,
+		WarnSize:      defaultSyncWarnSize,
+		AbortLarge:    c.SyncLargeNonInteractive == LargeSyncAbort,
+	}
+	if c.SyncWarnSizeMB > 0 {
+		settings.WarnSize = int64(c.SyncWarnSizeMB) * 1000 * 1000
+	} else if c.SyncWarnSizeMB < 0 {
+		settings.WarnSize = 0
+	}
+	if c.SyncTimeoutSeconds > 0 {
+		settings.Timeout = time.Duration(c.SyncTimeoutSeconds) * time.Second
+	}
+	if c.SyncRetries != nil {
+		settings.Retries = *c.SyncRetries
+	}
+	if server.SyncBwLimit != "" {
+		settings.BwLimit = server.SyncBwLimit
+	}
+	if server.SyncCompressLevel != nil {
+		settings.CompressLevel = server.SyncCompressLevel
+	}
+	if server.SyncSymlinks != "" {
+		settings.Symlinks = server.SyncSymlinks
+	}
+	return settings
+}
+
+// bwLimitPattern matches a bandwidth limit: a positive whole number of KiB per second, or
+// of KiB, MiB or GiB with a K, M or G suffix
+var bwLimitPattern = regexp.MustCompile(`^[1-9][0-9]*[KkMmGg]?$`)
+
+// ValidateBwLimit checks a sync bandwidth limit such as "500K" or "2M"
+func ValidateBwLimit(limit string) error {
+	if !bwLimitPattern.MatchString(limit) {
+		return fmt.Errorf("invalid bandwidth limit %q, want a positive whole number with an optional K, M or G suffix, e.g. 500K", limit)
+	}
+	return nil
+}
+
+// validateSync checks the global and per-server sync settings
+func (c *Config) validateSync() error {
+	check := func(where, limit string, level *int, symlinks SymlinkPolicy) error {
+		if limit != "" {
+			if err := ValidateBwLimit(limit); err != nil {
+				return fmt.Errorf("%ssync_bwlimit: %v", where, err)
+			}
+		}
+		if level != nil && (*level < 0 || *level > 9) {
+			return fmt.Errorf("%ssync_compress_level %d is out of range, want 0 to 9", where, *level)
+		}
+		if _, err := ParseSymlinkPolicy(string(symlinks)); err != nil {
+			return fmt.Errorf("%ssync_symlinks: %v", where, err)
+		}
+		return nil
+	}
+	if err := check("", c.SyncBwLimit, c.SyncCompressLevel, c.SyncSymlinks); err != nil {
+		return err
+	}
+	if c.SyncTimeoutSeconds < 0 || c.SSHConnectTimeoutSeconds < 0 {
+		return fmt.Errorf("sync_timeout_seconds and ssh_connect_timeout_seconds can't be negative")
+	}
+	if c.SyncRetries != nil && *c.SyncRetries < 0 {
+		return fmt.Errorf("sync_retries %d can't be negative", *c.SyncRetries)
+	}
+	if choice := c.SyncLargeNonInteractive; choice != "" && choice != LargeSyncProceed && choice != LargeSyncAbort {
+		return fmt.Errorf("invalid sync_large_noninteractive %q, want %s or %s", choice, LargeSyncProceed, LargeSyncAbort)
+	}
+	for _, server := range c.Servers {
+		if err := check(fmt.Sprintf("server %s: ", server.Name), server.SyncBwLimit, server.SyncCompressLevel, server.SyncSymlinks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProjectConfig holds the docker wrapper's settings for one project directory
+type ProjectConfig struct {
+	// ExtraExcludes are left out of the synced context, taking precedence over the
+	// project's ignore files; a leading ! re-includes what they exclude
+	ExtraExcludes []string `json:"extra_excludes,omitempty"`
+	// Server runs the project's commands instead of the server the monitor forwards
+	Server string `json:"server,omitempty"`
+	// ComposeFile is used by compose commands that don't name one with -f
+	ComposeFile string `json:"compose_file,omitempty"`
+	// NoSync runs commands in the last synced context, as --no-sync does
+	NoSync bool `json:"no_sync,omitempty"`
+}
+
+// Project returns the global config's settings for the project in dir, empty if it has none.
+// Merge adds those committed in its .dockforward/config.json.
+func (c *Config) Project(dir string) ProjectConfig {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return c.Projects[filepath.Clean(dir)]
+}
+
+// Defaults for retrying Docker API requests that fail transiently
+const (
+	defaultRetryAttempts = 3
+	defaultRetryDelay    = 500 * time.Millisecond
+)
+
+// DockerAPIRetry returns how many times Docker API requests are tried and the wait before
+// the first retry
+func (c *Config) DockerAPIRetry() (attempts int, delay time.Duration) {
+	attempts, delay = c.DockerAPIRetryAttempts, time.Duration(c.DockerAPIRetryDelayMs)*time.Millisecond
+	if attempts <= 0 {
+		attempts = defaultRetryAttempts
+	}
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	return attempts, delay
+}
+
+// DisplayPreferences holds monitor UI settings that persist between runs
+type DisplayPreferences struct {
+	SortOrder      string              `json:"sort_order,omitempty"`
+	SortDescending bool                `json:"sort_descending,omitempty"`             // Reverse the sort order
+	Pinned         map[string][]string `json:"pinned,omitempty"`                      // Pinned service names per server name
+	HideUnported   bool                `json:"hide_services_without_ports,omitempty"` // Collapse the table of services without ports
+	ShowHost       bool                `json:"show_host_resources,omitempty"`         // Show the host's disk, memory and load over the overview
+}
+
+// PinnedServices returns the services pinned on server, in the order they were pinned
+func (c *Config) PinnedServices(server string) []string {
+	return c.Display.Pinned[server]
+}
+
+// TogglePin pins service on server, or unpins it if it's already pinned, reporting whether
+// it's now pinned. The caller saves the config.
+func (c *Config) TogglePin(server, service string) bool {
+	pinned := c.Display.Pinned[server]
+	for i, name := range pinned {
+		if name == service {
+			pinned = append(pinned[:i:i], pinned[i+1:]...)
+			if len(pinned) == 0 {
+				delete(c.Display.Pinned, server)
+			} else {
+				c.Display.Pinned[server] = pinned
+			}
+			return false
+		}
+	}
+	if c.Display.Pinned == nil {
+		c.Display.Pinned = make(map[string][]string)
+	}
+	c.Display.Pinned[server] = append(pinned, service)
+	return true
+}
+
+// ColorTheme returns the configured color theme, falling back to the default theme
+// with an error if the config names an unknown theme or color
+func (c *Config) ColorTheme() (ColorTheme, error) {
+	return LoadTheme(c.ThemeName, c.Theme)
+}
+
+// NotificationPreferences controls alerts for service health changes and new port conflicts.
+// Watched events always ring the terminal bell; desktop notifications are opt-in.
+type NotificationPreferences struct {
+	Desktop         bool            `json:"desktop,omitempty"`          // Also send desktop notifications
+	Events          map[string]bool `json:"events,omitempty"`           // Per event toggles, keyed by event name; missing events are watched
+	DebounceMinutes int             `json:"debounce_minutes,omitempty"` // Minimum gap between alerts for one service and event, default 5
+}
+
+// APIPreferences controls the HTTP control API other tools use to query and drive a running
+// monitor. It's off unless enabled, and only ever listens on this machine.
+type APIPreferences struct {
+	Enabled bool `json:"enabled,omitempty"`
+	Port    int  `json:"port,omitempty"` // TCP port on 127.0.0.1; 0 serves on api.sock in the config directory
+	// GRPCAddr is where the gRPC server listens, such as 127.0.0.1:50051; empty doesn't
+	// serve it. It's separate from the HTTP API and served whether that's enabled or not.
+	GRPCAddr string `json:"grpc_addr,omitempty"`
+}
+
+// Watches reports whether alerts are enabled for an event
+func (n NotificationPreferences) Watches(event string) bool {
+	enabled, ok := n.Events[event]
+	return !ok || enabled
+}
+
+// Debounce returns the minimum gap between alerts for one service and event
+func (n NotificationPreferences) Debounce() time.Duration {
+	if n.DebounceMinutes <= 0 {
+		return defaultNotificationDebounce
+	}
+	return time.Duration(n.DebounceMinutes) * time.Minute
+}
+
+// LoggingPreferences sets where headless mode and the docker wrapper write their logs
+type LoggingPreferences struct {
+	File       string `json:"file,omitempty"`        // Log file instead of stderr; ~ is the home directory
+	MaxSizeMB  int    `json:"max_size_mb,omitempty"` // Size the file is rotated at, default 10
+	MaxBackups int    `json:"max_backups,omitempty"` // Rotated files kept, default 3
+}
+
+// defaultLogMaxSizeMB and defaultLogBackups apply when the config leaves them unset
+const (
+	defaultLogMaxSizeMB = 10
+	defaultLogBackups   = 3
+)
+
+// OpenFile opens the configured log file with its rotation settings, or path instead if
+// it's set, such as a --log-file flag
+func (l LoggingPreferences) OpenFile(path string) (*LogFile, error) {
+	if path == "" {
+		path = expandHome(l.File)
+	}
+	maxSize, backups := l.MaxSizeMB, l.MaxBackups
+	if maxSize <= 0 {
+		maxSize = defaultLogMaxSizeMB
+	}
+	if backups <= 0 {
+		backups = defaultLogBackups
+	}
+	return OpenLogFile(path, int64(maxSize)<<20, backups)
 }
 
+// configDirEnv names the environment variable that moves the config directory elsewhere
+const configDirEnv = "DOCKFORWARD_CONFIG_DIR"
+
+// GetConfigDir returns the directory holding the config file and the monitor's sockets,
+// $DOCKFORWARD_CONFIG_DIR if set and ~/.config/dockforward otherwise
 func GetConfigDir() (string, error) {
+	if dir := os.Getenv(configDirEnv); dir != "" {
+		return dir, nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get home directory: %v", err)
@@ -49,6 +418,9 @@ func LoadConfig() (*Config, error) {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %v", err)
 	}
+	if err := config.validateSync(); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
 
 	// Validate and clean up the configuration
 	config.validateAndCleanup()
@@ -97,7 +469,9 @@ func (c *Config) validateAndCleanup() {
 	// If no default server, set it to the first valid server
 	if c.DefaultServer == "" && len(c.Servers) > 0 {
 		c.DefaultServer = c.Servers[0].Name
-		c.CurrentServer = c.Servers[0].Name
+		if c.CurrentServer == "" {
+			c.CurrentServer = c.Servers[0].Name
+		}
 	}
 }
 
@@ -138,6 +512,49 @@ func (c *Config) Save() error {
 	return nil
 }
 
+// secretMask replaces secrets in the config Show prints
+const secretMask = "***"
+
+// Show formats the config as indented JSON, with the API token and webhook secrets masked
+// unless showSecrets is set, and $VAR and ${VAR} in values replaced by the environment
+// variables if expandEnv is set
+func (c *Config) Show(showSecrets, expandEnv bool) ([]byte, error) {
+	shown := *c
+	if !showSecrets {
+		if shown.APIToken != "" {
+			shown.APIToken = secretMask
+		}
+		shown.Servers = slices.Clone(c.Servers)
+		for i := range shown.Servers {
+			if shown.Servers[i].WebhookSecret != "" {
+				shown.Servers[i].WebhookSecret = secretMask
+			}
+		}
+	}
+	data, err := json.MarshalIndent(&shown, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %v", err)
+	}
+	if expandEnv {
+		// Escaped for JSON, since a value may hold quotes or backslashes
+		data = []byte(os.Expand(string(data), func(name string) string {
+			value, _ := json.Marshal(os.Getenv(name))
+			return string(value[1 : len(value)-1])
+		}))
+	}
+	return data, nil
+}
+
+// Server returns the server named name, or nil if there's none
+func (c *Config) Server(name string) *ServerConfig {
+	for i := range c.Servers {
+		if c.Servers[i].Name == name {
+			return &c.Servers[i]
+		}
+	}
+	return nil
+}
+
 func (c *Config) GetCurrentServer() *ServerConfig {
 	for _, server := range c.Servers {
 		if server.Name == c.CurrentServer {
@@ -0,0 +1,359 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// propertyIterations is the number of random configs checked per property
+const propertyIterations = 200
+
+// stringAlphabet mixes ASCII, path punctuation, JSON-significant characters and multi-byte runes
+var stringAlphabet = []rune("abcXYZ019 -_./~:@\"\\\t\n<>&é漢字🐳ß  ")
+
+func randomString(r *rand.Rand, minLen, maxLen int) string {
+	n := minLen + r.Intn(maxLen-minLen+1)
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteRune(stringAlphabet[r.Intn(len(stringAlphabet))])
+	}
+	return b.String()
+}
+
+// randomKeyPath produces key paths including home-relative, absolute and unusual forms
+func randomKeyPath(r *rand.Rand) string {
+	switch r.Intn(4) {
+	case 0:
+		return "~/.ssh/" + randomString(r, 1, 12)
+	case 1:
+		return "/" + randomString(r, 1, 30)
+	case 2:
+		return "~/" + strings.Repeat("dir/", r.Intn(10)) + "id_ed25519"
+	default:
+		return randomString(r, 1, 40)
+	}
+}
+
+// randomConfig generates a valid config: non-empty fields, unique names, and valid default/current servers
+func randomConfig(r *rand.Rand) *Config {
+	count := 1 + r.Intn(8)
+	config := &Config{}
+	for i := 0; i < count; i++ {
+		var env []string // Left nil when empty, as omitempty drops it
+		for j := r.Intn(3); j > 0; j-- {
+			env = append(env, randomString(r, 1, 12))
+		}
+		config.Servers = append(config.Servers, ServerConfig{
+			Name:               fmt.Sprintf("%s-%d", randomString(r, 1, 16), i),
+			Host:               fmt.Sprintf("%s:%d", randomString(r, 1, 20), r.Intn(65536)),
+			User:               randomString(r, 1, 12),
+			KeyPath:            randomKeyPath(r),
+			ForwardEnvVars:     env,
+			DialTimeoutSeconds: r.Intn(60),
+		})
+		if r.Intn(2) == 0 {
+			config.Servers[i].UseWSL2 = true
+			config.Servers[i].WSL2Distro = randomString(r, 0, 12)
+		}
+	}
+	config.DefaultServer = config.Servers[r.Intn(count)].Name
+	config.CurrentServer = config.Servers[r.Intn(count)].Name
+	if n := r.Intn(len(sortOrders) + 1); n < len(sortOrders) {
+		config.Display.SortOrder = string(sortOrders[n])
+	}
+	config.Display.SortDescending = r.Intn(2) == 0
+	if r.Intn(2) == 0 {
+		level := r.Intn(10)
+		config.SyncBwLimit, config.SyncCompressLevel = fmt.Sprintf("%d%s", 1+r.Intn(5000), []string{"", "K", "M"}[r.Intn(3)]), &level
+		config.Servers[0].SyncBwLimit = fmt.Sprintf("%dK", 1+r.Intn(500))
+		config.SyncSymlinks = []SymlinkPolicy{SymlinkPreserve, SymlinkFollow, SymlinkSkip}[r.Intn(3)]
+		config.SyncVerify = r.Intn(2) == 0
+	}
+	for i := r.Intn(3); i > 0; i-- {
+		config.TogglePin(config.Servers[r.Intn(count)].Name, randomString(r, 1, 16))
+	}
+	if len(config.Display.Pinned) == 0 {
+		config.Display.Pinned = nil // Pinning and unpinning leaves an empty map, which omitempty drops
+	}
+	config.Display.HideUnported = r.Intn(2) == 0
+	config.DockerAPIRetryAttempts, config.DockerAPIRetryDelayMs = r.Intn(5), r.Intn(2000)
+	if r.Intn(2) == 0 {
+		project := "/" + randomString(r, 1, 20)
+		config.Projects = map[string]ProjectConfig{project: {ExtraExcludes: []string{randomString(r, 1, 12), "!" + randomString(r, 1, 12)}}}
+	}
+	config.API = APIPreferences{Enabled: r.Intn(2) == 0, Port: r.Intn(65536)}
+	if r.Intn(2) == 0 {
+		config.API.GRPCAddr = fmt.Sprintf("127.0.0.1:%d", r.Intn(65536))
+	}
+	if r.Intn(2) == 0 {
+		config.Logging = LoggingPreferences{File: randomKeyPath(r), MaxSizeMB: r.Intn(100), MaxBackups: r.Intn(10)}
+	}
+	return config
+}
+
+func TestProject(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{Projects: map[string]ProjectConfig{dir: {ExtraExcludes: []string{"fixtures/"}}}}
+	if got := config.Project(dir + "/."); !reflect.DeepEqual(got.ExtraExcludes, []string{"fixtures/"}) {
+		t.Errorf("Project(%s) = %+v, want its excludes", dir, got)
+	}
+	if got := config.Project(t.TempDir()); got.ExtraExcludes != nil {
+		t.Errorf("Project of an unconfigured directory = %+v", got)
+	}
+}
+
+func TestSyncSettings(t *testing.T) {
+	level, off := 6, 0
+	config := &Config{SyncBwLimit: "2M", SyncCompressLevel: &level, SyncSymlinks: SymlinkFollow, SyncVerify: true}
+	if got := config.SyncSettings(ServerConfig{Name: "dev"}); got.BwLimit != "2M" || got.CompressLevel != &level || got.Symlinks != SymlinkFollow || !got.Verify {
+		t.Errorf("without server settings = %+v, want the global ones", got)
+	}
+	got := config.SyncSettings(ServerConfig{Name: "hotel", SyncBwLimit: "300K", SyncCompressLevel: &off, SyncSymlinks: SymlinkSkip})
+	if got.BwLimit != "300K" || got.CompressLevel != &off || got.Symlinks != SymlinkSkip {
+		t.Errorf("with server settings = %+v, want the server's", got)
+	}
+	if got.Timeout != defaultSyncTimeout || got.Retries != defaultSyncRetries || config.SSHConnectTimeout() != defaultConnectTimeout {
+		t.Errorf("timeouts = %+v and %s, want the defaults", got, config.SSHConnectTimeout())
+	}
+	retries := 0
+	config.SyncTimeoutSeconds, config.SyncRetries, config.SSHConnectTimeoutSeconds = 30, &retries, 5
+	if got := config.SyncSettings(ServerConfig{}); got.Timeout != 30*time.Second || got.Retries != 0 || config.SSHConnectTimeout() != 5*time.Second {
+		t.Errorf("timeouts = %+v and %s, want the configured ones", got, config.SSHConnectTimeout())
+	}
+	config.SyncTimeoutSeconds, config.SyncRetries, config.SSHConnectTimeoutSeconds = 0, nil, 0
+	if got := config.SyncSettings(ServerConfig{}); got.WarnSize != 200_000_000 || got.AbortLarge {
+		t.Errorf("large sync settings = %d and %v, want asking over 200MB and going ahead without a terminal", got.WarnSize, got.AbortLarge)
+	}
+	config.SyncWarnSizeMB, config.SyncLargeNonInteractive = 50, LargeSyncAbort
+	if got := config.SyncSettings(ServerConfig{}); got.WarnSize != 50_000_000 || !got.AbortLarge {
+		t.Errorf("large sync settings = %d and %v, want the configured ones", got.WarnSize, got.AbortLarge)
+	}
+	config.SyncWarnSizeMB = -1
+	if got := config.SyncSettings(ServerConfig{}); got.WarnSize != 0 {
+		t.Errorf("negative sync_warn_size_mb gives a threshold of %d, want none", got.WarnSize)
+	}
+	config.SyncWarnSizeMB, config.SyncLargeNonInteractive = 0, ""
+
+	for _, limit := range []string{"1", "500K", "2m", "1G"} {
+		if err := ValidateBwLimit(limit); err != nil {
+			t.Errorf("ValidateBwLimit(%q) = %v", limit, err)
+		}
+	}
+	for _, limit := range []string{"", "0", "-5", "1.5M", "500KB", "fast", "05K"} {
+		if err := ValidateBwLimit(limit); err == nil {
+			t.Errorf("ValidateBwLimit(%q) accepted it", limit)
+		}
+	}
+
+	tooHigh, negative := 10, -1
+	invalid := []*Config{
+		{SyncBwLimit: "10 MB"},
+		{SyncCompressLevel: &tooHigh},
+		{Servers: []ServerConfig{{Name: "hotel", SyncBwLimit: "-1"}}},
+		{SyncSymlinks: "copy"},
+		{SyncTimeoutSeconds: -1},
+		{SyncRetries: &negative},
+		{SyncLargeNonInteractive: "ask"},
+	}
+	for _, config := range invalid {
+		if err := config.validateSync(); err == nil {
+			t.Errorf("validateSync accepted %+v", config)
+		}
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	config = &Config{Servers: []ServerConfig{{Name: "hotel", Host: "h:22", User: "u", KeyPath: "k", SyncBwLimit: "lots"}}}
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "server hotel: sync_bwlimit") {
+		t.Errorf("LoadConfig = %v, want the server's invalid limit", err)
+	}
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	for value, want := range map[string]SymlinkPolicy{"": SymlinkPreserve, "preserve": SymlinkPreserve, "follow": SymlinkFollow, "skip": SymlinkSkip} {
+		if got, err := ParseSymlinkPolicy(value); err != nil || got != want {
+			t.Errorf("ParseSymlinkPolicy(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseSymlinkPolicy("Follow"); err == nil {
+		t.Error("ParseSymlinkPolicy accepted Follow")
+	}
+}
+
+func TestDockerAPIRetry(t *testing.T) {
+	config := &Config{}
+	if attempts, delay := config.DockerAPIRetry(); attempts != 3 || delay != 500*time.Millisecond {
+		t.Errorf("defaults = %d attempts after %v, want 3 after 500ms", attempts, delay)
+	}
+	config.DockerAPIRetryAttempts, config.DockerAPIRetryDelayMs = 1, 50
+	if attempts, delay := config.DockerAPIRetry(); attempts != 1 || delay != 50*time.Millisecond {
+		t.Errorf("configured = %d attempts after %v, want 1 after 50ms", attempts, delay)
+	}
+}
+
+func TestTogglePin(t *testing.T) {
+	config := fixtureConfig()
+	if !config.TogglePin("staging", "web") || !config.TogglePin("staging", "db") || !config.TogglePin("default", "web") {
+		t.Fatal("TogglePin reported an unpinned service as unpinned")
+	}
+	if got := config.PinnedServices("staging"); !reflect.DeepEqual(got, []string{"web", "db"}) {
+		t.Errorf("staging pins = %q, want [web db] in the order pinned", got)
+	}
+
+	if config.TogglePin("staging", "web") {
+		t.Error("TogglePin reported a pinned service as pinned after unpinning it")
+	}
+	if got := config.PinnedServices("staging"); !reflect.DeepEqual(got, []string{"db"}) {
+		t.Errorf("staging pins = %q after unpinning web, want [db]", got)
+	}
+	if got := config.PinnedServices("default"); !reflect.DeepEqual(got, []string{"web"}) {
+		t.Errorf("unpinning on staging changed default's pins to %q", got)
+	}
+
+	config.TogglePin("staging", "db")
+	if _, ok := config.Display.Pinned["staging"]; ok {
+		t.Error("a server with no pins is still listed")
+	}
+}
+
+func TestConfigJSONRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < propertyIterations; i++ {
+		want := randomConfig(r)
+
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatalf("iteration %d: marshal failed: %v", i, err)
+		}
+		var got Config
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("iteration %d: unmarshal failed: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(want, &got) {
+			t.Fatalf("iteration %d: round trip mismatch\nwant: %#v\ngot:  %#v\njson: %s", i, want, &got, data)
+		}
+	}
+}
+
+func TestConfigSaveLoadRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < propertyIterations; i++ {
+		t.Setenv("HOME", t.TempDir())
+		want := randomConfig(r)
+
+		if err := want.Save(); err != nil {
+			t.Fatalf("iteration %d: save failed: %v", i, err)
+		}
+		got, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("iteration %d: load failed: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("iteration %d: save/load mismatch\nwant: %#v\ngot:  %#v", i, want, got)
+		}
+	}
+}
+
+func TestValidateAndCleanupKeepsValidConfig(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < propertyIterations; i++ {
+		want := randomConfig(r)
+		got := *want
+		got.Servers = append([]ServerConfig(nil), want.Servers...)
+
+		got.validateAndCleanup()
+
+		if !reflect.DeepEqual(want, &got) {
+			t.Fatalf("iteration %d: validateAndCleanup changed a valid config\nwant: %#v\ngot:  %#v", i, want, &got)
+		}
+	}
+}
+
+func TestValidateAndCleanupDropsInvalidServers(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	for i := 0; i < propertyIterations; i++ {
+		config := randomConfig(r)
+
+		// Blank out one field on a random server, which makes it invalid
+		idx := r.Intn(len(config.Servers))
+		removed := config.Servers[idx].Name
+		current := config.CurrentServer
+		switch r.Intn(3) {
+		case 0:
+			config.Servers[idx].Host = ""
+		case 1:
+			config.Servers[idx].User = ""
+		default:
+			config.Servers[idx].KeyPath = ""
+		}
+
+		config.validateAndCleanup()
+
+		if config.isServerNameValid(removed) {
+			t.Fatalf("iteration %d: invalid server %q was kept", i, removed)
+		}
+		if len(config.Servers) > 0 {
+			if !config.isServerNameValid(config.DefaultServer) {
+				t.Fatalf("iteration %d: default server %q is not a remaining server", i, config.DefaultServer)
+			}
+			if !config.isServerNameValid(config.CurrentServer) {
+				t.Fatalf("iteration %d: current server %q is not a remaining server", i, config.CurrentServer)
+			}
+		}
+		if current != removed && config.CurrentServer != current {
+			t.Fatalf("iteration %d: current server changed from %q to %q although it is still valid", i, current, config.CurrentServer)
+		}
+	}
+}
+
+func TestConfigShow(t *testing.T) {
+	config := &Config{
+		Servers: []ServerConfig{
+			{Name: "prod", Host: "prod:22", User: "deploy", KeyPath: "$KEYS/prod", WebhookURL: "https://hooks.invalid/x", WebhookSecret: "s3cret"},
+			{Name: "dev", Host: "dev:22", User: "me", KeyPath: "~/.ssh/id_rsa"},
+		},
+		APIToken: "token",
+	}
+	t.Setenv("KEYS", `/keys "quoted"`)
+
+	data, err := config.Show(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shown Config
+	if err := json.Unmarshal(data, &shown); err != nil {
+		t.Fatalf("Show printed invalid JSON: %v\n%s", err, data)
+	}
+	if shown.APIToken != "***" || shown.Servers[0].WebhookSecret != "***" || shown.Servers[1].WebhookSecret != "" {
+		t.Errorf("secrets not masked:\n%s", data)
+	}
+	if shown.Servers[0].KeyPath != "$KEYS/prod" {
+		t.Errorf("key path = %q, want it unexpanded", shown.Servers[0].KeyPath)
+	}
+	if config.APIToken != "token" || config.Servers[0].WebhookSecret != "s3cret" {
+		t.Error("Show masked the config itself")
+	}
+
+	data, err = config.Show(true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &shown); err != nil {
+		t.Fatalf("Show printed invalid JSON: %v\n%s", err, data)
+	}
+	if shown.APIToken != "token" || shown.Servers[0].WebhookSecret != "s3cret" {
+		t.Errorf("secrets masked with showSecrets:\n%s", data)
+	}
+	if shown.Servers[0].KeyPath != `/keys "quoted"/prod` {
+		t.Errorf("key path = %q, want $KEYS expanded", shown.Servers[0].KeyPath)
+	}
+}
@@ -2,14 +2,24 @@ package pkg
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"github.com/atotto/clipboard"
 	"github.com/olekukonko/tablewriter"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
 )
 
 // DisplayMode represents different view modes
@@ -19,18 +29,92 @@ const (
 	ModeServerList DisplayMode = iota
 	ModeOverview
 	ModeServiceDetail
+	ModeHelp
+	ModeResolve
+	ModeMessages
+	ModeNetworkList
+	ModeVolumeList
+	ModeExtensions
+	ModeExtension
+	ModeForwards
 )
 
+// modeNames describes each mode in the help screen
+var modeNames = map[DisplayMode]string{
+	ModeServerList:    "Server list",
+	ModeOverview:      "Services",
+	ModeServiceDetail: "Service detail",
+	ModeResolve:       "Resolve conflicts",
+	ModeMessages:      "Messages",
+	ModeNetworkList:   "Networks",
+	ModeVolumeList:    "Volumes",
+	ModeExtensions:    "Extensions",
+	ModeExtension:     "Extension",
+	ModeForwards:      "Forwards",
+}
+
 // DisplayManager handles the rendering of service tables
 type DisplayManager struct {
-	docker          *DockerClient
+	docker          ContainerAPI
+	lock            *ServerLock // Lock on forwarding the connected server, nil while read-only
 	config          *Config
 	selectedService *ServiceStatus
 	selectedIndex   int
 	currentScreen   Screen
+	modals          []Screen         // Dialogs stacked over the current screen, topmost last
 	currentServices []*ServiceStatus // Store current sorted services with ports
+	renderedRows    []string         // Service names in the order last rendered, which numeric input resolves against
+	rowLines        []int            // Frame line of each clickable row, in row order
 	mode            DisplayMode
+	input           *InputHandler
+	cursors         map[DisplayMode]int // Highlighted row per screen in raw input mode
+	inputBuffer     string              // Partially typed command in raw input mode
+	lastFrame       []byte              // Last frame written, to skip redundant redraws
+	mirrors         map[*mirror]bool    // Other terminals each frame is also drawn on, such as browser tabs
+	altScreen       bool
+	mouse           bool // Whether terminal mouse reporting is enabled
+	tty             bool // Whether stdout is a terminal that understands cursor movement
+	width           int  // Terminal columns tables are fitted to, 0 for no limit
+	resized         chan os.Signal
+	colors          *Colorizer
+	notifier        *Notifier
+	events          *EventLogger // Where state changes are recorded, nil for nowhere
+	alerter         *Alerter     // Runs the config's alert rules
+	refresher       *Refresher   // Keeps the connection's services current, nil while disconnected
+	resources       *HostResources     // Last collected disk, memory and load of the connected host
+	resourcesErr    string             // Why the last collection failed, cleared by the next success
+	stopResources   context.CancelFunc // Stops collecting the connected host's resources
+	reachability    *ReachabilityChecker // Cached server probes, kept across visits to the server list
+	onQuit          func()
+	actionHistory   []PortRemapAction // Remaps that can be undone, most recent last
+	redoHistory     []PortRemapAction // Undone remaps that can be redone, most recent last
+	messages        messageLog  // Recent log messages, the newest shown below the screen
+	messagesReturn  DisplayMode // Screen the message history returns to
+	flashMsg        string   // Short-lived confirmation shown in the status line
+	flashTimer      *time.Timer
+	lastUpdate      time.Time // When services were last fetched successfully
+	fetchErr        string    // Why the last background fetch failed, cleared by the next success
+	filters         map[string][]string // Docker API filters applied to every connection, nil for all containers
+	plugins         []ScreenPlugin      // Screens listed in the extensions menu
+	extension       ScreenPlugin        // Plugin whose screen is open in ModeExtension
 	mu              sync.RWMutex
+	renderMu        sync.Mutex
+	inputMu         sync.Mutex // Held while handling input, which can come from the terminal and mirrors at once
+	msgMu           sync.Mutex
+}
+
+// messagesShown is the number of recent log messages shown in the message area
+const messagesShown = 3
+
+// flashDuration is how long a flash message stays in the status line
+const flashDuration = 2 * time.Second
+
+// clipboardWriteAll puts text on the system clipboard, replaced in tests
+var clipboardWriteAll = clipboard.WriteAll
+
+// Navigable is implemented by screens whose rows can be selected with the cursor
+type Navigable interface {
+	RowCount() int
 }
 
 func (d *DisplayManager) Mode() DisplayMode {
@@ -38,56 +122,586 @@ func (d *DisplayManager) Mode() DisplayMode {
 }
 
 // NewDisplayManager creates a new display manager
-func NewDisplayManager(config *Config, dockerClient *DockerClient) (*DisplayManager, error) {
+func NewDisplayManager(config *Config, dockerClient ContainerAPI) (*DisplayManager, error) {
 	dm := &DisplayManager{
-		docker: dockerClient,
-		config: config,
+		docker:  dockerClient,
+		config:  config,
+		cursors: make(map[DisplayMode]int),
+		tty:     term.IsTerminal(int(os.Stdout.Fd())),
 	}
+	theme, err := config.ColorTheme()
+	if err != nil {
+		logWarn("Using the default color theme: %v", err)
+	}
+	dm.colors = NewThemeColorizer(ColorSupported(), theme)
+	dm.notifier = NewNotifier(config.Notifications, &bellWriter{dm})
+	if dm.alerter, err = NewAlerter(config.Alerts); err != nil {
+		logWarn("Skipping invalid alerts: %v", err)
+	}
+	dm.reachability = NewReachabilityChecker()
 	dm.SetMode(ModeServerList)
 	return dm, nil
 }
 
-func (d *DisplayManager) SetDockerClient(client *DockerClient) {
+func (d *DisplayManager) SetDockerClient(client ContainerAPI) {
+	// Switching servers leaves nothing running for the previous one
+	if d.docker != nil && d.docker != client {
+		d.disconnect()
+	}
+	// Forwards restart from scratch on a new connection, so old remaps can't be undone
+	d.clearHistory()
+	var refresher *Refresher
+	if client != nil {
+		refresher = NewRefresher(client)
+		refresher.fetched = d.recordFetch
+		refresher.updated = d.UpdateServices
+	}
+	resourcesCtx, stopResources := context.WithCancel(context.Background())
+	d.mu.Lock()
+	d.lastUpdate, d.fetchErr = time.Time{}, ""
 	d.docker = client
+	d.refresher = refresher
+	d.resources, d.resourcesErr, d.stopResources = nil, "", stopResources
+	d.mu.Unlock()
+	if client != nil {
+		client.SetNotifier(d.notifier)
+		client.SetEventLogger(d.events)
+		client.SetAlerter(d.alerter)
+		client.SetRetry(d.config.DockerAPIRetry())
+		client.SetFilters(d.filters)
+		d.claimServer(client, d.config.CurrentServer)
+		refresher.Start()
+		go d.watchResources(resourcesCtx, client)
+	}
 	if d.currentScreen != nil {
 		switch screen := d.currentScreen.(type) {
 		case *LandingScreen:
 			screen.docker = client
 		case *ServiceDetailScreen:
 			screen.docker = client
+		case *NetworkListScreen:
+			screen.docker = client
+		case *VolumeListScreen:
+			screen.docker = client
+		case *ForwardsScreen:
+			screen.docker = client
 		}
 	}
 }
 
+// SetEventLogger records state changes of this connection's services, and any later
+// one's, in events
+func (d *DisplayManager) SetEventLogger(events *EventLogger) {
+	d.mu.Lock()
+	d.events = events
+	docker := d.docker
+	d.mu.Unlock()
+	if docker != nil {
+		docker.SetEventLogger(events)
+	}
+}
+
+// SetFilters restricts the services shown to containers matching filters, on this
+// connection and any later one; nil shows them all
+func (d *DisplayManager) SetFilters(filters map[string][]string) {
+	d.mu.Lock()
+	d.filters = filters
+	docker := d.docker
+	d.mu.Unlock()
+	if docker != nil {
+		docker.SetFilters(filters)
+	}
+}
+
 // UpdateServices updates the services in the display manager
 func (d *DisplayManager) UpdateServices(services map[string]*ServiceStatus) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	var withPorts, withoutPorts []*ServiceStatus
+	var withPorts []*ServiceStatus
 	for _, service := range services {
-		if len(service.ExposedPorts) > 0 {
+		if len(service.ForwardedPorts) > 0 {
 			withPorts = append(withPorts, service)
-		} else {
-			withoutPorts = append(withoutPorts, service)
 		}
 	}
 
-	// Sort services
-	sort.Slice(withPorts, func(i, j int) bool {
-		return withPorts[i].Name < withPorts[j].Name
-	})
-	sort.Slice(withoutPorts, func(i, j int) bool {
-		return withoutPorts[i].Name < withoutPorts[j].Name
-	})
+	// Sort the same way the table is rendered so indices match what's on screen
+	sortServices(withPorts, d.sortOrder(), d.sortAscending())
 
 	d.currentServices = withPorts
 }
 
+// snapshot copies services under the connection's read lock, since refreshes and remaps
+// update them in place while screens render
+func (d *DisplayManager) snapshot(services ...*ServiceStatus) []*ServiceStatus {
+	copies := make([]*ServiceStatus, len(services))
+	copyAll := func(map[string]*ServiceStatus) {
+		for i, service := range services {
+			copies[i] = service.Clone()
+		}
+	}
+	if docker := d.dockerClient(); docker != nil {
+		docker.ViewServices(copyAll)
+	} else {
+		copyAll(nil)
+	}
+	return copies
+}
+
+// disconnect closes the connected server's Docker API listener, port forwards and SSH connection
+func (d *DisplayManager) disconnect() {
+	if d.docker == nil {
+		return
+	}
+	d.docker.Close()
+	if sshClient := d.docker.GetClient(); sshClient != nil {
+		sshClient.Close()
+	}
+	d.mu.Lock()
+	d.docker = nil
+	refresher := d.refresher
+	d.refresher = nil
+	if d.stopResources != nil {
+		d.stopResources()
+		d.stopResources = nil
+	}
+	d.lock.Release()
+	d.lock = nil
+	d.mu.Unlock()
+	if refresher != nil {
+		refresher.Stop()
+	}
+}
+
+// watchServices asks for a refresh, then calls update whenever the connection's services
+// change until ctx is done. Screens share the one refresher rather than each polling.
+func (d *DisplayManager) watchServices(ctx context.Context, update func()) {
+	d.mu.RLock()
+	refresher := d.refresher
+	d.mu.RUnlock()
+	if refresher != nil {
+		refresher.Request()
+	}
+
+	for {
+		d.mu.RLock()
+		var changed <-chan struct{}
+		if d.refresher != nil {
+			changed = d.refresher.Changed()
+		}
+		d.mu.RUnlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+			if ctx.Err() == nil {
+				update()
+			}
+		}
+	}
+}
+
+// refreshServices fetches the services now and redraws
+func (d *DisplayManager) refreshServices() {
+	d.mu.RLock()
+	refresher := d.refresher
+	d.mu.RUnlock()
+	if refresher != nil {
+		refresher.Refresh()
+	}
+	d.Display()
+}
+
+// claimServer takes the lock on forwarding server for client. If another monitor holds it,
+// client is left read-only and the user is asked whether to take over.
+func (d *DisplayManager) claimServer(client ContainerAPI, server string) {
+	lock, err := acquireServerLock(server)
+	var held *LockHeldError
+	switch {
+	case errors.As(err, &held):
+		client.SetReadOnly(true)
+		logWarn("%v, showing its services read-only", held)
+		d.confirm(fmt.Sprintf("%s. Take over forwarding?", held), func() error {
+			go d.takeOver(client, held)
+			return nil
+		})
+		return
+	case err != nil:
+		// Without a lock file there's nothing to coordinate with, so forward anyway
+		logWarn("Failed to lock %s: %v", server, err)
+		return
+	}
+	d.mu.Lock()
+	d.lock = lock
+	d.mu.Unlock()
+}
+
+// takeoverTimeout is how long a takeover waits for the other monitor to release its lock
+const takeoverTimeout = 5 * time.Second
+
+// takeOver asks the monitor holding the server's lock to release it, then forwards with
+// client once it has
+func (d *DisplayManager) takeOver(client ContainerAPI, held *LockHeldError) {
+	if err := held.Holder.RequestRelease(); err != nil {
+		logError("Failed to take over %s: %v", held.Server, err)
+		return
+	}
+	deadline := time.Now().Add(takeoverTimeout)
+	for {
+		lock, err := acquireServerLock(held.Server)
+		if err == nil {
+			d.mu.Lock()
+			if d.docker != client {
+				// Switched servers while waiting
+				d.mu.Unlock()
+				lock.Release()
+				return
+			}
+			d.lock = lock
+			d.mu.Unlock()
+			client.SetReadOnly(false)
+			logInfo("Took over forwarding %s from pid %d", held.Server, held.Holder.PID)
+			d.Display()
+			return
+		}
+		if !errors.As(err, new(*LockHeldError)) || time.Now().After(deadline) {
+			logError("Failed to take over %s: %v", held.Server, err)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// takeOverServer forwards the connected server again after it was left read-only, taking
+// its lock from the monitor holding it if there still is one
+func (d *DisplayManager) takeOverServer() {
+	client := d.dockerClient()
+	if client == nil || !client.ReadOnly() {
+		return
+	}
+	server := d.config.CurrentServer
+	lock, err := acquireServerLock(server)
+	var held *LockHeldError
+	switch {
+	case errors.As(err, &held):
+		go d.takeOver(client, held)
+	case err != nil:
+		logError("Failed to take over %s: %v", server, err)
+	default:
+		d.mu.Lock()
+		d.lock = lock
+		d.mu.Unlock()
+		client.SetReadOnly(false)
+		logInfo("Forwarding %s again", server)
+	}
+}
+
+// ReleaseServer stops forwarding and releases the server's lock for another monitor taking
+// over, leaving this one showing the services read-only
+func (d *DisplayManager) ReleaseServer() {
+	d.mu.Lock()
+	lock, client := d.lock, d.docker
+	d.lock = nil
+	d.mu.Unlock()
+	if lock == nil {
+		return
+	}
+	if client != nil {
+		client.SetReadOnly(true)
+	}
+	lock.Release()
+	logWarn("Another monitor took over forwarding %s, showing its services read-only", lock.Server())
+	d.Display()
+}
+
+// dockerClient returns the connected server's client, safe to call from screens' background work
+func (d *DisplayManager) dockerClient() ContainerAPI {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.docker
+}
+
+// configuredServers returns the servers in the config, for the control API
+func (d *DisplayManager) configuredServers() []ServerConfig {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]ServerConfig(nil), d.config.Servers...)
+}
+
+// reconnect replaces the connection to the current server with a new one, returning to the
+// overview if a screen of the old connection's services was showing
+func (d *DisplayManager) reconnect() error {
+	server := d.config.GetCurrentServer()
+	if server == nil {
+		return fmt.Errorf("no server configured")
+	}
+	docker, err := Connect(server)
+	if err != nil {
+		return err
+	}
+	// The new connection replaces the old one, so carry its reconnect count over
+	if previous := d.dockerClient(); previous != nil {
+		old, _ := previous.GetClient().(*SSHClient)
+		fresh, _ := docker.GetClient().(*SSHClient)
+		if old != nil && fresh != nil && old.Target() == fresh.Target() {
+			fresh.ReconnectCount = old.Reconnects() + 1
+		}
+	}
+	d.SetDockerClient(docker)
+
+	d.mu.RLock()
+	mode := d.mode
+	d.mu.RUnlock()
+	if mode == ModeOverview || mode == ModeServiceDetail || mode == ModeResolve {
+		d.SetMode(ModeOverview)
+	}
+	d.events.Log(Event{Server: docker.server(), Type: EventSSHReconnect, NewValue: "connected"})
+	logInfo("Reconnected to %s", server.Name)
+	d.Display()
+	return nil
+}
+
+// Shutdown stops the current screen's polling and disconnects from the server
+func (d *DisplayManager) Shutdown() {
+	d.mu.RLock()
+	screen := d.currentScreen
+	d.mu.RUnlock()
+
+	if screen != nil {
+		screen.Close()
+	}
+	d.disconnect()
+}
+
+// SetQuitHandler sets the func the quit key runs, which owns restoring the terminal and exiting
+func (d *DisplayManager) SetQuitHandler(quit func()) {
+	d.onQuit = quit
+}
+
+// SelectedService returns the service shown in the detail screen
+func (d *DisplayManager) SelectedService() *ServiceStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.selectedService
+}
+
+// selectService sets the service shown in the detail screen, nil clearing the selection
+func (d *DisplayManager) selectService(service *ServiceStatus, index int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.selectedService = service
+	d.selectedIndex = index
+}
+
+// setRenderedRows records the services of the numbered rows as they were just drawn
+func (d *DisplayManager) setRenderedRows(services []*ServiceStatus) {
+	names := make([]string, len(services))
+	for i, service := range services {
+		names[i] = service.Name
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.renderedRows = names
+}
+
+// renderedRowCount returns the number of numbered rows in the last rendered frame
+func (d *DisplayManager) renderedRowCount() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.renderedRows)
+}
+
+// renderedName returns the service name of a numbered row in the last rendered frame, or ""
+func (d *DisplayManager) renderedName(idx int) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if idx < 0 || idx >= len(d.renderedRows) {
+		return ""
+	}
+	return d.renderedRows[idx]
+}
+
+// renderedService resolves a row number against the last rendered frame rather than the
+// live service list, which a poll may have reordered since the user read the screen
+func (d *DisplayManager) renderedService(idx int) *ServiceStatus {
+	d.mu.RLock()
+	if idx < 0 || idx >= len(d.renderedRows) {
+		d.mu.RUnlock()
+		return nil
+	}
+	name := d.renderedRows[idx]
+	d.mu.RUnlock()
+
+	docker := d.dockerClient()
+	if docker == nil {
+		return nil
+	}
+	return docker.GetService(name)
+}
+
+// SortOrder selects how the services tables are ordered
+type SortOrder string
+
+const (
+	SortByName    SortOrder = "name"
+	SortByHealth  SortOrder = "health"
+	SortByForward SortOrder = "forward"
+	SortByPorts   SortOrder = "ports"
+	SortByUptime  SortOrder = "uptime"
+)
+
+// sortOrders is the cycle followed by the sort toggle key
+var sortOrders = []SortOrder{SortByName, SortByHealth, SortByForward, SortByPorts, SortByUptime}
+
+// healthRank orders health states from most to least alarming
+var healthRank = map[string]int{
+	HealthUnhealthy:  0,
+	HealthDead:       1,
+	HealthExited:     2,
+	HealthRestarting: 3,
+	HealthStarting:   4,
+	HealthCreated:    5,
+	HealthPaused:     6,
+	HealthRemoving:   7,
+	HealthUnknown:    8,
+	HealthRunning:    9,
+	HealthHealthy:    10,
+}
+
+// forwardRank orders forward states from most to least alarming
+var forwardRank = map[string]int{
+	StatusConflict:     0,
+	StatusError:        1,
+	StatusNotForwarded: 2,
+	StatusUnsupported:  3,
+	StatusForwarded:    4,
+	StatusReady:        5,
+}
+
+// sortOrder returns the configured sort order, defaulting to name
+func (d *DisplayManager) sortOrder() SortOrder {
+	for _, order := range sortOrders {
+		if string(order) == d.config.Display.SortOrder {
+			return order
+		}
+	}
+	return SortByName
+}
+
+// cycleSortOrder advances to the next sort order and saves it as a display preference
+func (d *DisplayManager) cycleSortOrder() error {
+	current := d.sortOrder()
+	next := sortOrders[0]
+	for i, order := range sortOrders {
+		if order == current {
+			next = sortOrders[(i+1)%len(sortOrders)]
+			break
+		}
+	}
+	d.config.Display.SortOrder = string(next)
+
+	d.mu.Lock()
+	sortServices(d.currentServices, next, d.sortAscending())
+	d.mu.Unlock()
+
+	return d.config.Save()
+}
+
+// sortAscending reports whether the services are sorted in the order's own direction,
+// rather than reversed
+func (d *DisplayManager) sortAscending() bool {
+	return !d.config.Display.SortDescending
+}
+
+// reverseSortOrder flips the sort direction and saves it as a display preference
+func (d *DisplayManager) reverseSortOrder() error {
+	d.config.Display.SortDescending = !d.config.Display.SortDescending
+
+	d.mu.Lock()
+	sortServices(d.currentServices, d.sortOrder(), d.sortAscending())
+	d.mu.Unlock()
+
+	return d.config.Save()
+}
+
+// sortServices orders services in place. Ascending puts the most alarming first for state
+// orders, the fewest ports first, and the most recently started first for uptime;
+// descending reverses that. Ties are broken by name, A to Z.
+func sortServices(services []*ServiceStatus, order SortOrder, asc bool) {
+	// compare returns how a sorts against b ascending, 0 when the order doesn't tell them apart
+	compare := func(a, b *ServiceStatus) int {
+		switch order {
+		case SortByName:
+			return strings.Compare(a.Name, b.Name)
+		case SortByHealth:
+			return healthRank[a.HealthStatus] - healthRank[b.HealthStatus]
+		case SortByForward:
+			return forwardRank[a.ForwardStatus] - forwardRank[b.ForwardStatus]
+		case SortByPorts:
+			return len(a.ForwardedPorts) - len(b.ForwardedPorts)
+		case SortByUptime:
+			return b.Created.Compare(a.Created)
+		}
+		return 0
+	}
+	sort.SliceStable(services, func(i, j int) bool {
+		a, b := services[i], services[j]
+		if c := compare(a, b); c != 0 {
+			return c < 0 == asc
+		}
+		return a.Name < b.Name
+	})
+}
+
+// sortIndicator returns the arrow marking the sort direction
+func sortIndicator(asc bool) string {
+	if asc {
+		return "▲"
+	}
+	return "▼"
+}
+
+// sortColumn returns the table header the sort order applies to, if it has one
+func sortColumn(order SortOrder) string {
+	switch order {
+	case SortByName:
+		return "Service"
+	case SortByHealth:
+		return "Health"
+	case SortByForward:
+		return "Forward Status"
+	case SortByPorts:
+		return "Exposed Ports"
+	}
+	return ""
+}
+
 func (d *DisplayManager) SetMode(mode DisplayMode) {
+	// Help lists the outgoing screen's keys, which may need the lock to build
+	var helpKeys Keymap
+	if mode == ModeHelp && d.currentScreen != nil {
+		helpKeys = d.currentScreen.Keys()
+	}
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	// The outgoing screen's watcher would otherwise keep running alongside the new one
+	if d.currentScreen != nil {
+		d.currentScreen.Close()
+	}
+	// Dialogs belong to the screen they were opened over
+	for _, modal := range d.modals {
+		modal.Close()
+	}
+	d.modals = nil
+
+	previous := d.mode
+	d.mode = mode
+	d.inputBuffer = ""
+	d.rowLines = nil
 	switch mode {
 	case ModeServerList:
 		d.currentScreen = NewServerListScreen(d)
@@ -95,94 +709,780 @@ func (d *DisplayManager) SetMode(mode DisplayMode) {
 		d.currentScreen = NewLandingScreen(d, d.docker)
 	case ModeServiceDetail:
 		d.currentScreen = NewServiceDetailScreen(d, d.docker)
+	case ModeHelp:
+		d.currentScreen = NewHelpScreen(d, previous, helpKeys)
+	case ModeResolve:
+		d.currentScreen = NewResolveScreen(d, d.docker)
+	case ModeMessages:
+		// Coming back from help shouldn't make help the screen to return to
+		if previous != ModeHelp && previous != ModeMessages {
+			d.messagesReturn = previous
+		}
+		d.currentScreen = NewMessagesScreen(d, d.messagesReturn)
+	case ModeNetworkList:
+		d.currentScreen = NewNetworkListScreen(d, d.docker)
+	case ModeVolumeList:
+		d.currentScreen = NewVolumeListScreen(d, d.docker)
+	case ModeExtensions:
+		d.currentScreen = NewExtensionsScreen(d, d.plugins)
+	case ModeExtension:
+		// A plugin with nothing to show leaves the menu open
+		if screen := d.extension.NewScreen(d); screen != nil {
+			d.currentScreen = newExtensionScreen(d, screen)
+		} else {
+			d.mode = ModeExtensions
+			d.currentScreen = NewExtensionsScreen(d, d.plugins)
+		}
+	case ModeForwards:
+		d.currentScreen = NewForwardsScreen(d, d.docker)
+	}
+}
+
+// PushScreen opens a dialog over the current screen, which keeps its state underneath and
+// gets input back once the dialog is popped
+func (d *DisplayManager) PushScreen(screen Screen) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.modals = append(d.modals, screen)
+	d.inputBuffer = ""
+}
+
+// PopScreen closes the given dialog if it's the topmost one
+func (d *DisplayManager) PopScreen(screen Screen) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if n := len(d.modals); n > 0 && d.modals[n-1] == screen {
+		d.modals = d.modals[:n-1]
+		screen.Close()
+	}
+}
+
+// topModal returns the topmost dialog, or nil if none is open
+func (d *DisplayManager) topModal() Screen {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if len(d.modals) == 0 {
+		return nil
+	}
+	return d.modals[len(d.modals)-1]
+}
+
+// confirm asks before running a destructive action, which only runs on an explicit yes
+func (d *DisplayManager) confirm(question string, action func() error) {
+	d.PushScreen(NewConfirmScreen(d, question, action))
+}
+
+// SetColorizer replaces the colorizer used for all screen output
+func (d *DisplayManager) SetColorizer(colors *Colorizer) {
+	d.colors = colors
+}
+
+// SetInputHandler attaches the input handler so rendering and prompts can follow its mode
+func (d *DisplayManager) SetInputHandler(input *InputHandler) {
+	d.input = input
+}
+
+// EnableMouse asks Start to turn on terminal mouse reporting so rows can be clicked.
+// Clicks are only decoded in raw input mode.
+func (d *DisplayManager) EnableMouse() {
+	d.mouse = true
+}
+
+// Start switches to the terminal's alternate screen so the monitor doesn't clobber scrollback
+func (d *DisplayManager) Start() {
+	if !d.tty {
+		return
+	}
+	d.altScreen = true
+	fmt.Print("\033[?1049h\033[H\033[2J")
+	if d.mouse {
+		fmt.Print("\033[?1000h")
+	}
+
+	// Refit the tables whenever the terminal is resized
+	d.resized = make(chan os.Signal, 1)
+	d.resize(terminalWidth())
+	notifyResize(d.resized)
+	go func(resized <-chan os.Signal) {
+		for range resized {
+			if d.resize(terminalWidth()) {
+				d.Display()
+			}
+		}
+	}(d.resized)
+}
+
+// resize fits the next frame to a new terminal width, redrawing it in full. It reports
+// false once the display is stopped, when there's nothing to redraw.
+func (d *DisplayManager) resize(width int) bool {
+	d.renderMu.Lock()
+	defer d.renderMu.Unlock()
+	if d.resized == nil {
+		return false
 	}
+	d.width = width
+	d.lastFrame = nil
+	return true
+}
+
+// Stop restores the original screen, printing any messages that would otherwise be lost
+func (d *DisplayManager) Stop() {
+	d.renderMu.Lock()
+	defer d.renderMu.Unlock()
+
+	if d.resized != nil {
+		signal.Stop(d.resized)
+		close(d.resized)
+		d.resized = nil
+	}
+	if d.altScreen {
+		if d.mouse {
+			fmt.Print("\033[?1000l")
+		}
+		fmt.Print("\033[?1049l")
+		d.altScreen = false
+	}
+	d.msgMu.Lock()
+	defer d.msgMu.Unlock()
+	for _, msg := range d.messages.recent(messagesShown) {
+		fmt.Fprintln(os.Stderr, msg.Text)
+	}
+}
+
+// Flash shows a short-lived message in the status line, redrawing once it expires
+func (d *DisplayManager) Flash(msg string) {
+	d.msgMu.Lock()
+	defer d.msgMu.Unlock()
+
+	d.flashMsg = msg
+	if d.flashTimer != nil {
+		d.flashTimer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(flashDuration, func() {
+		d.msgMu.Lock()
+		// A newer flash has its own timer
+		if d.flashTimer != timer {
+			d.msgMu.Unlock()
+			return
+		}
+		d.flashMsg = ""
+		d.flashTimer = nil
+		d.msgMu.Unlock()
+		d.Display()
+	})
+	d.flashTimer = timer
+}
+
+// MessageWriter returns a writer for log output that collects lines into the message area
+// instead of printing them over the rendered tables
+func (d *DisplayManager) MessageWriter() io.Writer {
+	return &messageWriter{d: d}
+}
+
+type messageWriter struct {
+	d *DisplayManager
+}
+
+func (m *messageWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		m.d.Log(LevelInfo, line)
+	}
+	return len(p), nil
+}
+
+// Log adds a message to the message history, for use as the package's log hook
+func (d *DisplayManager) Log(level MessageLevel, text string) {
+	d.msgMu.Lock()
+	defer d.msgMu.Unlock()
+	d.messages.add(Message{Time: time.Now(), Level: level, Text: text})
+}
+
+// recentMessages returns up to n of the newest messages, oldest first, or all for n <= 0
+func (d *DisplayManager) recentMessages(n int) []Message {
+	d.msgMu.Lock()
+	defer d.msgMu.Unlock()
+	return d.messages.recent(n)
 }
 
 func (d *DisplayManager) Display() {
-	// Clear screen
-	fmt.Print("\033[H\033[2J")
+	d.renderMu.Lock()
+	defer d.renderMu.Unlock()
 
-	if d.currentScreen != nil {
-		d.currentScreen.Display()
+	// Background refreshes and probes render too, so read what SetMode swaps under the lock
+	d.mu.RLock()
+	screen := d.currentScreen
+	modals := append([]Screen(nil), d.modals...)
+	inputBuffer := d.inputBuffer
+	d.mu.RUnlock()
+
+	var frame bytes.Buffer
+	if screen != nil {
+		screen.Display(&frame)
+	}
+	for _, modal := range modals {
+		modal.Display(&frame)
+	}
+
+	d.msgMu.Lock()
+	if recent := d.messages.recent(messagesShown); len(recent) > 0 {
+		fmt.Fprintln(&frame, "\nMessages (m for history):")
+		for _, msg := range recent {
+			fmt.Fprintln(&frame, d.colorizeLevel(msg.Level, msg.Text))
+		}
+	}
+	if d.flashMsg != "" {
+		fmt.Fprintf(&frame, "\n%s\n", d.colors.Healthy(d.flashMsg))
+	}
+	d.msgMu.Unlock()
+
+	fmt.Fprintf(&frame, "\n%s\n", d.statusBar(time.Now()))
+
+	if d.input.Raw() {
+		if len(modals) > 0 {
+			fmt.Fprintln(&frame, "\ny - Confirm   n, Enter or Esc - Cancel")
+		} else {
+			fmt.Fprintln(&frame, "\n↑/↓ or j/k - Move selection   Enter - Select   Esc - Back   ? - Help   q - Quit")
+		}
+		fmt.Fprintf(&frame, "> %s", inputBuffer)
+	}
+
+	if bytes.Equal(frame.Bytes(), d.lastFrame) {
+		return
+	}
+	d.lastFrame = frame.Bytes()
+	for m := range d.mirrors {
+		m.w.Write(redrawSequence(d.lastFrame))
 	}
+
+	// Piped output gets each frame appended as plain text
+	if !d.tty {
+		os.Stdout.Write(append(frame.Bytes(), '\n'))
+		return
+	}
+
+	// Redraw in place, clearing each line's tail rather than the whole screen
+	newline := []byte("\033[K\n")
+	if d.input.Raw() {
+		newline = []byte("\033[K\r\n")
+	}
+	out := bytes.ReplaceAll(frame.Bytes(), []byte("\n"), newline)
+	os.Stdout.Write(append(append([]byte("\033[H"), out...), "\033[K\033[J"...))
 }
 
-func (d *DisplayManager) HandleInput(input string) bool {
-	if d.currentScreen != nil {
-		return d.currentScreen.HandleInput(input)
+// redrawSequence returns the escape sequences that draw frame over the previous one on a
+// terminal in raw mode, clearing each line's tail rather than the whole screen
+func redrawSequence(frame []byte) []byte {
+	out := bytes.ReplaceAll(frame, []byte("\n"), []byte("\033[K\r\n"))
+	return append(append([]byte("\033[H"), out...), "\033[K\033[J"...)
+}
+
+// AddMirror draws the current frame and every later one on w too, returning a func that
+// stops. Frames are written while rendering, so w shouldn't block.
+func (d *DisplayManager) AddMirror(w io.Writer) func() {
+	d.renderMu.Lock()
+	defer d.renderMu.Unlock()
+	if d.mirrors == nil {
+		d.mirrors = make(map[*mirror]bool)
+	}
+	m := &mirror{w: w}
+	d.mirrors[m] = true
+	if d.lastFrame != nil {
+		w.Write(redrawSequence(d.lastFrame))
+	}
+	return func() {
+		d.renderMu.Lock()
+		defer d.renderMu.Unlock()
+		delete(d.mirrors, m)
 	}
-	return false
 }
 
-func (d *DisplayManager) UpdateDisplay() {
+// mirror is a terminal added with AddMirror, by pointer so the same writer can be added twice
+type mirror struct {
+	w io.Writer
+}
+
+// HandleKeys handles keypresses and redraws, waiting for input from other sources to be
+// handled first
+func (d *DisplayManager) HandleKeys(keys ...Key) {
+	d.inputMu.Lock()
+	defer d.inputMu.Unlock()
+	for _, key := range keys {
+		d.HandleKey(key)
+	}
+	d.Display()
+}
+
+// HandleLine handles a command typed in line input mode and redraws, waiting for input
+// from other sources to be handled first
+func (d *DisplayManager) HandleLine(line string) {
+	d.inputMu.Lock()
+	defer d.inputMu.Unlock()
+	d.HandleInput(line)
+	d.Display()
+}
+
+// Cursor returns the highlighted row for the current screen, or -1 outside raw input mode
+func (d *DisplayManager) Cursor() int {
+	if !d.input.Raw() {
+		return -1
+	}
+	return d.cursors[d.mode]
+}
+
+// moveCursor shifts the highlighted row, keeping it within the current screen's rows
+func (d *DisplayManager) moveCursor(delta int) {
+	nav, ok := d.currentScreen.(Navigable)
+	if !ok {
+		return
+	}
+	cursor := d.cursors[d.mode] + delta
+	if rows := nav.RowCount(); cursor >= rows {
+		cursor = rows - 1
+	}
+	if cursor < 0 {
+		cursor = 0
+	}
+	d.cursors[d.mode] = cursor
+}
+
+// moveCursorTo highlights the given row, counting from the end when negative
+func (d *DisplayManager) moveCursorTo(row int) {
+	nav, ok := d.currentScreen.(Navigable)
+	if !ok {
+		return
+	}
+	if row < 0 {
+		row += nav.RowCount()
+	}
+	d.cursors[d.mode] = 0
+	d.moveCursor(row)
+}
+
+// suspendInput leaves raw mode for line-oriented prompts, returning a func that resumes it
+func (d *DisplayManager) suspendInput() func() {
+	// Prompts write below the frame, so the next render must redraw everything
+	d.renderMu.Lock()
+	d.lastFrame = nil
+	d.renderMu.Unlock()
+
+	if !d.input.Raw() {
+		return func() {}
+	}
+	// Clicks would otherwise arrive as escape sequences typed into the prompt
+	if d.mouse && d.altScreen {
+		fmt.Print("\033[?1000l")
+	}
+	fmt.Print("\r\n")
+	resume := d.input.Suspend()
+	return func() {
+		resume()
+		if d.mouse && d.altScreen {
+			fmt.Print("\033[?1000h")
+		}
+	}
+}
+
+// setRowLines records the frame lines the current screen drew its clickable rows on
+func (d *DisplayManager) setRowLines(lines []int) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	d.rowLines = lines
+}
 
-	if d.docker != nil && d.currentScreen.NeedsRefresh() {
-		services, err := d.docker.GetServices()
-		if err != nil {
-			log.Printf("Error fetching services: %v", err)
-		} else {
-			d.docker.UpdateServices(services)
-			d.UpdateServices(services)
+// rowRange returns the lines of count consecutive rows starting at first
+func rowRange(first, count int) []int {
+	lines := make([]int, count)
+	for i := range lines {
+		lines[i] = first + i
+	}
+	return lines
+}
+
+// clickedRow maps a 1-based terminal row to the row of the current screen drawn there,
+// returning -1 if the click missed every row
+func (d *DisplayManager) clickedRow(y int) int {
+	nav, ok := d.currentScreen.(Navigable)
+	if !ok {
+		return -1
+	}
+	d.mu.RLock()
+	lines := d.rowLines
+	d.mu.RUnlock()
+	// The frame is drawn from the top-left corner, so terminal row 1 is frame line 0
+	for row, line := range lines {
+		if line == y-1 && row < nav.RowCount() {
+			return row
+		}
+	}
+	return -1
+}
+
+// HandleKey processes a single keypress in raw input mode
+func (d *DisplayManager) HandleKey(key Key) bool {
+	if d.topModal() != nil {
+		return d.handleModalKey(key)
+	}
+	switch key.Type {
+	case KeyUp:
+		d.moveCursor(-1)
+		return true
+	case KeyDown:
+		d.moveCursor(1)
+		return true
+	case KeyTop:
+		if d.inputBuffer != "" {
+			// The gg chord was typed as part of a command
+			d.inputBuffer += "gg"
+			return true
+		}
+		d.moveCursorTo(0)
+		return true
+	case KeyBottom:
+		d.moveCursorTo(-1)
+		return true
+	case KeyCtrlR:
+		return d.HandleInput("redo")
+	case KeyMouse:
+		row := d.clickedRow(key.Y)
+		if row < 0 {
+			return false
 		}
+		// A click selects the row the same way as typing its number
+		d.cursors[d.mode] = row
+		d.inputBuffer = ""
+		return d.HandleInput(strconv.Itoa(row))
+	case KeyBackspace:
+		if runes := []rune(d.inputBuffer); len(runes) > 0 {
+			d.inputBuffer = string(runes[:len(runes)-1])
+		}
+		return true
+	case KeyEsc:
+		if d.inputBuffer != "" {
+			d.inputBuffer = ""
+			return true
+		}
+		return d.HandleInput("b")
+	case KeyEnter:
+		input := strings.TrimSpace(d.inputBuffer)
+		d.inputBuffer = ""
+		if input != "" {
+			return d.HandleInput(input)
+		}
+		if _, ok := d.currentScreen.(Navigable); ok {
+			return d.HandleInput(strconv.Itoa(d.cursors[d.mode]))
+		}
+		return false
+	case KeyRune:
+		if d.inputBuffer == "" {
+			// With nothing typed, letters are single-key actions
+			switch key.Rune {
+			case 'j':
+				d.moveCursor(1)
+				return true
+			case 'k':
+				d.moveCursor(-1)
+				return true
+			case 'G':
+				d.moveCursorTo(-1)
+				return true
+			}
+			if key.Rune != ' ' && (key.Rune < '0' || key.Rune > '9') {
+				return d.HandleInput(string(key.Rune))
+			}
+		}
+		if key.Rune >= ' ' {
+			d.inputBuffer += string(key.Rune)
+		}
+		return true
+	}
+	return false
+}
+
+// handleModalKey answers a dialog with a single key, leaving navigation keys to the
+// screen underneath until the dialog closes
+func (d *DisplayManager) handleModalKey(key Key) bool {
+	switch key.Type {
+	case KeyRune:
+		return d.HandleInput(string(key.Rune))
+	case KeyEnter, KeyEsc:
+		return d.HandleInput("n")
+	}
+	return false
+}
+
+// InputBuffer returns the partially typed command in raw input mode
+func (d *DisplayManager) InputBuffer() string {
+	return d.inputBuffer
+}
+
+func (d *DisplayManager) HandleInput(input string) bool {
+	// A dialog takes every command until it's answered
+	if modal := d.topModal(); modal != nil {
+		return modal.HandleInput(input)
 	}
+	if d.currentScreen != nil && d.currentScreen.HandleInput(input) {
+		return true
+	}
+	return d.globalKeys().Dispatch(input)
+}
+
+// globalKeys returns the commands available on every screen
+func (d *DisplayManager) globalKeys() Keymap {
+	return Keymap{
+		{Keys: []string{"?", "help"}, Description: "Show all keys for this screen", Action: func([]string) bool {
+			d.SetMode(ModeHelp)
+			return true
+		}},
+		{Keys: []string{"m", "messages"}, Label: "[m]essages", Description: "Show the message history", Action: func([]string) bool {
+			d.SetMode(ModeMessages)
+			return true
+		}},
+		{Keys: []string{"q", "quit"}, Label: "[q]uit", Description: "Disconnect and exit (or press Ctrl+C)", Action: func([]string) bool {
+			if d.onQuit == nil {
+				return false
+			}
+			d.onQuit()
+			return true
+		}},
+	}
+}
 
+// renderActions writes the footer listing a screen's keys followed by the global ones
+func (d *DisplayManager) renderActions(w io.Writer, keys Keymap) {
+	fmt.Fprintln(w, "\nAvailable Actions:")
+	append(keys, d.globalKeys()...).Render(w)
+}
+
+// navigationKeys describes the raw input mode keys that move the selection
+func (d *DisplayManager) navigationKeys() Keymap {
+	keys := Keymap{
+		{Label: "↑/↓ or j/k", Description: "Move selection"},
+		{Label: "gg/G", Description: "Jump to first/last row"},
+		{Label: "Enter", Description: "Select the highlighted row, or run the typed command"},
+		{Label: "Esc", Description: "Clear the typed command, or go back"},
+	}
+	if d.mouse {
+		keys = append(keys, Binding{Label: "Click", Description: "Select a row"})
+	}
+	return keys
+}
+
+// UpdateDisplay redraws the current screen, first fetching the services if it shows them
+func (d *DisplayManager) UpdateDisplay() {
+	d.mu.RLock()
+	screen := d.currentScreen
+	d.mu.RUnlock()
+
+	if screen.NeedsRefresh() {
+		d.refreshServices()
+		return
+	}
 	d.Display()
 }
 
-func (d *DisplayManager) handleKillProcess(port string) {
-	if info := d.docker.GetLocalProcessForPort(port); info != nil {
-		if err := d.docker.KillProcess(info.PID); err != nil {
-			log.Printf("Failed to kill process: %v", err)
-			return
-		}
-		if err := d.docker.RemapPort(d.selectedService, port, port); err != nil {
-			log.Printf("Failed to update port status: %v", err)
-			return
+// handleKillProcess kills the local process holding a port of the selected service and
+// forwards the port in its place
+func (d *DisplayManager) handleKillProcess(port string) error {
+	service := d.SelectedService()
+	if service == nil {
+		return nil
+	}
+	_, err := d.killPortProcess(service, port)
+	return err
+}
+
+// killPortProcess kills the local process holding a service's remote port and forwards the
+// port in its place, returning the process killed, or nil if nothing held the port
+func (d *DisplayManager) killPortProcess(service *ServiceStatus, port string) (*ProcessInfo, error) {
+	local := port
+	if p := service.Port(port); p != nil {
+		local = p.Local
+	}
+	info := d.docker.GetLocalProcessForPort(local)
+	if info == nil {
+		return nil, nil
+	}
+	if err := d.docker.KillProcess(info.PID); err != nil {
+		return nil, fmt.Errorf("Failed to kill process: %w", err)
+	}
+	if err := d.waitPortFree(local); err != nil {
+		return nil, err
+	}
+	if err := d.docker.RemapPort(service, port, local); err != nil {
+		return nil, fmt.Errorf("Failed to update port status: %v", err)
+	}
+	// Keep the service's ports on their current local ports
+	portMap := make(map[string]string)
+	for _, p := range service.ForwardedPorts {
+		portMap[p.Remote] = p.Local
+	}
+	if err := d.docker.GetClient().ForwardPorts(service, portMap); err != nil {
+		return nil, fmt.Errorf("Failed to forward port after killing process: %v", err)
+	}
+	return info, nil
+}
+
+// portFreeTimeout is how long after killing its process a port may take to be released
+var portFreeTimeout = 2 * time.Second
+
+// waitPortFree waits for nothing to listen on a local port, failing with ErrPortInUse if
+// something still does once portFreeTimeout is up, such as a replacement a supervisor started
+func (d *DisplayManager) waitPortFree(port string) error {
+	deadline := time.Now().Add(portFreeTimeout)
+	for {
+		info := d.docker.GetLocalProcessForPort(port)
+		if info == nil {
+			return nil
 		}
-		portMap := make(map[string]string)
-		if err := d.docker.GetClient().ForwardPorts(d.selectedService, portMap); err != nil {
-			log.Printf("Failed to forward port after killing process: %v", err)
-			return
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s is still held by %s (PID %s)", ErrPortInUse, port, info.Name, info.PID)
 		}
+		time.Sleep(100 * time.Millisecond)
 	}
 }
 
-func (d *DisplayManager) handleRemapPort(port, newPort string) {
+// confirmKillProcess asks before killing the process holding a port
+func (d *DisplayManager) confirmKillProcess(port string) {
+	question := fmt.Sprintf("Kill the process using local port %s?", port)
+	if info := d.docker.GetLocalProcessForPort(port); info != nil {
+		question = fmt.Sprintf("Kill %s (PID %s) using local port %s?", info.Name, info.PID, port)
+	}
+	d.confirm(question, func() error { return d.handleKillProcess(port) })
+}
+
+func (d *DisplayManager) handleRemapPort(port, newPort string) error {
+	service := d.SelectedService()
+	if service == nil {
+		return nil
+	}
+	return d.remapAndRecord(service, port, newPort)
+}
+
+// remapAndRecord remaps a service's port and records it so it can be undone
+func (d *DisplayManager) remapAndRecord(service *ServiceStatus, port, newPort string) error {
+	var oldPort string
+	if p := service.Port(port); p != nil {
+		oldPort = p.Local
+	}
+	if err := d.remapPort(service, port, newPort); err != nil {
+		return err
+	}
+	d.recordRemap(PortRemapAction{Service: service.Name, RemotePort: port, OldPort: oldPort, NewPort: newPort})
+	return nil
+}
+
+// confirmRemapPort asks before moving a port's forward to a new local port
+func (d *DisplayManager) confirmRemapPort(port, newPort string) {
+	service := d.SelectedService()
+	if service == nil {
+		return
+	}
+	oldPort := port
+	if p := service.Port(port); p != nil {
+		oldPort = p.Local
+	}
+	question := fmt.Sprintf("Remap %s port %s from local port %s to %s?", service.Name, port, oldPort, newPort)
+	d.confirm(question, func() error { return d.handleRemapPort(port, newPort) })
+}
+
+// remapPort points a service's remote port at a new local port and restarts its forward
+func (d *DisplayManager) remapPort(service *ServiceStatus, port, newPort string) error {
 	localPorts, err := GetLocalInUsePorts()
 	if err != nil {
-		log.Printf("Failed to get local ports: %v", err)
-		return
+		return fmt.Errorf("failed to get local ports: %v", err)
 	}
 	if IsPortInUse(newPort, localPorts) {
-		log.Printf("New port %s is already in use", newPort)
+		return fmt.Errorf("%w: %s", ErrPortInUse, newPort)
+	}
+	if err := d.docker.RemapPort(service, port, newPort); err != nil {
+		return fmt.Errorf("failed to update port status: %w", err)
+	}
+	// Keep the service's other ports on their current local ports
+	portMap := make(map[string]string)
+	for _, p := range service.ForwardedPorts {
+		portMap[p.Remote] = p.Local
+	}
+	if err := d.docker.GetClient().ForwardPorts(service, portMap); err != nil {
+		return fmt.Errorf("failed to forward remapped port: %v", err)
+	}
+	return nil
+}
+
+// copyLocalAddress puts the local URL, or localhost:port, of a forwarded port on the clipboard
+func (d *DisplayManager) copyLocalAddress(port *ForwardedPort) {
+	if port == nil {
 		return
 	}
-	if err := d.docker.RemapPort(d.selectedService, port, newPort); err != nil {
-		log.Printf("Failed to update port status: %v", err)
+	addr := port.LocalAddress()
+	if err := clipboardWriteAll(addr); err != nil {
+		// Without pbcopy, xclip, xsel or wl-copy, show the address so it can be copied by hand
+		logError("Failed to copy %s to clipboard: %v", addr, err)
+		d.Flash(fmt.Sprintf("No clipboard available, address: %s", addr))
 		return
 	}
-	portMap := make(map[string]string)
-	portMap[port] = newPort
-	if err := d.docker.GetClient().ForwardPorts(d.selectedService, portMap); err != nil {
-		log.Printf("Failed to forward remapped port: %v", err)
+	d.Flash(fmt.Sprintf("Copied! %s", addr))
+}
+
+// browserCommand builds the process that opens a URL in the default browser, replaced in tests
+var browserCommand = defaultBrowserCommand
+
+func defaultBrowserCommand(url string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url)
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	}
+	return exec.Command("xdg-open", url)
+}
+
+// openLocalURL opens an HTTP port's local URL in the default browser
+func (d *DisplayManager) openLocalURL(port *ForwardedPort) {
+	if port == nil {
+		return
+	}
+	if port.Scheme() == "" {
+		logWarn("Port %s doesn't look like HTTP, use copy to get localhost:%s instead", port.Remote, port.Local)
+		return
+	}
+	url := port.LocalAddress()
+	cmd := browserCommand(url)
+	if err := cmd.Start(); err != nil {
+		logError("Failed to open %s: %v", url, err)
 		return
 	}
+	// Reap the launcher, which exits once the browser has the URL
+	go cmd.Wait()
+	d.Flash(fmt.Sprintf("Opened %s", url))
 }
 
-// displayServicesTable renders a single table of services
-func (d *DisplayManager) displayServicesTable(services []*ServiceStatus, showPorts bool) {
-	table := tablewriter.NewWriter(os.Stdout)
+// displayServicesTable renders a single table of services. With ports shown, rows are
+// numbered from first and the row numbered cursor is highlighted.
+func (d *DisplayManager) displayServicesTable(w io.Writer, services []*ServiceStatus, showPorts bool, first, cursor int) {
+	services = d.snapshot(services...)
+	table := tablewriter.NewWriter(w)
 	
-	// Set headers
+	// Set headers, with the priority each column keeps its width on narrow terminals
 	headers := []string{}
+	priority := []int{}
 	if showPorts {
 		headers = append(headers, "#")
+		priority = append(priority, priorityHigh)
 	}
 	headers = append(headers, "Service", "Health")
+	priority = append(priority, priorityHigh, priorityMedium)
 	if showPorts {
 		headers = append(headers, "Exposed Ports", "Forward Status", "Conflicts")
+		priority = append(priority, priorityHigh, priorityMedium, priorityLow)
+	}
+
+	// Mark the column the rows are sorted by
+	sorted := sortColumn(d.sortOrder())
+	for i, header := range headers {
+		if header == sorted {
+			headers[i] = header + " " + sortIndicator(d.sortAscending())
+		}
 	}
 	table.SetHeader(headers)
 
@@ -198,45 +1498,99 @@ func (d *DisplayManager) displayServicesTable(services []*ServiceStatus, showPor
 	table.SetBorder(true)
 
 	// Add rows
+	var rows [][]string
+	names := displayNames(services)
 	for i, service := range services {
+		number := first + i
 		row := []string{}
 		if showPorts {
-			row = append(row, fmt.Sprintf("%d", i))
+			row = append(row, d.highlight(fmt.Sprintf("%d", number), number == cursor))
+		}
+
+		// The full name shows on the service's detail screen
+		name := truncateName(names[i], serviceNameWidth(d.width))
+		if d.pinned(service.Name) {
+			name = pinMark + name
+		}
+		if service.HealthStatus == HealthMissing {
+			name = d.colors.Muted(name)
 		}
-		
 		row = append(row,
-			service.Name,
+			d.highlight(name, number == cursor),
 			d.colorizeHealth(service.HealthStatus),
 		)
 
 		if showPorts {
 			conflicts := "None"
-			if len(service.Conflicts) > 0 {
-				conflicts = ColorRed + strings.Join(service.Conflicts, ", ") + ColorReset
+			var labels []string
+			for _, port := range service.ForwardedPorts {
+				if port.Status == StatusConflict {
+					labels = append(labels, conflictLabel(port))
+				}
+			}
+			if len(labels) > 0 {
+				conflicts = d.colors.Unhealthy(strings.Join(labels, ", "))
 			}
 
 			row = append(row,
-				strings.Join(service.ExposedPorts, ", "),
+				strings.Join(service.PortLabels(), ", "),
 				d.colorizeStatus(service.ForwardStatus),
 				conflicts,
 			)
 		}
 
-		table.Append(row)
+		rows = append(rows, row)
 	}
+	d.appendFitted(table, headers, rows, priority)
 
 	table.Render()
 }
 
+// displayNames returns the names the services are listed under: the Compose service name
+// for a Compose container, such as web for myproject-web-1, unless another of services
+// would be listed the same, as a scaled service's replicas are; the container name otherwise
+func displayNames(services []*ServiceStatus) []string {
+	names := make([]string, len(services))
+	counts := make(map[string]int)
+	for i, service := range services {
+		names[i] = service.Name
+		if service.ComposeService != "" {
+			names[i] = service.ComposeService
+		}
+		counts[names[i]]++
+	}
+	for i, service := range services {
+		if counts[names[i]] > 1 {
+			names[i] = service.Name
+		}
+	}
+	return names
+}
+
+// pinMark starts the names of pinned services
+const pinMark = "★ "
+
+// conflictLabel names a conflicted port and the process holding it, e.g. "5432 (postgres, pid 812)",
+// or just the port when the process isn't known
+func conflictLabel(port ForwardedPort) string {
+	info := port.ConflictInfo
+	if info == nil || info.PID == "" {
+		return port.Remote
+	}
+	return fmt.Sprintf("%s (%s, pid %s)", port.Remote, truncateString(info.Name, 16), info.PID)
+}
+
 // colorizeHealth returns health status with appropriate color
 func (d *DisplayManager) colorizeHealth(health string) string {
 	switch health {
 	case HealthHealthy, HealthRunning:
-		return ColorGreen + health + ColorReset
+		return d.colors.Healthy(health)
 	case HealthUnhealthy, HealthDead:
-		return ColorRed + health + ColorReset
+		return d.colors.Unhealthy(health)
 	case HealthStarting, HealthRestarting:
-		return ColorYellow + health + ColorReset
+		return d.colors.Warning(health)
+	case HealthMissing:
+		return d.colors.Muted(health)
 	default:
 		return health
 	}
@@ -246,31 +1600,92 @@ func (d *DisplayManager) colorizeHealth(health string) string {
 func (d *DisplayManager) colorizeStatus(status string) string {
 	switch status {
 	case StatusForwarded:
-		return ColorGreen + status + ColorReset
+		return d.colors.Healthy(status)
 	case StatusConflict, StatusError:
-		return ColorRed + status + ColorReset
+		return d.colors.Unhealthy(status)
 	case StatusReady:
-		return ColorGreen + status + ColorReset
+		return d.colors.Healthy(status)
+	case StatusUnsupported:
+		return d.colors.Warning(status)
 	default:
 		return status
 	}
 }
 
+// colorizeLevel colors s by the severity of a message level
+func (d *DisplayManager) colorizeLevel(level MessageLevel, s string) string {
+	switch level {
+	case LevelError:
+		return d.colors.Unhealthy(s)
+	case LevelWarn:
+		return d.colors.Warning(s)
+	case LevelDebug:
+		return d.colors.Muted(s)
+	}
+	return s
+}
+
+// colorizeReachability returns a server's reachability with appropriate color
+func (d *DisplayManager) colorizeReachability(state string) string {
+	switch state {
+	case ReachabilityReachable:
+		return d.colors.Healthy(state)
+	case ReachabilityUnreachable:
+		return d.colors.Unhealthy(state)
+	case ReachabilityChecking:
+		return d.colors.Warning(state)
+	default:
+		return "-"
+	}
+}
+
 // Helper functions
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
+func (d *DisplayManager) highlight(s string, selected bool) string {
+	if !selected {
 		return s
 	}
-	return s[:maxLen-3] + "..."
+	return d.colors.Highlight(s)
 }
 
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
+// bellWriter writes to the terminal between frames, so a bell can't split an escape sequence
+type bellWriter struct {
+	d *DisplayManager
+}
+
+func (b *bellWriter) Write(p []byte) (int, error) {
+	if !b.d.tty {
+		return len(p), nil
 	}
-	return false
+	b.d.renderMu.Lock()
+	defer b.d.renderMu.Unlock()
+	return os.Stdout.Write(p)
+}
+
+// lineCounter counts the lines written through it, so screens can tell where a row lands
+type lineCounter struct {
+	w     io.Writer
+	lines int
+}
+
+func (l *lineCounter) Write(p []byte) (int, error) {
+	l.lines += bytes.Count(p, []byte("\n"))
+	return l.w.Write(p)
+}
+
+// tableHeaderLines is the number of lines a bordered table prints before its first row
+const tableHeaderLines = 3
+
+// truncateString shortens s to maxLen characters, ending in "..." when it's cut and there's
+// room for more than the dots. Multi-byte characters are never split.
+func truncateString(s string, maxLen int) string {
+	runes := []rune(s)
+	if len(runes) <= maxLen {
+		return s
+	}
+	if maxLen <= 3 {
+		return string(runes[:max(maxLen, 0)])
+	}
+	return string(runes[:maxLen-3]) + "..."
 }
 
 // parseIndex attempts to parse a string as a service index
@@ -308,7 +1723,10 @@ func readInput(reader *bufio.Reader, prompt string, required bool, defaultValue
 	return value, nil
 }
 
-// handleAddServer prompts for new server details
+// serverCheckTimeout bounds each step of checking a server as it's added
+const serverCheckTimeout = 10 * time.Second
+
+// handleAddServer prompts for new server details, checking them against the server
 func (d *DisplayManager) handleAddServer() error {
 	reader := bufio.NewReader(os.Stdin)
 
@@ -332,14 +1750,61 @@ func (d *DisplayManager) handleAddServer() error {
 		return fmt.Errorf("error reading SSH key path: %v", err)
 	}
 
+	// Show the host key to accept before trusting the server with anything, then check the
+	// login and docker work so typos surface now rather than on the first connect
+	ctx, cancel := context.WithTimeout(context.Background(), serverCheckTimeout)
+	hostKey, err := FetchHostKey(ctx, host)
+	cancel()
+	if err != nil {
+		fmt.Printf("Failed to reach %s: %v\n", host, err)
+		if !confirmInput(reader, "Save the server anyway? [y/N]: ") {
+			return fmt.Errorf("server not added")
+		}
+	} else {
+		fmt.Printf("Host key fingerprint: %s (%s)\n", ssh.FingerprintSHA256(hostKey), hostKey.Type())
+		if !confirmInput(reader, "Trust this key? [y/N]: ") {
+			return fmt.Errorf("host key not trusted, server not added")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), serverCheckTimeout)
+		version, err := CheckServer(ctx, ServerConfig{Name: name, Host: host, User: user, KeyPath: keyPath}, hostKey)
+		cancel()
+		if err != nil {
+			fmt.Printf("Check failed: %v\n", err)
+			if hint := ErrorHint(err); hint != "" {
+				fmt.Println(hint)
+			}
+			if !confirmInput(reader, "Save the server anyway? [y/N]: ") {
+				return fmt.Errorf("server not added")
+			}
+		} else {
+			fmt.Printf("Logged in as %s, Docker %s is running\n", user, version)
+		}
+	}
+
 	if err := d.config.AddServer(name, host, user, keyPath); err != nil {
 		return fmt.Errorf("failed to add server: %v", err)
 	}
+	if hostKey != nil {
+		path, err := GetKnownHostsPath()
+		if err == nil {
+			err = RecordHostKey(path, host, hostKey)
+		}
+		if err != nil {
+			logWarn("Failed to record %s's host key: %v", name, err)
+		}
+	}
 
 	fmt.Printf("Server '%s' added successfully\n", name)
 	return nil
 }
 
+// confirmInput asks prompt and reports whether the answer is yes
+func confirmInput(reader *bufio.Reader, prompt string) bool {
+	answer, err := readInput(reader, prompt, false, "")
+	answer = strings.ToLower(answer)
+	return err == nil && (answer == "y" || answer == "yes")
+}
+
 // handleRemoveServer prompts for server index to remove
 func (d *DisplayManager) handleRemoveServer() error {
 	reader := bufio.NewReader(os.Stdin)
@@ -355,16 +1820,13 @@ func (d *DisplayManager) handleRemoveServer() error {
 	}
 
 	serverName := d.config.Servers[index].Name
-	fmt.Printf("Are you sure you want to remove server '%s'? (y/N): ", serverName)
-	confirm, _ := reader.ReadString('\n')
-	if strings.ToLower(strings.TrimSpace(confirm)) != "y" {
-		return fmt.Errorf("server removal cancelled")
-	}
-
-	if err := d.config.RemoveServer(serverName); err != nil {
-		return fmt.Errorf("failed to remove server: %v", err)
-	}
-	fmt.Printf("Server '%s' (index %d) removed successfully\n", serverName, index)
+	d.confirm(fmt.Sprintf("Remove server '%s'?", serverName), func() error {
+		if err := d.config.RemoveServer(serverName); err != nil {
+			return fmt.Errorf("failed to remove server: %v", err)
+		}
+		logInfo("Server '%s' removed", serverName)
+		return nil
+	})
 	return nil
 }
 
@@ -1,40 +1,124 @@
 package pkg
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"log"
+	"math/rand/v2"
 	"net"
 	"net/http"
-	"os/exec"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// socketDialer opens connections on the remote host, satisfied by *ssh.Client
+type socketDialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// ContainerAPI is what the display and its screens need from a server's containers: listing
+// and inspecting them, watching for changes and managing their forwards. *DockerClient talks
+// to a real daemon; tests provide their own, such as testutil.FakeDocker.
+type ContainerAPI interface {
+	GetClient() Tunneler
+	Close() error
+
+	GetServices() (map[string]*ServiceStatus, error)
+	InspectServices() (map[string]*ServiceStatus, error)
+	RefreshContainer(id, name string) error
+	WatchEvents(ctx context.Context) (<-chan DockerEvent, error)
+	Services() map[string]*ServiceStatus
+	ViewServices(fn func(services map[string]*ServiceStatus))
+	GetService(name string) *ServiceStatus
+	GetServicesByPortStatus() (withPorts, withoutPorts []*ServiceStatus, err error)
+	UpdateServices(services map[string]*ServiceStatus)
+	UpdateForwardingStatus() error
+
+	StartForward(serviceName, remotePort, localPort string) (ForwardedPort, error)
+	StopForward(serviceName, remotePort string) error
+	ListForwards() []ForwardInfo
+	RemapPort(service *ServiceStatus, remotePort, localPort string) error
+	GetLocalProcessForPort(port string) *ProcessInfo
+	KillProcess(pid string) error
+
+	GetNetworks() ([]*NetworkInfo, error)
+	GetVolumes() ([]*VolumeInfo, error)
+	RemoveVolume(name string) error
+	PruneVolumes() (*VolumePruneReport, error)
+	GetHostResources(ctx context.Context) (*HostResources, error)
+
+	Filters() map[string][]string
+	SetFilters(filters map[string][]string)
+	SetNotifier(notifier *Notifier)
+	SetEventLogger(events *EventLogger)
+	SetAlerter(alerter *Alerter)
+	SetRetry(attempts int, delay time.Duration)
+	ReadOnly() bool
+	SetReadOnly(readOnly bool)
+}
+
+var _ ContainerAPI = (*DockerClient)(nil)
+
 // DockerClient handles Docker API communication
 type DockerClient struct {
-	sshClient *SSHClient
+	sshClient Tunneler
+	dialer    socketDialer
 	listener  net.Listener
 	apiPort   int
 	services  map[string]*ServiceStatus
 	portMappings map[string]map[string]string // service name -> remote port -> local port
+	snapshot  map[string]serviceSnapshot // State at the last update, nil before the first
+	processes map[string]*ProcessInfo    // Process holding each conflicted local port, kept while it stays taken
+	ctx       context.Context            // Cancelled by Close, aborting in-flight Docker API requests
+	cancel    context.CancelFunc
+	timeout   time.Duration // Limit on each Docker API request, 0 for none
+	retryAttempts int           // Tries per Docker API request before its failure is returned
+	retryDelay    time.Duration // Wait before the first retry, doubling for each one after
+	filters   map[string][]string // Docker API filters narrowing every listing, nil for all containers
+	stopped   sync.Map            // forwardKey of each forward stopped on request, which refreshes leave alone
+	readOnly  atomic.Bool         // Set while another monitor forwards this server, so nothing is forwarded
+	swarm     atomic.Bool         // Set on a swarm manager, whose services are listed instead of containers
+	socket    string              // Remote Docker socket, or tcp:// address, resolved by Start
+	runner    commandRunner       // Runs the socket search's commands, nil to run them over sshClient
+	notifier  *Notifier
+	events    *EventLogger
+	alerter   *Alerter
+	webhook   *Webhook // Where the server's health transitions are posted, nil for nowhere
+	tlsConfig *tls.Config     // Client certificate the Docker API requires, nil for plain HTTP
+	transport *http.Transport // Carries Docker API requests over TLS, nil for the default
+	name      string   // Configured name of the server, set by Connect
 	mu        sync.RWMutex
 }
 
-// NewDockerClient creates a new Docker client that communicates via SSH
-func NewDockerClient(sshClient *SSHClient) (*DockerClient, error) {
+// NewDockerClient creates a new Docker client that reaches the server through tunnel, an
+// *SSHClient unless testing or using another backend, giving up on Docker API requests that
+// take longer than timeout
+func NewDockerClient(tunnel Tunneler, timeout time.Duration) (*DockerClient, error) {
 	// Create local listener for Docker API forwarding
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create local listener: %v", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &DockerClient{
-		sshClient: sshClient,
+		ctx:       ctx,
+		cancel:    cancel,
+		timeout:   timeout,
+		retryAttempts: defaultRetryAttempts,
+		retryDelay:    defaultRetryDelay,
+		sshClient: tunnel,
+		dialer:    tunnel,
 		listener:  listener,
 		apiPort:   listener.Addr().(*net.TCPAddr).Port,
 		services:  make(map[string]*ServiceStatus),
@@ -42,21 +126,92 @@ func NewDockerClient(sshClient *SSHClient) (*DockerClient, error) {
 	}, nil
 }
 
-// Start initializes the Docker API connection
+// Connect opens an SSH connection to server and starts forwarding its Docker API
+func Connect(server *ServerConfig) (*DockerClient, error) {
+	return ConnectContext(context.Background(), server)
+}
+
+// ConnectContext is Connect, giving up once ctx is done
+func ConnectContext(ctx context.Context, server *ServerConfig) (*DockerClient, error) {
+	sshClient, err := NewSSHClientContext(ctx, server.User, server.Host, server.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating SSH client: %w", err)
+	}
+	dockerClient, err := NewDockerClient(sshClient, server.DialTimeout())
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("error creating Docker client: %v", err)
+	}
+	dockerClient.name = server.Name
+	dockerClient.webhook = NewWebhook(server.WebhookURL, server.WebhookSecret)
+	tlsConfig, err := server.DockerTLSConfig()
+	if err != nil {
+		dockerClient.Close()
+		sshClient.Close()
+		return nil, err
+	}
+	if tlsConfig != nil {
+		dockerClient.UseTLS(tlsConfig)
+	}
+	if server.UseWSL2 {
+		if err := dockerClient.UseWSL2(server.WSL2Distro); err != nil {
+			dockerClient.Close()
+			sshClient.Close()
+			return nil, err
+		}
+	}
+	dockerClient.StartContext(ctx)
+	dockerClient.DetectSwarmContext(ctx)
+	if err := ctx.Err(); err != nil {
+		dockerClient.Close()
+		sshClient.Close()
+		return nil, fmt.Errorf("error connecting: %v", err)
+	}
+	return dockerClient, nil
+}
+
+// Start finds the remote Docker socket and initializes the Docker API connection. If no
+// socket answers, the system socket is used so the first request reports the problem.
 func (d *DockerClient) Start() {
+	d.StartContext(context.Background())
+}
+
+// StartContext is Start, giving up the search for the Docker socket once ctx is done
+func (d *DockerClient) StartContext(ctx context.Context) {
+	d.socket = defaultDockerSocket
+	if d.tlsConfig != nil {
+		d.socket = defaultTLSEndpoint
+	}
+	// Only a tunnel that runs commands, as SSH does, can search for the socket
+	runner, _ := d.sshClient.(commandRunner)
+	if d.runner != nil {
+		runner = d.runner
+	}
+	if runner != nil {
+		socket, err := resolveDockerSocket(ctx, runner, d.dialer, d.tlsConfig)
+		if err != nil {
+			logAttrs(LevelWarn, "Failed to find the Docker socket", "server", d.server(), "err", err)
+		}
+		if socket != "" {
+			d.socket = socket
+		}
+	}
+
 	// Forward local port to Docker socket
 	go func() {
 		for {
 			local, err := d.listener.Accept()
 			if err != nil {
-				log.Printf("Failed to accept connection: %v", err)
+				if !errors.Is(err, net.ErrClosed) {
+					logAttrs(LevelError, "Failed to accept Docker API connection", "server", d.server(), "err", err)
+				}
 				return
 			}
 
-			remote, err := d.sshClient.GetClient().Dial("unix", "/var/run/docker.sock")
+			remote, err := dialDocker(d.dialer, d.socket)
 			if err != nil {
-				log.Printf("Failed to connect to Docker socket: %v", err)
-				local.Close()
+				logAttrs(LevelError, "Failed to connect to Docker socket", "server", d.server(), "err", err)
+				go d.refuseAPIConnection(local, err)
 				continue
 			}
 
@@ -69,99 +224,601 @@ func (d *DockerClient) Start() {
 		}
 	}()
 
-	log.Println("Docker API connection initialized")
+	logAttrs(LevelInfo, "Docker API connection initialized", "server", d.server(), "api_port", d.apiPort, "socket", d.socket)
+}
+
+// The proxy marks its own answers with proxyErrorHeader, so they aren't taken for Docker's
+const (
+	proxyErrorHeader       = "X-Dockforward-Error"
+	proxyDaemonUnavailable = "daemon-unavailable"
+	proxyHostUnreachable   = "host-unreachable"
+)
+
+// refuseAPIConnection answers the request on a Docker API connection the socket couldn't be
+// dialed for with a 503 saying why, rather than dropping it for the caller to see as EOF
+func (d *DockerClient) refuseAPIConnection(local net.Conn, dialErr error) {
+	defer local.Close()
+	local.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := http.ReadRequest(bufio.NewReader(local)); err != nil {
+		return
+	}
+
+	reason := proxyDaemonUnavailable
+	if d.sshClient != nil && !d.sshClient.Connected() {
+		reason = proxyHostUnreachable
+	}
+	body, _ := json.Marshal(map[string]string{"message": fmt.Sprintf("failed to connect to Docker socket %s: %v", d.socket, dialErr)})
+	resp := &http.Response{
+		StatusCode:    http.StatusServiceUnavailable,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}, proxyErrorHeader: {reason}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Close:         true,
+	}
+	resp.Write(local)
+}
+
+// server returns the user@host the client is connected to, for log messages
+func (d *DockerClient) server() string {
+	if d.sshClient == nil {
+		return ""
+	}
+	return d.sshClient.Target()
 }
 
-// Close closes the Docker client
+// Close stops accepting Docker API connections and aborts requests still in flight
 func (d *DockerClient) Close() error {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	if d.listener == nil {
+		return nil
+	}
 	return d.listener.Close()
 }
 
-// GetServices retrieves and processes Docker container information
-func (d *DockerClient) GetServices() (map[string]*ServiceStatus, error) {
-	// Query Docker API
-	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/containers/json", d.apiPort))
+// requestContext returns the context Docker API requests run in, done once the client is closed
+func (d *DockerClient) requestContext() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// requestContextFor returns a context done once ctx is or the client is closed, and the
+// func releasing it
+func (d *DockerClient) requestContextFor(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(d.requestContext(), cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// apiRequest sends a Docker API request, decoding the response into out if it's set, and
+// failing with Docker's message if the request is refused. It's abandoned once ctx is done
+// or the client is closed.
+func (d *DockerClient) apiRequest(ctx context.Context, method, path string, out any) error {
+	ctx, release := d.requestContextFor(ctx)
+	defer release()
+	req, err := http.NewRequestWithContext(ctx, method, d.apiURL(path), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query Docker API: %v", err)
+		return fmt.Errorf("failed to create Docker API request: %v", err)
+	}
+	resp, err := d.retryDo(req, d.retryAttempts, d.retryDelay)
+	if err != nil {
+		return fmt.Errorf("failed to query Docker API: %v", err)
 	}
 	defer resp.Body.Close()
 
-	var containers []Container
-	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
-		return nil, fmt.Errorf("failed to decode Docker API response: %v", err)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return responseError(resp)
 	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode Docker API response: %v", err)
+	}
+	return nil
+}
 
-	services := make(map[string]*ServiceStatus)
+// SetRetry sets how many times each Docker API request is tried, and the wait before the
+// first retry, before its failure is returned
+func (d *DockerClient) SetRetry(attempts int, delay time.Duration) {
+	d.retryAttempts, d.retryDelay = attempts, delay
+}
 
-	for _, container := range containers {
-		name := strings.TrimPrefix(container.Names[0], "/")
-		ports := d.extractPorts(container.Ports)
-		health := d.parseContainerState(container.State, container.Status)
-
-		service := &ServiceStatus{
-			Name:          name,
-			ExposedPorts:  ports,
-			HealthStatus:  health,
-			ForwardStatus: StatusNotForwarded,
+// retryDo sends req up to maxAttempts times while it fails transiently: the connection
+// failing, or a 5xx from Docker or from the proxy when the tunnel hiccups. Retries wait
+// delay with jitter, doubling each time. Requests other than GET and HEAD are only retried
+// when they can't have reached Docker, so nothing is done twice.
+func (d *DockerClient) retryDo(req *http.Request, maxAttempts int, delay time.Duration) (*http.Response, error) {
+	client := d.httpClient(d.timeout)
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt >= maxAttempts || req.Context().Err() != nil || !retryable(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		wait := delay << (attempt - 1)
+		wait = wait/2 + rand.N(wait/2+1)
+		logDebug("Retrying Docker API request", "server", d.server(), "path", req.URL.Path, "attempt", attempt, "wait", wait, "err", err)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
 		}
+	}
+}
+
+// retryable reports whether a Docker API request that got resp or err is worth sending again
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if resp != nil && resp.Header.Get(proxyErrorHeader) != "" {
+		return true
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	return err != nil || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// responseError returns the error a failed Docker API response carries, wrapping
+// ErrDaemonUnavailable or ErrHostUnreachable when the proxy couldn't reach the socket
+func responseError(resp *http.Response) error {
+	var failure struct {
+		Message string `json:"message"`
+	}
+	message := fmt.Sprintf("Docker API returned %s", resp.Status)
+	if json.NewDecoder(resp.Body).Decode(&failure) == nil && failure.Message != "" {
+		message = failure.Message
+	}
+	switch resp.Header.Get(proxyErrorHeader) {
+	case proxyHostUnreachable:
+		return fmt.Errorf("%w: %s", ErrHostUnreachable, message)
+	case proxyDaemonUnavailable:
+		return fmt.Errorf("%w: %s", ErrDaemonUnavailable, message)
+	}
+	return errors.New(message)
+}
 
-		services[name] = service
+// GetServices retrieves and processes Docker container information, narrowed by the
+// client's filters
+func (d *DockerClient) GetServices() (map[string]*ServiceStatus, error) {
+	return d.GetServicesContext(context.Background())
+}
 
-		// Attempt to forward ports
-		if err := d.forwardPorts(service); err != nil {
-			log.Printf("Failed to forward ports for %s: %v", name, err)
-		}
+// GetServicesContext is GetServices, abandoning the listing once ctx is done
+func (d *DockerClient) GetServicesContext(ctx context.Context) (map[string]*ServiceStatus, error) {
+	return d.BatchGetServicesContext(ctx, d.Filters())
+}
+
+// BatchGetServices fetches the containers matching filters in a single Docker API call and
+// starts forwarding their ports, replacing the services known so far. Filters use the Docker
+// API's syntax, e.g. {"label": {"com.docker.compose.project=myapp"}}; nil matches everything.
+func (d *DockerClient) BatchGetServices(filters map[string][]string) (map[string]*ServiceStatus, error) {
+	return d.BatchGetServicesContext(context.Background(), filters)
+}
+
+// BatchGetServicesContext is BatchGetServices, abandoning the listing once ctx is done. The
+// forwards started outlive ctx, lasting until they're stopped or the client is closed.
+func (d *DockerClient) BatchGetServicesContext(ctx context.Context, filters map[string][]string) (map[string]*ServiceStatus, error) {
+	listed, err := d.listServices(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]*ServiceStatus)
+	for _, service := range listed {
+		d.startForwarding(service)
+		services[service.Name] = service
+	}
+
+	// Check for conflicts before storing, so transitions are detected on complete state
+	if err := d.updateForwardingStatus(services); err != nil {
+		logAttrs(LevelError, "Failed to update forwarding status", "server", d.server(), "err", err)
 	}
 
 	// Update the internal services map
 	d.UpdateServices(services)
 
-	// Update forwarding status to check for conflicts
-	if err := d.UpdateForwardingStatus(); err != nil {
-		log.Printf("Failed to update forwarding status: %v", err)
+	return services, nil
+}
+
+// SetFilters narrows the containers later refreshes fetch; nil fetches them all
+func (d *DockerClient) SetFilters(filters map[string][]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.filters = filters
+}
+
+// Filters returns the filters refreshes are narrowed by
+func (d *DockerClient) Filters() map[string][]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.filters
+}
+
+// ParseFilters turns key=value expressions, as given to `docker ps --filter`, into Docker API
+// filters; label=com.docker.compose.project=myapp keeps one Compose project's containers
+func ParseFilters(exprs []string) (map[string][]string, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	filters := make(map[string][]string)
+	for _, expr := range exprs {
+		key, value, ok := strings.Cut(expr, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid filter %q, expected key=value such as label=com.docker.compose.project=myapp", expr)
+		}
+		filters[key] = append(filters[key], value)
+	}
+	return filters, nil
+}
+
+// FormatFilters renders filters the way ParseFilters reads them, sorted for a stable display
+func FormatFilters(filters map[string][]string) string {
+	var exprs []string
+	for key, values := range filters {
+		for _, value := range values {
+			exprs = append(exprs, key+"="+value)
+		}
+	}
+	sort.Strings(exprs)
+	return strings.Join(exprs, " ")
+}
+
+// listContainers queries the Docker API for running containers, narrowed by filters if given
+func (d *DockerClient) listContainers(ctx context.Context, filters map[string][]string) ([]Container, error) {
+	path := "/containers/json"
+	if len(filters) > 0 {
+		encoded, err := json.Marshal(filters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode filters: %v", err)
+		}
+		path += "?filters=" + url.QueryEscape(string(encoded))
+	}
+
+	// Query Docker API
+	logDebug("Listing containers", "server", d.server(), "filters", FormatFilters(filters))
+	var containers []Container
+	if err := d.apiRequest(ctx, http.MethodGet, path, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// listServices lists the services matching filters without forwarding anything: the swarm
+// services on a swarm manager, and the running containers otherwise
+func (d *DockerClient) listServices(ctx context.Context, filters map[string][]string) ([]*ServiceStatus, error) {
+	if d.swarm.Load() {
+		swarmServices, err := d.listSwarmServices(ctx, filters)
+		if err != nil {
+			return nil, err
+		}
+		services := make([]*ServiceStatus, 0, len(swarmServices))
+		for _, swarmService := range swarmServices {
+			services = append(services, d.serviceFromSwarm(swarmService))
+		}
+		return services, nil
+	}
+
+	containers, err := d.listContainers(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	services := make([]*ServiceStatus, 0, len(containers))
+	for _, container := range containers {
+		services = append(services, d.serviceFromContainer(container))
 	}
+	return services, nil
+}
+
+// newService builds a service from a container and starts forwarding its ports
+func (d *DockerClient) newService(container Container) *ServiceStatus {
+	service := d.serviceFromContainer(container)
+	d.startForwarding(service)
+	return service
+}
+
+// startForwarding attempts to forward a service's ports, logging any failure
+func (d *DockerClient) startForwarding(service *ServiceStatus) {
+	if err := d.forwardPorts(service); err != nil {
+		logAttrs(LevelError, "Failed to forward ports", "server", d.server(), "service", service.Name, "err", err)
+	}
+}
+
+// serviceFromContainer builds a service from a container without forwarding anything
+func (d *DockerClient) serviceFromContainer(container Container) *ServiceStatus {
+	name := strings.TrimPrefix(container.Names[0], "/")
+	ports := d.extractPorts(container.Ports)
+	health := d.parseContainerState(container.State, container.Status)
+
+	// Carry over any remapped local ports from earlier refreshes
+	for i := range ports {
+		ports[i].Local = d.GetPortMapping(name, ports[i].Remote)
+	}
+
+	return &ServiceStatus{
+		Name:           name,
+		Image:          container.Image,
+		ForwardedPorts: ports,
+		HealthStatus:   health,
+		ForwardStatus:  StatusNotForwarded,
+		Created:        time.Unix(container.Created, 0),
+		Project:        container.Labels[ComposeProjectLabel],
+		ComposeService: container.Labels[ComposeServiceLabel],
+	}
+}
+
+// InspectServices fetches services like GetServices but leaves their ports unforwarded,
+// only checking whether each local port is free
+func (d *DockerClient) InspectServices() (map[string]*ServiceStatus, error) {
+	return d.InspectServicesContext(context.Background())
+}
 
+// InspectServicesContext is InspectServices, abandoning the listing once ctx is done
+func (d *DockerClient) InspectServicesContext(ctx context.Context) (map[string]*ServiceStatus, error) {
+	listed, err := d.listServices(ctx, d.Filters())
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]*ServiceStatus)
+	for _, service := range listed {
+		services[service.Name] = service
+	}
+	if err := d.updateForwardingStatus(services); err != nil {
+		logAttrs(LevelError, "Failed to update forwarding status", "server", d.server(), "err", err)
+	}
+	d.UpdateServices(services)
 	return services, nil
 }
 
+// RefreshContainer re-fetches a single container after an event, replacing its service
+// or dropping it if the container is no longer running or doesn't match the client's filters.
+// On a swarm manager an event may be about a service or one of its tasks, so every service
+// is fetched again.
+func (d *DockerClient) RefreshContainer(id, name string) error {
+	return d.RefreshContainerContext(context.Background(), id, name)
+}
+
+// RefreshContainerContext is RefreshContainer, abandoning the refresh once ctx is done
+func (d *DockerClient) RefreshContainerContext(ctx context.Context, id, name string) error {
+	if d.swarm.Load() {
+		logDebug("Refreshing swarm services", "server", d.server(), "service", name)
+		_, err := d.GetServicesContext(ctx)
+		return err
+	}
+	logDebug("Refreshing container", "server", d.server(), "service", name)
+	filters := map[string][]string{"id": {id}}
+	for key, values := range d.Filters() {
+		filters[key] = append(filters[key], values...)
+	}
+	containers, err := d.listContainers(ctx, filters)
+	if err != nil {
+		return err
+	}
+
+	refreshed := make(map[string]*ServiceStatus)
+	for _, container := range containers {
+		service := d.newService(container)
+		refreshed[service.Name] = service
+	}
+	if err := d.updateForwardingStatus(refreshed); err != nil {
+		logAttrs(LevelError, "Failed to update forwarding status", "server", d.server(), "err", err)
+	}
+
+	d.mu.RLock()
+	services := make(map[string]*ServiceStatus, len(d.services)+len(refreshed))
+	for serviceName, service := range d.services {
+		if serviceName != name {
+			services[serviceName] = service
+		}
+	}
+	d.mu.RUnlock()
+	for serviceName, service := range refreshed {
+		services[serviceName] = service
+	}
+
+	d.UpdateServices(services)
+	return nil
+}
+
+// Services returns the current services map
+func (d *DockerClient) Services() map[string]*ServiceStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.services
+}
+
+// ViewServices calls fn with the services while holding the read lock, since remaps and
+// refreshes change them in place
+func (d *DockerClient) ViewServices(fn func(services map[string]*ServiceStatus)) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	fn(d.services)
+}
+
+// WatchEvents streams container events from the Docker API until ctx is cancelled, the
+// client is closed or the connection drops, closing the returned channel when it stops
+func (d *DockerClient) WatchEvents(ctx context.Context) (<-chan DockerEvent, error) {
+	// The stream is long-lived, so it has no request timeout, only cancellation
+	ctx, release := d.requestContextFor(ctx)
+
+	filters := url.QueryEscape(`{"type":["container"]}`)
+	if d.swarm.Load() {
+		filters = url.QueryEscape(`{"type":["container","service"]}`)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.apiURL("/events?filters="+filters), nil)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to create events request: %v", err)
+	}
+	resp, err := d.httpClient(0).Do(req)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to watch Docker events: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		defer release()
+		return nil, fmt.Errorf("failed to watch Docker events: %w", responseError(resp))
+	}
+
+	events := make(chan DockerEvent)
+	go func() {
+		defer close(events)
+		defer release()
+		defer resp.Body.Close()
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var event DockerEvent
+			if err := decoder.Decode(&event); err != nil {
+				if ctx.Err() == nil {
+					logAttrs(LevelWarn, "Docker event stream ended", "server", d.server(), "err", err)
+				}
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
 // forwardPorts attempts to forward the exposed ports for a service
 func (d *DockerClient) forwardPorts(service *ServiceStatus) error {
-	for _, port := range service.ExposedPorts {
-		localPort := port // Use the same port number for local and remote
-		err := d.sshClient.ForwardPort(localPort, port)
+	// One port failing doesn't keep the others from being forwarded
+	var firstErr error
+	for i := range service.ForwardedPorts {
+		port := &service.ForwardedPorts[i]
+		if d.forwardStopped(service.Name, port.Remote) {
+			port.Status = StatusNotForwarded
+			continue
+		}
+		err := d.sshClient.ForwardPort(port.Remote, port.Local, port.Protocol)
+		if errors.Is(err, ErrUDPNotSupported) {
+			port.Status = StatusUnsupported
+			continue
+		}
 		if err != nil {
-			service.ForwardStatus = StatusError
-			return fmt.Errorf("failed to forward port %s: %v", port, err)
+			port.Status, port.Error = StatusError, err.Error()
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to forward port %s: %w", port.Remote, err)
+			}
+			continue
 		}
+		port.Status, port.Error = StatusForwarded, ""
+	}
+	if firstErr != nil {
+		service.ForwardStatus = StatusError
+		return firstErr
 	}
 	service.ForwardStatus = StatusForwarded
 	return nil
 }
 
-// UpdateServices updates the internal services map with the provided services
-func (d *DockerClient) UpdateServices(services map[string]*ServiceStatus) {
+// SetNotifier sets where health changes and new conflicts are reported
+func (d *DockerClient) SetNotifier(notifier *Notifier) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	d.notifier = notifier
+}
+
+// SetEventLogger sets where state changes are recorded
+func (d *DockerClient) SetEventLogger(events *EventLogger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events = events
+}
 
+// SetAlerter sets the alert rules services entering a condition are checked against
+func (d *DockerClient) SetAlerter(alerter *Alerter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.alerter = alerter
+}
+
+// UpdateServices updates the internal services map with the provided services,
+// alerting on any watched transitions since the last update and logging every change
+func (d *DockerClient) UpdateServices(services map[string]*ServiceStatus) {
+	d.mu.Lock()
 	d.services = services
+	d.reportChanges()
+}
+
+// reportChanges compares the services with the last snapshot, replacing it, then unlocks
+// d.mu to alert on the transitions, log the events, run the alert rules they trigger and
+// post health changes to the server's webhook
+func (d *DockerClient) reportChanges() {
+	previous, snapshot := d.snapshot, snapshotServices(d.services)
+	var transitions []Transition
+	var events []Event
+	if previous != nil {
+		transitions = detectTransitions(previous, snapshot)
+		events = diffSnapshots(d.server(), previous, snapshot)
+	}
+	d.snapshot = snapshot
+	notifier, eventLog, alerter, webhook := d.notifier, d.events, d.alerter, d.webhook
+	d.mu.Unlock()
+
+	for _, transition := range transitions {
+		notifier.Notify(transition)
+	}
+	eventLog.Log(events...)
+	alerter.Check(d.name, previous, snapshot)
+	webhook.Check(d.name, previous, snapshot)
 }
 
 // extractPorts extracts port information from Docker API Port structs
-func (d *DockerClient) extractPorts(ports []Port) []string {
-	// Use a map to deduplicate ports
-	portMap := make(map[string]bool)
+func (d *DockerClient) extractPorts(ports []Port) []ForwardedPort {
+	// Use a map keyed by protocol:port to deduplicate ports, so a TCP and a UDP
+	// binding on the same number both survive
+	portMap := make(map[string]ForwardedPort)
 	for _, port := range ports {
 		if port.PublicPort != 0 {
-			portMap[strconv.Itoa(port.PublicPort)] = true
+			protocol := port.Type
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			remote := strconv.Itoa(port.PublicPort)
+			key := protocol + ":" + remote
+			if _, exists := portMap[key]; !exists {
+				portMap[key] = ForwardedPort{
+					Remote:   remote,
+					Local:    remote,
+					Protocol: protocol,
+					Status:   StatusNotForwarded,
+				}
+			}
 		}
 	}
 	
-	// Convert map keys to sorted slice
-	var result []string
-	for port := range portMap {
+	// Convert map values to a slice sorted by port, then protocol
+	var result []ForwardedPort
+	for _, port := range portMap {
 		result = append(result, port)
 	}
-	sort.Strings(result)
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Remote != result[j].Remote {
+			return result[i].Remote < result[j].Remote
+		}
+		return result[i].Protocol < result[j].Protocol
+	})
 	return result
 }
 
@@ -169,10 +826,11 @@ func (d *DockerClient) extractPorts(ports []Port) []string {
 func (d *DockerClient) parseContainerState(state, status string) string {
 	switch state {
 	case "running":
-		if strings.Contains(status, "healthy") {
-			return HealthHealthy
-		} else if strings.Contains(status, "unhealthy") {
+		// Check unhealthy first, since "(unhealthy)" also contains "healthy"
+		if strings.Contains(status, "(unhealthy)") {
 			return HealthUnhealthy
+		} else if strings.Contains(status, "(healthy)") {
+			return HealthHealthy
 		}
 		return HealthRunning
 	case "created":
@@ -194,39 +852,98 @@ func (d *DockerClient) parseContainerState(state, status string) string {
 
 // UpdateForwardingStatus updates the forwarding status of all services
 func (d *DockerClient) UpdateForwardingStatus() error {
+	d.mu.Lock()
+	if err := d.updateForwardingStatus(d.services); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	d.reportChanges()
+	return nil
+}
+
+// processLookupBudget caps the time one update spends looking up which processes hold
+// conflicted ports; ports not reached are looked up on a later update
+const processLookupBudget = 200 * time.Millisecond
+
+// lookupProcess finds the local process listening on a port, a variable so tests can stub lsof
+var lookupProcess = localProcessForPort
+
+// updateForwardingStatus marks each port of services as forwarded, ready or in conflict,
+// and each service with the most alarming state of its ports
+func (d *DockerClient) updateForwardingStatus(services map[string]*ServiceStatus) error {
 	localPorts, err := GetLocalInUsePorts()
 	if err != nil {
 		return fmt.Errorf("error getting local ports: %v", err)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), processLookupBudget)
+	defer cancel()
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
-
-	for _, service := range d.services {
-		// Reset conflicts and status
-		conflicts := make(map[string]bool)
-		service.ForwardStatus = StatusForwarded // Start with forwarded, will be changed if any conflicts found
-
-		// Check each port
-		for _, port := range service.ExposedPorts {
-			if IsPortInUse(port, localPorts) {
-				conflicts[port] = true
-				service.ForwardStatus = StatusConflict // If any port conflicts, service status is conflict
-			} else if service.ForwardStatus != StatusConflict {
-				// Only update to Ready if we haven't found any conflicts
-				service.ForwardStatus = StatusReady
+	for _, service := range services {
+		for i := range service.ForwardedPorts {
+			port := &service.ForwardedPorts[i]
+			var failure error
+			port.Status, failure = d.portStatus(service.Name, port, localPorts)
+			port.Error = ""
+			if failure != nil {
+				port.Error = failure.Error()
+			}
+			if port.Status == StatusConflict {
+				port.ConflictInfo = d.conflictProcess(ctx, port.Local)
+			} else {
+				port.ConflictInfo = nil
+				delete(d.processes, port.Local)
 			}
 		}
+		service.ForwardStatus = aggregateForwardStatus(service.ForwardedPorts)
+	}
+
+	return nil
+}
 
-		// Convert conflicts map to sorted slice
-		service.Conflicts = []string{}
-		for port := range conflicts {
-			service.Conflicts = append(service.Conflicts, port)
+// portStatus returns the state of a service's port given the local ports listened on, and
+// why its forward failed if it's in error. Our own forward listens on its local port, so
+// only another process there is a conflict.
+func (d *DockerClient) portStatus(serviceName string, port *ForwardedPort, localPorts []string) (string, error) {
+	if port.Protocol == "udp" {
+		return StatusUnsupported, nil // lsof's LISTEN check only covers TCP anyway
+	}
+	if d.forwardStopped(serviceName, port.Remote) {
+		return StatusNotForwarded, nil
+	}
+	inUse := IsPortInUse(port.Local, localPorts)
+	if d.sshClient != nil {
+		// A forward given up on is down, and a conflict if something else took its port
+		if err := d.sshClient.ForwardFailure(port.Remote); err != nil {
+			if errors.Is(err, ErrPortInUse) && inUse {
+				return StatusConflict, nil
+			}
+			return StatusError, err
 		}
-		sort.Strings(service.Conflicts)
+		if d.sshClient.ForwardedTo(port.Remote) == port.Local {
+			return StatusForwarded, nil
+		}
+	}
+	if inUse {
+		return StatusConflict, nil
 	}
+	return StatusReady, nil
+}
 
-	return nil
+// forwardPrecedence orders port states by which one a service takes on: any conflict
+// shows, then any error, then whether ports are forwarded or ready to be
+var forwardPrecedence = []string{StatusConflict, StatusError, StatusForwarded, StatusReady, StatusNotForwarded, StatusUnsupported}
+
+// aggregateForwardStatus returns the state of a service with ports, the first in
+// forwardPrecedence any of them is in, or not forwarded for a service without any
+func aggregateForwardStatus(ports []ForwardedPort) string {
+	for _, status := range forwardPrecedence {
+		for _, port := range ports {
+			if port.Status == status {
+				return status
+			}
+		}
+	}
+	return StatusNotForwarded
 }
 
 // ProcessInfo represents information about a process using a port
@@ -237,20 +954,30 @@ type ProcessInfo struct {
 	Command string
 }
 
-// KillProcess kills a process by its PID
+// KillProcess asks the process with pid to exit, killing it outright if it hasn't after
+// killGracePeriod. It fails with ErrPermissionDenied if the process is another user's.
 func (d *DockerClient) KillProcess(pid string) error {
-	cmd := exec.Command("kill", pid)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to kill process: %v", err)
-	}
-	return nil
+	return killProcess(pid, killGracePeriod)
 }
 
-// RemapPort updates the port forwarding for a service
+// RemapPort updates the port forwarding for a service, failing with ErrPortConflict if
+// another service's forward already uses localPort
 func (d *DockerClient) RemapPort(service *ServiceStatus, remotePort, localPort string) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	// Two forwards can't share a local port, whichever service they're for
+	for _, other := range d.services {
+		for _, port := range other.ForwardedPorts {
+			if other.Name == service.Name && port.Remote == remotePort {
+				continue
+			}
+			if port.Local == localPort && (port.Status == StatusForwarded || port.Status == StatusReady) {
+				return fmt.Errorf("%w: %s for %s port %s", ErrPortConflict, localPort, other.Name, port.Remote)
+			}
+		}
+	}
+
 	// Initialize port mappings for service if not exists
 	if _, exists := d.portMappings[service.Name]; !exists {
 		d.portMappings[service.Name] = make(map[string]string)
@@ -259,82 +986,161 @@ func (d *DockerClient) RemapPort(service *ServiceStatus, remotePort, localPort s
 	// Store the new mapping
 	d.portMappings[service.Name][remotePort] = localPort
 
-	// Remove old port from conflicts if it exists
-	if contains(service.Conflicts, remotePort) {
-		service.Conflicts = removeString(service.Conflicts, remotePort)
+	// Point the port at its new local port, clearing any conflict
+	if port := service.Port(remotePort); port != nil {
+		delete(d.processes, port.Local)
+		port.Local = localPort
+		port.Status = StatusReady
+		port.ConflictInfo = nil
 	}
 
-	// Update service status
-	service.ForwardStatus = StatusReady
+	service.ForwardStatus = aggregateForwardStatus(service.ForwardedPorts)
 
 	return nil
 }
 
-// GetPortMapping returns the local port for a given service's remote port
-func (d *DockerClient) GetPortMapping(serviceName, remotePort string) string {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+// forwardKey identifies a service's remote port among stopped forwards
+func forwardKey(serviceName, remotePort string) string {
+	return serviceName + ":" + remotePort
+}
 
-	if mappings, exists := d.portMappings[serviceName]; exists {
-		if localPort, exists := mappings[remotePort]; exists {
-			return localPort
-		}
+// forwardStopped reports whether a service's remote port was stopped by StopForward, or
+// every port is because the client is read-only
+func (d *DockerClient) forwardStopped(serviceName, remotePort string) bool {
+	if d.readOnly.Load() {
+		return true
 	}
-	return remotePort // Default to same port if no mapping exists
+	_, stopped := d.stopped.Load(forwardKey(serviceName, remotePort))
+	return stopped
 }
 
-// Helper function to remove a string from a slice
-func removeString(slice []string, s string) []string {
-	for i, v := range slice {
-		if v == s {
-			return append(slice[:i], slice[i+1:]...)
-		}
+// SetReadOnly stops every forward and keeps refreshes from forwarding while another
+// monitor forwards this server, or lets them forward again
+func (d *DockerClient) SetReadOnly(readOnly bool) {
+	d.readOnly.Store(readOnly)
+	if readOnly && d.sshClient != nil {
+		d.sshClient.StopForwards()
 	}
-	return slice
 }
 
-// GetLocalProcessForPort returns detailed information about the local process using a port
-func (d *DockerClient) GetLocalProcessForPort(port string) *ProcessInfo {
-	cmd := exec.Command("lsof", "-i", fmt.Sprintf(":%s", port), "-F", "pcun")
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil
-	}
+// ReadOnly reports whether another monitor forwards this server's ports instead
+func (d *DockerClient) ReadOnly() bool {
+	return d.readOnly.Load()
+}
 
-	lines := strings.Split(string(out), "\n")
-	if len(lines) < 4 {
-		return nil
+// StartForward forwards a service's exposed remote port to localPort, or the same port if
+// it's empty, resuming it if it was stopped
+func (d *DockerClient) StartForward(serviceName, remotePort, localPort string) (ForwardedPort, error) {
+	service := d.GetService(serviceName)
+	if service == nil {
+		return ForwardedPort{}, fmt.Errorf("no service named %s", serviceName)
+	}
+	port := service.Port(remotePort)
+	if port == nil {
+		return ForwardedPort{}, fmt.Errorf("%s doesn't expose port %s", serviceName, remotePort)
+	}
+	if port.Protocol == "udp" {
+		return ForwardedPort{}, ErrUDPNotSupported
+	}
+	if d.ReadOnly() {
+		return ForwardedPort{}, fmt.Errorf("read-only, another monitor forwards this server")
+	}
+	if d.sshClient == nil {
+		return ForwardedPort{}, fmt.Errorf("not connected")
+	}
+	if localPort == "" {
+		localPort = remotePort
 	}
 
-	info := &ProcessInfo{}
-	for _, line := range lines {
-		if len(line) < 2 {
-			continue
+	// A running forward holds its own local port, so only a new one has to be free
+	if localPort != port.Local || d.forwardStopped(serviceName, remotePort) {
+		localPorts, err := GetLocalInUsePorts()
+		if err != nil {
+			return ForwardedPort{}, fmt.Errorf("failed to get local ports: %v", err)
 		}
-		switch line[0] {
-		case 'p':
-			info.PID = line[1:]
-		case 'c':
-			info.Name = line[1:]
-		case 'u':
-			info.User = line[1:]
-		case 'n':
-			info.Command = line[1:]
+		if IsPortInUse(localPort, localPorts) {
+			return ForwardedPort{}, fmt.Errorf("%w: %s", ErrPortInUse, localPort)
 		}
 	}
+	d.stopped.Delete(forwardKey(serviceName, remotePort))
+	if d.sshClient.ForwardFailure(remotePort) != nil {
+		// Asked for explicitly, so a forward given up on gets another try
+		d.sshClient.StopForward(remotePort)
+	}
+	if err := d.RemapPort(service, remotePort, localPort); err != nil {
+		return ForwardedPort{}, err
+	}
+	if err := d.sshClient.ForwardPort(remotePort, localPort, port.Protocol); err != nil {
+		return ForwardedPort{}, fmt.Errorf("failed to forward port %s: %w", remotePort, err)
+	}
 
-	if info.PID == "" {
-		return nil
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return *service.Port(remotePort), nil
+}
+
+// StopForward stops forwarding a service's remote port and keeps it stopped across
+// refreshes, until StartForward resumes it
+func (d *DockerClient) StopForward(serviceName, remotePort string) error {
+	service := d.GetService(serviceName)
+	if service == nil {
+		return fmt.Errorf("no service named %s", serviceName)
+	}
+	if service.Port(remotePort) == nil {
+		return fmt.Errorf("%s doesn't expose port %s", serviceName, remotePort)
 	}
 
-	// Get full command line
-	if cmdBytes, err := os.ReadFile(fmt.Sprintf("/proc/%s/cmdline", info.PID)); err == nil {
-		info.Command = strings.ReplaceAll(string(cmdBytes), "\x00", " ")
+	d.stopped.Store(forwardKey(serviceName, remotePort), true)
+	if d.sshClient != nil {
+		d.sshClient.StopForward(remotePort)
 	}
 
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	port := service.Port(remotePort)
+	delete(d.processes, port.Local)
+	port.Status = StatusNotForwarded
+	port.ConflictInfo = nil
+	return nil
+}
+
+// GetPortMapping returns the local port for a given service's remote port
+func (d *DockerClient) GetPortMapping(serviceName, remotePort string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if mappings, exists := d.portMappings[serviceName]; exists {
+		if localPort, exists := mappings[remotePort]; exists {
+			return localPort
+		}
+	}
+	return remotePort // Default to same port if no mapping exists
+}
+
+// conflictProcess returns the process holding a conflicted local port, looked up once while
+// the port stays taken. It's nil if the lookup fails or ctx is done before it finishes.
+func (d *DockerClient) conflictProcess(ctx context.Context, port string) *ProcessInfo {
+	if info, ok := d.processes[port]; ok {
+		return info
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	info := lookupProcess(ctx, port)
+	if info != nil {
+		if d.processes == nil {
+			d.processes = make(map[string]*ProcessInfo)
+		}
+		d.processes[port] = info
+	}
 	return info
 }
 
+// GetLocalProcessForPort returns detailed information about the local process using a port
+func (d *DockerClient) GetLocalProcessForPort(port string) *ProcessInfo {
+	return localProcessForPort(context.Background(), port)
+}
+
 // GetServicesByPortStatus returns services grouped by whether they have exposed ports
 func (d *DockerClient) GetServicesByPortStatus() (withPorts, withoutPorts []*ServiceStatus, err error) {
 	d.mu.RLock()
@@ -350,7 +1156,7 @@ func (d *DockerClient) GetServicesByPortStatus() (withPorts, withoutPorts []*Ser
 
 	for _, service := range d.services {
 		if service != nil {
-			if len(service.ExposedPorts) > 0 {
+			if len(service.ForwardedPorts) > 0 {
 				withPorts = append(withPorts, service)
 			} else {
 				withoutPorts = append(withoutPorts, service)
@@ -361,7 +1167,15 @@ func (d *DockerClient) GetServicesByPortStatus() (withPorts, withoutPorts []*Ser
 	return withPorts, withoutPorts, nil
 }
 
-// GetClient returns the SSH client
-func (d *DockerClient) GetClient() *SSHClient {
+// GetService returns the service with the given name, or nil if it's gone
+func (d *DockerClient) GetService(name string) *ServiceStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.services[name]
+}
+
+// GetClient returns the connection ports are forwarded over, or nil if there's none
+func (d *DockerClient) GetClient() Tunneler {
 	return d.sshClient
 }
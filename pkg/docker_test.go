@@ -0,0 +1,532 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockDialer stands in for the SSH connection, dialing a local server instead of the Docker socket
+type mockDialer struct {
+	addr string
+}
+
+func (m *mockDialer) Dial(network, addr string) (net.Conn, error) {
+	return net.Dial("tcp", m.addr)
+}
+
+func BenchmarkPortForward(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"Id":"abc","Names":["/web"],"State":"running","Status":"Up","Ports":[]}]`)
+	}))
+	defer remote.Close()
+
+	remoteURL, err := url.Parse(remote.URL)
+	if err != nil {
+		b.Fatalf("failed to parse server URL: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatalf("failed to create listener: %v", err)
+	}
+	d := &DockerClient{
+		dialer:   &mockDialer{addr: remoteURL.Host},
+		listener: listener,
+		apiPort:  listener.Addr().(*net.TCPAddr).Port,
+	}
+	d.Start()
+	defer d.Close()
+
+	// Each request opens a fresh connection so every iteration goes through the accept and proxy path
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d/containers/json", d.apiPort)
+
+	for _, conns := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("conns=%d", conns), func(b *testing.B) {
+			requests := make(chan struct{}, b.N)
+			for i := 0; i < b.N; i++ {
+				requests <- struct{}{}
+			}
+			close(requests)
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for c := 0; c < conns; c++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range requests {
+						resp, err := client.Get(endpoint)
+						if err != nil {
+							b.Errorf("request failed: %v", err)
+							return
+						}
+						io.Copy(io.Discard, resp.Body)
+						resp.Body.Close()
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestExtractPortsKeepsProtocols(t *testing.T) {
+	d := &DockerClient{}
+	ports := d.extractPorts([]Port{
+		{PrivatePort: 53, PublicPort: 53, Type: "udp"},
+		{PrivatePort: 53, PublicPort: 53, Type: "tcp"},
+		{PrivatePort: 53, PublicPort: 53, Type: "tcp"},
+		{PrivatePort: 80, PublicPort: 8080, Type: "tcp"},
+		{PrivatePort: 9000, Type: "tcp"},
+	})
+
+	want := []string{"53", "53/udp", "8080"}
+	if len(ports) != len(want) {
+		t.Fatalf("got %d ports, want %d: %+v", len(ports), len(want), ports)
+	}
+	for i, port := range ports {
+		if port.Label() != want[i] {
+			t.Errorf("port %d = %q, want %q", i, port.Label(), want[i])
+		}
+	}
+}
+
+// newTestDockerClient returns a DockerClient whose API connections reach handler
+func newTestDockerClient(t *testing.T, handler http.Handler) *DockerClient {
+	t.Helper()
+	remote := httptest.NewServer(handler)
+	t.Cleanup(remote.Close)
+
+	remoteURL, err := url.Parse(remote.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	d := &DockerClient{
+		dialer:       &mockDialer{addr: remoteURL.Host},
+		listener:     listener,
+		apiPort:      listener.Addr().(*net.TCPAddr).Port,
+		services:     make(map[string]*ServiceStatus),
+		portMappings: make(map[string]map[string]string),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.Start()
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// hangingHandler answers nothing until the request is abandoned, signalling started once it arrives
+func hangingHandler(started chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	})
+}
+
+func TestCloseAbortsRequests(t *testing.T) {
+	started := make(chan struct{}, 1)
+	d := newTestDockerClient(t, hangingHandler(started))
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := d.listContainers(context.Background(), nil)
+		errs <- err
+	}()
+	<-started
+	d.Close()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("request succeeded after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request still running after Close")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	started := make(chan struct{}, 1)
+	d := newTestDockerClient(t, hangingHandler(started))
+	d.timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	if _, err := d.listContainers(context.Background(), nil); err == nil {
+		t.Fatal("request succeeded without an answer")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("request gave up after %v, want soon after the 100ms timeout", elapsed)
+	}
+}
+
+func TestRetryDo(t *testing.T) {
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	mux := http.NewServeMux()
+	// Fails twice before answering
+	mux.HandleFunc("GET /flaky", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts["flaky"]++; attempts["flaky"] <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, `{}`)
+	})
+	mux.HandleFunc("GET /missing", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts["missing"]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("POST /restart", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts["restart"]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	// The proxy couldn't reach the socket, so Docker never saw the request
+	mux.HandleFunc("POST /unreachable", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts["unreachable"]++
+		mu.Unlock()
+		w.Header().Set(proxyErrorHeader, proxyHostUnreachable)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	d := newTestDockerClient(t, mux)
+	d.SetRetry(3, time.Millisecond)
+
+	if err := d.apiRequest(context.Background(), http.MethodGet, "/flaky", nil); err != nil {
+		t.Errorf("flaky request failed: %v", err)
+	}
+	d.apiRequest(context.Background(), http.MethodGet, "/missing", nil)
+	d.apiRequest(context.Background(), http.MethodPost, "/restart", nil)
+	if err := d.apiRequest(context.Background(), http.MethodPost, "/unreachable", nil); !errors.Is(err, ErrHostUnreachable) {
+		t.Errorf("unreachable request failed with %v, want ErrHostUnreachable", err)
+	}
+
+	want := map[string]int{"flaky": 3, "missing": 1, "restart": 1, "unreachable": 3}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(attempts, want) {
+		t.Errorf("attempts = %v, want %v", attempts, want)
+	}
+}
+
+func TestWatchEventsRefreshesContainer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("filters"); got != `{"type":["container"]}` {
+			t.Errorf("events filters = %q", got)
+		}
+		io.WriteString(w, `{"Type":"container","Action":"exec_start: sh","Actor":{"ID":"abc","Attributes":{"name":"web"}}}`+"\n")
+		io.WriteString(w, `{"Type":"container","Action":"health_status: unhealthy","Actor":{"ID":"abc","Attributes":{"name":"web"}},"time":1700000000}`+"\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("filters"); got != `{"id":["abc"]}` {
+			t.Errorf("containers filters = %q", got)
+		}
+		io.WriteString(w, `[{"Id":"abc","Names":["/web"],"State":"running","Status":"Up 5 minutes (unhealthy)","Ports":[]}]`)
+	})
+	d := newTestDockerClient(t, mux)
+	d.services = map[string]*ServiceStatus{
+		"web": {Name: "web", HealthStatus: HealthHealthy},
+		"db":  {Name: "db", HealthStatus: HealthHealthy},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := d.WatchEvents(ctx)
+	if err != nil {
+		t.Fatalf("WatchEvents failed: %v", err)
+	}
+
+	var changes []DockerEvent
+	for event := range events {
+		if event.ChangesService() {
+			changes = append(changes, event)
+			cancel()
+		}
+	}
+	cancel()
+	if len(changes) != 1 || changes[0].Action != "health_status: unhealthy" || changes[0].Name() != "web" {
+		t.Fatalf("got service changes %+v, want the health_status event for web", changes)
+	}
+
+	if err := d.RefreshContainer(changes[0].Actor.ID, changes[0].Name()); err != nil {
+		t.Fatalf("RefreshContainer failed: %v", err)
+	}
+	if got := d.GetService("web").HealthStatus; got != HealthUnhealthy {
+		t.Errorf("web is %s after refresh, want %s", got, HealthUnhealthy)
+	}
+	if d.GetService("db") == nil {
+		t.Error("refreshing web dropped db")
+	}
+}
+
+func TestRefreshContainerDropsStoppedContainer(t *testing.T) {
+	d := newTestDockerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[]`)
+	}))
+	d.services = map[string]*ServiceStatus{"web": {Name: "web", HealthStatus: HealthRunning}}
+
+	if err := d.RefreshContainer("abc", "web"); err != nil {
+		t.Fatalf("RefreshContainer failed: %v", err)
+	}
+	if d.GetService("web") != nil {
+		t.Error("stopped container is still listed")
+	}
+}
+
+func TestConflictProcessIsCached(t *testing.T) {
+	lookups := map[string]int{}
+	lookupProcess = func(ctx context.Context, port string) *ProcessInfo {
+		lookups[port]++
+		if port == "9999" {
+			return nil
+		}
+		return &ProcessInfo{Name: "postgres", PID: "812"}
+	}
+	t.Cleanup(func() { lookupProcess = localProcessForPort })
+
+	d := &DockerClient{}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if info := d.conflictProcess(ctx, "5432"); info == nil || info.PID != "812" {
+			t.Fatalf("conflictProcess(5432) = %+v, want postgres", info)
+		}
+		d.conflictProcess(ctx, "9999")
+	}
+	if lookups["5432"] != 1 {
+		t.Errorf("5432 looked up %d times, want once", lookups["5432"])
+	}
+	// Failed lookups are retried on the next update
+	if lookups["9999"] != 3 {
+		t.Errorf("9999 looked up %d times, want every time", lookups["9999"])
+	}
+
+	// Once the budget is spent, ports not cached are left for a later update
+	spent, cancel := context.WithCancel(ctx)
+	cancel()
+	if info := d.conflictProcess(spent, "6379"); info != nil {
+		t.Errorf("conflictProcess after the budget = %+v, want nil", info)
+	}
+	if lookups["6379"] != 0 {
+		t.Error("6379 was looked up after the budget was spent")
+	}
+	if info := d.conflictProcess(spent, "5432"); info == nil {
+		t.Error("cached process wasn't returned after the budget was spent")
+	}
+
+	// Remapping away from a port forgets its process
+	service := &ServiceStatus{Name: "db", ForwardedPorts: []ForwardedPort{{Remote: "5432", Local: "5432", Status: StatusConflict}}}
+	d.portMappings = map[string]map[string]string{}
+	d.RemapPort(service, "5432", "5433")
+	if _, ok := d.processes["5432"]; ok {
+		t.Error("process for 5432 is still cached after remapping")
+	}
+}
+
+func TestPortStatus(t *testing.T) {
+	ssh := &SSHClient{
+		ports: map[string]string{"3000": "3000", "8080": "18080", "5432": "5432"},
+		failed: map[string]forwardFailure{
+			"6379": {localPort: "6379", err: fmt.Errorf("%w: bind failed", ErrPortInUse)},
+			"9000": {localPort: "9000", err: ErrAuthFailed},
+		},
+	}
+	d := &DockerClient{sshClient: ssh}
+	d.stopped.Store(forwardKey("web", "4000"), true)
+
+	tests := []struct {
+		name     string
+		port     ForwardedPort
+		listened []string // Local ports something listens on
+		want     string
+	}{
+		{"our forward listening", ForwardedPort{Remote: "3000", Local: "3000"}, []string{"3000"}, StatusForwarded},
+		{"our forward starting", ForwardedPort{Remote: "3000", Local: "3000"}, nil, StatusForwarded},
+		{"our remapped forward", ForwardedPort{Remote: "8080", Local: "18080"}, []string{"18080", "8080"}, StatusForwarded},
+		{"forwarded elsewhere", ForwardedPort{Remote: "5432", Local: "15432"}, []string{"15432"}, StatusConflict},
+		{"foreign process", ForwardedPort{Remote: "5000", Local: "5000"}, []string{"5000"}, StatusConflict},
+		{"free", ForwardedPort{Remote: "5000", Local: "5000"}, []string{"3000"}, StatusReady},
+		{"given up, still held", ForwardedPort{Remote: "6379", Local: "6379"}, []string{"6379"}, StatusConflict},
+		{"given up, released", ForwardedPort{Remote: "6379", Local: "6379"}, nil, StatusError},
+		{"given up on auth", ForwardedPort{Remote: "9000", Local: "9000"}, []string{"9000"}, StatusError},
+		{"stopped", ForwardedPort{Remote: "4000", Local: "4000"}, []string{"4000"}, StatusNotForwarded},
+		{"udp", ForwardedPort{Remote: "53", Local: "53", Protocol: "udp"}, []string{"53"}, StatusUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.portStatus("web", &tt.port, tt.listened)
+			if got != tt.want {
+				t.Errorf("portStatus = %q, want %q", got, tt.want)
+			}
+			if (err != nil) != (got == StatusError) {
+				t.Errorf("portStatus = %q with error %v, want an error only for %q", got, err, StatusError)
+			}
+		})
+	}
+
+	// Without a connection nothing is ours
+	if got, _ := (&DockerClient{}).portStatus("web", &ForwardedPort{Remote: "3000", Local: "3000"}, []string{"3000"}); got != StatusConflict {
+		t.Errorf("portStatus without a connection = %q, want %q", got, StatusConflict)
+	}
+}
+
+func TestAggregateForwardStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []string
+		want  string
+	}{
+		{"conflict after ready", []string{StatusReady, StatusConflict}, StatusConflict},
+		{"conflict before ready", []string{StatusConflict, StatusReady}, StatusConflict},
+		{"conflict beats error", []string{StatusError, StatusForwarded, StatusConflict}, StatusConflict},
+		{"error beats forwarded", []string{StatusForwarded, StatusError, StatusReady}, StatusError},
+		{"forwarded beats ready", []string{StatusReady, StatusForwarded}, StatusForwarded},
+		{"ready", []string{StatusReady, StatusUnsupported}, StatusReady},
+		{"all stopped", []string{StatusNotForwarded, StatusUnsupported}, StatusNotForwarded},
+		{"udp only", []string{StatusUnsupported}, StatusUnsupported},
+		{"no ports", nil, StatusNotForwarded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ports []ForwardedPort
+			for i, status := range tt.ports {
+				ports = append(ports, ForwardedPort{Remote: fmt.Sprint(3000 + i), Status: status})
+			}
+			if got := aggregateForwardStatus(ports); got != tt.want {
+				t.Errorf("aggregateForwardStatus(%v) = %q, want %q", tt.ports, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClientWithoutConnection(t *testing.T) {
+	// Callers check for nil, which a nil *SSHClient inside the interface would defeat
+	if client := (&DockerClient{}).GetClient(); client != nil {
+		t.Errorf("GetClient without a connection = %#v, want nil", client)
+	}
+}
+
+func TestBatchGetServicesFiltersInOneRequest(t *testing.T) {
+	var requests []string
+	d := newTestDockerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("filters"))
+		io.WriteString(w, `[{"Id":"abc","Names":["/api"],"State":"running","Status":"Up 1 minute"}]`)
+	}))
+
+	services, err := d.BatchGetServices(map[string][]string{"label": {"com.docker.compose.project=myapp"}})
+	if err != nil {
+		t.Fatalf("BatchGetServices failed: %v", err)
+	}
+	if len(services) != 1 || services["api"] == nil {
+		t.Errorf("services = %v, want api", services)
+	}
+	if want := []string{`{"label":["com.docker.compose.project=myapp"]}`}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests sent filters %q, want %q", requests, want)
+	}
+}
+
+func TestRefreshesKeepFilters(t *testing.T) {
+	var requests []string
+	d := newTestDockerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("filters"))
+		io.WriteString(w, `[]`)
+	}))
+	d.SetFilters(map[string][]string{"label": {"tier=backend"}})
+
+	if _, err := d.GetServices(); err != nil {
+		t.Fatalf("GetServices failed: %v", err)
+	}
+	if err := d.RefreshContainer("abc", "web"); err != nil {
+		t.Fatalf("RefreshContainer failed: %v", err)
+	}
+	want := []string{
+		`{"label":["tier=backend"]}`,
+		`{"id":["abc"],"label":["tier=backend"]}`,
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests sent filters %q, want %q", requests, want)
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	filters, err := ParseFilters([]string{"label=com.docker.compose.project=myapp", "label=tier=backend", "status=running"})
+	if err != nil {
+		t.Fatalf("ParseFilters failed: %v", err)
+	}
+	want := map[string][]string{
+		"label":  {"com.docker.compose.project=myapp", "tier=backend"},
+		"status": {"running"},
+	}
+	if !reflect.DeepEqual(filters, want) {
+		t.Errorf("ParseFilters = %v, want %v", filters, want)
+	}
+	if got := FormatFilters(filters); got != "label=com.docker.compose.project=myapp label=tier=backend status=running" {
+		t.Errorf("FormatFilters = %q", got)
+	}
+
+	if filters, err := ParseFilters(nil); err != nil || filters != nil {
+		t.Errorf("ParseFilters(nil) = %v, %v, want no filters", filters, err)
+	}
+	for _, expr := range []string{"myapp", "=x", "label="} {
+		if _, err := ParseFilters([]string{expr}); err == nil {
+			t.Errorf("ParseFilters(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestGetServicesContextCancelled(t *testing.T) {
+	requested := make(chan struct{})
+	var once sync.Once
+	d := newTestDockerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(requested) })
+		<-r.Context().Done() // A listing that never finishes
+	}))
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requested
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := d.GetServicesContext(ctx); err == nil {
+		t.Fatal("GetServicesContext succeeded after being cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetServicesContext returned %v after being cancelled", elapsed)
+	}
+
+	// The request, its proxied connection and the server's handler all wind down
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines left behind by the cancelled listing", after-before)
+	}
+}
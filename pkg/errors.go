@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Failures callers branch on with errors.Is, wrapped with %w where they originate
+var (
+	// ErrAuthFailed is returned when the server refuses the SSH key
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrHostUnreachable is returned when nothing answers at the server's address
+	ErrHostUnreachable = errors.New("host unreachable")
+	// ErrDaemonUnavailable is returned when the server answers but its Docker daemon doesn't
+	ErrDaemonUnavailable = errors.New("Docker daemon unavailable")
+	// ErrPortConflict is returned when a local port is already forwarded for another port
+	ErrPortConflict = errors.New("local port already forwarded")
+	// ErrPortInUse is returned when a process outside dockforward holds a local port
+	ErrPortInUse = errors.New("local port in use")
+	// ErrPermissionDenied is returned when a local process can't be killed because it's another user's
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrNotConnected is returned when an API client acts on a monitor with no server connection
+	ErrNotConnected = errors.New("not connected")
+	// ErrPluginsUnsupported is returned when loading a plugin into a build that can't load them
+	ErrPluginsUnsupported = errors.New("plugins aren't supported by this build")
+	// ErrRemoteDiskFull is returned when a sync fails because the server's filesystem is full
+	ErrRemoteDiskFull = errors.New("remote filesystem full")
+	// ErrSyncMismatch is returned when verifying a sync finds the server's copy differs
+	ErrSyncMismatch = errors.New("synced context doesn't match")
+	// ErrRemoteUnsupported is returned when the server's docker lacks what a command needs,
+	// such as Compose or buildx
+	ErrRemoteUnsupported = errors.New("not supported by the server's docker")
+	// ErrHostKeyMismatch is returned when a server presents a host key other than the one
+	// recorded for it when it was added
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+)
+
+// ErrorHint returns what to try for the failure err wraps, or "" if it isn't one of the
+// failures above
+func ErrorHint(err error) string {
+	switch {
+	case errors.Is(err, ErrAuthFailed):
+		return "Check the user and key path, and that the key's public half is in the server's authorized_keys."
+	case errors.Is(err, ErrHostUnreachable):
+		return "Check the host and port, and that the server is up and reachable from here."
+	case errors.Is(err, ErrDaemonUnavailable):
+		return "Check that Docker is running on the server and the user can use its socket."
+	case errors.Is(err, ErrPortConflict):
+		return "Another forwarded port already uses that local port, pick a different one."
+	case errors.Is(err, ErrPortInUse):
+		return "Stop the process holding the local port, or pick a different one."
+	case errors.Is(err, ErrPermissionDenied):
+		return "Run the monitor with sudo, or kill the process manually."
+	case errors.Is(err, ErrPluginsUnsupported):
+		return "Plugins need a dockforward built with cgo on Linux, macOS or FreeBSD."
+	case errors.Is(err, ErrRemoteDiskFull):
+		return "Free up space on the server, e.g. with docker system prune, or sync to a roomier directory with --remote-dir."
+	case errors.Is(err, ErrSyncMismatch):
+		return "Run the command again to sync once more, and check the server's disk if it keeps happening."
+	case errors.Is(err, ErrRemoteUnsupported):
+		return "Install the missing plugin on the server, or upgrade Docker there."
+	case errors.Is(err, ErrHostKeyMismatch):
+		return "If the server was reinstalled or its keys replaced, remove its line from known_hosts in the config directory and add it again; otherwise something may be intercepting the connection."
+	}
+	return ""
+}
+
+// sshExitCode is the status ssh exits with when it fails itself, rather than the remote command
+const sshExitCode = 255
+
+// Messages ssh and the docker CLI print for the failures ClassifySSHError recognises
+var (
+	authFailedMessages        = []string{"Permission denied (", "Too many authentication failures"}
+	hostUnreachableMessages   = []string{"Could not resolve hostname", "Connection refused", "Connection timed out", "Operation timed out", "No route to host", "Network is unreachable"}
+	daemonUnavailableMessages = []string{"Cannot connect to the Docker daemon", "permission denied while trying to connect to the Docker daemon socket"}
+)
+
+// ClassifySSHError wraps the error matching what a failed ssh run printed, so callers can
+// branch on it with errors.Is, or returns err as is if nothing matches
+func ClassifySSHError(err error, output string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if exitErr.ExitCode() == sshExitCode {
+		switch {
+		case containsAny(output, authFailedMessages):
+			return fmt.Errorf("%w: %v", ErrAuthFailed, err)
+		case containsAny(output, hostUnreachableMessages):
+			return fmt.Errorf("%w: %v", ErrHostUnreachable, err)
+		}
+	}
+	if containsAny(output, daemonUnavailableMessages) {
+		return fmt.Errorf("%w: %v", ErrDaemonUnavailable, err)
+	}
+	return err
+}
+
+// containsAny reports whether s contains any of substrs
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
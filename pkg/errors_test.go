@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConnectErrorsWrapped(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedHost := closed.Addr().String()
+	closed.Close()
+	_, err = Connect(&ServerConfig{Name: "gone", Host: closedHost, User: "tester", KeyPath: "~/.ssh/id_rsa"})
+	if !errors.Is(err, ErrHostUnreachable) {
+		t.Errorf("Connect to a closed port = %v, want ErrHostUnreachable", err)
+	}
+
+	// A key the server doesn't know
+	_, otherPEM := generateKey(t)
+	if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), ".ssh", "id_rsa"), otherPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Connect(&ServerConfig{Name: "test", Host: host, User: "tester", KeyPath: "~/.ssh/id_rsa"})
+	if !errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrHostUnreachable) {
+		t.Errorf("Connect with an unknown key = %v, want ErrAuthFailed", err)
+	}
+	if ErrorHint(err) == "" {
+		t.Error("no hint for a refused key")
+	}
+}
+
+func TestDaemonUnavailableWrapped(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &DockerClient{
+		dialer:       &mockDialer{addr: closed.Addr().String()},
+		listener:     listener,
+		apiPort:      listener.Addr().(*net.TCPAddr).Port,
+		services:     make(map[string]*ServiceStatus),
+		portMappings: make(map[string]map[string]string),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.Start()
+	defer d.Close()
+
+	if _, err := d.GetServices(); !errors.Is(err, ErrDaemonUnavailable) {
+		t.Errorf("GetServices = %v, want ErrDaemonUnavailable", err)
+	}
+	if _, err := d.GetVolumes(); !errors.Is(err, ErrDaemonUnavailable) {
+		t.Errorf("GetVolumes = %v, want ErrDaemonUnavailable", err)
+	}
+	if _, err := d.WatchEvents(context.Background()); !errors.Is(err, ErrDaemonUnavailable) {
+		t.Errorf("WatchEvents = %v, want ErrDaemonUnavailable", err)
+	}
+}
+
+func TestDockerErrorsNotClassified(t *testing.T) {
+	d := newTestDockerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"message":"node is not part of a swarm"}`))
+	}))
+	// Docker's own 503s aren't the proxy failing to reach it
+	if _, err := d.GetServices(); err == nil || errors.Is(err, ErrDaemonUnavailable) {
+		t.Errorf("GetServices = %v, want Docker's error unclassified", err)
+	}
+}
+
+func TestPortErrorsWrapped(t *testing.T) {
+	dm, client := newRemapFixture(t)
+	web := dm.docker.GetService("web")
+	web.ForwardedPorts[0].Local = "38125"
+
+	// Another service's forward holds the local port
+	if err := dm.handleRemapPort("8080", "38125"); !errors.Is(err, ErrPortConflict) {
+		t.Errorf("remapping onto a forwarded port = %v, want ErrPortConflict", err)
+	}
+	if got := localPort(t, dm, "8080"); got != "18080" {
+		t.Errorf("refused remap moved port 8080 to %s", got)
+	}
+
+	// A process outside dockforward holds it
+	held, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+	_, heldPort, _ := net.SplitHostPort(held.Addr().String())
+	if err := dm.handleRemapPort("8080", heldPort); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("remapping onto a listening port = %v, want ErrPortInUse", err)
+	}
+	if _, err := dm.docker.StartForward("web", "8080", heldPort); !errors.Is(err, ErrPortInUse) {
+		t.Errorf("StartForward onto a listening port = %v, want ErrPortInUse", err)
+	}
+
+	if err := client.ForwardPort("4000", "38126", "tcp"); err != nil {
+		t.Fatalf("ForwardPort failed: %v", err)
+	}
+	if err := client.ForwardPort("4001", "38126", "tcp"); !errors.Is(err, ErrPortConflict) {
+		t.Errorf("forwarding a second port to the same local port = %v, want ErrPortConflict", err)
+	}
+}
@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of state change recorded in the event log
+const (
+	EventHealthChanged = "health_changed"         // A service's health changed
+	EventForwardStatus = "forward_status_changed" // A service's forward status changed
+	EventPortConflict  = "port_conflict"          // A local process took one of a service's ports
+	EventSSHReconnect  = "ssh_reconnect"          // The connection to a server was made again
+)
+
+// eventLogMaxSize and eventLogBackups bound the event log's disk use, rotated like log files
+const (
+	eventLogMaxSize = 10 << 20
+	eventLogBackups = 1
+)
+
+// Event is one state change in the event log, written as a line of JSON
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Server    string    `json:"server"`
+	Service   string    `json:"service,omitempty"`
+	Port      string    `json:"port,omitempty"` // Remote port, for port conflicts
+	Type      string    `json:"event_type"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+}
+
+// EventLogger appends events to a file as JSON lines, for an audit trail of what changed
+// and when. Its methods do nothing on a nil logger, so callers don't have to check.
+type EventLogger struct {
+	file *LogFile
+	now  func() time.Time
+	mu   sync.Mutex
+}
+
+// GetEventLogPath returns where the event log is kept, events.jsonl in the config dir
+func GetEventLogPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "events.jsonl"), nil
+}
+
+// OpenEventLogger opens the event log at path for appending, creating its directory
+func OpenEventLogger(path string) (*EventLogger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create event log directory: %v", err)
+	}
+	file, err := OpenLogFile(path, eventLogMaxSize, eventLogBackups)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLogger{file: file, now: time.Now}, nil
+}
+
+// Log appends events, stamping any without a time with the current one
+func (l *EventLogger) Log(events ...Event) {
+	if l == nil || len(events) == 0 {
+		return
+	}
+	var lines []byte
+	for _, event := range events {
+		if event.Timestamp.IsZero() {
+			event.Timestamp = l.now()
+		}
+		line, err := json.Marshal(event)
+		if err != nil {
+			logError("Failed to encode event: %v", err)
+			return
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(lines); err != nil {
+		logError("Failed to write event log: %v", err)
+	}
+}
+
+// Close closes the event log's file
+func (l *EventLogger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// ReadEvents reads the event log at path, returning only the last tail events if tail is
+// positive. Lines that aren't events, such as one cut short by a crash, are skipped.
+func ReadEvents(path string, tail int) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || event.Type == "" {
+			continue
+		}
+		events = append(events, event)
+		if tail > 0 && len(events) > tail {
+			events = events[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event log: %v", err)
+	}
+	return events, nil
+}
+
+// WriteEvents prints events one per line, oldest first, e.g.
+// "2024-05-01 12:00:00  staging  web  health_changed  Healthy -> Unhealthy"
+func WriteEvents(w io.Writer, events []Event) {
+	for _, event := range events {
+		subject := event.Service
+		if event.Port != "" {
+			subject += ":" + event.Port
+		}
+		if subject == "" {
+			subject = "-"
+		}
+		change := event.NewValue
+		if event.OldValue != "" {
+			change = event.OldValue + " -> " + event.NewValue
+		}
+		fmt.Fprintf(w, "%s  %s  %s  %s  %s\n", event.Timestamp.Local().Format("2006-01-02 15:04:05"), event.Server, subject, event.Type, change)
+	}
+}
+
+// diffSnapshots returns the events between two snapshots of a server's services, sorted
+// by service. Services that only just appeared have nothing to compare against and are skipped.
+func diffSnapshots(server string, previous, current map[string]serviceSnapshot) []Event {
+	var events []Event
+	for name, now := range current {
+		before, ok := previous[name]
+		if !ok {
+			continue
+		}
+		if now.health != before.health {
+			events = append(events, Event{Server: server, Service: name, Type: EventHealthChanged, OldValue: before.health, NewValue: now.health})
+		}
+		if now.forward != before.forward {
+			events = append(events, Event{Server: server, Service: name, Type: EventForwardStatus, OldValue: before.forward, NewValue: now.forward})
+		}
+		var ports []string
+		for port := range now.conflicts {
+			if !before.conflicts[port] {
+				ports = append(ports, port)
+			}
+		}
+		sort.Slice(ports, func(i, j int) bool { return portNumber(ports[i]) < portNumber(ports[j]) })
+		for _, port := range ports {
+			events = append(events, Event{Server: server, Service: name, Port: port, Type: EventPortConflict, OldValue: before.ports[port], NewValue: now.ports[port]})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Service < events[j].Service
+	})
+	return events
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "events.jsonl")
+	events, err := OpenEventLogger(path)
+	if err != nil {
+		t.Fatalf("OpenEventLogger failed: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events.now = func() time.Time { return now }
+
+	events.Log(
+		Event{Server: "deploy@staging", Service: "web", Type: EventHealthChanged, OldValue: HealthHealthy, NewValue: HealthUnhealthy},
+		Event{Server: "deploy@staging", Service: "db", Port: "5432", Type: EventPortConflict, OldValue: StatusForwarded, NewValue: StatusConflict},
+	)
+	events.Log(Event{Server: "deploy@staging", Type: EventSSHReconnect, NewValue: "connected"})
+	events.Close()
+
+	// A line cut short, as by a crash mid-write, is skipped
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"timestamp":"2024-05-01T12:00:01Z","server":"deploy`)
+	file.Close()
+
+	all, err := ReadEvents(path, 0)
+	if err != nil {
+		t.Fatalf("ReadEvents failed: %v", err)
+	}
+	if len(all) != 3 || !all[0].Timestamp.Equal(now) || all[1].Port != "5432" || all[2].Type != EventSSHReconnect {
+		t.Errorf("ReadEvents = %+v, want the 3 events logged", all)
+	}
+	last, err := ReadEvents(path, 2)
+	if err != nil {
+		t.Fatalf("ReadEvents failed: %v", err)
+	}
+	if !reflect.DeepEqual(last, all[1:]) {
+		t.Errorf("ReadEvents with tail 2 = %+v, want the last 2", last)
+	}
+
+	var out bytes.Buffer
+	WriteEvents(&out, all)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "deploy@staging  web  health_changed  Healthy -> Unhealthy") ||
+		!strings.Contains(lines[1], "  db:5432  ") || !strings.HasSuffix(lines[2], "  -  ssh_reconnect  connected") {
+		t.Errorf("WriteEvents printed:\n%s", out.String())
+	}
+
+	if _, err := ReadEvents(filepath.Join(t.TempDir(), "missing.jsonl"), 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadEvents of a missing log = %v, want ErrNotExist", err)
+	}
+
+	// A nil logger drops events
+	var none *EventLogger
+	none.Log(Event{Type: EventSSHReconnect})
+	none.Close()
+}
+
+func TestUpdateServicesLogsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	events, err := OpenEventLogger(path)
+	if err != nil {
+		t.Fatalf("OpenEventLogger failed: %v", err)
+	}
+	t.Cleanup(func() { events.Close() })
+	docker := fixtureDockerClient()
+	docker.SetEventLogger(events)
+
+	// The first update has nothing to compare against
+	docker.UpdateServices(fixtureDockerClient().services)
+
+	services := fixtureDockerClient().services
+	services["web"].HealthStatus = HealthUnhealthy
+	web := services["web"].Port("3000")
+	web.Status = StatusConflict
+	web.ConflictInfo = &ProcessInfo{Name: "node", PID: "4242"}
+	services["web"].ForwardStatus = StatusConflict
+	services["cache"] = &ServiceStatus{Name: "cache", HealthStatus: HealthRunning}
+	docker.UpdateServices(services)
+	// Storing the same state again logs nothing more
+	docker.UpdateServices(services)
+
+	got, err := ReadEvents(path, 0)
+	if err != nil {
+		t.Fatalf("ReadEvents failed: %v", err)
+	}
+	for i := range got {
+		got[i].Timestamp = time.Time{}
+	}
+	want := []Event{
+		{Service: "web", Type: EventHealthChanged, OldValue: HealthHealthy, NewValue: HealthUnhealthy},
+		{Service: "web", Type: EventForwardStatus, OldValue: StatusReady, NewValue: StatusConflict},
+		{Service: "web", Port: "3000", Type: EventPortConflict, OldValue: StatusReady, NewValue: "Conflict with node (PID 4242)"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events logged:\n got %+v\nwant %+v", got, want)
+	}
+}
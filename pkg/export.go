@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportColumns is the CSV header of exported services
+var exportColumns = []string{"server", "service", "image", "health", "exposed_ports", "local_ports", "forward_status", "conflicts"}
+
+// WriteStatusCSV writes a row for every service of servers, listing ports the way the tables do
+func WriteStatusCSV(w io.Writer, servers []ServerReport) error {
+	out := csv.NewWriter(w)
+	out.Write(exportColumns)
+	for _, server := range servers {
+		for _, service := range server.Services {
+			var exposed, local, conflicts []string
+			for _, port := range service.Ports {
+				forwarded := ForwardedPort{Remote: port.Remote, Local: port.Local, Protocol: port.Protocol, ConflictInfo: port.Conflict}
+				exposed = append(exposed, forwarded.Label())
+				if port.Status != StatusUnsupported {
+					local = append(local, forwarded.Label()+"->"+port.Local)
+				}
+				if port.Status == StatusConflict {
+					conflicts = append(conflicts, conflictLabel(forwarded))
+				}
+			}
+			out.Write([]string{
+				server.Name,
+				service.Name,
+				service.Image,
+				service.Health,
+				strings.Join(exposed, ", "),
+				strings.Join(local, ", "),
+				service.ForwardStatus,
+				strings.Join(conflicts, ", "),
+			})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// ExportServices writes a server's services to path, as JSON if it ends in .json and CSV otherwise
+func ExportServices(path string, report ServerReport) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = WriteStatusCSV(file, []ServerReport{report})
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~/ in path with the home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteStatusCSV(t *testing.T) {
+	report := serverReport(fixtureConfig().Servers[0], fixtureDockerClient())
+	report.Services[0].Image = "postgres:16"
+
+	var out strings.Builder
+	if err := WriteStatusCSV(&out, []ServerReport{report}); err != nil {
+		t.Fatalf("WriteStatusCSV failed: %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("output isn't valid CSV: %v\n%s", err, out.String())
+	}
+	want := [][]string{
+		exportColumns,
+		{"default", "db", "postgres:16", HealthUnhealthy, "5432", "5432->5432", StatusConflict, "5432 (postgres, pid 812)"},
+		{"default", "web", "", HealthHealthy, "3000, 8080", "3000->3000, 8080->18080", StatusReady, ""},
+		{"default", "worker", "", HealthRunning, "", "", StatusNotForwarded, ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV records = %q, want %q", records, want)
+	}
+}
+
+func TestLandingExportWritesShownServices(t *testing.T) {
+	docker := fixtureDockerClient()
+	config := fixtureConfig()
+	config.Display.HideUnported = true
+	dm := &DisplayManager{config: config, docker: docker, colors: NewColorizer(false)}
+	SetLogHook(dm.Log)
+	t.Cleanup(func() { SetLogHook(nil) })
+	screen := &LandingScreen{display: dm, docker: docker}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	if !screen.HandleInput("export " + path) {
+		t.Fatal("export was rejected")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("export wasn't written: %v", err)
+	}
+	var report ServerReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("export isn't JSON: %v", err)
+	}
+	var names []string
+	for _, service := range report.Services {
+		names = append(names, service.Name)
+	}
+	// The hidden service without ports is left out, as on screen
+	if want := []string{"db", "web"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("exported %v, want %v", names, want)
+	}
+	if messages := dm.recentMessages(1); len(messages) != 1 || messages[0].Text != "Exported 2 services to "+path {
+		t.Errorf("messages = %+v, want the written path confirmed", messages)
+	}
+
+	// A failed write is reported rather than crashing
+	screen.HandleInput("export " + filepath.Join(dir, "missing", "report.csv"))
+	if messages := dm.recentMessages(1); len(messages) != 1 || messages[0].Level != LevelError {
+		t.Errorf("messages = %+v, want the failure reported", messages)
+	}
+}
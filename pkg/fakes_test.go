@@ -0,0 +1,364 @@
+package pkg_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dockforward "dockforward/pkg"
+	"dockforward/pkg/testutil"
+)
+
+// freePort returns a local port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// holdPort listens on a local port until the test ends, returning the port
+func holdPort(t *testing.T) (int, net.Listener) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().(*net.TCPAddr).Port, listener
+}
+
+// newTunneledClient returns a started DockerClient reaching api through an in-memory tunnel
+func newTunneledClient(t *testing.T, api *testutil.DockerAPI) (*dockforward.DockerClient, *testutil.Tunnel) {
+	t.Helper()
+	tunnel := testutil.NewTunnel(api)
+	docker, err := dockforward.NewDockerClient(tunnel, 5*time.Second)
+	if err != nil {
+		t.Fatalf("NewDockerClient failed: %v", err)
+	}
+	docker.Start()
+	t.Cleanup(func() { docker.Close() })
+	return docker, tunnel
+}
+
+func TestUpdateForwardingStatusConflicts(t *testing.T) {
+	webPort := freePort(t)
+	dbPort, held := holdPort(t)
+	web, db := strconv.Itoa(webPort), strconv.Itoa(dbPort)
+	docker, tunnel := newTunneledClient(t, testutil.NewDockerAPI(
+		testutil.RunningContainer("web", webPort),
+		testutil.RunningContainer("db", dbPort),
+	))
+
+	services, err := docker.GetServices()
+	if err != nil {
+		t.Fatalf("GetServices failed: %v", err)
+	}
+	// Our own forward holds its local port without being a conflict
+	if got := services["web"].Port(web).Status; got != dockforward.StatusForwarded {
+		t.Errorf("forwarded port status = %q, want %q", got, dockforward.StatusForwarded)
+	}
+	if got := services["db"].ForwardStatus; got != dockforward.StatusConflict {
+		t.Errorf("service on a held port has status %q, want %q", got, dockforward.StatusConflict)
+	}
+	if got := tunnel.Forwards()[web]; got != web {
+		t.Errorf("port %s forwarded to %q, want %s", web, got, web)
+	}
+
+	// Once the other process lets go the forward is down until it's started again
+	held.Close()
+	if err := docker.UpdateForwardingStatus(); err != nil {
+		t.Fatalf("UpdateForwardingStatus failed: %v", err)
+	}
+	if got := docker.GetService("db").Port(db); got.Status != dockforward.StatusError || got.ConflictInfo != nil {
+		t.Errorf("released port is %q with %+v, want an error", got.Status, got.ConflictInfo)
+	}
+	if _, err := docker.StartForward("db", db, ""); err != nil {
+		t.Fatalf("StartForward failed: %v", err)
+	}
+	if err := docker.UpdateForwardingStatus(); err != nil {
+		t.Fatalf("UpdateForwardingStatus failed: %v", err)
+	}
+	if got := docker.GetService("db").ForwardStatus; got != dockforward.StatusForwarded {
+		t.Errorf("service status after starting again = %q, want %q", got, dockforward.StatusForwarded)
+	}
+
+	// A stopped forward is left alone
+	if err := docker.StopForward("web", web); err != nil {
+		t.Fatalf("StopForward failed: %v", err)
+	}
+	if err := docker.UpdateForwardingStatus(); err != nil {
+		t.Fatalf("UpdateForwardingStatus failed: %v", err)
+	}
+	if got := docker.GetService("web").Port(web).Status; got != dockforward.StatusNotForwarded {
+		t.Errorf("stopped port status = %q, want %q", got, dockforward.StatusNotForwarded)
+	}
+	if _, ok := tunnel.Forwards()[web]; ok {
+		t.Error("stopped port still forwarded over the tunnel")
+	}
+}
+
+func TestRemapPortThroughTunnel(t *testing.T) {
+	webPort, dbPort := freePort(t), freePort(t)
+	web, db := strconv.Itoa(webPort), strconv.Itoa(dbPort)
+	docker, _ := newTunneledClient(t, testutil.NewDockerAPI(
+		testutil.RunningContainer("web", webPort),
+		testutil.RunningContainer("db", dbPort),
+	))
+	if _, err := docker.GetServices(); err != nil {
+		t.Fatalf("GetServices failed: %v", err)
+	}
+
+	service := docker.GetService("web")
+	if err := docker.RemapPort(service, web, db); !errors.Is(err, dockforward.ErrPortConflict) {
+		t.Errorf("remapping onto db's port = %v, want ErrPortConflict", err)
+	}
+
+	target := strconv.Itoa(freePort(t))
+	if err := docker.RemapPort(service, web, target); err != nil {
+		t.Fatalf("RemapPort failed: %v", err)
+	}
+	if got := service.Port(web); got.Local != target || got.Status != dockforward.StatusReady {
+		t.Errorf("remapped port is %s %q, want %s ready", got.Local, got.Status, target)
+	}
+
+	// Refreshes keep the remap
+	services, err := docker.GetServices()
+	if err != nil {
+		t.Fatalf("GetServices failed: %v", err)
+	}
+	if got := services["web"].Port(web).Local; got != target {
+		t.Errorf("after a refresh port %s is on %s, want %s", web, got, target)
+	}
+}
+
+func TestTunnelFailures(t *testing.T) {
+	api := testutil.NewDockerAPI(testutil.RunningContainer("web", freePort(t)))
+	docker, tunnel := newTunneledClient(t, api)
+
+	tunnel.FailDials(errors.New("connection refused"))
+	if _, err := docker.GetServices(); !errors.Is(err, dockforward.ErrDaemonUnavailable) {
+		t.Errorf("GetServices with the socket refusing = %v, want ErrDaemonUnavailable", err)
+	}
+	tunnel.FailDials(nil)
+
+	api.Fail("internal error")
+	if _, err := docker.GetServices(); err == nil || errors.Is(err, dockforward.ErrDaemonUnavailable) {
+		t.Errorf("GetServices with Docker failing = %v, want Docker's error", err)
+	}
+	api.Fail("")
+
+	// Listing still works when forwards don't
+	tunnel.FailForwards(errors.New("administratively prohibited"))
+	services, err := docker.GetServices()
+	if err != nil || len(services) != 1 {
+		t.Fatalf("GetServices with forwards failing = %v, %v, want web", services, err)
+	}
+	if got := tunnel.Forwards(); len(got) != 0 {
+		t.Errorf("forwards %v started although the tunnel refuses them", got)
+	}
+	if got := services["web"].ForwardStatus; got != dockforward.StatusError {
+		t.Errorf("service whose forward failed has status %q, want %q", got, dockforward.StatusError)
+	}
+}
+
+// newFakeDisplay returns a display showing the details of service, backed by a FakeDocker
+// with the canned services
+func newFakeDisplay(t *testing.T, service string) (*dockforward.DisplayManager, *testutil.FakeDocker, *testutil.Tunnel) {
+	t.Helper()
+	t.Setenv("DOCKFORWARD_CONFIG_DIR", t.TempDir())
+	config := &dockforward.Config{
+		Servers:       []dockforward.ServerConfig{{Name: "staging", Host: "staging.example.com:22", User: "deploy"}},
+		CurrentServer: "staging",
+	}
+	dm, err := dockforward.NewDisplayManager(config, nil)
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	t.Cleanup(dm.Shutdown)
+
+	tunnel := testutil.NewTunnel(nil)
+	fake := testutil.NewFakeDocker(tunnel, testutil.CannedServices()...)
+	dm.SetDockerClient(fake)
+	dm.SetMode(dockforward.ModeOverview)
+	dm.UpdateDisplay()
+	for row := 0; row < 2; row++ {
+		if dm.HandleInput(strconv.Itoa(row)); dm.SelectedService() != nil && dm.SelectedService().Name == service {
+			return dm, fake, tunnel
+		}
+		dm.SetMode(dockforward.ModeOverview)
+		dm.UpdateDisplay()
+	}
+	t.Fatalf("no row shows %s", service)
+	return nil, nil, nil
+}
+
+func TestDisplayRemapFlow(t *testing.T) {
+	dm, fake, tunnel := newFakeDisplay(t, "web")
+	if dm.Mode() != dockforward.ModeServiceDetail {
+		t.Fatalf("selecting a row opened mode %v, want the detail screen", dm.Mode())
+	}
+
+	dm.HandleInput("0 remap 38125")
+	if len(fake.Calls()) != 0 {
+		t.Fatalf("remapped before confirming: %v", fake.Calls())
+	}
+	dm.HandleInput("y")
+	if got := fake.Calls(); len(got) != 1 || got[0] != "RemapPort web 3000 38125" {
+		t.Errorf("calls after confirming = %v, want the remap", got)
+	}
+	if got := tunnel.Forwards()["3000"]; got != "38125" {
+		t.Errorf("port 3000 forwarded to %q, want 38125", got)
+	}
+
+	// A refused remap leaves the port where it was
+	fake.Fail("RemapPort", dockforward.ErrPortConflict)
+	dm.HandleInput("1 remap 38126")
+	dm.HandleInput("y")
+	if got := fake.GetService("web").Port("8080").Local; got != "18080" {
+		t.Errorf("refused remap moved port 8080 to %s", got)
+	}
+	if got := tunnel.Forwards()["8080"]; got != "18080" {
+		t.Errorf("after a refused remap port 8080 is forwarded to %q, want 18080", got)
+	}
+}
+
+func TestDisplayKillFlow(t *testing.T) {
+	dm, fake, tunnel := newFakeDisplay(t, "db")
+	fake.HoldPort("5432", &dockforward.ProcessInfo{Name: "postgres", PID: "812", User: "tester"})
+
+	dm.HandleInput("0 kill")
+	dm.HandleInput("y")
+	want := []string{"KillProcess 812", "RemapPort db 5432 5432"}
+	if got := fake.Calls(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("calls after killing = %v, want %v", got, want)
+	}
+	if fake.GetLocalProcessForPort("5432") != nil {
+		t.Error("killed process still holds port 5432")
+	}
+	if got := tunnel.Forwards()["5432"]; got != "5432" {
+		t.Errorf("port 5432 forwarded to %q after killing its holder, want 5432", got)
+	}
+}
+
+func TestDisplayKillPermissionDenied(t *testing.T) {
+	dm, fake, tunnel := newFakeDisplay(t, "db")
+	fake.HoldPort("5432", &dockforward.ProcessInfo{Name: "postgres", PID: "812", User: "postgres"})
+	fake.Fail("KillProcess", fmt.Errorf("%w: the process belongs to another user", dockforward.ErrPermissionDenied))
+
+	dm.HandleInput("0 kill")
+	dm.HandleInput("y")
+	if got := fake.Calls(); len(got) != 1 || got[0] != "KillProcess 812" {
+		t.Errorf("calls after a refused kill = %v, want only the kill", got)
+	}
+	if fake.GetLocalProcessForPort("5432") == nil {
+		t.Error("refused kill freed port 5432")
+	}
+	if _, ok := tunnel.Forwards()["5432"]; ok {
+		t.Error("port 5432 forwarded although its holder wasn't killed")
+	}
+}
+
+func TestForwardsScreenStopsAndRestarts(t *testing.T) {
+	dm, fake, tunnel := newFakeDisplay(t, "web")
+	local := strconv.Itoa(freePort(t))
+	if err := tunnel.ForwardPort("3000", local, "tcp"); err != nil {
+		t.Fatalf("ForwardPort failed: %v", err)
+	}
+	dm.SetMode(dockforward.ModeForwards)
+
+	dm.HandleInput("0 stop")
+	if got := fake.Calls(); len(got) != 1 || got[0] != "StopForward web 3000" {
+		t.Errorf("calls after stopping = %v, want web's 3000 stopped", got)
+	}
+
+	dm.HandleInput("0 restart")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.Calls()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := fake.Calls(); len(got) != 3 || got[2] != "StartForward web 3000 "+local {
+		t.Errorf("calls after restarting = %v, want 3000 started again on %s", got, local)
+	}
+}
+
+func TestComposeForwards(t *testing.T) {
+	t.Setenv("DOCKFORWARD_CONFIG_DIR", t.TempDir())
+	webPort, replicaPort, dbPort, otherPort := freePort(t), freePort(t), freePort(t), freePort(t)
+	web, replica, db, other := strconv.Itoa(webPort), strconv.Itoa(replicaPort), strconv.Itoa(dbPort), strconv.Itoa(otherPort)
+	api := testutil.NewDockerAPI(
+		testutil.ComposeContainer("shop", "web", 1, webPort),
+		testutil.ComposeContainer("shop", "web", 2, replicaPort),
+		testutil.ComposeContainer("shop", "db", 1, dbPort),
+		testutil.ComposeContainer("blog", "app", 1, otherPort),
+	)
+	docker, tunnel := newTunneledClient(t, api)
+	config := &dockforward.Config{
+		Servers:       []dockforward.ServerConfig{{Name: "staging", Host: "staging.example.com:22", User: "deploy"}},
+		CurrentServer: "staging",
+	}
+	dm, err := dockforward.NewDisplayManager(config, nil)
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	t.Cleanup(dm.Shutdown)
+	dm.SetDockerClient(docker)
+	control := dockforward.NewControl(dm)
+
+	if _, err := docker.GetServices(); err != nil {
+		t.Fatalf("GetServices failed: %v", err)
+	}
+	// Stopped by hand, and forwarded again since the project was brought up again
+	if err := docker.StopForward("shop-db-1", db); err != nil {
+		t.Fatalf("StopForward failed: %v", err)
+	}
+
+	ports := []dockforward.ComposePort{
+		{Service: "web", Published: web, Target: "80", Protocol: "tcp"},
+		{Service: "web", Target: "443", Protocol: "tcp"},
+		{Service: "db", Published: db, Target: "5432", Protocol: "tcp"},
+		{Service: "cache", Published: "6379", Target: "6379", Protocol: "tcp"},
+	}
+	result, err := control.ForwardCompose("shop", ports)
+	if err != nil {
+		t.Fatalf("ForwardCompose failed: %v", err)
+	}
+	var ids []string
+	for _, forward := range result.Forwards {
+		ids = append(ids, forward.ID)
+	}
+	if want := []string{"shop-web-1:" + web, "shop-db-1:" + db, "shop-web-2:" + replica}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("forwarded %q, want %q", ids, want)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "cache publishes port 6379") {
+		t.Errorf("warnings = %q, want one about cache", result.Warnings)
+	}
+	if got := tunnel.Forwards()[db]; got != db {
+		t.Errorf("db port forwarded to %q, want %s", got, db)
+	}
+
+	// Taken down, the project's forwards stop and the other project's stay
+	api.SetContainers(testutil.ComposeContainer("blog", "app", 1, otherPort))
+	stopped, err := control.StopCompose("shop", ports)
+	if err != nil {
+		t.Fatalf("StopCompose failed: %v", err)
+	}
+	want := []string{web, replica, db}
+	sort.Strings(want)
+	if !reflect.DeepEqual(stopped, want) {
+		t.Errorf("stopped %q, want %q", stopped, want)
+	}
+	forwards := tunnel.Forwards()
+	if len(forwards) != 1 || forwards[other] != other {
+		t.Errorf("forwards left = %v, want only %s", forwards, other)
+	}
+}
@@ -0,0 +1,282 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// States of a forward on the forwards screen
+const (
+	ForwardActive   = "active"   // ssh is running and listening on the local port
+	ForwardRetrying = "retrying" // ssh exited and is waiting to be restarted
+	ForwardDead     = "dead"     // The forward was given up on and stays down until restarted
+)
+
+// ForwardInfo describes one port forward, for listing every tunnel in one place
+type ForwardInfo struct {
+	Remote   string
+	Local    string
+	Bind     string    // Local address the forward listens on
+	Service  string    // Service exposing the remote port, empty if none does any more
+	State    string    // ForwardActive, ForwardRetrying or ForwardDead
+	Since    time.Time // When the forward was started, zero if it's dead
+	Restarts int       // Times it was restarted after exiting on its own
+	Error    string    // Why a dead forward was given up on
+}
+
+// sortForwards orders forwards by remote port number
+func sortForwards(forwards []ForwardInfo) {
+	sort.Slice(forwards, func(i, j int) bool {
+		return portNumber(forwards[i].Remote) < portNumber(forwards[j].Remote)
+	})
+}
+
+// ListForwards returns the connection's forwards, each naming the service exposing its
+// remote port
+func (d *DockerClient) ListForwards() []ForwardInfo {
+	if d.sshClient == nil {
+		return nil
+	}
+	forwards := d.sshClient.ListForwards()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	nameForwardOwners(forwards, d.services)
+	return forwards
+}
+
+// nameForwardOwners fills in the service exposing each forward's remote port
+func nameForwardOwners(forwards []ForwardInfo, services map[string]*ServiceStatus) {
+	owners := make(map[string]string)
+	for name, service := range services {
+		for _, port := range service.ForwardedPorts {
+			owners[port.Remote] = name
+		}
+	}
+	for i := range forwards {
+		forwards[i].Service = owners[forwards[i].Remote]
+	}
+}
+
+// formatUptime formats a duration to the second, leaving out leading zero units, e.g.
+// "2h 15m 33s" or "45s"
+func formatUptime(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	hours, minutes, seconds := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm %ds", hours, minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// formatUptimeMinutes is formatUptime to the minute, e.g. "2h 15m" or "0m"
+func formatUptimeMinutes(d time.Duration) string {
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// ForwardsScreen lists every forward on the connection across services, answering what is
+// listening on a local port, and stops or restarts them
+type ForwardsScreen struct {
+	display *DisplayManager
+	docker  ContainerAPI
+	cancel  context.CancelFunc
+	now     func() time.Time
+}
+
+func NewForwardsScreen(display *DisplayManager, docker ContainerAPI) *ForwardsScreen {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &ForwardsScreen{display: display, docker: docker, cancel: cancel, now: time.Now}
+	if docker != nil {
+		go display.watchServices(ctx, display.Display)
+	}
+	return s
+}
+
+// forwards returns the forwards listed, in the order they're shown
+func (s *ForwardsScreen) forwards() []ForwardInfo {
+	if s.docker == nil {
+		return nil
+	}
+	return s.docker.ListForwards()
+}
+
+func (s *ForwardsScreen) Display(w io.Writer) {
+	if s.docker == nil {
+		fmt.Fprintln(w, "Error: Docker client is not initialized")
+		return
+	}
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header("Forwards"))
+
+	forwards := s.forwards()
+	if len(forwards) == 0 {
+		fmt.Fprintln(w, "No ports are forwarded.")
+	} else {
+		s.display.setRowLines(rowRange(2+tableHeaderLines, len(forwards)))
+		headers := []string{"#", "Remote Port", "Local Address", "Service", "State", "Uptime", "Restarts"}
+		var rows [][]string
+		for i, forward := range forwards {
+			selected := i == s.display.Cursor()
+			service, uptime := forward.Service, "-"
+			if service == "" {
+				service = "-"
+			}
+			if !forward.Since.IsZero() {
+				uptime = formatUptime(s.now().Sub(forward.Since))
+			}
+			rows = append(rows, []string{
+				s.display.highlight(strconv.Itoa(i), selected),
+				s.display.highlight(forward.Remote, selected),
+				forward.Bind + ":" + forward.Local,
+				service,
+				s.colorizeState(forward),
+				uptime,
+				strconv.Itoa(forward.Restarts),
+			})
+		}
+
+		table := tablewriter.NewWriter(w)
+		table.SetHeader(headers)
+		table.SetAutoWrapText(false)
+		table.SetAutoFormatHeaders(true)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetCenterSeparator("─")
+		table.SetColumnSeparator("│")
+		table.SetRowSeparator("─")
+		table.SetHeaderLine(true)
+		table.SetBorder(true)
+		s.display.appendFitted(table, headers, rows, []int{priorityHigh, priorityHigh, priorityHigh, priorityMedium, priorityHigh, priorityLow, priorityLow})
+		table.Render()
+	}
+
+	s.display.renderActions(w, s.Keys())
+}
+
+// colorizeState colors a forward's state, with the reason a dead one was given up on
+func (s *ForwardsScreen) colorizeState(forward ForwardInfo) string {
+	switch forward.State {
+	case ForwardActive:
+		return s.display.colors.Healthy(forward.State)
+	case ForwardRetrying:
+		return s.display.colors.Warning(forward.State)
+	}
+	state := forward.State
+	if forward.Error != "" {
+		state += ": " + truncateString(forward.Error, 40)
+	}
+	return s.display.colors.Unhealthy(state)
+}
+
+// forwardAt returns the forward a command refers to: the row number before it if there is
+// one, otherwise the highlighted row
+func (s *ForwardsScreen) forwardAt(args []string) (ForwardInfo, bool) {
+	forwards := s.forwards()
+	row := s.display.Cursor()
+	if idx, err := strconv.Atoi(args[0]); err == nil {
+		row = idx
+	}
+	if row < 0 || row >= len(forwards) {
+		return ForwardInfo{}, false
+	}
+	return forwards[row], true
+}
+
+// stop stops a forward, leaving it stopped across refreshes when a service still exposes
+// its port
+func (s *ForwardsScreen) stop(forward ForwardInfo) error {
+	if forward.Service == "" {
+		if client := s.docker.GetClient(); client != nil {
+			client.StopForward(forward.Remote)
+		}
+		return nil
+	}
+	return s.docker.StopForward(forward.Service, forward.Remote)
+}
+
+// restart stops a forward and starts it again on the same local port, waiting for the old
+// ssh to let go of the port first
+func (s *ForwardsScreen) restart(forward ForwardInfo) error {
+	if forward.Service == "" {
+		return fmt.Errorf("no service exposes port %s any more", forward.Remote)
+	}
+	if err := s.docker.StopForward(forward.Service, forward.Remote); err != nil {
+		return err
+	}
+	if forward.State != ForwardDead {
+		if err := s.display.waitPortFree(forward.Local); err != nil {
+			return err
+		}
+	}
+	_, err := s.docker.StartForward(forward.Service, forward.Remote, forward.Local)
+	return err
+}
+
+// Keys returns the commands available on the forwards screen
+func (s *ForwardsScreen) Keys() Keymap {
+	return Keymap{
+		{Keys: []string{"s", "# stop"}, Label: "[s]top", Description: "Stop the highlighted forward (e.g., '1 stop' for forward 1)", Action: func(args []string) bool {
+			forward, ok := s.forwardAt(args)
+			if !ok {
+				return false
+			}
+			if err := s.stop(forward); err != nil {
+				logError("Failed to stop forward of port %s: %v", forward.Remote, err)
+				return true
+			}
+			logInfo("Stopped forward of port %s", forward.Remote)
+			return true
+		}},
+		{Keys: []string{"R", "# restart"}, Label: "[R]estart", Description: "Restart the highlighted forward on the same local port (e.g., '1 restart')", Action: func(args []string) bool {
+			forward, ok := s.forwardAt(args)
+			if !ok {
+				return false
+			}
+			go func() {
+				if err := s.restart(forward); err != nil {
+					logError("Failed to restart forward of port %s: %v", forward.Remote, err)
+				} else {
+					logInfo("Restarted forward of port %s on %s", forward.Remote, forward.Local)
+				}
+				s.display.Display()
+			}()
+			return true
+		}},
+		{Keys: []string{"r", "refresh"}, Label: "[r]efresh", Description: "Refresh forwards now", Action: func([]string) bool {
+			return true
+		}},
+		{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to overview", Action: func([]string) bool {
+			s.display.SetMode(ModeOverview)
+			return true
+		}},
+	}
+}
+
+func (s *ForwardsScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *ForwardsScreen) NeedsRefresh() bool {
+	return false
+}
+
+// Close stops watching for changes to redraw on
+func (s *ForwardsScreen) Close() {
+	s.cancel()
+}
+
+// RowCount returns the number of forwards listed
+func (s *ForwardsScreen) RowCount() int {
+	return len(s.forwards())
+}
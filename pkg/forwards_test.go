@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fixtureForwards returns a DockerClient whose tunnel has web's 3000 running, 8080 waiting
+// to restart, db's 5432 given up on, and a forward of a port no service exposes any more
+func fixtureForwards(created time.Time) *DockerClient {
+	docker := fixtureDockerClient()
+	docker.sshClient = &SSHClient{
+		user:  "tester",
+		host:  "staging.example.com:22",
+		ports: map[string]string{"3000": "3000", "8080": "18080", "9000": "9000"},
+		forwards: map[string]*forward{
+			"3000": {created: created},
+			"8080": {created: created.Add(-2 * time.Hour), restarts: 3, retrying: true},
+			"9000": {created: created.Add(time.Minute)},
+		},
+		failed: map[string]forwardFailure{"5432": {localPort: "5432", err: errors.New("port in use: 5432")}},
+	}
+	return docker
+}
+
+func TestListForwards(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	got := fixtureForwards(created).ListForwards()
+	want := []ForwardInfo{
+		{Remote: "3000", Local: "3000", Bind: "localhost", Service: "web", State: ForwardActive, Since: created},
+		{Remote: "5432", Local: "5432", Bind: "localhost", Service: "db", State: ForwardDead, Error: "port in use: 5432"},
+		{Remote: "8080", Local: "18080", Bind: "localhost", Service: "web", State: ForwardRetrying, Since: created.Add(-2 * time.Hour), Restarts: 3},
+		{Remote: "9000", Local: "9000", Bind: "localhost", State: ForwardActive, Since: created.Add(time.Minute)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListForwards =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if forwards := fixtureDockerClient().ListForwards(); forwards != nil {
+		t.Errorf("ListForwards without a connection = %+v, want none", forwards)
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		45 * time.Second:                              "45s",
+		15*time.Minute + 33500*time.Millisecond:       "15m 33s",
+		2*time.Hour + 15*time.Minute + 33*time.Second: "2h 15m 33s",
+		26 * time.Hour:                                "26h 0m 0s",
+	} {
+		if got := formatUptime(d); got != want {
+			t.Errorf("formatUptime(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestForwardsScreenGolden(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	docker := fixtureForwards(created)
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, cursors: make(map[DisplayMode]int)}
+	screen := &ForwardsScreen{display: dm, docker: docker, cancel: func() {}, now: func() time.Time { return created.Add(90 * time.Second) }}
+	dm.currentScreen = screen
+	dm.mode = ModeForwards
+
+	assertGolden(t, "forwards", renderScreen(screen))
+	if got := screen.RowCount(); got != 4 {
+		t.Errorf("RowCount = %d, want 4", got)
+	}
+}
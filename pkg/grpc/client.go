@@ -0,0 +1,48 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+
+	"dockforward/pkg/grpc/pb"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client talks to a running monitor's gRPC API. The Monitor service's calls are promoted
+// from the generated client.
+type Client struct {
+	pb.MonitorClient
+	conn *gogrpc.ClientConn
+}
+
+// Dial returns a client for the gRPC API at addr, sending token with every call. It doesn't
+// connect until the first call.
+func Dial(addr, token string) (*Client, error) {
+	conn, err := gogrpc.NewClient(addr,
+		gogrpc.WithTransportCredentials(insecure.NewCredentials()),
+		gogrpc.WithPerRPCCredentials(bearerToken(token)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client for %s: %v", addr, err)
+	}
+	return &Client{MonitorClient: pb.NewMonitorClient(conn), conn: conn}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// bearerToken sends a token as the authorization metadata checkToken looks for
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity is false, as the server doesn't use TLS, like the HTTP control API
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,251 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: dockforward.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Monitor_GetServices_FullMethodName    = "/dockforward.v1.Monitor/GetServices"
+	Monitor_ForwardPort_FullMethodName    = "/dockforward.v1.Monitor/ForwardPort"
+	Monitor_StopForwarding_FullMethodName = "/dockforward.v1.Monitor/StopForwarding"
+	Monitor_StreamEvents_FullMethodName   = "/dockforward.v1.Monitor/StreamEvents"
+)
+
+// MonitorClient is the client API for Monitor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Monitor queries and drives a running dockforward monitor, as the HTTP control API does
+type MonitorClient interface {
+	// GetServices lists the connected server and its services
+	GetServices(ctx context.Context, in *GetServicesRequest, opts ...grpc.CallOption) (*GetServicesResponse, error)
+	// ForwardPort forwards a service's remote port, to the same local port unless one is given
+	ForwardPort(ctx context.Context, in *ForwardPortRequest, opts ...grpc.CallOption) (*Forward, error)
+	// StopForwarding stops forwarding a service's remote port until it's forwarded again
+	StopForwarding(ctx context.Context, in *StopForwardingRequest, opts ...grpc.CallOption) (*StopForwardingResponse, error)
+	// StreamEvents sends every service as it stands, then each change until the call ends
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ServiceEvent], error)
+}
+
+type monitorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMonitorClient(cc grpc.ClientConnInterface) MonitorClient {
+	return &monitorClient{cc}
+}
+
+func (c *monitorClient) GetServices(ctx context.Context, in *GetServicesRequest, opts ...grpc.CallOption) (*GetServicesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetServicesResponse)
+	err := c.cc.Invoke(ctx, Monitor_GetServices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) ForwardPort(ctx context.Context, in *ForwardPortRequest, opts ...grpc.CallOption) (*Forward, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Forward)
+	err := c.cc.Invoke(ctx, Monitor_ForwardPort_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) StopForwarding(ctx context.Context, in *StopForwardingRequest, opts ...grpc.CallOption) (*StopForwardingResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StopForwardingResponse)
+	err := c.cc.Invoke(ctx, Monitor_StopForwarding_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitorClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ServiceEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Monitor_ServiceDesc.Streams[0], Monitor_StreamEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamEventsRequest, ServiceEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Monitor_StreamEventsClient = grpc.ServerStreamingClient[ServiceEvent]
+
+// MonitorServer is the server API for Monitor service.
+// All implementations must embed UnimplementedMonitorServer
+// for forward compatibility.
+//
+// Monitor queries and drives a running dockforward monitor, as the HTTP control API does
+type MonitorServer interface {
+	// GetServices lists the connected server and its services
+	GetServices(context.Context, *GetServicesRequest) (*GetServicesResponse, error)
+	// ForwardPort forwards a service's remote port, to the same local port unless one is given
+	ForwardPort(context.Context, *ForwardPortRequest) (*Forward, error)
+	// StopForwarding stops forwarding a service's remote port until it's forwarded again
+	StopForwarding(context.Context, *StopForwardingRequest) (*StopForwardingResponse, error)
+	// StreamEvents sends every service as it stands, then each change until the call ends
+	StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[ServiceEvent]) error
+	mustEmbedUnimplementedMonitorServer()
+}
+
+// UnimplementedMonitorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMonitorServer struct{}
+
+func (UnimplementedMonitorServer) GetServices(context.Context, *GetServicesRequest) (*GetServicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServices not implemented")
+}
+func (UnimplementedMonitorServer) ForwardPort(context.Context, *ForwardPortRequest) (*Forward, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ForwardPort not implemented")
+}
+func (UnimplementedMonitorServer) StopForwarding(context.Context, *StopForwardingRequest) (*StopForwardingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopForwarding not implemented")
+}
+func (UnimplementedMonitorServer) StreamEvents(*StreamEventsRequest, grpc.ServerStreamingServer[ServiceEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamEvents not implemented")
+}
+func (UnimplementedMonitorServer) mustEmbedUnimplementedMonitorServer() {}
+func (UnimplementedMonitorServer) testEmbeddedByValue()                 {}
+
+// UnsafeMonitorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MonitorServer will
+// result in compilation errors.
+type UnsafeMonitorServer interface {
+	mustEmbedUnimplementedMonitorServer()
+}
+
+func RegisterMonitorServer(s grpc.ServiceRegistrar, srv MonitorServer) {
+	// If the following call pancis, it indicates UnimplementedMonitorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Monitor_ServiceDesc, srv)
+}
+
+func _Monitor_GetServices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).GetServices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_GetServices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).GetServices(ctx, req.(*GetServicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_ForwardPort_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForwardPortRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).ForwardPort(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_ForwardPort_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).ForwardPort(ctx, req.(*ForwardPortRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_StopForwarding_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopForwardingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitorServer).StopForwarding(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Monitor_StopForwarding_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitorServer).StopForwarding(ctx, req.(*StopForwardingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitor_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MonitorServer).StreamEvents(m, &grpc.GenericServerStream[StreamEventsRequest, ServiceEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Monitor_StreamEventsServer = grpc.ServerStreamingServer[ServiceEvent]
+
+// Monitor_ServiceDesc is the grpc.ServiceDesc for Monitor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Monitor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dockforward.v1.Monitor",
+	HandlerType: (*MonitorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetServices",
+			Handler:    _Monitor_GetServices_Handler,
+		},
+		{
+			MethodName: "ForwardPort",
+			Handler:    _Monitor_ForwardPort_Handler,
+		},
+		{
+			MethodName: "StopForwarding",
+			Handler:    _Monitor_StopForwarding_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _Monitor_StreamEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "dockforward.proto",
+}
@@ -0,0 +1,208 @@
+// Package grpc serves a running monitor's gRPC API, which other tools such as CI scripts
+// and editor plugins use to query services and start and stop forwards, and is the client
+// for it. Calls carry the HTTP control API's token, as "authorization: Bearer TOKEN".
+package grpc
+
+//go:generate protoc --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative -Ipb dockforward.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	dockforward "dockforward/pkg"
+	"dockforward/pkg/grpc/pb"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// eventInterval is how often StreamEvents looks for changed services
+const eventInterval = time.Second
+
+// Monitor is what the server reports on and acts through, satisfied by *dockforward.Control
+type Monitor interface {
+	StatusReport() dockforward.StatusReport
+	StartForward(req dockforward.ForwardRequest) (dockforward.ForwardReport, error)
+	StopForward(service, remotePort string) error
+}
+
+// server implements the Monitor service
+type server struct {
+	pb.UnimplementedMonitorServer
+	monitor  Monitor
+	interval time.Duration
+}
+
+// Serve serves monitor's gRPC API on addr with the control API's token, creating the token
+// if there isn't one yet, until the returned server is stopped
+func Serve(addr string, monitor Monitor) (*gogrpc.Server, error) {
+	token, err := dockforward.APIToken()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	grpcServer := NewServer(monitor, token)
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			slog.Error("gRPC server stopped", "err", err)
+		}
+	}()
+	return grpcServer, nil
+}
+
+// NewServer returns a gRPC server for monitor, refusing calls that don't carry token
+func NewServer(monitor Monitor, token string) *gogrpc.Server {
+	return newServer(monitor, token, eventInterval)
+}
+
+// newServer is NewServer looking for changed services every interval
+func newServer(monitor Monitor, token string, interval time.Duration) *gogrpc.Server {
+	grpcServer := gogrpc.NewServer(
+		gogrpc.UnaryInterceptor(func(ctx context.Context, req any, _ *gogrpc.UnaryServerInfo, handler gogrpc.UnaryHandler) (any, error) {
+			if err := checkToken(ctx, token); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		gogrpc.StreamInterceptor(func(srv any, stream gogrpc.ServerStream, _ *gogrpc.StreamServerInfo, handler gogrpc.StreamHandler) error {
+			if err := checkToken(stream.Context(), token); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	pb.RegisterMonitorServer(grpcServer, &server{monitor: monitor, interval: interval})
+	return grpcServer
+}
+
+// checkToken fails with Unauthenticated unless the call's metadata carries token
+func checkToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		given, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or wrong API token")
+}
+
+func (s *server) GetServices(ctx context.Context, _ *pb.GetServicesRequest) (*pb.GetServicesResponse, error) {
+	report := s.monitor.StatusReport()
+	resp := &pb.GetServicesResponse{}
+	for _, server := range report.Servers {
+		resp.Servers = append(resp.Servers, serverMessage(server))
+	}
+	return resp, nil
+}
+
+func (s *server) ForwardPort(ctx context.Context, req *pb.ForwardPortRequest) (*pb.Forward, error) {
+	if req.Service == "" || req.RemotePort == "" {
+		return nil, status.Error(codes.InvalidArgument, "service and remote_port are required")
+	}
+	forward, err := s.monitor.StartForward(dockforward.ForwardRequest{Service: req.Service, RemotePort: req.RemotePort, LocalPort: req.LocalPort})
+	switch {
+	case errors.Is(err, dockforward.ErrNotConnected):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, dockforward.ErrPortInUse), errors.Is(err, dockforward.ErrPortConflict):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &pb.Forward{Id: forward.ID, Service: forward.Service, Port: portMessage(forward.PortReport)}, nil
+}
+
+func (s *server) StopForwarding(ctx context.Context, req *pb.StopForwardingRequest) (*pb.StopForwardingResponse, error) {
+	if req.Service == "" || req.RemotePort == "" {
+		return nil, status.Error(codes.InvalidArgument, "service and remote_port are required")
+	}
+	err := s.monitor.StopForward(req.Service, req.RemotePort)
+	switch {
+	case errors.Is(err, dockforward.ErrNotConnected):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &pb.StopForwardingResponse{}, nil
+}
+
+// StreamEvents compares the services every interval, sending an event for each one that
+// appeared, changed or went away since the last look
+func (s *server) StreamEvents(_ *pb.StreamEventsRequest, stream gogrpc.ServerStreamingServer[pb.ServiceEvent]) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	last := make(map[string]*pb.ServiceEvent)
+	for {
+		current := make(map[string]*pb.ServiceEvent)
+		for _, server := range s.monitor.StatusReport().Servers {
+			for _, service := range server.Services {
+				current[server.Name+"/"+service.Name] = &pb.ServiceEvent{Server: server.Name, Service: serviceMessage(service)}
+			}
+		}
+		for key, event := range current {
+			previous, existed := last[key]
+			switch {
+			case !existed:
+				event.Type = pb.ServiceEvent_ADDED
+			case !proto.Equal(previous.Service, event.Service):
+				event.Type = pb.ServiceEvent_CHANGED
+			default:
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+		for key, event := range last {
+			if _, exists := current[key]; !exists {
+				removed := &pb.ServiceEvent{Type: pb.ServiceEvent_REMOVED, Server: event.Server, Service: &pb.Service{Name: event.Service.Name}}
+				if err := stream.Send(removed); err != nil {
+					return err
+				}
+			}
+		}
+		last = current
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// serverMessage converts a server's report to its message
+func serverMessage(server dockforward.ServerReport) *pb.Server {
+	message := &pb.Server{Name: server.Name, Host: server.Host, User: server.User, Connected: server.Connected, Error: server.Error}
+	for _, service := range server.Services {
+		message.Services = append(message.Services, serviceMessage(service))
+	}
+	return message
+}
+
+// serviceMessage converts a service's report to its message
+func serviceMessage(service dockforward.ServiceReport) *pb.Service {
+	message := &pb.Service{Name: service.Name, Image: service.Image, Health: service.Health, Replicas: service.Replicas, ForwardStatus: service.ForwardStatus}
+	for _, port := range service.Ports {
+		message.Ports = append(message.Ports, portMessage(port))
+	}
+	return message
+}
+
+// portMessage converts a port's report to its message
+func portMessage(port dockforward.PortReport) *pb.Port {
+	return &pb.Port{Remote: port.Remote, Local: port.Local, Protocol: port.Protocol, Status: port.Status, Address: port.Address}
+}
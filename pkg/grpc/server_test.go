@@ -0,0 +1,189 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	dockforward "dockforward/pkg"
+	"dockforward/pkg/grpc/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeMonitor is a Monitor whose forwards only change its report
+type fakeMonitor struct {
+	mu     sync.Mutex
+	report dockforward.StatusReport
+	err    error // Returned by StartForward and StopForward when set
+}
+
+func (m *fakeMonitor) StatusReport() dockforward.StatusReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := m.report
+	report.Servers = append([]dockforward.ServerReport(nil), m.report.Servers...)
+	for i := range report.Servers {
+		report.Servers[i].Services = append([]dockforward.ServiceReport(nil), report.Servers[i].Services...)
+	}
+	return report
+}
+
+func (m *fakeMonitor) StartForward(req dockforward.ForwardRequest) (dockforward.ForwardReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return dockforward.ForwardReport{}, m.err
+	}
+	port := dockforward.PortReport{Remote: req.RemotePort, Local: req.LocalPort, Protocol: "tcp", Status: dockforward.StatusForwarded}
+	return dockforward.ForwardReport{ID: req.Service + ":" + req.RemotePort, Service: req.Service, PortReport: port}, nil
+}
+
+func (m *fakeMonitor) StopForward(service, remotePort string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// setServices replaces the connected server's services
+func (m *fakeMonitor) setServices(services ...dockforward.ServiceReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.report.Servers[0].Services = services
+}
+
+// startTestServer serves monitor on a local port with the token "secret", returning a
+// client sending token
+func startTestServer(t *testing.T, monitor Monitor, token string) *Client {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newServer(monitor, "secret", 10*time.Millisecond)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := Dial(listener.Addr().String(), token)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func newFakeMonitor() *fakeMonitor {
+	return &fakeMonitor{report: dockforward.StatusReport{Servers: []dockforward.ServerReport{{
+		Name:      "staging",
+		Host:      "staging.example.invalid:22",
+		User:      "deploy",
+		Connected: true,
+		Services: []dockforward.ServiceReport{{
+			Name:          "web",
+			Health:        dockforward.HealthHealthy,
+			ForwardStatus: dockforward.StatusForwarded,
+			Ports:         []dockforward.PortReport{{Remote: "3000", Local: "3000", Protocol: "tcp", Status: dockforward.StatusForwarded}},
+		}},
+	}}}}
+}
+
+func TestRequiresToken(t *testing.T) {
+	client := startTestServer(t, newFakeMonitor(), "wrong")
+	_, err := client.GetServices(context.Background(), &pb.GetServicesRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("GetServices with the wrong token = %v, want Unauthenticated", err)
+	}
+	stream, err := client.StreamEvents(context.Background(), &pb.StreamEventsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("StreamEvents with the wrong token = %v, want Unauthenticated", err)
+	}
+}
+
+func TestGetServicesAndForwards(t *testing.T) {
+	monitor := newFakeMonitor()
+	client := startTestServer(t, monitor, "secret")
+	ctx := context.Background()
+
+	resp, err := client.GetServices(ctx, &pb.GetServicesRequest{})
+	if err != nil {
+		t.Fatalf("GetServices failed: %v", err)
+	}
+	if len(resp.Servers) != 1 || !resp.Servers[0].Connected || len(resp.Servers[0].Services) != 1 {
+		t.Fatalf("GetServices = %v, want staging with one service", resp)
+	}
+	if port := resp.Servers[0].Services[0].Ports[0]; port.Remote != "3000" || port.Status != dockforward.StatusForwarded {
+		t.Errorf("web's port = %v, want 3000 forwarded", port)
+	}
+
+	forward, err := client.ForwardPort(ctx, &pb.ForwardPortRequest{Service: "web", RemotePort: "3000", LocalPort: "38125"})
+	if err != nil || forward.Id != "web:3000" || forward.Port.Local != "38125" {
+		t.Errorf("ForwardPort = %v, %v; want web:3000 on 38125", forward, err)
+	}
+	if _, err := client.ForwardPort(ctx, &pb.ForwardPortRequest{Service: "web"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ForwardPort without a port = %v, want InvalidArgument", err)
+	}
+	if _, err := client.StopForwarding(ctx, &pb.StopForwardingRequest{Service: "web", RemotePort: "3000"}); err != nil {
+		t.Errorf("StopForwarding failed: %v", err)
+	}
+
+	// The monitor's failures map to status codes
+	for _, tt := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{dockforward.ErrNotConnected, codes.Unavailable},
+		{dockforward.ErrPortInUse, codes.AlreadyExists},
+		{dockforward.ErrPortConflict, codes.AlreadyExists},
+		{errors.New("web doesn't expose port 9999"), codes.FailedPrecondition},
+	} {
+		monitor.mu.Lock()
+		monitor.err = tt.err
+		monitor.mu.Unlock()
+		if _, err := client.ForwardPort(ctx, &pb.ForwardPortRequest{Service: "web", RemotePort: "3000"}); status.Code(err) != tt.code {
+			t.Errorf("ForwardPort failing with %v = %v, want %v", tt.err, err, tt.code)
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	monitor := newFakeMonitor()
+	client := startTestServer(t, monitor, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamEvents(ctx, &pb.StreamEventsRequest{})
+	if err != nil {
+		t.Fatalf("StreamEvents failed: %v", err)
+	}
+	next := func() *pb.ServiceEvent {
+		t.Helper()
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		return event
+	}
+
+	if event := next(); event.Type != pb.ServiceEvent_ADDED || event.Server != "staging" || event.Service.Name != "web" {
+		t.Errorf("first event = %v, want web added", event)
+	}
+
+	web := monitor.StatusReport().Servers[0].Services[0]
+	web.Health = dockforward.HealthUnhealthy
+	monitor.setServices(web)
+	if event := next(); event.Type != pb.ServiceEvent_CHANGED || event.Service.Health != dockforward.HealthUnhealthy {
+		t.Errorf("after web turned unhealthy got %v, want it changed", event)
+	}
+
+	monitor.setServices()
+	if event := next(); event.Type != pb.ServiceEvent_REMOVED || event.Service.Name != "web" {
+		t.Errorf("after web went away got %v, want it removed", event)
+	}
+}
@@ -0,0 +1,345 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headless keeps the current server's ports forwarded without the TUI, logging each
+// change in service state. It's meant to run under a service manager such as systemd.
+type Headless struct {
+	config     *Config
+	loadConfig func() (*Config, error)
+	connect    func(ctx context.Context, server *ServerConfig) (*DockerClient, error)
+	logger     *slog.Logger
+	retryDelay time.Duration
+	filters    map[string][]string // Docker API filters narrowing the containers forwarded
+	serverName string              // Server to forward instead of the config's current one, if set
+	reconnects chan struct{} // Reconnect requests from the control API
+	events     *EventLogger  // Where state changes are recorded, nil for nowhere
+	alerter    *Alerter      // Runs the config's alert rules
+	mu         sync.Mutex    // Guards config, docker and server, which the status socket and control API read from other goroutines
+	docker     *DockerClient
+	server     ServerConfig            // Server docker is connected to
+	services   map[string]serviceState // State at the last sync, for logging changes
+	lock       *ServerLock             // Lock on forwarding server, held from Connect to Close
+}
+
+// serviceState is the part of a service whose changes are logged
+type serviceState struct {
+	health string
+	ports  map[string]string // Port label -> forward status
+}
+
+// NewHeadless creates a headless forwarder for config's current server
+func NewHeadless(config *Config, logger *slog.Logger) *Headless {
+	alerter, err := NewAlerter(config.Alerts)
+	if err != nil {
+		logger.Warn("Skipping invalid alerts", "err", err)
+	}
+	return &Headless{
+		config:     config,
+		loadConfig: LoadConfig,
+		connect:    ConnectContext,
+		logger:     logger,
+		alerter:    alerter,
+		retryDelay: 5 * time.Second,
+		reconnects: make(chan struct{}, 1),
+	}
+}
+
+// SetFilters restricts forwarding to containers matching filters from the next connection
+func (h *Headless) SetFilters(filters map[string][]string) {
+	h.filters = filters
+}
+
+// SetEventLogger records state changes in events from the next connection
+func (h *Headless) SetEventLogger(events *EventLogger) {
+	h.events = events
+}
+
+// SetServer forwards the named server's ports instead of the current server's, across
+// config reloads too
+func (h *Headless) SetServer(name string) {
+	h.serverName = name
+}
+
+// currentServer returns the server to forward, or nil if the config has none
+func (h *Headless) currentServer() *ServerConfig {
+	if h.serverName != "" {
+		return h.config.Server(h.serverName)
+	}
+	return h.config.GetCurrentServer()
+}
+
+// Connect connects to the current server, trying again up to retries more times with a
+// growing delay between attempts
+func (h *Headless) Connect(ctx context.Context, retries int) error {
+	server := h.currentServer()
+	if server == nil {
+		return fmt.Errorf("no server configured")
+	}
+
+	// Another monitor forwarding the same server would fight over its ports
+	if h.lock.Server() != server.Name {
+		h.lock.Release()
+		h.lock = nil
+		lock, err := acquireServerLock(server.Name)
+		if err != nil {
+			return err
+		}
+		h.lock = lock
+	}
+
+	delay := h.retryDelay
+	for attempt := 0; ; attempt++ {
+		docker, err := h.connect(ctx, server)
+		if err == nil {
+			docker.SetFilters(h.filters)
+			docker.SetEventLogger(h.events)
+			docker.SetAlerter(h.alerter)
+			h.mu.Lock()
+			docker.SetRetry(h.config.DockerAPIRetry())
+			h.docker, h.server, h.services = docker, *server, nil
+			h.mu.Unlock()
+			h.logger.Info("connected", "server", server.Name, "host", server.Host, "user", server.User)
+			return nil
+		}
+		if attempt >= retries {
+			return fmt.Errorf("failed to connect to %s after %d attempts: %w", server.Name, attempt+1, err)
+		}
+		h.logger.Warn("connection failed", "server", server.Name, "attempt", attempt+1, "retry_in", delay, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// Run keeps forwards in sync until ctx is cancelled, reloading the config whenever reload
+// receives. Containers are refreshed as Docker reports changes to them, with a full sync
+// every resyncInterval, or every pollInterval without an event stream.
+func (h *Headless) Run(ctx context.Context, reload <-chan struct{}) {
+	defer h.Close()
+
+	for {
+		watchCtx, cancel := context.WithCancel(ctx)
+		h.watch(watchCtx, reload)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		h.Close()
+		if err := h.Connect(ctx, 0); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			h.logger.Error("reconnect failed", "server", h.server.Name, "err", err)
+			select {
+			case <-time.After(h.retryDelay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		h.events.Log(Event{Server: h.docker.server(), Type: EventSSHReconnect, NewValue: "connected"})
+	}
+}
+
+// watch syncs the connected server until ctx is cancelled or it has to reconnect, because
+// the connection dropped or a reload changed server
+func (h *Headless) watch(ctx context.Context, reload <-chan struct{}) {
+	if h.docker == nil {
+		return
+	}
+	h.sync(ctx)
+
+	interval := resyncInterval
+	events, err := h.docker.WatchEvents(ctx)
+	if err != nil {
+		h.logger.Warn("polling for service changes", "server", h.server.Name, "err", err)
+		interval = pollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+			if h.reload() {
+				return
+			}
+		case <-h.reconnects:
+			h.logger.Info("reconnecting on request", "server", h.server.Name)
+			return
+		case <-ticker.C:
+			if client := h.docker.GetClient(); client != nil && !client.Connected() {
+				h.logger.Warn("SSH connection lost", "server", h.server.Name)
+				return
+			}
+			h.sync(ctx)
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				ticker.Reset(pollInterval)
+				continue
+			}
+			if !event.ChangesService() {
+				continue
+			}
+			if err := h.docker.RefreshContainerContext(ctx, event.Actor.ID, event.Name()); err != nil {
+				h.logger.Error("refresh failed", "server", h.server.Name, "service", event.Name(), "event", event.Action, "err", err)
+				continue
+			}
+			h.logChanges(h.docker.Services())
+		}
+	}
+}
+
+// sync fetches every service, which forwards any ports not yet forwarded
+func (h *Headless) sync(ctx context.Context) {
+	services, err := h.docker.GetServicesContext(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return // Stopping, not failing
+		}
+		h.logger.Error("refresh failed", "server", h.server.Name, "err", err)
+		return
+	}
+	h.logChanges(services)
+}
+
+// reload rereads the config, reporting whether the current server changed and needs a reconnect
+func (h *Headless) reload() bool {
+	config, err := h.loadConfig()
+	if err != nil {
+		h.logger.Error("config reload failed", "err", err)
+		return false
+	}
+	h.mu.Lock()
+	h.config = config
+	h.mu.Unlock()
+	server := h.currentServer()
+	if server == nil {
+		h.logger.Warn("config reloaded without servers, staying connected", "server", h.server.Name)
+		return false
+	}
+	if server.SameConnection(h.server) {
+		h.logger.Info("config reloaded", "server", server.Name)
+		return false
+	}
+	h.logger.Info("config reloaded, switching server", "from", h.server.Name, "to", server.Name)
+	return true
+}
+
+// logChanges logs services that appeared, disappeared, or changed health or forward status
+func (h *Headless) logChanges(services map[string]*ServiceStatus) {
+	current := make(map[string]serviceState, len(services))
+	for name, service := range services {
+		state := serviceState{health: service.HealthStatus, ports: make(map[string]string)}
+		for _, port := range service.ForwardedPorts {
+			state.ports[port.Label()] = port.Status
+		}
+		current[name] = state
+	}
+	previous := h.services
+	h.services = current
+
+	for _, name := range slices.Sorted(maps.Keys(current)) {
+		state := current[name]
+		before, existed := previous[name]
+		if !existed {
+			h.logger.Info("service up", "service", name, "health", state.health)
+		} else if before.health != state.health {
+			h.logger.Info("health changed", "service", name, "from", before.health, "to", state.health)
+		}
+		for _, port := range slices.Sorted(maps.Keys(state.ports)) {
+			status := state.ports[port]
+			if was, ok := before.ports[port]; !ok || was != status {
+				level := slog.LevelInfo
+				if status == StatusConflict || status == StatusError {
+					level = slog.LevelWarn
+				}
+				h.logger.Log(context.Background(), level, "port "+strings.ToLower(status), "service", name, "port", port)
+			}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(previous)) {
+		if _, ok := current[name]; !ok {
+			h.logger.Info("service down", "service", name)
+		}
+	}
+}
+
+// Close stops every forward and disconnects from the server, then releases its lock
+func (h *Headless) Close() {
+	defer func() {
+		h.lock.Release()
+		h.lock = nil
+	}()
+	if h.docker == nil {
+		return
+	}
+	h.docker.Close()
+	if client := h.docker.GetClient(); client != nil {
+		client.Close()
+	}
+	h.mu.Lock()
+	h.docker = nil
+	h.mu.Unlock()
+	h.logger.Info("disconnected", "server", h.server.Name)
+}
+
+// configuredServers returns the servers in the config, for the control API
+func (h *Headless) configuredServers() []ServerConfig {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]ServerConfig(nil), h.config.Servers...)
+}
+
+// dockerClient returns the connected server's client, or nil between connections
+func (h *Headless) dockerClient() ContainerAPI {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// A nil *DockerClient would make a non-nil interface
+	if h.docker == nil {
+		return nil
+	}
+	return h.docker
+}
+
+// reconnect asks Run to drop the connection and connect again; it returns before that's done
+func (h *Headless) reconnect() error {
+	select {
+	case h.reconnects <- struct{}{}:
+	default: // A reconnect is already pending
+	}
+	return nil
+}
+
+// StatusReport describes the connected server for `dockforward-monitor status`
+func (h *Headless) StatusReport() StatusReport {
+	h.mu.Lock()
+	server := h.server
+	var docker ContainerAPI
+	if h.docker != nil {
+		docker = h.docker
+	}
+	h.mu.Unlock()
+
+	report := StatusReport{Source: "monitor", Time: time.Now()}
+	if server.Name != "" {
+		report.Servers = append(report.Servers, serverReport(server, docker))
+	}
+	return report
+}
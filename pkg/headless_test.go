@@ -0,0 +1,235 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the forwarder while a test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestHeadless returns a forwarder logging without timestamps to the returned buffer
+func newTestHeadless(config *Config) (*Headless, *syncBuffer) {
+	out := &syncBuffer{}
+	logger := slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	h := NewHeadless(config, logger)
+	h.retryDelay = time.Millisecond
+	return h, out
+}
+
+func TestHeadlessConnectRetries(t *testing.T) {
+	h, out := newTestHeadless(fixtureConfig())
+	attempts := 0
+	h.connect = func(ctx context.Context, server *ServerConfig) (*DockerClient, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("connection refused")
+		}
+		return &DockerClient{}, nil
+	}
+
+	if err := h.Connect(context.Background(), 1); err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Fatalf("Connect with 1 retry = %v, want failure after 2 attempts", err)
+	}
+	attempts = 0
+	if err := h.Connect(context.Background(), 2); err != nil {
+		t.Fatalf("Connect with 2 retries failed: %v", err)
+	}
+	if h.server.Name != "staging" {
+		t.Errorf("connected to %q, want the current server", h.server.Name)
+	}
+	if got := strings.Count(out.String(), "connection failed"); got != 3 {
+		t.Errorf("logged %d failed attempts, want 3:\n%s", got, out)
+	}
+}
+
+func TestHeadlessSetServer(t *testing.T) {
+	h, _ := newTestHeadless(fixtureConfig())
+	h.SetServer("default")
+	var connected string
+	h.connect = func(ctx context.Context, server *ServerConfig) (*DockerClient, error) {
+		connected = server.Name
+		return &DockerClient{}, nil
+	}
+
+	if err := h.Connect(context.Background(), 0); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if connected != "default" {
+		t.Errorf("connected to %q, want the server set instead of the current one", connected)
+	}
+}
+
+func TestHeadlessLogChanges(t *testing.T) {
+	h, out := newTestHeadless(fixtureConfig())
+
+	h.logChanges(fixtureDockerClient().services)
+	services := fixtureDockerClient().services
+	services["web"].HealthStatus = HealthUnhealthy
+	services["web"].ForwardedPorts[0].Status = StatusConflict
+	delete(services, "worker")
+	h.logChanges(services)
+
+	want := []string{
+		`level=INFO msg="service up" service=db health=Unhealthy`,
+		`level=WARN msg="port conflict" service=db port=5432`,
+		`level=INFO msg="service up" service=web health=Healthy`,
+		`level=INFO msg="port ready" service=web port=3000`,
+		`level=INFO msg="port ready" service=web port=8080`,
+		`level=INFO msg="service up" service=worker health=Running`,
+		`level=INFO msg="health changed" service=web from=Healthy to=Unhealthy`,
+		`level=WARN msg="port conflict" service=web port=3000`,
+		`level=INFO msg="service down" service=worker`,
+	}
+	if got := strings.Split(strings.TrimSpace(out.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("logged:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestHeadlessReload(t *testing.T) {
+	h, _ := newTestHeadless(fixtureConfig())
+	h.server = *fixtureConfig().GetCurrentServer()
+
+	h.loadConfig = func() (*Config, error) { return fixtureConfig(), nil }
+	if h.reload() {
+		t.Error("reload with the same server asked to reconnect")
+	}
+
+	h.loadConfig = func() (*Config, error) {
+		config := fixtureConfig()
+		config.CurrentServer = "default"
+		return config, nil
+	}
+	if !h.reload() {
+		t.Error("reload with a new current server didn't ask to reconnect")
+	}
+
+	h.loadConfig = func() (*Config, error) { return nil, errors.New("invalid JSON") }
+	if h.reload() {
+		t.Error("failed reload asked to reconnect")
+	}
+}
+
+func TestHeadlessRunStopsCleanly(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"Id":"abc","Names":["/web"],"State":"running","Status":"Up 5 minutes","Ports":[]}]`)
+	})
+	docker := newTestDockerClient(t, mux)
+
+	h, out := newTestHeadless(fixtureConfig())
+	h.connect = func(ctx context.Context, server *ServerConfig) (*DockerClient, error) { return docker, nil }
+	if err := h.Connect(context.Background(), 0); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx, nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), `msg="service up" service=web`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("service never came up:\n%s", out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// SIGTERM cancels the context, which must tear down the connection
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after cancelling")
+	}
+	if !strings.Contains(out.String(), `msg=disconnected server=staging`) {
+		t.Errorf("didn't disconnect:\n%s", out)
+	}
+	if _, err := docker.listener.Accept(); err == nil {
+		t.Error("Docker API listener still open")
+	}
+}
+
+func TestHeadlessReconnectsOnRequest(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[]`)
+	})
+	clients := make(chan *DockerClient, 2)
+	clients <- newTestDockerClient(t, handler)
+	clients <- newTestDockerClient(t, handler)
+
+	h, out := newTestHeadless(fixtureConfig())
+	h.connect = func(ctx context.Context, server *ServerConfig) (*DockerClient, error) {
+		select {
+		case docker := <-clients:
+			return docker, nil
+		default:
+			return nil, errors.New("no more clients")
+		}
+	}
+	if err := h.Connect(context.Background(), 0); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx, nil)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if err := h.reconnect(); err != nil {
+		t.Fatalf("reconnect failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "msg=connected") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("never reconnected:\n%s", out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(out.String(), `msg="reconnecting on request" server=staging`) {
+		t.Errorf("reconnect wasn't logged:\n%s", out)
+	}
+}
@@ -0,0 +1,112 @@
+package pkg
+
+import "fmt"
+
+// maxActionHistory caps how many remaps can be undone
+const maxActionHistory = 20
+
+// PortRemapAction is a remap of one of a service's ports that can be undone
+type PortRemapAction struct {
+	Service    string
+	RemotePort string
+	OldPort    string // Local port before the remap
+	NewPort    string // Local port after the remap
+}
+
+// recordRemap adds a remap to the undo history, dropping the oldest past the cap.
+// A new remap starts a new branch, so anything undone can no longer be redone.
+func (d *DisplayManager) recordRemap(action PortRemapAction) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.actionHistory = append(d.actionHistory, action)
+	if len(d.actionHistory) > maxActionHistory {
+		d.actionHistory = d.actionHistory[len(d.actionHistory)-maxActionHistory:]
+	}
+	d.redoHistory = nil
+}
+
+// clearHistory forgets every remap that could be undone or redone
+func (d *DisplayManager) clearHistory() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.actionHistory = nil
+	d.redoHistory = nil
+}
+
+// canUndo and canRedo report whether there's a remap to undo or redo
+func (d *DisplayManager) canUndo() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.actionHistory) > 0
+}
+
+func (d *DisplayManager) canRedo() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.redoHistory) > 0
+}
+
+// undoLastRemap moves the most recently remapped port back to its previous local port
+func (d *DisplayManager) undoLastRemap() error {
+	action, ok := d.popAction(&d.actionHistory)
+	if !ok {
+		return fmt.Errorf("nothing to undo")
+	}
+	if err := d.replayRemap(action.Service, action.RemotePort, action.OldPort); err != nil {
+		return fmt.Errorf("failed to undo remap of %s port %s: %v", action.Service, action.RemotePort, err)
+	}
+
+	d.mu.Lock()
+	d.redoHistory = append(d.redoHistory, action)
+	d.mu.Unlock()
+	d.Flash(fmt.Sprintf("Undid remap: %s port %s is back on %s", action.Service, action.RemotePort, action.OldPort))
+	return nil
+}
+
+// redoLastRemap reapplies the most recently undone remap
+func (d *DisplayManager) redoLastRemap() error {
+	action, ok := d.popAction(&d.redoHistory)
+	if !ok {
+		return fmt.Errorf("nothing to redo")
+	}
+	if err := d.replayRemap(action.Service, action.RemotePort, action.NewPort); err != nil {
+		return fmt.Errorf("failed to redo remap of %s port %s: %v", action.Service, action.RemotePort, err)
+	}
+
+	d.mu.Lock()
+	d.actionHistory = append(d.actionHistory, action)
+	d.mu.Unlock()
+	d.Flash(fmt.Sprintf("Redid remap: %s port %s is on %s", action.Service, action.RemotePort, action.NewPort))
+	return nil
+}
+
+// popAction removes and returns the last action of a history stack
+func (d *DisplayManager) popAction(stack *[]PortRemapAction) (PortRemapAction, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(*stack) == 0 {
+		return PortRemapAction{}, false
+	}
+	action := (*stack)[len(*stack)-1]
+	*stack = (*stack)[:len(*stack)-1]
+	return action, true
+}
+
+// replayRemap remaps a port of the named service, which may have been refreshed since
+func (d *DisplayManager) replayRemap(serviceName, remotePort, localPort string) error {
+	if d.docker == nil {
+		return fmt.Errorf("not connected")
+	}
+	// Prefer the copy the detail screen shows, so the change is visible right away
+	service := d.SelectedService()
+	if service == nil || service.Name != serviceName {
+		service = d.docker.GetService(serviceName)
+	}
+	if service == nil {
+		return fmt.Errorf("service %s is gone", serviceName)
+	}
+	return d.remapPort(service, remotePort, localPort)
+}
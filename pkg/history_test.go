@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+// newRemapFixture returns a display manager showing the web service, with forwards
+// started as sleeping processes instead of ssh
+func newRemapFixture(t *testing.T) (*DisplayManager, *SSHClient) {
+	t.Helper()
+
+	forwardCommand = func(args ...string) *exec.Cmd {
+		return exec.Command("sleep", "60")
+	}
+	t.Cleanup(func() {
+		forwardCommand = func(args ...string) *exec.Cmd { return exec.Command("ssh", args...) }
+	})
+
+	client := &SSHClient{
+		user:     "tester",
+		host:     "example.invalid:22",
+		ports:    make(map[string]string),
+		forwards: make(map[string]*forward),
+	}
+	t.Cleanup(func() { client.Close() })
+
+	docker := fixtureDockerClient()
+	docker.sshClient = client
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, colors: NewColorizer(false)}
+	dm.selectedService = docker.services["web"]
+	t.Cleanup(func() {
+		if dm.flashTimer != nil {
+			dm.flashTimer.Stop()
+		}
+	})
+	return dm, client
+}
+
+func localPort(t *testing.T, dm *DisplayManager, remote string) string {
+	t.Helper()
+	return dm.SelectedService().Port(remote).Local
+}
+
+func TestUndoRedoRemap(t *testing.T) {
+	dm, client := newRemapFixture(t)
+
+	dm.handleRemapPort("3000", "38123")
+	if got := localPort(t, dm, "3000"); got != "38123" {
+		t.Fatalf("after remap, port 3000 is on %s, want 38123", got)
+	}
+
+	if err := dm.undoLastRemap(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := localPort(t, dm, "3000"); got != "3000" {
+		t.Errorf("after undo, port 3000 is on %s, want 3000", got)
+	}
+	if got := client.ports["3000"]; got != "3000" {
+		t.Errorf("after undo, forward for 3000 goes to %s, want 3000", got)
+	}
+	// The other port keeps its own remap
+	if got := client.ports["8080"]; got != "18080" {
+		t.Errorf("after undo, forward for 8080 goes to %s, want 18080", got)
+	}
+	if err := dm.undoLastRemap(); err == nil {
+		t.Error("second undo succeeded with nothing left to undo")
+	}
+
+	if err := dm.redoLastRemap(); err != nil {
+		t.Fatalf("redo failed: %v", err)
+	}
+	if got := localPort(t, dm, "3000"); got != "38123" {
+		t.Errorf("after redo, port 3000 is on %s, want 38123", got)
+	}
+
+	// A new remap can't be followed by redoing older undone ones
+	dm.undoLastRemap()
+	dm.handleRemapPort("8080", "38124")
+	if dm.canRedo() {
+		t.Error("redo still available after a new remap")
+	}
+}
+
+func TestActionHistoryIsCapped(t *testing.T) {
+	dm, _ := newRemapFixture(t)
+
+	for i := 0; i < maxActionHistory+5; i++ {
+		dm.recordRemap(PortRemapAction{Service: "web", RemotePort: "3000", OldPort: fmt.Sprint(i), NewPort: fmt.Sprint(i + 1)})
+	}
+	if len(dm.actionHistory) != maxActionHistory {
+		t.Fatalf("history has %d entries, want %d", len(dm.actionHistory), maxActionHistory)
+	}
+	if oldest := dm.actionHistory[0].OldPort; oldest != "5" {
+		t.Errorf("oldest entry starts at %s, want 5", oldest)
+	}
+}
+
+func TestReconnectClearsActionHistory(t *testing.T) {
+	dm, _ := newRemapFixture(t)
+	dm.recordRemap(PortRemapAction{Service: "web", RemotePort: "3000", OldPort: "3000", NewPort: "38123"})
+
+	dm.SetDockerClient(fixtureDockerClient())
+	// Stops the refresher and resource watcher the new connection started
+	t.Cleanup(dm.Shutdown)
+
+	if dm.canUndo() {
+		t.Error("undo still available after reconnecting")
+	}
+}
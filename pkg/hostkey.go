@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// errHostKeyFetched stops FetchHostKey's handshake once the server has shown its key
+var errHostKeyFetched = errors.New("host key fetched")
+
+// GetKnownHostsPath returns where the host keys accepted for servers are recorded, in
+// OpenSSH's known_hosts format, known_hosts in the config dir
+func GetKnownHostsPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "known_hosts"), nil
+}
+
+// knownHostKeys checks each server recorded in the known_hosts file presents the key
+// recorded for it, failing with ErrHostKeyMismatch otherwise. Servers without a record, such
+// as those written into the config by hand, are trusted without a check as before.
+func knownHostKeys() (ssh.HostKeyCallback, error) {
+	path, err := GetKnownHostsPath()
+	if err != nil {
+		return nil, err
+	}
+	check, err := knownhosts.New(path)
+	if os.IsNotExist(err) {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return nil
+			}
+			return fmt.Errorf("%w: %s presented %s key %s, not the one recorded in %s", ErrHostKeyMismatch, hostname, key.Type(), ssh.FingerprintSHA256(key), path)
+		}
+		return err
+	}, nil
+}
+
+// FetchHostKey returns the host key the SSH server at host presents, without authenticating
+func FetchHostKey(ctx context.Context, host string) (ssh.PublicKey, error) {
+	var hostKey ssh.PublicKey
+	config := &ssh.ClientConfig{
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKeyFetched
+		},
+	}
+	client, err := dialSSH(ctx, sshAddr(host), config)
+	if client != nil {
+		client.Close()
+	}
+	if hostKey == nil {
+		return nil, err
+	}
+	return hostKey, nil
+}
+
+// CheckServer authenticates to server as it's configured, insisting on hostKey, and returns
+// the version of the Docker daemon there. The error wraps ErrAuthFailed, ErrHostUnreachable
+// or ErrDaemonUnavailable for those failures.
+func CheckServer(ctx context.Context, server ServerConfig, hostKey ssh.PublicKey) (string, error) {
+	client, err := newSSHClient(ctx, server.User, sshAddr(server.Host), server.KeyPath, ssh.FixedHostKey(hostKey))
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	output, err := client.RunCommandContext(ctx, "docker version --format '{{.Server.Version}}'")
+	output = strings.TrimSpace(output)
+	if err != nil {
+		if output == "" {
+			return "", fmt.Errorf("%w: %v", ErrDaemonUnavailable, err)
+		}
+		return "", fmt.Errorf("%w: %s", ErrDaemonUnavailable, output)
+	}
+	return output, nil
+}
+
+// RecordHostKey records key as the one accepted for host in the known_hosts file at path,
+// replacing any key recorded for it before
+func RecordHostKey(path, host string, key ssh.PublicKey) error {
+	address := knownhosts.Normalize(host)
+	var lines []string
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] != address {
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, knownhosts.Line([]string{address}, key))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestCheckServer(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	hostKey, err := FetchHostKey(ctx, host)
+	if err != nil {
+		t.Fatalf("FetchHostKey failed: %v", err)
+	}
+
+	// The test server runs commands locally, so a stand-in docker answers
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\necho 27.1.1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	server := ServerConfig{Name: "test", Host: host, User: "tester", KeyPath: "~/.ssh/id_rsa"}
+	if version, err := CheckServer(ctx, server, hostKey); err != nil || version != "27.1.1" {
+		t.Errorf("CheckServer = %q, %v, want the daemon's version", version, err)
+	}
+
+	otherKey, _ := generateKey(t)
+	if _, err := CheckServer(ctx, server, otherKey.PublicKey()); err == nil {
+		t.Error("CheckServer accepted a different host key")
+	}
+
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte("#!/bin/sh\necho 'Cannot connect to the Docker daemon' >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckServer(ctx, server, hostKey); !errors.Is(err, ErrDaemonUnavailable) || !strings.Contains(err.Error(), "Cannot connect") {
+		t.Errorf("CheckServer without a daemon = %v", err)
+	}
+
+	_, otherPEM := generateKey(t)
+	if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), ".ssh", "other_rsa"), otherPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	server.KeyPath = "~/.ssh/other_rsa"
+	if _, err := CheckServer(ctx, server, hostKey); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("CheckServer with an unknown key = %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestRecordHostKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dockforward", "known_hosts")
+	first, _ := generateKey(t)
+	second, _ := generateKey(t)
+	other, _ := generateKey(t)
+
+	for _, record := range []struct {
+		host string
+		key  ssh.PublicKey
+	}{
+		{"build.example.com:22", first.PublicKey()},
+		{"10.0.0.5:2222", other.PublicKey()},
+		// Adding the server again replaces its key
+		{"build.example.com", second.PublicKey()},
+	} {
+		if err := RecordHostKey(path, record.host, record.key); err != nil {
+			t.Fatalf("RecordHostKey failed: %v", err)
+		}
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		t.Fatalf("known_hosts doesn't parse: %v", err)
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+	if err := callback("build.example.com:22", addr, second.PublicKey()); err != nil {
+		t.Errorf("the replacing key isn't accepted: %v", err)
+	}
+	if err := callback("build.example.com:22", addr, first.PublicKey()); err == nil {
+		t.Error("the replaced key is still accepted")
+	}
+	if err := callback("10.0.0.5:2222", addr, other.PublicKey()); err != nil {
+		t.Errorf("the other server's key isn't accepted: %v", err)
+	}
+}
+
+func TestRecordedHostKeyChecked(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+	t.Setenv(configDirEnv, t.TempDir())
+	path, err := GetKnownHostsPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a record, as for servers written into the config by hand
+	client, err := NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("connecting to an unrecorded server failed: %v", err)
+	}
+	client.Close()
+
+	hostKey, err := FetchHostKey(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordHostKey(path, host, hostKey); err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("connecting with the recorded key failed: %v", err)
+	}
+	client.Close()
+
+	otherKey, _ := generateKey(t)
+	if err := RecordHostKey(path, host, otherKey.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if !errors.Is(err, ErrHostKeyMismatch) {
+		t.Errorf("connecting with another key recorded = %v, want ErrHostKeyMismatch", err)
+	}
+	if ErrorHint(err) == "" {
+		t.Error("no hint for a changed host key")
+	}
+}
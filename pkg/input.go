@@ -2,17 +2,119 @@ package pkg
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// KeyType identifies the kind of keypress read in raw mode
+type KeyType int
+
+const (
+	KeyRune KeyType = iota
+	KeyUp
+	KeyDown
+	KeyTop    // gg or Home
+	KeyBottom // End
+	KeyEnter
+	KeyEsc
+	KeyBackspace
+	KeyCtrlC
+	KeyCtrlR
+	KeyMouse // Left click, see Key.X and Key.Y
+	KeyUnknown
+)
+
+// Key is a single keypress or mouse click read in raw mode
+type Key struct {
+	Type KeyType
+	Rune rune
+	X, Y int // 1-based terminal cell of a mouse click
+}
+
+const (
+	// escapeTimeout is how long to wait after ESC for the rest of an escape sequence.
+	// Terminals send sequences in one burst, so anything slower is a lone Esc press.
+	escapeTimeout = 50 * time.Millisecond
+
+	// chordTimeout is how long to wait after g for a second g
+	chordTimeout = 300 * time.Millisecond
 )
 
+// InputHandler reads commands from stdin, either a line at a time or, in raw mode,
+// a keypress at a time
 type InputHandler struct {
-	reader *bufio.Reader
+	reader   *bufio.Reader
+	fd       int
+	rawState *term.State
+	// wait blocks until more input is readable or the timeout passes, reporting which
+	wait func(timeout time.Duration) bool
 }
 
+// NewInputHandler creates a line-oriented input handler
 func NewInputHandler() *InputHandler {
+	fd := int(os.Stdin.Fd())
+	return newInputHandler(os.Stdin, fd, func(timeout time.Duration) bool {
+		return waitReadable(fd, timeout)
+	})
+}
+
+func newInputHandler(r io.Reader, fd int, wait func(time.Duration) bool) *InputHandler {
 	return &InputHandler{
-		reader: bufio.NewReader(os.Stdin),
+		reader: bufio.NewReader(r),
+		fd:     fd,
+		wait:   wait,
+	}
+}
+
+// NewRawInputHandler creates an input handler with the terminal in raw mode
+func NewRawInputHandler() (*InputHandler, error) {
+	ih := NewInputHandler()
+	if !term.IsTerminal(ih.fd) {
+		return nil, fmt.Errorf("stdin is not a terminal")
+	}
+	if err := ih.makeRaw(); err != nil {
+		return nil, err
+	}
+	return ih, nil
+}
+
+func (ih *InputHandler) makeRaw() error {
+	state, err := term.MakeRaw(ih.fd)
+	if err != nil {
+		return fmt.Errorf("failed to enter raw mode: %v", err)
+	}
+	ih.rawState = state
+	return nil
+}
+
+// Raw reports whether the terminal is currently in raw mode
+func (ih *InputHandler) Raw() bool {
+	return ih != nil && ih.rawState != nil
+}
+
+// Restore returns the terminal to the state it was in before raw mode
+func (ih *InputHandler) Restore() error {
+	if !ih.Raw() {
+		return nil
+	}
+	state := ih.rawState
+	ih.rawState = nil
+	return term.Restore(ih.fd, state)
+}
+
+// Suspend leaves raw mode so line-oriented prompts work, returning a func that re-enters it
+func (ih *InputHandler) Suspend() func() {
+	if !ih.Raw() {
+		return func() {}
+	}
+	ih.Restore()
+	return func() {
+		ih.makeRaw()
 	}
 }
 
@@ -24,6 +126,127 @@ func (ih *InputHandler) ReadInput() (string, error) {
 	return strings.TrimSpace(input), nil
 }
 
+// ready reports whether another byte arrives within timeout, without consuming it
+func (ih *InputHandler) ready(timeout time.Duration) bool {
+	if ih.reader.Buffered() > 0 {
+		return true
+	}
+	return ih.wait != nil && ih.wait(timeout)
+}
+
+// ReadKey reads a single keypress, decoding escape sequences and the gg chord
+func (ih *InputHandler) ReadKey() (Key, error) {
+	r, _, err := ih.reader.ReadRune()
+	if err != nil {
+		return Key{}, err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return Key{Type: KeyEnter}, nil
+	case 0x7f, 0x08:
+		return Key{Type: KeyBackspace}, nil
+	case 0x03:
+		return Key{Type: KeyCtrlC}, nil
+	case 0x12:
+		return Key{Type: KeyCtrlR}, nil
+	case 0x1b:
+		if !ih.ready(escapeTimeout) {
+			return Key{Type: KeyEsc}, nil
+		}
+		return ih.readEscapeSequence()
+	case 'g':
+		if ih.ready(chordTimeout) {
+			if next, err := ih.reader.Peek(1); err == nil && next[0] == 'g' {
+				ih.reader.ReadByte()
+				return Key{Type: KeyTop}, nil
+			}
+		}
+	}
+
+	return Key{Type: KeyRune, Rune: r}, nil
+}
+
+// ParseKeys decodes keypresses sent in one burst, as a browser terminal sends each key or
+// paste, so an escape sequence is never split across two calls
+func ParseKeys(data string) []Key {
+	ih := newInputHandler(strings.NewReader(data), -1, nil)
+	var keys []Key
+	for {
+		key, err := ih.ReadKey()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, key)
+	}
+}
+
+// readEscapeSequence decodes the remainder of an ESC [ or ESC O sequence
+func (ih *InputHandler) readEscapeSequence() (Key, error) {
+	prefix, err := ih.reader.ReadByte()
+	if err != nil {
+		return Key{}, err
+	}
+	if prefix != '[' && prefix != 'O' {
+		// Alt+key arrives as ESC followed by the key, which has no binding
+		return Key{Type: KeyUnknown}, nil
+	}
+
+	// Consume parameter bytes up to the final byte of the sequence
+	var params []byte
+	for {
+		if !ih.ready(escapeTimeout) {
+			return Key{Type: KeyUnknown}, nil
+		}
+		b, err := ih.reader.ReadByte()
+		if err != nil {
+			return Key{}, err
+		}
+		if b < 0x40 || b > 0x7e {
+			params = append(params, b)
+			continue
+		}
+		if b == 'M' && prefix == '[' && len(params) == 0 {
+			return ih.readMouseEvent()
+		}
+
+		switch {
+		case b == 'A':
+			return Key{Type: KeyUp}, nil
+		case b == 'B':
+			return Key{Type: KeyDown}, nil
+		case b == 'H', b == '~' && (string(params) == "1" || string(params) == "7"):
+			return Key{Type: KeyTop}, nil
+		case b == 'F', b == '~' && (string(params) == "4" || string(params) == "8"):
+			return Key{Type: KeyBottom}, nil
+		}
+		return Key{Type: KeyUnknown}, nil
+	}
+}
+
+// readMouseEvent decodes the button and 1-based cell that follow ESC [ M, each offset by 32
+func (ih *InputHandler) readMouseEvent() (Key, error) {
+	var event [3]byte
+	if _, err := io.ReadFull(ih.reader, event[:]); err != nil {
+		return Key{}, err
+	}
+	button := int(event[0]) - 32
+	x, y := int(event[1])-32, int(event[2])-32
+
+	switch {
+	case button&64 != 0:
+		// Wheel scrolls move the selection like the arrow keys
+		if button&1 == 0 {
+			return Key{Type: KeyUp}, nil
+		}
+		return Key{Type: KeyDown}, nil
+	case button&3 == 0:
+		return Key{Type: KeyMouse, X: x, Y: y}, nil
+	}
+	// Releases and other buttons have no binding
+	return Key{Type: KeyUnknown}, nil
+}
+
 func (ih *InputHandler) ProcessInput(input string, dm *DisplayManager) bool {
 	return dm.HandleInput(input)
 }
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package pkg
+
+import "time"
+
+// waitReadable can't poll the console here, so only already-buffered input counts
+// as part of an escape sequence or chord
+func waitReadable(fd int, timeout time.Duration) bool {
+	return false
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// chunkReader returns one chunk per Read, like a terminal delivering bytes as they're typed
+type chunkReader struct {
+	chunks []string
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.chunks[0])
+	c.chunks = c.chunks[1:]
+	return n, nil
+}
+
+// newChunkedInput returns a handler whose wait reports input only when a chunk is left
+// and arrives in time, with late set for chunks that arrive after the timeout
+func newChunkedInput(late bool, chunks ...string) *InputHandler {
+	r := &chunkReader{chunks: chunks}
+	return newInputHandler(r, -1, func(time.Duration) bool {
+		return len(r.chunks) > 0 && !late
+	})
+}
+
+func readKeys(t *testing.T, ih *InputHandler) []Key {
+	t.Helper()
+
+	var keys []Key
+	for {
+		key, err := ih.ReadKey()
+		if err == io.EOF {
+			return keys
+		}
+		if err != nil {
+			t.Fatalf("ReadKey failed: %v", err)
+		}
+		keys = append(keys, key)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		late   bool
+		chunks []string
+		want   []Key
+	}{
+		{"runes", false, []string{"jq"}, []Key{{Type: KeyRune, Rune: 'j'}, {Type: KeyRune, Rune: 'q'}}},
+		{"enter and backspace", false, []string{"\r\x7f"}, []Key{{Type: KeyEnter}, {Type: KeyBackspace}}},
+		{"arrow in one burst", false, []string{"\x1b[A\x1bOB"}, []Key{{Type: KeyUp}, {Type: KeyDown}}},
+		{"arrow split across reads", false, []string{"\x1b", "[", "B"}, []Key{{Type: KeyDown}}},
+		{"lone esc", false, []string{"\x1b"}, []Key{{Type: KeyEsc}}},
+		{"esc then slow bracket", true, []string{"\x1b", "["}, []Key{{Type: KeyEsc}, {Type: KeyRune, Rune: '['}}},
+		{"home and end", false, []string{"\x1b[H\x1b[4~"}, []Key{{Type: KeyTop}, {Type: KeyBottom}}},
+		{"gg chord", false, []string{"g", "g"}, []Key{{Type: KeyTop}}},
+		{"slow second g", true, []string{"g", "g"}, []Key{{Type: KeyRune, Rune: 'g'}, {Type: KeyRune, Rune: 'g'}}},
+		{"g then other key", false, []string{"g", "j"}, []Key{{Type: KeyRune, Rune: 'g'}, {Type: KeyRune, Rune: 'j'}}},
+		{"mouse click", false, []string{"\x1b[M !#"}, []Key{{Type: KeyMouse, X: 1, Y: 3}}},
+		{"mouse release", false, []string{"\x1b[M#!#"}, []Key{{Type: KeyUnknown}}},
+		{"mouse wheel", false, []string{"\x1b[M`!!\x1b[Ma!!"}, []Key{{Type: KeyUp}, {Type: KeyDown}}},
+		{"unknown sequence", false, []string{"\x1b[5~k"}, []Key{{Type: KeyUnknown}, {Type: KeyRune, Rune: 'k'}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readKeys(t, newChunkedInput(tt.late, tt.chunks...))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got keys %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("key %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := ParseKeys("j\x1b[A\r0 remap\x7f")
+	want := []Key{{Type: KeyRune, Rune: 'j'}, {Type: KeyUp}, {Type: KeyEnter}, {Type: KeyRune, Rune: '0'}, {Type: KeyRune, Rune: ' '},
+		{Type: KeyRune, Rune: 'r'}, {Type: KeyRune, Rune: 'e'}, {Type: KeyRune, Rune: 'm'}, {Type: KeyRune, Rune: 'a'}, {Type: KeyRune, Rune: 'p'}, {Type: KeyBackspace}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseKeys = %+v, want %+v", got, want)
+	}
+	// Nothing more is coming after a lone Esc
+	if got := ParseKeys("\x1b"); len(got) != 1 || got[0].Type != KeyEsc {
+		t.Errorf("ParseKeys(Esc) = %+v, want Esc", got)
+	}
+}
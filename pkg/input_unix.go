@@ -0,0 +1,21 @@
+//go:build unix
+
+package pkg
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitReadable reports whether fd has input within timeout
+func waitReadable(fd int, timeout time.Duration) bool {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+		if err == unix.EINTR {
+			continue
+		}
+		return err == nil && n > 0
+	}
+}
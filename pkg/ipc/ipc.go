@@ -0,0 +1,189 @@
+// Package ipc is how the docker wrapper and `status` ask a running monitor for its state,
+// over a unix socket in the config directory. Each connection carries one request and its
+// response, each a line of JSON.
+package ipc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	dockforward "dockforward/pkg"
+	"dockforward/pkg/version"
+)
+
+// Methods a Request can name
+const (
+	// GetStatus returns the monitor's status report
+	GetStatus = "GetStatus"
+	// GetCurrentServer returns the server the monitor forwards
+	GetCurrentServer = "GetCurrentServer"
+	// GetPortMappings returns the local port of each forwarded port, by service
+	GetPortMappings = "GetPortMappings"
+	// GetSyncedDir returns the build context directory last synced to Request.Server
+	GetSyncedDir = "GetSyncedDir"
+	// SetSyncedDir records Request.Dir as the build context directory synced to Request.Server
+	SetSyncedDir = "SetSyncedDir"
+	// ForwardCompose forwards Request.ComposePorts of the Compose project Request.Project
+	ForwardCompose = "ForwardCompose"
+	// StopCompose stops the forwards of the Compose project Request.Project, taken down
+	StopCompose = "StopCompose"
+	// GetVersion returns the monitor's version
+	GetVersion = "GetVersion"
+)
+
+// Request asks the monitor for one thing
+type Request struct {
+	Method string `json:"method"`
+	Server string `json:"server,omitempty"`
+	Dir    string `json:"dir,omitempty"`
+
+	Project      string                    `json:"project,omitempty"`
+	ComposePorts []dockforward.ComposePort `json:"composePorts,omitempty"`
+
+	// Version of the binary asking, so the monitor can warn when it differs from its own
+	Version string `json:"version,omitempty"`
+}
+
+// Response answers a Request, with Error set if it failed and the field for its method set otherwise
+type Response struct {
+	Error  string                       `json:"error,omitempty"`
+	Status *dockforward.StatusReport    `json:"status,omitempty"`
+	Server *dockforward.ServerInfo      `json:"server,omitempty"`
+	Ports  map[string]map[string]string `json:"ports,omitempty"` // Service name -> remote port -> local port
+	Dir    string                       `json:"dir,omitempty"`
+
+	Compose *dockforward.ComposeForwards `json:"compose,omitempty"`
+	Stopped []string                     `json:"stopped,omitempty"` // Remote ports StopCompose stopped forwarding
+
+	Version string `json:"version,omitempty"` // The monitor's version, sent with every response
+}
+
+// timeout bounds each request, so a wedged monitor doesn't hang its callers
+const timeout = 5 * time.Second
+
+// Client sends requests to the monitor serving a socket
+type Client struct {
+	path string
+}
+
+// NewClient returns a client for the monitor serving the socket at path
+func NewClient(path string) *Client {
+	return &Client{path: path}
+}
+
+// DefaultClient returns a client for the monitor serving the config directory's socket
+func DefaultClient() (*Client, error) {
+	path, err := dockforward.ControlSocketPath()
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(path), nil
+}
+
+// call sends req and reads its response, failing with the monitor's error if it gave one
+func (c *Client) call(req Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", c.path, time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("no monitor running: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if req.Version == "" {
+		req.Version = version.Version
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send %s: %v", req.Method, err)
+	}
+	var resp Response
+	if err := json.NewDecoder(io.LimitReader(conn, 16<<20)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %v", req.Method, err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s: %s", req.Method, resp.Error)
+	}
+	return &resp, nil
+}
+
+// Status returns the monitor's status report
+func (c *Client) Status() (*dockforward.StatusReport, error) {
+	resp, err := c.call(Request{Method: GetStatus})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status == nil {
+		return nil, fmt.Errorf("monitor sent no status")
+	}
+	return resp.Status, nil
+}
+
+// CurrentServer returns the server the monitor forwards and whether it's connected
+func (c *Client) CurrentServer() (*dockforward.ServerInfo, error) {
+	resp, err := c.call(Request{Method: GetCurrentServer})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Server == nil {
+		return nil, fmt.Errorf("monitor sent no server")
+	}
+	return resp.Server, nil
+}
+
+// PortMappings returns the local port each service's forwarded remote ports are on
+func (c *Client) PortMappings() (map[string]map[string]string, error) {
+	resp, err := c.call(Request{Method: GetPortMappings})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Ports, nil
+}
+
+// SyncedDir returns the build context directory last synced to server while the monitor
+// ran, or "" if none was
+func (c *Client) SyncedDir(server string) (string, error) {
+	resp, err := c.call(Request{Method: GetSyncedDir, Server: server})
+	if err != nil {
+		return "", err
+	}
+	return resp.Dir, nil
+}
+
+// SetSyncedDir tells the monitor dir is the build context directory last synced to server
+func (c *Client) SetSyncedDir(server, dir string) error {
+	_, err := c.call(Request{Method: SetSyncedDir, Server: server, Dir: dir})
+	return err
+}
+
+// ForwardCompose asks the monitor to forward ports of the Compose project just brought up
+func (c *Client) ForwardCompose(project string, ports []dockforward.ComposePort) (*dockforward.ComposeForwards, error) {
+	resp, err := c.call(Request{Method: ForwardCompose, Project: project, ComposePorts: ports})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Compose == nil {
+		return nil, fmt.Errorf("monitor sent no forwards")
+	}
+	return resp.Compose, nil
+}
+
+// StopCompose asks the monitor to stop forwarding the Compose project just taken down,
+// returning the remote ports it stopped
+func (c *Client) StopCompose(project string, ports []dockforward.ComposePort) ([]string, error) {
+	resp, err := c.call(Request{Method: StopCompose, Project: project, ComposePorts: ports})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Stopped, nil
+}
+
+// MonitorVersion returns the version of the running monitor
+func (c *Client) MonitorVersion() (string, error) {
+	resp, err := c.call(Request{Method: GetVersion})
+	if err != nil {
+		return "", err
+	}
+	return resp.Version, nil
+}
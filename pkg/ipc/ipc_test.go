@@ -0,0 +1,253 @@
+package ipc
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	dockforward "dockforward/pkg"
+	"dockforward/pkg/version"
+)
+
+// fakeMonitor reports a status set by the test
+type fakeMonitor struct {
+	mu     sync.Mutex
+	report dockforward.StatusReport
+}
+
+func (m *fakeMonitor) StatusReport() dockforward.StatusReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.report
+}
+
+func (m *fakeMonitor) setReport(report dockforward.StatusReport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.report = report
+}
+
+// socketPath returns a socket path in a fresh directory removed when the test ends
+func socketPath(t *testing.T) string {
+	t.Helper()
+	// Unix socket paths are limited to about 100 bytes, which t.TempDir can exceed
+	dir, err := os.MkdirTemp("", "dockforward")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "monitor.sock")
+}
+
+func stagingReport() dockforward.StatusReport {
+	return dockforward.StatusReport{Source: "monitor", Servers: []dockforward.ServerReport{{
+		Name: "staging", Host: "staging.example.com:22", User: "deploy", Connected: true,
+		Services: []dockforward.ServiceReport{
+			{Name: "web", Ports: []dockforward.PortReport{
+				{Remote: "3000", Local: "3000", Status: dockforward.StatusReady},
+				{Remote: "8080", Local: "18080", Status: dockforward.StatusForwarded},
+			}},
+			{Name: "db", Ports: []dockforward.PortReport{
+				{Remote: "5432", Local: "5432", Status: dockforward.StatusConflict, Conflict: &dockforward.ProcessInfo{Name: "postgres", PID: "812"}},
+			}},
+		},
+	}}}
+}
+
+func TestServeStatus(t *testing.T) {
+	path := socketPath(t)
+	client := NewClient(path)
+	if _, err := client.Status(); err == nil {
+		t.Fatal("Status succeeded with no monitor running")
+	}
+
+	// A socket file left behind by a crashed monitor is replaced
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	listener, err := Serve(path, &fakeMonitor{report: stagingReport()})
+	if err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	defer listener.Close()
+
+	if _, err := Serve(path, &fakeMonitor{}); err == nil {
+		t.Error("a second monitor took over the control socket")
+	}
+
+	report, err := client.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if report.Source != "monitor" || len(report.Servers) != 1 || len(report.Servers[0].Services) != 2 {
+		t.Errorf("got report %+v, want staging's two services from the monitor", report)
+	}
+	if report.Conflicts() != 1 {
+		t.Errorf("Conflicts() = %d after the round trip, want 1", report.Conflicts())
+	}
+}
+
+func TestMonitorState(t *testing.T) {
+	path := socketPath(t)
+	monitor := &fakeMonitor{report: stagingReport()}
+	listener, err := Serve(path, monitor)
+	if err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	defer listener.Close()
+	client := NewClient(path)
+
+	server, err := client.CurrentServer()
+	if err != nil {
+		t.Fatalf("CurrentServer failed: %v", err)
+	}
+	if server.Name != "staging" || !server.Connected || !server.Current {
+		t.Errorf("CurrentServer = %+v, want staging connected", server)
+	}
+
+	// Conflicted ports aren't forwarded, so they aren't mapped
+	mappings, err := client.PortMappings()
+	if err != nil {
+		t.Fatalf("PortMappings failed: %v", err)
+	}
+	if want := map[string]map[string]string{"web": {"3000": "3000", "8080": "18080"}}; !reflect.DeepEqual(mappings, want) {
+		t.Errorf("PortMappings = %v, want %v", mappings, want)
+	}
+
+	if dir, err := client.SyncedDir("staging"); err != nil || dir != "" {
+		t.Errorf("SyncedDir before any sync = %q, %v, want none", dir, err)
+	}
+	if err := client.SetSyncedDir("staging", "/tmp/docker-context-abc"); err != nil {
+		t.Fatalf("SetSyncedDir failed: %v", err)
+	}
+	if dir, err := client.SyncedDir("staging"); err != nil || dir != "/tmp/docker-context-abc" {
+		t.Errorf("SyncedDir = %q, %v, want /tmp/docker-context-abc", dir, err)
+	}
+	if dir, _ := client.SyncedDir("prod"); dir != "" {
+		t.Errorf("SyncedDir(prod) = %q, want only staging's recorded", dir)
+	}
+	if _, err := client.SyncedDir(""); err == nil {
+		t.Error("SyncedDir without a server succeeded")
+	}
+
+	// Between connections there's no current server
+	monitor.setReport(dockforward.StatusReport{Source: "monitor"})
+	if _, err := client.CurrentServer(); err == nil {
+		t.Error("CurrentServer succeeded with no server")
+	}
+	if _, err := client.call(Request{Method: "Reboot"}); err == nil {
+		t.Error("an unknown method succeeded")
+	}
+}
+
+// composeMonitor records the Compose projects it's asked to forward and stop
+type composeMonitor struct {
+	fakeMonitor
+	forwarded map[string][]dockforward.ComposePort
+	stopped   []string
+}
+
+func (m *composeMonitor) ForwardCompose(project string, ports []dockforward.ComposePort) (dockforward.ComposeForwards, error) {
+	m.forwarded[project] = ports
+	return dockforward.ComposeForwards{
+		Forwards: []dockforward.ForwardReport{{ID: "shop-web-1:8080", Service: "shop-web-1", PortReport: dockforward.PortReport{Remote: "8080", Local: "8080"}}},
+		Warnings: []string{"cache publishes port 6379, but none of its running containers do"},
+	}, nil
+}
+
+func (m *composeMonitor) StopCompose(project string, ports []dockforward.ComposePort) ([]string, error) {
+	m.stopped = append(m.stopped, project)
+	return []string{"8080"}, nil
+}
+
+func TestComposeForwards(t *testing.T) {
+	path := socketPath(t)
+	monitor := &composeMonitor{forwarded: make(map[string][]dockforward.ComposePort)}
+	listener, err := Serve(path, monitor)
+	if err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	defer listener.Close()
+	client := NewClient(path)
+
+	ports := []dockforward.ComposePort{{Service: "web", Published: "8080", Target: "80", Protocol: "tcp"}}
+	forwards, err := client.ForwardCompose("shop", ports)
+	if err != nil {
+		t.Fatalf("ForwardCompose failed: %v", err)
+	}
+	if !reflect.DeepEqual(monitor.forwarded["shop"], ports) {
+		t.Errorf("monitor asked to forward %+v, want %+v", monitor.forwarded["shop"], ports)
+	}
+	if len(forwards.Forwards) != 1 || forwards.Forwards[0].Local != "8080" || len(forwards.Warnings) != 1 {
+		t.Errorf("ForwardCompose = %+v", forwards)
+	}
+
+	if stopped, err := client.StopCompose("shop", ports); err != nil || !reflect.DeepEqual(stopped, []string{"8080"}) {
+		t.Errorf("StopCompose = %q, %v; want 8080 stopped", stopped, err)
+	}
+	if _, err := client.StopCompose("", nil); err == nil {
+		t.Error("StopCompose succeeded without a project")
+	}
+
+	// A monitor that only reports status can't forward
+	other := socketPath(t)
+	plain, err := Serve(other, &fakeMonitor{})
+	if err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	defer plain.Close()
+	if _, err := NewClient(other).ForwardCompose("shop", ports); err == nil {
+		t.Error("a status-only monitor forwarded a Compose project")
+	}
+}
+
+// syncBuffer collects log output from the server's goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestVersionMismatch(t *testing.T) {
+	logs := &syncBuffer{}
+	defer func(logger *slog.Logger) { slog.SetDefault(logger) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, nil)))
+
+	path := socketPath(t)
+	listener, err := Serve(path, &fakeMonitor{report: stagingReport()})
+	if err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	defer listener.Close()
+	client := NewClient(path)
+
+	if v, err := client.MonitorVersion(); err != nil || v != version.Version {
+		t.Errorf("MonitorVersion = %q, %v, want %q", v, err, version.Version)
+	}
+	if logs.String() != "" {
+		t.Errorf("warned about the same version:\n%s", logs)
+	}
+	for range 2 {
+		if _, err := client.call(Request{Method: GetStatus, Version: "v0.9.0"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Count(logs.String(), "client=v0.9.0"); got != 1 {
+		t.Errorf("warned %d times about v0.9.0, want once:\n%s", got, logs)
+	}
+}
@@ -0,0 +1,178 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	dockforward "dockforward/pkg"
+	"dockforward/pkg/version"
+)
+
+// Monitor is what the server answers from, satisfied by *dockforward.DisplayManager and
+// *dockforward.Headless. Its report lists the current server first.
+type Monitor interface {
+	StatusReport() dockforward.StatusReport
+}
+
+// ComposeForwarder is a Monitor that can also forward Compose projects for the docker
+// wrapper, as *dockforward.Control can
+type ComposeForwarder interface {
+	Monitor
+	ForwardCompose(project string, ports []dockforward.ComposePort) (dockforward.ComposeForwards, error)
+	StopCompose(project string, ports []dockforward.ComposePort) ([]string, error)
+}
+
+// server answers requests from a monitor's state
+type server struct {
+	monitor Monitor
+	mu      sync.Mutex
+	synced  map[string]string // Context directory last synced to each server, by server name
+	warned  map[string]bool   // Other versions of dockforward that have been warned about
+}
+
+// Serve answers requests on a unix socket at path from monitor until the returned listener
+// is closed. A socket left behind by a monitor that crashed is replaced, but one that still
+// answers means another monitor is running.
+func Serve(path string, monitor Monitor) (net.Listener, error) {
+	listener, err := dockforward.ListenUnix(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &server{monitor: monitor, synced: make(map[string]string), warned: make(map[string]bool)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("Failed to accept ipc connection", "err", err)
+				}
+				return
+			}
+			go s.serveConn(conn)
+		}
+	}()
+	return listener, nil
+}
+
+// serveConn answers the request on conn
+func (s *server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		slog.Debug("Failed to read ipc request", "err", err)
+		return
+	}
+	var req Request
+	var resp *Response
+	if err := json.Unmarshal(line, &req); err != nil {
+		resp = &Response{Error: fmt.Sprintf("invalid request: %v", err)}
+	} else {
+		s.checkVersion(req.Version)
+		resp = s.handle(req)
+	}
+	resp.Version = version.Version
+	json.NewEncoder(conn).Encode(resp)
+}
+
+// checkVersion warns, once per version, when a request comes from another version of
+// dockforward than the monitor's, such as a docker wrapper left over from an older install
+func (s *server) checkVersion(v string) {
+	if v == "" || v == version.Version {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.warned[v] {
+		return
+	}
+	s.warned[v] = true
+	slog.Warn("dockforward's version differs from the monitor's; install both from the same build", "client", v, "monitor", version.Version)
+}
+
+// handle answers req
+func (s *server) handle(req Request) *Response {
+	switch req.Method {
+	case GetStatus:
+		report := s.monitor.StatusReport()
+		return &Response{Status: &report}
+	case GetCurrentServer:
+		current, ok := s.current()
+		if !ok {
+			return &Response{Error: "no current server"}
+		}
+		return &Response{Server: &dockforward.ServerInfo{Name: current.Name, Host: current.Host, User: current.User, Current: true, Connected: current.Connected}}
+	case GetPortMappings:
+		current, ok := s.current()
+		if !ok {
+			return &Response{Error: "no current server"}
+		}
+		return &Response{Ports: portMappings(current)}
+	case GetSyncedDir, SetSyncedDir:
+		if req.Server == "" {
+			return &Response{Error: "server is required"}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if req.Method == SetSyncedDir {
+			s.synced[req.Server] = req.Dir
+		}
+		return &Response{Dir: s.synced[req.Server]}
+	case ForwardCompose, StopCompose:
+		forwarder, ok := s.monitor.(ComposeForwarder)
+		if !ok {
+			return &Response{Error: "monitor can't forward Compose projects"}
+		}
+		if req.Project == "" {
+			return &Response{Error: "project is required"}
+		}
+		if req.Method == StopCompose {
+			stopped, err := forwarder.StopCompose(req.Project, req.ComposePorts)
+			if err != nil {
+				return &Response{Error: err.Error()}
+			}
+			return &Response{Stopped: stopped}
+		}
+		forwards, err := forwarder.ForwardCompose(req.Project, req.ComposePorts)
+		if err != nil {
+			return &Response{Error: err.Error()}
+		}
+		return &Response{Compose: &forwards}
+	case GetVersion:
+		return &Response{} // serveConn adds the version to every response
+	}
+	return &Response{Error: fmt.Sprintf("unknown method %q", req.Method)}
+}
+
+// current returns the report on the monitor's current server, if it has one
+func (s *server) current() (dockforward.ServerReport, bool) {
+	report := s.monitor.StatusReport()
+	if len(report.Servers) == 0 {
+		return dockforward.ServerReport{}, false
+	}
+	return report.Servers[0], true
+}
+
+// portMappings lists the local port of each port server forwards, by service
+func portMappings(server dockforward.ServerReport) map[string]map[string]string {
+	mappings := make(map[string]map[string]string)
+	for _, service := range server.Services {
+		for _, port := range service.Ports {
+			if port.Status != dockforward.StatusForwarded && port.Status != dockforward.StatusReady {
+				continue
+			}
+			if mappings[service.Name] == nil {
+				mappings[service.Name] = make(map[string]string)
+			}
+			mappings[service.Name][port.Remote] = port.Local
+		}
+	}
+	return mappings
+}
@@ -0,0 +1,106 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Binding ties the commands a screen accepts to the action they run and their help text
+type Binding struct {
+	Keys        []string // Accepted commands; "#" stands for a row number, so "# kill" matches "0 kill"
+	Label       string   // Footer label such as "[r]efresh", defaulting to "[<first key>]"
+	Description string
+	Action      func(args []string) bool // Gets the command's fields; nil for keys the main loop handles
+	Hidden      bool                     // Left out of the footer but still listed in help
+}
+
+// Keymap is the ordered set of bindings for a screen, driving both input dispatch and
+// the "Available Actions" footer so the two can't drift apart
+type Keymap []Binding
+
+// Dispatch runs the binding matching input, reporting whether it was handled. The binding
+// with the longest matching key wins, so "2 pin" goes to "# pin" rather than "#"; ties go
+// to the first binding.
+func (k Keymap) Dispatch(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+	best, bestLength := -1, 0
+	for i, binding := range k {
+		if binding.Action == nil {
+			continue
+		}
+		if length := binding.match(fields); length > bestLength {
+			best, bestLength = i, length
+		}
+	}
+	if best < 0 {
+		return false
+	}
+	return k[best].Action(fields)
+}
+
+// match returns the number of tokens in the longest key matching the start of fields, or 0
+func (b Binding) match(fields []string) int {
+	longest := 0
+	for _, key := range b.Keys {
+		tokens := strings.Fields(key)
+		if len(fields) < len(tokens) || len(tokens) <= longest {
+			continue
+		}
+		matched := true
+		for i, token := range tokens {
+			if token == "#" {
+				if n, err := strconv.Atoi(fields[i]); err != nil || n < 0 {
+					matched = false
+					break
+				}
+			} else if fields[i] != token {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			longest = len(tokens)
+		}
+	}
+	return longest
+}
+
+func (b Binding) label() string {
+	if b.Label != "" {
+		return b.Label
+	}
+	return "[" + b.Keys[0] + "]"
+}
+
+// Render writes one aligned "label - description" line per visible binding
+func (k Keymap) Render(w io.Writer) {
+	k.render(w, false)
+}
+
+// RenderAll is Render including hidden bindings, for the help screen
+func (k Keymap) RenderAll(w io.Writer) {
+	k.render(w, true)
+}
+
+func (k Keymap) render(w io.Writer, all bool) {
+	width := 0
+	for _, binding := range k {
+		if n := utf8.RuneCountInString(binding.label()); n > width && (all || !binding.Hidden) {
+			width = n
+		}
+	}
+	for _, binding := range k {
+		if binding.Hidden && !all {
+			continue
+		}
+		label := binding.label()
+		padding := strings.Repeat(" ", width-utf8.RuneCountInString(label))
+		fmt.Fprintf(w, "%s%s - %s\n", label, padding, binding.Description)
+	}
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestKeymapDispatch(t *testing.T) {
+	var got []string
+	record := func(name string) func([]string) bool {
+		return func(args []string) bool {
+			got = append([]string{name}, args...)
+			return true
+		}
+	}
+	keys := Keymap{
+		{Keys: []string{"#"}, Action: record("select")},
+		{Keys: []string{"r", "refresh"}, Action: record("refresh")},
+		{Keys: []string{"# kill"}, Action: record("kill")},
+		{Keys: []string{"q"}},
+	}
+
+	tests := []struct {
+		input   string
+		handled bool
+		want    []string
+	}{
+		{"3", true, []string{"select", "3"}},
+		{"0 kill", true, []string{"kill", "0", "kill"}},
+		{"refresh", true, []string{"refresh", "refresh"}},
+		{"  r  ", true, []string{"refresh", "r"}},
+		{"-1", false, nil},
+		{"x", false, nil},
+		{"q", false, nil},
+		{"", false, nil},
+	}
+	for _, tt := range tests {
+		got = nil
+		if handled := keys.Dispatch(tt.input); handled != tt.handled {
+			t.Errorf("Dispatch(%q) = %v, want %v", tt.input, handled, tt.handled)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Dispatch(%q) ran %v, want %v", tt.input, got, tt.want)
+		}
+	}
+
+	// The longest matching key wins whatever the order, so "#" doesn't shadow "# kill"
+	got = nil
+	Keymap{keys[2], keys[0]}.Dispatch("0 kill")
+	if want := []string{"kill", "0", "kill"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Dispatch(\"0 kill\") ran %v, want %v", got, want)
+	}
+}
+
+func TestKeymapRender(t *testing.T) {
+	keys := Keymap{
+		{Keys: []string{"b"}, Label: "[b]ack", Description: "Go back"},
+		{Keys: []string{"#"}, Description: "Select"},
+		{Keys: []string{"# kill"}, Label: "[#] kill-all", Description: "Hidden", Hidden: true},
+	}
+
+	var buf bytes.Buffer
+	keys.Render(&buf)
+	if want := "[b]ack - Go back\n[#]    - Select\n"; buf.String() != want {
+		t.Errorf("Render = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	keys.RenderAll(&buf)
+	if want := "[b]ack       - Go back\n[#]          - Select\n[#] kill-all - Hidden\n"; buf.String() != want {
+		t.Errorf("RenderAll = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/term"
+)
+
+// Column priorities for fitting tables into the terminal; lower priority columns shrink first
+const (
+	priorityLow = iota
+	priorityMedium
+	priorityHigh
+)
+
+// minColumnWidth is the narrowest a column shrinks to, unless its header is wider
+const minColumnWidth = 6
+
+// narrowWidth is the terminal width below which multi-line cells collapse to one line
+const narrowWidth = 120
+
+// terminalWidth returns the width of the terminal on stdout, or 0 if it isn't one
+var terminalWidth = func() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// serviceNameWidth is the widest a service name shows in the services table on a terminal
+// width columns wide, so long Compose container names leave room for the other columns.
+// It's 0, no limit, when the width isn't known.
+func serviceNameWidth(width int) int {
+	if width <= 0 {
+		return 0
+	}
+	return max(20, width-80)
+}
+
+// truncateName shortens a name to width characters, ending in "…" when it's cut. A width
+// of 0 or less means there's no limit.
+func truncateName(name string, width int) string {
+	runes := []rune(name)
+	if width <= 0 || len(runes) <= width {
+		return name
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// tableOverhead is the width tablewriter adds around columns: a separator and a space of
+// padding on each side of every column, and the closing border
+func tableOverhead(columns int) int {
+	return 3*columns + 1
+}
+
+// allocateWidths fits columns of the given natural widths into a table of width columns,
+// shrinking the lowest priority columns first, widest first, but none below its minimum.
+// A width of 0 or less means there's no limit.
+func allocateWidths(natural, minimum, priority []int, width int) []int {
+	widths := append([]int(nil), natural...)
+	if width <= 0 {
+		return widths
+	}
+	excess := tableOverhead(len(widths)) - width
+	for _, w := range widths {
+		excess += w
+	}
+
+	for level := priorityLow; level <= priorityHigh && excess > 0; level++ {
+		for excess > 0 {
+			widest := -1
+			for i, w := range widths {
+				if priority[i] == level && w > minimum[i] && (widest < 0 || w > widths[widest]) {
+					widest = i
+				}
+			}
+			if widest < 0 {
+				break
+			}
+			widths[widest]--
+			excess--
+		}
+	}
+	return widths
+}
+
+// escapeEnd returns the length of the escape sequence at the start of s, or 0 if there isn't one.
+// It covers CSI sequences such as colors and OSC sequences such as hyperlinks.
+func escapeEnd(s string) int {
+	if len(s) < 2 || s[0] != '\033' {
+		return 0
+	}
+	switch s[1] {
+	case '[':
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+		}
+	case ']':
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == '\033' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+	}
+	return len(s)
+}
+
+// visibleWidth returns the number of characters s shows, ignoring escape sequences
+func visibleWidth(s string) int {
+	width := 0
+	for len(s) > 0 {
+		if n := escapeEnd(s); n > 0 {
+			s = s[n:]
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		width++
+	}
+	return width
+}
+
+// truncateVisible shortens s to width visible characters, ending in "..." when it's cut.
+// Escape sequences are kept whole, and colors are reset after a cut.
+func truncateVisible(s string, width int) string {
+	if visibleWidth(s) <= width {
+		return s
+	}
+	keep := width - 3
+	ellipsis := "..."
+	if keep < 1 {
+		keep, ellipsis = width, ""
+	}
+
+	var b strings.Builder
+	escaped := false
+	for shown := 0; len(s) > 0 && shown < keep; {
+		if n := escapeEnd(s); n > 0 {
+			b.WriteString(s[:n])
+			s = s[n:]
+			escaped = true
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s)
+		b.WriteString(s[:size])
+		s = s[size:]
+		shown++
+	}
+	b.WriteString(ellipsis)
+	if escaped {
+		b.WriteString(ColorReset)
+	}
+	return b.String()
+}
+
+// cellWidth returns the visible width of a cell's widest line
+func cellWidth(cell string) int {
+	width := 0
+	for _, line := range strings.Split(cell, "\n") {
+		width = max(width, visibleWidth(line))
+	}
+	return width
+}
+
+// fitRows truncates cells so a table of headers and rows fits in width terminal columns,
+// shrinking columns by priority. Headers are never cut.
+func fitRows(headers []string, rows [][]string, priority []int, width int) [][]string {
+	natural := make([]int, len(headers))
+	minimum := make([]int, len(headers))
+	for i, header := range headers {
+		natural[i] = visibleWidth(header)
+		minimum[i] = max(natural[i], minColumnWidth)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			natural[i] = max(natural[i], cellWidth(cell))
+		}
+	}
+	for i := range minimum {
+		minimum[i] = min(minimum[i], natural[i])
+	}
+
+	widths := allocateWidths(natural, minimum, priority, width)
+	fitted := make([][]string, len(rows))
+	for r, row := range rows {
+		fitted[r] = make([]string, len(row))
+		for i, cell := range row {
+			if cellWidth(cell) <= widths[i] {
+				fitted[r][i] = cell
+				continue
+			}
+			lines := strings.Split(cell, "\n")
+			for j, line := range lines {
+				lines[j] = truncateVisible(line, widths[i])
+			}
+			fitted[r][i] = strings.Join(lines, "\n")
+		}
+	}
+	return fitted
+}
+
+// appendFitted adds rows to a table with the given headers, truncated to fit the terminal
+func (d *DisplayManager) appendFitted(table *tablewriter.Table, headers []string, rows [][]string, priority []int) {
+	for _, row := range fitRows(headers, rows, priority, d.width) {
+		table.Append(row)
+	}
+}
+
+// narrow reports whether the terminal is too narrow for multi-line cells
+func (d *DisplayManager) narrow() bool {
+	return d.width > 0 && d.width < narrowWidth
+}
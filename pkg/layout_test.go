@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAllocateWidths(t *testing.T) {
+	// The services table: #, Service, Health, Exposed Ports, Forward Status, Conflicts
+	natural := []int{1, 30, 9, 40, 14, 50}
+	minimum := []int{1, 7, 6, 13, 14, 9}
+	priority := []int{priorityHigh, priorityHigh, priorityMedium, priorityHigh, priorityMedium, priorityLow}
+
+	tests := []struct {
+		width int
+		want  []int
+	}{
+		// Everything fits
+		{200, []int{1, 30, 9, 40, 14, 50}},
+		// Conflicts gives up all it can, then Health makes up the rest
+		{120, []int{1, 30, 7, 40, 14, 9}},
+		// Service and Exposed Ports shrink last, evenly from the wider
+		{80, []int{1, 15, 6, 16, 14, 9}},
+	}
+	for _, tt := range tests {
+		got := allocateWidths(natural, minimum, priority, tt.width)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("allocateWidths at %d columns = %v, want %v", tt.width, got, tt.want)
+		}
+		total := tableOverhead(len(got))
+		for _, w := range got {
+			total += w
+		}
+		if total > tt.width {
+			t.Errorf("at %d columns the table is %d wide", tt.width, total)
+		}
+	}
+
+	// Columns never go below their minimums, even if the table can't fit
+	if got := allocateWidths(natural, minimum, priority, 20); !reflect.DeepEqual(got, minimum) {
+		t.Errorf("allocateWidths at 20 columns = %v, want the minimums %v", got, minimum)
+	}
+	// Without a known width nothing shrinks
+	if got := allocateWidths(natural, minimum, priority, 0); !reflect.DeepEqual(got, natural) {
+		t.Errorf("allocateWidths without a width = %v, want %v", got, natural)
+	}
+}
+
+func TestTruncateVisible(t *testing.T) {
+	red := "\033[31m"
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"postgres", 10, "postgres"},
+		{"postgres (PID 812)", 10, "postgre..."},
+		{red + "5432 (postgres, pid 812)" + ColorReset, 12, red + "5432 (pos..." + ColorReset},
+		{"漢字漢字漢字", 5, "漢字..."},
+		{"abcdef", 2, "ab"},
+	}
+	for _, tt := range tests {
+		if got := truncateVisible(tt.in, tt.width); got != tt.want {
+			t.Errorf("truncateVisible(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+		if got := visibleWidth(truncateVisible(tt.in, tt.width)); got > tt.width {
+			t.Errorf("truncateVisible(%q, %d) shows %d characters", tt.in, tt.width, got)
+		}
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"postgres", 10, "postgres"},
+		{"postgres -D /usr/local/var/postgres", 12, "postgres ..."},
+		{"café au lait", 6, "caf..."},
+		{"漢字漢字漢字", 5, "漢字..."},
+		{"postgres", 3, "pos"},
+		{"postgres", 1, "p"},
+		{"postgres", 0, ""},
+		{"postgres", -1, ""},
+	}
+	for _, tt := range tests {
+		got := truncateString(tt.in, tt.maxLen)
+		if got != tt.want {
+			t.Errorf("truncateString(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateString(%q, %d) split a character: %q", tt.in, tt.maxLen, got)
+		}
+	}
+}
+
+func TestFitRowsTruncatesEachLine(t *testing.T) {
+	headers := []string{"#", "Local Process"}
+	rows := [][]string{{"0", "postgres\nPID: 812\nCmd: postgres -D /usr/local/var/postgres"}}
+	got := fitRows(headers, rows, []int{priorityHigh, priorityLow}, 30)
+	lines := strings.Split(got[0][1], "\n")
+	if len(lines) != 3 || lines[0] != "postgres" || lines[2] != "Cmd: postgres -D /u..." {
+		t.Errorf("fitted cell = %q", got[0][1])
+	}
+}
+
+func TestTruncateName(t *testing.T) {
+	tests := []struct {
+		width int
+		want  int
+	}{
+		{0, 0},
+		{80, 20},
+		{100, 20},
+		{160, 80},
+	}
+	for _, tt := range tests {
+		if got := serviceNameWidth(tt.width); got != tt.want {
+			t.Errorf("serviceNameWidth(%d) = %d, want %d", tt.width, got, tt.want)
+		}
+	}
+
+	name := "myproject-some-long-service-name-1"
+	if got := truncateName(name, 20); got != "myproject-some-long…" {
+		t.Errorf("truncateName = %q", got)
+	}
+	if got := truncateName(name, 0); got != name {
+		t.Errorf("truncateName without a limit = %q", got)
+	}
+	if got := truncateName("web", 20); got != "web" {
+		t.Errorf("truncateName of a short name = %q", got)
+	}
+}
+
+func TestLongServiceNameTruncated(t *testing.T) {
+	docker := fixtureDockerClient()
+	name := "myproject-" + strings.Repeat("x", 100) + "-1"
+	docker.services["web"].Name = name
+	docker.services[name] = docker.services["web"]
+	delete(docker.services, "web")
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, width: 160}
+
+	output := renderScreen(&LandingScreen{display: dm, docker: docker})
+	if strings.Contains(output, name) || !strings.Contains(output, name[:79]+"…") {
+		t.Errorf("services table doesn't cut the name to 80 characters:\n%s", output)
+	}
+
+	dm.selectedService = docker.services[name]
+	if output := renderScreen(&ServiceDetailScreen{display: dm, docker: docker}); !strings.Contains(output, name) {
+		t.Errorf("service detail doesn't show the full name:\n%s", output)
+	}
+}
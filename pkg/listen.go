@@ -0,0 +1,39 @@
+package pkg
+
+import (
+	"net"
+	"strings"
+)
+
+// LoopbackAddr reports whether addr only accepts connections from this machine
+func LoopbackAddr(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// AllowedHost reports whether a request's Host header names this machine as served on
+// listenAddr: a loopback address, localhost or listenAddr's own host, or any address when it
+// listens on all of them. A site that resolves its own name to this machine (DNS rebinding)
+// still sends that name as Host, so its pages' requests are refused.
+func AllowedHost(host, listenAddr string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	listenHost, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return false
+	}
+	if listenIP := net.ParseIP(listenHost); listenHost == "" || listenIP != nil && listenIP.IsUnspecified() {
+		return ip != nil
+	}
+	return host != "" && strings.EqualFold(host, listenHost)
+}
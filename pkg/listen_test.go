@@ -0,0 +1,50 @@
+package pkg
+
+import (
+	"net"
+	"testing"
+)
+
+func TestLoopbackAddr(t *testing.T) {
+	for addr, want := range map[net.Addr]bool{
+		&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}:   true,
+		&net.TCPAddr{IP: net.IPv6loopback}:         true,
+		&net.TCPAddr{IP: net.IPv4zero}:             false,
+		&net.TCPAddr{IP: net.IPv4(192, 168, 1, 5)}: false,
+		&net.UnixAddr{Name: "/tmp/sock"}:           false,
+	} {
+		if got := LoopbackAddr(addr); got != want {
+			t.Errorf("LoopbackAddr(%v) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestAllowedHost(t *testing.T) {
+	tests := []struct {
+		host, listenAddr string
+		want             bool
+	}{
+		{"127.0.0.1:8766", "127.0.0.1:8766", true},
+		{"localhost:8766", "127.0.0.1:8766", true},
+		{"[::1]:8766", "127.0.0.1:8766", true},
+		{"localhost", "127.0.0.1:8766", true},
+		// A rebound name reaches the same address but says who it is
+		{"evil.example.com:8766", "127.0.0.1:8766", false},
+		{"192.168.1.5:8766", "127.0.0.1:8766", false},
+		// The configured address, by name or address
+		{"devbox.lan:8766", "devbox.lan:8766", true},
+		{"DEVBOX.lan.:8766", "devbox.lan:8766", true},
+		{"192.168.1.5:8766", "192.168.1.5:8766", true},
+		{"evil.example.com:8766", "devbox.lan:8766", false},
+		// Listening on every address, any of them may be used but no name is
+		{"192.168.1.5:8766", ":8766", true},
+		{"[fe80::1]:8766", "0.0.0.0:8766", true},
+		{"evil.example.com:8766", ":8766", false},
+		{"", ":8766", false},
+	}
+	for _, tt := range tests {
+		if got := AllowedHost(tt.host, tt.listenAddr); got != tt.want {
+			t.Errorf("AllowedHost(%q, %q) = %v, want %v", tt.host, tt.listenAddr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errLocked is returned by lockFile when another process holds a conflicting lock
+var errLocked = errors.New("locked by another process")
+
+// LockHolder identifies the monitor forwarding a server's ports
+type LockHolder struct {
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// RequestRelease signals the holder to stop forwarding and release its lock
+func (h LockHolder) RequestRelease() error {
+	if err := signalRelease(h.PID); err != nil {
+		return fmt.Errorf("failed to signal pid %d: %v", h.PID, err)
+	}
+	return nil
+}
+
+// LockHeldError is returned when another monitor already forwards a server's ports
+type LockHeldError struct {
+	Server string
+	Holder LockHolder
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("%s is already forwarded by another monitor (pid %d, started %s)", e.Server, e.Holder.PID, e.Holder.Started.Format(time.DateTime))
+}
+
+// ServerLock is an exclusive lock on forwarding a server's ports, so two monitors don't
+// fight over the same local ports. It's an flock on a file under the config directory,
+// which the OS releases if the monitor dies.
+type ServerLock struct {
+	server string
+	file   *os.File
+}
+
+// acquireServerLock takes a server's lock, a variable so tests don't lock the real servers
+var acquireServerLock = AcquireServerLock
+
+// serverLockPath returns the lock file for a server, its name escaped to be a file name
+func serverLockPath(server string) (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "server-"+url.PathEscape(server)+".lock"), nil
+}
+
+// AcquireServerLock takes the lock on forwarding server's ports, recording this process as
+// the holder. If another monitor holds it, the error is a *LockHeldError naming it.
+func AcquireServerLock(server string) (*ServerLock, error) {
+	path, err := serverLockPath(server)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+	if err := lockFile(file, true); err != nil {
+		defer file.Close()
+		if errors.Is(err, errLocked) {
+			return nil, &LockHeldError{Server: server, Holder: readLockHolder(file)}
+		}
+		return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+	}
+
+	holder, _ := json.Marshal(LockHolder{PID: os.Getpid(), Started: time.Now().Truncate(time.Second)})
+	if err := file.Truncate(0); err == nil {
+		_, err = file.WriteAt(holder, 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write lock file: %v", err)
+	}
+	return &ServerLock{server: server, file: file}, nil
+}
+
+// ServerLockHolder returns the monitor forwarding server's ports, or nil if none is
+func ServerLockHolder(server string) (*LockHolder, error) {
+	path, err := serverLockPath(server)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+	defer file.Close()
+
+	// A shared lock is only refused while a monitor holds the exclusive one
+	err = lockFile(file, false)
+	if err == nil {
+		unlockFile(file)
+		return nil, nil
+	}
+	if !errors.Is(err, errLocked) {
+		return nil, fmt.Errorf("failed to check %s: %v", path, err)
+	}
+	holder := readLockHolder(file)
+	return &holder, nil
+}
+
+// readLockHolder reads the holder recorded in a lock file, zero if it can't be read
+func readLockHolder(file *os.File) LockHolder {
+	var holder LockHolder
+	if data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<10)); err == nil {
+		json.Unmarshal(data, &holder)
+	}
+	return holder
+}
+
+// Server returns the name of the server locked
+func (l *ServerLock) Server() string {
+	if l == nil {
+		return ""
+	}
+	return l.server
+}
+
+// Release gives up the lock, leaving the file for the next monitor to lock. It's safe to
+// call on a nil lock.
+func (l *ServerLock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	l.file.Truncate(0)
+	unlockFile(l.file)
+	l.file.Close()
+	l.file = nil
+}
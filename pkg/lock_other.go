@@ -0,0 +1,24 @@
+//go:build !unix
+
+package pkg
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile always succeeds here, there's no flock to keep two monitors apart
+func lockFile(file *os.File, exclusive bool) error {
+	return nil
+}
+
+// unlockFile does nothing here, lockFile took no lock
+func unlockFile(file *os.File) {}
+
+// signalRelease can't reach another monitor here, there's no signal to send
+func signalRelease(pid int) error {
+	return errors.New("taking over isn't supported on this platform")
+}
+
+// NotifyRelease does nothing here, there's no signal to listen for
+func NotifyRelease(c chan<- os.Signal) {}
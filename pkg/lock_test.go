@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestServerLock(t *testing.T) {
+	t.Setenv(configDirEnv, t.TempDir())
+
+	lock, err := AcquireServerLock("staging/eu")
+	if err != nil {
+		t.Fatalf("AcquireServerLock failed: %v", err)
+	}
+	var held *LockHeldError
+	if _, err := AcquireServerLock("staging/eu"); !errors.As(err, &held) || held.Holder.PID != os.Getpid() {
+		t.Fatalf("second lock = %v, want it held by this process", err)
+	}
+	if holder, err := ServerLockHolder("staging/eu"); err != nil || holder == nil || holder.PID != os.Getpid() || holder.Started.IsZero() {
+		t.Errorf("ServerLockHolder = %+v, %v, want this process", holder, err)
+	}
+
+	// Servers are locked independently
+	other, err := AcquireServerLock("default")
+	if err != nil {
+		t.Fatalf("locking another server failed: %v", err)
+	}
+	other.Release()
+
+	lock.Release()
+	if holder, err := ServerLockHolder("staging/eu"); err != nil || holder != nil {
+		t.Errorf("ServerLockHolder after release = %+v, %v, want none", holder, err)
+	}
+	lock, err = AcquireServerLock("staging/eu")
+	if err != nil {
+		t.Fatalf("relocking after release failed: %v", err)
+	}
+	lock.Release()
+}
+
+func TestDisplayClaimServer(t *testing.T) {
+	held := &LockHeldError{Server: "staging", Holder: LockHolder{PID: 4242}}
+	acquireServerLock = func(server string) (*ServerLock, error) { return nil, held }
+	t.Cleanup(func() { acquireServerLock = func(string) (*ServerLock, error) { return nil, nil } })
+
+	dm, _ := newRemapFixture(t)
+	client := dm.docker.(*DockerClient)
+	dm.claimServer(client, "staging")
+	if !client.ReadOnly() {
+		t.Fatal("client forwards although another monitor holds the lock")
+	}
+	if _, ok := dm.topModal().(*ConfirmScreen); !ok {
+		t.Fatalf("held lock opened %T, want an offer to take over", dm.topModal())
+	}
+	if _, err := client.StartForward("web", "3000", ""); err == nil {
+		t.Error("a read-only client started a forward")
+	}
+	client.forwardPorts(client.services["web"])
+	if got := client.services["web"].ForwardedPorts[0].Status; got != StatusNotForwarded {
+		t.Errorf("read-only refresh left port status %q, want %q", got, StatusNotForwarded)
+	}
+
+	// Once the other monitor is gone, taking over needs no signal
+	acquireServerLock = func(server string) (*ServerLock, error) { return &ServerLock{server: server}, nil }
+	dm.takeOverServer()
+	if client.ReadOnly() || dm.lock.Server() != "staging" {
+		t.Errorf("after taking over read-only = %v with lock %q", client.ReadOnly(), dm.lock.Server())
+	}
+
+	dm.ReleaseServer()
+	if !client.ReadOnly() || dm.lock != nil {
+		t.Errorf("after releasing read-only = %v with lock %v", client.ReadOnly(), dm.lock)
+	}
+}
+
+func TestHeadlessRefusesHeldServer(t *testing.T) {
+	acquireServerLock = func(server string) (*ServerLock, error) {
+		return nil, &LockHeldError{Server: server, Holder: LockHolder{PID: 4242}}
+	}
+	t.Cleanup(func() { acquireServerLock = func(string) (*ServerLock, error) { return nil, nil } })
+
+	h, _ := newTestHeadless(fixtureConfig())
+	h.connect = func(ctx context.Context, server *ServerConfig) (*DockerClient, error) {
+		t.Error("connected although another monitor holds the server")
+		return &DockerClient{}, nil
+	}
+	var held *LockHeldError
+	if err := h.Connect(context.Background(), 3); !errors.As(err, &held) {
+		t.Errorf("Connect = %v, want the lock holder", err)
+	}
+}
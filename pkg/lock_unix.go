@@ -0,0 +1,41 @@
+//go:build unix
+
+package pkg
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile takes an exclusive or shared flock on file without waiting, failing with
+// errLocked if another process holds a conflicting one
+func lockFile(file *os.File, exclusive bool) error {
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+	err := unix.Flock(int(file.Fd()), how|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return errLocked
+	}
+	return err
+}
+
+// unlockFile releases the flock on file
+func unlockFile(file *os.File) {
+	unix.Flock(int(file.Fd()), unix.LOCK_UN)
+}
+
+// signalRelease asks the monitor with pid to release its server lock
+func signalRelease(pid int) error {
+	return unix.Kill(pid, unix.SIGUSR1)
+}
+
+// NotifyRelease delivers a signal on c whenever another monitor asks to take over the
+// server this one forwards
+func NotifyRelease(c chan<- os.Signal) {
+	signal.Notify(c, unix.SIGUSR1)
+}
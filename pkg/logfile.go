@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// LogFile is a log file that's rotated once it reaches a size: path is renamed to path.1,
+// path.1 to path.2 and so on, dropping the oldest beyond the backups kept
+type LogFile struct {
+	path    string
+	maxSize int64
+	backups int
+	mu      sync.Mutex // Guards file and size, as loggers write from any goroutine
+	file    *os.File
+	size    int64
+}
+
+// OpenLogFile opens path for appending, rotating it before it grows past maxSize bytes and
+// keeping backups rotated files. A maxSize of 0 never rotates.
+func OpenLogFile(path string, maxSize int64, backups int) (*LogFile, error) {
+	l := &LogFile{path: path, maxSize: maxSize, backups: backups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the file at path for appending, picking up its current size
+func (l *LogFile) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would take the file past its maximum size
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return 0, os.ErrClosed
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups along, moves the current file to path.1 and starts a new one
+func (l *LogFile) rotate() error {
+	l.file.Close()
+	l.file = nil
+	if l.backups > 0 {
+		for i := l.backups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("failed to rotate log file: %v", err)
+	}
+	return l.open()
+}
+
+// Close closes the file
+func (l *LogFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
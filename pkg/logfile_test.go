@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dockforward.log")
+	file, err := OpenLogFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("OpenLogFile failed: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := io.WriteString(file, line); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	// Each line fills most of the 10 bytes, so every write after the first rotates, and only
+	// two rotated files are kept
+	want := map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"}
+	for name, content := range want {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(name), data, err, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept a third rotated file: %v", err)
+	}
+
+	// Reopening appends, counting what's already there
+	file.Close()
+	file, err = OpenLogFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("reopening failed: %v", err)
+	}
+	io.WriteString(file, "x\n")
+	if data, _ := os.ReadFile(path); !strings.HasSuffix(string(data), "fourth\nx\n") {
+		t.Errorf("reopened file = %q, want the new line appended", data)
+	}
+}
@@ -0,0 +1,199 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MessageLevel ranks log messages
+type MessageLevel int
+
+const (
+	LevelDebug MessageLevel = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l MessageLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "INFO"
+}
+
+// SlogLevel returns the slog level matching l
+func (l MessageLevel) SlogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Message is a log message kept in the message history
+type Message struct {
+	Time  time.Time
+	Level MessageLevel
+	Text  string
+}
+
+// messageHistory is the number of messages kept for the message history screen
+const messageHistory = 50
+
+// messageLog is a ring buffer of the most recent messages
+type messageLog struct {
+	entries []Message
+	next    int // Slot the next message goes in once the buffer is full
+}
+
+func (l *messageLog) add(msg Message) {
+	if len(l.entries) < messageHistory {
+		l.entries = append(l.entries, msg)
+		return
+	}
+	l.entries[l.next] = msg
+	l.next = (l.next + 1) % messageHistory
+}
+
+// recent returns up to n of the newest messages, oldest first; n <= 0 returns them all
+func (l *messageLog) recent(n int) []Message {
+	ordered := append(append([]Message(nil), l.entries[l.next:]...), l.entries[:l.next]...)
+	if n > 0 && len(ordered) > n {
+		ordered = ordered[len(ordered)-n:]
+	}
+	return ordered
+}
+
+var (
+	logHookMu sync.RWMutex
+	logHook   func(level MessageLevel, text string)
+	logLevel  atomic.Int64 // Least severe MessageLevel logged, LevelInfo by default
+)
+
+// SetLogHook sends messages logged by this package to hook, such as DisplayManager.Log while
+// the TUI owns the screen. A nil hook sends them to slog's default logger again.
+func SetLogHook(hook func(level MessageLevel, text string)) {
+	logHookMu.Lock()
+	defer logHookMu.Unlock()
+	logHook = hook
+}
+
+// SetLogLevel drops messages less severe than level, e.g. LevelDebug for --verbose or
+// LevelWarn for --quiet, here and in slog's default handler
+func SetLogLevel(level MessageLevel) {
+	logLevel.Store(int64(level))
+	slog.SetLogLoggerLevel(level.SlogLevel())
+}
+
+// LogLevelFor returns the level the --verbose and --quiet flags ask for, verbose winning
+func LogLevelFor(verbose, quiet bool) MessageLevel {
+	switch {
+	case verbose:
+		return LevelDebug
+	case quiet:
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+// logAttrs logs msg with slog-style key-value attrs, such as "server", "service", "port"
+// and "err", through the hook if one is set, or slog's default logger otherwise
+func logAttrs(level MessageLevel, msg string, attrs ...any) {
+	if level < MessageLevel(logLevel.Load()) {
+		return
+	}
+	logHookMu.RLock()
+	hook := logHook
+	logHookMu.RUnlock()
+	if hook != nil {
+		hook(level, msg+formatAttrs(attrs))
+		return
+	}
+	slog.Default().Log(context.Background(), level.SlogLevel(), msg, attrs...)
+}
+
+// formatAttrs renders key-value attrs as " key=value" pairs for the message history,
+// quoting values with spaces
+func formatAttrs(attrs []any) string {
+	var b strings.Builder
+	for _, attr := range slog.Group("", attrs...).Value.Group() {
+		value := attr.Value.String()
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", attr.Key, value)
+	}
+	return b.String()
+}
+
+// logf logs a formatted message without attrs
+func logf(level MessageLevel, format string, args ...any) {
+	logAttrs(level, fmt.Sprintf(format, args...))
+}
+
+func logDebug(msg string, attrs ...any) { logAttrs(LevelDebug, msg, attrs...) }
+func logInfo(format string, args ...any)  { logf(LevelInfo, format, args...) }
+func logWarn(format string, args ...any)  { logf(LevelWarn, format, args...) }
+func logError(format string, args ...any) { logf(LevelError, format, args...) }
+
+// MessagesScreen lists the message history with timestamps
+type MessagesScreen struct {
+	display  *DisplayManager
+	previous DisplayMode
+}
+
+func NewMessagesScreen(display *DisplayManager, previous DisplayMode) *MessagesScreen {
+	return &MessagesScreen{display: display, previous: previous}
+}
+
+func (s *MessagesScreen) Display(w io.Writer) {
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header("Messages"))
+
+	messages := s.display.recentMessages(0)
+	if len(messages) == 0 {
+		fmt.Fprintln(w, "No messages yet.")
+	}
+	for _, msg := range messages {
+		fmt.Fprintf(w, "%s %s %s\n", msg.Time.Format("15:04:05"), s.display.colorizeLevel(msg.Level, fmt.Sprintf("%-5s", msg.Level)), msg.Text)
+	}
+
+	s.display.renderActions(w, s.Keys())
+}
+
+// Keys returns the commands available on the message history screen
+func (s *MessagesScreen) Keys() Keymap {
+	return Keymap{
+		{Keys: []string{"b", "back", "m"}, Label: "[b]ack", Description: "Close the message history", Action: func([]string) bool {
+			s.display.SetMode(s.previous)
+			return true
+		}},
+	}
+}
+
+func (s *MessagesScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *MessagesScreen) NeedsRefresh() bool {
+	return false
+}
+
+// Close is a no-op, the message history has no background work
+func (s *MessagesScreen) Close() {}
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageLogKeepsNewest(t *testing.T) {
+	var l messageLog
+	for i := 0; i < messageHistory+5; i++ {
+		l.add(Message{Text: fmt.Sprint(i)})
+	}
+	all := l.recent(0)
+	if len(all) != messageHistory {
+		t.Fatalf("kept %d messages, want %d", len(all), messageHistory)
+	}
+	if all[0].Text != "5" || all[len(all)-1].Text != fmt.Sprint(messageHistory+4) {
+		t.Errorf("kept %s..%s, want the newest oldest first", all[0].Text, all[len(all)-1].Text)
+	}
+	last := l.recent(messagesShown)
+	if len(last) != messagesShown || last[messagesShown-1].Text != all[len(all)-1].Text {
+		t.Errorf("recent(%d) = %v, want the newest %d", messagesShown, last, messagesShown)
+	}
+}
+
+func TestLogHookRoutesIntoMessages(t *testing.T) {
+	dm := &DisplayManager{config: fixtureConfig(), colors: NewColorizer(false)}
+	SetLogHook(dm.Log)
+	t.Cleanup(func() { SetLogHook(nil) })
+
+	logError("Failed to forward ports for %s: %v", "web", "exit status 255")
+	logInfo("Docker API connection initialized")
+	fmt.Fprintln(dm.MessageWriter(), "from the standard logger")
+
+	messages := dm.recentMessages(0)
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+	if messages[0].Level != LevelError || messages[0].Text != "Failed to forward ports for web: exit status 255" {
+		t.Errorf("first message = %+v", messages[0])
+	}
+	if messages[2].Level != LevelInfo || messages[2].Text != "from the standard logger" {
+		t.Errorf("last message = %+v", messages[2])
+	}
+}
+
+func TestLogLevelAndAttrs(t *testing.T) {
+	var logged []Message
+	SetLogHook(func(level MessageLevel, text string) { logged = append(logged, Message{Level: level, Text: text}) })
+	t.Cleanup(func() {
+		SetLogHook(nil)
+		SetLogLevel(LevelInfo)
+	})
+
+	logDebug("Started port forward", "server", "me@host", "port", "3000")
+	logAttrs(LevelError, "Port forward exited", "server", "me@host", "port", "3000", "err", errors.New("exit status 255"))
+	if len(logged) != 1 || logged[0].Text != `Port forward exited server=me@host port=3000 err="exit status 255"` {
+		t.Fatalf("at the default level logged %+v, want only the error with its attrs", logged)
+	}
+
+	logged = nil
+	SetLogLevel(LogLevelFor(true, true))
+	logDebug("Started port forward", "server", "me@host", "port", "3000")
+	if len(logged) != 1 || logged[0].Level != LevelDebug || logged[0].Text != "Started port forward server=me@host port=3000" {
+		t.Errorf("with --verbose logged %+v, want the debug message", logged)
+	}
+
+	logged = nil
+	SetLogLevel(LogLevelFor(false, true))
+	logInfo("Docker API connection initialized")
+	logWarn("Docker event stream ended")
+	if len(logged) != 1 || logged[0].Level != LevelWarn {
+		t.Errorf("with --quiet logged %+v, want only the warning", logged)
+	}
+}
+
+func TestMessagesScreen(t *testing.T) {
+	dm := &DisplayManager{config: fixtureConfig(), colors: NewColorizer(false), input: NewInputHandler()}
+	at := time.Date(2026, 10, 18, 9, 30, 5, 0, time.UTC)
+	dm.messages.add(Message{Time: at, Level: LevelWarn, Text: "Docker event stream ended: EOF"})
+	dm.messages.add(Message{Time: at.Add(time.Second), Level: LevelError, Text: "Failed to save sort order: permission denied"})
+
+	dm.SetMode(ModeServerList)
+	dm.HandleInput("m")
+	if dm.Mode() != ModeMessages {
+		t.Fatalf("m opened mode %v, want the message history", dm.Mode())
+	}
+	var out bytes.Buffer
+	dm.currentScreen.Display(&out)
+	for _, want := range []string{
+		"09:30:05 WARN  Docker event stream ended: EOF",
+		"09:30:06 ERROR Failed to save sort order: permission denied",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("history doesn't show %q:\n%s", want, out.String())
+		}
+	}
+
+	// Help opened from the history doesn't become where it returns to
+	dm.HandleInput("?")
+	dm.HandleInput("b")
+	dm.HandleInput("b")
+	if dm.Mode() != ModeServerList {
+		t.Errorf("back from the history went to mode %v, want the server list", dm.Mode())
+	}
+}
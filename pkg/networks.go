@@ -0,0 +1,295 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// NetworkInfo is a Docker network and the running containers attached to it
+type NetworkInfo struct {
+	ID         string
+	Name       string
+	Driver     string
+	Scope      string
+	Containers map[string]string // Container name -> IPv4 address on the network, empty if it has none
+}
+
+// GetNetworks lists the remote host's networks, sorted by name. Docker's network listing
+// leaves out attached containers, so they're filled in from a single container listing.
+func (d *DockerClient) GetNetworks() ([]*NetworkInfo, error) {
+	var listed []struct {
+		ID     string `json:"Id"`
+		Name   string
+		Driver string
+		Scope  string
+	}
+	if err := d.apiRequest(d.requestContext(), http.MethodGet, "/networks", &listed); err != nil {
+		return nil, err
+	}
+	networks := make([]*NetworkInfo, 0, len(listed))
+	byID := make(map[string]*NetworkInfo, len(listed))
+	for _, n := range listed {
+		network := &NetworkInfo{ID: n.ID, Name: n.Name, Driver: n.Driver, Scope: n.Scope, Containers: make(map[string]string)}
+		networks = append(networks, network)
+		byID[network.ID] = network
+	}
+
+	containers, err := d.listContainers(d.requestContext(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range containers {
+		name := strings.TrimPrefix(container.Names[0], "/")
+		for _, endpoint := range container.NetworkSettings.Networks {
+			if network, ok := byID[endpoint.NetworkID]; ok {
+				network.Containers[name] = endpoint.IPAddress
+			}
+		}
+	}
+
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i].Name < networks[j].Name
+	})
+	return networks, nil
+}
+
+// NetworkListScreen lists the remote host's networks, and the containers attached to the
+// one selected
+type NetworkListScreen struct {
+	display  *DisplayManager
+	docker   ContainerAPI
+	mu       sync.Mutex // Guards the fields below, set by the background fetch
+	networks []*NetworkInfo
+	err      error
+	loaded   bool
+	selected string // Name of the network whose containers are shown, empty for the list
+}
+
+func NewNetworkListScreen(display *DisplayManager, docker ContainerAPI) *NetworkListScreen {
+	s := &NetworkListScreen{display: display, docker: docker}
+	if docker != nil {
+		go s.refresh()
+	}
+	return s
+}
+
+// refresh fetches the networks and redraws
+func (s *NetworkListScreen) refresh() {
+	networks, err := s.docker.GetNetworks()
+	s.mu.Lock()
+	s.networks, s.err, s.loaded = networks, err, true
+	s.mu.Unlock()
+	s.display.Display()
+}
+
+// network returns the network named name, or nil if there's none
+func (s *NetworkListScreen) network(name string) *NetworkInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, network := range s.networks {
+		if network.Name == name {
+			return network
+		}
+	}
+	return nil
+}
+
+// attached returns the selected network and the names of its containers, sorted
+func (s *NetworkListScreen) attached() (*NetworkInfo, []string) {
+	s.mu.Lock()
+	selected := s.selected
+	s.mu.Unlock()
+	network := s.network(selected)
+	if network == nil {
+		return nil, nil
+	}
+	var names []string
+	for name := range network.Containers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return network, names
+}
+
+func (s *NetworkListScreen) Display(w io.Writer) {
+	if s.docker == nil {
+		fmt.Fprintln(w, "Error: Docker client is not initialized")
+		return
+	}
+	if network, names := s.attached(); network != nil {
+		s.displayContainers(w, network, names)
+		return
+	}
+
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header("Networks"))
+	s.mu.Lock()
+	networks, err, loaded := s.networks, s.err, s.loaded
+	s.mu.Unlock()
+	switch {
+	case !loaded:
+		fmt.Fprintln(w, "Loading networks...")
+	case err != nil:
+		fmt.Fprintf(w, "Error getting networks: %v\n", err)
+	case len(networks) == 0:
+		fmt.Fprintln(w, "No networks found.")
+	default:
+		s.display.setRowLines(rowRange(2+tableHeaderLines, len(networks)))
+		headers := []string{"#", "Name", "Driver", "Scope", "Containers"}
+		var rows [][]string
+		for i, network := range networks {
+			selected := i == s.display.Cursor()
+			rows = append(rows, []string{
+				s.display.highlight(strconv.Itoa(i), selected),
+				s.display.highlight(network.Name, selected),
+				network.Driver,
+				network.Scope,
+				strconv.Itoa(len(network.Containers)),
+			})
+		}
+		s.renderTable(w, headers, rows, []int{priorityHigh, priorityHigh, priorityMedium, priorityLow, priorityMedium})
+	}
+
+	s.display.renderActions(w, s.Keys())
+}
+
+// displayContainers lists the containers attached to network
+func (s *NetworkListScreen) displayContainers(w io.Writer, network *NetworkInfo, names []string) {
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header(fmt.Sprintf("Network: %s (%s, %s)", network.Name, network.Driver, network.Scope)))
+	if len(names) == 0 {
+		fmt.Fprintln(w, "No containers attached.")
+	} else {
+		s.display.setRowLines(rowRange(2+tableHeaderLines, len(names)))
+		headers := []string{"#", "Container", "Address"}
+		var rows [][]string
+		for i, name := range names {
+			selected := i == s.display.Cursor()
+			address := network.Containers[name]
+			if address == "" {
+				address = "-"
+			}
+			rows = append(rows, []string{
+				s.display.highlight(strconv.Itoa(i), selected),
+				s.display.highlight(name, selected),
+				address,
+			})
+		}
+		s.renderTable(w, headers, rows, []int{priorityHigh, priorityHigh, priorityMedium})
+	}
+
+	s.display.renderActions(w, s.Keys())
+}
+
+// renderTable draws a bordered table fitted to the terminal
+func (s *NetworkListScreen) renderTable(w io.Writer, headers []string, rows [][]string, priority []int) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(headers)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("─")
+	table.SetColumnSeparator("│")
+	table.SetRowSeparator("─")
+	table.SetHeaderLine(true)
+	table.SetBorder(true)
+	s.display.appendFitted(table, headers, rows, priority)
+	table.Render()
+}
+
+// containerAt returns the name of the attached container at the highlighted row, or the
+// row given as args[0], or "" if there's none
+func (s *NetworkListScreen) containerAt(args []string) string {
+	_, names := s.attached()
+	row := s.display.Cursor()
+	if idx, err := strconv.Atoi(args[0]); err == nil {
+		row = idx
+	} else if row < 0 {
+		row = 0
+	}
+	if row < 0 || row >= len(names) {
+		return ""
+	}
+	return names[row]
+}
+
+// Keys returns the commands available on the network list, or on a network's containers
+func (s *NetworkListScreen) Keys() Keymap {
+	if network, _ := s.attached(); network != nil {
+		return Keymap{
+			{Keys: []string{"i", "# i"}, Label: "[i]nspect", Description: "Show the highlighted container's service details (e.g., '1 i' for container 1)", Action: func(args []string) bool {
+				name := s.containerAt(args)
+				if name == "" {
+					return false
+				}
+				service := s.docker.GetService(name)
+				if service == nil {
+					logWarn("%s isn't among the services shown", name)
+					return true
+				}
+				s.display.selectService(service, -1)
+				s.display.SetMode(ModeServiceDetail)
+				return true
+			}},
+			{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to the network list", Action: func([]string) bool {
+				s.mu.Lock()
+				s.selected = ""
+				s.mu.Unlock()
+				s.display.moveCursorTo(0)
+				return true
+			}},
+		}
+	}
+
+	return Keymap{
+		{Keys: []string{"#"}, Description: "Show the containers attached to a network", Action: func(args []string) bool {
+			idx := parseIndex(args[0])
+			s.mu.Lock()
+			if idx < 0 || idx >= len(s.networks) {
+				s.mu.Unlock()
+				return false
+			}
+			s.selected = s.networks[idx].Name
+			s.mu.Unlock()
+			// The container rows start from the top
+			s.display.moveCursorTo(0)
+			return true
+		}},
+		{Keys: []string{"r", "refresh"}, Label: "[r]efresh", Description: "Refresh networks now", Action: func([]string) bool {
+			go s.refresh()
+			return true
+		}},
+		{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to overview", Action: func([]string) bool {
+			s.display.SetMode(ModeOverview)
+			return true
+		}},
+	}
+}
+
+func (s *NetworkListScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *NetworkListScreen) NeedsRefresh() bool {
+	return false
+}
+
+// Close is a no-op, networks are only fetched on request
+func (s *NetworkListScreen) Close() {}
+
+// RowCount returns the number of networks listed, or of containers in the selected network
+func (s *NetworkListScreen) RowCount() int {
+	if network, names := s.attached(); network != nil {
+		return len(names)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.networks)
+}
@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetNetworks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/networks", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[
+			{"Name":"myapp_default","Id":"n2","Driver":"bridge","Scope":"local","Containers":{}},
+			{"Name":"bridge","Id":"n1","Driver":"bridge","Scope":"local","Containers":{}}
+		]`)
+	})
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[
+			{"Id":"a","Names":["/web"],"NetworkSettings":{"Networks":{"myapp_default":{"NetworkID":"n2","IPAddress":"172.18.0.2"}}}},
+			{"Id":"b","Names":["/db"],"NetworkSettings":{"Networks":{"myapp_default":{"NetworkID":"n2","IPAddress":"172.18.0.3"},"bridge":{"NetworkID":"n1","IPAddress":""}}}}
+		]`)
+	})
+	d := newTestDockerClient(t, mux)
+
+	networks, err := d.GetNetworks()
+	if err != nil {
+		t.Fatalf("GetNetworks failed: %v", err)
+	}
+	want := []*NetworkInfo{
+		{ID: "n1", Name: "bridge", Driver: "bridge", Scope: "local", Containers: map[string]string{"db": ""}},
+		{ID: "n2", Name: "myapp_default", Driver: "bridge", Scope: "local", Containers: map[string]string{"web": "172.18.0.2", "db": "172.18.0.3"}},
+	}
+	if !reflect.DeepEqual(networks, want) {
+		t.Errorf("GetNetworks = %+v, want %+v", networks, want)
+	}
+}
+
+// fixtureNetworkScreen returns a network list already loaded with two networks
+func fixtureNetworkScreen() (*NetworkListScreen, *DisplayManager) {
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, cursors: make(map[DisplayMode]int)}
+	screen := &NetworkListScreen{display: dm, docker: docker, loaded: true, networks: []*NetworkInfo{
+		{ID: "n1", Name: "bridge", Driver: "bridge", Scope: "local", Containers: map[string]string{}},
+		{ID: "n2", Name: "myapp_default", Driver: "bridge", Scope: "local", Containers: map[string]string{"web": "172.18.0.2", "db": "172.18.0.3", "gone": ""}},
+	}}
+	dm.currentScreen = screen
+	dm.mode = ModeNetworkList
+	return screen, dm
+}
+
+func TestNetworkListScreenGolden(t *testing.T) {
+	screen, _ := fixtureNetworkScreen()
+	assertGolden(t, "network_list", renderScreen(screen))
+
+	if !screen.HandleInput("1") {
+		t.Fatal("selecting network 1 was rejected")
+	}
+	assertGolden(t, "network_containers", renderScreen(screen))
+
+	if !screen.HandleInput("b") || screen.RowCount() != 2 {
+		t.Errorf("back didn't return to the network list")
+	}
+}
+
+func TestNetworkInspectContainer(t *testing.T) {
+	screen, dm := fixtureNetworkScreen()
+	screen.HandleInput("1")
+
+	// Containers are sorted by name: db, gone, web
+	if !screen.HandleInput("2 i") {
+		t.Fatal("inspecting container 2 was rejected")
+	}
+	if dm.Mode() != ModeServiceDetail || dm.SelectedService().Name != "web" {
+		t.Errorf("mode %v with service %v, want web's details", dm.Mode(), dm.SelectedService())
+	}
+	dm.currentScreen.Close()
+
+	// A container that isn't a listed service stays put
+	screen, dm = fixtureNetworkScreen()
+	screen.HandleInput("1")
+	if !screen.HandleInput("1 i") || dm.Mode() != ModeNetworkList {
+		t.Errorf("inspecting an unlisted container left mode %v", dm.Mode())
+	}
+	if screen.HandleInput("5 i") {
+		t.Error("inspecting a row that doesn't exist was accepted")
+	}
+}
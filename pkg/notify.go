@@ -0,0 +1,177 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events that can trigger an alert, as named in the notifications config
+const (
+	EventUnhealthy = "unhealthy" // A service became unhealthy, exited or died
+	EventConflict  = "conflict"  // A local process took one of a service's ports
+)
+
+// defaultNotificationDebounce is the minimum gap between alerts for one service and event,
+// so a flapping healthcheck doesn't alert on every poll
+const defaultNotificationDebounce = 5 * time.Minute
+
+// notifyCommand builds the process that shows a desktop notification, replaced in tests.
+// It returns nil on platforms without a supported notifier.
+var notifyCommand = defaultNotifyCommand
+
+func defaultNotifyCommand(title, message string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", message, title)
+		return exec.Command("osascript", "-e", script)
+	case "linux":
+		return exec.Command("notify-send", title, message)
+	}
+	return nil
+}
+
+// Transition is a watched change in a service's state between two refreshes
+type Transition struct {
+	Service string
+	Event   string
+	Detail  string // Human readable description, e.g. "web is Unhealthy"
+}
+
+// Notifier alerts on transitions with the terminal bell and, if enabled, desktop notifications
+type Notifier struct {
+	prefs NotificationPreferences
+	bell  io.Writer
+	now   func() time.Time
+	last  map[string]time.Time // Last alert per service and event
+	mu    sync.Mutex
+}
+
+// NewNotifier creates a notifier that rings the bell on the given terminal
+func NewNotifier(prefs NotificationPreferences, bell io.Writer) *Notifier {
+	return &Notifier{
+		prefs: prefs,
+		bell:  bell,
+		now:   time.Now,
+		last:  make(map[string]time.Time),
+	}
+}
+
+// Notify alerts on a transition unless its event is switched off or it was alerted recently
+func (n *Notifier) Notify(t Transition) {
+	if n == nil || !n.prefs.Watches(t.Event) || !n.due(t) {
+		return
+	}
+
+	logWarn("%s", t.Detail)
+	if n.bell != nil {
+		fmt.Fprint(n.bell, "\a")
+	}
+	if !n.prefs.Desktop {
+		return
+	}
+	cmd := notifyCommand("dockforward", t.Detail)
+	if cmd == nil {
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		logError("Failed to send desktop notification: %v", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// due records an alert for the transition's service and event, reporting whether the
+// debounce period since the last one has passed
+func (n *Notifier) due(t Transition) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := t.Service + "/" + t.Event
+	now := n.now()
+	if last, ok := n.last[key]; ok && now.Sub(last) < n.prefs.Debounce() {
+		return false
+	}
+	n.last[key] = now
+	return true
+}
+
+// serviceSnapshot is the part of a service's state that transitions and events are detected on
+type serviceSnapshot struct {
+	health    string
+	forward   string
+	conflicts map[string]bool   // Remote ports in conflict
+	ports     map[string]string // State of each remote port, naming the process holding it in a conflict
+}
+
+func snapshotServices(services map[string]*ServiceStatus) map[string]serviceSnapshot {
+	snapshot := make(map[string]serviceSnapshot, len(services))
+	for name, service := range services {
+		conflicts := make(map[string]bool)
+		for _, port := range service.ConflictPorts() {
+			conflicts[port] = true
+		}
+		ports := make(map[string]string, len(service.ForwardedPorts))
+		for _, port := range service.ForwardedPorts {
+			ports[port.Remote] = port.Status
+			if port.Status == StatusConflict && port.ConflictInfo != nil {
+				ports[port.Remote] += " with " + describeProcess(port.ConflictInfo)
+			}
+		}
+		snapshot[name] = serviceSnapshot{health: service.HealthStatus, forward: service.ForwardStatus, conflicts: conflicts, ports: ports}
+	}
+	return snapshot
+}
+
+// isUnhealthy reports whether a health status means the service needs attention
+func isUnhealthy(health string) bool {
+	return health == HealthUnhealthy || health == HealthExited || health == HealthDead
+}
+
+// detectTransitions compares two snapshots, returning the watched changes sorted by service.
+// Services that only just appeared have nothing to compare against and are skipped.
+func detectTransitions(previous, current map[string]serviceSnapshot) []Transition {
+	var transitions []Transition
+	for name, now := range current {
+		before, ok := previous[name]
+		if !ok {
+			continue
+		}
+		if isUnhealthy(now.health) && !isUnhealthy(before.health) {
+			transitions = append(transitions, Transition{
+				Service: name,
+				Event:   EventUnhealthy,
+				Detail:  fmt.Sprintf("%s is %s (was %s)", name, now.health, before.health),
+			})
+		}
+		var ports []string
+		for port := range now.conflicts {
+			if !before.conflicts[port] {
+				ports = append(ports, port)
+			}
+		}
+		if len(ports) > 0 {
+			sort.Slice(ports, func(i, j int) bool { return portNumber(ports[i]) < portNumber(ports[j]) })
+			transitions = append(transitions, Transition{
+				Service: name,
+				Event:   EventConflict,
+				Detail:  fmt.Sprintf("%s has a new port conflict on %s", name, strings.Join(ports, ", ")),
+			})
+		}
+	}
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].Service < transitions[j].Service
+	})
+	return transitions
+}
+
+// portNumber parses a port for sorting, putting anything unparsable first
+func portNumber(port string) int {
+	n, _ := strconv.Atoi(port)
+	return n
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectTransitions(t *testing.T) {
+	previous := snapshotServices(fixtureDockerClient().services)
+	current := fixtureDockerClient().services
+	current["web"].HealthStatus = HealthUnhealthy
+	current["web"].ForwardedPorts[1].Status = StatusConflict
+	current["worker"].HealthStatus = HealthExited
+	current["db"].HealthStatus = HealthExited // Already unhealthy, so not a new alert
+	current["new"] = &ServiceStatus{Name: "new", HealthStatus: HealthDead}
+
+	got := detectTransitions(previous, snapshotServices(current))
+	want := []Transition{
+		{Service: "web", Event: EventUnhealthy, Detail: "web is Unhealthy (was Healthy)"},
+		{Service: "web", Event: EventConflict, Detail: "web has a new port conflict on 8080"},
+		{Service: "worker", Event: EventUnhealthy, Detail: "worker is Exited (was Running)"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transitions:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestNotifierDebounceAndToggles(t *testing.T) {
+	var desktop []string
+	notifyCommand = func(title, message string) *exec.Cmd {
+		desktop = append(desktop, message)
+		return exec.Command("true")
+	}
+	t.Cleanup(func() { notifyCommand = defaultNotifyCommand })
+
+	var bell bytes.Buffer
+	prefs := NotificationPreferences{Desktop: true, Events: map[string]bool{EventConflict: false}, DebounceMinutes: 2}
+	notifier := NewNotifier(prefs, &bell)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	notifier.now = func() time.Time { return now }
+
+	unhealthy := Transition{Service: "web", Event: EventUnhealthy, Detail: "web is Unhealthy (was Healthy)"}
+	notifier.Notify(unhealthy)
+	notifier.Notify(Transition{Service: "web", Event: EventConflict, Detail: "web has a new port conflict on 8080"})
+	now = now.Add(time.Minute)
+	notifier.Notify(unhealthy) // Within the debounce period
+	notifier.Notify(Transition{Service: "db", Event: EventUnhealthy, Detail: "db is Dead (was Running)"})
+	now = now.Add(2 * time.Minute)
+	notifier.Notify(unhealthy)
+
+	if got := bell.String(); got != "\a\a\a" {
+		t.Errorf("bell rang %d times, want 3", len(got))
+	}
+	want := []string{"web is Unhealthy (was Healthy)", "db is Dead (was Running)", "web is Unhealthy (was Healthy)"}
+	if !reflect.DeepEqual(desktop, want) {
+		t.Errorf("desktop notifications:\n got %q\nwant %q", desktop, want)
+	}
+}
+
+func TestUpdateServicesNotifiesOnTransitions(t *testing.T) {
+	var bell bytes.Buffer
+	docker := fixtureDockerClient()
+	docker.SetNotifier(NewNotifier(NotificationPreferences{}, &bell))
+
+	// The first update has nothing to compare against
+	docker.UpdateServices(fixtureDockerClient().services)
+	if bell.Len() != 0 {
+		t.Fatal("bell rang for the initial services")
+	}
+
+	services := fixtureDockerClient().services
+	services["web"].HealthStatus = HealthUnhealthy
+	docker.UpdateServices(services)
+	if bell.String() != "\a" {
+		t.Fatalf("bell wrote %q after web became unhealthy", bell.String())
+	}
+
+	// Storing the same state again, as screens do after a fetch, doesn't alert twice
+	docker.UpdateServices(services)
+	if bell.String() != "\a" {
+		t.Errorf("bell wrote %q after an unchanged update", bell.String())
+	}
+}
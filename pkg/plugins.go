@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ScreenPlugin is a screen added from outside dockforward, opened from the extensions menu
+type ScreenPlugin interface {
+	// Name labels the screen in the extensions menu
+	Name() string
+	// NewScreen creates the screen each time it's opened
+	NewScreen(dm *DisplayManager) Screen
+}
+
+// PluginLoader loads screen plugins from the shared libraries (.so files) in a directory.
+// Each is built with -buildmode=plugin against the same dockforward source and Go version
+// as the monitor, and exports a NewScreen(dm *DisplayManager) Screen function.
+type PluginLoader struct {
+	Dir string
+}
+
+func NewPluginLoader(dir string) *PluginLoader {
+	return &PluginLoader{Dir: dir}
+}
+
+// GetPluginDir returns the directory plugins are loaded from, plugins/ in the config dir
+func GetPluginDir() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "plugins"), nil
+}
+
+// Load opens each .so file in the directory in name order, returning the plugins that
+// loaded along with why the others didn't. A missing directory holds no plugins.
+func (l *PluginLoader) Load() ([]ScreenPlugin, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %v", err)
+	}
+
+	var plugins []ScreenPlugin
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".so" {
+			continue
+		}
+		newScreen, err := openPlugin(filepath.Join(l.Dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load plugin %s: %w", entry.Name(), err))
+			continue
+		}
+		plugins = append(plugins, &sharedPlugin{name: strings.TrimSuffix(entry.Name(), ".so"), newScreen: newScreen})
+	}
+	return plugins, errors.Join(errs...)
+}
+
+// sharedPlugin is a plugin loaded from a shared library, named after its file
+type sharedPlugin struct {
+	name      string
+	newScreen func(dm *DisplayManager) Screen
+}
+
+func (p *sharedPlugin) Name() string {
+	return p.name
+}
+
+func (p *sharedPlugin) NewScreen(dm *DisplayManager) Screen {
+	return p.newScreen(dm)
+}
+
+// RegisterPlugin adds plugin's screen to the extensions menu
+func (d *DisplayManager) RegisterPlugin(plugin ScreenPlugin) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.plugins = append(d.plugins, plugin)
+}
+
+// Plugins returns the registered plugins in menu order
+func (d *DisplayManager) Plugins() []ScreenPlugin {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return slices.Clone(d.plugins)
+}
+
+// openExtension switches to plugin's screen
+func (d *DisplayManager) openExtension(plugin ScreenPlugin) {
+	d.mu.Lock()
+	d.extension = plugin
+	d.mu.Unlock()
+	d.SetMode(ModeExtension)
+}
+
+// RenderActions writes a plugin screen's footer: keys, the key back to the extensions
+// menu unless keys has its own, and the keys every screen accepts
+func (d *DisplayManager) RenderActions(w io.Writer, keys Keymap) {
+	d.renderActions(w, withExtensionBack(d, keys))
+}
+
+// withExtensionBack adds the key back to the extensions menu to a plugin screen's keys,
+// unless the plugin handles "b" itself
+func withExtensionBack(d *DisplayManager, keys Keymap) Keymap {
+	for _, binding := range keys {
+		if binding.match([]string{"b"}) > 0 {
+			return keys
+		}
+	}
+	return append(slices.Clip(keys), extensionBack(d))
+}
+
+func extensionBack(d *DisplayManager) Binding {
+	return Binding{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to the extensions menu", Action: func([]string) bool {
+		d.SetMode(ModeExtensions)
+		return true
+	}}
+}
+
+// ExtensionsScreen lists the screens added by plugins
+type ExtensionsScreen struct {
+	display *DisplayManager
+	plugins []ScreenPlugin
+}
+
+func NewExtensionsScreen(display *DisplayManager, plugins []ScreenPlugin) *ExtensionsScreen {
+	return &ExtensionsScreen{display: display, plugins: plugins}
+}
+
+func (s *ExtensionsScreen) Display(w io.Writer) {
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header("Extensions"))
+	if len(s.plugins) == 0 {
+		dir, err := GetPluginDir()
+		if err != nil {
+			dir = "the config directory's plugins folder"
+		}
+		fmt.Fprintf(w, "No plugins loaded. Plugins are loaded from %s at startup.\n", dir)
+	}
+	s.display.setRowLines(rowRange(2, len(s.plugins)))
+	for i, plugin := range s.plugins {
+		selected := i == s.display.Cursor()
+		fmt.Fprintf(w, "%s  %s\n", s.display.highlight(fmt.Sprintf("%2d", i), selected), s.display.highlight(plugin.Name(), selected))
+	}
+
+	s.display.renderActions(w, s.Keys())
+}
+
+// RowCount returns the number of plugins listed
+func (s *ExtensionsScreen) RowCount() int {
+	return len(s.plugins)
+}
+
+// Keys returns the commands available on the extensions menu
+func (s *ExtensionsScreen) Keys() Keymap {
+	return Keymap{
+		{Keys: []string{"#"}, Description: "Open a plugin's screen", Action: func(args []string) bool {
+			idx := parseIndex(args[0])
+			if idx < 0 || idx >= len(s.plugins) {
+				return false
+			}
+			s.display.openExtension(s.plugins[idx])
+			return true
+		}},
+		{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to the services overview", Action: func([]string) bool {
+			s.display.SetMode(ModeOverview)
+			return true
+		}},
+	}
+}
+
+func (s *ExtensionsScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *ExtensionsScreen) NeedsRefresh() bool {
+	return false
+}
+
+// Close is a no-op, the menu has no background work
+func (s *ExtensionsScreen) Close() {}
+
+// extensionScreen is a plugin's screen, which goes back to the extensions menu on "b"
+// unless the plugin handles it
+type extensionScreen struct {
+	Screen
+	display *DisplayManager
+}
+
+func (s *extensionScreen) Keys() Keymap {
+	return withExtensionBack(s.display, s.Screen.Keys())
+}
+
+func (s *extensionScreen) HandleInput(input string) bool {
+	return s.Screen.HandleInput(input) || Keymap{extensionBack(s.display)}.Dispatch(input)
+}
+
+// navigableExtension is a plugin's screen with rows the cursor can select
+type navigableExtension struct {
+	*extensionScreen
+	Navigable
+}
+
+// newExtensionScreen wraps a plugin's screen, keeping it navigable if it is
+func newExtensionScreen(display *DisplayManager, screen Screen) Screen {
+	extension := &extensionScreen{Screen: screen, display: display}
+	if navigable, ok := screen.(Navigable); ok {
+		return &navigableExtension{extension, navigable}
+	}
+	return extension
+}
@@ -0,0 +1,8 @@
+//go:build !((linux || darwin || freebsd) && cgo)
+
+package pkg
+
+// openPlugin always fails here, Go only loads shared libraries with cgo on a few systems
+func openPlugin(path string) (func(dm *DisplayManager) Screen, error) {
+	return nil, ErrPluginsUnsupported
+}
@@ -0,0 +1,25 @@
+//go:build (linux || darwin || freebsd) && cgo
+
+package pkg
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// openPlugin loads the shared library at path and returns its NewScreen function
+func openPlugin(path string) (func(dm *DisplayManager) Screen, error) {
+	library, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := library.Lookup("NewScreen")
+	if err != nil {
+		return nil, err
+	}
+	newScreen, ok := symbol.(func(dm *DisplayManager) Screen)
+	if !ok {
+		return nil, fmt.Errorf("NewScreen is a %T, want func(*DisplayManager) Screen", symbol)
+	}
+	return newScreen, nil
+}
@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakePlugin adds a screen counting the times "ping" was typed on it
+type fakePlugin struct {
+	name  string
+	pings int
+}
+
+func (p *fakePlugin) Name() string {
+	return p.name
+}
+
+func (p *fakePlugin) NewScreen(dm *DisplayManager) Screen {
+	return &fakePluginScreen{plugin: p, display: dm}
+}
+
+type fakePluginScreen struct {
+	plugin  *fakePlugin
+	display *DisplayManager
+}
+
+func (s *fakePluginScreen) Display(w io.Writer) {
+	fmt.Fprintf(w, "Pings: %d\n", s.plugin.pings)
+	s.display.RenderActions(w, s.Keys())
+}
+
+func (s *fakePluginScreen) Keys() Keymap {
+	return Keymap{{Keys: []string{"ping"}, Label: "[ping]", Description: "Count a ping", Action: func([]string) bool {
+		s.plugin.pings++
+		return true
+	}}}
+}
+
+func (s *fakePluginScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *fakePluginScreen) NeedsRefresh() bool {
+	return false
+}
+
+func (s *fakePluginScreen) Close() {}
+
+func TestPluginLoader(t *testing.T) {
+	dir := t.TempDir()
+	if plugins, err := NewPluginLoader(filepath.Join(dir, "missing")).Load(); plugins != nil || err != nil {
+		t.Errorf("Load of a missing directory = %v, %v, want nothing", plugins, err)
+	}
+
+	// Only .so files are opened, and one that fails doesn't stop the others
+	for name, content := range map[string]string{"broken.so": "not a shared library", "README.txt": "notes"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "nested.so"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	plugins, err := NewPluginLoader(dir).Load()
+	if len(plugins) != 0 {
+		t.Errorf("loaded %d plugins from files that aren't any", len(plugins))
+	}
+	if err == nil || !strings.Contains(err.Error(), "broken.so") || strings.Contains(err.Error(), "README") || strings.Contains(err.Error(), "nested") {
+		t.Errorf("Load error = %v, want only broken.so's failure", err)
+	}
+}
+
+func TestExtensionsMenu(t *testing.T) {
+	dm := &DisplayManager{config: fixtureConfig(), docker: fixtureDockerClient(), cursors: make(map[DisplayMode]int)}
+	dm.SetMode(ModeOverview)
+	if strings.Contains(renderScreen(dm.currentScreen), "e[X]tensions") {
+		t.Error("extensions offered with no plugins loaded")
+	}
+
+	plugin := &fakePlugin{name: "pinger"}
+	dm.RegisterPlugin(plugin)
+	dm.SetMode(ModeOverview)
+	if !strings.Contains(renderScreen(dm.currentScreen), "e[X]tensions") {
+		t.Error("extensions not offered with a plugin loaded")
+	}
+
+	if !dm.HandleInput("X") || dm.Mode() != ModeExtensions {
+		t.Fatalf("X opened mode %v, want the extensions menu", dm.Mode())
+	}
+	if frame := renderScreen(dm.currentScreen); !strings.Contains(frame, "pinger") {
+		t.Errorf("extensions menu doesn't list the plugin:\n%s", frame)
+	}
+	if dm.HandleInput("1") {
+		t.Error("opening an extension that doesn't exist was accepted")
+	}
+
+	if !dm.HandleInput("0") || dm.Mode() != ModeExtension {
+		t.Fatalf("0 opened mode %v, want the plugin's screen", dm.Mode())
+	}
+	if !dm.HandleInput("ping") || plugin.pings != 1 {
+		t.Errorf("plugin's key wasn't handled, %d pings", plugin.pings)
+	}
+	if frame := renderScreen(dm.currentScreen); !strings.Contains(frame, "Pings: 1") || !strings.Contains(frame, "[b]ack") || !strings.Contains(frame, "[q]uit") {
+		t.Errorf("plugin screen lacks its content or footer:\n%s", frame)
+	}
+
+	if !dm.HandleInput("b") || dm.Mode() != ModeExtensions {
+		t.Errorf("back from the plugin's screen went to mode %v, want the extensions menu", dm.Mode())
+	}
+	if !dm.HandleInput("b") || dm.Mode() != ModeOverview {
+		t.Errorf("back from the extensions menu went to mode %v, want the overview", dm.Mode())
+	}
+	dm.currentScreen.Close()
+}
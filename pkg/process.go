@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// killGracePeriod is how long KillProcess waits for a process to exit before killing it outright
+var killGracePeriod = 2 * time.Second
+
+// killPollInterval is how often KillProcess checks whether the process has exited
+const killPollInterval = 50 * time.Millisecond
+
+// procDir is where process command lines are read from, absent on macOS and the BSDs
+var procDir = "/proc"
+
+// lsofProcess is a process in lsof's -F output with the network addresses it has open
+type lsofProcess struct {
+	ProcessInfo
+	names []string
+}
+
+// listening reports whether the process has a socket not connected to a peer, as a
+// listening one is, rather than only connections to the port
+func (p lsofProcess) listening() bool {
+	for _, name := range p.names {
+		if !strings.Contains(name, "->") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLsof parses the output of lsof -F pcuLn into its processes, in the order listed.
+// macOS adds an f line before each file, which is skipped.
+func parseLsof(output string) []lsofProcess {
+	var processes []lsofProcess
+	var current *lsofProcess
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 2 {
+			continue
+		}
+		if line[0] == 'p' {
+			processes = append(processes, lsofProcess{ProcessInfo: ProcessInfo{PID: line[1:]}})
+			current = &processes[len(processes)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		switch line[0] {
+		case 'c':
+			current.Name = line[1:]
+		case 'u':
+			if current.User == "" {
+				current.User = line[1:]
+			}
+		case 'L':
+			current.User = line[1:] // The login name reads better than the uid
+		case 'n':
+			current.names = append(current.names, line[1:])
+		}
+	}
+	return processes
+}
+
+// portListener picks the process listening on a port from lsof's processes, preferring one
+// with a listening socket over clients connected to the port
+func portListener(processes []lsofProcess) *ProcessInfo {
+	for _, process := range processes {
+		if process.listening() {
+			return &process.ProcessInfo
+		}
+	}
+	if len(processes) > 0 {
+		return &processes[0].ProcessInfo
+	}
+	return nil
+}
+
+// localProcessForPort runs lsof to find the process listening on a port, giving up when ctx is done
+func localProcessForPort(ctx context.Context, port string) *ProcessInfo {
+	// -n and -P skip host and service name lookups, which are slow and turn 5432 into "postgresql"
+	cmd := exec.CommandContext(ctx, "lsof", "-n", "-P", "-iTCP:"+port, "-sTCP:LISTEN", "-F", "pcuLn")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	info := portListener(parseLsof(string(out)))
+	if info == nil {
+		return nil
+	}
+	info.Command = processCommand(ctx, info.PID)
+	if info.Command == "" {
+		info.Command = info.Name
+	}
+	return info
+}
+
+// processCommand returns the full command line of the process with pid, from /proc where
+// there is one and from ps otherwise, or "" if neither has it
+func processCommand(ctx context.Context, pid string) string {
+	if cmdline, err := os.ReadFile(filepath.Join(procDir, pid, "cmdline")); err == nil {
+		return strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+	out, err := exec.CommandContext(ctx, "ps", "-o", "command=", "-p", pid).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// killProcess sends the process with pid a terminate signal and waits up to grace for it to
+// exit, then kills it outright and waits as long again
+func killProcess(pid string, grace time.Duration) error {
+	n, err := strconv.Atoi(pid)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid PID %q", pid)
+	}
+	if err := terminateProcess(n); err != nil {
+		return fmt.Errorf("failed to stop PID %s: %w", pid, err)
+	}
+	if waitProcessExit(n, grace) {
+		return nil
+	}
+	logDebug("Process ignored the terminate signal, killing it", "pid", pid, "grace", grace)
+	if err := forceKillProcess(n); err != nil {
+		return fmt.Errorf("failed to kill PID %s: %w", pid, err)
+	}
+	if !waitProcessExit(n, grace) {
+		return fmt.Errorf("PID %s is still running after being killed", pid)
+	}
+	return nil
+}
+
+// waitProcessExit polls until the process with pid has exited, reporting false if it's
+// still running after timeout
+func waitProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(killPollInterval)
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+//go:build !unix
+
+package pkg
+
+import "os"
+
+// terminateProcess ends the process with pid; there's no gentler signal to send here
+func terminateProcess(pid int) error {
+	return forceKillProcess(pid)
+}
+
+// forceKillProcess kills the process with pid, succeeding if it already exited
+func forceKillProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	defer process.Release()
+	return process.Kill()
+}
+
+// processRunning reports whether a process with pid can still be found
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLsof(t *testing.T) {
+	tests := []struct {
+		file      string
+		processes int
+		want      ProcessInfo
+	}{
+		// A client connected to the port is listed before the server listening on it
+		{"lsof_linux.txt", 2, ProcessInfo{PID: "812", Name: "postgres", User: "postgres"}},
+		// Workers sharing a listening socket, each file preceded by an f line
+		{"lsof_darwin.txt", 2, ProcessInfo{PID: "1207", Name: "node", User: "jane"}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		processes := parseLsof(string(data))
+		if len(processes) != tt.processes {
+			t.Errorf("%s: parsed %d processes, want %d", tt.file, len(processes), tt.processes)
+		}
+		if got := portListener(processes); got == nil || *got != tt.want {
+			t.Errorf("%s: listener = %+v, want %+v", tt.file, got, tt.want)
+		}
+	}
+
+	if got := portListener(parseLsof("")); got != nil {
+		t.Errorf("listener with no output = %+v, want nil", got)
+	}
+	// Without a login name the uid stands in
+	if got := parseLsof("p42\ncnc\nu1000\nn*:8080\n"); len(got) != 1 || got[0].User != "1000" {
+		t.Errorf("parsed %+v, want uid 1000 as the user", got)
+	}
+}
+
+func TestProcessCommandWithoutProc(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	withProc := processCommand(context.Background(), pid)
+	if !strings.Contains(withProc, filepath.Base(os.Args[0])) {
+		t.Errorf("command from /proc = %q, want the test binary", withProc)
+	}
+
+	// As on macOS, where ps is the only source
+	procDir = filepath.Join(t.TempDir(), "proc")
+	t.Cleanup(func() { procDir = "/proc" })
+	if got := processCommand(context.Background(), pid); !strings.Contains(got, filepath.Base(os.Args[0])) {
+		t.Errorf("command from ps = %q, want the test binary", got)
+	}
+	if got := processCommand(context.Background(), "999999999"); got != "" {
+		t.Errorf("command of a missing process = %q, want none", got)
+	}
+}
+
+// startProcess runs script in the background, reaping it when it exits, and returns its PID
+func startProcess(t *testing.T, script string) string {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", script)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start %q: %v", script, err)
+	}
+	go cmd.Wait()
+	t.Cleanup(func() { cmd.Process.Kill() })
+	return strconv.Itoa(cmd.Process.Pid)
+}
+
+func TestKillProcess(t *testing.T) {
+	pid := startProcess(t, "exec sleep 30")
+	if err := killProcess(pid, time.Second); err != nil {
+		t.Fatalf("killProcess failed: %v", err)
+	}
+
+	// A process ignoring SIGTERM is killed once the grace period is up
+	stubborn := startProcess(t, `trap "" TERM; exec sleep 30`)
+	time.Sleep(50 * time.Millisecond) // Let the shell set the trap
+	start := time.Now()
+	if err := killProcess(stubborn, 200*time.Millisecond); err != nil {
+		t.Fatalf("killProcess of a process ignoring SIGTERM failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("killProcess returned after %v, before the grace period was up", elapsed)
+	}
+	n, _ := strconv.Atoi(stubborn)
+	if processRunning(n) {
+		t.Error("process ignoring SIGTERM still running")
+	}
+
+	if err := killProcess("nope", time.Second); err == nil {
+		t.Error("killProcess succeeded with an invalid PID")
+	}
+}
+
+func TestKillProcessPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root may signal any process")
+	}
+	err := killProcess("1", time.Second)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("killing init = %v, want ErrPermissionDenied", err)
+	}
+	if ErrorHint(err) == "" {
+		t.Error("no hint for a process that can't be killed")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminateProcess asks the process with pid to exit, succeeding if it already has
+func terminateProcess(pid int) error {
+	return signalProcess(pid, unix.SIGTERM)
+}
+
+// forceKillProcess kills the process with pid, succeeding if it already exited
+func forceKillProcess(pid int) error {
+	return signalProcess(pid, unix.SIGKILL)
+}
+
+// signalProcess sends sig to the process with pid, failing with ErrPermissionDenied if the
+// process is another user's
+func signalProcess(pid int, sig unix.Signal) error {
+	err := unix.Kill(pid, sig)
+	switch {
+	case errors.Is(err, unix.ESRCH):
+		return nil
+	case errors.Is(err, unix.EPERM):
+		return fmt.Errorf("%w: the process belongs to another user", ErrPermissionDenied)
+	}
+	return err
+}
+
+// processRunning reports whether a process with pid exists, even if it's another user's
+func processRunning(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ProjectDirName is the directory in a project holding the dockforward settings its team
+// commits, which syncing leaves out
+const ProjectDirName = ".dockforward"
+
+// ProjectFile is a project's committed settings for the docker wrapper, in
+// .dockforward/config.json, which take precedence over the global config's
+type ProjectFile struct {
+	Server          string   `json:"server"`            // Server the project's commands run on, "" for the monitor's
+	ComposeFile     string   `json:"compose_file"`      // Compose file compose commands without -f use
+	ExcludePatterns []string `json:"exclude_patterns"`  // Added to the global config's extra_excludes for the project
+	NoSync          *bool    `json:"no_sync,omitempty"` // Run in the last synced context, as --no-sync does; nil keeps the global setting
+}
+
+// ProjectFilePath returns where the project in dir keeps its settings
+func ProjectFilePath(dir string) string {
+	return filepath.Join(dir, ProjectDirName, "config.json")
+}
+
+// LoadProjectFile reads the settings of the project in dir, returning nil if it has none
+func LoadProjectFile(dir string) (*ProjectFile, error) {
+	data, err := os.ReadFile(ProjectFilePath(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project config: %v", err)
+	}
+	var file ProjectFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", ProjectFilePath(dir), err)
+	}
+	return &file, nil
+}
+
+// InitProjectFile writes file as the settings of the project in dir, refusing to replace
+// existing ones unless force is set, and returns the file's path
+func InitProjectFile(dir string, file ProjectFile, force bool) (string, error) {
+	path := ProjectFilePath(dir)
+	if _, err := os.Stat(path); err == nil && !force {
+		return path, fmt.Errorf("%s already exists", path)
+	}
+	if file.ExcludePatterns == nil {
+		file.ExcludePatterns = []string{} // Written as [] so it's clear where patterns go
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return path, fmt.Errorf("failed to marshal project config: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return path, fmt.Errorf("failed to create %s: %v", ProjectDirName, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return path, fmt.Errorf("failed to write project config: %v", err)
+	}
+	return path, nil
+}
+
+// Merge returns p with the settings file sets taking precedence
+func (p ProjectConfig) Merge(file *ProjectFile) ProjectConfig {
+	if file == nil {
+		return p
+	}
+	if file.Server != "" {
+		p.Server = file.Server
+	}
+	if file.ComposeFile != "" {
+		p.ComposeFile = file.ComposeFile
+	}
+	// Later patterns win, so the project's come after the global ones
+	if len(file.ExcludePatterns) > 0 {
+		p.ExtraExcludes = append(append([]string{}, p.ExtraExcludes...), file.ExcludePatterns...)
+	}
+	if file.NoSync != nil {
+		p.NoSync = *file.NoSync
+	}
+	return p
+}
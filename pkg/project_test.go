@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProjectFile(t *testing.T) {
+	dir := t.TempDir()
+	if file, err := LoadProjectFile(dir); file != nil || err != nil {
+		t.Errorf("LoadProjectFile without one = %+v, %v", file, err)
+	}
+
+	path, err := InitProjectFile(dir, ProjectFile{Server: "build", ComposeFile: "compose.yaml"}, false)
+	if err != nil {
+		t.Fatalf("InitProjectFile failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"exclude_patterns": []`) || strings.Contains(string(data), `"no_sync"`) {
+		t.Errorf("scaffold = %s, want exclude_patterns shown and no_sync left to the global config", data)
+	}
+	if _, err := InitProjectFile(dir, ProjectFile{}, false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("InitProjectFile over existing settings = %v", err)
+	}
+	noSync := true
+	if _, err := InitProjectFile(dir, ProjectFile{Server: "staging", ExcludePatterns: []string{"data/"}, NoSync: &noSync}, true); err != nil {
+		t.Fatalf("InitProjectFile with force failed: %v", err)
+	}
+	file, err := LoadProjectFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ProjectFile{Server: "staging", ExcludePatterns: []string{"data/"}, NoSync: &noSync}
+	if !reflect.DeepEqual(file, want) {
+		t.Errorf("LoadProjectFile = %+v, want %+v", file, want)
+	}
+
+	// The committed settings win over the global ones, and add to their excludes
+	config := &Config{
+		Projects: map[string]ProjectConfig{dir: {ExtraExcludes: []string{"fixtures/"}, Server: "prod", ComposeFile: "prod.yaml"}},
+	}
+	got := config.Project(dir).Merge(file)
+	if wantProject := (ProjectConfig{ExtraExcludes: []string{"fixtures/", "data/"}, Server: "staging", ComposeFile: "prod.yaml", NoSync: true}); !reflect.DeepEqual(got, wantProject) {
+		t.Errorf("Project = %+v, want %+v", got, wantProject)
+	}
+	// Leaving no_sync out keeps the global setting, while false overrides it
+	global := ProjectConfig{NoSync: true}
+	if merged := global.Merge(&ProjectFile{Server: "staging"}); !merged.NoSync {
+		t.Error("a project file without no_sync reset the global no_sync")
+	}
+	noSync = false
+	if merged := global.Merge(&ProjectFile{NoSync: &noSync}); merged.NoSync {
+		t.Error("no_sync false in the project file didn't override the global no_sync")
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProjectFile(dir); err == nil {
+		t.Error("LoadProjectFile accepted broken JSON")
+	}
+}
@@ -0,0 +1,223 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PullProgress is one message of an image pull's progress stream
+type PullProgress struct {
+	ID      string // Layer the message is about, empty for the image as a whole
+	Status  string // e.g. "Downloading", "Extracting" or "Pull complete"
+	Current int64  // Bytes done of the current step, when known
+	Total   int64  // Bytes in the current step, 0 when unknown
+	Error   string // Why the pull failed, on the last message of a failed pull
+}
+
+// pullMessage is an object of Docker's JSON progress stream
+type pullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error       string `json:"error"`
+	ErrorDetail struct {
+		Message string `json:"message"`
+	} `json:"errorDetail"`
+}
+
+// splitImageRef splits an image reference into the name and tag the Docker API takes,
+// defaulting to latest. A digest stays part of the name, as the API expects.
+func splitImageRef(image string) (name, tag string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	// A colon before the last slash separates a registry's port, not a tag
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
+
+// PullImage pulls image on the remote host, streaming its progress on the returned channel
+// until the pull finishes, fails or ctx is cancelled, then closing it. A failure reported by
+// Docker mid-pull arrives as a final message with Error set.
+func (d *DockerClient) PullImage(ctx context.Context, image string) (<-chan PullProgress, error) {
+	// Pulls can take minutes, so there's no request timeout, only cancellation
+	ctx, release := d.requestContextFor(ctx)
+
+	name, tag := splitImageRef(image)
+	query := url.Values{"fromImage": {name}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.apiURL("/images/create?"+query.Encode()), nil)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to create pull request: %v", err)
+	}
+	resp, err := d.httpClient(0).Do(req)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to pull %s: %v", image, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		defer release()
+		return nil, fmt.Errorf("failed to pull %s: %w", image, responseError(resp))
+	}
+
+	progress := make(chan PullProgress)
+	go func() {
+		defer close(progress)
+		defer release()
+		defer resp.Body.Close()
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var msg pullMessage
+			if err := decoder.Decode(&msg); err != nil {
+				if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+					logWarn("Pull progress for %s ended: %v", image, err)
+				}
+				return
+			}
+			update := PullProgress{
+				ID:      msg.ID,
+				Status:  msg.Status,
+				Current: msg.ProgressDetail.Current,
+				Total:   msg.ProgressDetail.Total,
+				Error:   msg.Error,
+			}
+			if msg.ErrorDetail.Message != "" {
+				update.Error = msg.ErrorDetail.Message
+			}
+			select {
+			case progress <- update:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return progress, nil
+}
+
+// pullBarWidth is the number of characters inside a layer's progress bar
+const pullBarWidth = 30
+
+// PullDisplay renders a pull's progress as a line per layer. On a terminal the lines are
+// redrawn in place with a progress bar; otherwise a line is printed whenever a layer's
+// status changes, so logs stay readable.
+type PullDisplay struct {
+	w      io.Writer
+	tty    bool
+	layers []string                // Layer IDs in the order first seen
+	latest map[string]PullProgress // Last message per layer
+	drawn  int                     // Layer lines drawn on the terminal, redrawn by the next update
+	failed string                  // Error reported by Docker, if the pull failed
+}
+
+// NewPullDisplay returns a display writing to w, redrawing in place if tty is set
+func NewPullDisplay(w io.Writer, tty bool) *PullDisplay {
+	return &PullDisplay{w: w, tty: tty, latest: make(map[string]PullProgress)}
+}
+
+// Update shows one progress message
+func (p *PullDisplay) Update(update PullProgress) {
+	if update.Error != "" {
+		p.failed = update.Error
+		p.printLine(fmt.Sprintf("Error: %s", update.Error))
+		return
+	}
+	if update.ID == "" {
+		p.printLine(update.Status)
+		return
+	}
+
+	previous, seen := p.latest[update.ID]
+	if !seen {
+		p.layers = append(p.layers, update.ID)
+	}
+	p.latest[update.ID] = update
+	if p.tty {
+		p.redraw()
+	} else if !seen || previous.Status != update.Status {
+		fmt.Fprintln(p.w, layerLine(update, false))
+	}
+}
+
+// Err returns the error Docker reported, or nil if the pull hasn't failed
+func (p *PullDisplay) Err() error {
+	if p.failed == "" {
+		return nil
+	}
+	return errors.New(p.failed)
+}
+
+// printLine prints a message about the whole image above the layer lines
+func (p *PullDisplay) printLine(line string) {
+	if !p.tty {
+		fmt.Fprintln(p.w, line)
+		return
+	}
+	p.clear()
+	fmt.Fprintln(p.w, line)
+	p.redraw()
+}
+
+// clear moves back over the layer lines and erases them
+func (p *PullDisplay) clear() {
+	if p.drawn > 0 {
+		fmt.Fprintf(p.w, "\033[%dA\033[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+// redraw draws a line per layer in place of the last ones drawn
+func (p *PullDisplay) redraw() {
+	if p.drawn > 0 {
+		fmt.Fprintf(p.w, "\033[%dA", p.drawn)
+	}
+	for _, id := range p.layers {
+		fmt.Fprintf(p.w, "\033[K%s\n", layerLine(p.latest[id], true))
+	}
+	p.drawn = len(p.layers)
+}
+
+// layerLine describes a layer's progress, with a bar while its size is known if bar is set
+func layerLine(update PullProgress, bar bool) string {
+	line := fmt.Sprintf("%s: %s", update.ID, update.Status)
+	if !bar || update.Total <= 0 {
+		return line
+	}
+	done := int(min(update.Current, update.Total) * pullBarWidth / update.Total)
+	filled := strings.Repeat("=", done)
+	if done < pullBarWidth {
+		filled += ">"
+	}
+	return fmt.Sprintf("%-32s [%-*s] %s/%s", line, pullBarWidth, filled, FormatBytes(update.Current), FormatBytes(update.Total))
+}
+
+// FormatBytes renders a byte count with a decimal unit, as docker pull does
+func FormatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n), ""
+	for _, s := range []string{"kB", "MB", "GB", "TB"} {
+		value /= unit
+		suffix = s
+		if value < unit {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
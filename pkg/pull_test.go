@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitImageRef(t *testing.T) {
+	tests := []struct {
+		image, name, tag string
+	}{
+		{"nginx", "nginx", "latest"},
+		{"nginx:1.25", "nginx", "1.25"},
+		{"registry.local:5000/team/api", "registry.local:5000/team/api", "latest"},
+		{"registry.local:5000/team/api:v2", "registry.local:5000/team/api", "v2"},
+		{"nginx@sha256:abc", "nginx@sha256:abc", ""},
+	}
+	for _, tt := range tests {
+		if name, tag := splitImageRef(tt.image); name != tt.name || tag != tt.tag {
+			t.Errorf("splitImageRef(%q) = %q, %q, want %q, %q", tt.image, name, tag, tt.name, tt.tag)
+		}
+	}
+}
+
+func TestPullImageStreamsProgress(t *testing.T) {
+	d := newTestDockerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/images/create" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.URL.Query(); got.Get("fromImage") != "nginx" || got.Get("tag") != "1.25" {
+			t.Errorf("pull query = %v, want nginx at 1.25", got)
+		}
+		io.WriteString(w, `{"status":"Pulling from library/nginx","id":"1.25"}
+{"status":"Downloading","progressDetail":{"current":512,"total":2048},"id":"a1b2"}
+{"status":"Pull complete","progressDetail":{},"id":"a1b2"}
+{"errorDetail":{"message":"no space left on device"},"error":"no space left on device"}
+`)
+	}))
+
+	progress, err := d.PullImage(context.Background(), "nginx:1.25")
+	if err != nil {
+		t.Fatalf("PullImage failed: %v", err)
+	}
+	var got []PullProgress
+	for update := range progress {
+		got = append(got, update)
+	}
+	want := []PullProgress{
+		{ID: "1.25", Status: "Pulling from library/nginx"},
+		{ID: "a1b2", Status: "Downloading", Current: 512, Total: 2048},
+		{ID: "a1b2", Status: "Pull complete"},
+		{Error: "no space left on device"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("progress = %+v, want %+v", got, want)
+	}
+}
+
+func TestPullImageRejected(t *testing.T) {
+	d := newTestDockerClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message":"pull access denied for nope"}`)
+	}))
+
+	_, err := d.PullImage(context.Background(), "nope")
+	if err == nil || !strings.Contains(err.Error(), "pull access denied for nope") {
+		t.Errorf("PullImage error = %v, want Docker's message", err)
+	}
+}
+
+func TestPullDisplay(t *testing.T) {
+	updates := []PullProgress{
+		{Status: "Pulling from library/nginx"},
+		{ID: "a1b2", Status: "Downloading", Current: 1500000, Total: 3000000},
+		{ID: "a1b2", Status: "Downloading", Current: 3000000, Total: 3000000},
+		{ID: "a1b2", Status: "Pull complete"},
+	}
+
+	var plain strings.Builder
+	display := NewPullDisplay(&plain, false)
+	for _, update := range updates {
+		display.Update(update)
+	}
+	// Without a terminal, only status changes are printed
+	want := "Pulling from library/nginx\na1b2: Downloading\na1b2: Pull complete\n"
+	if plain.String() != want {
+		t.Errorf("plain output = %q, want %q", plain.String(), want)
+	}
+
+	var tty strings.Builder
+	display = NewPullDisplay(&tty, true)
+	display.Update(updates[0])
+	display.Update(updates[1])
+	if want := "a1b2: Downloading" + strings.Repeat(" ", 16) + "[===============>              ] 1.5MB/3.0MB"; !strings.Contains(tty.String(), want) {
+		t.Errorf("terminal output %q doesn't show the bar %q", tty.String(), want)
+	}
+	if display.Err() != nil {
+		t.Errorf("Err = %v before any failure", display.Err())
+	}
+	display.Update(PullProgress{Error: "no space left on device"})
+	if display.Err() == nil {
+		t.Error("Err = nil after Docker reported a failure")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{0: "0B", 999: "999B", 1000: "1.0kB", 1536000: "1.5MB", 2500000000: "2.5GB"} {
+		if got := FormatBytes(n); got != want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
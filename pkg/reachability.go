@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reachability of a server as shown in the server list
+const (
+	ReachabilityChecking    = "Checking"
+	ReachabilityReachable   = "Reachable"
+	ReachabilityUnreachable = "Unreachable"
+)
+
+// probeTimeout bounds each reachability probe, so a dead host doesn't stay Checking for long
+const probeTimeout = 3 * time.Second
+
+// reachabilityTTL is how long a probe result is reused before the server is probed again
+const reachabilityTTL = 30 * time.Second
+
+// probeServer checks that an SSH server answers at host, replaced in tests
+var probeServer = probeSSH
+
+// probeSSH connects to host and reads the SSH version banner without authenticating
+func probeSSH(host string) error {
+	conn, err := net.DialTimeout("tcp", sshAddr(host), probeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(probeTimeout))
+
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no SSH banner: %v", err)
+	}
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("not an SSH server: %q", strings.TrimSpace(banner))
+	}
+	return nil
+}
+
+// sshAddr returns host with SSH's port added when it names none
+func sshAddr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		return net.JoinHostPort(host, "22")
+	}
+	return host
+}
+
+// reachabilityResult is the outcome of the last probe of a host
+type reachabilityResult struct {
+	state   string
+	checked time.Time
+}
+
+// ReachabilityChecker probes servers in the background and caches the results by host
+type ReachabilityChecker struct {
+	now     func() time.Time
+	results map[string]reachabilityResult
+	mu      sync.Mutex
+}
+
+// NewReachabilityChecker creates a checker with no results yet
+func NewReachabilityChecker() *ReachabilityChecker {
+	return &ReachabilityChecker{
+		now:     time.Now,
+		results: make(map[string]reachabilityResult),
+	}
+}
+
+// Check probes each server whose result is missing or older than reachabilityTTL, or every
+// server not already being probed if force is set. Probes run concurrently and done is
+// called as each one finishes.
+func (r *ReachabilityChecker) Check(servers []ServerConfig, force bool, done func()) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for _, server := range servers {
+		host := server.Host
+		result, ok := r.results[host]
+		if ok && result.state == ReachabilityChecking {
+			continue
+		}
+		if ok && !force && now.Sub(result.checked) < reachabilityTTL {
+			continue
+		}
+		r.results[host] = reachabilityResult{state: ReachabilityChecking, checked: now}
+		go r.probe(host, done)
+	}
+}
+
+func (r *ReachabilityChecker) probe(host string, done func()) {
+	state := ReachabilityReachable
+	if err := probeServer(host); err != nil {
+		state = ReachabilityUnreachable
+	}
+
+	r.mu.Lock()
+	r.results[host] = reachabilityResult{state: state, checked: r.now()}
+	r.mu.Unlock()
+	if done != nil {
+		done()
+	}
+}
+
+// State returns the last known reachability of host, or "" if it hasn't been checked
+func (r *ReachabilityChecker) State(host string) string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.results[host].state
+}
@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Screens probe the configured servers when shown; keep tests off the network
+	probeServer = func(host string) error { return fmt.Errorf("probes are disabled in tests") }
+	// Fixtures connect to the same servers over and over without disconnecting
+	acquireServerLock = func(server string) (*ServerLock, error) { return nil, nil }
+	os.Exit(m.Run())
+}
+
+func TestProbeSSH(t *testing.T) {
+	serve := func(banner string) string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to create listener: %v", err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				io.WriteString(conn, banner)
+				conn.Close()
+			}
+		}()
+		return listener.Addr().String()
+	}
+
+	if err := probeSSH(serve("SSH-2.0-OpenSSH_9.6\r\n")); err != nil {
+		t.Errorf("probeSSH failed against an SSH server: %v", err)
+	}
+	if err := probeSSH(serve("HTTP/1.1 400 Bad Request\r\n")); err == nil {
+		t.Error("probeSSH accepted an HTTP server")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+	if err := probeSSH(closed); err == nil {
+		t.Error("probeSSH accepted a closed port")
+	}
+}
+
+func TestReachabilityChecker(t *testing.T) {
+	var mu sync.Mutex
+	probes := map[string]int{}
+	release := make(chan struct{})
+	probeServer = func(host string) error {
+		mu.Lock()
+		probes[host]++
+		mu.Unlock()
+		<-release
+		if host == "down.example.invalid:22" {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	}
+	t.Cleanup(func() { probeServer = func(string) error { return fmt.Errorf("probes are disabled in tests") } })
+
+	now := time.Now()
+	r := NewReachabilityChecker()
+	r.now = func() time.Time { return now }
+	servers := []ServerConfig{
+		{Name: "up", Host: "up.example.invalid:22"},
+		{Name: "down", Host: "down.example.invalid:22"},
+	}
+	done := make(chan struct{}, 10)
+	wait := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for probes")
+			}
+		}
+	}
+	check := func(force bool) { r.Check(servers, force, func() { done <- struct{}{} }) }
+
+	check(false)
+	if got := r.State("up.example.invalid:22"); got != ReachabilityChecking {
+		t.Errorf("state while probing = %q, want %q", got, ReachabilityChecking)
+	}
+	// Probes already running aren't started again, even when forced
+	check(true)
+	close(release)
+	wait(2)
+	if got := r.State("up.example.invalid:22"); got != ReachabilityReachable {
+		t.Errorf("up is %q, want %q", got, ReachabilityReachable)
+	}
+	if got := r.State("down.example.invalid:22"); got != ReachabilityUnreachable {
+		t.Errorf("down is %q, want %q", got, ReachabilityUnreachable)
+	}
+
+	// Fresh results are reused until they expire or a check is forced
+	check(false)
+	now = now.Add(reachabilityTTL)
+	check(false)
+	wait(2)
+	check(true)
+	wait(2)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, server := range servers {
+		if probes[server.Host] != 3 {
+			t.Errorf("%s probed %d times, want 3", server.Name, probes[server.Host])
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package pkg
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// pollInterval is how often services are fetched when Docker events aren't available
+	pollInterval = 2 * time.Second
+
+	// resyncInterval is how often services are fetched alongside Docker events, which
+	// can't report local processes taking a forwarded port
+	resyncInterval = 30 * time.Second
+
+	// refreshDebounce is how long a requested refresh waits for others to join it
+	refreshDebounce = 100 * time.Millisecond
+)
+
+// Refresher keeps a connection's services current for every screen showing them. It fetches
+// once per interval, or as Docker reports changes, and only tells subscribers when the
+// services actually changed, so screens redraw from its cache instead of polling on their own.
+type Refresher struct {
+	docker   ContainerAPI
+	requests chan struct{} // Pending request for a refresh, coalescing any made meanwhile
+	fetching sync.Mutex    // Held for a whole fetch, so concurrent refreshes don't overlap
+
+	mu          sync.Mutex
+	services    map[string]*ServiceStatus // Copies of the services as of the last change
+	fetchErr    string                    // Why the last fetch failed, empty if it didn't
+	lastUpdated time.Time
+	changed     chan struct{} // Closed on the next change, then replaced
+
+	fetched func(err error)                          // Called after every fetch
+	updated func(services map[string]*ServiceStatus) // Called with the services when they change, before subscribers hear
+	cancel  context.CancelFunc
+	done    chan struct{} // Closed once watching has stopped, nil until Start
+}
+
+// NewRefresher creates a refresher for docker's services; Start begins refreshing
+func NewRefresher(docker ContainerAPI) *Refresher {
+	return &Refresher{
+		docker:   docker,
+		requests: make(chan struct{}, 1),
+		changed:  make(chan struct{}),
+		cancel:   func() {},
+	}
+}
+
+// Start fetches the services now and keeps them current until Stop
+func (r *Refresher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	done := make(chan struct{})
+	r.done = done
+	go func() {
+		defer close(done)
+		r.watch(ctx)
+	}()
+}
+
+// Stop ends refreshing, waiting for a fetch in progress, and wakes subscribers, so they can
+// move on to the next connection's
+func (r *Refresher) Stop() {
+	r.cancel()
+	if r.done != nil {
+		<-r.done
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.changed:
+	default:
+		close(r.changed)
+	}
+}
+
+// Changed returns a channel closed the next time the services or the outcome of fetching
+// them change. Every subscriber calls it again after each wake.
+func (r *Refresher) Changed() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed
+}
+
+// LastUpdated returns when the services were last fetched successfully
+func (r *Refresher) LastUpdated() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastUpdated
+}
+
+// Request asks for a refresh soon. Requests made within refreshDebounce of each other, such
+// as by two screens opening together, share one fetch.
+func (r *Refresher) Request() {
+	select {
+	case r.requests <- struct{}{}:
+	default:
+	}
+}
+
+// Refresh fetches the services now, storing them and telling subscribers if they changed
+func (r *Refresher) Refresh() error {
+	r.fetching.Lock()
+	defer r.fetching.Unlock()
+	services, err := r.docker.GetServices()
+	if err == nil {
+		r.docker.UpdateServices(services)
+	}
+	r.apply(err)
+	return err
+}
+
+// watch refreshes until ctx is cancelled, re-fetching a container as soon as Docker reports
+// a change to it. Without an event stream it falls back to polling.
+func (r *Refresher) watch(ctx context.Context) {
+	r.Refresh()
+
+	interval := resyncInterval
+	events, err := r.docker.WatchEvents(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logError("Polling for service changes: %v", err)
+		interval = pollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	debounce := time.NewTimer(refreshDebounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reconnect()
+			r.Refresh()
+		case <-r.requests:
+			debounce.Reset(refreshDebounce)
+		case <-debounce.C:
+			r.Refresh()
+		case event, ok := <-events:
+			if !ok {
+				// The stream dropped, so poll until the next connection
+				events = nil
+				ticker.Reset(pollInterval)
+				continue
+			}
+			if event.ChangesService() {
+				r.refreshContainer(event)
+			}
+		}
+	}
+}
+
+// reconnector is a tunnel that can replace its dropped connection in place, as *SSHClient can
+type reconnector interface {
+	Connected() bool
+	Reconnect() error
+}
+
+// reconnect re-establishes a dropped SSH connection, keeping its forwards, so the next fetch
+// can succeed. A failure is left for the next tick to retry.
+func (r *Refresher) reconnect() {
+	client, ok := r.docker.GetClient().(reconnector)
+	if !ok || client.Connected() {
+		return
+	}
+	if err := client.Reconnect(); err != nil {
+		logDebug("SSH reconnect failed", "err", err)
+		return
+	}
+	logInfo("Reconnected over SSH")
+}
+
+// refreshContainer re-fetches the container an event is about
+func (r *Refresher) refreshContainer(event DockerEvent) {
+	r.fetching.Lock()
+	defer r.fetching.Unlock()
+	r.apply(r.docker.RefreshContainer(event.Actor.ID, event.Name()))
+}
+
+// apply records a fetch's outcome, comparing the stored services with the cached copies and
+// waking subscribers if either changed; r.fetching must be held
+func (r *Refresher) apply(err error) {
+	var services map[string]*ServiceStatus
+	if err == nil {
+		r.docker.ViewServices(func(current map[string]*ServiceStatus) {
+			services = cloneServices(current)
+		})
+	}
+	r.mu.Lock()
+	select {
+	case <-r.changed:
+		// Stopped, so the display has moved on to another connection
+		r.mu.Unlock()
+		return
+	default:
+	}
+	fetchErr := ""
+	if err != nil {
+		fetchErr = err.Error()
+	} else {
+		r.lastUpdated = time.Now()
+	}
+	changed := fetchErr != r.fetchErr || (err == nil && !sameServices(services, r.services))
+	r.fetchErr = fetchErr
+	if err == nil {
+		r.services = services
+	}
+	r.mu.Unlock()
+	if r.fetched != nil {
+		r.fetched(err)
+	}
+	if !changed {
+		return
+	}
+
+	if err == nil && r.updated != nil {
+		r.updated(r.docker.Services())
+	}
+	r.mu.Lock()
+	select {
+	case <-r.changed:
+		// Stopped, so there's no one left to wake
+	default:
+		close(r.changed)
+		r.changed = make(chan struct{})
+	}
+	r.mu.Unlock()
+}
+
+// cloneServices copies services, so later changes in place can be told apart
+func cloneServices(services map[string]*ServiceStatus) map[string]*ServiceStatus {
+	clones := make(map[string]*ServiceStatus, len(services))
+	for name, service := range services {
+		clones[name] = service.Clone()
+	}
+	return clones
+}
+
+// sameServices reports whether a and b hold the same services in the same state
+func sameServices(a, b map[string]*ServiceStatus) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return maps.EqualFunc(a, b, func(x, y *ServiceStatus) bool {
+		return x.Name == y.Name && x.Image == y.Image && x.HealthStatus == y.HealthStatus &&
+			x.ForwardStatus == y.ForwardStatus && x.Created.Equal(y.Created) && x.Replicas == y.Replicas &&
+			slices.EqualFunc(x.ForwardedPorts, y.ForwardedPorts, samePort)
+	})
+}
+
+// samePort reports whether two ports are forwarded alike, held by the same process if any
+func samePort(a, b ForwardedPort) bool {
+	if (a.ConflictInfo == nil) != (b.ConflictInfo == nil) || a.ConflictInfo != nil && *a.ConflictInfo != *b.ConflictInfo {
+		return false
+	}
+	return a.Remote == b.Remote && a.Local == b.Local && a.Protocol == b.Protocol && a.Status == b.Status && a.Error == b.Error
+}
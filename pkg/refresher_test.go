@@ -0,0 +1,131 @@
+package pkg_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dockforward "dockforward/pkg"
+	"dockforward/pkg/testutil"
+)
+
+// countingDocker is a FakeDocker counting the listings fetched from it
+type countingDocker struct {
+	*testutil.FakeDocker
+	fetches atomic.Int32
+}
+
+func newCountingDocker() *countingDocker {
+	return &countingDocker{FakeDocker: testutil.NewFakeDocker(nil, testutil.CannedServices()...)}
+}
+
+func (c *countingDocker) GetServices() (map[string]*dockforward.ServiceStatus, error) {
+	c.fetches.Add(1)
+	return c.FakeDocker.GetServices()
+}
+
+// closed reports whether ch has been closed
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestRefresherSignalsOnlyChanges(t *testing.T) {
+	docker := newCountingDocker()
+	refresher := dockforward.NewRefresher(docker)
+
+	overview, detail := refresher.Changed(), refresher.Changed()
+	if err := refresher.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if !closed(overview) || !closed(detail) {
+		t.Error("first fetch didn't wake every subscriber")
+	}
+	if refresher.LastUpdated().IsZero() {
+		t.Error("LastUpdated not set by a successful fetch")
+	}
+
+	unchanged := refresher.Changed()
+	refresher.Refresh()
+	if closed(unchanged) {
+		t.Error("fetching the same services woke subscribers")
+	}
+
+	// A local process taking a forwarded port is a change
+	docker.HoldPort("3000", &dockforward.ProcessInfo{Name: "node", PID: "4242"})
+	docker.UpdateForwardingStatus()
+	refresher.Refresh()
+	if !closed(unchanged) {
+		t.Error("a new conflict didn't wake subscribers")
+	}
+
+	// So is a fetch starting to fail, but not failing again
+	failing := refresher.Changed()
+	docker.Fail("GetServices", errors.New("daemon gone"))
+	refresher.Refresh()
+	if !closed(failing) {
+		t.Error("a failed fetch didn't wake subscribers")
+	}
+	stillFailing := refresher.Changed()
+	refresher.Refresh()
+	if closed(stillFailing) {
+		t.Error("failing the same way again woke subscribers")
+	}
+}
+
+func TestRefresherCoalescesRequests(t *testing.T) {
+	docker := newCountingDocker()
+	refresher := dockforward.NewRefresher(docker)
+	refresher.Start()
+	t.Cleanup(refresher.Stop)
+
+	// The overview and detail screens opening together share one fetch after the first
+	for range 3 {
+		refresher.Request()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for docker.fetches.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got := docker.fetches.Load(); got != 2 {
+		t.Errorf("%d fetches, want the first and one for the requests", got)
+	}
+
+	stopped := refresher.Changed()
+	refresher.Stop()
+	if !closed(stopped) {
+		t.Error("Stop didn't wake subscribers")
+	}
+}
+
+// BenchmarkRefresh compares the Docker API listings made per refresh interval with the
+// overview and detail screens both showing services
+func BenchmarkRefresh(b *testing.B) {
+	// Each screen polling on its own ticker
+	b.Run("per-screen", func(b *testing.B) {
+		docker := newCountingDocker()
+		for i := 0; i < b.N; i++ {
+			for range 2 {
+				services, _ := docker.GetServices()
+				docker.UpdateServices(services)
+			}
+		}
+		b.ReportMetric(float64(docker.fetches.Load())/float64(b.N), "fetches/interval")
+	})
+
+	// Both screens redrawing from one refresher's fetch
+	b.Run("shared", func(b *testing.B) {
+		docker := newCountingDocker()
+		refresher := dockforward.NewRefresher(docker)
+		for i := 0; i < b.N; i++ {
+			refresher.Refresh()
+		}
+		b.ReportMetric(float64(docker.fetches.Load())/float64(b.N), "fetches/interval")
+	})
+}
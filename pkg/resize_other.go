@@ -0,0 +1,8 @@
+//go:build !unix
+
+package pkg
+
+import "os"
+
+// notifyResize does nothing here, there's no resize signal to listen for
+func notifyResize(c chan<- os.Signal) {}
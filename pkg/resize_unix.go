@@ -0,0 +1,15 @@
+//go:build unix
+
+package pkg
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// notifyResize delivers a signal on c whenever the terminal is resized
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, unix.SIGWINCH)
+}
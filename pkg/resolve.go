@@ -0,0 +1,296 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Choices for a conflicted port in the resolve wizard
+const (
+	resolveKill  = "kill"
+	resolveRemap = "remap"
+	resolveSkip  = "skip"
+)
+
+// portConflict is a forwarded port whose local port another process holds
+type portConflict struct {
+	Service string
+	Remote  string
+	Local   string
+	Process *ProcessInfo
+	NewPort string // Free local port offered for remapping
+	Choice  string
+	Result  string // What applying the choice did, for the summary
+}
+
+// ResolveScreen walks through every port conflict, collecting a kill, remap or skip for
+// each, then applies them all in one pass and shows what was done
+type ResolveScreen struct {
+	display   *DisplayManager
+	docker    ContainerAPI
+	conflicts []*portConflict
+	current   int  // Conflict being decided
+	applied   bool // Whether the choices were applied and the summary is showing
+}
+
+func NewResolveScreen(display *DisplayManager, docker ContainerAPI) *ResolveScreen {
+	return &ResolveScreen{
+		display:   display,
+		docker:    docker,
+		conflicts: findConflicts(docker),
+	}
+}
+
+// findConflicts lists the conflicted ports of every service by service name, each offered
+// the next local port that's neither in use nor offered to another conflict
+func findConflicts(docker ContainerAPI) []*portConflict {
+	if docker == nil {
+		return nil
+	}
+	taken := make(map[string]bool)
+	if inUse, err := GetLocalInUsePorts(); err != nil {
+		logWarn("Failed to list local ports, remap suggestions may be in use: %v", err)
+	} else {
+		for _, port := range inUse {
+			taken[port] = true
+		}
+	}
+
+	var conflicts []*portConflict
+	docker.ViewServices(func(services map[string]*ServiceStatus) {
+		for _, service := range services {
+			for _, port := range service.ForwardedPorts {
+				taken[port.Local] = true
+				if port.Status == StatusConflict {
+					conflicts = append(conflicts, &portConflict{
+						Service: service.Name,
+						Remote:  port.Remote,
+						Local:   port.Local,
+						Process: port.ConflictInfo,
+					})
+				}
+			}
+		}
+	})
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Service != conflicts[j].Service {
+			return conflicts[i].Service < conflicts[j].Service
+		}
+		return portNumber(conflicts[i].Remote) < portNumber(conflicts[j].Remote)
+	})
+	for _, conflict := range conflicts {
+		conflict.NewPort = nextFreePort(conflict.Local, taken)
+		taken[conflict.NewPort] = true
+	}
+	return conflicts
+}
+
+// nextFreePort returns the first port above port that isn't taken, or "" if there's none
+func nextFreePort(port string, taken map[string]bool) string {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return ""
+	}
+	for candidate := n + 1; candidate <= 65535; candidate++ {
+		if p := strconv.Itoa(candidate); !taken[p] {
+			return p
+		}
+	}
+	return ""
+}
+
+// describeProcess names a process holding a port, e.g. "postgres (PID 812, user alice)"
+func describeProcess(info *ProcessInfo) string {
+	if info == nil {
+		return "unknown process"
+	}
+	if info.User == "" {
+		return fmt.Sprintf("%s (PID %s)", info.Name, info.PID)
+	}
+	return fmt.Sprintf("%s (PID %s, user %s)", info.Name, info.PID, info.User)
+}
+
+func (s *ResolveScreen) Display(w io.Writer) {
+	if s.applied || len(s.conflicts) == 0 {
+		s.displaySummary(w)
+		return
+	}
+
+	conflict := s.conflicts[s.current]
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header(fmt.Sprintf("Resolve Conflicts (%d of %d)", s.current+1, len(s.conflicts))))
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Property", "Value"})
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("─")
+	table.SetColumnSeparator("│")
+	table.SetRowSeparator("─")
+	table.SetHeaderLine(true)
+	table.SetBorder(true)
+
+	rows := [][]string{
+		{"Service", conflict.Service},
+		{"Remote Port", conflict.Remote},
+		{"Local Port", s.display.colors.Unhealthy(conflict.Local + " (in use)")},
+		{"Held By", describeProcess(conflict.Process)},
+	}
+	if conflict.Process != nil && conflict.Process.Command != "" {
+		rows = append(rows, []string{"Command", truncateString(conflict.Process.Command, 60)})
+	}
+	s.display.appendFitted(table, []string{"Property", "Value"}, rows, []int{priorityHigh, priorityLow})
+	table.Render()
+
+	if s.current > 0 {
+		fmt.Fprintln(w, "\nChosen so far:")
+		for _, decided := range s.conflicts[:s.current] {
+			fmt.Fprintf(w, "  %s %s: %s\n", decided.Service, decided.Remote, s.describeChoice(decided))
+		}
+	}
+
+	s.display.renderActions(w, s.Keys())
+}
+
+// describeChoice says what a choice will do before it's applied
+func (s *ResolveScreen) describeChoice(conflict *portConflict) string {
+	switch conflict.Choice {
+	case resolveKill:
+		return "kill " + describeProcess(conflict.Process)
+	case resolveRemap:
+		return "remap to local port " + conflict.NewPort
+	}
+	return "skip"
+}
+
+func (s *ResolveScreen) displaySummary(w io.Writer) {
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header("Resolve Conflicts: Summary"))
+	if len(s.conflicts) == 0 {
+		fmt.Fprintln(w, "No port conflicts to resolve.")
+	}
+	for _, conflict := range s.conflicts {
+		fmt.Fprintf(w, "%s %s: %s\n", conflict.Service, conflict.Remote, conflict.Result)
+	}
+	s.display.renderActions(w, s.Keys())
+}
+
+// Keys returns the choices for the current conflict, or just back once they're applied
+func (s *ResolveScreen) Keys() Keymap {
+	back := Binding{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to overview", Action: func([]string) bool {
+		s.display.SetMode(ModeOverview)
+		return true
+	}}
+	if s.applied || len(s.conflicts) == 0 {
+		return Keymap{back}
+	}
+
+	conflict := s.conflicts[s.current]
+	back.Description = "Return to overview without changing anything"
+	return Keymap{
+		{Keys: []string{"K", "kill"}, Label: "[K]ill", Description: fmt.Sprintf("Kill %s and forward local port %s", describeProcess(conflict.Process), conflict.Local), Action: func([]string) bool {
+			s.choose(resolveKill)
+			return true
+		}},
+		{Keys: []string{"r", "remap"}, Label: "[r]emap", Description: fmt.Sprintf("Forward to free local port %s instead", conflict.NewPort), Action: func([]string) bool {
+			if conflict.NewPort == "" {
+				return false
+			}
+			s.choose(resolveRemap)
+			return true
+		}},
+		{Keys: []string{"#", "remap #"}, Label: "[#] remap", Description: "Forward to the typed local port instead (e.g., '18080')", Action: func(args []string) bool {
+			port := args[len(args)-1]
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				return false
+			}
+			conflict.NewPort = port
+			s.choose(resolveRemap)
+			return true
+		}},
+		{Keys: []string{"s", "skip"}, Label: "[s]kip", Description: "Leave this port as it is", Action: func([]string) bool {
+			s.choose(resolveSkip)
+			return true
+		}},
+		{Keys: []string{"a", "all"}, Label: "[a]ll", Description: "Remap this and every remaining conflict to a free local port", Action: func([]string) bool {
+			remaining := len(s.conflicts) - s.current
+			question := fmt.Sprintf("Remap %s to free local ports?", plural(remaining, "conflicted port"))
+			s.display.confirm(question, func() error {
+				for _, conflict := range s.conflicts[s.current:] {
+					conflict.Choice = resolveRemap
+				}
+				s.current = len(s.conflicts)
+				s.apply()
+				return nil
+			})
+			return true
+		}},
+		back,
+	}
+}
+
+// choose records the choice for the current conflict, applying every choice after the last
+func (s *ResolveScreen) choose(choice string) {
+	s.conflicts[s.current].Choice = choice
+	s.current++
+	if s.current == len(s.conflicts) {
+		s.apply()
+	}
+}
+
+// apply carries out every choice, then rechecks which local ports are free
+func (s *ResolveScreen) apply() {
+	for _, conflict := range s.conflicts {
+		conflict.Result = s.applyChoice(conflict)
+	}
+	if err := s.docker.UpdateForwardingStatus(); err != nil {
+		logError("Failed to recheck forwarded ports: %v", err)
+	}
+	s.display.UpdateServices(s.docker.Services())
+	s.applied = true
+}
+
+// applyChoice carries out one conflict's choice, describing the outcome
+func (s *ResolveScreen) applyChoice(conflict *portConflict) string {
+	if conflict.Choice == resolveSkip || conflict.Choice == "" {
+		return "skipped"
+	}
+	service := s.docker.GetService(conflict.Service)
+	if service == nil {
+		return "failed: service is gone"
+	}
+
+	switch conflict.Choice {
+	case resolveKill:
+		info, err := s.display.killPortProcess(service, conflict.Remote)
+		if err != nil {
+			return s.display.colors.Unhealthy(fmt.Sprintf("failed: %v", err))
+		}
+		if info == nil {
+			return fmt.Sprintf("nothing holds local port %s any more", conflict.Local)
+		}
+		return s.display.colors.Healthy(fmt.Sprintf("killed %s, forwarded on local port %s", describeProcess(info), conflict.Local))
+	case resolveRemap:
+		if err := s.display.remapAndRecord(service, conflict.Remote, conflict.NewPort); err != nil {
+			return s.display.colors.Unhealthy(fmt.Sprintf("failed: %v", err))
+		}
+		return s.display.colors.Healthy(fmt.Sprintf("remapped from local port %s to %s", conflict.Local, conflict.NewPort))
+	}
+	return "skipped"
+}
+
+func (s *ResolveScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *ResolveScreen) NeedsRefresh() bool {
+	return false
+}
+
+// Close is a no-op, the wizard has no background work
+func (s *ResolveScreen) Close() {}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNextFreePort(t *testing.T) {
+	taken := map[string]bool{"5433": true, "5434": true}
+	if got := nextFreePort("5432", taken); got != "5435" {
+		t.Errorf("nextFreePort(5432) = %q, want 5435", got)
+	}
+	if got := nextFreePort("65535", taken); got != "" {
+		t.Errorf("nextFreePort(65535) = %q, want none", got)
+	}
+}
+
+func TestResolveRemapsChosenConflicts(t *testing.T) {
+	dm, client := newRemapFixture(t)
+	screen := NewResolveScreen(dm, dm.docker)
+	if len(screen.conflicts) != 1 || screen.conflicts[0].Service != "db" {
+		t.Fatalf("conflicts = %+v, want db's port", screen.conflicts)
+	}
+
+	var out bytes.Buffer
+	screen.Display(&out)
+	for _, want := range []string{"Resolve Conflicts (1 of 1)", "5432 (in use)", "[K]ill", "[a]ll"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("wizard doesn't show %q:\n%s", want, out.String())
+		}
+	}
+
+	if !screen.HandleInput("15432") {
+		t.Fatal("remap with a custom port was rejected")
+	}
+	if !screen.applied {
+		t.Fatal("choices weren't applied after the last conflict")
+	}
+	if got := client.ports["5432"]; got != "15432" {
+		t.Errorf("forward for 5432 goes to %q, want 15432", got)
+	}
+	if !dm.canUndo() {
+		t.Error("remap wasn't recorded in the action history")
+	}
+
+	out.Reset()
+	screen.Display(&out)
+	if want := "db 5432: remapped from local port 5432 to 15432"; !strings.Contains(out.String(), want) {
+		t.Errorf("summary doesn't show %q:\n%s", want, out.String())
+	}
+}
+
+func TestResolveSkipChangesNothing(t *testing.T) {
+	dm, client := newRemapFixture(t)
+	screen := NewResolveScreen(dm, dm.docker)
+	screen.HandleInput("s")
+	if _, ok := client.ports["5432"]; ok {
+		t.Error("skipped conflict was forwarded")
+	}
+	if want := "skipped"; screen.conflicts[0].Result != want {
+		t.Errorf("result = %q, want %q", screen.conflicts[0].Result, want)
+	}
+}
+
+func TestResolveAllNeedsConfirmation(t *testing.T) {
+	dm, client := newRemapFixture(t)
+	screen := NewResolveScreen(dm, dm.docker)
+	suggested := screen.conflicts[0].NewPort
+
+	screen.HandleInput("a")
+	if screen.applied {
+		t.Fatal("remapped everything before confirming")
+	}
+	modal := dm.topModal()
+	if modal == nil {
+		t.Fatal("no confirmation shown")
+	}
+	modal.HandleInput("y")
+	if !screen.applied {
+		t.Fatal("choices weren't applied after confirming")
+	}
+	if got := client.ports["5432"]; got != suggested {
+		t.Errorf("forward for 5432 goes to %q, want the suggested %s", got, suggested)
+	}
+}
@@ -0,0 +1,313 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// resourceInterval is how often the remote host's disk, memory and load are collected
+	resourceInterval = 30 * time.Second
+
+	// Usage percentages colored as a warning, and as critical in the status bar too
+	resourceWarnPercent     = 80
+	resourceCriticalPercent = 90
+
+	// resourceSeparator splits the output of the batched resource command into sections
+	resourceSeparator = "--dockforward--"
+)
+
+// HostResources is a snapshot of the remote host's disk, memory and load, and of the space
+// Docker's data takes up. Sizes are in bytes.
+type HostResources struct {
+	DataRoot      string // Docker's data root, whose filesystem the disk figures describe
+	DiskTotal     int64
+	DiskUsed      int64
+	DiskAvailable int64
+	MemTotal      int64
+	MemAvailable  int64
+	Load          [3]float64 // 1, 5 and 15 minute load averages
+
+	Images     int64 // Image layers
+	Containers int64 // Containers' writable layers
+	Volumes    int64
+	BuildCache int64
+}
+
+// DiskPercent returns the share of the data root's filesystem in use, as df reports it
+func (r *HostResources) DiskPercent() float64 {
+	if r.DiskUsed+r.DiskAvailable == 0 {
+		return 0
+	}
+	return float64(r.DiskUsed) * 100 / float64(r.DiskUsed+r.DiskAvailable)
+}
+
+// MemPercent returns the share of memory not available to new processes
+func (r *HostResources) MemPercent() float64 {
+	if r.MemTotal == 0 {
+		return 0
+	}
+	return float64(r.MemTotal-r.MemAvailable) * 100 / float64(r.MemTotal)
+}
+
+// DockerUsage returns the space taken by images, containers, volumes and build cache
+func (r *HostResources) DockerUsage() int64 {
+	return r.Images + r.Containers + r.Volumes + r.BuildCache
+}
+
+// DiskCritical reports whether the data root's filesystem is nearly full
+func (r *HostResources) DiskCritical() bool {
+	return r.DiskPercent() >= resourceCriticalPercent
+}
+
+// GetHostResources collects the remote host's resources: Docker's data root and disk
+// usage from the API, and the filesystem, memory and load from one batched command
+func (d *DockerClient) GetHostResources(ctx context.Context) (*HostResources, error) {
+	runner, _ := d.sshClient.(commandRunner)
+	if d.runner != nil {
+		runner = d.runner
+	}
+	if runner == nil {
+		return nil, fmt.Errorf("host resources can only be collected over SSH")
+	}
+
+	var info struct {
+		DockerRootDir string
+	}
+	if err := d.apiRequest(ctx, http.MethodGet, "/info", &info); err != nil {
+		return nil, fmt.Errorf("failed to get Docker info: %w", err)
+	}
+	resources := &HostResources{DataRoot: info.DockerRootDir}
+	if resources.DataRoot == "" {
+		resources.DataRoot = "/"
+	}
+
+	output, err := runner.RunCommandContext(ctx, resourceCommand(resources.DataRoot))
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect host resources: %v", err)
+	}
+	if err := parseResources(output, resources); err != nil {
+		return nil, err
+	}
+
+	// Docker's own usage is a nicety, so the host's figures are still shown without it
+	if err := d.dockerDiskUsage(ctx, resources); err != nil {
+		logWarn("Failed to get Docker disk usage: %v", err)
+	}
+	return resources, nil
+}
+
+// dockerDiskUsage fills in the space Docker's data takes up from /system/df
+func (d *DockerClient) dockerDiskUsage(ctx context.Context, resources *HostResources) error {
+	var df struct {
+		LayersSize int64
+		Containers []struct {
+			SizeRw int64
+		}
+		Volumes []struct {
+			UsageData *volumeUsage
+		}
+		BuildCache []struct {
+			Size int64
+		}
+	}
+	if err := d.apiRequest(ctx, http.MethodGet, "/system/df", &df); err != nil {
+		return err
+	}
+	resources.Images = df.LayersSize
+	for _, container := range df.Containers {
+		resources.Containers += container.SizeRw
+	}
+	for _, volume := range df.Volumes {
+		if volume.UsageData != nil && volume.UsageData.Size > 0 {
+			resources.Volumes += volume.UsageData.Size
+		}
+	}
+	for _, cache := range df.BuildCache {
+		resources.BuildCache += cache.Size
+	}
+	return nil
+}
+
+// resourceCommand returns the command printing the filesystem of dataRoot, memory and load
+// in one round trip. df -Pk and free print alike on GNU and busybox hosts.
+func resourceCommand(dataRoot string) string {
+	return fmt.Sprintf("df -Pk %s 2>/dev/null || df -Pk /; echo %s; free; echo %s; cat /proc/loadavg",
+		ShellQuote(dataRoot), resourceSeparator, resourceSeparator)
+}
+
+// parseResources reads the output of resourceCommand into resources
+func parseResources(output string, resources *HostResources) error {
+	sections := strings.Split(output, resourceSeparator+"\n")
+	if len(sections) != 3 {
+		return fmt.Errorf("unexpected output collecting host resources: %q", truncateString(output, 80))
+	}
+	var err error
+	if resources.DiskTotal, resources.DiskUsed, resources.DiskAvailable, err = parseDF(sections[0]); err != nil {
+		return err
+	}
+	if resources.MemTotal, resources.MemAvailable, err = parseFree(sections[1]); err != nil {
+		return err
+	}
+	if resources.Load, err = parseLoadavg(sections[2]); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseDF reads the sizes from df -Pk output. GNU df wraps a long filesystem name onto a
+// line of its own, so the fields are read around the capacity column ending in %.
+func parseDF(output string) (total, used, available int64, err error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return 0, 0, 0, fmt.Errorf("unexpected df output: %q", truncateString(output, 80))
+	}
+	fields := strings.Fields(strings.Join(lines[1:], " "))
+	for i := 3; i < len(fields); i++ {
+		if !strings.HasSuffix(fields[i], "%") {
+			continue
+		}
+		var sizes [3]int64
+		for j := range sizes {
+			kb, err := strconv.ParseInt(fields[i-3+j], 10, 64)
+			if err != nil {
+				return 0, 0, 0, fmt.Errorf("unexpected df output: %q", truncateString(output, 80))
+			}
+			sizes[j] = kb * 1024
+		}
+		return sizes[0], sizes[1], sizes[2], nil
+	}
+	return 0, 0, 0, fmt.Errorf("unexpected df output: %q", truncateString(output, 80))
+}
+
+// parseFree reads total and available memory from free's output in KiB. Hosts whose free
+// has no available column, such as older busybox, count free memory plus buffers and cache.
+func parseFree(output string) (total, available int64, err error) {
+	var columns []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "total" {
+			columns = fields
+			continue
+		}
+		if len(fields) < 2 || fields[0] != "Mem:" || columns == nil {
+			continue
+		}
+		values := make(map[string]int64)
+		for i, column := range columns {
+			if i+1 >= len(fields) {
+				break
+			}
+			kb, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("unexpected free output: %q", truncateString(output, 80))
+			}
+			values[column] = kb * 1024
+		}
+		total = values["total"]
+		var ok bool
+		if available, ok = values["available"]; !ok {
+			available = values["free"] + values["buffers"] + values["cached"] + values["buff/cache"]
+		}
+		return total, available, nil
+	}
+	return 0, 0, fmt.Errorf("unexpected free output: %q", truncateString(output, 80))
+}
+
+// parseLoadavg reads the 1, 5 and 15 minute load averages from /proc/loadavg
+func parseLoadavg(output string) ([3]float64, error) {
+	var load [3]float64
+	fields := strings.Fields(output)
+	if len(fields) < 3 {
+		return load, fmt.Errorf("unexpected load average: %q", truncateString(output, 80))
+	}
+	for i := range load {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return load, fmt.Errorf("unexpected load average: %q", truncateString(output, 80))
+		}
+		load[i] = value
+	}
+	return load, nil
+}
+
+// watchResources collects the host's resources every resourceInterval until ctx is done,
+// redrawing with each collection
+func (d *DisplayManager) watchResources(ctx context.Context, docker ContainerAPI) {
+	ticker := time.NewTicker(resourceInterval)
+	defer ticker.Stop()
+	for {
+		resources, err := docker.GetHostResources(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		d.mu.Lock()
+		if err != nil {
+			logDebug("Failed to collect host resources", "err", err)
+			d.resourcesErr = err.Error()
+		} else {
+			d.resources, d.resourcesErr = resources, ""
+		}
+		d.mu.Unlock()
+		d.Display()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// hostResources returns the last resources collected and why the last collection failed
+func (d *DisplayManager) hostResources() (*HostResources, string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.resources, d.resourcesErr
+}
+
+// colorizeUsage colors a usage percentage by how close it is to full
+func (d *DisplayManager) colorizeUsage(percent float64, text string) string {
+	switch {
+	case percent >= resourceCriticalPercent:
+		return d.colors.Unhealthy(text)
+	case percent >= resourceWarnPercent:
+		return d.colors.Warning(text)
+	}
+	return d.colors.Healthy(text)
+}
+
+// renderResources draws the host resource panel shown over the overview's services
+func (d *DisplayManager) renderResources(w io.Writer) {
+	resources, fetchErr := d.hostResources()
+	switch {
+	case resources == nil && fetchErr != "":
+		fmt.Fprintf(w, "Host resources unavailable: %s\n\n", fetchErr)
+		return
+	case resources == nil:
+		fmt.Fprint(w, "Collecting host resources...\n\n")
+		return
+	}
+
+	disk := resources.DiskPercent()
+	fmt.Fprintf(w, "Disk    %s, %s free of %s (%s)\n",
+		d.colorizeUsage(disk, fmt.Sprintf("%.0f%% used", disk)),
+		FormatBytes(resources.DiskAvailable), FormatBytes(resources.DiskTotal), resources.DataRoot)
+	memory := resources.MemPercent()
+	fmt.Fprintf(w, "Memory  %s, %s available of %s\n",
+		d.colorizeUsage(memory, fmt.Sprintf("%.0f%% used", memory)),
+		FormatBytes(resources.MemAvailable), FormatBytes(resources.MemTotal))
+	fmt.Fprintf(w, "Load    %.2f %.2f %.2f\n", resources.Load[0], resources.Load[1], resources.Load[2])
+	fmt.Fprintf(w, "Docker  %s (images %s, containers %s, volumes %s, build cache %s)\n",
+		FormatBytes(resources.DockerUsage()), FormatBytes(resources.Images), FormatBytes(resources.Containers),
+		FormatBytes(resources.Volumes), FormatBytes(resources.BuildCache))
+	if fetchErr != "" {
+		fmt.Fprintln(w, d.colors.Warning("Last collection failed: "+fetchErr))
+	}
+	fmt.Fprintln(w)
+}
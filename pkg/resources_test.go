@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDF(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"GNU", `Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sda1        102400000 83968000  18432000      82% /
+`},
+		{"GNU wrapped", `Filesystem                                           1024-blocks     Used Available Capacity Mounted on
+/dev/mapper/ubuntu--vg-ubuntu--lv--with--a--long--name
+                                                       102400000 83968000  18432000      82% /var/lib/docker
+`},
+		{"busybox", `Filesystem           1024-blocks    Used Available Capacity Mounted on
+overlay              102400000  83968000  18432000  82% /
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, used, available, err := parseDF(tt.output)
+			if err != nil {
+				t.Fatalf("parseDF failed: %v", err)
+			}
+			if total != 102400000*1024 || used != 83968000*1024 || available != 18432000*1024 {
+				t.Errorf("parseDF = %d, %d, %d", total, used, available)
+			}
+		})
+	}
+
+	if _, _, _, err := parseDF("df: /var/lib/docker: No such file or directory\n"); err == nil {
+		t.Error("parseDF accepted an error message")
+	}
+}
+
+func TestParseFree(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		available int64
+	}{
+		{"GNU", `               total        used        free      shared  buff/cache   available
+Mem:        16318412     9021848      812340      402132     6484224     6520100
+Swap:        2097148      102400     1994748
+`, 6520100},
+		{"busybox", `              total        used        free      shared  buff/cache   available
+Mem:       16318412     9021848      812340      402132     6484224     6520100
+Swap:             0           0           0
+`, 6520100},
+		{"old busybox", `             total       used       free     shared    buffers     cached
+Mem:      16318412    9021848     812340          0     100000    5600000
+-/+ buffers/cache:    3321848   12996564
+Swap:            0          0          0
+`, 812340 + 100000 + 5600000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, available, err := parseFree(tt.output)
+			if err != nil {
+				t.Fatalf("parseFree failed: %v", err)
+			}
+			if total != 16318412*1024 || available != tt.available*1024 {
+				t.Errorf("parseFree = %d, %d, want %d, %d", total, available, 16318412*1024, tt.available*1024)
+			}
+		})
+	}
+}
+
+// cannedRunner answers every command with the same output
+type cannedRunner struct {
+	output   string
+	commands []string
+}
+
+func (r *cannedRunner) RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	r.commands = append(r.commands, cmd)
+	return r.output, nil
+}
+
+func TestGetHostResources(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"DockerRootDir":"/srv/docker"}`)
+	})
+	mux.HandleFunc("GET /system/df", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"LayersSize":4000,"Containers":[{"SizeRw":100},{"SizeRw":20}],
+			"Volumes":[{"UsageData":{"Size":300,"RefCount":1}},{"UsageData":{"Size":-1,"RefCount":-1}}],
+			"BuildCache":[{"Size":50}]}`)
+	})
+	d := newTestDockerClient(t, mux)
+	runner := &cannedRunner{output: `Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sdb1        100000 93000  7000      94% /srv
+--dockforward--
+               total        used        free      shared  buff/cache   available
+Mem:        1000000      600000      100000           0      300000      400000
+--dockforward--
+0.52 0.58 0.59 1/467 12345
+`}
+	d.runner = runner
+
+	resources, err := d.GetHostResources(context.Background())
+	if err != nil {
+		t.Fatalf("GetHostResources failed: %v", err)
+	}
+	if len(runner.commands) != 1 || !strings.Contains(runner.commands[0], "df -Pk '/srv/docker'") {
+		t.Errorf("ran %q, want one command measuring the data root", runner.commands)
+	}
+	if resources.DataRoot != "/srv/docker" || resources.DiskPercent() != 93 || !resources.DiskCritical() {
+		t.Errorf("disk = %s at %.1f%%, want /srv/docker at 93%%", resources.DataRoot, resources.DiskPercent())
+	}
+	if resources.MemPercent() != 60 || resources.Load != [3]float64{0.52, 0.58, 0.59} {
+		t.Errorf("memory at %.1f%% with load %v", resources.MemPercent(), resources.Load)
+	}
+	if resources.DockerUsage() != 4470 || resources.Volumes != 300 {
+		t.Errorf("Docker usage = %d with volumes %d, want 4470 and 300", resources.DockerUsage(), resources.Volumes)
+	}
+}
+
+func TestHostResourcesPanel(t *testing.T) {
+	docker := fixtureDockerClient()
+	config := fixtureConfig()
+	config.Display.ShowHost = true
+	dm := &DisplayManager{config: config, docker: docker, colors: NewColorizer(false)}
+	screen := &LandingScreen{display: dm, docker: docker}
+
+	if got := renderScreen(screen); !strings.Contains(got, "Collecting host resources...") {
+		t.Errorf("panel before the first collection:\n%s", got)
+	}
+
+	dm.resources = &HostResources{
+		DataRoot: "/var/lib/docker", DiskTotal: 100e9, DiskUsed: 95e9, DiskAvailable: 5e9,
+		MemTotal: 16e9, MemAvailable: 6e9, Load: [3]float64{0.5, 0.25, 1},
+		Images: 40e9, Containers: 1e9, Volumes: 3e9, BuildCache: 1e9,
+	}
+	got := renderScreen(screen)
+	for _, want := range []string{
+		"Disk    95% used, 5.0GB free of 100.0GB (/var/lib/docker)",
+		"Memory  62% used, 6.0GB available of 16.0GB",
+		"Load    0.50 0.25 1.00",
+		"Docker  45.0GB (images 40.0GB, containers 1.0GB, volumes 3.0GB, build cache 1.0GB)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("panel missing %q:\n%s", want, got)
+		}
+	}
+	if bar := dm.statusBar(time.Now()); !strings.Contains(bar, "disk 95% full") {
+		t.Errorf("status bar doesn't warn about the full disk: %q", bar)
+	}
+
+	dm.resources.DiskUsed, dm.resources.DiskAvailable = 50e9, 50e9
+	if bar := dm.statusBar(time.Now()); strings.Contains(bar, "full") {
+		t.Errorf("status bar warns about a half empty disk: %q", bar)
+	}
+}
@@ -2,10 +2,12 @@ package pkg
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"log"
+	"io"
 	"os"
-	"sort"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -13,134 +15,400 @@ import (
 )
 
 type Screen interface {
-	Display()
+	Display(w io.Writer)
 	HandleInput(input string) bool
 	NeedsRefresh() bool
+	// Keys returns the commands the screen accepts, which also drive its footer and help
+	Keys() Keymap
+	// Close releases the screen's background work; DisplayManager calls it when leaving the screen
+	Close()
 }
 
 type LandingScreen struct {
 	display *DisplayManager
-	docker  *DockerClient
-	ticker  *time.Ticker
-	done    chan bool
+	docker  ContainerAPI
+	cancel  context.CancelFunc
 }
 
-func NewLandingScreen(display *DisplayManager, docker *DockerClient) *LandingScreen {
+func NewLandingScreen(display *DisplayManager, docker ContainerAPI) *LandingScreen {
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &LandingScreen{
 		display: display,
 		docker:  docker,
-		done:    make(chan bool),
+		cancel:  cancel,
+	}
+	if docker != nil {
+		go display.watchServices(ctx, display.Display)
 	}
-	s.startPolling()
 	return s
 }
 
-func (s *LandingScreen) startPolling() {
-	s.ticker = time.NewTicker(2 * time.Second)
-	go func() {
-		for {
-			select {
-			case <-s.ticker.C:
-				s.updateServices()
-			case <-s.done:
-				return
-			}
-		}
-	}()
+// Close stops watching for service updates
+func (s *LandingScreen) Close() {
+	s.cancel()
 }
 
-func (s *LandingScreen) stopPolling() {
-	if s.ticker != nil {
-		s.ticker.Stop()
-		s.done <- true
+func (s *LandingScreen) Display(w io.Writer) {
+	lines := &lineCounter{w: w}
+	w = lines
+
+	if s.docker == nil {
+		fmt.Fprintln(w, "Error: Docker client is not initialized")
+		return
+	}
+
+	server := s.display.config.GetCurrentServer()
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header(fmt.Sprintf("Connected to %s (%s@%s)", server.Name, server.User, server.Host)))
+
+	pinned, withPorts, withoutPorts, err := s.sections(server)
+	if err != nil {
+		fmt.Fprintf(w, "Error getting services: %v\n", err)
+		return
+	}
+	order := s.display.sortOrder()
+	if filters := s.docker.Filters(); len(filters) > 0 {
+		fmt.Fprintf(w, "Filtered by %s\n", FormatFilters(filters))
+	}
+	if s.docker.ReadOnly() {
+		fmt.Fprintln(w, s.display.colors.Warning("Read-only, another monitor forwards this server (press t to take over)"))
+	}
+	if s.display.config.Display.ShowHost {
+		s.display.renderResources(w)
+	}
+
+	var rowLines []int
+	cursor := s.display.Cursor()
+	if len(pinned) == 0 && len(withPorts) == 0 && len(withoutPorts) == 0 {
+		fmt.Fprintln(w, "No services found.")
+	} else {
+		fmt.Fprintf(w, "Sorted by %s %s\n", order, sortIndicator(s.display.sortAscending()))
+		if len(pinned) > 0 {
+			fmt.Fprintln(w, "Pinned")
+			rowLines = append(rowLines, rowRange(lines.lines+tableHeaderLines, len(pinned))...)
+			s.display.displayServicesTable(w, pinned, true, 0, cursor)
+			fmt.Fprintln(w)
+		}
+		if !s.display.config.Display.HideUnported {
+			s.display.displayServicesTable(w, withoutPorts, false, 0, -1)
+			fmt.Fprintln(w)
+		} else if len(withoutPorts) > 0 {
+			fmt.Fprintf(w, "%d without ports hidden, press h to show\n\n", len(withoutPorts))
+		}
+		rowLines = append(rowLines, rowRange(lines.lines+tableHeaderLines, len(withPorts))...)
+		s.display.displayServicesTable(w, withPorts, true, len(pinned), cursor)
 	}
+	s.display.setRowLines(rowLines)
+	// Numbers typed from now on refer to the rows exactly as drawn here
+	s.display.setRenderedRows(append(pinned, withPorts...))
+
+	s.display.renderActions(w, s.Keys())
 }
 
-func (s *LandingScreen) updateServices() {
-	if s.docker != nil {
-		services, err := s.docker.GetServices()
-		if err != nil {
-			log.Printf("Error fetching services: %v", err)
+// splitPinned separates the services named in pinned from the rest
+func splitPinned(services []*ServiceStatus, pinned []string) (matched, rest []*ServiceStatus) {
+	for _, service := range services {
+		if slices.Contains(pinned, service.Name) {
+			matched = append(matched, service)
 		} else {
-			s.docker.UpdateServices(services)
-			s.display.UpdateServices(services)
-			s.display.Display()
+			rest = append(rest, service)
 		}
 	}
+	return matched, rest
 }
 
-func (s *LandingScreen) Display() {
-	if s.docker == nil {
-		fmt.Println("Error: Docker client is not initialized")
-		return
+// missingServices returns placeholders for the pinned names not among services
+func missingServices(pinned []string, services []*ServiceStatus) []*ServiceStatus {
+	var missing []*ServiceStatus
+	for _, name := range pinned {
+		found := slices.ContainsFunc(services, func(service *ServiceStatus) bool {
+			return service.Name == name
+		})
+		if !found {
+			missing = append(missing, &ServiceStatus{Name: name, HealthStatus: HealthMissing})
+		}
 	}
+	return missing
+}
 
-	server := s.display.config.GetCurrentServer()
-	fmt.Printf("Connected to %s (%s@%s)\n\n", server.Name, server.User, server.Host)
+// sections splits the services into the overview's tables, each in the chosen sort order
+func (s *LandingScreen) sections(server *ServerConfig) (pinned, withPorts, withoutPorts []*ServiceStatus, err error) {
+	withPorts, withoutPorts, err = s.docker.GetServicesByPortStatus()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	pinnedNames := s.display.config.PinnedServices(server.Name)
+	pinned, withPorts = splitPinned(withPorts, pinnedNames)
+	pinnedWithoutPorts, withoutPorts := splitPinned(withoutPorts, pinnedNames)
+	pinned = append(pinned, pinnedWithoutPorts...)
+
+	order, asc := s.display.sortOrder(), s.display.sortAscending()
+	sortServices(pinned, order, asc)
+	sortServices(withPorts, order, asc)
+	sortServices(withoutPorts, order, asc)
+	// Pinned services that stopped stay listed so it's noticed
+	pinned = append(pinned, missingServices(pinnedNames, pinned)...)
+	return pinned, withPorts, withoutPorts, nil
+}
 
-	withPorts, withoutPorts, err := s.docker.GetServicesByPortStatus()
+// visibleServices returns the services the overview shows, in the order it shows them
+func (s *LandingScreen) visibleServices(server *ServerConfig) ([]*ServiceStatus, error) {
+	pinned, withPorts, withoutPorts, err := s.sections(server)
 	if err != nil {
-		fmt.Printf("Error getting services: %v\n", err)
+		return nil, err
+	}
+	services := pinned
+	if !s.display.config.Display.HideUnported {
+		services = append(services, withoutPorts...)
+	}
+	return append(services, withPorts...), nil
+}
+
+// export writes the services shown to path, reporting the outcome in the message area
+func (s *LandingScreen) export(path string) {
+	server := s.display.config.GetCurrentServer()
+	if server == nil || s.docker == nil {
+		logError("Failed to export services: not connected")
+		return
+	}
+	services, err := s.visibleServices(server)
+	if err != nil {
+		logError("Failed to export services: %v", err)
 		return
 	}
 
-	// Sort services alphabetically
-	sort.Slice(withPorts, func(i, j int) bool {
-		return withPorts[i].Name < withPorts[j].Name
-	})
-	sort.Slice(withoutPorts, func(i, j int) bool {
-		return withoutPorts[i].Name < withoutPorts[j].Name
+	report := ServerReport{Name: server.Name, Host: server.Host, User: server.User, Services: []ServiceReport{}}
+	if client := s.docker.GetClient(); client != nil {
+		report.Connected = client.Connected()
+	}
+	s.docker.ViewServices(func(map[string]*ServiceStatus) {
+		for _, service := range services {
+			report.Services = append(report.Services, serviceReport(service))
+		}
 	})
 
-	if len(withPorts) == 0 && len(withoutPorts) == 0 {
-		fmt.Println("No services found.")
+	path = expandHome(path)
+	if err := ExportServices(path, report); err != nil {
+		logError("Failed to export services: %v", err)
+		return
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	logInfo("Exported %s to %s", plural(len(services), "service"), path)
+}
+
+// setFilters applies the filter expressions and fetches the matching services
+func (s *LandingScreen) setFilters(exprs []string) {
+	filters, err := ParseFilters(exprs)
+	if err != nil {
+		logError("%v", err)
+		return
+	}
+	s.display.SetFilters(filters)
+	s.display.refreshServices()
+}
+
+// togglePin pins or unpins the service named on the current server and saves the choice
+func (d *DisplayManager) togglePin(name string) {
+	server := d.config.GetCurrentServer()
+	if server == nil {
+		return
+	}
+	if d.config.TogglePin(server.Name, name) {
+		d.Flash(fmt.Sprintf("Pinned %s", name))
 	} else {
-		s.display.displayServicesTable(withoutPorts, false)
-		fmt.Println()
-		s.display.displayServicesTable(withPorts, true)
+		d.Flash(fmt.Sprintf("Unpinned %s", name))
 	}
+	if err := d.config.Save(); err != nil {
+		logError("Failed to save pinned services: %v", err)
+	}
+}
 
-	fmt.Println("\nAvailable Actions:")
-	fmt.Println("Enter service number to view details and manage conflicts")
-	fmt.Println("[b]ack - Return to server list")
-	fmt.Println("Press Ctrl+C to exit")
+// pinned reports whether the service named is pinned on the current server
+func (d *DisplayManager) pinned(name string) bool {
+	server := d.config.GetCurrentServer()
+	return server != nil && slices.Contains(d.config.PinnedServices(server.Name), name)
 }
 
-func (s *LandingScreen) HandleInput(input string) bool {
-	if input == "b" || input == "back" {
-		s.stopPolling()
-		s.display.SetMode(ModeServerList)
-		return true
-	} else if idx := parseIndex(input); idx >= 0 && idx < len(s.display.currentServices) {
-		s.stopPolling()
-		s.display.selectedService = s.display.currentServices[idx]
-		s.display.selectedIndex = idx
-		s.display.SetMode(ModeServiceDetail)
-		return true
+// hasConflicts reports whether any forwarded port is held by another local process
+func (s *LandingScreen) hasConflicts() bool {
+	if s.docker == nil {
+		return false
+	}
+	conflicted := false
+	s.docker.ViewServices(func(services map[string]*ServiceStatus) {
+		for _, service := range services {
+			if len(service.ConflictPorts()) > 0 {
+				conflicted = true
+				return
+			}
+		}
+	})
+	return conflicted
+}
+
+// Keys returns the commands available on the services overview
+func (s *LandingScreen) Keys() Keymap {
+	return Keymap{
+		{Keys: []string{"#"}, Description: "View service details and manage conflicts", Action: func(args []string) bool {
+			idx := parseIndex(args[0])
+			service := s.display.renderedService(idx)
+			if service == nil {
+				return false
+			}
+			s.display.selectService(service, idx)
+			s.display.SetMode(ModeServiceDetail)
+			return true
+		}},
+		{Keys: []string{"p", "pin", "# pin"}, Label: "[p]in", Description: "Pin or unpin the highlighted service at the top (e.g., '2 pin', or 'pin web' by name)", Action: func(args []string) bool {
+			name := ""
+			switch {
+			case len(args) > 1 && args[1] == "pin":
+				name = s.display.renderedName(parseIndex(args[0]))
+			case len(args) > 1:
+				name = args[1]
+			default:
+				name = s.display.renderedName(s.display.Cursor())
+			}
+			if name == "" {
+				return false
+			}
+			s.display.togglePin(name)
+			return true
+		}},
+		{Keys: []string{"c", "conflicts"}, Label: "[c]onflicts", Description: "Resolve every port conflict in one pass", Hidden: !s.hasConflicts(), Action: func([]string) bool {
+			s.display.SetMode(ModeResolve)
+			return true
+		}},
+		{Keys: []string{"x", "export"}, Label: "e[x]port", Description: "Save the services shown to a CSV file, or JSON for a .json path (e.g., 'export report.json')", Action: func(args []string) bool {
+			if len(args) > 1 {
+				s.export(args[1])
+				return true
+			}
+			defer s.display.suspendInput()()
+			def := fmt.Sprintf("dockforward-%s-%s.csv", s.display.config.CurrentServer, time.Now().Format("2006-01-02"))
+			path, err := readInput(bufio.NewReader(os.Stdin), fmt.Sprintf("\nExport to (default: %s): ", def), false, def)
+			if err != nil {
+				logError("Failed to read export path: %v", err)
+				return true
+			}
+			s.export(path)
+			return true
+		}},
+		{Keys: []string{"f", "filter"}, Label: "[f]ilter", Description: "Only show containers matching Docker filters, or all of them if left empty (e.g., 'filter label=com.docker.compose.project=myapp')", Action: func(args []string) bool {
+			exprs := args[1:]
+			if len(args) == 1 {
+				restore := s.display.suspendInput()
+				line, err := readInput(bufio.NewReader(os.Stdin), fmt.Sprintf("\nFilter (current: %s, empty to show all): ", FormatFilters(s.docker.Filters())), false, "")
+				restore()
+				if err != nil {
+					logError("Failed to read filter: %v", err)
+					return true
+				}
+				exprs = strings.Fields(line)
+			}
+			s.setFilters(exprs)
+			return true
+		}},
+		{Keys: []string{"N", "networks"}, Label: "[N]etworks", Description: "List the host's networks and the containers attached to each", Action: func([]string) bool {
+			s.display.SetMode(ModeNetworkList)
+			return true
+		}},
+		{Keys: []string{"F", "forwards"}, Label: "[F]orwards", Description: "List every forward with its local address, state and uptime, and stop or restart them", Action: func([]string) bool {
+			s.display.SetMode(ModeForwards)
+			return true
+		}},
+		{Keys: []string{"v", "volumes"}, Label: "[v]olumes", Description: "List the host's volumes, and delete or prune unused ones", Action: func([]string) bool {
+			s.display.SetMode(ModeVolumeList)
+			return true
+		}},
+		{Keys: []string{"X", "extensions"}, Label: "e[X]tensions", Description: "Open a screen added by a plugin", Hidden: len(s.display.plugins) == 0, Action: func([]string) bool {
+			s.display.SetMode(ModeExtensions)
+			return true
+		}},
+		{Keys: []string{"t", "takeover"}, Label: "[t]akeover", Description: "Take over forwarding from the monitor holding this server", Hidden: s.docker == nil || !s.docker.ReadOnly(), Action: func([]string) bool {
+			s.display.confirm("Take over forwarding from the other monitor?", func() error {
+				s.display.takeOverServer()
+				return nil
+			})
+			return true
+		}},
+		{Keys: []string{"r", "refresh"}, Label: "[r]efresh", Description: "Refresh services now", Action: func([]string) bool {
+			s.display.refreshServices()
+			return true
+		}},
+		{Keys: []string{"s", "sort"}, Label: "[s]ort", Description: "Cycle sort order (name, health, forward status, port count, uptime)", Action: func([]string) bool {
+			if err := s.display.cycleSortOrder(); err != nil {
+				logError("Failed to save sort order: %v", err)
+			}
+			return true
+		}},
+		{Keys: []string{"S", "switch"}, Label: "[S]witch", Description: "Switch the sort direction between ascending and descending", Action: func([]string) bool {
+			if err := s.display.reverseSortOrder(); err != nil {
+				logError("Failed to save sort order: %v", err)
+			}
+			return true
+		}},
+		{Keys: []string{"h", "hide"}, Label: "[h]ide", Description: "Hide or show services without ports", Action: func([]string) bool {
+			s.display.config.Display.HideUnported = !s.display.config.Display.HideUnported
+			if err := s.display.config.Save(); err != nil {
+				logError("Failed to save display preferences: %v", err)
+			}
+			return true
+		}},
+		{Keys: []string{"H", "host"}, Label: "[H]ost", Description: "Show or hide the host's disk, memory and load", Action: func([]string) bool {
+			s.display.config.Display.ShowHost = !s.display.config.Display.ShowHost
+			if err := s.display.config.Save(); err != nil {
+				logError("Failed to save display preferences: %v", err)
+			}
+			return true
+		}},
+		{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to server list", Action: func([]string) bool {
+			s.display.SetMode(ModeServerList)
+			return true
+		}},
 	}
-	return false
+}
+
+func (s *LandingScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
 }
 
 func (s *LandingScreen) NeedsRefresh() bool {
 	return false
 }
 
+func (s *LandingScreen) RowCount() int {
+	return s.display.renderedRowCount()
+}
+
 type ServerListScreen struct {
 	display *DisplayManager
 }
 
 func NewServerListScreen(display *DisplayManager) *ServerListScreen {
-	return &ServerListScreen{
+	s := &ServerListScreen{
 		display: display,
 	}
+	s.checkReachability(false)
+	return s
+}
+
+// checkReachability probes the servers in the background, redrawing as each result arrives.
+// Unless force is set, results from the last reachabilityTTL are reused.
+func (s *ServerListScreen) checkReachability(force bool) {
+	s.display.reachability.Check(s.display.config.Servers, force, s.display.Display)
 }
 
-func (s *ServerListScreen) Display() {
-	fmt.Println("Docker Remote Servers")
-	fmt.Println()
+func (s *ServerListScreen) Display(w io.Writer) {
+	fmt.Fprintln(w, s.display.colors.Header("Docker Remote Servers"))
+	fmt.Fprintln(w)
+	s.display.setRowLines(rowRange(2+tableHeaderLines, len(s.display.config.Servers)))
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"#", "Name", "Host", "User", "Status"})
+	table := tablewriter.NewWriter(w)
+	headers := []string{"#", "Name", "Host", "User", "Reachability", "Status"}
+	table.SetHeader(headers)
 	table.SetAutoWrapText(false)
 	table.SetAutoFormatHeaders(true)
 	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
@@ -151,162 +419,163 @@ func (s *ServerListScreen) Display() {
 	table.SetHeaderLine(true)
 	table.SetBorder(true)
 
+	var rows [][]string
 	for i, server := range s.display.config.Servers {
 		status := []string{}
 		if server.Name == s.display.config.CurrentServer {
-			status = append(status, ColorGreen+"Current"+ColorReset)
+			status = append(status, s.display.colors.Healthy("Current"))
 		}
 		if server.Name == s.display.config.DefaultServer {
-			status = append(status, ColorYellow+"Default"+ColorReset)
+			status = append(status, s.display.colors.Warning("Default"))
 		}
 		statusStr := strings.Join(status, ", ")
 		if statusStr == "" {
 			statusStr = "-"
 		}
 
-		table.Append([]string{
-			fmt.Sprintf("%d", i),
-			server.Name,
+		selected := i == s.display.Cursor()
+		rows = append(rows, []string{
+			s.display.highlight(fmt.Sprintf("%d", i), selected),
+			s.display.highlight(server.Name, selected),
 			server.Host,
 			server.User,
+			s.display.colorizeReachability(s.display.reachability.State(server.Host)),
 			statusStr,
 		})
 	}
+	s.display.appendFitted(table, headers, rows, []int{priorityHigh, priorityHigh, priorityMedium, priorityLow, priorityMedium, priorityMedium})
 
 	table.Render()
 
-	fmt.Println("\nAvailable Actions:")
-	fmt.Printf("Enter server number to connect (current: %s)\n", s.display.config.CurrentServer)
-	fmt.Println("[a]dd     - Add a new server")
-	fmt.Println("[r]emove  - Remove a server")
-	fmt.Println("[d]efault - Set default server")
-	fmt.Println("Press Ctrl+C to exit")
+	s.display.renderActions(w, s.Keys())
 }
 
-func (s *ServerListScreen) HandleInput(input string) bool {
-	switch input {
-	case "a":
-		if err := s.display.handleAddServer(); err != nil {
-			fmt.Printf("Failed to add server: %v\n", err)
-			fmt.Println("Press Enter to continue...")
-			bufio.NewReader(os.Stdin).ReadBytes('\n')
-		}
-		return true
-	case "r":
-		if err := s.display.handleRemoveServer(); err != nil {
-			fmt.Printf("Failed to remove server: %v\n", err)
-			fmt.Println("Press Enter to continue...")
-			bufio.NewReader(os.Stdin).ReadBytes('\n')
-		}
-		return true
-	case "d":
-		if err := s.display.handleSetDefaultServer(); err != nil {
-			fmt.Printf("Failed to set default server: %v\n", err)
-			fmt.Println("Press Enter to continue...")
-			bufio.NewReader(os.Stdin).ReadBytes('\n')
-		}
-		return true
-	default:
-		if idx, err := strconv.Atoi(input); err == nil && idx >= 0 && idx < len(s.display.config.Servers) {
-			server := &s.display.config.Servers[idx]
-			if err := s.display.config.SetCurrentServer(server.Name); err != nil {
-				fmt.Printf("Failed to set current server: %v\n", err)
-				fmt.Println("Press Enter to continue...")
-				bufio.NewReader(os.Stdin).ReadBytes('\n')
-				return true
+// Keys returns the commands available on the server list
+func (s *ServerListScreen) Keys() Keymap {
+	return Keymap{
+		{Keys: []string{"#"}, Description: fmt.Sprintf("Connect to server by number (current: %s)", s.display.config.CurrentServer), Action: func(args []string) bool {
+			idx, _ := strconv.Atoi(args[0])
+			if idx >= len(s.display.config.Servers) {
+				return false
 			}
-			sshClient, err := NewSSHClient(server.User, server.Host, server.KeyPath)
-			if err != nil {
-				fmt.Printf("Error creating SSH client: %v\n", err)
-				fmt.Println("Press Enter to continue...")
-				bufio.NewReader(os.Stdin).ReadBytes('\n')
-				return true
-			}
-			dockerClient, err := NewDockerClient(sshClient)
-			if err != nil {
-				fmt.Printf("Error creating Docker client: %v\n", err)
-				sshClient.Close()
-				fmt.Println("Press Enter to continue...")
-				bufio.NewReader(os.Stdin).ReadBytes('\n')
-				return true
-			}
-			dockerClient.Start()
-			s.display.SetDockerClient(dockerClient)
-			s.display.SetMode(ModeOverview)
+			return s.prompt(func() error { return s.connect(idx) }, "Failed to connect")
+		}},
+		{Keys: []string{"a", "add"}, Label: "[a]dd", Description: "Add a new server", Action: func([]string) bool {
+			return s.prompt(s.display.handleAddServer, "Failed to add server")
+		}},
+		{Keys: []string{"r", "remove"}, Label: "[r]emove", Description: "Remove a server", Action: func([]string) bool {
+			return s.prompt(s.display.handleRemoveServer, "Failed to remove server")
+		}},
+		{Keys: []string{"d", "default"}, Label: "[d]efault", Description: "Set default server", Action: func([]string) bool {
+			return s.prompt(s.display.handleSetDefaultServer, "Failed to set default server")
+		}},
+		{Keys: []string{"c", "check"}, Label: "[c]heck", Description: "Check which servers are reachable", Action: func([]string) bool {
+			s.checkReachability(true)
 			return true
+		}},
+	}
+}
+
+func (s *ServerListScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+// prompt runs an action that reads whole lines, which raw mode doesn't provide,
+// pausing on failure so the error can be read before the screen redraws
+func (s *ServerListScreen) prompt(action func() error, failure string) bool {
+	defer s.display.suspendInput()()
+
+	if err := action(); err != nil {
+		fmt.Printf("%s: %v\n", failure, err)
+		if hint := ErrorHint(err); hint != "" {
+			fmt.Println(hint)
 		}
+		fmt.Println("Press Enter to continue...")
+		bufio.NewReader(os.Stdin).ReadBytes('\n')
 	}
-	return false
+	return true
+}
+
+// connect makes the server at idx current and switches to its services
+func (s *ServerListScreen) connect(idx int) error {
+	server := &s.display.config.Servers[idx]
+	// Under the display's lock, since API servers read the current server from other goroutines
+	s.display.mu.Lock()
+	err := s.display.config.SetCurrentServer(server.Name)
+	s.display.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to set current server: %v", err)
+	}
+	dockerClient, err := Connect(server)
+	if err != nil {
+		return err
+	}
+	s.display.SetDockerClient(dockerClient)
+	s.display.SetMode(ModeOverview)
+	return nil
 }
 
 func (s *ServerListScreen) NeedsRefresh() bool {
 	return false
 }
 
+// Close is a no-op, the server list has no background work
+func (s *ServerListScreen) Close() {}
+
+func (s *ServerListScreen) RowCount() int {
+	return len(s.display.config.Servers)
+}
+
 type ServiceDetailScreen struct {
-	display *DisplayManager
-	docker  *DockerClient
-	ticker  *time.Ticker
-	done    chan bool
+	display  *DisplayManager
+	docker   ContainerAPI
+	cancel   context.CancelFunc
+	expanded bool // Whether process details stay multi-line on a narrow terminal
 }
 
-func NewServiceDetailScreen(display *DisplayManager, docker *DockerClient) *ServiceDetailScreen {
+func NewServiceDetailScreen(display *DisplayManager, docker ContainerAPI) *ServiceDetailScreen {
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &ServiceDetailScreen{
 		display: display,
 		docker:  docker,
-		done:    make(chan bool),
+		cancel:  cancel,
 	}
-	s.startPolling()
+	go display.watchServices(ctx, s.updateService)
 	return s
 }
 
-func (s *ServiceDetailScreen) startPolling() {
-	s.ticker = time.NewTicker(2 * time.Second)
-	go func() {
-		for {
-			select {
-			case <-s.ticker.C:
-				s.updateService()
-			case <-s.done:
-				return
-			}
-		}
-	}()
-}
-
-func (s *ServiceDetailScreen) stopPolling() {
-	if s.ticker != nil {
-		s.ticker.Stop()
-		s.done <- true
-	}
+// Close stops watching for updates to the selected service
+func (s *ServiceDetailScreen) Close() {
+	s.cancel()
 }
 
 func (s *ServiceDetailScreen) updateService() {
-	if s.docker != nil && s.display.selectedService != nil {
-		services, err := s.docker.GetServices()
-		if err != nil {
-			log.Printf("Error fetching services: %v", err)
-		} else {
-			for _, service := range services {
-				if service.Name == s.display.selectedService.Name {
-					s.display.selectedService = service
-					s.display.Display()
-					break
-				}
-			}
+	selected := s.display.SelectedService()
+	if s.docker != nil && selected != nil {
+		if service := s.docker.GetService(selected.Name); service != nil {
+			s.display.mu.Lock()
+			s.display.selectedService = service
+			s.display.mu.Unlock()
 		}
+		s.display.Display()
 	}
 }
 
-func (s *ServiceDetailScreen) Display() {
-	if s.display.selectedService == nil {
+func (s *ServiceDetailScreen) Display(w io.Writer) {
+	service := s.display.SelectedService()
+	if service == nil {
 		return
 	}
+	service = s.display.snapshot(service)[0]
 
-	fmt.Printf("Service Detail: %s\n\n", s.display.selectedService.Name)
+	title := "Service Detail: " + service.Name
+	if s.display.pinned(service.Name) {
+		title = "Service Detail: " + pinMark + service.Name
+	}
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header(title))
 
 	// Service info table
-	infoTable := tablewriter.NewWriter(os.Stdout)
+	infoTable := tablewriter.NewWriter(w)
 	infoTable.SetHeader([]string{"Property", "Value"})
 	infoTable.SetAutoWrapText(false)
 	infoTable.SetAutoFormatHeaders(true)
@@ -318,16 +587,35 @@ func (s *ServiceDetailScreen) Display() {
 	infoTable.SetHeaderLine(true)
 	infoTable.SetBorder(true)
 
-	infoTable.Append([]string{"Name", s.display.selectedService.Name})
-	infoTable.Append([]string{"Health Status", s.display.colorizeHealth(s.display.selectedService.HealthStatus)})
-	infoTable.Append([]string{"Forward Status", s.display.colorizeStatus(s.display.selectedService.ForwardStatus)})
+	info := [][]string{
+		{"Name", service.Name},
+		{"Health Status", s.display.colorizeHealth(service.HealthStatus)},
+		{"Forward Status", s.display.colorizeStatus(service.ForwardStatus)},
+	}
+	if service.ComposeService != "" {
+		info = append(info, []string{"Compose Service", fmt.Sprintf("%s (project %s)", service.ComposeService, service.Project)})
+	}
+	if service.Replicas != "" {
+		info = append(info, []string{"Replicas", service.Replicas})
+	}
+	if s.docker != nil {
+		if client, ok := s.docker.GetClient().(*SSHClient); ok {
+			info = append(info,
+				[]string{"Server", fmt.Sprintf("%s (%s)", s.display.config.CurrentServer, client.Target())},
+				[]string{"SSH Reconnects", strconv.Itoa(client.Reconnects())},
+			)
+		}
+	}
+	s.display.appendFitted(infoTable, []string{"Property", "Value"}, info, []int{priorityHigh, priorityLow})
 	infoTable.Render()
-	fmt.Println()
+	fmt.Fprintln(w)
 
 	// Ports table
-	portsTable := tablewriter.NewWriter(os.Stdout)
-	portsTable.SetHeader([]string{"#", "Remote Port", "Local Port", "Status", "Local Process"})
-	portsTable.SetAutoWrapText(true)
+	portsTable := tablewriter.NewWriter(w)
+	headers := []string{"#", "Remote Port", "Protocol", "Local Port", "Status", "Local Process"}
+	portsTable.SetHeader(headers)
+	// Wrapping measures escape codes as visible text, so rely on explicit newlines instead
+	portsTable.SetAutoWrapText(false)
 	portsTable.SetAutoFormatHeaders(true)
 	portsTable.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
 	portsTable.SetAlignment(tablewriter.ALIGN_LEFT)
@@ -337,14 +625,25 @@ func (s *ServiceDetailScreen) Display() {
 	portsTable.SetHeaderLine(true)
 	portsTable.SetBorder(true)
 
-	for i, port := range s.display.selectedService.ExposedPorts {
-		status := ColorGreen + "Ready" + ColorReset
-		localPort := s.docker.GetPortMapping(s.display.selectedService.Name, port)
+	cursor := s.display.Cursor()
+	collapsed := s.display.narrow() && !s.expanded
+	var rows [][]string
+	for i, port := range service.ForwardedPorts {
+		status := s.display.colorizeStatus(port.Status)
 		processInfo := "None"
 
-		if isConflict := contains(s.display.selectedService.Conflicts, port); isConflict {
-			status = ColorRed + "Conflict" + ColorReset
-			if info := s.docker.GetLocalProcessForPort(port); info != nil {
+		switch port.Status {
+		case StatusUnsupported:
+			processInfo = "UDP can't be forwarded over SSH"
+		case StatusError:
+			processInfo = port.Error
+			if collapsed {
+				processInfo = truncateString(port.Error, 50)
+			}
+		case StatusConflict:
+			if info := port.ConflictInfo; info != nil && collapsed {
+				processInfo = describeProcess(info)
+			} else if info != nil {
 				processInfo = fmt.Sprintf("%s\nPID: %s\nUser: %s\nCmd: %s", 
 					info.Name, 
 					info.PID,
@@ -352,64 +651,263 @@ func (s *ServiceDetailScreen) Display() {
 					truncateString(info.Command, 50),
 				)
 			}
-		} else if s.display.selectedService.ForwardStatus == StatusForwarded {
-			status = ColorGreen + "Forwarded" + ColorReset
 		}
 
-		portsTable.Append([]string{
-			fmt.Sprintf("%d", i),
-			port,
-			localPort,
+		rows = append(rows, []string{
+			s.display.highlight(fmt.Sprintf("%d", i), i == cursor),
+			s.display.highlight(port.Remote, i == cursor),
+			port.Protocol,
+			port.Local,
 			status,
 			processInfo,
 		})
 	}
+	s.display.appendFitted(portsTable, headers, rows, []int{priorityHigh, priorityHigh, priorityMedium, priorityHigh, priorityMedium, priorityLow})
 
 	portsTable.Render()
 
-	fmt.Println("\nAvailable Actions:")
-	fmt.Println("[b]ack     - Return to overview")
-	fmt.Println("[#] remap  - Remap port by number (e.g., '0 8081' to change port 0's local port to 8081)")
-	if len(s.display.selectedService.Conflicts) > 0 {
-		fmt.Println("[#] kill   - Kill process using port by number (e.g., '0 kill')")
+	// Links stay out of the table, which would count their escape codes as width
+	fmt.Fprintln(w, "\nLocal Addresses:")
+	for i, port := range service.ForwardedPorts {
+		if port.Status == StatusUnsupported {
+			continue
+		}
+		addr := port.LocalAddress()
+		if port.Scheme() != "" {
+			addr = s.display.colors.Hyperlink(addr, addr)
+		}
+		fmt.Fprintf(w, "[%d] %s\n", i, addr)
 	}
+
+	s.display.renderActions(w, s.Keys())
 }
 
-func (s *ServiceDetailScreen) HandleInput(input string) bool {
-	if input == "b" || input == "back" {
-		s.stopPolling()
-		s.display.SetMode(ModeOverview)
-		s.display.selectedService = nil
-		s.display.selectedIndex = -1
-		return true
+// Keys returns the commands available on the service detail screen
+func (s *ServiceDetailScreen) Keys() Keymap {
+	conflicts := false
+	if service := s.display.SelectedService(); service != nil {
+		conflicts = len(s.display.snapshot(service)[0].ConflictPorts()) > 0
 	}
 
-	parts := strings.Fields(input)
-	if len(parts) < 2 {
-		return false
+	return Keymap{
+		{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to overview", Action: func([]string) bool {
+			s.display.SetMode(ModeOverview)
+			s.display.selectService(nil, -1)
+			return true
+		}},
+		{Keys: []string{"p", "pin"}, Label: "[p]in", Description: "Pin or unpin this service at the top of the overview", Action: func([]string) bool {
+			if service := s.display.SelectedService(); service != nil {
+				s.display.togglePin(service.Name)
+			}
+			return true
+		}},
+		{Keys: []string{"e", "expand"}, Label: "[e]xpand", Description: "Show or collapse full process details, which are one line on narrow terminals", Hidden: !conflicts || !s.display.narrow(), Action: func([]string) bool {
+			s.expanded = !s.expanded
+			return true
+		}},
+		{Keys: []string{"# remap"}, Label: "[#] remap", Description: "Remap port by number (e.g., '0 remap 8081' to change port 0's local port to 8081)", Action: func(args []string) bool {
+			port := s.portAt(args[0])
+			if port == "" || len(args) != 3 {
+				return false
+			}
+			s.display.confirmRemapPort(port, args[2])
+			return true
+		}},
+		{Keys: []string{"u", "undo"}, Label: "[u]ndo", Description: "Undo the last remap", Hidden: !s.display.canUndo(), Action: func([]string) bool {
+			if err := s.display.undoLastRemap(); err != nil {
+				logError("%v", err)
+			}
+			return true
+		}},
+		{Keys: []string{"U", "redo"}, Label: "[U] redo", Description: "Redo the last undone remap (or press Ctrl+R)", Hidden: !s.display.canRedo(), Action: func([]string) bool {
+			if err := s.display.redoLastRemap(); err != nil {
+				logError("%v", err)
+			}
+			return true
+		}},
+		{Keys: []string{"c", "# copy"}, Label: "[c]opy", Description: "Copy the highlighted port's local URL, or localhost:port for non-HTTP ports (e.g., '1 copy' for port 1)", Action: func(args []string) bool {
+			port := s.portFor(args)
+			if port == nil {
+				return false
+			}
+			s.display.copyLocalAddress(port)
+			return true
+		}},
+		{Keys: []string{"o", "# open"}, Label: "[o]pen", Description: "Open the highlighted port's local URL in the browser (e.g., '1 open' for port 1)", Action: func(args []string) bool {
+			port := s.portFor(args)
+			if port == nil {
+				return false
+			}
+			s.display.openLocalURL(port)
+			return true
+		}},
+		{Keys: []string{"# kill"}, Label: "[#] kill", Description: "Kill process using port by number (e.g., '0 kill')", Hidden: !conflicts, Action: func(args []string) bool {
+			port := s.portAt(args[0])
+			if port == "" {
+				return false
+			}
+			s.display.confirmKillProcess(port)
+			return true
+		}},
 	}
+}
 
-	portIdx, err := strconv.Atoi(parts[0])
-	if err != nil || portIdx < 0 || portIdx >= len(s.display.selectedService.ExposedPorts) {
-		return false
+// portFor returns the port a command refers to: the row number before it if there is one,
+// otherwise the highlighted row, or the first port outside raw input mode
+func (s *ServiceDetailScreen) portFor(args []string) *ForwardedPort {
+	service := s.display.SelectedService()
+	if service == nil {
+		return nil
+	}
+	row := s.display.Cursor()
+	if idx, err := strconv.Atoi(args[0]); err == nil {
+		row = idx
+	} else if row < 0 {
+		row = 0
+	}
+	if row < 0 || row >= len(service.ForwardedPorts) {
+		return nil
+	}
+	return &service.ForwardedPorts[row]
+}
+
+// portAt returns the remote port at the given row of the ports table, or "" if there's none
+func (s *ServiceDetailScreen) portAt(row string) string {
+	service := s.display.SelectedService()
+	if service == nil {
+		return ""
+	}
+	idx, err := strconv.Atoi(row)
+	if err != nil || idx < 0 || idx >= len(service.ForwardedPorts) {
+		return ""
+	}
+	return service.ForwardedPorts[idx].Remote
+}
+
+func (s *ServiceDetailScreen) RowCount() int {
+	if service := s.display.SelectedService(); service != nil {
+		return len(service.ForwardedPorts)
+	}
+	return 0
+}
+
+func (s *ServiceDetailScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *ServiceDetailScreen) NeedsRefresh() bool {
+	return false
+}
+
+// HelpScreen lists every key available on the screen it was opened from
+type HelpScreen struct {
+	display  *DisplayManager
+	previous DisplayMode
+	keys     Keymap
+}
+
+func NewHelpScreen(display *DisplayManager, previous DisplayMode, keys Keymap) *HelpScreen {
+	return &HelpScreen{
+		display:  display,
+		previous: previous,
+		keys:     keys,
+	}
+}
+
+func (s *HelpScreen) Display(w io.Writer) {
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header("Keyboard Shortcuts: "+modeNames[s.previous]))
+
+	fmt.Fprintln(w, "Screen:")
+	s.keys.RenderAll(w)
+
+	fmt.Fprintln(w, "\nEverywhere:")
+	s.display.globalKeys().RenderAll(w)
+
+	if s.display.input.Raw() {
+		fmt.Fprintln(w, "\nNavigation:")
+		s.display.navigationKeys().RenderAll(w)
 	}
 
-	port := s.display.selectedService.ExposedPorts[portIdx]
-	cmd := parts[1]
+	fmt.Fprintln(w, "\nAvailable Actions:")
+	s.Keys().Render(w)
+}
 
-	switch cmd {
-	case "kill":
-		s.display.handleKillProcess(port)
-		return true
-	case "remap":
-		if len(parts) == 3 {
-			s.display.handleRemapPort(port, parts[2])
+// Keys returns the commands available on the help screen
+func (s *HelpScreen) Keys() Keymap {
+	return Keymap{
+		{Keys: []string{"b", "back", "?"}, Label: "[b]ack", Description: "Close help", Action: func([]string) bool {
+			s.display.SetMode(s.previous)
 			return true
-		}
+		}},
 	}
+}
+
+func (s *HelpScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *HelpScreen) NeedsRefresh() bool {
 	return false
 }
 
-func (s *ServiceDetailScreen) NeedsRefresh() bool {
+// Close is a no-op, the help screen has no background work
+func (s *HelpScreen) Close() {}
+
+// ConfirmScreen is a yes/no dialog pushed over another screen before a destructive action.
+// Anything but an explicit yes cancels, and answering pops it to reveal the screen beneath.
+type ConfirmScreen struct {
+	display  *DisplayManager
+	question string
+	action   func() error
+}
+
+func NewConfirmScreen(display *DisplayManager, question string, action func() error) *ConfirmScreen {
+	return &ConfirmScreen{
+		display:  display,
+		question: question,
+		action:   action,
+	}
+}
+
+func (s *ConfirmScreen) Display(w io.Writer) {
+	fmt.Fprintf(w, "\n%s\n", s.display.colors.Warning(s.question+" Are you sure? [y/N]"))
+}
+
+// Keys returns the answers the dialog accepts
+func (s *ConfirmScreen) Keys() Keymap {
+	return Keymap{
+		{Keys: []string{"y", "yes"}, Label: "[y]es", Description: "Go ahead", Action: func([]string) bool {
+			s.display.PopScreen(s)
+			if err := s.action(); err != nil {
+				logError("%v", err)
+				if hint := ErrorHint(err); hint != "" {
+					logInfo("%s", hint)
+				}
+			}
+			return true
+		}},
+		{Keys: []string{"n", "no"}, Label: "[n]o", Description: "Cancel (default)", Action: func([]string) bool {
+			s.cancel()
+			return true
+		}},
+	}
+}
+
+func (s *ConfirmScreen) HandleInput(input string) bool {
+	if !s.Keys().Dispatch(input) {
+		s.cancel()
+	}
+	return true
+}
+
+func (s *ConfirmScreen) cancel() {
+	s.display.PopScreen(s)
+	s.display.Flash("Cancelled")
+}
+
+func (s *ConfirmScreen) NeedsRefresh() bool {
 	return false
 }
+
+// Close is a no-op, the dialog has no background work
+func (s *ConfirmScreen) Close() {}
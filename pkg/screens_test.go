@@ -0,0 +1,699 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "regenerate golden files in testdata/")
+
+// ansiPattern matches the terminal escape sequences emitted by the screens
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// renderScreen returns what a screen writes when displayed
+func renderScreen(screen Screen) string {
+	var buf bytes.Buffer
+	screen.Display(&buf)
+	return buf.String()
+}
+
+// assertGolden compares output against testdata/<name>.golden, rewriting it with -update-golden
+func assertGolden(t *testing.T, name, output string) {
+	t.Helper()
+
+	output = ansiPattern.ReplaceAllString(output, "")
+	path := filepath.Join("testdata", name+".golden")
+
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatalf("failed to create testdata directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update-golden to create it): %v", err)
+	}
+	if string(want) != output {
+		t.Errorf("output does not match %s\n--- want ---\n%s\n--- got ---\n%s", path, want, output)
+	}
+}
+
+// fixtureConfig returns a config with two servers that is never saved to disk
+func fixtureConfig() *Config {
+	return &Config{
+		Servers: []ServerConfig{
+			{Name: "default", Host: "c1.local:22", User: "c1user", KeyPath: "~/.ssh/id_rsa"},
+			{Name: "staging", Host: "staging.example.com:2222", User: "deploy", KeyPath: "~/.ssh/deploy"},
+		},
+		DefaultServer: "default",
+		CurrentServer: "staging",
+	}
+}
+
+// fixtureDockerClient returns a DockerClient with canned services and no connection
+func fixtureDockerClient() *DockerClient {
+	return &DockerClient{
+		services: map[string]*ServiceStatus{
+			"web": {
+				Name: "web",
+				ForwardedPorts: []ForwardedPort{
+					{Remote: "3000", Local: "3000", Protocol: "tcp", Status: StatusReady},
+					{Remote: "8080", Local: "18080", Protocol: "tcp", Status: StatusReady},
+				},
+				HealthStatus:  HealthHealthy,
+				ForwardStatus: StatusReady,
+			},
+			"db": {
+				Name: "db",
+				ForwardedPorts: []ForwardedPort{
+					{Remote: "5432", Local: "5432", Protocol: "tcp", Status: StatusConflict, ConflictInfo: &ProcessInfo{Name: "postgres", PID: "812", User: "alice", Command: "postgres -D /usr/local/var/postgres"}},
+				},
+				HealthStatus:  HealthUnhealthy,
+				ForwardStatus: StatusConflict,
+			},
+			"worker": {
+				Name:          "worker",
+				HealthStatus:  HealthRunning,
+				ForwardStatus: StatusNotForwarded,
+			},
+		},
+		portMappings: map[string]map[string]string{
+			"web": {"8080": "18080"},
+		},
+	}
+}
+
+func TestServerListScreenGolden(t *testing.T) {
+	dm := &DisplayManager{config: fixtureConfig()}
+	screen := NewServerListScreen(dm)
+
+	assertGolden(t, "server_list", renderScreen(screen))
+}
+
+func TestLandingScreenGolden(t *testing.T) {
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker}
+	screen := &LandingScreen{display: dm, docker: docker}
+
+	assertGolden(t, "landing", renderScreen(screen))
+}
+
+func TestLandingScreenNoServicesGolden(t *testing.T) {
+	docker := &DockerClient{services: map[string]*ServiceStatus{}}
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker}
+	screen := &LandingScreen{display: dm, docker: docker}
+
+	assertGolden(t, "landing_empty", renderScreen(screen))
+}
+
+func TestLandingScreenFilteredGolden(t *testing.T) {
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig()}
+	dm.SetFilters(map[string][]string{"label": {"com.docker.compose.project=myapp"}})
+	// Filters set before connecting apply to the new connection
+	dm.SetDockerClient(docker)
+	t.Cleanup(dm.Shutdown)
+	screen := &LandingScreen{display: dm, docker: docker}
+
+	assertGolden(t, "landing_filtered", renderScreen(screen))
+}
+
+func TestServiceDetailScreenGolden(t *testing.T) {
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker}
+	dm.selectedService = docker.services["web"]
+	screen := &ServiceDetailScreen{display: dm, docker: docker}
+
+	assertGolden(t, "service_detail", renderScreen(screen))
+}
+
+func TestServiceDetailShowsEachPortsState(t *testing.T) {
+	docker := fixtureDockerClient()
+	web := docker.services["web"]
+	web.ForwardedPorts = append(web.ForwardedPorts, ForwardedPort{Remote: "9229", Local: "9229", Protocol: "tcp"})
+	web.Port("3000").Status = StatusForwarded
+	failed := web.Port("8080")
+	failed.Status, failed.Error = StatusError, "local port in use: bind [127.0.0.1]:18080: Address already in use"
+	web.Port("9229").Status = StatusNotForwarded
+	web.ForwardStatus = aggregateForwardStatus(web.ForwardedPorts)
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker}
+	dm.selectedService = web
+
+	// One port failing leaves the others showing their own state
+	output := renderScreen(&ServiceDetailScreen{display: dm, docker: docker})
+	for _, want := range []string{"Forwarded", "Error", "Address already in use", "Not forwarded"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("service detail doesn't show %q:\n%s", want, output)
+		}
+	}
+	if web.ForwardStatus != StatusError {
+		t.Errorf("service with a failed port is %q, want %q", web.ForwardStatus, StatusError)
+	}
+}
+
+func TestNarrowTerminalGolden(t *testing.T) {
+	docker := fixtureDockerClient()
+	docker.services["db"].Name = "db-primary-with-a-long-service-name"
+	docker.services["db-primary-with-a-long-service-name"] = docker.services["db"]
+	delete(docker.services, "db")
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, width: 60}
+
+	assertGolden(t, "landing_narrow", renderScreen(&LandingScreen{display: dm, docker: docker}))
+
+	dm.width = 80
+	dm.selectedService = docker.services["db-primary-with-a-long-service-name"]
+	detail := &ServiceDetailScreen{display: dm, docker: docker}
+	assertGolden(t, "service_detail_narrow", renderScreen(detail))
+
+	// Expanding brings back the multi-line process details
+	if !detail.HandleInput("e") {
+		t.Fatal("expand was rejected")
+	}
+	if output := renderScreen(detail); !strings.Contains(output, "PID: 812") {
+		t.Errorf("expanded detail doesn't show the process details:\n%s", output)
+	}
+}
+
+func TestScreensWithoutColor(t *testing.T) {
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, colors: NewColorizer(false)}
+	dm.selectedService = docker.services["web"]
+
+	screens := map[string]Screen{
+		"server list":    NewServerListScreen(dm),
+		"landing":        &LandingScreen{display: dm, docker: docker},
+		"service detail": &ServiceDetailScreen{display: dm, docker: docker},
+	}
+	for name, screen := range screens {
+		if output := renderScreen(screen); ansiPattern.MatchString(output) {
+			t.Errorf("%s screen emitted escape codes with color disabled:\n%q", name, output)
+		}
+	}
+}
+
+func TestLandingScreenSortedByHealthGolden(t *testing.T) {
+	docker := fixtureDockerClient()
+	config := fixtureConfig()
+	config.Display.SortOrder = string(SortByHealth)
+	dm := &DisplayManager{config: config, docker: docker}
+	screen := &LandingScreen{display: dm, docker: docker}
+
+	assertGolden(t, "landing_sorted_health", renderScreen(screen))
+}
+
+func TestComposeServiceNames(t *testing.T) {
+	services := []*ServiceStatus{
+		{Name: "shop-api-1", Project: "shop", ComposeService: "api"},
+		{Name: "shop-web-1", Project: "shop", ComposeService: "web"},
+		{Name: "shop-web-2", Project: "shop", ComposeService: "web"},
+		{Name: "blog-db-1", Project: "blog", ComposeService: "db"},
+		{Name: "db"},
+		{Name: "redis"},
+	}
+	want := []string{"api", "shop-web-1", "shop-web-2", "blog-db-1", "db", "redis"}
+	if got := displayNames(services); !reflect.DeepEqual(got, want) {
+		t.Errorf("displayNames = %q, want %q", got, want)
+	}
+
+	docker := fixtureDockerClient()
+	docker.services["web"].Name = "shop-web-1"
+	docker.services["web"].Project, docker.services["web"].ComposeService = "shop", "web"
+	docker.services["shop-web-1"] = docker.services["web"]
+	delete(docker.services, "web")
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker}
+	if output := renderScreen(&LandingScreen{display: dm, docker: docker}); strings.Contains(output, "shop-web-1") || !strings.Contains(output, "│ web ") {
+		t.Errorf("overview doesn't list shop-web-1 as web:\n%s", output)
+	}
+	dm.selectedService = docker.services["shop-web-1"]
+	if output := renderScreen(&ServiceDetailScreen{display: dm, docker: docker}); !strings.Contains(output, "Service Detail: shop-web-1") || !strings.Contains(output, "web (project shop)") {
+		t.Errorf("service detail doesn't show the container and Compose service names:\n%s", output)
+	}
+}
+
+func TestSortServices(t *testing.T) {
+	now := time.Now()
+	services := []*ServiceStatus{
+		{Name: "web", HealthStatus: HealthHealthy, ForwardStatus: StatusReady, Created: now.Add(-time.Hour),
+			ForwardedPorts: []ForwardedPort{{Remote: "80"}, {Remote: "443"}}},
+		{Name: "db", HealthStatus: HealthUnhealthy, ForwardStatus: StatusConflict, Created: now.Add(-2 * time.Hour),
+			ForwardedPorts: []ForwardedPort{{Remote: "5432"}}},
+		{Name: "api", HealthStatus: HealthHealthy, ForwardStatus: StatusReady, Created: now,
+			ForwardedPorts: []ForwardedPort{{Remote: "3000"}}},
+	}
+
+	tests := []struct {
+		order SortOrder
+		asc   bool
+		want  string
+	}{
+		{SortByName, true, "api db web"},
+		{SortByName, false, "web db api"},
+		{SortByHealth, true, "db api web"},
+		// Ties stay in name order either way
+		{SortByHealth, false, "api web db"},
+		{SortByPorts, true, "api db web"},
+		{SortByPorts, false, "web api db"},
+		{SortByUptime, true, "api web db"},
+		{SortByUptime, false, "db web api"},
+	}
+	for _, tt := range tests {
+		sortServices(services, tt.order, tt.asc)
+		var names []string
+		for _, service := range services {
+			names = append(names, service.Name)
+		}
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("sorted by %s ascending %v = %s, want %s", tt.order, tt.asc, got, tt.want)
+		}
+	}
+}
+
+func TestLandingScreenReversed(t *testing.T) {
+	docker := fixtureDockerClient()
+	config := fixtureConfig()
+	config.Display.SortDescending = true
+	dm := &DisplayManager{config: config, docker: docker}
+
+	output := ansiPattern.ReplaceAllString(renderScreen(&LandingScreen{display: dm, docker: docker}), "")
+	if !strings.Contains(output, "Sorted by name ▼") || !strings.Contains(output, "SERVICE ▼") {
+		t.Errorf("descending sort isn't marked:\n%s", output)
+	}
+	if web, db := strings.Index(output, "│ web"), strings.Index(output, "│ db"); web < 0 || db < 0 || web > db {
+		t.Errorf("web isn't listed before db:\n%s", output)
+	}
+}
+
+func TestLandingScreenPinnedGolden(t *testing.T) {
+	docker := fixtureDockerClient()
+	config := fixtureConfig()
+	config.TogglePin("staging", "gone")
+	config.TogglePin("staging", "db")
+	config.Display.HideUnported = true
+	dm := &DisplayManager{config: config, docker: docker}
+	screen := &LandingScreen{display: dm, docker: docker}
+
+	assertGolden(t, "landing_pinned", renderScreen(screen))
+
+	// Pinned rows come first, then the remaining services with ports
+	for i, want := range []string{"db", "gone", "web"} {
+		if got := dm.renderedName(i); got != want {
+			t.Errorf("row %d = %q, want %q", i, got, want)
+		}
+	}
+	if dm.renderedService(1) != nil {
+		t.Error("the stopped pinned service resolved to a running one")
+	}
+}
+
+func TestPinTogglesRenderedRow(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker}
+	screen := &LandingScreen{display: dm, docker: docker}
+	renderScreen(screen)
+
+	if !screen.HandleInput("1 pin") {
+		t.Fatal("'1 pin' was not handled")
+	}
+	if got := dm.config.PinnedServices("staging"); len(got) != 1 || got[0] != "web" {
+		t.Fatalf("pins = %q after '1 pin', want [web]", got)
+	}
+	renderScreen(screen)
+	if got := dm.renderedName(0); got != "web" {
+		t.Errorf("row 0 = %q after pinning web, want web", got)
+	}
+	if !screen.HandleInput("pin web") {
+		t.Fatal("'pin web' was not handled")
+	}
+	if got := dm.config.PinnedServices("staging"); len(got) != 0 {
+		t.Errorf("pins = %q after 'pin web', want none", got)
+	}
+}
+
+func TestServiceDetailPin(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker}
+	dm.selectedService = docker.services["web"]
+	detail := &ServiceDetailScreen{display: dm, docker: docker}
+
+	if !detail.HandleInput("p") {
+		t.Fatal("'p' was not handled")
+	}
+	if got := dm.config.PinnedServices("staging"); len(got) != 1 || got[0] != "web" {
+		t.Fatalf("pins = %q after 'p', want [web]", got)
+	}
+	if output := renderScreen(detail); !strings.Contains(output, "Service Detail: ★ web") {
+		t.Errorf("detail doesn't mark web pinned:\n%s", output)
+	}
+	if output := renderScreen(&LandingScreen{display: dm, docker: docker}); !strings.Contains(output, "★ web") {
+		t.Errorf("overview doesn't mark web pinned:\n%s", output)
+	}
+
+	detail.HandleInput("p")
+	if got := dm.config.PinnedServices("staging"); len(got) != 0 {
+		t.Errorf("pins = %q after 'p' again, want none", got)
+	}
+}
+
+func TestClickSelectsRowBelowPinned(t *testing.T) {
+	config := fixtureConfig()
+	config.TogglePin("staging", "db")
+	dm, err := NewDisplayManager(config, fixtureDockerClient())
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	dm.SetMode(ModeOverview)
+	defer func() { dm.currentScreen.Close() }()
+
+	output := renderScreen(dm.currentScreen)
+	y := 0
+	for i, line := range strings.Split(ansiPattern.ReplaceAllString(output, ""), "\n") {
+		if strings.HasPrefix(line, "│ 1 ") {
+			y = i + 1
+		}
+	}
+	if y == 0 {
+		t.Fatalf("row 1 not found in output:\n%s", output)
+	}
+	if !dm.HandleKey(Key{Type: KeyMouse, X: 3, Y: y}) {
+		t.Fatal("click on row 1 was not handled")
+	}
+	if got := dm.SelectedService(); got == nil || got.Name != "web" {
+		t.Errorf("selected %v, want web", got)
+	}
+}
+
+func TestLandingSelectionUsesRenderedRows(t *testing.T) {
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker}
+	screen := &LandingScreen{display: dm, docker: docker}
+
+	// Rendered by name: 0 db, 1 web
+	renderScreen(screen)
+
+	// A poll adds a service that would now sort first, shifting the live list
+	docker.mu.Lock()
+	docker.services["api"] = &ServiceStatus{
+		Name:           "api",
+		ForwardedPorts: []ForwardedPort{{Remote: "80", Local: "80", Protocol: "tcp"}},
+	}
+	docker.mu.Unlock()
+	dm.UpdateServices(docker.services)
+
+	if got := dm.renderedService(1); got == nil || got.Name != "web" {
+		t.Fatalf("row 1 resolved to %v, want web as rendered", got)
+	}
+	if got := dm.renderedService(2); got != nil {
+		t.Errorf("row 2 resolved to %q although it was never rendered", got.Name)
+	}
+
+	// Once the new frame is drawn, numbers follow it
+	renderScreen(screen)
+	if got := dm.renderedService(0); got == nil || got.Name != "api" {
+		t.Errorf("row 0 resolved to %v after redraw, want api", got)
+	}
+}
+
+func TestSetModeStopsOutgoingPollers(t *testing.T) {
+	dm, err := NewDisplayManager(fixtureConfig(), fixtureDockerClient())
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 100; i++ {
+		dm.SetMode(ModeOverview)
+		dm.SetMode(ModeServiceDetail)
+		dm.SetMode(ModeServerList)
+	}
+
+	// Closed pollers exit asynchronously, so give them a moment to wind down
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines grew from %d to %d after cycling modes", before, after)
+	}
+
+	// Closing twice must not panic or block
+	dm.SetMode(ModeOverview)
+	dm.currentScreen.Close()
+	dm.SetMode(ModeServerList)
+}
+
+func TestClickSelectsRenderedService(t *testing.T) {
+	dm, err := NewDisplayManager(fixtureConfig(), fixtureDockerClient())
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	dm.SetMode(ModeOverview)
+	defer func() { dm.currentScreen.Close() }()
+
+	output := renderScreen(dm.currentScreen)
+
+	// Find the terminal row the web service was drawn on
+	y := 0
+	for i, line := range strings.Split(ansiPattern.ReplaceAllString(output, ""), "\n") {
+		if strings.HasPrefix(line, "│ 1 ") {
+			y = i + 1
+		}
+	}
+	if y == 0 {
+		t.Fatalf("row 1 not found in output:\n%s", output)
+	}
+
+	if dm.HandleKey(Key{Type: KeyMouse, X: 3, Y: y - 3}) {
+		t.Error("click on the table header was handled")
+	}
+	if !dm.HandleKey(Key{Type: KeyMouse, X: 3, Y: y}) {
+		t.Fatal("click on row 1 was not handled")
+	}
+	if dm.Mode() != ModeServiceDetail {
+		t.Errorf("mode = %v, want service detail", dm.Mode())
+	}
+	if got := dm.SelectedService(); got == nil || got.Name != "web" {
+		t.Errorf("selected %v, want web", got)
+	}
+}
+
+func TestHelpScreenGolden(t *testing.T) {
+	dm, err := NewDisplayManager(fixtureConfig(), fixtureDockerClient())
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	dm.SetMode(ModeOverview)
+	defer func() { dm.currentScreen.Close() }()
+
+	if !dm.HandleInput("?") {
+		t.Fatal("? was not handled")
+	}
+	if dm.Mode() != ModeHelp {
+		t.Fatalf("mode = %v, want help", dm.Mode())
+	}
+	assertGolden(t, "help_landing", renderScreen(dm.currentScreen))
+
+	if !dm.HandleInput("?") || dm.Mode() != ModeOverview {
+		t.Errorf("? did not return from help, mode = %v", dm.Mode())
+	}
+}
+
+func TestCopyLocalAddress(t *testing.T) {
+	var copied string
+	clipboardWriteAll = func(text string) error {
+		copied = text
+		return nil
+	}
+	defer func() { clipboardWriteAll = clipboard.WriteAll }()
+
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, colors: NewColorizer(false)}
+	dm.selectedService = docker.services["web"]
+	screen := &ServiceDetailScreen{display: dm, docker: docker}
+
+	if !screen.HandleInput("1 copy") {
+		t.Fatal("1 copy was not handled")
+	}
+	defer dm.flashTimer.Stop()
+	if copied != "http://localhost:18080" {
+		t.Errorf("copied %q, want %q", copied, "http://localhost:18080")
+	}
+	if dm.flashMsg != "Copied! http://localhost:18080" {
+		t.Errorf("flash = %q, want the copied address", dm.flashMsg)
+	}
+
+	if screen.HandleInput("5 copy") {
+		t.Error("5 copy was handled although there is no port 5")
+	}
+
+	// Non-HTTP ports are copied as host:port
+	dm.selectedService = docker.services["db"]
+	screen.HandleInput("c")
+	if copied != "localhost:5432" {
+		t.Errorf("copied %q, want %q", copied, "localhost:5432")
+	}
+}
+
+func TestOpenLocalURL(t *testing.T) {
+	var opened []string
+	browserCommand = func(url string) *exec.Cmd {
+		opened = append(opened, url)
+		return exec.Command("true")
+	}
+	defer func() { browserCommand = defaultBrowserCommand }()
+
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, colors: NewColorizer(false)}
+	dm.selectedService = docker.services["web"]
+	screen := &ServiceDetailScreen{display: dm, docker: docker}
+
+	screen.HandleInput("1 open")
+	defer dm.flashTimer.Stop()
+
+	// Port 5432 isn't HTTP, so there's nothing to open
+	dm.selectedService = docker.services["db"]
+	screen.HandleInput("0 open")
+
+	if len(opened) != 1 || opened[0] != "http://localhost:18080" {
+		t.Errorf("opened %v, want only http://localhost:18080", opened)
+	}
+}
+
+func TestPortScheme(t *testing.T) {
+	tests := []struct {
+		port ForwardedPort
+		want string
+	}{
+		{ForwardedPort{Remote: "8443", Local: "9443", Protocol: "tcp"}, "https://localhost:9443"},
+		{ForwardedPort{Remote: "80", Local: "8080", Protocol: "tcp"}, "http://localhost:8080"},
+		{ForwardedPort{Remote: "6379", Local: "6379", Protocol: "tcp"}, "localhost:6379"},
+		{ForwardedPort{Remote: "80", Local: "80", Protocol: "udp"}, "localhost:80"},
+	}
+	for _, tt := range tests {
+		if got := tt.port.LocalAddress(); got != tt.want {
+			t.Errorf("LocalAddress(%s/%s) = %q, want %q", tt.port.Remote, tt.port.Protocol, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmBeforeRemap(t *testing.T) {
+	dm, _ := newRemapFixture(t)
+	detail := &ServiceDetailScreen{display: dm, docker: dm.docker}
+	dm.currentScreen = detail
+	dm.mode = ModeServiceDetail
+
+	dm.HandleInput("0 remap 38125")
+	modal := dm.topModal()
+	if modal == nil {
+		t.Fatal("remap ran without asking for confirmation")
+	}
+	if got := renderScreen(modal); !strings.Contains(got, "Remap web port 3000 from local port 3000 to 38125? Are you sure? [y/N]") {
+		t.Errorf("unexpected dialog: %q", got)
+	}
+	if got := localPort(t, dm, "3000"); got != "3000" {
+		t.Fatalf("port 3000 moved to %s before confirming", got)
+	}
+
+	// Enter takes the default answer, leaving the detail screen as it was
+	dm.HandleKey(Key{Type: KeyEnter})
+	if dm.topModal() != nil || dm.currentScreen != detail {
+		t.Fatal("cancelling didn't return to the detail screen")
+	}
+	if got := localPort(t, dm, "3000"); got != "3000" {
+		t.Fatalf("port 3000 moved to %s after cancelling", got)
+	}
+
+	dm.HandleInput("0 remap 38125")
+	dm.HandleKey(Key{Type: KeyRune, Rune: 'y'})
+	if dm.topModal() != nil {
+		t.Fatal("dialog still open after confirming")
+	}
+	if got := localPort(t, dm, "3000"); got != "38125" {
+		t.Errorf("after confirming, port 3000 is on %s, want 38125", got)
+	}
+}
+
+func TestDisplayMirror(t *testing.T) {
+	dm, err := NewDisplayManager(fixtureConfig(), fixtureDockerClient())
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	dm.SetMode(ModeOverview)
+	defer func() { dm.currentScreen.Close() }()
+	dm.Display()
+
+	// A mirror added later starts with the current frame
+	var mirror bytes.Buffer
+	stop := dm.AddMirror(&mirror)
+	if !strings.HasPrefix(mirror.String(), "\033[H") || !strings.Contains(mirror.String(), "web") {
+		t.Fatalf("mirror got %q, want the overview redrawn", mirror.String())
+	}
+	if strings.Contains(strings.ReplaceAll(mirror.String(), "\r\n", ""), "\n") {
+		t.Error("mirrored frame has bare newlines, which a raw terminal doesn't return from")
+	}
+
+	mirror.Reset()
+	dm.HandleKeys(ParseKeys("1")...)
+	dm.HandleKeys(Key{Type: KeyEnter})
+	if dm.Mode() != ModeServiceDetail || !strings.Contains(mirror.String(), "web") {
+		t.Errorf("after selecting from a mirror mode is %v with %q drawn, want web's details", dm.Mode(), mirror.String())
+	}
+
+	stop()
+	mirror.Reset()
+	dm.HandleKeys(Key{Type: KeyEsc})
+	if mirror.Len() != 0 {
+		t.Errorf("stopped mirror still drawn on: %q", mirror.String())
+	}
+}
+
+// Refreshes update services in place while background work renders them; run with -race
+func TestForwardingStatusRaceWithDisplay(t *testing.T) {
+	lookupProcess = func(ctx context.Context, port string) *ProcessInfo {
+		return &ProcessInfo{Name: "postgres", PID: "812"}
+	}
+	t.Cleanup(func() { lookupProcess = localProcessForPort })
+
+	docker := fixtureDockerClient()
+	dm, err := NewDisplayManager(fixtureConfig(), docker)
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	defer func() { dm.currentScreen.Close() }()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			docker.UpdateForwardingStatus()
+		}
+	}()
+	for _, mode := range []DisplayMode{ModeOverview, ModeServiceDetail, ModeResolve} {
+		dm.selectedService = docker.GetService("db")
+		dm.SetMode(mode)
+		for range 10 {
+			dm.Display()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,242 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// serviceMarker starts every file `service install` writes, so uninstall only ever
+// removes a file it created
+const serviceMarker = "Generated by dockforward-monitor service install"
+
+// systemdUnitName is the user unit `service install` creates on Linux
+const systemdUnitName = "dockforward.service"
+
+// launchAgentLabel is the LaunchAgent `service install` creates on macOS
+const launchAgentLabel = "com.dockforward.monitor"
+
+// ServiceSpec is what the installed service runs
+type ServiceSpec struct {
+	Binary    string // Absolute path of the monitor binary
+	Server    string // Server to forward, or empty for the config's current server
+	ConfigDir string // Config directory to pass on, or empty for the default
+}
+
+// args returns the monitor's command line
+func (s ServiceSpec) args() []string {
+	args := []string{s.Binary, "--headless"}
+	if s.Server != "" {
+		args = append(args, "--server", s.Server)
+	}
+	return args
+}
+
+// ServiceManager installs the headless monitor as a user service that starts at login,
+// with systemd on Linux and launchd on macOS
+type ServiceManager struct {
+	goos string
+	home string
+	uid  int
+	run  func(name string, args ...string) ([]byte, error) // Runs systemctl or launchctl, replaced in tests
+}
+
+// NewServiceManager returns a manager for this machine's service manager
+func NewServiceManager() (*ServiceManager, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return &ServiceManager{
+		goos: runtime.GOOS,
+		home: home,
+		uid:  os.Getuid(),
+		run: func(name string, args ...string) ([]byte, error) {
+			return exec.Command(name, args...).CombinedOutput()
+		},
+	}, nil
+}
+
+// Path returns where the service definition is installed
+func (m *ServiceManager) Path() (string, error) {
+	switch m.goos {
+	case "linux":
+		return filepath.Join(m.home, ".config", "systemd", "user", systemdUnitName), nil
+	case "darwin":
+		return filepath.Join(m.home, "Library", "LaunchAgents", launchAgentLabel+".plist"), nil
+	}
+	return "", fmt.Errorf("services aren't supported on %s, only with systemd on Linux or launchd on macOS", m.goos)
+}
+
+// Install writes the service definition for spec and starts it, now and at every login
+func (m *ServiceManager) Install(spec ServiceSpec) (string, error) {
+	path, err := m.Path()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("%s already exists, run service uninstall first", path)
+	}
+
+	definition := systemdUnit(spec)
+	if m.goos == "darwin" {
+		definition = launchAgentPlist(spec, filepath.Join(m.home, "Library", "Logs", "dockforward.log"))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(definition), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	var steps [][]string
+	if m.goos == "darwin" {
+		steps = [][]string{{"launchctl", "bootstrap", m.launchDomain(), path}}
+	} else {
+		steps = [][]string{
+			{"systemctl", "--user", "daemon-reload"},
+			{"systemctl", "--user", "enable", "--now", systemdUnitName},
+		}
+	}
+	for _, step := range steps {
+		if err := m.runStep(step); err != nil {
+			return path, err
+		}
+	}
+	return path, nil
+}
+
+// Uninstall stops the service and removes the definition Install wrote, refusing to touch
+// a file it didn't write
+func (m *ServiceManager) Uninstall() (string, error) {
+	path, err := m.Path()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no service installed at %s", path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if !strings.Contains(string(data), serviceMarker) {
+		return "", fmt.Errorf("%s wasn't written by service install, leaving it alone", path)
+	}
+
+	// Stopping fails if it isn't running, which is fine since the goal is that it isn't
+	if m.goos == "darwin" {
+		m.run("launchctl", "bootout", m.launchDomain()+"/"+launchAgentLabel)
+	} else {
+		m.run("systemctl", "--user", "disable", "--now", systemdUnitName)
+	}
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("failed to remove %s: %v", path, err)
+	}
+	if m.goos != "darwin" {
+		if err := m.runStep([]string{"systemctl", "--user", "daemon-reload"}); err != nil {
+			return path, err
+		}
+	}
+	return path, nil
+}
+
+// Status reports whether the service is installed and what the service manager says about it
+func (m *ServiceManager) Status() (string, error) {
+	path, err := m.Path()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return "Not installed", nil
+	}
+
+	// Both exit non-zero for a stopped service, whose output is still the answer
+	var out []byte
+	if m.goos == "darwin" {
+		out, err = m.run("launchctl", "print", m.launchDomain()+"/"+launchAgentLabel)
+	} else {
+		out, err = m.run("systemctl", "--user", "status", "--no-pager", systemdUnitName)
+	}
+	if len(out) == 0 && err != nil {
+		return "", fmt.Errorf("failed to get service status: %v", err)
+	}
+	return fmt.Sprintf("Installed at %s\n\n%s", path, out), nil
+}
+
+// launchDomain is the launchd domain of the user's login session
+func (m *ServiceManager) launchDomain() string {
+	return "gui/" + strconv.Itoa(m.uid)
+}
+
+// runStep runs a service manager command, failing with its output
+func (m *ServiceManager) runStep(step []string) error {
+	out, err := m.run(step[0], step[1:]...)
+	if err != nil {
+		return fmt.Errorf("%s failed: %v\n%s", strings.Join(step, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// systemdQuote quotes an ExecStart argument for systemd
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	return `"` + arg + `"`
+}
+
+// systemdUnit returns a user unit running spec, restarted if it fails
+func systemdUnit(spec ServiceSpec) string {
+	var quoted []string
+	for _, arg := range spec.args() {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", serviceMarker)
+	b.WriteString("[Unit]\nDescription=dockforward port forwarding\nAfter=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	b.WriteString("Restart=on-failure\nRestartSec=5\n")
+	if spec.ConfigDir != "" {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(configDirEnv+"="+spec.ConfigDir))
+	}
+	b.WriteString("\n[Install]\nWantedBy=default.target\n")
+	return b.String()
+}
+
+// launchAgentPlist returns a LaunchAgent running spec at login, restarted if it fails,
+// logging to logPath
+func launchAgentPlist(spec ServiceSpec, logPath string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	fmt.Fprintf(&b, "<!-- %s -->\n", serviceMarker)
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", launchAgentLabel)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range spec.args() {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", html.EscapeString(arg))
+	}
+	b.WriteString("\t</array>\n")
+	if spec.ConfigDir != "" {
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		fmt.Fprintf(&b, "\t\t<key>%s</key>\n\t\t<string>%s</string>\n", configDirEnv, html.EscapeString(spec.ConfigDir))
+		b.WriteString("\t</dict>\n")
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	// Restart only after a failure, like systemd's Restart=on-failure
+	b.WriteString("\t<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", html.EscapeString(logPath))
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", html.EscapeString(logPath))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
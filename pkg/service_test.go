@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeServiceManager returns a manager for goos under a temporary home, recording the
+// commands it runs instead of running them
+func fakeServiceManager(t *testing.T, goos string) (*ServiceManager, *[]string) {
+	var ran []string
+	return &ServiceManager{
+		goos: goos,
+		home: t.TempDir(),
+		uid:  501,
+		run: func(name string, args ...string) ([]byte, error) {
+			ran = append(ran, strings.Join(append([]string{name}, args...), " "))
+			return nil, nil
+		},
+	}, &ran
+}
+
+func TestSystemdUnit(t *testing.T) {
+	unit := systemdUnit(ServiceSpec{Binary: "/opt/dock forward/monitor", Server: "staging", ConfigDir: "/etc/df"})
+	for _, want := range []string{
+		"# " + serviceMarker + "\n",
+		`ExecStart="/opt/dock forward/monitor" "--headless" "--server" "staging"` + "\n",
+		"Restart=on-failure\n",
+		`Environment="DOCKFORWARD_CONFIG_DIR=/etc/df"` + "\n",
+		"WantedBy=default.target\n",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit is missing %q:\n%s", want, unit)
+		}
+	}
+
+	if unit := systemdUnit(ServiceSpec{Binary: "/bin/m"}); strings.Contains(unit, "Environment=") {
+		t.Errorf("unit sets the environment without a config dir override:\n%s", unit)
+	}
+}
+
+func TestLaunchAgentPlist(t *testing.T) {
+	plist := launchAgentPlist(ServiceSpec{Binary: "/bin/m", Server: "a&b", ConfigDir: "/etc/df"}, "/tmp/df.log")
+	for _, want := range []string{
+		serviceMarker,
+		"<string>" + launchAgentLabel + "</string>",
+		"<string>/bin/m</string>\n\t\t<string>--headless</string>\n\t\t<string>--server</string>\n\t\t<string>a&amp;b</string>",
+		"<key>DOCKFORWARD_CONFIG_DIR</key>\n\t\t<string>/etc/df</string>",
+		"<key>SuccessfulExit</key>\n\t\t<false/>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("plist is missing %q:\n%s", want, plist)
+		}
+	}
+}
+
+func TestServiceInstallUninstallSystemd(t *testing.T) {
+	m, ran := fakeServiceManager(t, "linux")
+	path, err := m.Install(ServiceSpec{Binary: "/bin/m", Server: "staging"})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if want := filepath.Join(m.home, ".config", "systemd", "user", "dockforward.service"); path != want {
+		t.Errorf("installed at %s, want %s", path, want)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("unit wasn't written: %v", err)
+	}
+	if want := []string{"systemctl --user daemon-reload", "systemctl --user enable --now dockforward.service"}; !reflect.DeepEqual(*ran, want) {
+		t.Errorf("install ran %q, want %q", *ran, want)
+	}
+	if _, err := m.Install(ServiceSpec{Binary: "/bin/m"}); err == nil {
+		t.Error("a second install overwrote the first")
+	}
+
+	*ran = nil
+	if _, err := m.Uninstall(); err != nil {
+		t.Fatalf("Uninstall: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unit still exists after uninstall: %v", err)
+	}
+	if want := []string{"systemctl --user disable --now dockforward.service", "systemctl --user daemon-reload"}; !reflect.DeepEqual(*ran, want) {
+		t.Errorf("uninstall ran %q, want %q", *ran, want)
+	}
+	if status, err := m.Status(); err != nil || status != "Not installed" {
+		t.Errorf("Status() = %q, %v after uninstall, want Not installed", status, err)
+	}
+}
+
+func TestServiceInstallLaunchd(t *testing.T) {
+	m, ran := fakeServiceManager(t, "darwin")
+	path, err := m.Install(ServiceSpec{Binary: "/bin/m"})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if want := []string{"launchctl bootstrap gui/501 " + path}; !reflect.DeepEqual(*ran, want) {
+		t.Errorf("install ran %q, want %q", *ran, want)
+	}
+
+	*ran = nil
+	if _, err := m.Uninstall(); err != nil {
+		t.Fatalf("Uninstall: %v", err)
+	}
+	if want := []string{"launchctl bootout gui/501/com.dockforward.monitor"}; !reflect.DeepEqual(*ran, want) {
+		t.Errorf("uninstall ran %q, want %q", *ran, want)
+	}
+}
+
+func TestServiceUninstallLeavesForeignFile(t *testing.T) {
+	m, ran := fakeServiceManager(t, "linux")
+	path, _ := m.Path()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("[Service]\nExecStart=/usr/bin/something-else\n"), 0644)
+
+	if _, err := m.Uninstall(); err == nil {
+		t.Fatal("Uninstall removed a unit install didn't write")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("foreign unit was removed: %v", err)
+	}
+	if len(*ran) != 0 {
+		t.Errorf("uninstall ran %q for a foreign unit", *ran)
+	}
+}
@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultDockerSocket is where Docker listens on most Linux hosts
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// socketProbeTimeout limits how long each candidate socket has to answer a ping
+const socketProbeTimeout = 3 * time.Second
+
+// commandRunner runs commands on the remote host, satisfied by *SSHClient
+type commandRunner interface {
+	RunCommandContext(ctx context.Context, cmd string) (string, error)
+}
+
+// tcpPrefix marks a Docker endpoint reached over TCP rather than a socket path, as in
+// DOCKER_HOST=tcp://127.0.0.1:2375
+const tcpPrefix = "tcp://"
+
+// defaultDockerPort is the plain HTTP port Docker listens on when DOCKER_HOST names none
+const defaultDockerPort = "2375"
+
+// dockerHostEndpoint returns the endpoint DOCKER_HOST names, a socket path or a tcp://
+// address, and false for what can't be forwarded, such as ssh:// or an empty value
+func dockerHostEndpoint(dockerHost string) (string, bool) {
+	if path, ok := strings.CutPrefix(dockerHost, "unix://"); ok && path != "" {
+		return path, true
+	}
+	if addr, ok := strings.CutPrefix(dockerHost, tcpPrefix); ok && addr != "" {
+		addr = strings.TrimSuffix(addr, "/")
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, defaultDockerPort)
+		}
+		return tcpPrefix + addr, true
+	}
+	return "", false
+}
+
+// dialDocker connects to a Docker endpoint on the remote host, a tcp:// address or a
+// socket path
+func dialDocker(dialer socketDialer, endpoint string) (net.Conn, error) {
+	if addr, ok := strings.CutPrefix(endpoint, tcpPrefix); ok {
+		return dialer.Dial("tcp", addr)
+	}
+	return dialer.Dial("unix", endpoint)
+}
+
+// dockerSocketCandidates returns the endpoints Docker may listen on, in the order they're
+// tried. That's only the one DOCKER_HOST names if it's set, as for the docker CLI, and
+// otherwise the system socket, rootless Docker's and those of OrbStack and Colima, which
+// macOS developers use instead of Docker Desktop.
+func dockerSocketCandidates(dockerHost, uid, home string) []string {
+	if endpoint, ok := dockerHostEndpoint(dockerHost); ok {
+		return []string{endpoint}
+	}
+	candidates := []string{defaultDockerSocket}
+	if uid != "" {
+		candidates = append(candidates, "/run/user/"+uid+"/docker.sock")
+	}
+	if home != "" {
+		candidates = append(candidates, home+"/.orbstack/run/docker.sock", home+"/.colima/default/docker.sock")
+	}
+	return candidates
+}
+
+// resolveDockerSocket finds the remote host's Docker endpoint, returning the first candidate
+// that answers a ping. The remote environment is read in one command, whose failure only
+// leaves the system socket to try. It gives up once ctx is done. When DOCKER_HOST's
+// endpoint doesn't answer it's returned along with the error, so requests report why.
+// With tlsConfig only a TCP endpoint is tried, DOCKER_HOST's or defaultTLSEndpoint.
+func resolveDockerSocket(ctx context.Context, sshClient commandRunner, dialer socketDialer, tlsConfig *tls.Config) (string, error) {
+	var dockerHost, uid, home string
+	output, err := sshClient.RunCommandContext(ctx, `printf '%s\n' "$DOCKER_HOST" "$(id -u)" "$HOME"`)
+	if err != nil {
+		logAttrs(LevelWarn, "Failed to read the remote environment", "err", err)
+	} else {
+		fields := strings.Split(strings.TrimRight(output, "\n"), "\n")
+		for len(fields) < 3 {
+			fields = append(fields, "")
+		}
+		dockerHost, uid, home = strings.TrimSpace(fields[0]), strings.TrimSpace(fields[1]), strings.TrimSpace(fields[2])
+		if _, ok := dockerHostEndpoint(dockerHost); dockerHost != "" && !ok {
+			logAttrs(LevelWarn, "Ignoring DOCKER_HOST, only unix:// and tcp:// are supported", "docker_host", dockerHost)
+		}
+	}
+
+	candidates := dockerSocketCandidates(dockerHost, uid, home)
+	if tlsConfig != nil && !strings.HasPrefix(candidates[0], tcpPrefix) {
+		candidates = []string{defaultTLSEndpoint}
+	}
+	for _, path := range candidates {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("failed to find the Docker socket: %v", ctx.Err())
+		}
+		if err := pingDockerSocket(ctx, dialer, path, tlsConfig); err != nil {
+			logDebug("Docker socket not responding", "socket", path, "err", err)
+			if len(candidates) == 1 && dockerHost != "" {
+				return path, fmt.Errorf("DOCKER_HOST %s isn't responding: %v", dockerHost, err)
+			}
+			continue
+		}
+		logDebug("Found Docker socket", "socket", path)
+		return path, nil
+	}
+	return "", fmt.Errorf("no Docker socket responded, tried %s", strings.Join(candidates, ", "))
+}
+
+// pingDockerSocket checks that the Docker API answers at the remote endpoint path, over
+// TLS with tlsConfig if it isn't nil
+func pingDockerSocket(ctx context.Context, dialer socketDialer, path string, tlsConfig *tls.Config) error {
+	client := &http.Client{
+		Timeout: socketProbeTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialDocker(dialer, path)
+			},
+			TLSClientConfig:   tlsConfig,
+			DisableKeepAlives: true,
+		},
+	}
+	url := "http://docker/_ping"
+	if tlsConfig != nil {
+		url = "https://docker/_ping"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping returned %s", resp.Status)
+	}
+	return nil
+}
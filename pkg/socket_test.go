@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// socketsDialer dials the fake Docker API listening for each remote socket path
+type socketsDialer map[string]string
+
+func (s socketsDialer) Dial(network, addr string) (net.Conn, error) {
+	if target, ok := s[addr]; ok {
+		return net.Dial("tcp", target)
+	}
+	return nil, errors.New("no such file or directory")
+}
+
+// fakeRunner answers remote commands with fixed output
+type fakeRunner struct {
+	output string
+	err    error
+}
+
+func (f fakeRunner) RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	return f.output, f.err
+}
+
+func TestDockerSocketCandidates(t *testing.T) {
+	got := dockerSocketCandidates("", "501", "/Users/dev")
+	want := []string{
+		"/var/run/docker.sock",
+		"/run/user/501/docker.sock",
+		"/Users/dev/.orbstack/run/docker.sock",
+		"/Users/dev/.colima/default/docker.sock",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates = %q, want %q", got, want)
+	}
+
+	// DOCKER_HOST is all the docker CLI would try, so it's all that's tried
+	for dockerHost, want := range map[string]string{
+		"unix:///srv/docker.sock": "/srv/docker.sock",
+		"tcp://10.0.0.5:2376":     "tcp://10.0.0.5:2376",
+		"tcp://127.0.0.1/":        "tcp://127.0.0.1:2375",
+	} {
+		if got := dockerSocketCandidates(dockerHost, "501", "/Users/dev"); !reflect.DeepEqual(got, []string{want}) {
+			t.Errorf("candidates for DOCKER_HOST %s = %q, want %q", dockerHost, got, want)
+		}
+	}
+	// One that can't be forwarded is ignored
+	if got := dockerSocketCandidates("ssh://deploy@build", "", ""); !reflect.DeepEqual(got, []string{"/var/run/docker.sock"}) {
+		t.Errorf("candidates for an ssh DOCKER_HOST = %q", got)
+	}
+}
+
+func TestResolveDockerSocket(t *testing.T) {
+	docker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_ping" {
+			t.Errorf("probe requested %s, want /_ping", r.URL.Path)
+		}
+		io.WriteString(w, "OK")
+	}))
+	t.Cleanup(docker.Close)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(broken.Close)
+	addr := strings.TrimPrefix(docker.URL, "http://")
+
+	// Only OrbStack's socket answers, the rootless one exists but refuses
+	dialer := socketsDialer{
+		"/run/user/501/docker.sock":            strings.TrimPrefix(broken.URL, "http://"),
+		"/Users/dev/.orbstack/run/docker.sock": addr,
+	}
+	socket, err := resolveDockerSocket(context.Background(), fakeRunner{output: "\n501\n/Users/dev\n"}, dialer, nil)
+	if err != nil || socket != "/Users/dev/.orbstack/run/docker.sock" {
+		t.Errorf("resolveDockerSocket = %q, %v, want OrbStack's socket", socket, err)
+	}
+
+	// DOCKER_HOST wins over the system socket
+	dialer = socketsDialer{"/var/run/docker.sock": addr, "/srv/docker.sock": addr}
+	if socket, _ := resolveDockerSocket(context.Background(), fakeRunner{output: "unix:///srv/docker.sock\n0\n/root\n"}, dialer, nil); socket != "/srv/docker.sock" {
+		t.Errorf("resolveDockerSocket with DOCKER_HOST = %q", socket)
+	}
+
+	// A TCP DOCKER_HOST is dialed over TCP, and is the only endpoint tried
+	dialer = socketsDialer{"/var/run/docker.sock": addr, "127.0.0.1:2375": addr}
+	if socket, err := resolveDockerSocket(context.Background(), fakeRunner{output: "tcp://127.0.0.1:2375\n0\n/root\n"}, dialer, nil); err != nil || socket != "tcp://127.0.0.1:2375" {
+		t.Errorf("resolveDockerSocket with a TCP DOCKER_HOST = %q, %v", socket, err)
+	}
+	socket, err = resolveDockerSocket(context.Background(), fakeRunner{output: "tcp://127.0.0.1:2380\n0\n/root\n"}, dialer, nil)
+	if err == nil || socket != "tcp://127.0.0.1:2380" {
+		t.Errorf("resolveDockerSocket with DOCKER_HOST down = %q, %v, want it and an error rather than the system socket", socket, err)
+	}
+
+	// Without the remote environment the system socket is still tried
+	dialer = socketsDialer{"/var/run/docker.sock": addr}
+	if socket, _ := resolveDockerSocket(context.Background(), fakeRunner{err: errors.New("exec refused")}, dialer, nil); socket != "/var/run/docker.sock" {
+		t.Errorf("resolveDockerSocket without the environment = %q", socket)
+	}
+
+	if _, err := resolveDockerSocket(context.Background(), fakeRunner{output: "\n501\n/Users/dev\n"}, socketsDialer{}, nil); err == nil {
+		t.Error("resolveDockerSocket found a socket where none answers")
+	}
+}
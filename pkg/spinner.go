@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// spinnerFrames are drawn in turn to animate the spinner
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// spinnerInterval is how long each spinner frame is shown
+const spinnerInterval = 100 * time.Millisecond
+
+// Spinner animates a message on a single line while a slow operation runs
+type Spinner struct {
+	w       io.Writer
+	enabled bool
+	mu      sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewSpinner creates a spinner on stderr, which stays silent unless stderr is a terminal
+func NewSpinner() *Spinner {
+	return newSpinner(os.Stderr, term.IsTerminal(int(os.Stderr.Fd())))
+}
+
+func newSpinner(w io.Writer, enabled bool) *Spinner {
+	return &Spinner{w: w, enabled: enabled}
+}
+
+// Start shows message beside the spinner until Stop, replacing any message already spinning
+func (s *Spinner) Start(message string) {
+	if !s.enabled {
+		return
+	}
+	s.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			fmt.Fprintf(s.w, "\r\033[K%c %s", spinnerFrames[i%len(spinnerFrames)], message)
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}(s.stop, s.done)
+}
+
+// Stop ends the animation and clears its line so the next output starts on a blank line
+func (s *Spinner) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop, s.done = nil, nil
+	fmt.Fprint(s.w, "\r\033[K")
+}
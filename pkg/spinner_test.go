@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpinner(t *testing.T) {
+	var out bytes.Buffer
+	spinner := newSpinner(&out, true)
+
+	spinner.Start("Connecting to c1.local")
+	time.Sleep(spinnerInterval * 3 / 2)
+	spinner.Stop()
+
+	got := out.String()
+	for _, frame := range []string{"⠋ Connecting to c1.local", "⠙ Connecting to c1.local"} {
+		if !strings.Contains(got, frame) {
+			t.Errorf("output %q is missing frame %q", got, frame)
+		}
+	}
+	if !strings.HasSuffix(got, "\r\033[K") {
+		t.Errorf("output %q doesn't end by clearing the line", got)
+	}
+
+	// Stopping again, or before starting, writes nothing
+	out.Reset()
+	spinner.Stop()
+	if out.Len() != 0 {
+		t.Errorf("second Stop wrote %q", out.String())
+	}
+}
+
+func TestSpinnerSilentWithoutTerminal(t *testing.T) {
+	var out bytes.Buffer
+	spinner := newSpinner(&out, false)
+
+	spinner.Start("Syncing")
+	spinner.Stop()
+	if out.Len() != 0 {
+		t.Errorf("spinner wrote %q with stderr not a terminal", out.String())
+	}
+}
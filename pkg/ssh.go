@@ -1,29 +1,96 @@
 package pkg
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/ssh"
 	"io/ioutil"
-	"log"
+	"math/rand/v2"
+	"net"
 	"os"
 	"os/exec"
 	"strings"
 	"strconv"
 	"sync"
+	"time"
 )
 
+// ErrUDPNotSupported is returned for UDP ports, which SSH local forwarding (-L) only
+// carries for TCP; forwarding them needs a relay such as socat on both ends
+var ErrUDPNotSupported = errors.New("UDP forwarding over SSH is not supported")
+
+// forwardCommand builds the process that forwards a port, replaced in tests
+var forwardCommand = func(args ...string) *exec.Cmd {
+	return exec.Command("ssh", args...)
+}
+
+// Tunneler carries a DockerClient's traffic to its server: connections to the Docker
+// socket and forwards of remote ports to local ones. *SSHClient tunnels over SSH; tests and
+// other backends provide their own, such as testutil.Tunnel.
+type Tunneler interface {
+	Dial(network, addr string) (net.Conn, error)
+	ForwardPort(remotePort, localPort, protocol string) error
+	ForwardPorts(service *ServiceStatus, portMap map[string]string) error
+	StopForward(remotePort string)
+	StopForwards()
+	// ForwardFailure returns why remotePort's forward was given up on, or nil if it wasn't
+	ForwardFailure(remotePort string) error
+	// ForwardedTo returns the local port remotePort is forwarded to, or "" if it isn't
+	ForwardedTo(remotePort string) string
+	// ListForwards returns every forward, including those given up on, by remote port
+	ListForwards() []ForwardInfo
+	Connected() bool
+	Target() string
+	Close() error
+}
+
+// SSHClientInterface is a Tunneler that can also run commands on the server and give up on
+// slow operations, as *SSHClient can
+type SSHClientInterface interface {
+	Tunneler
+	RunCommand(cmd string) (string, error)
+	RunCommandContext(ctx context.Context, cmd string) (string, error)
+	ForwardPortContext(ctx context.Context, remotePort, localPort, protocol string) error
+	ForwardPortsContext(ctx context.Context, service *ServiceStatus, portMap map[string]string) error
+}
+
+var _ SSHClientInterface = (*SSHClient)(nil)
+
 // SSHClient wraps the SSH connection and configuration
 type SSHClient struct {
-	client *ssh.Client
-	config *ssh.ClientConfig
-	user   string
-	host   string
-	mu     sync.Mutex
-	ports  map[string]string // Track forwarded ports and their mappings
+	client   *ssh.Client
+	config   *ssh.ClientConfig
+	user     string
+	host     string
+	mu       sync.Mutex
+	ports    map[string]string    // Track forwarded ports and their mappings
+	forwards map[string]*forward  // Running forwards by remote port
+	failed   map[string]forwardFailure // Forwards given up on by remote port, which aren't restarted
+	closed   bool
+	lost     bool // The connection dropped on its own
+
+	ConnectedAt    time.Time // When the current connection was made
+	ReconnectCount int       // Times Reconnect replaced the connection
+	endedAt        time.Time // When the current connection dropped or was closed
 }
 
 // NewSSHClient creates a new SSH client with the given credentials
 func NewSSHClient(user, host, keyPath string) (*SSHClient, error) {
+	return NewSSHClientContext(context.Background(), user, host, keyPath)
+}
+
+// NewSSHClientContext is NewSSHClient, giving up on connecting once ctx is done
+func NewSSHClientContext(ctx context.Context, user, host, keyPath string) (*SSHClient, error) {
+	hostKeyCallback, err := knownHostKeys()
+	if err != nil {
+		return nil, err
+	}
+	return newSSHClient(ctx, user, host, keyPath, hostKeyCallback)
+}
+
+// newSSHClient connects with keyPath, checking the server's host key with hostKeyCallback
+func newSSHClient(ctx context.Context, user, host, keyPath string, hostKeyCallback ssh.HostKeyCallback) (*SSHClient, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, fmt.Errorf("unable to get home directory: %v", err)
@@ -46,35 +113,235 @@ func NewSSHClient(user, host, keyPath string) (*SSHClient, error) {
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: logHostKey(hostKeyCallback),
+	}
+
+	logDebug("Connecting over SSH", "server", fmt.Sprintf("%s@%s", user, host), "key", keyPath)
+	s := &SSHClient{
+		config:   config,
+		user:     user,
+		host:     host,
+		ports:    make(map[string]string),
+		forwards: make(map[string]*forward),
+	}
+	client, err := dialSSH(ctx, host, config)
+	if err != nil {
+		return nil, err
+	}
+	s.attach(client)
+	return s, nil
+}
+
+// logHostKey wraps callback to log the key each server presents, for --verbose
+func logHostKey(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		logDebug("Server host key", "host", hostname, "addr", remote.String(), "type", key.Type(), "fingerprint", ssh.FingerprintSHA256(key))
+		return callback(hostname, remote, key)
 	}
+}
 
-	client, err := ssh.Dial("tcp", host, config)
+// dialSSH connects and handshakes with host, giving up once ctx is done
+func dialSSH(ctx context.Context, host string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("unable to connect to remote host: %v", ctx.Err())
+		}
+		return nil, fmt.Errorf("unable to connect to remote host: %w: %v", ErrHostUnreachable, err)
+	}
+	// The handshake doesn't take a context, so closing the connection is what aborts it
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, host, config)
+	if !stop() {
+		if err == nil {
+			clientConn.Close()
+		}
+		return nil, fmt.Errorf("unable to connect to remote host: %v", ctx.Err())
+	}
+	if err != nil {
+		conn.Close()
+		// x/crypto/ssh has no typed error for refused keys, only this message
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, fmt.Errorf("unable to connect to remote host: %w: %v", ErrAuthFailed, err)
+		}
+		if errors.Is(err, ErrHostKeyMismatch) {
+			return nil, fmt.Errorf("unable to connect to remote host: %w", err)
+		}
 		return nil, fmt.Errorf("unable to connect to remote host: %v", err)
 	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// attach makes client the connection in use, marking the client lost once it drops
+func (s *SSHClient) attach(client *ssh.Client) {
+	s.mu.Lock()
+	s.client = client
+	s.lost = false
+	s.ConnectedAt = time.Now()
+	s.endedAt = time.Time{}
+	s.mu.Unlock()
+	go func() {
+		err := client.Wait()
+		s.mu.Lock()
+		// A reconnect may already have replaced this connection
+		if s.client == client {
+			s.lost = true
+			if s.endedAt.IsZero() {
+				s.endedAt = time.Now()
+			}
+		}
+		s.mu.Unlock()
+		logDebug("SSH connection ended", "server", s.Target(), "err", err)
+	}()
+}
+
+// Reconnect replaces a dropped connection with a new one to the same host, keeping the
+// client's forwards and counting the reconnect
+func (s *SSHClient) Reconnect() error {
+	return s.ReconnectContext(context.Background())
+}
+
+// ReconnectContext is Reconnect, giving up on connecting once ctx is done
+func (s *SSHClient) ReconnectContext(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return fmt.Errorf("SSH client is closed")
+	}
+	old := s.client
+	s.mu.Unlock()
+
+	logDebug("Reconnecting over SSH", "server", s.Target())
+	client, err := dialSSH(ctx, s.host, s.config)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		client.Close()
+		return fmt.Errorf("SSH client is closed")
+	}
+	s.ReconnectCount++
+	s.mu.Unlock()
+	s.attach(client)
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Uptime returns how long the current connection has been up, or how long it lasted once
+// it's dropped or closed
+func (s *SSHClient) Uptime() time.Duration {
+	return s.uptimeAt(time.Now())
+}
+
+// uptimeAt is Uptime as of now
+func (s *SSHClient) uptimeAt(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ConnectedAt.IsZero() {
+		return 0
+	}
+	if !s.endedAt.IsZero() {
+		now = s.endedAt
+	}
+	return now.Sub(s.ConnectedAt)
+}
 
-	return &SSHClient{
-		client: client,
-		config: config,
-		user:   user,
-		host:   host,
-		ports:  make(map[string]string),
-	}, nil
+// Reconnects returns how many times the client has reconnected since it was created
+func (s *SSHClient) Reconnects() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ReconnectCount
+}
+
+// Target returns the user@host the client is connected to
+func (s *SSHClient) Target() string {
+	return fmt.Sprintf("%s@%s", s.user, s.host)
+}
+
+// Connected reports whether the SSH connection is still up
+func (s *SSHClient) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.closed && !s.lost
 }
 
-// Close closes the SSH connection
+// Close stops every port forward and closes the SSH connection
 func (s *SSHClient) Close() error {
-	return s.client.Close()
+	s.mu.Lock()
+	s.closed = true
+	if s.endedAt.IsZero() {
+		s.endedAt = time.Now()
+	}
+	client := s.client
+	for remotePort, fwd := range s.forwards {
+		fwd.cmd.Process.Kill()
+		delete(s.forwards, remotePort)
+		delete(s.ports, remotePort)
+	}
+	s.mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	return client.Close()
+}
+
+// Dial opens a connection on the remote host, such as to the Docker socket
+func (s *SSHClient) Dial(network, addr string) (net.Conn, error) {
+	return s.GetClient().Dial(network, addr)
 }
 
 // GetClient returns the underlying SSH client
 func (s *SSHClient) GetClient() *ssh.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.client
 }
 
-// ForwardPort forwards a single port using SSH with optional local port mapping
-func (s *SSHClient) ForwardPort(remotePort, localPort string) error {
+// RunCommand runs a command on the remote host and returns its combined output
+func (s *SSHClient) RunCommand(cmd string) (string, error) {
+	return s.RunCommandContext(context.Background(), cmd)
+}
+
+// RunCommandContext is RunCommand, closing the session once ctx is done so the remote
+// command hangs up
+func (s *SSHClient) RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	session, err := s.GetClient().NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %v", err)
+	}
+	defer session.Close()
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	output, err := session.CombinedOutput(cmd)
+	if ctx.Err() != nil {
+		return string(output), fmt.Errorf("remote command cancelled: %v", ctx.Err())
+	}
+	if err != nil {
+		return string(output), fmt.Errorf("remote command failed: %v", err)
+	}
+	return string(output), nil
+}
+
+// ForwardPort forwards a single port using SSH with optional local port mapping.
+// An empty protocol is treated as TCP.
+func (s *SSHClient) ForwardPort(remotePort, localPort, protocol string) error {
+	return s.ForwardPortContext(context.Background(), remotePort, localPort, protocol)
+}
+
+// ForwardPortContext is ForwardPort, stopping the forward once ctx is done
+func (s *SSHClient) ForwardPortContext(ctx context.Context, remotePort, localPort, protocol string) error {
+	if protocol == "udp" {
+		return ErrUDPNotSupported
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to start port forwarding: %v", err)
+	}
 	if localPort == "" {
 		localPort = remotePort
 	}
@@ -82,55 +349,316 @@ func (s *SSHClient) ForwardPort(remotePort, localPort string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.closed {
+		return fmt.Errorf("SSH client is closed")
+	}
+
+	for otherRemote, otherLocal := range s.ports {
+		if otherRemote != remotePort && otherLocal == localPort {
+			return fmt.Errorf("%w: %s for remote port %s", ErrPortConflict, localPort, otherRemote)
+		}
+	}
+
+	// A forward given up on stays down until it's stopped or moved to another local port,
+	// so refreshes don't respawn one that can't work
+	if failure, ok := s.failed[remotePort]; ok {
+		if failure.localPort == localPort {
+			return failure.err
+		}
+		delete(s.failed, remotePort)
+	}
+
 	// Check if port is already mapped
 	if mappedPort, exists := s.ports[remotePort]; exists {
 		if mappedPort == localPort {
 			return nil // Port already forwarded to the same local port
 		}
-		// Different local port, need to kill existing forward
-		cmd := exec.Command("lsof", "-ti", fmt.Sprintf(":%s", remotePort))
-		if out, err := cmd.Output(); err == nil {
-			// Kill the existing SSH process
-			pid := strings.TrimSpace(string(out))
-			if pid != "" {
-				exec.Command("kill", pid).Run()
-			}
+		// Different local port, stop the existing forward
+		if fwd, ok := s.forwards[remotePort]; ok {
+			fwd.cmd.Process.Kill()
+			delete(s.forwards, remotePort)
 		}
 		delete(s.ports, remotePort)
 	}
 
+	cmd, output, err := s.startForward(remotePort, localPort)
+	if err != nil {
+		return err
+	}
+
 	// Track the new mapping
+	fwd := &forward{cmd: cmd, created: time.Now()}
 	s.ports[remotePort] = localPort
+	s.forwards[remotePort] = fwd
+
+	go s.superviseForward(ctx, remotePort, localPort, fwd, output)
+	return nil
+}
 
+// Restarts of a forward whose ssh exits on its own, such as when the connection drops
+const (
+	forwardRetries     = 5                // Restarts in a row before giving up on the forward
+	forwardRetryMax    = 30 * time.Second // Longest wait between restarts
+	forwardStableAfter = time.Minute      // Running this long resets the count of restarts
+)
+
+// forwardRetryDelay is the wait before the first restart, doubled for each one after; a
+// variable so tests can shorten it
+var forwardRetryDelay = 500 * time.Millisecond
+
+// forward is a running port forward's ssh process and how it has fared
+type forward struct {
+	cmd      *exec.Cmd
+	created  time.Time // When the forward was started, kept across restarts
+	restarts int       // Times ssh was restarted after exiting on its own
+	retrying bool      // Whether ssh exited and is waiting to be restarted
+}
+
+// forwardFailure is why a forward to localPort was given up on
+type forwardFailure struct {
+	localPort string
+	err       error
+}
+
+// startForward starts the ssh process forwarding localPort to remotePort, returning it and
+// the end of its output, where ssh says why it exited
+func (s *SSHClient) startForward(remotePort, localPort string) (*exec.Cmd, *outputTail, error) {
 	// Extract host from SSH host string (remove port)
 	host := strings.Split(s.host, ":")[0]
 
-	cmd := fmt.Sprintf("ssh -L %s:localhost:%s %s@%s -N", localPort, remotePort, s.user, host)
-	cmdArgs := strings.Split(cmd, " ")
+	// Without ExitOnForwardFailure, ssh keeps running when it can't listen on the local port
+	cmd := forwardCommand("-o", "ExitOnForwardFailure=yes", "-L", fmt.Sprintf("%s:localhost:%s", localPort, remotePort), fmt.Sprintf("%s@%s", s.user, host), "-N")
+	output := &outputTail{}
+	if cmd.Stderr == nil {
+		cmd.Stderr = output
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start port forwarding: %v", err)
+	}
+	logDebug("Started port forward", "server", s.Target(), "port", remotePort, "local_port", localPort, "pid", cmd.Process.Pid)
+	return cmd, output, nil
+}
 
-	// Run the port forwarding command in a goroutine
-	go func() {
-		for {
-			if err := exec.Command(cmdArgs[0], cmdArgs[1:]...).Run(); err != nil {
-				log.Printf("Port forwarding for %s -> %s failed, retrying: %v", remotePort, localPort, err)
-				s.mu.Lock()
-				delete(s.ports, remotePort)
-				s.mu.Unlock()
-				return
-			}
+// superviseForward waits for a forward's process to exit and restarts it, backing off after
+// each exit, until it's stopped or replaced, ctx is done, or it fails in a way a restart
+// can't fix or too many times in a row. A forward given up on is recorded in s.failed.
+func (s *SSHClient) superviseForward(ctx context.Context, remotePort, localPort string, fwd *forward, output *outputTail) {
+	restarts := 0
+	cmd := fwd.cmd
+	for {
+		stop := context.AfterFunc(ctx, func() { s.stopForward(remotePort, fwd) })
+		started := time.Now()
+		err := cmd.Wait()
+		stop()
+
+		s.mu.Lock()
+		if s.closed || s.forwards[remotePort] != fwd {
+			s.mu.Unlock()
+			return // Replaced by a remap, or stopped by StopForward, ctx or Close
 		}
-	}()
+		if time.Since(started) >= forwardStableAfter {
+			restarts = 0
+		}
+		failure := classifyForwardFailure(output.String())
+		if failure == nil && restarts >= forwardRetries {
+			failure = fmt.Errorf("port forward exited %d times in a row: %v", restarts+1, err)
+		}
+		if failure != nil {
+			s.giveUpForward(remotePort, localPort, failure)
+			s.mu.Unlock()
+			return
+		}
+		fwd.retrying = true
+		s.mu.Unlock()
+
+		restarts++
+		delay := backoff(forwardRetryDelay, forwardRetryMax, restarts)
+		logDebug("Restarting port forward", "server", s.Target(), "port", remotePort, "local_port", localPort, "attempt", restarts, "delay", delay, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			s.stopForward(remotePort, fwd)
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed || s.forwards[remotePort] != fwd {
+			s.mu.Unlock()
+			return // Stopped or replaced while waiting
+		}
+		next, nextOutput, err := s.startForward(remotePort, localPort)
+		if err != nil {
+			s.giveUpForward(remotePort, localPort, err)
+			s.mu.Unlock()
+			return
+		}
+		fwd.cmd, fwd.retrying = next, false
+		fwd.restarts++
+		s.mu.Unlock()
+		cmd, output = next, nextOutput
+	}
+}
 
+// giveUpForward forgets remotePort's forward and records why, with s.mu held
+func (s *SSHClient) giveUpForward(remotePort, localPort string, err error) {
+	logAttrs(LevelError, "Port forward failed, not restarting it", "server", s.Target(), "port", remotePort, "local_port", localPort, "err", err)
+	delete(s.forwards, remotePort)
+	delete(s.ports, remotePort)
+	if s.failed == nil {
+		s.failed = make(map[string]forwardFailure)
+	}
+	s.failed[remotePort] = forwardFailure{localPort: localPort, err: err}
+}
+
+// backoff returns the wait before the nth restart: base doubled for each restart before it,
+// capped at max, with up to half of it taken off at random so forwards that dropped
+// together don't all restart at once
+func backoff(base, max time.Duration, n int) time.Duration {
+	delay := base
+	for i := 1; i < n && delay < max; i++ {
+		delay *= 2
+	}
+	delay = min(delay, max)
+	return delay - rand.N(delay/2+1)
+}
+
+// classifyForwardFailure returns why a forward whose ssh wrote output can't work however
+// often it's restarted, or nil if a restart might help
+func classifyForwardFailure(output string) error {
+	reason := strings.TrimSpace(output)
+	if i := strings.LastIndexByte(reason, '\n'); i >= 0 {
+		reason = reason[i+1:]
+	}
+	switch {
+	case strings.Contains(output, "Permission denied"), strings.Contains(output, "Host key verification failed"), strings.Contains(output, "Too many authentication failures"):
+		return fmt.Errorf("%w: %s", ErrAuthFailed, reason)
+	case strings.Contains(output, "Address already in use"), strings.Contains(output, "cannot listen to port"), strings.Contains(output, "Could not request local forwarding"):
+		return fmt.Errorf("%w: %s", ErrPortInUse, reason)
+	case strings.Contains(output, "Bad local forwarding specification"), strings.Contains(output, "Bad port"), strings.Contains(output, "bad port"):
+		return fmt.Errorf("invalid port: %s", reason)
+	}
 	return nil
 }
 
+// ForwardFailure returns why remotePort's forward was given up on, or nil if it wasn't
+func (s *SSHClient) ForwardFailure(remotePort string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failed[remotePort].err
+}
+
+// ForwardedTo returns the local port remotePort is forwarded to, or "" if it isn't. The
+// port is held by our ssh process, so it shows as in use while the forward runs.
+func (s *SSHClient) ForwardedTo(remotePort string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ports[remotePort]
+}
+
+// ListForwards returns every forward, running, waiting to restart or given up on, by remote
+// port. ssh binds forwards to localhost and doesn't report the bytes it carries.
+func (s *SSHClient) ListForwards() []ForwardInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var forwards []ForwardInfo
+	for remotePort, fwd := range s.forwards {
+		state := ForwardActive
+		if fwd.retrying {
+			state = ForwardRetrying
+		}
+		forwards = append(forwards, ForwardInfo{
+			Remote:   remotePort,
+			Local:    s.ports[remotePort],
+			Bind:     "localhost",
+			State:    state,
+			Since:    fwd.created,
+			Restarts: fwd.restarts,
+		})
+	}
+	for remotePort, failure := range s.failed {
+		forwards = append(forwards, ForwardInfo{Remote: remotePort, Local: failure.localPort, Bind: "localhost", State: ForwardDead, Error: failure.err.Error()})
+	}
+	sortForwards(forwards)
+	return forwards
+}
+
+// outputTail keeps the last few KB written to it, enough for ssh's last words
+type outputTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (o *outputTail) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = append(o.buf, p...)
+	if len(o.buf) > 4096 {
+		o.buf = o.buf[len(o.buf)-4096:]
+	}
+	return len(p), nil
+}
+
+func (o *outputTail) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return string(o.buf)
+}
+
+// StopForward stops forwarding remotePort, if it's forwarded
+func (s *SSHClient) StopForward(remotePort string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fwd, ok := s.forwards[remotePort]; ok {
+		fwd.cmd.Process.Kill()
+		delete(s.forwards, remotePort)
+		logDebug("Stopped port forward", "server", s.Target(), "port", remotePort)
+	}
+	delete(s.ports, remotePort)
+	delete(s.failed, remotePort)
+}
+
+// stopForward stops the forward of remotePort if it's still fwd, not replaced since
+func (s *SSHClient) stopForward(remotePort string, fwd *forward) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.forwards[remotePort] != fwd {
+		return
+	}
+	fwd.cmd.Process.Kill()
+	delete(s.forwards, remotePort)
+	delete(s.ports, remotePort)
+	logDebug("Stopped port forward", "server", s.Target(), "port", remotePort)
+}
+
+// StopForwards stops every port forward, keeping the connection open
+func (s *SSHClient) StopForwards() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for remotePort, fwd := range s.forwards {
+		fwd.cmd.Process.Kill()
+		delete(s.forwards, remotePort)
+	}
+	clear(s.ports)
+	clear(s.failed)
+}
+
 // ForwardPorts forwards multiple ports for a service with optional port mapping
 func (s *SSHClient) ForwardPorts(service *ServiceStatus, portMap map[string]string) error {
+	return s.ForwardPortsContext(context.Background(), service, portMap)
+}
+
+// ForwardPortsContext is ForwardPorts, stopping the forwards once ctx is done
+func (s *SSHClient) ForwardPortsContext(ctx context.Context, service *ServiceStatus, portMap map[string]string) error {
 	if portMap == nil {
 		portMap = make(map[string]string)
 	}
 
-	for _, remotePort := range service.ExposedPorts {
+	for _, port := range service.ForwardedPorts {
+		remotePort := port.Remote
+		if port.Protocol == "udp" {
+			continue // Can't be forwarded, see ErrUDPNotSupported
+		}
+
 		// Handle port ranges
 		if strings.Contains(remotePort, "-") {
 			portRange := strings.Split(remotePort, "-")
@@ -150,14 +678,14 @@ func (s *SSHClient) ForwardPorts(service *ServiceStatus, portMap map[string]stri
 			for i := start; i <= end; i++ {
 				portStr := fmt.Sprintf("%d", i)
 				localPort := portMap[portStr]
-				if err := s.ForwardPort(portStr, localPort); err != nil {
-					return fmt.Errorf("error forwarding port %s -> %s: %v", portStr, localPort, err)
+				if err := s.ForwardPortContext(ctx, portStr, localPort, port.Protocol); err != nil {
+					return fmt.Errorf("error forwarding port %s -> %s: %w", portStr, localPort, err)
 				}
 			}
 		} else {
 			localPort := portMap[remotePort]
-			if err := s.ForwardPort(remotePort, localPort); err != nil {
-				return fmt.Errorf("error forwarding port %s -> %s: %v", remotePort, localPort, err)
+			if err := s.ForwardPortContext(ctx, remotePort, localPort, port.Protocol); err != nil {
+				return fmt.Errorf("error forwarding port %s -> %s: %w", remotePort, localPort, err)
 			}
 		}
 	}
@@ -204,3 +732,29 @@ func IsPortInUse(port string, localPorts []string) bool {
 	}
 	return false
 }
+
+// ShellArgs returns the ssh command line, ssh first, that opens an interactive shell on the
+// server with its configured key and port
+func (s ServerConfig) ShellArgs() []string {
+	args := []string{"ssh", "-t"}
+	if s.KeyPath != "" {
+		// Offer only this key, as the docker wrapper does
+		args = append(args, "-i", expandHome(s.KeyPath), "-o", "IdentitiesOnly=yes")
+	}
+	host := s.Host
+	if h, port, err := net.SplitHostPort(s.Host); err == nil {
+		host = h
+		if port != "22" {
+			args = append(args, "-p", port)
+		}
+	}
+	if s.User != "" {
+		host = s.User + "@" + host
+	}
+	return append(args, host)
+}
+
+// ShellQuote quotes s for a POSIX shell, for paths and arguments in commands run over ssh
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,664 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testContainersJSON is served by the fake Docker API behind the test SSH server
+const testContainersJSON = `[
+	{"Id":"abc","Names":["/web"],"State":"running","Status":"Up 5 minutes (healthy)","Ports":[]},
+	{"Id":"def","Names":["/worker"],"State":"exited","Status":"Exited (1) 2 minutes ago","Ports":[]}
+]`
+
+// generateKey returns a new RSA key as a signer and its PEM encoding
+func generateKey(t *testing.T) (ssh.Signer, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return signer, pemBytes
+}
+
+// startTestSSHServer starts an in-process SSH server that accepts the key it writes to
+// ~/.ssh/id_rsa under a temporary HOME, runs exec requests locally, and forwards
+// Unix socket channels to a fake Docker API
+func startTestSSHServer(t *testing.T) (host string, cleanup func()) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	hostKey, _ := generateKey(t)
+	clientKey, clientPEM := generateKey(t)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatalf("failed to create .ssh directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_rsa"), clientPEM, 0600); err != nil {
+		t.Fatalf("failed to write client key: %v", err)
+	}
+
+	authorized := string(clientKey.PublicKey().Marshal())
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == authorized {
+				return nil, nil
+			}
+			return nil, errors.New("unknown public key")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	// Fake Docker API on a Unix socket, reached through direct-streamlocal channels
+	dockerSocket := filepath.Join(home, "docker.sock")
+	dockerListener, err := net.Listen("unix", dockerSocket)
+	if err != nil {
+		t.Fatalf("failed to listen on docker socket: %v", err)
+	}
+	dockerServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			io.WriteString(w, "OK")
+			return
+		}
+		if r.URL.Path != "/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, testContainersJSON)
+	})}
+	go dockerServer.Serve(dockerListener)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serveTestSSHConn(conn, config, dockerSocket)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), func() {
+		listener.Close()
+		dockerServer.Close()
+		wg.Wait()
+	}
+}
+
+func serveTestSSHConn(conn net.Conn, config *ssh.ServerConfig, dockerSocket string) {
+	serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go serveTestSession(newChannel)
+		case "direct-streamlocal@openssh.com":
+			go serveTestStreamLocal(newChannel, dockerSocket)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// serveTestSession handles exec requests by running the command with the local shell
+func serveTestSession(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		cmd := exec.Command("sh", "-c", payload.Command)
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		status := uint32(0)
+		if err := cmd.Run(); err != nil {
+			status = 1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status = uint32(exitErr.ExitCode())
+			}
+		}
+		statusPayload := make([]byte, 4)
+		binary.BigEndian.PutUint32(statusPayload, status)
+		channel.SendRequest("exit-status", false, statusPayload)
+		return
+	}
+}
+
+// serveTestStreamLocal proxies any requested socket path to the fake Docker API
+func serveTestStreamLocal(newChannel ssh.NewChannel, dockerSocket string) {
+	remote, err := net.Dial("unix", dockerSocket)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		remote.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		io.Copy(channel, remote)
+		channel.CloseWrite()
+	}()
+	io.Copy(remote, channel)
+	remote.Close()
+	channel.Close()
+}
+
+func TestNewSSHClient(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	client, err := NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	client.Close()
+}
+
+func TestLogHostKey(t *testing.T) {
+	var logged []string
+	SetLogHook(func(level MessageLevel, text string) { logged = append(logged, text) })
+	SetLogLevel(LevelDebug)
+	t.Cleanup(func() {
+		SetLogHook(nil)
+		SetLogLevel(LevelInfo)
+	})
+
+	signer, _ := generateKey(t)
+	key := signer.PublicKey()
+	called := false
+	callback := logHostKey(func(string, net.Addr, ssh.PublicKey) error {
+		called = true
+		return nil
+	})
+	if err := callback("example.invalid:22", &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}, key); err != nil || !called {
+		t.Fatalf("callback = %v, called %v", err, called)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], ssh.FingerprintSHA256(key)) || !strings.Contains(logged[0], "host=example.invalid:22") {
+		t.Errorf("logged %q, want the host and its key's fingerprint", logged)
+	}
+}
+
+func TestSSHClientReconnect(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	client, err := NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	defer client.Close()
+	if client.ConnectedAt.IsZero() {
+		t.Fatal("ConnectedAt not set on connecting")
+	}
+
+	// Drop the connection underneath the client
+	client.GetClient().Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Connected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.Connected() {
+		t.Fatal("client still connected after its connection dropped")
+	}
+	lasted := client.Uptime()
+	time.Sleep(20 * time.Millisecond)
+	if client.Uptime() != lasted {
+		t.Error("uptime kept counting after the connection dropped")
+	}
+
+	firstConnected := client.ConnectedAt
+	if err := client.Reconnect(); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	if !client.Connected() || client.Reconnects() != 1 || !client.ConnectedAt.After(firstConnected) {
+		t.Errorf("after reconnecting: connected %v, %d reconnects, connected at %v (was %v)", client.Connected(), client.Reconnects(), client.ConnectedAt, firstConnected)
+	}
+	if output, err := client.RunCommand("echo hello"); err != nil || output != "hello\n" {
+		t.Errorf("RunCommand over the new connection = %q, %v", output, err)
+	}
+
+	client.Close()
+	if err := client.Reconnect(); err == nil {
+		t.Error("Reconnect succeeded on a closed client")
+	}
+}
+
+func TestNewSSHClientRejectsUnknownKey(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	_, otherPEM := generateKey(t)
+	if err := os.WriteFile(filepath.Join(os.Getenv("HOME"), ".ssh", "other_rsa"), otherPEM, 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	if client, err := NewSSHClient("tester", host, "~/.ssh/other_rsa"); err == nil {
+		client.Close()
+		t.Fatal("expected NewSSHClient to fail with an unauthorized key")
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	client, err := NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	defer client.Close()
+
+	output, err := client.RunCommand("echo hello")
+	if err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+	if output != "hello\n" {
+		t.Errorf("RunCommand output = %q, want %q", output, "hello\n")
+	}
+
+	output, err = client.RunCommand("echo oops >&2; exit 3")
+	if err == nil {
+		t.Fatal("expected RunCommand to fail for a non-zero exit status")
+	}
+	if !strings.Contains(err.Error(), "status 3") {
+		t.Errorf("expected exit status 3 in error, got %v", err)
+	}
+	if output != "oops\n" {
+		t.Errorf("RunCommand output = %q, want %q", output, "oops\n")
+	}
+}
+
+func TestForwardPortTracksMapping(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	client, err := NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.ForwardPort("18080", "", "tcp"); err != nil {
+		t.Fatalf("ForwardPort failed: %v", err)
+	}
+
+	// The ssh subprocess may already have failed and dropped the mapping, but never remaps it
+	client.mu.Lock()
+	mapped, exists := client.ports["18080"]
+	client.mu.Unlock()
+	if exists && mapped != "18080" {
+		t.Errorf("port 18080 mapped to %q, want %q", mapped, "18080")
+	}
+
+	// Forwarding the same mapping again is a no-op
+	if err := client.ForwardPort("18080", "18080", "tcp"); err != nil {
+		t.Fatalf("repeated ForwardPort failed: %v", err)
+	}
+}
+
+func TestRunCommandContextCancelled(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	client, err := NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.RunCommandContext(ctx, "sleep 2"); err == nil {
+		t.Fatal("RunCommandContext succeeded after being cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RunCommandContext returned %v after being cancelled", elapsed)
+	}
+}
+
+func TestForwardPortContextStopsForward(t *testing.T) {
+	_, client := newRemapFixture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.ForwardPortContext(ctx, "3000", "", "tcp"); err != nil {
+		t.Fatalf("ForwardPortContext failed: %v", err)
+	}
+	client.mu.Lock()
+	forward := client.forwards["3000"].cmd
+	client.mu.Unlock()
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for forward.Process.Signal(syscall.Signal(0)) == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if forward.Process.Signal(syscall.Signal(0)) == nil {
+		t.Error("forward process still running after its context was cancelled")
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if _, ok := client.ports["3000"]; ok {
+		t.Error("port 3000 still mapped after its context was cancelled")
+	}
+}
+
+func TestForwardPortRejectsUDP(t *testing.T) {
+	client := &SSHClient{ports: make(map[string]string)}
+
+	if err := client.ForwardPort("53", "", "udp"); !errors.Is(err, ErrUDPNotSupported) {
+		t.Fatalf("ForwardPort error = %v, want ErrUDPNotSupported", err)
+	}
+	if len(client.ports) != 0 {
+		t.Errorf("UDP port was recorded as forwarded: %v", client.ports)
+	}
+}
+
+func TestDockerClientOverSSH(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	client, err := NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	defer client.Close()
+
+	docker, err := NewDockerClient(client, defaultDialTimeout)
+	if err != nil {
+		t.Fatalf("NewDockerClient failed: %v", err)
+	}
+	docker.Start()
+	defer docker.Close()
+
+	services, err := docker.GetServices()
+	if err != nil {
+		t.Fatalf("GetServices failed: %v", err)
+	}
+
+	if len(services) != 2 {
+		t.Fatalf("got %d services, want 2", len(services))
+	}
+	if got := services["web"].HealthStatus; got != HealthHealthy {
+		t.Errorf("web health = %q, want %q", got, HealthHealthy)
+	}
+	if got := services["worker"].HealthStatus; got != HealthExited {
+		t.Errorf("worker health = %q, want %q", got, HealthExited)
+	}
+}
+
+func TestShutdownLeavesNothingRunning(t *testing.T) {
+	host, cleanup := startTestSSHServer(t)
+	defer cleanup()
+
+	// Stand in for ssh -L with a process that runs until killed
+	forwardCommand = func(args ...string) *exec.Cmd {
+		return exec.Command("sleep", "60")
+	}
+	defer func() {
+		forwardCommand = func(args ...string) *exec.Cmd { return exec.Command("ssh", args...) }
+	}()
+
+	client, err := NewSSHClient("tester", host, "~/.ssh/id_rsa")
+	if err != nil {
+		t.Fatalf("NewSSHClient failed: %v", err)
+	}
+	docker, err := NewDockerClient(client, defaultDialTimeout)
+	if err != nil {
+		t.Fatalf("NewDockerClient failed: %v", err)
+	}
+	docker.Start()
+	if err := client.ForwardPort("18080", "", "tcp"); err != nil {
+		t.Fatalf("ForwardPort failed: %v", err)
+	}
+	forward := client.forwards["18080"].cmd
+
+	dm, err := NewDisplayManager(fixtureConfig(), nil)
+	if err != nil {
+		t.Fatalf("NewDisplayManager failed: %v", err)
+	}
+	dm.SetDockerClient(docker)
+	dm.SetMode(ModeOverview)
+	dm.Shutdown()
+
+	if conn, err := net.Dial("tcp", docker.listener.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("Docker API listener still accepts connections after shutdown")
+	}
+	if _, err := client.RunCommand("true"); err == nil {
+		t.Error("SSH connection still usable after shutdown")
+	}
+	if err := client.ForwardPort("18081", "", "tcp"); err == nil {
+		t.Error("ForwardPort succeeded after shutdown")
+	}
+
+	// The forward process is reaped asynchronously once killed
+	deadline := time.Now().Add(time.Second)
+	for forward.Process.Signal(syscall.Signal(0)) == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := forward.Process.Signal(syscall.Signal(0)); err == nil {
+		t.Error("port forward process still running after shutdown")
+	}
+}
+
+// stubFailingForward makes forwards run script in place of ssh, returning how many were started
+func stubFailingForward(t *testing.T, script string) *atomic.Int32 {
+	t.Helper()
+	var starts atomic.Int32
+	forwardCommand = func(args ...string) *exec.Cmd {
+		starts.Add(1)
+		return exec.Command("sh", "-c", script)
+	}
+	delay := forwardRetryDelay
+	forwardRetryDelay = time.Millisecond
+	t.Cleanup(func() {
+		forwardCommand = func(args ...string) *exec.Cmd { return exec.Command("ssh", args...) }
+		forwardRetryDelay = delay
+	})
+	return &starts
+}
+
+// waitForwardFailure waits for client to give up on port's forward, returning why
+func waitForwardFailure(t *testing.T, client *SSHClient, port string) error {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := client.ForwardFailure(port); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("forward of port %s never given up on", port)
+	return nil
+}
+
+func TestForwardPortRetriesAreCapped(t *testing.T) {
+	starts := stubFailingForward(t, "exit 255")
+	client := &SSHClient{user: "tester", host: "example.invalid:22", ports: make(map[string]string), forwards: make(map[string]*forward)}
+	defer client.Close()
+
+	if err := client.ForwardPort("3000", "", "tcp"); err != nil {
+		t.Fatalf("ForwardPort failed: %v", err)
+	}
+	waitForwardFailure(t, client, "3000")
+	if got, want := starts.Load(), int32(1+forwardRetries); got != want {
+		t.Errorf("forward started %d times, want %d", got, want)
+	}
+	client.mu.Lock()
+	_, mapped := client.ports["3000"]
+	client.mu.Unlock()
+	if mapped {
+		t.Error("port 3000 still mapped after its forward was given up on")
+	}
+
+	// Asking again for the same forward doesn't start it over
+	if err := client.ForwardPort("3000", "", "tcp"); err == nil {
+		t.Error("ForwardPort of a forward given up on succeeded")
+	}
+	if got := starts.Load(); got != int32(1+forwardRetries) {
+		t.Errorf("forward started %d times after asking again, want no more", got)
+	}
+
+	// Stopping it clears the failure
+	client.StopForward("3000")
+	if err := client.ForwardFailure("3000"); err != nil {
+		t.Errorf("ForwardFailure after StopForward = %v, want nil", err)
+	}
+}
+
+func TestForwardPortPermanentFailure(t *testing.T) {
+	starts := stubFailingForward(t, "echo 'tester@example.invalid: Permission denied (publickey).' >&2; exit 255")
+	client := &SSHClient{user: "tester", host: "example.invalid:22", ports: make(map[string]string), forwards: make(map[string]*forward)}
+	defer client.Close()
+
+	if err := client.ForwardPort("3000", "", "tcp"); err != nil {
+		t.Fatalf("ForwardPort failed: %v", err)
+	}
+	if err := waitForwardFailure(t, client, "3000"); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("ForwardFailure = %v, want ErrAuthFailed", err)
+	}
+	if got := starts.Load(); got != 1 {
+		t.Errorf("forward failing auth started %d times, want 1", got)
+	}
+}
+
+func TestClassifyForwardFailure(t *testing.T) {
+	tests := []struct {
+		output string
+		want   error
+	}{
+		{"bind [127.0.0.1]:3000: Address already in use\nchannel_setup_fwd_listener_tcpip: cannot listen to port: 3000\n", ErrPortInUse},
+		{"Host key verification failed.\n", ErrAuthFailed},
+		{"Connection closed by 10.0.0.5 port 22\n", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		err := classifyForwardFailure(tt.output)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("classifyForwardFailure(%q) = %v, want %v", tt.output, err, tt.want)
+		}
+	}
+	if err := classifyForwardFailure("Bad local forwarding specification '99999:localhost:80'\n"); err == nil {
+		t.Error("a bad port was taken for a failure a restart might fix")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for n := 1; n <= 10; n++ {
+		want := min(100*time.Millisecond<<(n-1), time.Second)
+		for range 20 {
+			if got := backoff(100*time.Millisecond, time.Second, n); got < want/2 || got > want {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", n, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestUpdateForwardingStatusMarksFailedForward(t *testing.T) {
+	stubFailingForward(t, "exit 255")
+	client := &SSHClient{user: "tester", host: "example.invalid:22", ports: make(map[string]string), forwards: make(map[string]*forward)}
+	defer client.Close()
+	docker := fixtureDockerClient()
+	docker.sshClient = client
+
+	if err := client.ForwardPort("3000", "", "tcp"); err != nil {
+		t.Fatalf("ForwardPort failed: %v", err)
+	}
+	waitForwardFailure(t, client, "3000")
+	if err := docker.UpdateForwardingStatus(); err != nil {
+		t.Fatalf("UpdateForwardingStatus failed: %v", err)
+	}
+	web := docker.GetService("web")
+	if got := web.Port("3000").Status; got != StatusError {
+		t.Errorf("dead forward's port status = %q, want %q", got, StatusError)
+	}
+	if web.ForwardStatus != StatusError {
+		t.Errorf("service with a dead forward has status %q, want %q", web.ForwardStatus, StatusError)
+	}
+}
+
+func TestServerShellArgs(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		server ServerConfig
+		want   []string
+	}{
+		{ServerConfig{Host: "build.example.com:22", User: "deploy", KeyPath: "~/.ssh/id_ed25519"},
+			[]string{"ssh", "-t", "-i", filepath.Join(home, ".ssh/id_ed25519"), "-o", "IdentitiesOnly=yes", "deploy@build.example.com"}},
+		{ServerConfig{Host: "10.0.0.5:2222", User: "deploy", KeyPath: "/keys/build"},
+			[]string{"ssh", "-t", "-i", "/keys/build", "-o", "IdentitiesOnly=yes", "-p", "2222", "deploy@10.0.0.5"}},
+		// A Host alias from ~/.ssh/config, which supplies the rest
+		{ServerConfig{Host: "build"}, []string{"ssh", "-t", "build"}},
+	}
+	for _, tt := range tests {
+		if got := tt.server.ShellArgs(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ShellArgs(%+v) = %q, want %q", tt.server, got, tt.want)
+		}
+	}
+}
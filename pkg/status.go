@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// StatusReport is the machine-readable state printed by `dockforward-monitor status`
+type StatusReport struct {
+	Source  string         `json:"source"` // "monitor" when read from a running monitor, "query" for a one-shot query
+	Time    time.Time      `json:"time"`
+	Servers []ServerReport `json:"servers"`
+}
+
+// ServerReport is the state of one server and its services
+type ServerReport struct {
+	Name      string          `json:"name"`
+	Host      string          `json:"host"`
+	User      string          `json:"user"`
+	Connected bool            `json:"connected"`
+	Error     string          `json:"error,omitempty"`
+	Services  []ServiceReport `json:"services"`
+}
+
+// ServiceReport is the state of one service and its exposed ports
+type ServiceReport struct {
+	Name          string       `json:"name"`
+	Image         string       `json:"image,omitempty"`
+	Health        string       `json:"health"`
+	Replicas      string       `json:"replicas,omitempty"`
+	ForwardStatus string       `json:"forward_status"`
+	Ports         []PortReport `json:"ports"`
+}
+
+// PortReport is one exposed port and its local forward
+type PortReport struct {
+	Remote   string       `json:"remote"`
+	Local    string       `json:"local"`
+	Protocol string       `json:"protocol"`
+	Status   string       `json:"status"`
+	Address  string       `json:"address"`
+	Conflict *ProcessInfo `json:"conflict,omitempty"`
+	Error    string       `json:"error,omitempty"` // Why the forward failed
+}
+
+// serviceReport describes a service and its ports
+func serviceReport(service *ServiceStatus) ServiceReport {
+	report := ServiceReport{
+		Name:          service.Name,
+		Image:         service.Image,
+		Health:        service.HealthStatus,
+		Replicas:      service.Replicas,
+		ForwardStatus: service.ForwardStatus,
+		Ports:         []PortReport{},
+	}
+	for _, port := range service.ForwardedPorts {
+		report.Ports = append(report.Ports, portReport(port))
+	}
+	return report
+}
+
+// portReport describes a forwarded port the way status reports do
+func portReport(port ForwardedPort) PortReport {
+	return PortReport{
+		Remote:   port.Remote,
+		Local:    port.Local,
+		Protocol: port.Protocol,
+		Status:   port.Status,
+		Address:  port.LocalAddress(),
+		Conflict: port.ConflictInfo,
+		Error:    port.Error,
+	}
+}
+
+// Conflicts returns the number of ports held by another local process
+func (r *StatusReport) Conflicts() int {
+	conflicts := 0
+	for _, server := range r.Servers {
+		for _, service := range server.Services {
+			for _, port := range service.Ports {
+				if port.Status == StatusConflict {
+					conflicts++
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// Errors returns the number of unreachable servers and ports that failed to forward
+func (r *StatusReport) Errors() int {
+	errs := 0
+	for _, server := range r.Servers {
+		if server.Error != "" {
+			errs++
+		}
+		for _, service := range server.Services {
+			for _, port := range service.Ports {
+				if port.Status == StatusError {
+					errs++
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// serverReport describes server and the services docker knows about, sorted by name
+func serverReport(server ServerConfig, docker ContainerAPI) ServerReport {
+	report := ServerReport{
+		Name:     server.Name,
+		Host:     server.Host,
+		User:     server.User,
+		Services: []ServiceReport{},
+	}
+	if docker == nil {
+		report.Error = "not connected"
+		return report
+	}
+	if client := docker.GetClient(); client != nil {
+		report.Connected = client.Connected()
+	}
+
+	// Hold the lock while copying, since remaps and refreshes change services in place
+	docker.ViewServices(func(services map[string]*ServiceStatus) {
+		for _, service := range services {
+			report.Services = append(report.Services, serviceReport(service))
+		}
+	})
+	sort.Slice(report.Services, func(i, j int) bool {
+		return report.Services[i].Name < report.Services[j].Name
+	})
+	return report
+}
+
+// QueryStatus connects to server without forwarding anything and reports its services,
+// for when no monitor is running
+func QueryStatus(server *ServerConfig) StatusReport {
+	return QueryStatusContext(context.Background(), server)
+}
+
+// QueryStatusContext is QueryStatus, giving up once ctx is done
+func QueryStatusContext(ctx context.Context, server *ServerConfig) StatusReport {
+	report := StatusReport{Source: "query", Time: time.Now()}
+	docker, err := ConnectContext(ctx, server)
+	if err != nil {
+		failed := serverReport(*server, nil)
+		failed.Error = err.Error()
+		report.Servers = append(report.Servers, failed)
+		return report
+	}
+	defer func() {
+		docker.Close()
+		docker.GetClient().Close()
+	}()
+
+	if _, err := docker.InspectServicesContext(ctx); err != nil {
+		failed := serverReport(*server, nil)
+		failed.Error = err.Error()
+		report.Servers = append(report.Servers, failed)
+		return report
+	}
+	report.Servers = append(report.Servers, serverReport(*server, docker))
+	return report
+}
+
+// ControlSocketPath returns where a running monitor answers the ipc package's requests, such
+// as for its status
+func ControlSocketPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "monitor.sock"), nil
+}
+
+// ListenUnix listens on a unix socket at path, replacing one left behind by a monitor that
+// crashed but failing if another monitor still answers on it
+func ListenUnix(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another monitor is already serving %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", path, err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServerReport(t *testing.T) {
+	report := StatusReport{Servers: []ServerReport{
+		serverReport(ServerConfig{Name: "staging", Host: "example.invalid:22", User: "tester"}, fixtureDockerClient()),
+	}}
+
+	server := report.Servers[0]
+	var names []string
+	for _, service := range server.Services {
+		names = append(names, service.Name)
+	}
+	if len(names) != 3 || names[0] != "db" || names[1] != "web" || names[2] != "worker" {
+		t.Errorf("services = %v, want [db web worker]", names)
+	}
+	if port := server.Services[1].Ports[1]; port.Remote != "8080" || port.Local != "18080" || !strings.HasSuffix(port.Address, "localhost:18080") {
+		t.Errorf("web's second port = %+v, want 8080 forwarded to localhost:18080", port)
+	}
+	if server.Services[2].Ports == nil {
+		t.Error("worker's ports are null, want an empty list")
+	}
+	if got := report.Conflicts(); got != 1 {
+		t.Errorf("Conflicts() = %d, want 1", got)
+	}
+	if got := report.Errors(); got != 0 {
+		t.Errorf("Errors() = %d, want 0", got)
+	}
+
+	report.Servers = append(report.Servers, serverReport(ServerConfig{Name: "prod"}, nil))
+	if got := report.Errors(); got != 1 {
+		t.Errorf("Errors() with a disconnected server = %d, want 1", got)
+	}
+}
@@ -0,0 +1,140 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SSH connection states shown in the status bar
+const (
+	SSHConnected    = "connected"
+	SSHReconnecting = "reconnecting" // Connection is up but the last refresh failed; the next poll retries
+	SSHDown         = "down"
+)
+
+// recordFetch notes the outcome of a background service refresh for the status bar.
+// A failure stays in the bar until the next successful refresh rather than being logged.
+func (d *DisplayManager) recordFetch(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		d.fetchErr = err.Error()
+		return
+	}
+	d.fetchErr = ""
+	d.lastUpdate = time.Now()
+}
+
+// sshState reports the connection state of the current server
+func (d *DisplayManager) sshState() string {
+	docker := d.dockerClient()
+	if docker == nil || docker.GetClient() == nil || !docker.GetClient().Connected() {
+		return SSHDown
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.fetchErr != "" {
+		return SSHReconnecting
+	}
+	return SSHConnected
+}
+
+// statusBar renders the single status line shown under every screen
+func (d *DisplayManager) statusBar(now time.Time) string {
+	docker := d.dockerClient()
+	if docker == nil {
+		return "Not connected"
+	}
+
+	server := d.config.CurrentServer
+	if client := docker.GetClient(); client != nil {
+		server = fmt.Sprintf("%s (%s)", server, client.Target())
+	}
+
+	state := d.connectionState(docker.GetClient(), now)
+
+	forwarded, conflicts := 0, 0
+	withPorts, _, _ := docker.GetServicesByPortStatus()
+	for _, service := range d.snapshot(withPorts...) {
+		for _, port := range service.ForwardedPorts {
+			switch port.Status {
+			case StatusForwarded, StatusReady:
+				forwarded++
+			case StatusConflict:
+				conflicts++
+			}
+		}
+	}
+
+	d.mu.RLock()
+	lastUpdate, fetchErr := d.lastUpdate, d.fetchErr
+	d.mu.RUnlock()
+
+	updated := "not updated yet"
+	if !lastUpdate.IsZero() {
+		updated = fmt.Sprintf("updated %s ago", now.Sub(lastUpdate).Truncate(time.Second))
+	}
+
+	parts := []string{
+		server,
+		state,
+		fmt.Sprintf("%d forwarded", forwarded),
+		plural(conflicts, "conflict"),
+		fmt.Sprintf("sorted by %s %s", d.sortOrder(), sortIndicator(d.sortAscending())),
+		updated,
+	}
+	if conflicts > 0 {
+		parts[3] = d.colors.Unhealthy(parts[3])
+	}
+	if resources, _ := d.hostResources(); resources != nil && resources.DiskCritical() {
+		parts = append(parts, d.colors.Unhealthy(fmt.Sprintf("disk %.0f%% full", resources.DiskPercent())))
+	}
+	if fetchErr != "" {
+		parts = append(parts, d.colors.Unhealthy("error: "+fetchErr))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// connectionState describes the SSH connection, with how long it's been up when the tunnel
+// keeps track, e.g. "Connected 2h 15m 33s" or "Reconnecting… (was connected 2h 15m)"
+func (d *DisplayManager) connectionState(client Tunneler, now time.Time) string {
+	state := d.sshState()
+	sshClient, _ := client.(*SSHClient)
+	var uptime time.Duration
+	if sshClient != nil {
+		uptime = sshClient.uptimeAt(now)
+	}
+	switch {
+	case state == SSHConnected && uptime > 0:
+		return d.colors.Healthy("Connected " + formatUptime(uptime))
+	case state == SSHConnected:
+		return d.colors.Healthy("SSH " + state)
+	case state == SSHReconnecting:
+		return d.colors.Warning("SSH " + state)
+	case uptime > 0:
+		return d.colors.Unhealthy(fmt.Sprintf("Reconnecting… (was connected %s)", formatUptimeMinutes(uptime)))
+	}
+	return d.colors.Unhealthy("SSH " + state)
+}
+
+// plural formats a count with its noun, adding an s unless there's exactly one
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// StatusReport describes the connected server for `dockforward-monitor status`
+func (d *DisplayManager) StatusReport() StatusReport {
+	report := StatusReport{Source: "monitor", Time: time.Now()}
+	// Read-locked, so API servers can ask while the display switches servers
+	d.mu.RLock()
+	server, docker := d.config.GetCurrentServer(), d.docker
+	d.mu.RUnlock()
+	if server != nil {
+		report.Servers = append(report.Servers, serverReport(*server, docker))
+	}
+	return report
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatusBar(t *testing.T) {
+	dm, client := newRemapFixture(t)
+
+	if got, want := dm.statusBar(time.Now()), "staging (tester@example.invalid:22) | SSH connected | 2 forwarded | 1 conflict | sorted by name ▲ | not updated yet"; got != want {
+		t.Errorf("before any refresh:\n got %q\nwant %q", got, want)
+	}
+
+	dm.recordFetch(nil)
+	now := dm.lastUpdate.Add(5*time.Second + 300*time.Millisecond)
+	if got, want := dm.statusBar(now), "staging (tester@example.invalid:22) | SSH connected | 2 forwarded | 1 conflict | sorted by name ▲ | updated 5s ago"; got != want {
+		t.Errorf("after a refresh:\n got %q\nwant %q", got, want)
+	}
+
+	// A failed refresh keeps the last good timestamp and shows why it failed
+	dm.recordFetch(errors.New("failed to query Docker API: EOF"))
+	if got, want := dm.statusBar(now), "staging (tester@example.invalid:22) | SSH reconnecting | 2 forwarded | 1 conflict | sorted by name ▲ | updated 5s ago | error: failed to query Docker API: EOF"; got != want {
+		t.Errorf("after a failed refresh:\n got %q\nwant %q", got, want)
+	}
+
+	dm.recordFetch(nil)
+	if got := dm.sshState(); got != SSHConnected {
+		t.Errorf("after recovering, SSH is %s, want %s", got, SSHConnected)
+	}
+
+	// Once the client knows when it connected, the bar shows for how long
+	client.ConnectedAt = now.Add(-(2*time.Hour + 15*time.Minute + 33*time.Second))
+	if got, want := dm.statusBar(now), "staging (tester@example.invalid:22) | Connected 2h 15m 33s | 2 forwarded | 1 conflict | sorted by name ▲ | updated 5s ago"; got != want {
+		t.Errorf("with a connection time:\n got %q\nwant %q", got, want)
+	}
+
+	// A dropped connection keeps how long it lasted while it's re-established
+	client.mu.Lock()
+	client.lost = true
+	client.endedAt = now.Add(-10 * time.Second)
+	client.mu.Unlock()
+	if got, want := dm.statusBar(now.Add(time.Hour)), "staging (tester@example.invalid:22) | Reconnecting… (was connected 2h 15m) | 2 forwarded | 1 conflict | sorted by name ▲ | updated 1h0m5s ago"; got != want {
+		t.Errorf("after the connection dropped:\n got %q\nwant %q", got, want)
+	}
+
+	client.Close()
+	if got := dm.sshState(); got != SSHDown {
+		t.Errorf("after closing, SSH is %s, want %s", got, SSHDown)
+	}
+
+	dm.docker = nil
+	if got, want := dm.statusBar(now), "Not connected"; got != want {
+		t.Errorf("without a server: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// IsSwarmMode reports whether the remote host is a swarm manager. Only managers can list a
+// swarm's services, so a worker node is treated like any other host and its containers listed.
+func (d *DockerClient) IsSwarmMode() (bool, error) {
+	return d.IsSwarmModeContext(context.Background())
+}
+
+// IsSwarmModeContext is IsSwarmMode, giving up once ctx is done
+func (d *DockerClient) IsSwarmModeContext(ctx context.Context) (bool, error) {
+	var info struct {
+		Swarm struct {
+			LocalNodeState   string
+			ControlAvailable bool
+		}
+	}
+	if err := d.apiRequest(ctx, http.MethodGet, "/info", &info); err != nil {
+		return false, fmt.Errorf("failed to get Docker info: %w", err)
+	}
+	return info.Swarm.LocalNodeState == "active" && info.Swarm.ControlAvailable, nil
+}
+
+// DetectSwarm checks once whether the remote host is a swarm manager, so later refreshes
+// list its services instead of containers. If the check fails, containers are listed.
+func (d *DockerClient) DetectSwarm() {
+	d.DetectSwarmContext(context.Background())
+}
+
+// DetectSwarmContext is DetectSwarm, giving up the check once ctx is done
+func (d *DockerClient) DetectSwarmContext(ctx context.Context) {
+	swarm, err := d.IsSwarmModeContext(ctx)
+	if err != nil {
+		logAttrs(LevelWarn, "Failed to detect swarm mode, listing containers", "server", d.server(), "err", err)
+	}
+	if swarm {
+		logAttrs(LevelInfo, "Swarm manager detected, listing swarm services", "server", d.server())
+	}
+	d.swarm.Store(swarm)
+}
+
+// SwarmMode reports whether the client lists swarm services rather than containers
+func (d *DockerClient) SwarmMode() bool {
+	return d.swarm.Load()
+}
+
+// listSwarmServices queries the Docker API for the swarm's services with their task counts,
+// narrowed by filters if given
+func (d *DockerClient) listSwarmServices(ctx context.Context, filters map[string][]string) ([]SwarmService, error) {
+	query := url.Values{"status": {"true"}}
+	if len(filters) > 0 {
+		encoded, err := json.Marshal(filters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode filters: %v", err)
+		}
+		query.Set("filters", string(encoded))
+	}
+
+	logDebug("Listing swarm services", "server", d.server(), "filters", FormatFilters(filters))
+	var services []SwarmService
+	if err := d.apiRequest(ctx, http.MethodGet, "/services?"+query.Encode(), &services); err != nil {
+		return nil, fmt.Errorf("failed to list swarm services: %w", err)
+	}
+	return services, nil
+}
+
+// serviceFromSwarm builds a service from a swarm service without forwarding anything. Its
+// ports are the published ones, which the ingress mode publishes on every node.
+func (d *DockerClient) serviceFromSwarm(swarmService SwarmService) *ServiceStatus {
+	name := swarmService.Spec.Name
+	var published []Port
+	for _, port := range swarmService.Endpoint.Ports {
+		published = append(published, Port{PrivatePort: port.TargetPort, PublicPort: port.PublishedPort, Type: port.Protocol})
+	}
+	ports := d.extractPorts(published)
+
+	// Carry over any remapped local ports from earlier refreshes
+	for i := range ports {
+		ports[i].Local = d.GetPortMapping(name, ports[i].Remote)
+	}
+
+	service := &ServiceStatus{
+		Name:           name,
+		Image:          swarmService.Spec.TaskTemplate.ContainerSpec.Image,
+		ForwardedPorts: ports,
+		HealthStatus:   HealthUnknown,
+		ForwardStatus:  StatusNotForwarded,
+		Created:        swarmService.CreatedAt,
+	}
+	if status := swarmService.ServiceStatus; status != nil {
+		service.HealthStatus = swarmHealth(status.RunningTasks, status.DesiredTasks)
+		service.Replicas = strconv.FormatUint(status.RunningTasks, 10) + "/" + strconv.FormatUint(status.DesiredTasks, 10)
+	}
+	return service
+}
+
+// swarmHealth describes a swarm service by how many of its desired tasks are running
+func swarmHealth(running, desired uint64) string {
+	switch {
+	case desired == 0:
+		return HealthExited
+	case running == 0:
+		return HealthUnhealthy
+	case running < desired:
+		return HealthStarting
+	default:
+		return HealthRunning
+	}
+}
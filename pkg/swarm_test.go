@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSwarmServices(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"Swarm":{"LocalNodeState":"active","ControlAvailable":true}}`)
+	})
+	mux.HandleFunc("GET /services", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("status"); got != "true" {
+			t.Errorf("services listed with status=%q, want task counts", got)
+		}
+		if got := r.URL.Query().Get("filters"); got != `{"label":["tier=web"]}` {
+			t.Errorf("services filters = %q", got)
+		}
+		io.WriteString(w, `[
+			{"ID":"s1","CreatedAt":"2024-05-01T10:00:00Z","Spec":{"Name":"web","TaskTemplate":{"ContainerSpec":{"Image":"nginx:1.27"}}},
+			 "Endpoint":{"Ports":[{"Protocol":"tcp","TargetPort":80,"PublishedPort":8080,"PublishMode":"ingress"},{"Protocol":"tcp","TargetPort":9000}]},
+			 "ServiceStatus":{"RunningTasks":2,"DesiredTasks":3}},
+			{"ID":"s2","Spec":{"Name":"worker"},"ServiceStatus":{"RunningTasks":0,"DesiredTasks":0}}
+		]`)
+	})
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("containers were listed on a swarm manager")
+		io.WriteString(w, `[]`)
+	})
+	d := newTestDockerClient(t, mux)
+	d.SetFilters(map[string][]string{"label": {"tier=web"}})
+
+	d.DetectSwarm()
+	if !d.SwarmMode() {
+		t.Fatal("swarm manager wasn't detected")
+	}
+	services, err := d.InspectServices()
+	if err != nil {
+		t.Fatalf("InspectServices failed: %v", err)
+	}
+
+	web := services["web"]
+	if web == nil {
+		t.Fatalf("services = %v, want web", services)
+	}
+	if web.Image != "nginx:1.27" || web.Replicas != "2/3" || web.HealthStatus != HealthStarting {
+		t.Errorf("web = %+v, want nginx:1.27 starting with 2/3 replicas", web)
+	}
+	if !web.Created.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("web created %v", web.Created)
+	}
+	// Only published ports can be forwarded
+	if len(web.ForwardedPorts) != 1 || web.ForwardedPorts[0].Remote != "8080" {
+		t.Errorf("web ports = %+v, want the published 8080", web.ForwardedPorts)
+	}
+	if worker := services["worker"]; worker == nil || worker.HealthStatus != HealthExited {
+		t.Errorf("worker scaled to zero = %+v, want %s", worker, HealthExited)
+	}
+}
+
+func TestDetectSwarmOnWorker(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"Swarm":{"LocalNodeState":"active","ControlAvailable":false}}`)
+	})
+	d := newTestDockerClient(t, mux)
+
+	d.DetectSwarm()
+	if d.SwarmMode() {
+		t.Error("a worker node, which can't list services, was treated as a manager")
+	}
+}
+
+func TestSwarmHealth(t *testing.T) {
+	for _, tt := range []struct {
+		running, desired uint64
+		want             string
+	}{
+		{3, 3, HealthRunning},
+		{1, 3, HealthStarting},
+		{0, 3, HealthUnhealthy},
+		{0, 0, HealthExited},
+	} {
+		if got := swarmHealth(tt.running, tt.desired); got != tt.want {
+			t.Errorf("swarmHealth(%d, %d) = %s, want %s", tt.running, tt.desired, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package sync
+
+import (
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SizeEntry is a file or directory of a context, with the bytes synced for it
+type SizeEntry struct {
+	Path string // Relative to the context, slash-separated, with a trailing slash for a directory
+	Size int64
+}
+
+// SizeEstimate is roughly what a sync sends when the server has nothing yet
+type SizeEstimate struct {
+	Total   int64
+	Files   int
+	Largest []SizeEntry // The biggest files and directories, largest first, none inside another
+}
+
+// pathRule is an ignoreRule compiled for matching paths locally, the way rsync reads the
+// rule rsyncRule writes
+type pathRule struct {
+	pattern  *regexp.Regexp
+	anchored bool // Matches the whole path from the root rather than its last components
+	dirOnly  bool
+	include  bool
+}
+
+// compileRules compiles rules for matching paths, in the same order
+func compileRules(rules []ignoreRule) []pathRule {
+	compiled := make([]pathRule, 0, len(rules))
+	for _, rule := range rules {
+		pattern := rule.rsyncRule()[2:]
+		compiled = append(compiled, pathRule{
+			pattern:  globRegexp(strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")),
+			anchored: strings.HasPrefix(pattern, "/"),
+			dirOnly:  strings.HasSuffix(pattern, "/"),
+			include:  rule.include,
+		})
+	}
+	return compiled
+}
+
+// globRegexp translates a gitignore glob, where * and ? stay within a path component and
+// ** crosses them, into a regexp matching all of a path
+func globRegexp(glob string) *regexp.Regexp {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end >= 0 {
+				class := glob[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				re.WriteString("[" + class + "]")
+				i += end + 1
+				continue
+			}
+			re.WriteString(`\[`)
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	pattern, err := regexp.Compile(re.String())
+	if err != nil {
+		return regexp.MustCompile(`^` + regexp.QuoteMeta(glob) + `$`)
+	}
+	return pattern
+}
+
+// matches reports whether the rule matches rel, a slash-separated path from the root. An
+// unanchored rule matches its last components, as rsync does.
+func (r pathRule) matches(rel string, dir bool) bool {
+	if r.dirOnly && !dir {
+		return false
+	}
+	if r.anchored {
+		return r.pattern.MatchString(rel)
+	}
+	for {
+		if r.pattern.MatchString(rel) {
+			return true
+		}
+		_, rest, ok := strings.Cut(rel, "/")
+		if !ok {
+			return false
+		}
+		rel = rest
+	}
+}
+
+// excluded reports whether rules leave rel out, the last one matching deciding
+func excluded(rules []pathRule, rel string, dir bool) bool {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(rel, dir) {
+			return !rules[i].include
+		}
+	}
+	return false
+}
+
+// EstimateSize adds up the files a sync of dir would send, leaving out what the common
+// excludes, its ignore files and extraExcludes do, and lists the top largest files and
+// directories. Symlinks count as links.
+func EstimateSize(dir string, extraExcludes []string, top int) (SizeEstimate, error) {
+	rules := compileRules(parseIgnoreRules(ignoreLines(dir, extraExcludes)))
+	var estimate SizeEstimate
+	var entries []SizeEntry
+	dirSizes := map[string]int64{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if excluded(rules, rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		estimate.Total += info.Size()
+		estimate.Files++
+		entries = append(entries, SizeEntry{Path: rel, Size: info.Size()})
+		for parent := filepath.ToSlash(filepath.Dir(rel)); parent != "."; parent = filepath.ToSlash(filepath.Dir(parent)) {
+			dirSizes[parent] += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return estimate, err
+	}
+
+	for path, size := range dirSizes {
+		entries = append(entries, SizeEntry{Path: path + "/", Size: size})
+	}
+	// A directory sorts before what's in it when their sizes tie, so it's picked first
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Size != entries[j].Size {
+			return entries[i].Size > entries[j].Size
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	for _, entry := range entries {
+		if len(estimate.Largest) == top || entry.Size == 0 {
+			break
+		}
+		inside := false
+		for _, picked := range estimate.Largest {
+			if strings.HasSuffix(picked.Path, "/") && strings.HasPrefix(entry.Path, picked.Path) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			estimate.Largest = append(estimate.Largest, entry)
+		}
+	}
+	return estimate, nil
+}
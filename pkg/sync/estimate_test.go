@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]int{
+		"main.go":                   100,
+		"data/train.csv":            5000,
+		"data/test.csv":             1000,
+		"images/vm.qcow2":           8000,
+		"node_modules/left-pad.js":  9000, // Always excluded
+		".terraform/plugin":         9000, // Excluded by .dockforwardignore
+		"docs/drafts/big.pdf":       9000, // Excluded by an anchored rule
+		"build/app.log":             700,  // *.log is excluded
+		"build/keep.log":            300,  // but this one is re-included
+		"src/vendor/.terraform/foo": 9000, // Unanchored rules match at any depth
+	}
+	for name, size := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, IgnoreFileName), []byte(".terraform/\n/docs/drafts\n*.log\n!keep.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	estimate, err := EstimateSize(dir, nil, 3)
+	if err != nil {
+		t.Fatalf("EstimateSize failed: %v", err)
+	}
+	ignoreSize := int64(len(".terraform/\n/docs/drafts\n*.log\n!keep.log\n"))
+	if want := 100 + 5000 + 1000 + 8000 + 300 + ignoreSize; estimate.Total != want || estimate.Files != 6 {
+		t.Errorf("estimate = %d bytes in %d files, want %d in 6", estimate.Total, estimate.Files, want)
+	}
+	// images/ and its only file tie, so the directory is listed and the file isn't
+	want := []SizeEntry{{"images/", 8000}, {"data/", 6000}, {"build/", 300}}
+	if !reflect.DeepEqual(estimate.Largest, want) {
+		t.Errorf("largest = %+v, want %+v", estimate.Largest, want)
+	}
+
+	// Extra excludes apply too
+	if estimate, err := EstimateSize(dir, []string{"images/"}, 1); err != nil || estimate.Total != 100+6000+300+ignoreSize || len(estimate.Largest) != 1 {
+		t.Errorf("with extra excludes, estimate = %+v, %v", estimate, err)
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"*.log", "app.log", true},
+		{"*.log", "logs/app.log", false},
+		{"**/cache", "a/b/cache", true},
+		{"**/cache", "cache", true},
+		{"docs/**", "docs/a/b.md", true},
+		{"file?.txt", "file1.txt", true},
+		{"[!a]*", "abc", false},
+		{"[ab]*", "bcd", true},
+		{"a.b", "axb", false},
+	}
+	for _, tt := range tests {
+		if got := globRegexp(tt.glob).MatchString(tt.path); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,580 @@
+// Package sync copies the docker wrapper's build context to the server, where the remote
+// docker command runs in it, and removes contexts old builds left behind.
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	dockforward "dockforward/pkg"
+)
+
+// ContextDirPrefix starts the name of each per-project context directory on the server,
+// which Cleanup removes once they're a day old
+const ContextDirPrefix = "/tmp/docker-context-"
+
+// SyncOptions says what to sync where
+type SyncOptions struct {
+	LocalDir      string                    // Directory synced, leaving out what its ignore files exclude
+	RemoteDir     string                    // Directory on the server it's mirrored to, created if needed
+	ExtraExcludes []string                  // Patterns excluded over the ignore files, such as a project's extra_excludes
+	BwLimit       string                    // Bandwidth cap such as "500K", in KiB per second without a suffix; empty for none
+	CompressLevel *int                      // Compression level from 0, which turns it off, to 9; nil for rsync's default
+	Symlinks      dockforward.SymlinkPolicy // How symlinks are copied, preserved if empty
+	Verify        bool                      // Compare the server's copy by checksum afterwards
+	Verbose       bool                      // Have rsync explain what it does with -vv
+	Timeout       time.Duration             // Limit on each try of each step, none if 0
+	Retries       int                       // How often creating the directory or rsync is retried
+}
+
+// SyncResult describes a finished sync
+type SyncResult struct {
+	RemoteDir string
+	Output    string // What rsync printed, listing the files it sent
+	Duration  time.Duration
+	BytesSent int64 // Bytes sent over the connection, after compression
+	// DanglingLinks are preserved symlinks that don't resolve on the server, relative to RemoteDir
+	DanglingLinks []string
+}
+
+// Throughput returns the bytes sent per second, 0 if it isn't known
+func (r SyncResult) Throughput() float64 {
+	if r.BytesSent == 0 || r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.BytesSent) / r.Duration.Seconds()
+}
+
+// sentPattern matches the summary rsync -v ends with, e.g. "sent 1,234 bytes  received 56 bytes"
+var sentPattern = regexp.MustCompile(`(?m)^sent ([0-9,.]+) bytes`)
+
+// bytesSent reads how many bytes rsync sent from its summary, 0 if there isn't one
+func bytesSent(output string) int64 {
+	match := sentPattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0
+	}
+	sent, _ := strconv.ParseInt(strings.NewReplacer(",", "", ".", "").Replace(match[1]), 10, 64)
+	return sent
+}
+
+// Syncer mirrors local build contexts onto a server
+type Syncer interface {
+	// Sync mirrors opts.LocalDir to opts.RemoteDir, stopping once ctx is done
+	Sync(ctx context.Context, opts SyncOptions) (SyncResult, error)
+	// Cleanup removes context directories older than a day
+	Cleanup(ctx context.Context) error
+}
+
+// RsyncSyncer syncs over rsync and ssh
+type RsyncSyncer struct {
+	target     string   // user@host
+	sshOptions []string // Extra options for every ssh invocation, such as -i for a key
+}
+
+var _ Syncer = (*RsyncSyncer)(nil)
+
+// NewRsyncSyncer creates a syncer for user@host, passing sshOptions to ssh
+func NewRsyncSyncer(user, host string, sshOptions []string) *RsyncSyncer {
+	return &RsyncSyncer{target: fmt.Sprintf("%s@%s", user, host), sshOptions: sshOptions}
+}
+
+// Sync creates the remote directory, then mirrors the local one into it with rsync,
+// deleting remote files that no longer exist locally
+func (s *RsyncSyncer) Sync(ctx context.Context, opts SyncOptions) (SyncResult, error) {
+	start := time.Now()
+	result := SyncResult{RemoteDir: opts.RemoteDir}
+	policy, err := dockforward.ParseSymlinkPolicy(string(opts.Symlinks))
+	if err != nil {
+		return result, err
+	}
+	if policy == dockforward.SymlinkFollow {
+		// rsync -L would otherwise copy a loop until paths grow too long
+		if loop, err := FindSymlinkLoop(opts.LocalDir, opts.ExtraExcludes); err != nil {
+			return result, fmt.Errorf("failed to check symlinks: %v", err)
+		} else if loop != "" {
+			return result, fmt.Errorf("can't follow symlinks: %s leads back into a directory that contains it", loop)
+		}
+	}
+
+	err = attempt(ctx, opts, "creating the remote directory", func(ctx context.Context) error {
+		output, err := s.sshCommand(ctx, s.target, "mkdir", "-p", dockforward.ShellQuote(opts.RemoteDir)).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to create remote directory: %w", dockforward.ClassifySSHError(err, string(output)))
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// Create exclude file from the ignore files and extra excludes
+	excludeFile, err := CreateExcludeFile(opts.LocalDir, opts.ExtraExcludes)
+	if err != nil {
+		return result, fmt.Errorf("failed to create exclude file: %v", err)
+	}
+	defer os.Remove(excludeFile)
+
+	verbosity := "-v" // lists the files sent
+	if opts.Verbose {
+		verbosity = "-vv" // also says why files are skipped
+	}
+	rsyncArgs := append(s.rsyncArgs(opts, policy, excludeFile),
+		verbosity,
+		fmt.Sprintf("%s/", opts.LocalDir), // source with trailing slash
+		fmt.Sprintf("%s:%s/", s.target, opts.RemoteDir), // destination
+	)
+	// rsync only sends what's still missing, so a retry picks up where a failed run stopped
+	err = attempt(ctx, opts, "rsync", func(ctx context.Context) error {
+		output, err := exec.CommandContext(ctx, "rsync", rsyncArgs...).CombinedOutput()
+		result.Output = string(output)
+		result.BytesSent = bytesSent(result.Output)
+		if err == nil {
+			return nil
+		}
+		// File I/O and stream errors are what a full disk on the server looks like
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && (exitErr.ExitCode() == 11 || exitErr.ExitCode() == 12) {
+			if full, usage := s.remoteFull(ctx, opts.RemoteDir, result.Output); full {
+				return fmt.Errorf("rsync failed: %w: %s\nOutput: %s", dockforward.ErrRemoteDiskFull, usage, result.Output)
+			}
+		}
+		// rsync passes on ssh's exit status when its remote shell fails
+		return fmt.Errorf("rsync failed: %w\nOutput: %s", dockforward.ClassifySSHError(err, result.Output), result.Output)
+	})
+	result.Duration = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+
+	if opts.Verify {
+		verifyCtx, cancel := withTimeout(ctx, opts.Timeout)
+		err := s.verify(verifyCtx, opts, policy, excludeFile)
+		cancel()
+		if err != nil {
+			return result, timedOut(ctx, verifyCtx, err, "verifying the sync", opts.Timeout)
+		}
+	}
+
+	if policy == dockforward.SymlinkPreserve {
+		// Links into the home directory or elsewhere outside the project break remotely
+		dangling, err := s.danglingLinks(ctx, opts.RemoteDir)
+		if err != nil {
+			slog.Debug("Failed to check for dangling symlinks", "dir", opts.RemoteDir, "err", err)
+		}
+		result.DanglingLinks = dangling
+	}
+	return result, nil
+}
+
+// retryDelay is how long attempt waits before its first retry, doubling after that
+var retryDelay = 2 * time.Second
+
+// attempt runs step with opts.Timeout for each try, retrying it up to opts.Retries times
+// with a growing, jittered delay. Authentication failures, a full disk and a mismatch
+// aren't retried, since another try fails the same way.
+func attempt(ctx context.Context, opts SyncOptions, phase string, step func(context.Context) error) error {
+	wait := retryDelay
+	for try := 0; ; try++ {
+		stepCtx, cancel := withTimeout(ctx, opts.Timeout)
+		err := timedOut(ctx, stepCtx, step(stepCtx), phase, opts.Timeout)
+		cancel()
+		if err == nil || try >= opts.Retries || ctx.Err() != nil ||
+			errors.Is(err, dockforward.ErrAuthFailed) ||
+			errors.Is(err, dockforward.ErrRemoteDiskFull) ||
+			errors.Is(err, dockforward.ErrSyncMismatch) {
+			return err
+		}
+		delay := wait/2 + rand.N(wait/2+1)
+		slog.Warn("Retrying", "step", phase, "try", try+2, "of", opts.Retries+1, "in", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		wait *= 2
+	}
+}
+
+// withTimeout limits ctx to timeout, or just makes it cancelable if timeout is 0
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timedOut replaces err with one naming phase if it failed because stepCtx, limited to
+// timeout, ran out of time while its parent ctx hadn't
+func timedOut(ctx, stepCtx context.Context, err error, phase string, timeout time.Duration) error {
+	if err == nil || ctx.Err() != nil || !errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%s timed out after %s: %w", phase, timeout, context.DeadlineExceeded)
+}
+
+// rsyncArgs returns the rsync options for syncing as opts says, leaving out the source and
+// destination
+func (s *RsyncSyncer) rsyncArgs(opts SyncOptions, policy dockforward.SymlinkPolicy, excludeFile string) []string {
+	// Symlinks are copied as links with -l, replaced by what they point to with -L, or
+	// skipped without either
+	links := map[dockforward.SymlinkPolicy]string{
+		dockforward.SymlinkPreserve: "l",
+		dockforward.SymlinkFollow:   "L",
+	}[policy]
+	args := []string{
+		"-r" + links + "ptDz",                        // no -a, explicit flags instead
+		"--chmod=Du=rwx,Dg=rx,Do=rx,Fu=rw,Fg=r,Fo=r", // explicit permissions
+		"--delete",                    // delete extraneous files
+		"--exclude-from", excludeFile, // use the rules from exclude file, first match wins
+		"-e", RemoteShell(s.sshOptions),
+	}
+	if opts.CompressLevel != nil {
+		if *opts.CompressLevel == 0 {
+			args[0] = strings.TrimSuffix(args[0], "z") // no compression at all
+		} else {
+			args = append(args, fmt.Sprintf("--compress-level=%d", *opts.CompressLevel))
+		}
+	}
+	if opts.BwLimit != "" {
+		args = append(args, "--bwlimit="+opts.BwLimit)
+	}
+	return args
+}
+
+// maxListedPaths caps how many differing paths a failed verification lists
+const maxListedPaths = 10
+
+// verify compares the server's copy with the local directory by checksum, with a dry run
+// of the same sync, and fails listing the paths that would change
+func (s *RsyncSyncer) verify(ctx context.Context, opts SyncOptions, policy dockforward.SymlinkPolicy, excludeFile string) error {
+	args := append(s.rsyncArgs(opts, policy, excludeFile),
+		"--checksum", "--dry-run", "--itemize-changes",
+		fmt.Sprintf("%s/", opts.LocalDir),
+		fmt.Sprintf("%s:%s/", s.target, opts.RemoteDir),
+	)
+	output, err := exec.CommandContext(ctx, "rsync", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to verify the sync: %w\nOutput: %s", dockforward.ClassifySSHError(err, string(output)), string(output))
+	}
+	differ := changedPaths(string(output))
+	if len(differ) == 0 {
+		return nil
+	}
+	listed := differ[:min(len(differ), maxListedPaths)]
+	more := ""
+	if len(differ) > len(listed) {
+		more = fmt.Sprintf(" and %d more", len(differ)-len(listed))
+	}
+	return fmt.Errorf("%w: %d paths differ on the server: %s%s", dockforward.ErrSyncMismatch, len(differ), strings.Join(listed, ", "), more)
+}
+
+// changedPaths reads the paths rsync --itemize-changes would transfer or delete. Lines for
+// attribute changes only, starting with a dot, don't count, since the contents match.
+func changedPaths(output string) []string {
+	var paths []string
+	for _, line := range strings.Split(output, "\n") {
+		if path, ok := strings.CutPrefix(line, "*deleting"); ok {
+			paths = append(paths, strings.TrimSpace(path))
+			continue
+		}
+		// Itemized changes are an 11 character summary, a space and the path
+		if len(line) < 13 || line[11] != ' ' || !strings.ContainsRune("<>ch", rune(line[0])) {
+			continue
+		}
+		paths = append(paths, line[12:])
+	}
+	return paths
+}
+
+// remoteFull reports whether the filesystem holding remoteDir on the server is full, going
+// by rsync's output and df, with df's account of its usage
+func (s *RsyncSyncer) remoteFull(ctx context.Context, remoteDir, output string) (bool, string) {
+	full := strings.Contains(output, "No space left on device")
+	usage := "no space left on device"
+	df, err := s.sshCommand(ctx, s.target, "df", "-Pk", dockforward.ShellQuote(remoteDir)).Output()
+	if err != nil {
+		return full, usage
+	}
+	// Filesystem, 1024-blocks, Used, Available, Capacity, Mounted on
+	lines := strings.Split(strings.TrimSpace(string(df)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 6 {
+		return full, usage
+	}
+	available, _ := strconv.ParseInt(fields[3], 10, 64)
+	if available == 0 || fields[4] == "100%" {
+		full = true
+	}
+	return full, fmt.Sprintf("%s on %s has %d KiB free (%s used)", fields[0], fields[5], available, fields[4])
+}
+
+// danglingLinks lists the symlinks in remoteDir on the server that don't resolve
+func (s *RsyncSyncer) danglingLinks(ctx context.Context, remoteDir string) ([]string, error) {
+	find := fmt.Sprintf("cd %s && find . -type l ! -exec test -e {} \\; -print", dockforward.ShellQuote(remoteDir))
+	output, err := s.sshCommand(ctx, s.target, find).Output()
+	if err != nil {
+		return nil, dockforward.ClassifySSHError(err, "")
+	}
+	var links []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			links = append(links, strings.TrimPrefix(line, "./"))
+		}
+	}
+	sort.Strings(links)
+	return links, nil
+}
+
+// FindSymlinkLoop walks dir following symlinks, as rsync -L copies it, and returns the first
+// link found that leads to a directory it's inside, relative to dir, or "" if there's none.
+// Directories the common excludes, dir's ignore files or extraExcludes leave out by name,
+// such as node_modules/, aren't walked.
+func FindSymlinkLoop(dir string, extraExcludes []string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	excluded := excludedNames(dir, extraExcludes)
+
+	// chain holds the real directories being walked, from root down
+	chain := map[string]bool{}
+	var walk func(real, rel string) (string, error)
+	walk = func(real, rel string) (string, error) {
+		chain[real] = true
+		defer delete(chain, real)
+		entries, err := os.ReadDir(real)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			path, relPath := filepath.Join(real, entry.Name()), filepath.Join(rel, entry.Name())
+			switch {
+			case entry.Type()&os.ModeSymlink != 0:
+				target, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					continue // Dangling, which rsync reports itself
+				}
+				if info, err := os.Stat(target); err != nil || !info.IsDir() {
+					continue
+				}
+				if chain[target] {
+					return relPath, nil
+				}
+				if loop, err := walk(target, relPath); loop != "" || err != nil {
+					return loop, err
+				}
+			case entry.IsDir() && !excluded(entry.Name()):
+				if loop, err := walk(path, relPath); loop != "" || err != nil {
+					return loop, err
+				}
+			}
+		}
+		return "", nil
+	}
+	return walk(root, "")
+}
+
+// excludedNames returns whether a directory name is excluded by the single name patterns,
+// such as node_modules/ or *.cache, among the common excludes, dir's ignore files and
+// extraExcludes. Patterns with a path are ignored.
+func excludedNames(dir string, extraExcludes []string) func(name string) bool {
+	rules := parseIgnoreRules(ignoreLines(dir, extraExcludes))
+	return func(name string) bool {
+		excluded := false
+		for _, rule := range rules {
+			pattern := strings.TrimSuffix(rule.pattern, "/")
+			if strings.Contains(pattern, "/") {
+				continue
+			}
+			if matched, _ := filepath.Match(pattern, name); matched {
+				excluded = !rule.include
+			}
+		}
+		return excluded
+	}
+}
+
+// Cleanup removes the per-project context directories older than a day
+func (s *RsyncSyncer) Cleanup(ctx context.Context) error {
+	// Only look in our specific context directory path
+	dir, prefix := filepath.Split(ContextDirPrefix)
+	cleanupCmd := fmt.Sprintf("cd %s && find . -maxdepth 1 -type d -name '%s*' -mtime +1 -exec rm -rf {} \\;", dir, prefix)
+	cmd := s.sshCommand(ctx, s.target, cleanupCmd)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cleanup failed: %w\nOutput: %s", dockforward.ClassifySSHError(err, string(output)), string(output))
+	}
+	return nil
+}
+
+// sshCommand builds an ssh invocation with the syncer's options, sending ssh SIGTERM once
+// ctx is done so it can close the session and let the remote command hang up
+func (s *RsyncSyncer) sshCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "ssh", append(append([]string{}, s.sshOptions...), args...)...)
+	slog.Debug("Running ssh", "args", strings.Join(cmd.Args[1:], " "))
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	// Kill ssh if it doesn't exit after SIGTERM
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
+// RemoteShell returns the remote shell command rsync should use, passing sshOptions to ssh
+func RemoteShell(sshOptions []string) string {
+	shell := []string{"ssh"}
+	for _, option := range sshOptions {
+		shell = append(shell, fmt.Sprintf("%q", option))
+	}
+	return strings.Join(shell, " ")
+}
+
+// ProjectHash generates a stable hash based on the absolute path of dir
+func ProjectHash(dir string) (string, error) {
+	absPath, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	// Create a stable hash of the absolute path
+	hash := sha256.New()
+	io.WriteString(hash, absPath)
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// ContextDir returns the per-project context directory on the server for localDir
+func ContextDir(localDir string) (string, error) {
+	hash, err := ProjectHash(localDir)
+	if err != nil {
+		return "", err
+	}
+	return ContextDirPrefix + hash[:12], nil
+}
+
+// IgnoreFileName is the project's own ignore file, for rules only syncing needs, which take
+// precedence over .gitignore and .dockerignore
+const IgnoreFileName = ".dockforwardignore"
+
+// ignoreFiles are read from the project root in increasing order of precedence
+var ignoreFiles = []string{".gitignore", ".dockerignore", IgnoreFileName}
+
+// ignoreRule is one gitignore-style pattern, excluding what it matches or, negated with a
+// leading !, re-including what an earlier rule excluded
+type ignoreRule struct {
+	pattern string
+	include bool
+}
+
+// parseIgnoreRules reads gitignore-style lines, skipping blank ones and # comments. A
+// leading backslash escapes a pattern starting with # or !.
+func parseIgnoreRules(lines []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if pattern, ok := strings.CutPrefix(line, "!"); ok {
+			rule.include, line = true, pattern
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if rule.pattern = line; rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// rsyncRule translates the rule into an rsync filter rule. A pattern with a slash before
+// its end only matches from the project root in gitignore, so it's anchored with a leading
+// slash, which rsync reads the same way.
+func (r ignoreRule) rsyncRule() string {
+	pattern := r.pattern
+	if !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "**/") &&
+		strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+		pattern = "/" + pattern
+	}
+	if r.include {
+		return "+ " + pattern
+	}
+	return "- " + pattern
+}
+
+// ignoreLines returns the common excludes, then the lines of dir's ignore files, then
+// extraExcludes, in increasing order of precedence
+func ignoreLines(dir string, extraExcludes []string) []string {
+	// Common patterns to always exclude, unless a project re-includes them
+	lines := []string{
+		".git/",
+		".env",
+		"node_modules/",
+		dockforward.ProjectDirName + "/",
+	}
+	for _, name := range ignoreFiles {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			lines = append(lines, strings.Split(string(data), "\n")...)
+		}
+	}
+	return append(lines, extraExcludes...)
+}
+
+// CreateExcludeFile creates a temporary rsync filter file from the exclusion patterns in
+// dir's .gitignore, .dockerignore and .dockforwardignore, then extraExcludes, each taking
+// precedence over the ones before as later gitignore rules do. rsync uses the first rule
+// that matches, so they're written last first. The caller removes the file.
+func CreateExcludeFile(dir string, extraExcludes []string) (string, error) {
+	rules := parseIgnoreRules(ignoreLines(dir, extraExcludes))
+
+	tmpfile, err := os.CreateTemp("", "exclude")
+	if err != nil {
+		return "", err
+	}
+	for i := len(rules) - 1; i >= 0; i-- {
+		fmt.Fprintln(tmpfile, rules[i].rsyncRule())
+	}
+	if err := tmpfile.Close(); err != nil {
+		os.Remove(tmpfile.Name())
+		return "", err
+	}
+	return tmpfile.Name(), nil
+}
+
+// MockSyncer is a Syncer for tests that records what it's asked to do instead of syncing.
+// It's safe for concurrent syncs.
+type MockSyncer struct {
+	Syncs    []SyncOptions // Each Sync's options, in order
+	Cleanups int
+	Err      error // Returned by every call if set
+	mu       sync.Mutex
+}
+
+var _ Syncer = (*MockSyncer)(nil)
+
+func (m *MockSyncer) Sync(ctx context.Context, opts SyncOptions) (SyncResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Syncs = append(m.Syncs, opts)
+	return SyncResult{RemoteDir: opts.RemoteDir}, m.Err
+}
+
+func (m *MockSyncer) Cleanup(ctx context.Context) error {
+	m.Cleanups++
+	return m.Err
+}
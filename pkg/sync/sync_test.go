@@ -0,0 +1,399 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dockforward "dockforward/pkg"
+)
+
+func TestCreateExcludeFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".gitignore":    "# build output\ndist/\n*.log\n",
+		".dockerignore": "docs/drafts\n\\#notes\n",
+		IgnoreFileName:  "!dist/\nfixtures/\n!keep.log  \n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name, err := CreateExcludeFile(dir, []string{"!.env", "/tmp"})
+	if err != nil {
+		t.Fatalf("CreateExcludeFile failed: %v", err)
+	}
+	defer os.Remove(name)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rsync takes the first rule matching, so later sources and lines come first
+	want := strings.Join([]string{
+		"- /tmp",
+		"+ .env",
+		"+ keep.log",
+		"- fixtures/",
+		"+ dist/",
+		"- #notes",
+		"- /docs/drafts",
+		"- *.log",
+		"- dist/",
+		"- .dockforward/",
+		"- node_modules/",
+		"- .env",
+		"- .git/",
+	}, "\n") + "\n"
+	if got := string(data); got != want {
+		t.Errorf("exclude file =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestContextDir(t *testing.T) {
+	dir := t.TempDir()
+	first, err := ContextDir(dir)
+	if err != nil {
+		t.Fatalf("ContextDir failed: %v", err)
+	}
+	if !strings.HasPrefix(first, ContextDirPrefix) || len(first) != len(ContextDirPrefix)+12 {
+		t.Errorf("ContextDir = %q, want %s and 12 hex digits", first, ContextDirPrefix)
+	}
+	if again, _ := ContextDir(dir + "/."); again != first {
+		t.Errorf("ContextDir changed with the path's spelling: %q, then %q", first, again)
+	}
+	if other, _ := ContextDir(t.TempDir()); other == first {
+		t.Errorf("two projects share %q", first)
+	}
+}
+
+// stubTools puts stand-ins for ssh and rsync on PATH, which run everything on this machine
+func stubTools(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	scripts := map[string]string{
+		// Runs the remote command locally, joining the arguments after user@host as ssh does
+		"ssh": "#!/bin/sh\nuntil case \"$1\" in *@*) true ;; *) false ;; esac; do shift; done\nshift\nexec sh -c \"$*\"\n",
+		// Mirrors the source into the destination, dropping the host. A dry run prints
+		// $STUB_RSYNC_DIFF instead, and $STUB_RSYNC_FAIL fails it with an I/O error.
+		// $STUB_RSYNC_FLAKY names a file the first run creates, failing with a timeout,
+		// and $STUB_RSYNC_SLEEP hangs it for that many seconds.
+		"rsync": `#!/bin/sh
+case " $* " in *" --dry-run "*) printf '%b' "$STUB_RSYNC_DIFF"; exit 0 ;; esac
+if [ -n "$STUB_RSYNC_FAIL" ]; then echo "$STUB_RSYNC_FAIL" >&2; exit 11; fi
+if [ -n "$STUB_RSYNC_FLAKY" ] && [ ! -e "$STUB_RSYNC_FLAKY" ]; then touch "$STUB_RSYNC_FLAKY"; echo "connection reset" >&2; exit 30; fi
+if [ -n "$STUB_RSYNC_SLEEP" ]; then exec sleep "$STUB_RSYNC_SLEEP"; fi
+for last; do :; done
+n=0; for arg; do n=$((n+1)); eval "a$n=\$arg"; done
+eval "src=\$a$((n-1))"
+dest=${last#*@*:}
+rm -rf "$dest" && mkdir -p "$dest" && cp -Rp "$src." "$dest" && echo "sent $src"
+echo "rsync $*"
+echo "sent 1,234 bytes  received 35 bytes  2,538.00 bytes/sec"
+`,
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRsyncSyncer(t *testing.T) {
+	stubTools(t)
+	local, remote := t.TempDir(), filepath.Join(t.TempDir(), "context")
+	if err := os.WriteFile(filepath.Join(local, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	syncer := NewRsyncSyncer("deploy", "example.invalid", []string{"-i", "/keys/deploy"})
+	result, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.RemoteDir != remote || !strings.Contains(result.Output, "sent "+local) {
+		t.Errorf("Sync = %+v", result)
+	}
+	if data, err := os.ReadFile(filepath.Join(remote, "Dockerfile")); err != nil || string(data) != "FROM scratch\n" {
+		t.Errorf("synced Dockerfile = %q, %v", data, err)
+	}
+	if result.BytesSent != 1234 || result.Throughput() <= 0 {
+		t.Errorf("sent %d bytes at %f bytes/s, want 1234 at some rate", result.BytesSent, result.Throughput())
+	}
+	if !strings.Contains(result.Output, " -v ") || strings.Contains(result.Output, "-vv") {
+		t.Errorf("rsync isn't run with -v:\n%s", result.Output)
+	}
+	if result, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote, Verbose: true}); err != nil || !strings.Contains(result.Output, " -vv ") {
+		t.Errorf("verbose Sync = %v, want rsync run with -vv:\n%s", err, result.Output)
+	}
+	if strings.Contains(result.Output, "--bwlimit") || strings.Contains(result.Output, "--compress-level") {
+		t.Errorf("rsync throttled without settings:\n%s", result.Output)
+	}
+
+	level := 3
+	result, err = syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote, BwLimit: "500K", CompressLevel: &level})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !strings.Contains(result.Output, "-rlptDz") || !strings.Contains(result.Output, "--compress-level=3") || !strings.Contains(result.Output, "--bwlimit=500K") {
+		t.Errorf("rsync isn't throttled and compressed at level 3:\n%s", result.Output)
+	}
+
+	level = 0
+	result, err = syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote, CompressLevel: &level})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !strings.Contains(result.Output, "rsync -rlptD ") || strings.Contains(result.Output, "--compress-level") {
+		t.Errorf("rsync compresses at level 0:\n%s", result.Output)
+	}
+}
+
+func TestSyncSymlinks(t *testing.T) {
+	stubTools(t)
+	parent := t.TempDir()
+	local, remote := filepath.Join(parent, "project"), filepath.Join(t.TempDir(), "context")
+	if err := os.Mkdir(local, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "shared.conf"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Resolves locally, but not once synced elsewhere
+	if err := os.Symlink("../shared.conf", filepath.Join(local, "shared.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	syncer := NewRsyncSyncer("deploy", "example.invalid", nil)
+	result, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.DanglingLinks, []string{"shared.conf"}) {
+		t.Errorf("dangling links = %q, want [shared.conf]", result.DanglingLinks)
+	}
+
+	for policy, flags := range map[dockforward.SymlinkPolicy]string{dockforward.SymlinkFollow: "-rLptDz", dockforward.SymlinkSkip: "-rptDz"} {
+		result, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote, Symlinks: policy})
+		if err != nil {
+			t.Fatalf("Sync with %s failed: %v", policy, err)
+		}
+		if !strings.Contains(result.Output, "rsync "+flags+" ") || result.DanglingLinks != nil {
+			t.Errorf("Sync with %s = %+v, want %s and no check for dangling links", policy, result, flags)
+		}
+	}
+
+	// Following a link back to the project would never finish
+	if err := os.Symlink("..", filepath.Join(local, "up")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote, Symlinks: dockforward.SymlinkFollow}); err == nil || !strings.Contains(err.Error(), "up leads back") {
+		t.Errorf("Sync following a loop = %v, want it refused", err)
+	}
+	if _, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote, Symlinks: "copy"}); err == nil {
+		t.Error("Sync accepted an unknown symlink policy")
+	}
+}
+
+func TestFindSymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"src/app", "vendor", "node_modules/pkg"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink := func(target, link string) {
+		t.Helper()
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink("../../vendor", "src/app/vendor")
+	symlink("missing", "src/dangling")
+	// node_modules/ is excluded, so its loop is never followed
+	symlink("..", "node_modules/pkg/parent")
+
+	if loop, err := FindSymlinkLoop(dir, nil); err != nil || loop != "" {
+		t.Errorf("FindSymlinkLoop = %q, %v; want no loop", loop, err)
+	}
+	if loop, err := FindSymlinkLoop(dir, []string{"!node_modules/"}); err != nil || loop != filepath.Join("node_modules", "pkg", "parent") {
+		t.Errorf("FindSymlinkLoop with node_modules = %q, %v; want its loop", loop, err)
+	}
+
+	// Two links that lead into each other's directories
+	symlink("../src", "vendor/src")
+	if loop, err := FindSymlinkLoop(dir, nil); err != nil || loop == "" {
+		t.Errorf("FindSymlinkLoop = %q, %v; want the loop through vendor", loop, err)
+	}
+}
+
+func TestSyncVerify(t *testing.T) {
+	stubTools(t)
+	local, remote := t.TempDir(), filepath.Join(t.TempDir(), "context")
+	syncer := NewRsyncSyncer("deploy", "example.invalid", nil)
+	opts := SyncOptions{LocalDir: local, RemoteDir: remote, Verify: true}
+
+	if _, err := syncer.Sync(context.Background(), opts); err != nil {
+		t.Errorf("Sync of a matching copy failed: %v", err)
+	}
+	// Only a directory's time differs, so the contents match
+	t.Setenv("STUB_RSYNC_DIFF", ".d..t...... ./\n")
+	if _, err := syncer.Sync(context.Background(), opts); err != nil {
+		t.Errorf("Sync with only a time differing failed: %v", err)
+	}
+
+	t.Setenv("STUB_RSYNC_DIFF", ">fcst...... src/main.go\n>f+++++++++ src/new.go\n*deleting   stale.txt\n")
+	_, err := syncer.Sync(context.Background(), opts)
+	if !errors.Is(err, dockforward.ErrSyncMismatch) || !strings.Contains(err.Error(), "3 paths differ on the server: src/main.go, src/new.go, stale.txt") {
+		t.Errorf("Sync of a partial copy = %v, want the paths that differ", err)
+	}
+	opts.Verify = false
+	if _, err := syncer.Sync(context.Background(), opts); err != nil {
+		t.Errorf("Sync without verifying failed: %v", err)
+	}
+}
+
+func TestDanglingLinksQuotesRemoteDir(t *testing.T) {
+	stubTools(t)
+	pwned := filepath.Join(t.TempDir(), "pwned")
+	t.Setenv("PWNED", pwned)
+	remote := filepath.Join(t.TempDir(), `my app $(touch "$PWNED")`)
+	if err := os.Mkdir(remote, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../missing.conf", filepath.Join(remote, "app.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	syncer := NewRsyncSyncer("deploy", "example.invalid", nil)
+	links, err := syncer.danglingLinks(context.Background(), remote)
+	if err != nil || !reflect.DeepEqual(links, []string{"app.conf"}) {
+		t.Errorf("danglingLinks = %q, %v, want [app.conf]", links, err)
+	}
+	if _, err := os.Stat(pwned); err == nil {
+		t.Error("the remote directory's name ran as a command")
+	}
+}
+
+func TestSyncRemoteDiskFull(t *testing.T) {
+	stubTools(t)
+	local, remote := t.TempDir(), t.TempDir()
+	syncer := NewRsyncSyncer("deploy", "example.invalid", nil)
+
+	t.Setenv("STUB_RSYNC_FAIL", `rsync: [receiver] write failed on "/tmp/docker-context-1/app.tar": No space left on device (28)`)
+	_, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote})
+	if !errors.Is(err, dockforward.ErrRemoteDiskFull) || !strings.Contains(err.Error(), "KiB free") {
+		t.Errorf("Sync to a full disk = %v, want ErrRemoteDiskFull with df's account", err)
+	}
+
+	// Other I/O errors, with room to spare, aren't blamed on the disk
+	t.Setenv("STUB_RSYNC_FAIL", "rsync: read errors mapping")
+	if _, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote}); err == nil || errors.Is(err, dockforward.ErrRemoteDiskFull) {
+		t.Errorf("Sync with a read error = %v, want a plain failure", err)
+	}
+}
+
+func TestRemoteFullQuotesRemoteDir(t *testing.T) {
+	stubTools(t)
+	pwned := filepath.Join(t.TempDir(), "pwned")
+	t.Setenv("PWNED", pwned)
+	remote := filepath.Join(t.TempDir(), `my app $(touch "$PWNED")`)
+	if err := os.Mkdir(remote, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	syncer := NewRsyncSyncer("deploy", "example.invalid", nil)
+	if _, usage := syncer.remoteFull(context.Background(), remote, ""); !strings.Contains(usage, "KiB free") {
+		t.Errorf("remoteFull's usage = %q, want df's account of the directory", usage)
+	}
+	if _, err := os.Stat(pwned); err == nil {
+		t.Error("the remote directory's name ran as a command")
+	}
+}
+
+func TestBytesSent(t *testing.T) {
+	tests := []struct {
+		output string
+		want   int64
+	}{
+		{"sending incremental file list\nDockerfile\n\nsent 1,234 bytes  received 35 bytes  2,538.00 bytes/sec\ntotal size is 13", 1234},
+		{"sent 98765 bytes  received 35 bytes  1000.00 bytes/sec", 98765},
+		{"sent 1.234.567 bytes  received 35 bytes", 1234567},
+		{"rsync: connection unexpectedly closed", 0},
+	}
+	for _, tt := range tests {
+		if got := bytesSent(tt.output); got != tt.want {
+			t.Errorf("bytesSent(%q) = %d, want %d", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteShell(t *testing.T) {
+	if got := RemoteShell(nil); got != "ssh" {
+		t.Errorf("RemoteShell(nil) = %q", got)
+	}
+	if got, want := RemoteShell([]string{"-i", "/keys/my key"}), `ssh "-i" "/keys/my key"`; got != want {
+		t.Errorf("RemoteShell = %q, want %q", got, want)
+	}
+}
+
+func TestRsyncSyncerRetries(t *testing.T) {
+	stubTools(t)
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = time.Millisecond
+	local, remote := t.TempDir(), filepath.Join(t.TempDir(), "context")
+	if err := os.WriteFile(filepath.Join(local, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	syncer := NewRsyncSyncer("deploy", "example.invalid", nil)
+
+	// Without retries the failed run is the end of it
+	t.Setenv("STUB_RSYNC_FLAKY", filepath.Join(t.TempDir(), "failed"))
+	if _, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote}); err == nil {
+		t.Fatal("Sync succeeded despite rsync failing")
+	}
+
+	t.Setenv("STUB_RSYNC_FLAKY", filepath.Join(t.TempDir(), "failed"))
+	result, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote, Retries: 1})
+	if err != nil {
+		t.Fatalf("Sync failed after a retry: %v", err)
+	}
+	if !strings.Contains(result.Output, "sent "+local) {
+		t.Errorf("output is from the failed run:\n%s", result.Output)
+	}
+}
+
+func TestRsyncSyncerTimeout(t *testing.T) {
+	stubTools(t)
+	t.Setenv("STUB_RSYNC_SLEEP", "10")
+	local, remote := t.TempDir(), filepath.Join(t.TempDir(), "context")
+
+	syncer := NewRsyncSyncer("deploy", "example.invalid", nil)
+	start := time.Now()
+	_, err := syncer.Sync(context.Background(), SyncOptions{LocalDir: local, RemoteDir: remote, Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "rsync timed out after 100ms") {
+		t.Errorf("Sync = %v, want rsync to time out", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Sync took %s", elapsed)
+	}
+}
+
+func TestAttemptStopsOnAuthFailure(t *testing.T) {
+	tries := 0
+	err := attempt(context.Background(), SyncOptions{Retries: 3}, "rsync", func(context.Context) error {
+		tries++
+		return fmt.Errorf("rsync failed: %w", dockforward.ErrAuthFailed)
+	})
+	if !errors.Is(err, dockforward.ErrAuthFailed) || tries != 1 {
+		t.Errorf("attempt = %v after %d tries, want one try", err, tries)
+	}
+}
@@ -0,0 +1,108 @@
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	dockforward "dockforward/pkg"
+)
+
+// DockerAPI answers the Docker API requests a DockerClient makes from a canned list of
+// containers, for serving through a Tunnel
+type DockerAPI struct {
+	mu         sync.Mutex
+	containers []dockforward.Container
+	failure    string // Message every request fails with, "" to answer them
+}
+
+// NewDockerAPI returns a Docker API listing containers
+func NewDockerAPI(containers ...dockforward.Container) *DockerAPI {
+	return &DockerAPI{containers: containers}
+}
+
+// RunningContainer returns a running container named name publishing each of ports on the
+// same host port
+func RunningContainer(name string, ports ...int) dockforward.Container {
+	container := dockforward.Container{ID: name + "-id", Names: []string{"/" + name}, Image: name + ":latest", State: "running", Status: "Up 5 minutes"}
+	for _, port := range ports {
+		container.Ports = append(container.Ports, dockforward.Port{PrivatePort: port, PublicPort: port, Type: "tcp"})
+	}
+	return container
+}
+
+// ComposeContainer returns a running container of a Compose project's service, labelled
+// and named as Compose does, publishing each of ports on the same host port
+func ComposeContainer(project, service string, replica int, ports ...int) dockforward.Container {
+	container := RunningContainer(fmt.Sprintf("%s-%s-%d", project, service, replica), ports...)
+	container.Labels = map[string]string{dockforward.ComposeProjectLabel: project, dockforward.ComposeServiceLabel: service}
+	return container
+}
+
+// SetContainers replaces the containers later listings return
+func (a *DockerAPI) SetContainers(containers ...dockforward.Container) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.containers = containers
+}
+
+// Fail makes later requests fail with a 500 carrying message, as the daemon reports errors;
+// "" answers them again
+func (a *DockerAPI) Fail(message string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failure = message
+}
+
+func (a *DockerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	containers, failure := a.containers, a.failure
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if failure != "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"message": failure})
+		return
+	}
+	switch path := r.URL.Path; {
+	case path == "/containers/json":
+		json.NewEncoder(w).Encode(matchingContainers(containers, r.URL.Query().Get("filters")))
+	case path == "/events":
+		// Nothing ever happens, so hold the stream open until it's abandoned
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	case path == "/info":
+		w.Write([]byte(`{}`))
+	case path == "/networks":
+		w.Write([]byte(`[]`))
+	case path == "/volumes", path == "/system/df":
+		w.Write([]byte(`{"Volumes":[]}`))
+	case strings.HasPrefix(path, "/volumes/"):
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "page not found"})
+	}
+}
+
+// matchingContainers narrows containers by the id filter RefreshContainer sends; other
+// filters match everything
+func matchingContainers(containers []dockforward.Container, encoded string) []dockforward.Container {
+	var filters map[string][]string
+	if encoded == "" || json.Unmarshal([]byte(encoded), &filters) != nil || len(filters["id"]) == 0 {
+		return containers
+	}
+	matched := []dockforward.Container{}
+	for _, container := range containers {
+		for _, id := range filters["id"] {
+			if container.ID == id {
+				matched = append(matched, container)
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,371 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	dockforward "dockforward/pkg"
+)
+
+// FakeDocker is an in-memory ContainerAPI holding canned services. Nothing is forwarded:
+// forwarding calls only update the services' ports and are recorded in Calls, and any call
+// fails with the error set by Fail.
+type FakeDocker struct {
+	mu        sync.RWMutex
+	services  map[string]*dockforward.ServiceStatus
+	processes map[string]*dockforward.ProcessInfo // Process holding each local port
+	failures  map[string]error                    // Error each method fails with, by name
+	filters   map[string][]string
+	readOnly  bool
+	tunnel    dockforward.Tunneler
+	calls     []string
+}
+
+var _ dockforward.ContainerAPI = (*FakeDocker)(nil)
+
+// NewFakeDocker returns a FakeDocker with services, whose forwards go over tunnel if it isn't nil
+func NewFakeDocker(tunnel dockforward.Tunneler, services ...*dockforward.ServiceStatus) *FakeDocker {
+	f := &FakeDocker{
+		services:  make(map[string]*dockforward.ServiceStatus),
+		processes: make(map[string]*dockforward.ProcessInfo),
+		failures:  make(map[string]error),
+		tunnel:    tunnel,
+	}
+	for _, service := range services {
+		f.services[service.Name] = service
+	}
+	return f
+}
+
+// CannedServices returns a running web service forwarding 3000 and 8080, the latter on
+// local port 18080, and a db service whose 5432 is held by a local postgres
+func CannedServices() []*dockforward.ServiceStatus {
+	return []*dockforward.ServiceStatus{
+		{
+			Name:  "web",
+			Image: "web:latest",
+			ForwardedPorts: []dockforward.ForwardedPort{
+				{Remote: "3000", Local: "3000", Protocol: "tcp", Status: dockforward.StatusReady},
+				{Remote: "8080", Local: "18080", Protocol: "tcp", Status: dockforward.StatusReady},
+			},
+			HealthStatus:  dockforward.HealthHealthy,
+			ForwardStatus: dockforward.StatusReady,
+		},
+		{
+			Name:  "db",
+			Image: "postgres:16",
+			ForwardedPorts: []dockforward.ForwardedPort{
+				{Remote: "5432", Local: "5432", Protocol: "tcp", Status: dockforward.StatusConflict, ConflictInfo: &dockforward.ProcessInfo{Name: "postgres", PID: "812", User: "tester"}},
+			},
+			HealthStatus:  dockforward.HealthRunning,
+			ForwardStatus: dockforward.StatusConflict,
+		},
+	}
+}
+
+// Fail makes later calls of the method named, such as "RemapPort", fail with err; nil lets
+// them succeed again
+func (f *FakeDocker) Fail(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = err
+}
+
+// HoldPort makes process the holder of a local port, as GetLocalProcessForPort reports it
+func (f *FakeDocker) HoldPort(port string, process *dockforward.ProcessInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.processes[port] = process
+}
+
+// Calls returns the forwarding calls made so far, such as "RemapPort web 3000 3001"
+func (f *FakeDocker) Calls() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]string(nil), f.calls...)
+}
+
+// record notes a call and returns the error it should fail with; f.mu must be held
+func (f *FakeDocker) record(method string, args ...string) error {
+	call := method
+	for _, arg := range args {
+		call += " " + arg
+	}
+	f.calls = append(f.calls, call)
+	return f.failures[method]
+}
+
+func (f *FakeDocker) GetClient() dockforward.Tunneler {
+	return f.tunnel
+}
+
+func (f *FakeDocker) Close() error {
+	return nil
+}
+
+func (f *FakeDocker) GetServices() (map[string]*dockforward.ServiceStatus, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if err := f.failures["GetServices"]; err != nil {
+		return nil, err
+	}
+	return f.services, nil
+}
+
+func (f *FakeDocker) InspectServices() (map[string]*dockforward.ServiceStatus, error) {
+	return f.GetServices()
+}
+
+func (f *FakeDocker) RefreshContainer(id, name string) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.failures["RefreshContainer"]
+}
+
+// WatchEvents streams nothing, closing the channel once ctx is done
+func (f *FakeDocker) WatchEvents(ctx context.Context) (<-chan dockforward.DockerEvent, error) {
+	f.mu.RLock()
+	err := f.failures["WatchEvents"]
+	f.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan dockforward.DockerEvent)
+	go func() {
+		<-ctx.Done()
+		close(events)
+	}()
+	return events, nil
+}
+
+func (f *FakeDocker) Services() map[string]*dockforward.ServiceStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.services
+}
+
+func (f *FakeDocker) ViewServices(fn func(services map[string]*dockforward.ServiceStatus)) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	fn(f.services)
+}
+
+func (f *FakeDocker) GetService(name string) *dockforward.ServiceStatus {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.services[name]
+}
+
+// GetServicesByPortStatus splits the services by whether they expose ports, sorted by name
+func (f *FakeDocker) GetServicesByPortStatus() (withPorts, withoutPorts []*dockforward.ServiceStatus, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, service := range f.services {
+		if len(service.ForwardedPorts) > 0 {
+			withPorts = append(withPorts, service)
+		} else {
+			withoutPorts = append(withoutPorts, service)
+		}
+	}
+	byName := func(services []*dockforward.ServiceStatus) {
+		sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	}
+	byName(withPorts)
+	byName(withoutPorts)
+	return withPorts, withoutPorts, nil
+}
+
+func (f *FakeDocker) UpdateServices(services map[string]*dockforward.ServiceStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.services = services
+}
+
+// UpdateForwardingStatus marks each port in conflict if HoldPort gave its local port a
+// holder, and ready otherwise
+func (f *FakeDocker) UpdateForwardingStatus() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.failures["UpdateForwardingStatus"]; err != nil {
+		return err
+	}
+	for _, service := range f.services {
+		service.ForwardStatus = dockforward.StatusReady
+		for i := range service.ForwardedPorts {
+			port := &service.ForwardedPorts[i]
+			if process := f.processes[port.Local]; process != nil {
+				port.Status, port.ConflictInfo = dockforward.StatusConflict, process
+				service.ForwardStatus = dockforward.StatusConflict
+			} else {
+				port.Status, port.ConflictInfo = dockforward.StatusReady, nil
+			}
+		}
+	}
+	return nil
+}
+
+func (f *FakeDocker) StartForward(serviceName, remotePort, localPort string) (dockforward.ForwardedPort, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("StartForward", serviceName, remotePort, localPort); err != nil {
+		return dockforward.ForwardedPort{}, err
+	}
+	port, err := f.port(serviceName, remotePort)
+	if err != nil {
+		return dockforward.ForwardedPort{}, err
+	}
+	if localPort != "" {
+		port.Local = localPort
+	}
+	port.Status = dockforward.StatusReady
+	return *port, nil
+}
+
+func (f *FakeDocker) StopForward(serviceName, remotePort string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("StopForward", serviceName, remotePort); err != nil {
+		return err
+	}
+	port, err := f.port(serviceName, remotePort)
+	if err != nil {
+		return err
+	}
+	port.Status, port.ConflictInfo = dockforward.StatusNotForwarded, nil
+	return nil
+}
+
+func (f *FakeDocker) RemapPort(service *dockforward.ServiceStatus, remotePort, localPort string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("RemapPort", service.Name, remotePort, localPort); err != nil {
+		return err
+	}
+	port, err := f.port(service.Name, remotePort)
+	if err != nil {
+		return err
+	}
+	port.Local, port.Status, port.ConflictInfo = localPort, dockforward.StatusForwarded, nil
+	return nil
+}
+
+// port returns a service's port, or an error like DockerClient's if there's no such port;
+// f.mu must be held
+func (f *FakeDocker) port(serviceName, remotePort string) (*dockforward.ForwardedPort, error) {
+	service := f.services[serviceName]
+	if service == nil {
+		return nil, fmt.Errorf("no service named %s", serviceName)
+	}
+	port := service.Port(remotePort)
+	if port == nil {
+		return nil, fmt.Errorf("%s doesn't expose port %s", serviceName, remotePort)
+	}
+	return port, nil
+}
+
+func (f *FakeDocker) GetLocalProcessForPort(port string) *dockforward.ProcessInfo {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.processes[port]
+}
+
+// KillProcess frees the local ports held by the process with pid
+func (f *FakeDocker) KillProcess(pid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("KillProcess", pid); err != nil {
+		return err
+	}
+	for port, process := range f.processes {
+		if process.PID == pid {
+			delete(f.processes, port)
+		}
+	}
+	return nil
+}
+
+func (f *FakeDocker) GetNetworks() ([]*dockforward.NetworkInfo, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return nil, f.failures["GetNetworks"]
+}
+
+func (f *FakeDocker) GetVolumes() ([]*dockforward.VolumeInfo, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return nil, f.failures["GetVolumes"]
+}
+
+func (f *FakeDocker) GetHostResources(ctx context.Context) (*dockforward.HostResources, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return nil, f.failures["GetHostResources"]
+}
+
+func (f *FakeDocker) RemoveVolume(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.record("RemoveVolume", name)
+}
+
+func (f *FakeDocker) PruneVolumes() (*dockforward.VolumePruneReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("PruneVolumes"); err != nil {
+		return nil, err
+	}
+	return &dockforward.VolumePruneReport{}, nil
+}
+
+func (f *FakeDocker) Filters() map[string][]string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.filters
+}
+
+func (f *FakeDocker) SetFilters(filters map[string][]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filters = filters
+}
+
+func (f *FakeDocker) SetNotifier(*dockforward.Notifier) {}
+
+func (f *FakeDocker) SetEventLogger(*dockforward.EventLogger) {}
+
+func (f *FakeDocker) SetAlerter(*dockforward.Alerter) {}
+
+func (f *FakeDocker) SetRetry(int, time.Duration) {}
+
+// ListForwards returns the tunnel's forwards, naming the service exposing each remote port
+func (f *FakeDocker) ListForwards() []dockforward.ForwardInfo {
+	if f.tunnel == nil {
+		return nil
+	}
+	forwards := f.tunnel.ListForwards()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i := range forwards {
+		for name, service := range f.services {
+			if service.Port(forwards[i].Remote) != nil {
+				forwards[i].Service = name
+			}
+		}
+	}
+	return forwards
+}
+
+func (f *FakeDocker) ReadOnly() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.readOnly
+}
+
+func (f *FakeDocker) SetReadOnly(readOnly bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readOnly = readOnly
+}
@@ -0,0 +1,226 @@
+// Package testutil provides in-memory stand-ins for a server, for testing code built on
+// dockforward's Tunneler and ContainerAPI without SSH or a Docker daemon
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	dockforward "dockforward/pkg"
+)
+
+// ErrClosed is returned by a Tunnel's calls once it's closed
+var ErrClosed = errors.New("tunnel is closed")
+
+// Tunnel is an in-memory Tunneler. Its connections to the Docker socket are answered by a
+// handler, such as a DockerAPI, and its forwards are only recorded, so nothing listens on
+// their local ports. Like ssh, a forward fails if another process already does.
+type Tunnel struct {
+	docker     http.Handler
+	mu         sync.Mutex
+	forwards   map[string]string    // Local port by remote port
+	created    map[string]time.Time // When each forward was recorded, by remote port
+	failed     map[string]error     // Why each forward that failed did, by remote port
+	dialErr    error
+	forwardErr error
+	closed     bool
+}
+
+var _ dockforward.Tunneler = (*Tunnel)(nil)
+
+// NewTunnel returns a tunnel whose connections to the Docker socket are served by docker
+func NewTunnel(docker http.Handler) *Tunnel {
+	return &Tunnel{docker: docker, forwards: make(map[string]string), created: make(map[string]time.Time), failed: make(map[string]error)}
+}
+
+// FailDials makes later connections to the Docker socket fail with err, as when the daemon
+// is down; nil lets them through again
+func (t *Tunnel) FailDials(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dialErr = err
+}
+
+// FailForwards makes later forwards fail with err; nil lets them through again
+func (t *Tunnel) FailForwards(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.forwardErr = err
+}
+
+// Forwards returns the local port each remote port is forwarded to
+func (t *Tunnel) Forwards() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	forwards := make(map[string]string, len(t.forwards))
+	for remote, local := range t.forwards {
+		forwards[remote] = local
+	}
+	return forwards
+}
+
+// Dial connects to the Docker socket, serving the connection with the tunnel's handler
+func (t *Tunnel) Dial(network, addr string) (net.Conn, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.closed:
+		return nil, ErrClosed
+	case t.dialErr != nil:
+		return nil, t.dialErr
+	}
+
+	client, server := net.Pipe()
+	go (&http.Server{Handler: t.docker}).Serve(&connListener{conn: server})
+	return client, nil
+}
+
+// ForwardPort records remotePort as forwarded to localPort, or to the same port if it's
+// empty, failing like an SSH forward when another remote port already uses localPort or
+// another process listens on it
+func (t *Tunnel) ForwardPort(remotePort, localPort, protocol string) error {
+	if protocol == "udp" {
+		return dockforward.ErrUDPNotSupported
+	}
+	if localPort == "" {
+		localPort = remotePort
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.closed:
+		return ErrClosed
+	case t.forwardErr != nil:
+		t.failed[remotePort] = t.forwardErr
+		return t.forwardErr
+	}
+	for otherRemote, otherLocal := range t.forwards {
+		if otherRemote != remotePort && otherLocal == localPort {
+			return fmt.Errorf("%w: %s for remote port %s", dockforward.ErrPortConflict, localPort, otherRemote)
+		}
+	}
+	if t.forwards[remotePort] != localPort {
+		listener, err := net.Listen("tcp", "127.0.0.1:"+localPort)
+		if err != nil {
+			t.failed[remotePort] = fmt.Errorf("%w: %s", dockforward.ErrPortInUse, localPort)
+			return t.failed[remotePort]
+		}
+		listener.Close()
+		t.created[remotePort] = time.Now()
+	}
+	t.forwards[remotePort] = localPort
+	delete(t.failed, remotePort)
+	return nil
+}
+
+// ForwardFailure returns the error remotePort's last forward failed with, or nil if it
+// didn't fail or was stopped since
+func (t *Tunnel) ForwardFailure(remotePort string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed[remotePort]
+}
+
+// ForwardedTo returns the local port remotePort is forwarded to, or "" if it isn't
+func (t *Tunnel) ForwardedTo(remotePort string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.forwards[remotePort]
+}
+
+// ListForwards returns the recorded forwards as active, and those that failed as dead
+func (t *Tunnel) ListForwards() []dockforward.ForwardInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var forwards []dockforward.ForwardInfo
+	for remote, local := range t.forwards {
+		forwards = append(forwards, dockforward.ForwardInfo{Remote: remote, Local: local, Bind: "localhost", State: dockforward.ForwardActive, Since: t.created[remote]})
+	}
+	for remote, err := range t.failed {
+		forwards = append(forwards, dockforward.ForwardInfo{Remote: remote, Bind: "localhost", State: dockforward.ForwardDead, Error: err.Error()})
+	}
+	sort.Slice(forwards, func(i, j int) bool { return forwards[i].Remote < forwards[j].Remote })
+	return forwards
+}
+
+// ForwardPorts forwards each of service's TCP ports, to the local port in portMap if it has one
+func (t *Tunnel) ForwardPorts(service *dockforward.ServiceStatus, portMap map[string]string) error {
+	for _, port := range service.ForwardedPorts {
+		if port.Protocol == "udp" {
+			continue
+		}
+		if err := t.ForwardPort(port.Remote, portMap[port.Remote], port.Protocol); err != nil {
+			return fmt.Errorf("error forwarding port %s: %w", port.Remote, err)
+		}
+	}
+	return nil
+}
+
+// StopForward forgets the forward of remotePort
+func (t *Tunnel) StopForward(remotePort string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.forwards, remotePort)
+	delete(t.created, remotePort)
+	delete(t.failed, remotePort)
+}
+
+// StopForwards forgets every forward
+func (t *Tunnel) StopForwards() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.forwards)
+	clear(t.created)
+	clear(t.failed)
+}
+
+// Connected reports whether the tunnel is still open
+func (t *Tunnel) Connected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.closed
+}
+
+// Target names the tunnel in status lines
+func (t *Tunnel) Target() string {
+	return "tester@in-memory"
+}
+
+// Close forgets every forward and fails later calls
+func (t *Tunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	clear(t.forwards)
+	return nil
+}
+
+// connListener accepts a single connection, then fails, ending the http.Server serving it
+// without closing the connection
+type connListener struct {
+	conn net.Conn
+	once sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() { conn = l.conn })
+	if conn == nil {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (l *connListener) Close() error {
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
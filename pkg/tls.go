@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// defaultTLSEndpoint is where a Docker daemon requiring client certificates listens when
+// DOCKER_HOST doesn't say, the port dockerd --tlsverify conventionally uses. Unix sockets
+// don't speak TLS.
+const defaultTLSEndpoint = tcpPrefix + "127.0.0.1:2376"
+
+// UsesTLS reports whether any of the server's TLS client certificate settings are set
+func (s ServerConfig) UsesTLS() bool {
+	return s.TLSCertPath != "" || s.TLSKeyPath != "" || s.TLSCACertPath != ""
+}
+
+// DockerTLSConfig loads the client certificate and CA the server's Docker daemon requires,
+// returning nil if the server doesn't set them. The daemon's certificate is checked against
+// the CA and the server's host name.
+func (s ServerConfig) DockerTLSConfig() (*tls.Config, error) {
+	if !s.UsesTLS() {
+		return nil, nil
+	}
+	if s.TLSCertPath == "" || s.TLSKeyPath == "" || s.TLSCACertPath == "" {
+		return nil, fmt.Errorf("server %s: tls_cert_path, tls_key_path and tls_ca_cert_path must all be set", s.Name)
+	}
+	cert, err := tls.LoadX509KeyPair(expandHome(s.TLSCertPath), expandHome(s.TLSKeyPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the Docker TLS client certificate: %v", err)
+	}
+	ca, err := os.ReadFile(expandHome(s.TLSCACertPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Docker TLS CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in %s", s.TLSCACertPath)
+	}
+	host, _, err := net.SplitHostPort(s.Host)
+	if err != nil {
+		host = s.Host
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   host,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// UseTLS has Docker API requests authenticate with config's client certificate, through
+// the same SSH forward. Call it before Start.
+func (d *DockerClient) UseTLS(config *tls.Config) {
+	d.tlsConfig = config
+	d.transport = &http.Transport{TLSClientConfig: config}
+}
+
+// apiURL returns the URL of path on the forwarded Docker API
+func (d *DockerClient) apiURL(path string) string {
+	scheme := "http"
+	if d.tlsConfig != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://127.0.0.1:%d%s", scheme, d.apiPort, path)
+}
+
+// httpClient returns a client for the forwarded Docker API giving up after timeout, or
+// never if it's 0
+func (d *DockerClient) httpClient(timeout time.Duration) *http.Client {
+	if d.transport == nil {
+		return &http.Client{Timeout: timeout}
+	}
+	return &http.Client{Timeout: timeout, Transport: d.transport}
+}
@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert issues a certificate for name signed by parent and parentKey, or self-signed
+// if parent is nil, writing it and its key to dir as name.pem and name-key.pem
+func writeCert(t *testing.T, dir, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore, template.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestDockerClientTLS(t *testing.T) {
+	// A CA issuing the daemon's certificate, for the server's host name, and the client's
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{SerialNumber: big.NewInt(1), IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil, nil)
+	writeCert(t, dir, "server", &x509.Certificate{SerialNumber: big.NewInt(2), DNSNames: []string{"build.example.invalid"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, ca, caKey)
+	writeCert(t, dir, "client", &x509.Certificate{SerialNumber: big.NewInt(3), ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ca, caKey)
+
+	// A Docker API like dockerd --tlsverify, refusing clients without a certificate
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	remote := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "client" {
+			t.Errorf("request without the client certificate: %+v", r.TLS)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{"Id":"abc","Names":["/web"],"State":"running","Status":"Up","Ports":[]}]`)
+	}))
+	remote.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	remote.StartTLS()
+	t.Cleanup(remote.Close)
+	remoteURL, err := url.Parse(remote.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := ServerConfig{
+		Name:          "build",
+		Host:          "build.example.invalid:22",
+		TLSCertPath:   filepath.Join(dir, "client.pem"),
+		TLSKeyPath:    filepath.Join(dir, "client-key.pem"),
+		TLSCACertPath: filepath.Join(dir, "ca.pem"),
+	}
+	tlsConfig, err := server.DockerTLSConfig()
+	if err != nil {
+		t.Fatalf("DockerTLSConfig failed: %v", err)
+	}
+	if tlsConfig.ServerName != "build.example.invalid" {
+		t.Errorf("ServerName = %q, want the server's host", tlsConfig.ServerName)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &DockerClient{
+		dialer:       &mockDialer{addr: remoteURL.Host},
+		listener:     listener,
+		apiPort:      listener.Addr().(*net.TCPAddr).Port,
+		services:     make(map[string]*ServiceStatus),
+		portMappings: make(map[string]map[string]string),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.UseTLS(tlsConfig)
+	d.Start()
+	t.Cleanup(func() { d.Close() })
+
+	if d.socket != defaultTLSEndpoint {
+		t.Errorf("socket = %q, want %q since unix sockets don't do TLS", d.socket, defaultTLSEndpoint)
+	}
+	services, err := d.listContainers(context.Background(), nil)
+	if err != nil || len(services) != 1 {
+		t.Fatalf("listContainers over TLS = %v, %v", services, err)
+	}
+
+	// The same forward refuses a client without the certificate
+	plain := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "build.example.invalid"}}}
+	if resp, err := plain.Get(d.apiURL("/containers/json")); err == nil {
+		resp.Body.Close()
+		t.Errorf("request without a client certificate answered %s", resp.Status)
+	}
+}
+
+func TestDockerTLSConfigIncomplete(t *testing.T) {
+	if config, err := (ServerConfig{Name: "plain"}).DockerTLSConfig(); config != nil || err != nil {
+		t.Errorf("without certificates DockerTLSConfig = %v, %v, want plain HTTP", config, err)
+	}
+	_, err := ServerConfig{Name: "half", TLSCertPath: "cert.pem"}.DockerTLSConfig()
+	if err == nil || !strings.Contains(err.Error(), "must all be set") {
+		t.Errorf("with only a certificate DockerTLSConfig = %v", err)
+	}
+	_, err = ServerConfig{Name: "missing", TLSCertPath: "/nonexistent/cert.pem", TLSKeyPath: "/nonexistent/key.pem", TLSCACertPath: "/nonexistent/ca.pem"}.DockerTLSConfig()
+	if err == nil {
+		t.Error("DockerTLSConfig loaded certificates that don't exist")
+	}
+}
@@ -1,12 +1,93 @@
 package pkg
 
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
 // Docker API types
 type Container struct {
-	ID     string
-	Names  []string
-	State  string
-	Status string
-	Ports  []Port
+	ID      string
+	Names   []string
+	Image   string
+	State   string
+	Status  string
+	Ports   []Port
+	Labels  map[string]string
+	Created int64
+	NetworkSettings struct {
+		Networks map[string]EndpointSettings // Keyed by network name
+	}
+}
+
+// EndpointSettings is a container's attachment to a network
+type EndpointSettings struct {
+	NetworkID string
+	IPAddress string
+}
+
+// DockerEvent is one object from the Docker API's /events stream
+type DockerEvent struct {
+	Type   string
+	Action string
+	Actor  struct {
+		ID         string
+		Attributes map[string]string
+	}
+	Time int64 `json:"time"`
+}
+
+// Name returns the name of the container the event is about
+func (e DockerEvent) Name() string {
+	return e.Actor.Attributes["name"]
+}
+
+// ChangesService reports whether the event can change a container's listing, so the
+// container should be fetched again. Health events arrive as "health_status: healthy".
+// Swarm managers also report service events, each of which changes the listing.
+func (e DockerEvent) ChangesService() bool {
+	if e.Type == "service" {
+		return true
+	}
+	if e.Type != "container" {
+		return false
+	}
+	switch e.Action {
+	case "start", "stop", "die":
+		return true
+	}
+	return strings.HasPrefix(e.Action, "health_status")
+}
+
+// SwarmService is a service from the Docker API's /services listing on a swarm manager
+type SwarmService struct {
+	ID        string
+	CreatedAt time.Time
+	Spec      struct {
+		Name         string
+		TaskTemplate struct {
+			ContainerSpec struct {
+				Image string
+			}
+		}
+	}
+	Endpoint struct {
+		Ports []SwarmPort
+	}
+	ServiceStatus *struct { // Task counts, only reported when listing with status=true
+		RunningTasks uint64
+		DesiredTasks uint64
+	}
+}
+
+// SwarmPort is a port a swarm service publishes, on every node for the ingress mode or on
+// the task's node for the host mode
+type SwarmPort struct {
+	Protocol      string
+	TargetPort    int
+	PublishedPort int
+	PublishMode   string
 }
 
 type Port struct {
@@ -19,11 +100,109 @@ type Port struct {
 // ServiceStatus represents the current state of a Docker service
 type ServiceStatus struct {
 	Name           string
-	ExposedPorts   []string
+	Image          string
+	ForwardedPorts []ForwardedPort
 	HealthStatus   string
 	ForwardStatus  string
-	LocalPorts     []string
-	Conflicts      []string
+	Created        time.Time
+	Replicas       string // Running and desired tasks of a swarm service, as "2/3", empty for a container
+	Project        string // Compose project the container belongs to, from its labels
+	ComposeService string // Compose service the container runs, from its labels
+}
+
+// Clone returns a copy of s whose ports can be read while s is updated
+func (s *ServiceStatus) Clone() *ServiceStatus {
+	clone := *s
+	clone.ForwardedPorts = slices.Clone(s.ForwardedPorts)
+	return &clone
+}
+
+// ForwardedPort tracks one exposed port of a service and its local forward
+type ForwardedPort struct {
+	Remote       string
+	Local        string
+	Protocol     string
+	Status       string
+	ConflictInfo *ProcessInfo // Local process holding the port when Status is StatusConflict
+	Error        string       // Why the forward failed when Status is StatusError
+}
+
+// Label returns the port number, suffixed with the protocol when it isn't TCP
+func (p ForwardedPort) Label() string {
+	if p.Protocol == "" || p.Protocol == "tcp" {
+		return p.Remote
+	}
+	return p.Remote + "/" + p.Protocol
+}
+
+// httpsPorts and httpPorts are remote ports assumed to serve HTTPS or plain HTTP
+var (
+	httpsPorts = map[string]bool{"443": true, "8443": true, "9443": true}
+	httpPorts  = map[string]bool{
+		"80": true, "3000": true, "4200": true, "5000": true, "5173": true, "8000": true,
+		"8080": true, "8081": true, "8888": true, "9000": true, "9090": true,
+	}
+)
+
+// Scheme guesses the URL scheme the port serves from its number, "" if it doesn't look like HTTP
+func (p ForwardedPort) Scheme() string {
+	if p.Protocol != "" && p.Protocol != "tcp" {
+		return ""
+	}
+	switch {
+	case httpsPorts[p.Remote]:
+		return "https"
+	case httpPorts[p.Remote]:
+		return "http"
+	}
+	return ""
+}
+
+// LocalAddress returns the port's local URL, or localhost:port if it doesn't look like HTTP
+func (p ForwardedPort) LocalAddress() string {
+	if scheme := p.Scheme(); scheme != "" {
+		return scheme + "://localhost:" + p.Local
+	}
+	return "localhost:" + p.Local
+}
+
+// PortLabels returns the labels of the service's exposed ports
+func (s *ServiceStatus) PortLabels() []string {
+	labels := make([]string, 0, len(s.ForwardedPorts))
+	for _, port := range s.ForwardedPorts {
+		labels = append(labels, port.Label())
+	}
+	return labels
+}
+
+// RemotePorts returns the exposed port numbers of the service
+func (s *ServiceStatus) RemotePorts() []string {
+	ports := make([]string, 0, len(s.ForwardedPorts))
+	for _, port := range s.ForwardedPorts {
+		ports = append(ports, port.Remote)
+	}
+	return ports
+}
+
+// ConflictPorts returns the exposed ports whose local port is taken by another process
+func (s *ServiceStatus) ConflictPorts() []string {
+	var ports []string
+	for _, port := range s.ForwardedPorts {
+		if port.Status == StatusConflict {
+			ports = append(ports, port.Remote)
+		}
+	}
+	return ports
+}
+
+// Port returns the forwarded port for a remote port number, or nil if the service doesn't expose it
+func (s *ServiceStatus) Port(remote string) *ForwardedPort {
+	for i := range s.ForwardedPorts {
+		if s.ForwardedPorts[i].Remote == remote {
+			return &s.ForwardedPorts[i]
+		}
+	}
+	return nil
 }
 
 
@@ -34,6 +213,7 @@ const (
 	StatusReady       = "Ready"
 	StatusError       = "Error"
 	StatusConflict    = "Conflict"
+	StatusUnsupported = "Unsupported"
 )
 
 // Health status constants
@@ -49,4 +229,5 @@ const (
 	HealthExited     = "Exited"
 	HealthDead       = "Dead"
 	HealthUnknown    = "Unknown"
+	HealthMissing    = "Missing" // A pinned service the daemon no longer reports
 )
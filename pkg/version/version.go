@@ -0,0 +1,126 @@
+// Package version holds the build information both binaries report, set with -ldflags
+// when building, and checks GitHub for newer releases.
+package version
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Build information, set when building with e.g.
+// go build -ldflags "-X dockforward/pkg/version.Version=v1.2.0 -X dockforward/pkg/version.GitCommit=$(git rev-parse --short HEAD)"
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildDate = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build information, falling back to what the Go toolchain
+// recorded about the checkout when the linker flags weren't set
+func Get() Info {
+	info := Info{Version: Version, GitCommit: GitCommit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.GitCommit == "":
+				info.GitCommit = setting.Value[:min(len(setting.Value), 12)]
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// String formats the information on one line, e.g. "v1.2.0 (commit 3f2a9c1, built 2026-01-05, go1.23.5)"
+func (v Info) String() string {
+	details := []string{}
+	if v.GitCommit != "" {
+		details = append(details, "commit "+v.GitCommit)
+	}
+	if v.BuildDate != "" {
+		details = append(details, "built "+v.BuildDate)
+	}
+	details = append(details, v.GoVersion)
+	return fmt.Sprintf("%s (%s)", v.Version, strings.Join(details, ", "))
+}
+
+// latestReleaseURL is the GitHub API endpoint for the newest release, replaced in tests
+var latestReleaseURL = "https://api.github.com/repos/thebadking/dockforward/releases/latest"
+
+// LatestRelease fetches the tag of the newest dockforward release on GitHub
+func LatestRelease(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to check for updates: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to check for updates: GitHub answered %s", resp.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil || release.TagName == "" {
+		return "", fmt.Errorf("failed to check for updates: unexpected answer from GitHub")
+	}
+	return release.TagName, nil
+}
+
+// Newer reports whether version latest is newer than current. Versions that
+// aren't of the form v1.2.3, such as a development build, are never older.
+func Newer(current, latest string) bool {
+	have, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	want, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	for i := range have {
+		if want[i] != have[i] {
+			return want[i] > have[i]
+		}
+	}
+	return false
+}
+
+// parseVersion splits a version like v1.2.3 or 1.2 into its numbers, ignoring any
+// pre-release or build suffix
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	version, _, _ = strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	version, _, _ = strings.Cut(version, "+")
+	fields := strings.Split(version, ".")
+	if len(fields) > len(parts) {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
@@ -0,0 +1,62 @@
+package version
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		want            bool
+	}{
+		{"v1.2.0", "v1.3.0", true},
+		{"v1.2.9", "v1.10.0", true},
+		{"1.2.0", "v1.2.1", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.3.0", "v1.2.5", false},
+		{"v1.2", "v1.2.0", false},
+		{"v1.2.0-rc.1", "v1.2.1", true},
+		{"dev", "v1.0.0", false},
+		{"v1.0.0", "nightly", false},
+	}
+	for _, tt := range tests {
+		if got := Newer(tt.current, tt.latest); got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.current, tt.latest, got, tt.want)
+		}
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"tag_name": "v1.4.0", "name": "dockforward 1.4"}`))
+	}))
+	defer server.Close()
+	defer func(url string) { latestReleaseURL = url }(latestReleaseURL)
+
+	latestReleaseURL = server.URL + "/releases/latest"
+	if tag, err := LatestRelease(context.Background(), server.Client()); err != nil || tag != "v1.4.0" {
+		t.Errorf("LatestRelease = %q, %v", tag, err)
+	}
+	latestReleaseURL = server.URL + "/missing"
+	if _, err := LatestRelease(context.Background(), server.Client()); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("LatestRelease = %v, want the 404", err)
+	}
+}
+
+func TestInfoString(t *testing.T) {
+	info := Info{Version: "v1.2.0", GitCommit: "3f2a9c1", BuildDate: "2026-01-05", GoVersion: "go1.23.5"}
+	if got := info.String(); got != "v1.2.0 (commit 3f2a9c1, built 2026-01-05, go1.23.5)" {
+		t.Errorf("String = %q", got)
+	}
+	if got := (Info{Version: "dev", GoVersion: "go1.23.5"}).String(); got != "dev (go1.23.5)" {
+		t.Errorf("String = %q", got)
+	}
+}
@@ -0,0 +1,271 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// VolumeInfo is a Docker volume on the remote host
+type VolumeInfo struct {
+	Name       string
+	Driver     string
+	Mountpoint string
+	Size       int64 // Bytes used, -1 if Docker couldn't measure it
+	RefCount   int   // Containers using the volume, -1 if unknown
+}
+
+// Unused reports whether no container uses the volume, so deleting it is safe
+func (v *VolumeInfo) Unused() bool {
+	return v.RefCount == 0
+}
+
+// volumeUsage is the size and use count Docker reports for a volume
+type volumeUsage struct {
+	Size     int64
+	RefCount int
+}
+
+// VolumePruneReport is what pruning removed
+type VolumePruneReport struct {
+	VolumesDeleted []string
+	SpaceReclaimed int64
+}
+
+// GetVolumes lists the remote host's volumes, sorted by name. Docker only measures volumes
+// for its disk usage report, not when listing or inspecting them, so sizes and use counts
+// come from a single /system/df request.
+func (d *DockerClient) GetVolumes() ([]*VolumeInfo, error) {
+	var listed struct {
+		Volumes []struct {
+			Name       string
+			Driver     string
+			Mountpoint string
+		}
+	}
+	if err := d.apiRequest(d.requestContext(), http.MethodGet, "/volumes", &listed); err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	// Sizes are a nicety, so the volumes are still listed if measuring them fails
+	usage := make(map[string]volumeUsage)
+	var df struct {
+		Volumes []struct {
+			Name      string
+			UsageData *volumeUsage
+		}
+	}
+	if err := d.apiRequest(d.requestContext(), http.MethodGet, "/system/df?type=volume", &df); err != nil {
+		logWarn("Failed to get volume sizes: %v", err)
+	}
+	for _, volume := range df.Volumes {
+		if volume.UsageData != nil {
+			usage[volume.Name] = *volume.UsageData
+		}
+	}
+
+	volumes := make([]*VolumeInfo, 0, len(listed.Volumes))
+	for _, v := range listed.Volumes {
+		volume := &VolumeInfo{Name: v.Name, Driver: v.Driver, Mountpoint: v.Mountpoint, Size: -1, RefCount: -1}
+		if u, ok := usage[v.Name]; ok {
+			volume.Size, volume.RefCount = u.Size, u.RefCount
+		}
+		volumes = append(volumes, volume)
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+	return volumes, nil
+}
+
+// RemoveVolume deletes the named volume, which Docker refuses while a container uses it
+func (d *DockerClient) RemoveVolume(name string) error {
+	if err := d.apiRequest(d.requestContext(), http.MethodDelete, "/volumes/"+url.PathEscape(name), nil); err != nil {
+		return fmt.Errorf("failed to remove volume %s: %w", name, err)
+	}
+	return nil
+}
+
+// PruneVolumes deletes the volumes no container uses, which Docker limits to anonymous
+// volumes
+func (d *DockerClient) PruneVolumes() (*VolumePruneReport, error) {
+	var report VolumePruneReport
+	if err := d.apiRequest(d.requestContext(), http.MethodPost, "/volumes/prune", &report); err != nil {
+		return nil, fmt.Errorf("failed to prune volumes: %w", err)
+	}
+	return &report, nil
+}
+
+// VolumeListScreen lists the remote host's volumes, and deletes or prunes unused ones
+type VolumeListScreen struct {
+	display *DisplayManager
+	docker  ContainerAPI
+	mu      sync.Mutex // Guards the fields below, set by the background fetch
+	volumes []*VolumeInfo
+	err     error
+	loaded  bool
+}
+
+func NewVolumeListScreen(display *DisplayManager, docker ContainerAPI) *VolumeListScreen {
+	s := &VolumeListScreen{display: display, docker: docker}
+	if docker != nil {
+		go s.refresh()
+	}
+	return s
+}
+
+// refresh fetches the volumes and redraws
+func (s *VolumeListScreen) refresh() {
+	volumes, err := s.docker.GetVolumes()
+	s.mu.Lock()
+	s.volumes, s.err, s.loaded = volumes, err, true
+	s.mu.Unlock()
+	s.display.Display()
+}
+
+func (s *VolumeListScreen) Display(w io.Writer) {
+	if s.docker == nil {
+		fmt.Fprintln(w, "Error: Docker client is not initialized")
+		return
+	}
+
+	fmt.Fprintf(w, "%s\n\n", s.display.colors.Header("Volumes"))
+	s.mu.Lock()
+	volumes, err, loaded := s.volumes, s.err, s.loaded
+	s.mu.Unlock()
+	switch {
+	case !loaded:
+		fmt.Fprintln(w, "Loading volumes...")
+	case err != nil:
+		fmt.Fprintf(w, "Error getting volumes: %v\n", err)
+	case len(volumes) == 0:
+		fmt.Fprintln(w, "No volumes found.")
+	default:
+		s.display.setRowLines(rowRange(2+tableHeaderLines, len(volumes)))
+		headers := []string{"#", "Name", "Driver", "Mountpoint", "Size", "Used By"}
+		var rows [][]string
+		for i, volume := range volumes {
+			selected := i == s.display.Cursor()
+			mountpoint, size, usedBy := volume.Mountpoint, "-", "-"
+			if mountpoint == "" {
+				mountpoint = "-"
+			}
+			if volume.Size >= 0 {
+				size = FormatBytes(volume.Size)
+			}
+			if volume.RefCount >= 0 {
+				usedBy = plural(volume.RefCount, "container")
+			}
+			rows = append(rows, []string{
+				s.display.highlight(strconv.Itoa(i), selected),
+				s.display.highlight(volume.Name, selected),
+				volume.Driver,
+				mountpoint,
+				size,
+				usedBy,
+			})
+		}
+
+		table := tablewriter.NewWriter(w)
+		table.SetHeader(headers)
+		table.SetAutoWrapText(false)
+		table.SetAutoFormatHeaders(true)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetCenterSeparator("─")
+		table.SetColumnSeparator("│")
+		table.SetRowSeparator("─")
+		table.SetHeaderLine(true)
+		table.SetBorder(true)
+		s.display.appendFitted(table, headers, rows, []int{priorityHigh, priorityHigh, priorityLow, priorityLow, priorityMedium, priorityMedium})
+		table.Render()
+	}
+
+	s.display.renderActions(w, s.Keys())
+}
+
+// volumeAt returns the volume at the highlighted row, or the row given as args[0], or nil
+// if there's none
+func (s *VolumeListScreen) volumeAt(args []string) *VolumeInfo {
+	row := s.display.Cursor()
+	if idx, err := strconv.Atoi(args[0]); err == nil {
+		row = idx
+	} else if row < 0 {
+		row = 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if row < 0 || row >= len(s.volumes) {
+		return nil
+	}
+	return s.volumes[row]
+}
+
+// Keys returns the commands available on the volume list
+func (s *VolumeListScreen) Keys() Keymap {
+	return Keymap{
+		{Keys: []string{"d", "# d"}, Label: "[d]elete", Description: "Delete the highlighted volume if no container uses it (e.g., '2 d' for volume 2)", Action: func(args []string) bool {
+			volume := s.volumeAt(args)
+			if volume == nil {
+				return false
+			}
+			if !volume.Unused() {
+				logWarn("Volume %s is in use, remove its containers first", volume.Name)
+				return true
+			}
+			s.display.confirm(fmt.Sprintf("Delete volume '%s' and its data?", volume.Name), func() error {
+				if err := s.docker.RemoveVolume(volume.Name); err != nil {
+					return err
+				}
+				logInfo("Deleted volume %s", volume.Name)
+				go s.refresh()
+				return nil
+			})
+			return true
+		}},
+		{Keys: []string{"p", "prune"}, Label: "[p]rune", Description: "Delete every dangling volume, the anonymous ones no container uses", Action: func([]string) bool {
+			s.display.confirm("Delete every dangling volume and its data?", func() error {
+				report, err := s.docker.PruneVolumes()
+				if err != nil {
+					return err
+				}
+				logInfo("Pruned %s, reclaiming %s", plural(len(report.VolumesDeleted), "volume"), FormatBytes(report.SpaceReclaimed))
+				go s.refresh()
+				return nil
+			})
+			return true
+		}},
+		{Keys: []string{"r", "refresh"}, Label: "[r]efresh", Description: "Refresh volumes now", Action: func([]string) bool {
+			go s.refresh()
+			return true
+		}},
+		{Keys: []string{"b", "back"}, Label: "[b]ack", Description: "Return to overview", Action: func([]string) bool {
+			s.display.SetMode(ModeOverview)
+			return true
+		}},
+	}
+}
+
+func (s *VolumeListScreen) HandleInput(input string) bool {
+	return s.Keys().Dispatch(input)
+}
+
+func (s *VolumeListScreen) NeedsRefresh() bool {
+	return false
+}
+
+// Close is a no-op, volumes are only fetched on request
+func (s *VolumeListScreen) Close() {}
+
+// RowCount returns the number of volumes listed
+func (s *VolumeListScreen) RowCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.volumes)
+}
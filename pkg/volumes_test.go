@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetVolumes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /volumes", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"Volumes":[
+			{"Name":"pgdata","Driver":"local","Mountpoint":"/var/lib/docker/volumes/pgdata/_data"},
+			{"Name":"cache","Driver":"local","Mountpoint":"/var/lib/docker/volumes/cache/_data"},
+			{"Name":"nfs","Driver":"nfs","Mountpoint":""}
+		]}`)
+	})
+	mux.HandleFunc("GET /system/df", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("type"); got != "volume" {
+			t.Errorf("df type = %q, want volume", got)
+		}
+		io.WriteString(w, `{"Volumes":[
+			{"Name":"pgdata","UsageData":{"Size":52428800,"RefCount":1}},
+			{"Name":"cache","UsageData":{"Size":0,"RefCount":0}}
+		]}`)
+	})
+	d := newTestDockerClient(t, mux)
+
+	volumes, err := d.GetVolumes()
+	if err != nil {
+		t.Fatalf("GetVolumes failed: %v", err)
+	}
+	want := []*VolumeInfo{
+		{Name: "cache", Driver: "local", Mountpoint: "/var/lib/docker/volumes/cache/_data", Size: 0, RefCount: 0},
+		{Name: "nfs", Driver: "nfs", Size: -1, RefCount: -1},
+		{Name: "pgdata", Driver: "local", Mountpoint: "/var/lib/docker/volumes/pgdata/_data", Size: 52428800, RefCount: 1},
+	}
+	if !reflect.DeepEqual(volumes, want) {
+		t.Errorf("GetVolumes = %+v, want %+v", volumes, want)
+	}
+}
+
+func TestRemoveAndPruneVolumes(t *testing.T) {
+	var removed []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /volumes/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") == "pgdata" {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"message":"remove pgdata: volume is in use"}`)
+			return
+		}
+		removed = append(removed, r.PathValue("name"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /volumes/prune", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"VolumesDeleted":["a","b"],"SpaceReclaimed":2048}`)
+	})
+	d := newTestDockerClient(t, mux)
+
+	if err := d.RemoveVolume("cache"); err != nil {
+		t.Fatalf("RemoveVolume failed: %v", err)
+	}
+	if !reflect.DeepEqual(removed, []string{"cache"}) {
+		t.Errorf("removed %q, want [cache]", removed)
+	}
+	if err := d.RemoveVolume("pgdata"); err == nil || err.Error() != "failed to remove volume pgdata: remove pgdata: volume is in use" {
+		t.Errorf("removing a volume in use = %v, want Docker's refusal", err)
+	}
+
+	report, err := d.PruneVolumes()
+	if err != nil {
+		t.Fatalf("PruneVolumes failed: %v", err)
+	}
+	if want := (&VolumePruneReport{VolumesDeleted: []string{"a", "b"}, SpaceReclaimed: 2048}); !reflect.DeepEqual(report, want) {
+		t.Errorf("PruneVolumes = %+v, want %+v", report, want)
+	}
+}
+
+// fixtureVolumeScreen returns a volume list already loaded with three volumes
+func fixtureVolumeScreen() (*VolumeListScreen, *DisplayManager) {
+	docker := fixtureDockerClient()
+	dm := &DisplayManager{config: fixtureConfig(), docker: docker, cursors: make(map[DisplayMode]int)}
+	screen := &VolumeListScreen{display: dm, docker: docker, loaded: true, volumes: []*VolumeInfo{
+		{Name: "cache", Driver: "local", Mountpoint: "/var/lib/docker/volumes/cache/_data", Size: 0, RefCount: 0},
+		{Name: "nfs", Driver: "nfs", Size: -1, RefCount: -1},
+		{Name: "pgdata", Driver: "local", Mountpoint: "/var/lib/docker/volumes/pgdata/_data", Size: 52428800, RefCount: 1},
+	}}
+	dm.currentScreen = screen
+	dm.mode = ModeVolumeList
+	return screen, dm
+}
+
+func TestVolumeListScreenGolden(t *testing.T) {
+	screen, _ := fixtureVolumeScreen()
+	assertGolden(t, "volume_list", renderScreen(screen))
+}
+
+func TestVolumeDeleteAsksFirst(t *testing.T) {
+	screen, dm := fixtureVolumeScreen()
+
+	// A volume in use isn't offered for deletion
+	if !screen.HandleInput("2 d") || dm.topModal() != nil {
+		t.Error("deleting a volume in use asked for confirmation")
+	}
+	if screen.HandleInput("7 d") {
+		t.Error("deleting a row that doesn't exist was accepted")
+	}
+
+	if !screen.HandleInput("0 d") {
+		t.Fatal("deleting volume 0 was rejected")
+	}
+	if _, ok := dm.topModal().(*ConfirmScreen); !ok {
+		t.Fatalf("deleting an unused volume opened %T, want a confirmation", dm.topModal())
+	}
+	dm.topModal().HandleInput("n")
+	if dm.topModal() != nil {
+		t.Error("cancelling left the confirmation open")
+	}
+}
@@ -0,0 +1,187 @@
+// Package web serves the monitor's screens to browsers: a page running a terminal emulator
+// that a WebSocket connects to the monitor's session. Every tab sees the frames the terminal
+// sees, and keys typed in any of them are handled as if typed in the terminal.
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	dockforward "dockforward/pkg"
+
+	"golang.org/x/net/websocket"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// pageCSP lets the page run its own script and nothing else, and connect only back to the
+// monitor it came from
+var pageCSP = func() string {
+	_, script, _ := bytes.Cut(indexHTML, []byte("<script>"))
+	script, _, _ = bytes.Cut(script, []byte("</script>"))
+	sum := sha256.Sum256(script)
+	return "default-src 'none'; script-src 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'; " +
+		"style-src 'unsafe-inline'; connect-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+}()
+
+// Terminal is the session browsers share, satisfied by *dockforward.DisplayManager
+type Terminal interface {
+	AddMirror(w io.Writer) func()
+	HandleKeys(keys ...dockforward.Key)
+}
+
+// Serve serves terminal to browsers on addr until the returned server is closed, requiring
+// token, given as the page's ?token=, unless it's empty. Without one it only listens on
+// loopback.
+func Serve(addr, token string, terminal Terminal) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	if token == "" && !dockforward.LoopbackAddr(listener.Addr()) {
+		listener.Close()
+		return nil, fmt.Errorf("%s is reachable beyond this machine, set api_token in the config to serve on it", addr)
+	}
+	server := &http.Server{Handler: NewHandler(terminal, token, addr), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Web terminal stopped", "err", err)
+		}
+	}()
+	return server, nil
+}
+
+// tokenCookie carries the token once the page has been opened with it. It's HttpOnly, so
+// the page's script never sees the token.
+const tokenCookie = "dockforward_token"
+
+// NewHandler serves the page at / and its WebSocket at /ws, each requiring token unless it's
+// empty. The page opened as /?token= stores it in a cookie and drops it from the address.
+// Requests must name the machine as served on listenAddr, see dockforward.AllowedHost.
+func NewHandler(terminal Terminal, token, listenAddr string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", pageCSP)
+		w.Write(indexHTML)
+	})
+	mux.Handle("GET /ws", websocket.Server{
+		Handshake: checkOrigin,
+		Handler:   func(ws *websocket.Conn) { serveConn(ws, terminal) },
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !dockforward.AllowedHost(r.Host, listenAddr) {
+			http.Error(w, fmt.Sprintf("host %q isn't served here", r.Host), http.StatusMisdirectedRequest)
+			return
+		}
+		if token == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		given := r.URL.Query().Get("token")
+		if cookie, err := r.Cookie(tokenCookie); given == "" && err == nil {
+			given = cookie.Value
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "missing or wrong token, open the page with ?token=", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/" && r.URL.Query().Has("token") {
+			http.SetCookie(w, &http.Cookie{Name: tokenCookie, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin refuses WebSockets opened by pages from other sites, which could otherwise
+// drive the monitor from any tab the user has open
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil || origin.Host != r.Host {
+		return fmt.Errorf("WebSocket from origin %q refused", r.Header.Get("Origin"))
+	}
+	config.Origin = origin
+	return nil
+}
+
+// serveConn mirrors the terminal's frames to ws and handles the keys typed in it until the
+// browser goes away
+func serveConn(ws *websocket.Conn, terminal Terminal) {
+	defer ws.Close()
+	frames := &latestFrame{c: make(chan []byte, 1)}
+	defer frames.close()
+	defer terminal.AddMirror(frames)()
+
+	// Send frames from here, so a slow browser only ever delays its own
+	go func() {
+		for frame := range frames.c {
+			if err := websocket.Message.Send(ws, string(frame)); err != nil {
+				ws.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		var data string
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+		var keys []dockforward.Key
+		for _, key := range dockforward.ParseKeys(data) {
+			// Ctrl+C quits the monitor in its terminal, not from a browser tab
+			if key.Type != dockforward.KeyCtrlC {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			terminal.HandleKeys(keys...)
+		}
+	}
+}
+
+// latestFrame passes frames to a sender without blocking the renderer. Each frame redraws
+// the whole screen, so one the sender hasn't taken yet is replaced by the next.
+type latestFrame struct {
+	mu     sync.Mutex
+	c      chan []byte
+	closed bool
+}
+
+func (f *latestFrame) Write(frame []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, net.ErrClosed
+	}
+	select {
+	case <-f.c:
+	default:
+	}
+	f.c <- append([]byte(nil), frame...)
+	return len(frame), nil
+}
+
+// close ends the sender once it has sent the last frame
+func (f *latestFrame) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	close(f.c)
+}
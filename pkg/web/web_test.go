@@ -0,0 +1,227 @@
+package web
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dockforward "dockforward/pkg"
+
+	"golang.org/x/net/websocket"
+)
+
+// fakeTerminal draws a frame listing the keys typed so far on every mirror
+type fakeTerminal struct {
+	mu      sync.Mutex
+	mirrors map[*io.Writer]bool
+	typed   string
+}
+
+func (f *fakeTerminal) AddMirror(w io.Writer) func() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mirrors == nil {
+		f.mirrors = make(map[*io.Writer]bool)
+	}
+	key := &w
+	f.mirrors[key] = true
+	w.Write([]byte("typed: " + f.typed))
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.mirrors, key)
+	}
+}
+
+func (f *fakeTerminal) HandleKeys(keys ...dockforward.Key) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		switch key.Type {
+		case dockforward.KeyRune:
+			f.typed += string(key.Rune)
+		case dockforward.KeyDown:
+			f.typed += "<down>"
+		case dockforward.KeyCtrlC:
+			f.typed += "<ctrl-c>"
+		}
+	}
+	for w := range f.mirrors {
+		(*w).Write([]byte("typed: " + f.typed))
+	}
+}
+
+func (f *fakeTerminal) mirrorCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.mirrors)
+}
+
+// dial opens the page's WebSocket on server, as a tab loaded from it would
+func dial(t *testing.T, server *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	ws, err := websocket.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/ws"+query, "", server.URL)
+	if err != nil {
+		t.Fatalf("failed to open WebSocket: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// receive waits for a frame on ws
+func receive(t *testing.T, ws *websocket.Conn) string {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frame string
+	if err := websocket.Message.Receive(ws, &frame); err != nil {
+		t.Fatalf("no frame received: %v", err)
+	}
+	return frame
+}
+
+func TestTabsShareSession(t *testing.T) {
+	terminal := &fakeTerminal{}
+	server := httptest.NewServer(NewHandler(terminal, "", ""))
+	t.Cleanup(server.Close)
+
+	first, second := dial(t, server, ""), dial(t, server, "")
+	for _, ws := range []*websocket.Conn{first, second} {
+		if got := receive(t, ws); got != "typed: " {
+			t.Errorf("first frame = %q, want the current screen", got)
+		}
+	}
+
+	// Ctrl+C is dropped, an arrow key's escape sequence arrives whole
+	if err := websocket.Message.Send(first, "j\x03\x1b[B"); err != nil {
+		t.Fatal(err)
+	}
+	for _, ws := range []*websocket.Conn{first, second} {
+		if got := receive(t, ws); got != "typed: j<down>" {
+			t.Errorf("frame after typing = %q, want j and down in every tab", got)
+		}
+	}
+
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for terminal.mirrorCount() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := terminal.mirrorCount(); got != 1 {
+		t.Errorf("%d tabs mirrored after one closed, want 1", got)
+	}
+}
+
+func TestPageAndToken(t *testing.T) {
+	server := httptest.NewServer(NewHandler(&fakeTerminal{}, "secret", ""))
+	t.Cleanup(server.Close)
+
+	for query, want := range map[string]int{"": http.StatusUnauthorized, "?token=wrong": http.StatusUnauthorized, "?token=secret": http.StatusOK} {
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		resp, err := client.Get(server.URL + "/" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("GET /%s = %d, want %d", query, resp.StatusCode, want)
+		}
+		if want != http.StatusOK {
+			continue
+		}
+		// The page draws the terminal itself, loading nothing from elsewhere
+		if !strings.Contains(string(body), `id="terminal"`) || strings.Contains(string(body), "src=") || strings.Contains(string(body), "://cdn") {
+			t.Errorf("page doesn't draw the terminal itself")
+		}
+		if csp := resp.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'sha256-") || !strings.Contains(csp, "default-src 'none'") {
+			t.Errorf("page served with policy %q, want only its own script allowed", csp)
+		}
+		// The token moves to a cookie scripts can't read, out of the address
+		if resp.Request.URL.RawQuery != "" {
+			t.Errorf("page left at %s, want the token dropped", resp.Request.URL)
+		}
+		cookie := resp.Request.Header.Get("Cookie")
+		if cookie != tokenCookie+"=secret" {
+			t.Errorf("page reloaded with cookie %q", cookie)
+		}
+		if setCookie := resp.Request.Response.Header.Get("Set-Cookie"); !strings.Contains(setCookie, "HttpOnly") || !strings.Contains(setCookie, "SameSite=Strict") {
+			t.Errorf("token cookie set as %q, want HttpOnly and SameSite=Strict", setCookie)
+		}
+
+		config, err := websocket.NewConfig(strings.Replace(server.URL, "http", "ws", 1)+"/ws", server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Header.Set("Cookie", cookie)
+		ws, err := websocket.DialConfig(config)
+		if err != nil {
+			t.Fatalf("WebSocket with the token cookie refused: %v", err)
+		}
+		ws.Close()
+	}
+
+	if _, err := websocket.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/ws", "", server.URL); err == nil {
+		t.Error("WebSocket without the token opened")
+	}
+	dial(t, server, "?token=secret")
+}
+
+func TestOtherOriginsRefused(t *testing.T) {
+	server := httptest.NewServer(NewHandler(&fakeTerminal{}, "", ""))
+	t.Cleanup(server.Close)
+
+	if _, err := websocket.Dial(strings.Replace(server.URL, "http", "ws", 1)+"/ws", "", "https://evil.example.com"); err == nil {
+		t.Error("WebSocket from another site's page opened")
+	}
+}
+
+func TestOtherHostsRefused(t *testing.T) {
+	server := httptest.NewServer(NewHandler(&fakeTerminal{}, "", ""))
+	t.Cleanup(server.Close)
+
+	// A rebound name reaches the server's address, but says which name it used
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "evil.example.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMisdirectedRequest {
+		t.Errorf("GET / for another host = %d, want %d", resp.StatusCode, http.StatusMisdirectedRequest)
+	}
+
+	config, err := websocket.NewConfig("ws://evil.example.com/ws", "http://evil.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := websocket.NewClient(config, conn); err == nil {
+		t.Error("WebSocket for another host opened")
+	}
+}
+
+func TestServeNeedsTokenBeyondLoopback(t *testing.T) {
+	if _, err := Serve("0.0.0.0:0", "", &fakeTerminal{}); err == nil {
+		t.Error("served on every address without a token")
+	}
+	server, err := Serve("127.0.0.1:0", "", &fakeTerminal{})
+	if err != nil {
+		t.Fatalf("failed to serve on loopback without a token: %v", err)
+	}
+	server.Close()
+}
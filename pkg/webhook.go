@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookAttempts is how many times a delivery is tried before it's given up on
+const webhookAttempts = 4
+
+// WebhookPayload is the body posted to a server's webhook when a service's health changes
+type WebhookPayload struct {
+	Server    string    `json:"server"`
+	Service   string    `json:"service"`
+	OldHealth string    `json:"oldHealth"`
+	NewHealth string    `json:"newHealth"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Webhook posts a server's health transitions to a URL, signed with a shared secret. Its
+// methods do nothing on a nil webhook, so callers don't have to check.
+type Webhook struct {
+	url     string
+	secret  string
+	client  *http.Client
+	backoff time.Duration // Wait before the first retry, doubling for each one after
+	now     func() time.Time
+}
+
+// NewWebhook creates a webhook posting to url, signing bodies with secret unless it's
+// empty. It returns nil when url is empty.
+func NewWebhook(url, secret string) *Webhook {
+	if url == "" {
+		return nil
+	}
+	return &Webhook{
+		url:     url,
+		secret:  secret,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		backoff: time.Second,
+		now:     time.Now,
+	}
+}
+
+// Check posts each service on server that turned unhealthy, or recovered, since the
+// previous snapshot. Services that only just appeared have nothing to compare against.
+func (w *Webhook) Check(server string, previous, current map[string]serviceSnapshot) {
+	if w == nil {
+		return
+	}
+	for name, now := range current {
+		before, ok := previous[name]
+		if !ok || isUnhealthy(before.health) == isUnhealthy(now.health) {
+			continue
+		}
+		payload := WebhookPayload{Server: server, Service: name, OldHealth: before.health, NewHealth: now.health, Timestamp: w.now()}
+		go func() {
+			if err := w.Deliver(payload); err != nil {
+				logWarn("%v", err)
+			}
+		}()
+	}
+}
+
+// Deliver posts payload, retrying with exponential backoff until it's accepted or
+// webhookAttempts have failed
+func (w *Webhook) Deliver(payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %v", err)
+	}
+	delay := w.backoff
+	for attempt := 1; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			return nil
+		}
+		if attempt == webhookAttempts {
+			return fmt.Errorf("webhook for %s gave up after %d attempts: %v", payload.Service, attempt, err)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends one delivery of body, failing unless the endpoint accepts it
+func (w *Webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		req.Header.Set("X-Dockforward-Signature", SignWebhook(body, w.secret))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the X-Dockforward-Signature of body: its HMAC-SHA256 with secret,
+// hex encoded. Receivers compute the same to check a delivery came from the monitor.
+func SignWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the deliveries posted to it, failing the first fails of them
+type webhookReceiver struct {
+	mu         sync.Mutex
+	fails      int
+	attempts   int
+	payloads   []WebhookPayload
+	signatures []string
+	bodies     [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	if r.attempts <= r.fails {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	var payload WebhookPayload
+	json.Unmarshal(body, &payload)
+	r.payloads = append(r.payloads, payload)
+	r.signatures = append(r.signatures, req.Header.Get("X-Dockforward-Signature"))
+	r.bodies = append(r.bodies, body)
+}
+
+func newTestWebhook(t *testing.T, receiver *webhookReceiver, secret string) *Webhook {
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	webhook := NewWebhook(server.URL, secret)
+	webhook.backoff = time.Millisecond
+	return webhook
+}
+
+func TestWebhookDeliverRetries(t *testing.T) {
+	receiver := &webhookReceiver{fails: 2}
+	webhook := newTestWebhook(t, receiver, "s3cret")
+	payload := WebhookPayload{Server: "prod", Service: "web", OldHealth: HealthHealthy, NewHealth: HealthUnhealthy}
+
+	if err := webhook.Deliver(payload); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if receiver.attempts != 3 || len(receiver.payloads) != 1 {
+		t.Fatalf("%d attempts delivering %d payloads, want the third accepted", receiver.attempts, len(receiver.payloads))
+	}
+	if got := receiver.payloads[0]; got.Service != "web" || got.NewHealth != HealthUnhealthy {
+		t.Errorf("payload = %+v, want web turning Unhealthy", got)
+	}
+	if want := SignWebhook(receiver.bodies[0], "s3cret"); receiver.signatures[0] != want {
+		t.Errorf("signature = %q, want %q", receiver.signatures[0], want)
+	}
+
+	failing := &webhookReceiver{fails: 10}
+	if err := newTestWebhook(t, failing, "").Deliver(payload); err == nil {
+		t.Error("Deliver succeeded although every attempt failed")
+	}
+	if failing.attempts != webhookAttempts {
+		t.Errorf("%d attempts, want %d", failing.attempts, webhookAttempts)
+	}
+
+	if NewWebhook("", "s3cret") != nil {
+		t.Error("NewWebhook without a URL returned a webhook")
+	}
+}
+
+func TestWebhookCheck(t *testing.T) {
+	receiver := &webhookReceiver{}
+	webhook := newTestWebhook(t, receiver, "")
+
+	previous := map[string]serviceSnapshot{"web": {health: HealthHealthy}, "db": {health: HealthExited}, "cache": {health: HealthStarting}}
+	current := map[string]serviceSnapshot{"web": {health: HealthUnhealthy}, "db": {health: HealthRunning}, "cache": {health: HealthHealthy}, "new": {health: HealthDead}}
+	webhook.Check("prod", previous, current)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		receiver.mu.Lock()
+		delivered := len(receiver.payloads)
+		receiver.mu.Unlock()
+		if delivered >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	got := make(map[string]string)
+	for _, payload := range receiver.payloads {
+		got[payload.Service] = payload.OldHealth + "->" + payload.NewHealth
+	}
+	want := map[string]string{"web": "Healthy->Unhealthy", "db": "Exited->Running"}
+	if len(got) != len(want) || got["web"] != want["web"] || got["db"] != want["db"] {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	if receiver.signatures[0] != "" {
+		t.Error("delivery without a secret was signed")
+	}
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// wslSafePath matches socket paths that can be passed to wsl.exe unquoted
+var wslSafePath = regexp.MustCompile(`^[A-Za-z0-9/._-]+$`)
+
+// wslDistroName matches the distro names wsl.exe accepts
+var wslDistroName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// errNoDeadline is returned by sessionConn, whose SSH session can't time out reads or writes
+var errNoDeadline = errors.New("deadlines are not supported over a WSL2 tunnel")
+
+// wslExe returns the wsl.exe invocation for distro, the default distro if it's ""
+func wslExe(distro string) string {
+	if distro == "" {
+		return "wsl.exe"
+	}
+	return "wsl.exe -d " + distro
+}
+
+// wslCommand returns the Windows command that runs cmd with sh inside a WSL2 distro. The
+// Windows host's sshd runs it through cmd.exe or PowerShell, whose quoting differs from
+// sh's, so cmd is passed base64-encoded and is left without stdin.
+func wslCommand(distro, cmd string) string {
+	return fmt.Sprintf(`%s -- sh -c "echo %s | base64 -d | sh"`, wslExe(distro), base64.StdEncoding.EncodeToString([]byte(cmd)))
+}
+
+// wslRunner runs commands inside a WSL2 distro over a connection to its Windows host
+type wslRunner struct {
+	runner commandRunner
+	distro string
+}
+
+func (w wslRunner) RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	return w.runner.RunCommandContext(ctx, wslCommand(w.distro, cmd))
+}
+
+// wslDialer connects to Unix sockets inside a WSL2 distro, which the Windows host's sshd
+// can't forward to, by running socat in the distro over an SSH session per connection
+type wslDialer struct {
+	client *SSHClient // Asked for its connection per dial, so a reconnect carries over
+	distro string
+}
+
+func (w *wslDialer) Dial(network, addr string) (net.Conn, error) {
+	if network != "unix" {
+		return nil, fmt.Errorf("unsupported network %s over a WSL2 tunnel", network)
+	}
+	if !wslSafePath.MatchString(addr) {
+		return nil, fmt.Errorf("unsupported socket path %q over a WSL2 tunnel", addr)
+	}
+	session, err := w.client.GetClient().NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to open WSL2 tunnel: %v", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to open WSL2 tunnel: %v", err)
+	}
+	if err := session.Start(wslExe(w.distro) + " -- socat - UNIX-CONNECT:" + addr); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start socat in WSL2: %v", err)
+	}
+	return &sessionConn{session: session, stdin: stdin, stdout: stdout, addr: wslAddr(addr)}, nil
+}
+
+// sessionConn is a connection carried over an SSH session's stdin and stdout
+type sessionConn struct {
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	addr    wslAddr
+}
+
+func (c *sessionConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *sessionConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+// Close ends the session, which stops socat
+func (c *sessionConn) Close() error {
+	c.stdin.Close()
+	return c.session.Close()
+}
+
+func (c *sessionConn) LocalAddr() net.Addr                { return c.addr }
+func (c *sessionConn) RemoteAddr() net.Addr               { return c.addr }
+func (c *sessionConn) SetDeadline(t time.Time) error      { return errNoDeadline }
+func (c *sessionConn) SetReadDeadline(t time.Time) error  { return errNoDeadline }
+func (c *sessionConn) SetWriteDeadline(t time.Time) error { return errNoDeadline }
+
+// wslAddr is the path of a socket inside a WSL2 distro
+type wslAddr string
+
+func (a wslAddr) Network() string { return "unix" }
+func (a wslAddr) String() string  { return string(a) }
+
+// UseWSL2 reaches Docker inside a WSL2 distro on the Windows host the client is connected
+// to, "" for the default distro. Call it before Start, which looks for the socket there.
+func (d *DockerClient) UseWSL2(distro string) error {
+	if distro != "" && !wslDistroName.MatchString(distro) {
+		return fmt.Errorf("invalid WSL2 distro name %q", distro)
+	}
+	sshClient, ok := d.sshClient.(*SSHClient)
+	if !ok {
+		return fmt.Errorf("WSL2 hosts can only be reached over SSH")
+	}
+	d.dialer = &wslDialer{client: sshClient, distro: distro}
+	d.runner = wslRunner{runner: sshClient, distro: distro}
+	return nil
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// recordingRunner records the commands it's asked to run
+type recordingRunner struct {
+	commands []string
+}
+
+func (r *recordingRunner) RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	r.commands = append(r.commands, cmd)
+	return "", nil
+}
+
+func TestWSLCommand(t *testing.T) {
+	if _, err := exec.LookPath("base64"); err != nil {
+		t.Skip("base64 is not installed")
+	}
+	cmd := wslCommand("", `printf '%s|%s\n' "a b" 'c"d'`)
+	inner, ok := strings.CutPrefix(cmd, "wsl.exe -- ")
+	if !ok {
+		t.Fatalf("wslCommand = %q, want it run with wsl.exe", cmd)
+	}
+	// Inside the distro the arguments after -- run as they would in any shell
+	output, err := exec.Command("sh", "-c", inner).CombinedOutput()
+	if err != nil {
+		t.Fatalf("running %q failed: %v: %s", inner, err, output)
+	}
+	if string(output) != "a b|c\"d\n" {
+		t.Errorf("output = %q, want the quoting intact", output)
+	}
+	if strings.ContainsAny(inner[len(`sh -c "`):len(inner)-1], `"'$%`) {
+		t.Errorf("%q passes characters a Windows shell would interpret", inner)
+	}
+
+	if got := wslCommand("Ubuntu-22.04", "true"); !strings.HasPrefix(got, "wsl.exe -d Ubuntu-22.04 -- ") {
+		t.Errorf("wslCommand with a distro = %q", got)
+	}
+}
+
+func TestWSLRunner(t *testing.T) {
+	runner := &recordingRunner{}
+	wsl := wslRunner{runner: runner, distro: "Debian"}
+	wsl.RunCommandContext(context.Background(), "id -u")
+	if len(runner.commands) != 1 || runner.commands[0] != wslCommand("Debian", "id -u") {
+		t.Errorf("ran %q, want the command wrapped in wsl.exe", runner.commands)
+	}
+}
+
+func TestUseWSL2(t *testing.T) {
+	d := &DockerClient{sshClient: &SSHClient{}}
+	if err := d.UseWSL2("Ubuntu & calc"); err == nil {
+		t.Error("UseWSL2 accepted a distro name a shell would interpret")
+	}
+	if err := d.UseWSL2("Ubuntu"); err != nil {
+		t.Fatalf("UseWSL2 failed: %v", err)
+	}
+	if _, ok := d.dialer.(*wslDialer); !ok {
+		t.Errorf("dialer = %T, want a WSL2 tunnel", d.dialer)
+	}
+	if _, err := d.dialer.Dial("unix", "/run/docker sock; calc"); err == nil {
+		t.Error("dialed a socket path a shell would interpret")
+	}
+}